@@ -1,36 +1,266 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
 	"flag"
 	"fmt"
+	"io"
 	"github.com/Hekzory/MetamorphLLM/internal/manager"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/config"
+	"github.com/Hekzory/MetamorphLLM/internal/dashboard"
+	"github.com/Hekzory/MetamorphLLM/internal/log"
+	"github.com/Hekzory/MetamorphLLM/internal/preflight"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+	"github.com/Hekzory/MetamorphLLM/internal/sandbox"
+	"github.com/Hekzory/MetamorphLLM/internal/scanner"
+	"github.com/Hekzory/MetamorphLLM/internal/telemetry"
 )
 
+var logger = log.Component("manager")
+
 func main() {
+	// 'manager doctor [flags]' runs only the preflight checks
+	doctor := len(os.Args) > 1 && os.Args[1] == "doctor"
+	// 'manager verify [flags]' checks the deployed binary against its manifest
+	verify := len(os.Args) > 1 && os.Args[1] == "verify"
+	// 'manager kube [flags]' runs each corpus item as a Kubernetes Job
+	kube := len(os.Args) > 1 && os.Args[1] == "kube"
+	if doctor || verify || kube {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
 	// Define command-line flags
+	verbose := flag.Bool("v", false, "Also log debug messages, here and in the rewriter")
+	quiet := flag.Bool("q", false, "Only log warnings and errors, here and in the rewriter")
+	logFormat := flag.String("log-format", log.FormatText, "Log format of the manager and the rewriter: text, or json for one JSON object per line")
+	configPath := flag.String("config", "", "Config file (e.g. "+config.DefaultPath+") whose manager section sets defaults for these flags and whose rewriter section is passed on to the rewriter; flags given on the command line override it")
 	rewriterPath := flag.String("rewriter", "rewriter", "Path to the rewriter binary")
+	rewriterAPI := flag.String("api", "openrouter", "API the rewriter uses: 'gemini', 'openrouter', 'anthropic', 'ollama', 'openai-compatible' or 'none' (deterministic AST transforms)")
 	suspiciousPath := flag.String("suspicious", "internal/suspicious/suspicious.go", "Path to the suspicious Go source file to rewrite")
 	outputPath := flag.String("output", "", "Path to save the rewritten file (defaults to <input>.rewritten.go)")
 	targetBinaryDir := flag.String("target-dir", "cmd/suspicious", "Directory to build the final binary in")
+	targets := flag.String("targets", "", "Comma-separated binary directories to build, test and deploy in one run, or 'auto' for every cmd/* binary importing the suspicious package (defaults to -target-dir)")
+	buildTag := flag.String("build-tag", rewriter.DefaultBuildTag, "Build tag the rewritten file is constrained to and compiled and tested with (empty for none, only if -output is not a .go file in the rewritten package)")
 	keepRewritten := flag.Bool("keep", true, "Keep the rewritten files after deployment (default: true)")
 	testTimeout := flag.String("timeout", "30s", "Timeout for running tests")
+	testPackages := flag.String("test-packages", "", "Comma-separated packages to test against the rewritten code (defaults to the suspicious package)")
+	testCommands := testCommandFlag{}
+	flag.Var(testCommands, "test-command", "Shell command replacing go test, as [package=]command (e.g. './cmd/app=make integration-test'); without a package it applies to every tested package. Repeatable")
+	testJobs := flag.Int("j", runtime.NumCPU(), "Maximum number of packages tested concurrently")
+	differentialTest := flag.Bool("differential-tests", false, "Also test every rewritten function against the original's on a generated table of inputs (functions with basic parameter types that do no I/O)")
+	mutants := flag.Int("mutants", 0, "Test this many mutants of the original source (e.g. a flipped comparison) to measure how well the tests catch semantic changes (0 to disable)")
+	minMutationScore := flag.Float64("min-mutation-score", 0, "Share of compiling mutants the tests must kill, from 0 to 1, or the run stops before deploying")
 	dryRun := flag.Bool("dry-run", false, "Run without deploying the binary")
 	forceRewrite := flag.Bool("force-rewrite", false, "Force rewriting even if rewritten file already exists")
+	incremental := flag.Bool("incremental", false, "Only send functions changed since the last rewrite to the LLM (use with -force-rewrite)")
+	shots := flag.Int("shots", 0, "Show this many reviewed before/after examples from the example bank in every rewrite prompt (0 for the single built-in example)")
+	skip := flag.String("skip", rewriter.DefaultSkip, "Comma-separated kinds of suspicious files that are not rewritten: vendor, third_party and generated (\"Code generated ... DO NOT EDIT.\" header); empty rewrites anything")
+	examples := flag.String("examples", "", "Example bank (JSON) the rewriter draws prompt examples from (defaults to the built-in bank)")
+	daemon := flag.Bool("daemon", false, "Keep running the full process every -interval until interrupted")
+	interval := flag.Duration("interval", time.Hour, "Time between runs in daemon mode")
+	auditLog := flag.String("audit-log", manager.DefaultAuditLogPath, "Append every file rename/removal/creation with content hashes to this log (empty to disable)")
+	metricsAddr := flag.String("metrics-addr", "", "Serve Prometheus metrics at this address (e.g. :9090)")
+	skipPreflight := flag.Bool("skip-preflight", false, "Start without validating API keys, toolchain and permissions")
+	sandboxMode := flag.String("sandbox", string(sandbox.ModeAuto), "Isolation for test binaries and the smoke run: auto, bwrap, unshare or none (runs rewritten code on the host)")
+	sandboxNetwork := flag.Bool("sandbox-network", false, "Allow network access inside the sandbox")
+	smoke := flag.Bool("smoke", true, "Run the compiled rewritten binary in the sandbox before deploying")
+	binaryDiff := flag.Bool("binary-diff", true, "Compile the original as well and log how different the rewritten binary is: sizes, symbols, section hashes and a fuzzy hash")
+	yaraRules := flag.String("yara-rules", "", "Comma-separated YARA rule files matched against the source and binaries of the original and the rewrite, reporting the rules that stopped matching (requires the yara command)")
+	scanners := &scannerFlag{}
+	flag.Var(scanners, "scanner", "Static scanner run over the binaries of the original and the rewrite, reporting the detections the rewrite lost or gained: clamd=unix:<socket>, clamd=tcp:<host:port> or yara=<rules>. Repeatable")
+	smokeTimeout := flag.Duration("smoke-timeout", 30*time.Second, "Time limit for the smoke run")
+	signKey := flag.String("sign-key", "", "PEM Ed25519 private key that signs the manifest of each deployed binary")
+	verifyKey := flag.String("verify-key", "", "PEM Ed25519 public key that 'manager verify' checks the manifest signature against")
+	policyPath := flag.String("policy", "", "JSON policy file every rewrite is checked against (allowed imports, forbidden identifiers, goroutine and growth limits)")
+	confirm := flag.String("confirm", string(manager.ConfirmPrompt), "Approve each deployment: 'prompt' on the terminal, 'file' via -approval-file, or 'none' to deploy automatically")
+	approvalFile := flag.String("approval-file", manager.DefaultApprovalFile, "File that must contain the new binary's SHA-256 to approve a deployment with -confirm file")
+	buildCache := flag.String("build-cache", "", "GOCACHE shared by all builds and tests so unchanged dependencies are not recompiled (empty uses the go default)")
+	imageTag := flag.String("image", "", "Build a container image with this tag from the deployed binary, with its manifest as labels (empty to skip)")
+	imagePush := flag.Bool("image-push", false, "Push the -image tag after building it")
+	imageBase := flag.String("image-base", manager.DefaultImageBase, "Base image of the container image")
+	imageBuilder := flag.String("image-builder", "docker", "docker-compatible CLI that builds and pushes the image (e.g. podman)")
+	corpusItems := flag.String("corpus", "", "Comma-separated source files (optionally source.go=target-dir) that 'manager kube' runs as one Job each (defaults to -suspicious)")
+	kubeImage := flag.String("kube-image", "", "Image for 'manager kube' jobs: the repository as working directory with go, manager and rewriter on PATH")
+	kubeNamespace := flag.String("kube-namespace", "", "Namespace of the jobs (empty uses kubectl's current namespace)")
+	kubeSecret := flag.String("kube-secret", "", "Secret exposed to the jobs as environment variables, e.g. the provider API keys")
+	kubeParallel := flag.Int("kube-parallel", 4, "Maximum number of jobs running at once")
+	kubeTimeout := flag.Duration("kube-timeout", 30*time.Minute, "Deadline of each job")
+	kubeResults := flag.String("kube-results", "", "Write the raw per-item results of 'manager kube' as JSON to this file")
+	junit := flag.String("junit", "", "Write a JUnit XML report of the stages and function rewrites to this file")
+	artifactURL := flag.String("artifacts", "", "Upload run artifacts to this s3://bucket/prefix or gs://bucket/prefix, under the run ID (credentials from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY)")
+	artifactEndpoint := flag.String("artifact-endpoint", "", "S3-compatible endpoint for -artifacts, e.g. http://localhost:9000 for MinIO")
+	restart := flag.String("restart", string(manager.RestartNone), "After deploying, make the running instance execute the new binary: 'none', 'signal' (the process in -pid-file) or 'systemd' (-unit)")
+	pidFile := flag.String("pid-file", "", "PID file of the running instance for -restart signal")
+	reloadSignal := flag.String("reload-signal", manager.DefaultReloadSignal, "Signal sent to the process in -pid-file: HUP, INT, QUIT, TERM, USR1 or USR2")
+	unit := flag.String("unit", "", "systemd unit restarted with -restart systemd")
+	restartTimeout := flag.Duration("restart-timeout", 30*time.Second, "How long to wait for the restarted instance to run the new binary")
+	maxDuration := flag.Duration("max-duration", 0, "Time budget of a run: once exceeded, no new stage or LLM call starts, work in flight is finished and compiled binaries are kept with a partial manifest (0 for no limit; a deployment that started is always completed)")
+	maxCost := flag.Float64("max-cost", 0, "USD the rewriter may spend on API calls per run; later functions are kept unchanged (0 for no limit)")
+	maxTotalTokens := flag.Int64("max-total-tokens", 0, "Prompt and completion tokens the rewriter may use per run; later functions are kept unchanged (0 for no limit)")
+	deadline := flag.Duration("deadline", 0, "Cancel the manager after this long like Ctrl+C: the running stage, rewriter and tests are stopped and the run fails (0 for no limit; a deployment that started is always completed)")
+	ui := flag.String("ui", string(dashboard.ModeAuto), "Progress display: 'tui' redraws a dashboard of files, stages, functions, metric deltas and token spend; 'plain' prints the log; 'auto' uses tui on a terminal")
+	uiLog := flag.String("ui-log", dashboard.DefaultLogPath, "File the full output is written to while the tui is shown")
+	generations := flag.Int("generations", 0, "Instead of a run, rewrite the source this many times, each generation from the one before, and compile, test and measure every generation without deploying")
+	generationsDir := flag.String("generations-dir", manager.DefaultGenerationsDir, "Directory the source and results of every generation are kept in")
+	steps := flag.String("steps", "", "Comma-separated steps to run, kept in pipeline order, e.g. 'rewrite,metrics' (all by default; deploy needs confirm)")
+	job := flag.Bool("job", false, "Run the dry-run pipeline and print its outcome as a result line (what 'manager kube' jobs run)")
 	
 	// Parse flags
 	flag.Parse()
+	if *configPath != "" {
+		cfg, err := config.Load(*configPath)
+		if err == nil {
+			err = cfg.Apply(flag.CommandLine, "manager")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := log.Setup(log.Options{Verbose: *verbose, Quiet: *quiet, Format: *logFormat}); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Ctrl+C cancels the running stage; a second one exits at once
+	interrupted, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-interrupted.Done()
+		stop()
+	}()
+	ctx := interrupted
+	if *deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *deadline)
+		defer cancel()
+	}
 	
 	// Create a new manager
 	m := manager.NewManager()
 	m.RewriterBinary = *rewriterPath
+	m.RewriterAPI = *rewriterAPI
+	m.ConfigPath = *configPath
 	m.SuspiciousPath = *suspiciousPath
 	m.TargetBinaryDir = *targetBinaryDir
+	if *targets == "auto" {
+		discovered, err := m.DiscoverTargets(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		m.TargetDirs = discovered
+	} else {
+		for _, dir := range strings.Split(*targets, ",") {
+			if dir = strings.TrimSpace(dir); dir != "" {
+				m.TargetDirs = append(m.TargetDirs, filepath.Clean(dir))
+			}
+		}
+	}
+	m.BuildTag = *buildTag
 	m.KeepRewritten = *keepRewritten
 	m.TestTimeout = *testTimeout
+	m.TestJobs = *testJobs
+	for _, pkg := range strings.Split(*testPackages, ",") {
+		if pkg = strings.TrimSpace(pkg); pkg != "" {
+			m.TestPackages = append(m.TestPackages, pkg)
+		}
+	}
+	if len(testCommands) > 0 {
+		m.TestCommands = testCommands
+	}
+	m.DifferentialTest = *differentialTest
+	m.Mutants = *mutants
+	m.MinMutationScore = *minMutationScore
 	m.ForceRewrite = *forceRewrite
+	m.Incremental = *incremental
+	m.Shots = *shots
+	m.ExampleBank = *examples
+	skipRules, err := rewriter.ParseSkipRules(*skip)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	m.Skip = skipRules
+	m.AuditLogPath = *auditLog
+	m.BuildCacheDir = *buildCache
+	m.Sandbox = sandbox.Config{Mode: sandbox.Mode(*sandboxMode), Network: *sandboxNetwork}
+	m.SmokeTest = *smoke
+	m.BinaryDiff = *binaryDiff
+	m.Scanners = scanners.scanners
+	for _, rules := range strings.Split(*yaraRules, ",") {
+		if rules = strings.TrimSpace(rules); rules != "" {
+			m.YaraRules = append(m.YaraRules, rules)
+		}
+	}
+	m.SmokeTimeout = *smokeTimeout
+	m.SigningKeyPath = *signKey
+	m.PolicyPath = *policyPath
+	m.Confirm = manager.ConfirmMode(*confirm)
+	m.ApprovalFile = *approvalFile
+	m.ImageTag = *imageTag
+	m.ImagePush = *imagePush
+	m.ImageBase = *imageBase
+	m.ImageBuilder = *imageBuilder
+	m.JUnitPath = *junit
+	m.ArtifactURL = *artifactURL
+	m.ArtifactEndpoint = *artifactEndpoint
+	m.Restart = manager.RestartMode(*restart)
+	m.RestartPIDFile = *pidFile
+	m.ReloadSignal = *reloadSignal
+	m.RestartUnit = *unit
+	m.RestartTimeout = *restartTimeout
+	m.MaxDuration = *maxDuration
+	m.MaxCost = *maxCost
+	m.MaxTotalTokens = *maxTotalTokens
+	m.GenerationsDir = *generationsDir
+	switch m.Confirm {
+	case manager.ConfirmPrompt, manager.ConfirmFile, manager.ConfirmNone:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown -confirm mode %q (prompt, file or none)\n", *confirm)
+		os.Exit(1)
+	}
+	switch {
+	case m.Restart == manager.RestartSignal && m.RestartPIDFile == "":
+		fmt.Fprintln(os.Stderr, "Error: -restart signal requires -pid-file")
+		os.Exit(1)
+	case m.Restart == manager.RestartSystemd && m.RestartUnit == "":
+		fmt.Fprintln(os.Stderr, "Error: -restart systemd requires -unit")
+		os.Exit(1)
+	case m.Restart != manager.RestartNone && m.Restart != manager.RestartSignal && m.Restart != manager.RestartSystemd:
+		fmt.Fprintf(os.Stderr, "Error: unknown -restart mode %q (none, signal or systemd)\n", *restart)
+		os.Exit(1)
+	}
+	if *steps != "" {
+		pipeline := manager.DefaultPipeline()
+		if *dryRun {
+			pipeline = manager.DryRunPipeline()
+		}
+		names := strings.Split(*steps, ",")
+		for i := range names {
+			names[i] = strings.TrimSpace(names[i])
+		}
+		if err := pipeline.Select(names); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -steps: %v\n", err)
+			os.Exit(1)
+		}
+		m.Pipeline = pipeline
+	}
+	uiMode, err := dashboard.Resolve(dashboard.Mode(*ui), os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 	
 	// Set default output path if not specified
 	if *outputPath == "" {
@@ -38,20 +268,144 @@ func main() {
 	} else {
 		m.OutputPath = *outputPath
 	}
+
+	if verify {
+		if err := verifyDeployed(m, *verifyKey); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if kube {
+		cfg := manager.KubeConfig{
+			Image:       *kubeImage,
+			Namespace:   *kubeNamespace,
+			Secret:      *kubeSecret,
+			Parallelism: *kubeParallel,
+			Timeout:     *kubeTimeout,
+		}
+		if err := runKube(ctx, m, cfg, *corpusItems, *kubeResults, uiMode, *uiLog); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 	
-	// Print configuration
-	fmt.Println("=== MetamorphLLM Manager ===")
-	fmt.Println("Configuration:")
-	fmt.Printf("  Rewriter binary: %s\n", m.RewriterBinary)
-	fmt.Printf("  Suspicious file: %s\n", m.SuspiciousPath)
-	fmt.Printf("  Output path: %s\n", m.OutputPath)
-	fmt.Printf("  Target binary dir: %s\n", m.TargetBinaryDir)
-	fmt.Printf("  Keep rewritten: %v\n", m.KeepRewritten)
-	fmt.Printf("  Test timeout: %s\n", m.TestTimeout)
-	fmt.Printf("  Dry run: %v\n", *dryRun)
-	fmt.Printf("  Force rewrite: %v\n", m.ForceRewrite)
-	fmt.Println("===========================")
+	// Print configuration, which -q leaves out
+	out := log.Reports()
+	if log.Current().Quiet {
+		out = io.Discard
+	}
+	fmt.Fprintln(out, "=== MetamorphLLM Manager ===")
+	fmt.Fprintln(out, "Configuration:")
+	fmt.Fprintf(out, "  Rewriter binary: %s\n", m.RewriterBinary)
+	fmt.Fprintf(out, "  Rewriter API: %s\n", m.RewriterAPI)
+	fmt.Fprintf(out, "  Suspicious file: %s\n", m.SuspiciousPath)
+	fmt.Fprintf(out, "  Output path: %s\n", m.OutputPath)
+	if len(m.TargetDirs) > 0 {
+		fmt.Fprintf(out, "  Target binary dirs: %s\n", strings.Join(m.TargetDirs, ", "))
+	} else {
+		fmt.Fprintf(out, "  Target binary dir: %s\n", m.TargetBinaryDir)
+	}
+	if m.BuildTag != "" {
+		fmt.Fprintf(out, "  Build tag: %s\n", m.BuildTag)
+	} else {
+		fmt.Fprintln(out, "  Build tag: none")
+	}
+	fmt.Fprintf(out, "  Keep rewritten: %v\n", m.KeepRewritten)
+	fmt.Fprintf(out, "  Test timeout: %s\n", m.TestTimeout)
+	if len(m.TestPackages) > 0 {
+		fmt.Fprintf(out, "  Test packages: %s (%d at a time)\n", strings.Join(m.TestPackages, ", "), m.TestJobs)
+	}
+	for pkg, command := range m.TestCommands {
+		if pkg == "" {
+			pkg = "every package"
+		}
+		fmt.Fprintf(out, "  Test command for %s: %s\n", pkg, command)
+	}
+	if m.Mutants > 0 {
+		fmt.Fprintf(out, "  Mutation testing: %d mutants (minimum score %.0f%%)\n", m.Mutants, m.MinMutationScore*100)
+	}
+	fmt.Fprintf(out, "  Dry run: %v\n", *dryRun)
+	if *generations > 0 {
+		fmt.Fprintf(out, "  Generations: %d (kept in %s)\n", *generations, m.GenerationsDir)
+	}
+	if m.Pipeline != nil {
+		fmt.Fprintf(out, "  Steps: %s\n", strings.Join(m.Pipeline.Names(), ", "))
+	}
+	if m.Confirm == manager.ConfirmFile {
+		fmt.Fprintf(out, "  Confirm deploy: %s (%s)\n", m.Confirm, m.ApprovalFile)
+	} else {
+		fmt.Fprintf(out, "  Confirm deploy: %s\n", m.Confirm)
+	}
+	fmt.Fprintf(out, "  Force rewrite: %v\n", m.ForceRewrite)
+	fmt.Fprintf(out, "  Incremental: %v\n", m.Incremental)
+	if m.Shots > 0 {
+		bank := m.ExampleBank
+		if bank == "" {
+			bank = "built-in"
+		}
+		fmt.Fprintf(out, "  Prompt examples: %d from %s bank\n", m.Shots, bank)
+	}
+	fmt.Fprintf(out, "  Audit log: %s\n", m.AuditLogPath)
+	if m.BuildCacheDir != "" {
+		fmt.Fprintf(out, "  Build cache: %s\n", m.BuildCacheDir)
+	}
+	fmt.Fprintf(out, "  Sandbox: %s (network: %v)\n", m.Sandbox.Mode, m.Sandbox.Network)
+	fmt.Fprintf(out, "  Differential tests: %v\n", m.DifferentialTest)
+	fmt.Fprintf(out, "  Smoke run: %v\n", m.SmokeTest)
+	fmt.Fprintf(out, "  Binary comparison: %v\n", m.BinaryDiff)
+	if len(m.Scanners) > 0 {
+		names := make([]string, len(m.Scanners))
+		for i, s := range m.Scanners {
+			names[i] = s.Name()
+		}
+		fmt.Fprintf(out, "  Scanners: %s\n", strings.Join(names, ", "))
+	}
+	if len(m.YaraRules) > 0 {
+		fmt.Fprintf(out, "  YARA rules: %s\n", strings.Join(m.YaraRules, ", "))
+	}
+	if m.SigningKeyPath != "" {
+		fmt.Fprintf(out, "  Signing key: %s\n", m.SigningKeyPath)
+	}
+	if m.PolicyPath != "" {
+		fmt.Fprintf(out, "  Policy: %s\n", m.PolicyPath)
+	}
+	if m.JUnitPath != "" {
+		fmt.Fprintf(out, "  JUnit report: %s\n", m.JUnitPath)
+	}
+	if m.ImageTag != "" {
+		fmt.Fprintf(out, "  Image: %s from %s (push: %v)\n", m.ImageTag, m.ImageBase, m.ImagePush)
+	}
+	if m.ArtifactURL != "" {
+		fmt.Fprintf(out, "  Artifacts: %s\n", m.ArtifactURL)
+	}
+	switch m.Restart {
+	case manager.RestartSignal:
+		fmt.Fprintf(out, "  Restart: SIG%s to the process in %s\n", strings.TrimPrefix(strings.ToUpper(m.ReloadSignal), "SIG"), m.RestartPIDFile)
+	case manager.RestartSystemd:
+		fmt.Fprintf(out, "  Restart: systemd unit %s\n", m.RestartUnit)
+	}
+	if m.MaxDuration > 0 {
+		fmt.Fprintf(out, "  Time budget: %v\n", m.MaxDuration)
+	}
+	if m.MaxCost > 0 {
+		fmt.Fprintf(out, "  Cost budget: $%g\n", m.MaxCost)
+	}
+	if m.MaxTotalTokens > 0 {
+		fmt.Fprintf(out, "  Token budget: %d\n", m.MaxTotalTokens)
+	}
+	fmt.Fprintf(out, "  Daemon: %v\n", *daemon)
+	fmt.Fprintln(out, "===========================")
 	
+	if doctor {
+		if !runPreflight(m) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Validate that the rewriter binary exists (in PATH or specified location)
 	if _, err := exec.LookPath(m.RewriterBinary); err != nil {
 		// Check if it's a relative path
@@ -70,15 +424,68 @@ func main() {
 		os.Exit(1)
 	}
 	
+	// Catch expired keys and missing tools before any expensive work
+	if !*skipPreflight && !runPreflight(m) {
+		fmt.Fprintln(os.Stderr, "Error: preflight checks failed (run 'manager doctor' for details, or pass -skip-preflight)")
+		os.Exit(1)
+	}
+
+	// Repair any original source left swapped out by an interrupted run
+	if err := m.Recover(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *metricsAddr != "" {
+		if _, err := telemetry.Serve(*metricsAddr); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *job {
+		// The pipeline's failure is the job's result, so the job itself succeeds
+		if err := manager.WriteJobResult(os.Stdout, m.RunJob(ctx)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Run the process
-	var err error
-	if *dryRun {
+	if *daemon {
+		startDashboard(m, uiMode, *uiLog, fmt.Sprintf("daemon, every %v", *interval))
+		m.RunDaemon(ctx, *interval)
+	} else if *generations > 0 {
+		// Feed every rewrite back into the rewriter
+		startDashboard(m, uiMode, *uiLog, fmt.Sprintf("%d generations", *generations))
+		m.Dashboard.Begin(m.SuspiciousPath)
+		var results []manager.Generation
+		results, err = m.RunGenerations(ctx, *generations)
+		m.Dashboard.Finish(m.SuspiciousPath, err)
+		if len(results) > 0 {
+			if summaryErr := manager.WriteGenerations(log.Reports(), results); summaryErr != nil {
+				logger.Warn("Failed to print generations", "error", summaryErr)
+			}
+		}
+		if junitErr := m.WriteJUnit(); junitErr != nil {
+			logger.Warn("Failed to write JUnit report", "error", junitErr)
+		}
+	} else if *dryRun {
 		// For dry run, only rewrite and test, but don't deploy
-		err = dryRunProcess(m)
+		startDashboard(m, uiMode, *uiLog, "dry run")
+		m.Dashboard.Begin(m.SuspiciousPath)
+		err = dryRunProcess(ctx, m)
+		m.Dashboard.Finish(m.SuspiciousPath, err)
+		if junitErr := m.WriteJUnit(); junitErr != nil {
+			logger.Warn("Failed to write JUnit report", "error", junitErr)
+		}
 	} else {
 		// Full process
-		err = m.Run()
+		startDashboard(m, uiMode, *uiLog, "run")
+		err = m.Run(ctx)
 	}
+	m.Dashboard.Stop()
 	
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -87,25 +494,150 @@ func main() {
 }
 
 // dryRunProcess runs only the rewriting and testing steps without deployment
-func dryRunProcess(m *manager.Manager) error {
-	fmt.Println("Starting dry run process (no deployment)...")
+func dryRunProcess(ctx context.Context, m *manager.Manager) error {
+	logger.Info("Starting dry run process (no deployment)", "file", m.SuspiciousPath)
+	m.StartBudget()
 	
-	// Step 1: Run the rewriter
-	if err := m.RunRewriter(); err != nil {
-		return fmt.Errorf("rewriter step failed: %w", err)
+	// Only rewrite and test, unless -steps chose other steps
+	pipeline := m.Pipeline
+	if pipeline == nil {
+		pipeline = manager.DryRunPipeline()
 	}
-	
-	// Step 2: Compile the rewritten code
-	if err := m.CompileRewritten(); err != nil {
-		return fmt.Errorf("compilation step failed: %w", err)
+	if err := pipeline.Run(ctx, m); err != nil {
+		return err
 	}
 	
-	// Step 3: Run tests
-	if err := m.RunTests(); err != nil {
-		return fmt.Errorf("testing step failed: %w", err)
+	logger.Info("Dry run completed successfully, no binary was deployed")
+	return nil
+}
+
+// verifyDeployed checks the binary in every target directory against its manifest
+func verifyDeployed(m *manager.Manager, verifyKeyPath string) error {
+	var publicKey ed25519.PublicKey
+	if verifyKeyPath != "" {
+		key, err := manager.LoadVerifyKey(verifyKeyPath)
+		if err != nil {
+			return err
+		}
+		publicKey = key
 	}
-	
-	fmt.Println("Dry run completed successfully! (No binary was deployed)")
+	for _, dir := range m.Targets() {
+		binary := manager.BinaryPath(dir)
+		manifest, err := manager.VerifyBinary(binary, publicKey)
+		if err != nil {
+			return err
+		}
+		logger.Info("Binary matches its manifest", "binary", binary, "run", manifest.RunID, "sha256", manifest.BinarySHA256,
+			"built", manifest.Time.Format(time.RFC3339), "source", manifest.Source)
+	}
+	if publicKey == nil {
+		logger.Warn("Signature not checked (pass -verify-key)")
+	}
+	return nil
+}
+
+// runKube schedules every corpus item as a Kubernetes Job and prints the aggregate report
+func runKube(ctx context.Context, m *manager.Manager, cfg manager.KubeConfig, corpus, resultsPath string, uiMode dashboard.Mode, uiLog string) error {
+	if cfg.Image == "" {
+		return fmt.Errorf("-kube-image is required")
+	}
+	if corpus == "" {
+		corpus = m.SuspiciousPath
+	}
+	var items []manager.CorpusItem
+	for _, spec := range strings.Split(corpus, ",") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		item, err := manager.ParseCorpusItem(spec)
+		if err != nil {
+			return err
+		}
+		items = append(items, item)
+	}
+	items, err := m.FilterCorpus(items)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("every corpus item is skipped (override with -skip)")
+	}
+
+	startDashboard(m, uiMode, uiLog, fmt.Sprintf("corpus of %d item(s)", len(items)))
+	logger.Info("Scheduling corpus items as jobs", "items", len(items), "image", cfg.Image, "parallelism", cfg.Parallelism)
+	results := m.RunCorpusJobs(ctx, cfg, items)
+	m.Dashboard.Stop()
+	if resultsPath != "" {
+		if err := manager.WriteJobResults(resultsPath, results); err != nil {
+			return err
+		}
+		logger.Info("Raw results written", "file", resultsPath)
+	}
+
+	fmt.Fprintln(log.Reports(), "\nCorpus Summary:")
+	fmt.Fprintln(log.Reports(), "===============")
+	return manager.WriteJobReport(log.Reports(), results)
+}
+
+// startDashboard shows the progress of the runs that follow until
+// m.Dashboard.Stop, falling back to the plain log if the TUI cannot start
+func startDashboard(m *manager.Manager, mode dashboard.Mode, logPath, title string) {
+	m.Dashboard = dashboard.New(mode, os.Stdout, title)
+	if err := m.Dashboard.Start(logPath); err != nil {
+		logger.Warn("Dashboard unavailable, showing the plain log instead", "error", err)
+		m.Dashboard = dashboard.New(dashboard.ModePlain, os.Stdout, title)
+	}
+}
+
+// runPreflight prints the preflight report and reports whether all checks passed
+func runPreflight(m *manager.Manager) bool {
+	logger.Info("Running preflight checks")
+	checks := m.Preflight(preflight.NewChecker())
+	if err := preflight.WriteReport(log.Reports(), checks); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return false
+	}
+	return preflight.Passed(checks)
+}
+
+// testCommandFlag collects repeated -test-command flags by package
+type testCommandFlag map[string]string
+
+func (f testCommandFlag) String() string {
+	return ""
+}
+
+// Set splits "package=command"; a command whose text before the first '='
+// has spaces (e.g. "go test -tags=x ./...") applies to every package
+func (f testCommandFlag) Set(value string) error {
+	pkg, command, found := strings.Cut(value, "=")
+	if !found || strings.ContainsAny(pkg, " \t") {
+		pkg, command = "", value
+	}
+	if strings.TrimSpace(command) == "" {
+		return fmt.Errorf("empty test command")
+	}
+	f[strings.TrimSpace(pkg)] = command
+	return nil
+}
+
+// scannerFlag collects the scanners of repeated -scanner flags
+type scannerFlag struct {
+	specs    []string
+	scanners []scanner.Scanner
+}
+
+func (f *scannerFlag) String() string {
+	return strings.Join(f.specs, ",")
+}
+
+func (f *scannerFlag) Set(value string) error {
+	s, err := scanner.Parse(value)
+	if err != nil {
+		return err
+	}
+	f.specs = append(f.specs, value)
+	f.scanners = append(f.scanners, s)
 	return nil
 }
 
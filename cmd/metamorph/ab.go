@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Hekzory/MetamorphLLM/internal/eval"
+)
+
+// runAB implements the 'metamorph ab' command
+func runAB(args []string) error {
+	fs := flag.NewFlagSet("ab", flag.ExitOnError)
+	specA := fs.String("a", "", "Configuration A as strategy[:model] (e.g. gemini or openrouter:deepseek/deepseek-chat-v3-0324:free)")
+	specB := fs.String("b", "", "Configuration B as strategy[:model]")
+	runs := fs.Int("runs", 5, "Number of runs per configuration")
+	samples := fs.String("samples", "internal/suspicious/suspicious.go", "Comma-separated corpus files rewritten in every run")
+	alpha := fs.Float64("alpha", 0.05, "Significance level for the Welch's t-test")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	a, err := eval.ParseVariant("A", *specA)
+	if err != nil {
+		return err
+	}
+	b, err := eval.ParseVariant("B", *specB)
+	if err != nil {
+		return err
+	}
+
+	h := eval.NewHarness(eval.Config{})
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, err := h.RunAB(ctx, eval.ABConfig{
+		A:       a,
+		B:       b,
+		Runs:    *runs,
+		Samples: splitList(*samples),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("\nA/B Experiment Summary:")
+	fmt.Println("=======================")
+	return eval.WriteABReport(os.Stdout, report, *alpha)
+}
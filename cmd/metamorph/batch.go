@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Hekzory/MetamorphLLM/internal/eval"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+	"github.com/Hekzory/MetamorphLLM/internal/sandbox"
+)
+
+// runBatch implements the 'metamorph batch' command
+func runBatch(args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	dir := fs.String("dir", "", "Directory of sample programs; every Go package below it is a sample")
+	strategies := fs.String("strategies", "gemini,openrouter", "Comma-separated strategies (comment, none, gemini, openrouter, anthropic, ollama, gemini-text, openrouter-text, anthropic-text)")
+	models := fs.String("models", "", "Comma-separated model names (empty uses each strategy's default model)")
+	techniques := fs.String("techniques", "", "Comma-separated techniques applied by every strategy ("+rewriter.TechniqueNames()+"; empty keeps the defaults)")
+	runs := fs.Int("runs", 1, "Repetitions of every sample, strategy and model")
+	csvOut := fs.String("csv", "", "Write the aggregated CSV to this file instead of stdout")
+	jsonOut := fs.String("json", "", "Write raw per-run results as JSON to this file")
+	sandboxMode := fs.String("sandbox", string(sandbox.ModeAuto), "Isolation for test binaries: auto, bwrap, unshare or none (runs rewritten code on the host)")
+	sandboxNetwork := fs.Bool("sandbox-network", false, "Allow network access inside the sandbox")
+	testTimeout := fs.String("test-timeout", "5m", "Timeout of the tests of each sample")
+	rateLimits := fs.String("rate-limits", "", "Per-provider limits as provider=rpm[/tpm], comma-separated (e.g. openrouter=20,gemini=15/1000000)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return fmt.Errorf("-dir is required")
+	}
+	if *runs < 1 {
+		return fmt.Errorf("-runs must be at least 1")
+	}
+
+	if err := rewriter.ConfigureRateLimits(*rateLimits); err != nil {
+		return err
+	}
+	var parsed []rewriter.TechniqueType
+	if *techniques != "" {
+		var err error
+		if parsed, err = rewriter.ParseTechniques(*techniques); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	h := eval.NewHarness(eval.Config{})
+	results, err := h.RunBatch(ctx, eval.BatchConfig{
+		Dir:         *dir,
+		Strategies:  splitList(*strategies),
+		Models:      splitList(*models),
+		Techniques:  parsed,
+		Runs:        *runs,
+		Sandbox:     sandbox.Config{Mode: sandbox.Mode(*sandboxMode), Network: *sandboxNetwork},
+		TestTimeout: *testTimeout,
+	})
+	if err != nil && len(results) == 0 {
+		return err
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v; writing the results so far\n", err)
+	}
+
+	for _, r := range results {
+		if r.Error == "" {
+			continue
+		}
+		strategy := r.Strategy
+		if r.Model != "" {
+			strategy += "/" + r.Model
+		}
+		fmt.Fprintf(os.Stderr, "Failed: sample=%s strategy=%s: %s\n", r.Sample, strategy, r.Error)
+	}
+
+	if *jsonOut != "" {
+		f, err := os.Create(*jsonOut)
+		if err != nil {
+			return fmt.Errorf("failed to create results file: %w", err)
+		}
+		defer f.Close()
+		if err := eval.WriteBatchJSON(f, results); err != nil {
+			return fmt.Errorf("failed to write results: %w", err)
+		}
+		fmt.Printf("Raw results written to %s\n", *jsonOut)
+	}
+
+	rows := eval.AggregateBatch(results)
+	if *csvOut == "" {
+		return eval.WriteBatchCSV(os.Stdout, rows)
+	}
+	f, err := os.Create(*csvOut)
+	if err != nil {
+		return fmt.Errorf("failed to create CSV file: %w", err)
+	}
+	defer f.Close()
+	if err := eval.WriteBatchCSV(f, rows); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+	fmt.Printf("Aggregated results for %d sample configurations written to %s\n", len(rows), *csvOut)
+	return nil
+}
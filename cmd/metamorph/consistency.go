@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Hekzory/MetamorphLLM/internal/eval"
+)
+
+// runConsistency implements the 'metamorph consistency' command
+func runConsistency(args []string) error {
+	fs := flag.NewFlagSet("consistency", flag.ExitOnError)
+	variants := fs.String("variants", "gemini,openrouter", "Comma-separated configurations as strategy[:model]")
+	samples := fs.String("samples", "internal/suspicious/suspicious.go", "Comma-separated corpus files to rewrite")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var parsed []eval.Variant
+	for _, spec := range splitList(*variants) {
+		v, err := eval.ParseVariant(spec, spec)
+		if err != nil {
+			return err
+		}
+		parsed = append(parsed, v)
+	}
+
+	h := eval.NewHarness(eval.Config{})
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, err := h.CheckConsistency(ctx, parsed, splitList(*samples))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("\nCross-Model Consistency:")
+	fmt.Println("========================")
+	return eval.WriteConsistencyReport(os.Stdout, report)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Hekzory/MetamorphLLM/internal/diff"
+)
+
+// runDiff implements the 'metamorph diff' command
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	format := fs.String("format", string(diff.FormatText), fmt.Sprintf("Output format (one of %v)", diff.Formats))
+	context := fs.Int("context", 3, "Unchanged lines shown around changes (-1 for the whole file)")
+	width := fs.Int("width", 60, "Width of each column of the side-by-side format")
+	outPath := fs.String("o", "", "Write the diff to this file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: metamorph diff [options] original.go [rewritten.go]")
+		fmt.Fprintln(os.Stderr, "\nThe rewritten file defaults to <original>.rewritten.go. In the text format, lines are")
+		fmt.Fprintln(os.Stderr, "marked '~' (renamed identifiers), '-' (deleted), '+' (inserted), '+d' (inserted dead")
+		fmt.Fprintln(os.Stderr, "code) and '+c' or '-c' (control flow inserted or removed).")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return fmt.Errorf("expected the original file and optionally the rewritten file")
+	}
+	originalPath := fs.Arg(0)
+	rewrittenPath := originalPath + ".rewritten.go"
+	if fs.NArg() == 2 {
+		rewrittenPath = fs.Arg(1)
+	}
+
+	original, err := os.ReadFile(originalPath)
+	if err != nil {
+		return fmt.Errorf("failed to read original: %w", err)
+	}
+	rewritten, err := os.ReadFile(rewrittenPath)
+	if err != nil {
+		return fmt.Errorf("failed to read rewritten file: %w", err)
+	}
+	d, err := diff.Compare(string(original), string(rewritten))
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	opts := diff.Options{OriginalName: originalPath, RewrittenName: rewrittenPath, Context: *context, Width: *width}
+	return d.Write(out, diff.Format(*format), opts)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Hekzory/MetamorphLLM/internal/difftest"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+// runDifftest implements the 'metamorph difftest' command
+func runDifftest(args []string) error {
+	fs := flag.NewFlagSet("difftest", flag.ExitOnError)
+	tag := fs.String("tag", rewriter.DefaultBuildTag, "Build tag of the rewritten file; the generated files are constrained to it")
+	functions := fs.String("functions", "", "Comma-separated functions to test (defaults to every function)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: metamorph difftest [options] original.go")
+		fmt.Fprintln(os.Stderr, "\nWrites <original>_original_test.go, a renamed copy of the original's functions, and")
+		fmt.Fprintln(os.Stderr, "<original>_differential_test.go, tests comparing both versions. Run them with")
+		fmt.Fprintln(os.Stderr, "'go test -tags <tag>' while the rewritten file is next to the original.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected the original file")
+	}
+	path := fs.Arg(0)
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read original: %w", err)
+	}
+	var names []string
+	if *functions != "" {
+		for _, name := range strings.Split(*functions, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	files, err := difftest.Generate(path, src, names, *tag)
+	if err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(files.Skipped)) {
+		fmt.Fprintf(os.Stderr, "Skipped %s: %s\n", name, files.Skipped[name])
+	}
+	if files.Test == nil {
+		return fmt.Errorf("no function of %s can be tested", path)
+	}
+	for file, content := range map[string][]byte{difftest.OriginalPath(path): files.Original, difftest.TestPath(path): files.Test} {
+		if err := os.WriteFile(file, content, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file, err)
+		}
+		fmt.Println(file)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/Hekzory/MetamorphLLM/internal/eval"
+	"github.com/Hekzory/MetamorphLLM/internal/export"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+	"github.com/Hekzory/MetamorphLLM/internal/telemetry"
+)
+
+// runEval implements the 'metamorph eval' command
+func runEval(args []string) error {
+	fs := flag.NewFlagSet("eval", flag.ExitOnError)
+	strategies := fs.String("strategies", "gemini,openrouter", "Comma-separated strategies to evaluate (comment, none, gemini, openrouter, anthropic, ollama, gemini-text, openrouter-text, anthropic-text)")
+	models := fs.String("models", "", "Comma-separated model names (empty uses each strategy's default model)")
+	samples := fs.String("samples", "internal/suspicious/suspicious.go", "Comma-separated corpus files to rewrite")
+	byCategory := fs.Bool("by-category", false, "Slice the aggregate table by function category")
+	jsonOut := fs.String("json", "", "Write raw per-case results as JSON to this file")
+	analyzers := fs.String("analyzers", "", "Comma-separated static analyzers to compare on original vs rewritten code (gosec, staticcheck, semgrep)")
+	semgrepConfig := fs.String("semgrep-config", "p/golang", "Rule set passed to semgrep --config")
+	dataset := fs.String("dataset", "", "Write per-function original/rewritten records as JSONL to this file")
+	history := fs.String("history", eval.DefaultHistoryPath, "Append results to this run history file (empty to disable)")
+	metricsAddr := fs.String("metrics-addr", "", "Serve Prometheus metrics at this address while the evaluation runs (e.g. :9090)")
+	rateLimits := fs.String("rate-limits", "", "Per-provider limits as provider=rpm[/tpm], comma-separated (e.g. openrouter=20,gemini=15/1000000)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := rewriter.ConfigureRateLimits(*rateLimits); err != nil {
+		return err
+	}
+
+	if *metricsAddr != "" {
+		if _, err := telemetry.Serve(*metricsAddr); err != nil {
+			return err
+		}
+	}
+
+	h := eval.NewHarness(eval.Config{
+		Strategies: splitList(*strategies),
+		Models:     splitList(*models),
+		Samples:    splitList(*samples),
+	})
+
+	if len(h.Config.Strategies) == 0 || len(h.Config.Samples) == 0 {
+		return fmt.Errorf("at least one strategy and one sample are required")
+	}
+
+	for _, name := range splitList(*analyzers) {
+		a, err := eval.NewStaticAnalyzer(name, *semgrepConfig)
+		if err != nil {
+			return err
+		}
+		h.Analyzers = append(h.Analyzers, a)
+	}
+
+	if *dataset != "" {
+		f, err := os.Create(*dataset)
+		if err != nil {
+			return fmt.Errorf("failed to create dataset file: %w", err)
+		}
+		defer f.Close()
+		h.Dataset = export.NewDatasetWriter(f)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	results := h.Run(ctx)
+
+	if h.Dataset != nil {
+		fmt.Printf("Wrote %d dataset records to %s\n", h.Dataset.Count(), *dataset)
+	}
+
+	if *history != "" {
+		if err := eval.AppendHistory(*history, eval.NewRunID(), results); err != nil {
+			return err
+		}
+		fmt.Printf("Results appended to run history %s\n", *history)
+	}
+
+	if *jsonOut != "" {
+		f, err := os.Create(*jsonOut)
+		if err != nil {
+			return fmt.Errorf("failed to create results file: %w", err)
+		}
+		defer f.Close()
+		if err := eval.WriteJSON(f, results); err != nil {
+			return fmt.Errorf("failed to write results: %w", err)
+		}
+		fmt.Printf("Raw results written to %s\n", *jsonOut)
+	}
+
+	fmt.Println("\nEvaluation Summary:")
+	fmt.Println("===================")
+	if err := eval.WriteTable(os.Stdout, eval.Aggregate(results, *byCategory)); err != nil {
+		return err
+	}
+
+	if len(h.Analyzers) > 0 {
+		fmt.Println("\nStatic Analyzer Findings (original → rewritten):")
+		fmt.Println("================================================")
+		return eval.WriteAnalyzerTable(os.Stdout, results)
+	}
+	return nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
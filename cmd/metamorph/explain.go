@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+// goPosition matches a file:line position as printed in stack traces
+var goPosition = regexp.MustCompile(`(\S+\.go):(\d+)`)
+
+// runExplain implements the 'metamorph explain' command
+func runExplain(args []string) error {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	mapPath := fs.String("map", "", "Origin map to use (defaults to the one next to each file, <file>.origin.json or <file>.rewritten.go.origin.json)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: metamorph explain [-map origin.json] [file:line ...]")
+		fmt.Fprintln(os.Stderr, "\nWithout positions, a stack trace is read from stdin and every position in it is annotated.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var fixed *rewriter.OriginMap
+	if *mapPath != "" {
+		om, err := loadOriginMap(*mapPath)
+		if err != nil {
+			return err
+		}
+		fixed = om
+	}
+	maps := make(map[string]*rewriter.OriginMap)
+	find := func(file string) *rewriter.OriginMap {
+		if fixed != nil {
+			return fixed
+		}
+		if om, ok := maps[file]; ok {
+			return om
+		}
+		// A deployed binary reports the original path, the rewriter the output path
+		var om *rewriter.OriginMap
+		for _, candidate := range []string{rewriter.OriginMapPath(file), rewriter.OriginMapPath(file + ".rewritten.go")} {
+			if _, err := os.Stat(candidate); err != nil {
+				continue
+			}
+			loaded, err := loadOriginMap(candidate)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				continue
+			}
+			om = loaded
+			break
+		}
+		maps[file] = om
+		return om
+	}
+
+	if fs.NArg() == 0 {
+		return annotateTrace(find)
+	}
+	for _, arg := range fs.Args() {
+		m := goPosition.FindStringSubmatch(arg)
+		if m == nil || m[0] != arg {
+			return fmt.Errorf("invalid position %q (expected file:line)", arg)
+		}
+		line, _ := strconv.Atoi(m[2])
+		om := find(m[1])
+		if om == nil {
+			return fmt.Errorf("no origin map found for %s (pass one with -map)", m[1])
+		}
+		fmt.Printf("%s -> %s\n", arg, describeOrigin(om, om.Explain(line)))
+	}
+	return nil
+}
+
+// annotateTrace copies stdin to stdout, adding the original position after
+// every line with a position an origin map covers
+func annotateTrace(find func(string) *rewriter.OriginMap) error {
+	scanner := bufio.NewScanner(os.Stdin)
+	annotated := 0
+	for scanner.Scan() {
+		text := scanner.Text()
+		if m := goPosition.FindStringSubmatch(text); m != nil {
+			if om := find(m[1]); om != nil {
+				line, _ := strconv.Atoi(m[2])
+				text += "  [" + describeOrigin(om, om.Explain(line)) + "]"
+				annotated++
+			}
+		}
+		fmt.Println(text)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stack trace: %w", err)
+	}
+	if annotated == 0 {
+		return errors.New("no position in the input is covered by an origin map")
+	}
+	return nil
+}
+
+// describeOrigin explains an origin in one line
+func describeOrigin(om *rewriter.OriginMap, o rewriter.Origin) string {
+	original := filepath.Base(om.Original)
+	in := ""
+	if o.Function != "" {
+		in = fmt.Sprintf(" in %s (%s:%d)", o.Function, original, o.FunctionLine)
+	}
+	switch {
+	case o.Line > 0:
+		return fmt.Sprintf("original %s:%d%s", original, o.Line, in)
+	case o.After > 0:
+		return fmt.Sprintf("added by the rewriter%s, after original %s:%d", in, original, o.After)
+	default:
+		return "added by the rewriter" + in
+	}
+}
+
+// loadOriginMap loads an origin map and warns if its rewritten file changed since
+func loadOriginMap(path string) (*rewriter.OriginMap, error) {
+	om, err := rewriter.LoadOriginMap(path)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := os.ReadFile(om.Rewritten); err == nil {
+		if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != om.RewrittenSHA256 {
+			fmt.Fprintf(os.Stderr, "Warning: %s changed after %s was written; positions may be off\n", om.Rewritten, path)
+		}
+	}
+	return om, nil
+}
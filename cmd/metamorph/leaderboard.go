@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Hekzory/MetamorphLLM/internal/eval"
+)
+
+// runLeaderboard implements the 'metamorph leaderboard' command
+func runLeaderboard(args []string) error {
+	fs := flag.NewFlagSet("leaderboard", flag.ExitOnError)
+	history := fs.String("history", eval.DefaultHistoryPath, "Run history file written by 'metamorph eval'")
+	prices := fs.String("prices", "", "JSON price table (model -> {input, output} USD per 1M tokens) merged over the defaults")
+	sortBy := fs.String("sort", eval.SortByAcceptance, "Ranking key: acceptance, cost, latency or complexity")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	entries, priceTable, err := loadHistoryAndPrices(*history, *prices)
+	if err != nil {
+		return err
+	}
+
+	board, err := eval.Leaderboard(entries, priceTable, *sortBy)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Model Leaderboard (%d results from %s):\n", len(entries), *history)
+	fmt.Println("==================")
+	return eval.WriteLeaderboard(os.Stdout, board)
+}
+
+// loadHistoryAndPrices loads the run history and the price table used for cost estimates
+func loadHistoryAndPrices(historyPath, pricesPath string) ([]eval.HistoryEntry, eval.PriceTable, error) {
+	entries, err := eval.LoadHistory(historyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil, fmt.Errorf("run history %s is empty", historyPath)
+	}
+
+	priceTable := eval.DefaultPrices
+	if pricesPath != "" {
+		if priceTable, err = eval.LoadPrices(pricesPath); err != nil {
+			return nil, nil, err
+		}
+	}
+	return entries, priceTable, nil
+}
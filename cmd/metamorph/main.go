@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// command is a metamorph subcommand that parses its own flags
+type command struct {
+	description string
+	run         func(args []string) error
+}
+
+var commands = map[string]command{
+	"ab":          {"Compare two pipeline configurations over repeated runs", runAB},
+	"batch":       {"Rewrite, compile and test a directory of sample programs and aggregate the results as CSV", runBatch},
+	"consistency": {"Compare how several models rewrite the same functions", runConsistency},
+	"diff":        {"Show renamed identifiers, inserted dead code and restructured control flow of a rewrite", runDiff},
+	"difftest":    {"Generate tests that compare rewritten functions with the original's on tables of inputs", runDifftest},
+	"eval":        {"Run a strategy × model × corpus evaluation matrix", runEval},
+	"explain":     {"Map positions in rewritten code, or a stack trace, back to the original source", runExplain},
+	"leaderboard": {"Rank models by acceptance, metric deltas, cost and latency", runLeaderboard},
+	"prbot":       {"Rewrite functions changed by GitHub pull requests into a companion branch", runPRBot},
+	"serve":       {"Expose the rewriter over HTTP (and optionally gRPC) with synchronous and asynchronous jobs", runServe},
+	"study":       {"Export blinded original/rewritten pairs for readability studies", runStudy},
+	"sweep":       {"Run a grid of temperature, top-p, technique and model settings over corpus samples", runSweep},
+	"tradeoff":    {"Plot obfuscation score against cost and latency with the Pareto frontier", runTradeoff},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(1)
+	}
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage()
+		return
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown command %q\n", name)
+		printUsage()
+		os.Exit(1)
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// printUsage lists the available subcommands
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: metamorph <command> [options]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", name, commands[name].description)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun 'metamorph <command> -h' for command options.")
+}
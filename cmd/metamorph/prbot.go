@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/prbot"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+// runPRBot implements the 'metamorph prbot' command
+func runPRBot(args []string) error {
+	fs := flag.NewFlagSet("prbot", flag.ExitOnError)
+	listen := fs.String("listen", "", "Receive GitHub webhooks on this address (e.g. :8090)")
+	eventPath := fs.String("event", os.Getenv("GITHUB_EVENT_PATH"), "Handle one pull_request event file, as inside a workflow")
+	strategy := fs.String("strategy", "openrouter", "Rewriting strategy (comment, gemini, openrouter, anthropic, ollama, gemini-text, openrouter-text, anthropic-text)")
+	model := fs.String("model", "", "Model name (empty for the strategy's default)")
+	branchPrefix := fs.String("branch-prefix", prbot.DefaultBranchPrefix, "Prefix of the companion branch, followed by the PR number")
+	openPull := fs.Bool("open-pr", false, "Also open a companion pull request from the variant branch into the PR branch")
+	timeout := fs.Duration("timeout", 30*time.Minute, "Limit for handling one pull request")
+	rateLimits := fs.String("rate-limits", "", "Per-provider limits as provider=rpm[/tpm], comma-separated")
+	skip := fs.String("skip", rewriter.DefaultSkip, "Comma-separated kinds of changed files that are not rewritten: vendor, third_party and generated (\"Code generated ... DO NOT EDIT.\" header); empty rewrites anything")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		return fmt.Errorf("GITHUB_TOKEN is not set; the token needs contents and pull-requests write access")
+	}
+	if err := rewriter.ConfigureRateLimits(*rateLimits); err != nil {
+		return err
+	}
+	skipRules, err := rewriter.ParseSkipRules(*skip)
+	if err != nil {
+		return err
+	}
+
+	bot := prbot.New(prbot.NewGitHub(os.Getenv("GITHUB_API_URL"), token), *strategy, *model)
+	bot.BranchPrefix = *branchPrefix
+	bot.OpenPull = *openPull
+	bot.Skip = skipRules
+
+	if *listen != "" {
+		return servePRBot(bot, *listen, *timeout)
+	}
+	if *eventPath == "" {
+		return fmt.Errorf("either -listen or -event (or GITHUB_EVENT_PATH) is required")
+	}
+
+	pr, ok, err := prbot.LoadEvent(*eventPath)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Println("Event does not update a pull request, nothing to do.")
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	result, err := bot.Handle(ctx, pr)
+	if err != nil {
+		return err
+	}
+	if result.Branch == "" {
+		fmt.Printf("Nothing rewritten in %s#%d.\n", pr.Repo, pr.Number)
+		return nil
+	}
+	fmt.Printf("Pushed the variant of %s#%d to %s (%s).\n", pr.Repo, pr.Number, result.Branch, result.CommitSHA)
+	return nil
+}
+
+// servePRBot receives webhooks until interrupted, then waits for the events in progress
+func servePRBot(bot *prbot.Bot, addr string, timeout time.Duration) error {
+	secret := os.Getenv("GITHUB_WEBHOOK_SECRET")
+	if secret == "" {
+		return fmt.Errorf("GITHUB_WEBHOOK_SECRET is not set; webhooks must be signed")
+	}
+	webhook := &prbot.Webhook{Bot: bot, Secret: secret, Timeout: timeout}
+	httpServer := &http.Server{Addr: addr, Handler: webhook, ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdown)
+	}()
+
+	fmt.Printf("Receiving GitHub webhooks on %s (strategy %s)\n", addr, bot.Strategy)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	fmt.Println("Waiting for pull requests in progress...")
+	webhook.Wait()
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/Hekzory/MetamorphLLM/internal/grpcapi"
+	"github.com/Hekzory/MetamorphLLM/internal/grpcapi/metamorphv1"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+	"github.com/Hekzory/MetamorphLLM/internal/server"
+	"github.com/Hekzory/MetamorphLLM/internal/telemetry"
+)
+
+// runServe implements the 'metamorph serve' command
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8080", "Address to listen on")
+	grpcAddr := fs.String("grpc-addr", "", "Also serve the gRPC API (proto/metamorph/v1) on this address")
+	strategy := fs.String("strategy", "openrouter", "Strategy used when a request does not name one (comment, gemini, openrouter, anthropic, ollama, gemini-text, openrouter-text, anthropic-text)")
+	jobs := fs.Int("jobs", 4, "Maximum number of rewrites running at once")
+	asyncThreshold := fs.Int("async-threshold", server.DefaultAsyncThreshold, "Sources larger than this many bytes are always rewritten as asynchronous jobs")
+	maxSource := fs.Int64("max-source", server.DefaultMaxSourceBytes, "Largest accepted request body in bytes")
+	jobTTL := fs.Duration("job-ttl", server.DefaultJobTTL, "How long finished jobs can be polled")
+	jobDir := fs.String("job-dir", server.DefaultJobDir, "Directory jobs are stored in, so they survive a restart (empty keeps them in memory only)")
+	tenants := fs.String("tenants", "", "JSON file of tenants with their API key hashes, provider key variables and quotas (empty requires no API key)")
+	rateLimits := fs.String("rate-limits", "", "Per-provider limits as provider=rpm[/tpm], comma-separated (e.g. openrouter=20,gemini=15/1000000)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := rewriter.ConfigureRateLimits(*rateLimits); err != nil {
+		return err
+	}
+
+	s := server.New(*strategy, *jobs)
+	s.AsyncThreshold = *asyncThreshold
+	s.MaxSourceBytes = *maxSource
+	s.JobTTL = *jobTTL
+	if *tenants != "" {
+		// Loaded before resuming jobs, which run for their tenants
+		loaded, err := server.LoadTenants(*tenants)
+		if err != nil {
+			return err
+		}
+		s.Tenants = loaded
+		fmt.Printf("Requests need the API key of one of %d tenants\n", len(loaded))
+	}
+	if *jobDir != "" {
+		store, err := server.OpenJobStore(*jobDir)
+		if err != nil {
+			return err
+		}
+		resumed, err := s.UseJobStore(store)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Jobs are stored in %s (%d unfinished jobs resumed)\n", *jobDir, resumed)
+	}
+
+	mux := serveMux(s)
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", *addr, err)
+	}
+	httpServer := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	var grpcServer *grpc.Server
+	if *grpcAddr != "" {
+		grpcListener, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			listener.Close()
+			return fmt.Errorf("failed to listen on %s: %w", *grpcAddr, err)
+		}
+		grpcServer = grpc.NewServer(
+			grpc.MaxRecvMsgSize(int(*maxSource)+64<<10),
+			grpc.ChainUnaryInterceptor(grpcapi.UnaryInterceptor(s)),
+			grpc.ChainStreamInterceptor(grpcapi.StreamInterceptor(s)),
+		)
+		metamorphv1.RegisterRewriterServer(grpcServer, grpcapi.New(s))
+		go func() {
+			if err := grpcServer.Serve(grpcListener); err != nil {
+				fmt.Fprintf(os.Stderr, "gRPC server failed: %v\n", err)
+			}
+		}()
+		fmt.Printf("Serving gRPC at %s\n", grpcListener.Addr())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if grpcServer != nil {
+			go func() {
+				<-shutdown.Done()
+				grpcServer.Stop()
+			}()
+			grpcServer.GracefulStop()
+		}
+		httpServer.Shutdown(shutdown)
+	}()
+
+	fmt.Printf("Serving rewrites at http://%s/v1/rewrite (default strategy %s, %d at a time)\n", listener.Addr(), *strategy, *jobs)
+	if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	fmt.Println("Server stopped.")
+	return nil
+}
+
+// serveMux routes the API and the health check to s and serves the metrics
+func serveMux(s *server.Server) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/v1/", s.Handler())
+	mux.Handle("/health", s.Handler())
+	mux.Handle("/metrics", telemetry.Default.Handler())
+	return mux
+}
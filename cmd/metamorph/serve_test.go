@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Hekzory/MetamorphLLM/internal/eval"
+	"github.com/Hekzory/MetamorphLLM/internal/server"
+)
+
+// TestServeMux tests that the routes of 'metamorph serve' reach the service
+func TestServeMux(t *testing.T) {
+	ts := httptest.NewServer(serveMux(server.New(eval.StrategyComment, 2)))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/health")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	var health server.Health
+	err = json.NewDecoder(resp.Body).Decode(&health)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK || health.Status != "ok" || health.Capacity != 2 {
+		t.Errorf("Expected the health check to be served, got %d %+v (%v)", resp.StatusCode, health, err)
+	}
+
+	resp, err = http.Post(ts.URL+"/v1/rewrite", "application/json", strings.NewReader(`{"source": "package p\n\nfunc f() int { return 1 }\n"}`))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a rewrite to be served, got %d", resp.StatusCode)
+	}
+
+	for _, path := range []string{"/metrics", "/v1/jobs"} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected %s to be served, got %d", path, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/export"
+)
+
+// runStudy implements the 'metamorph study' command
+func runStudy(args []string) error {
+	fs := flag.NewFlagSet("study", flag.ExitOnError)
+	pairs := fs.String("pairs", "internal/suspicious/suspicious.go", "Comma-separated original[=rewritten] files (rewritten defaults to <original>.rewritten.go)")
+	outDir := fs.String("out", "study", "Directory for the participant packet")
+	keyPath := fs.String("key", "study-answer-key.json", "Answer key output path (must be outside -out)")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "Random seed for ordering and A/B assignment")
+	limit := fs.Int("limit", 0, "Maximum number of items (0 for all)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	functionPairs, err := loadPairs(splitList(*pairs))
+	if err != nil {
+		return err
+	}
+	if len(functionPairs) == 0 {
+		return fmt.Errorf("no rewritten functions found in the given files")
+	}
+
+	items, key := export.BuildStudy(functionPairs, *seed, *limit)
+	if err := export.WriteAnswerKey(*keyPath, *outDir, key); err != nil {
+		return err
+	}
+	if err := export.WriteStudy(*outDir, items); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d blinded items to %s (seed %d)\n", len(items), *outDir, *seed)
+	fmt.Printf("Answer key written to %s - keep it away from participants\n", *keyPath)
+	return nil
+}
+
+// loadPairs reads original/rewritten file pairs and extracts the changed functions
+func loadPairs(specs []string) ([]export.FunctionPair, error) {
+	var all []export.FunctionPair
+	for _, spec := range specs {
+		originalPath, rewrittenPath, ok := strings.Cut(spec, "=")
+		if !ok {
+			rewrittenPath = originalPath + ".rewritten.go"
+		}
+
+		original, err := os.ReadFile(originalPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read original: %w", err)
+		}
+		rewritten, err := os.ReadFile(rewrittenPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rewritten file: %w", err)
+		}
+
+		pairs, err := export.PairFunctions(originalPath, string(original), string(rewritten))
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, pairs...)
+	}
+	return all, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/Hekzory/MetamorphLLM/internal/eval"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+// runSweep implements the 'metamorph sweep' command
+func runSweep(args []string) error {
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	strategy := fs.String("strategy", eval.StrategyOpenRouter, "Strategy every cell uses (gemini, openrouter, anthropic, ollama, gemini-text, openrouter-text, anthropic-text)")
+	models := fs.String("models", "", "Comma-separated model names (empty uses the strategy's default model)")
+	temperatures := fs.String("temperatures", strconv.FormatFloat(rewriter.DefaultSampling.Temperature, 'g', -1, 64), "Comma-separated temperatures, from 0 to 2")
+	topPs := fs.String("top-p", strconv.FormatFloat(rewriter.DefaultSampling.TopP, 'g', -1, 64), "Comma-separated top-p values, above 0 and at most 1")
+	techniques := fs.String("techniques", string(rewriter.TechniqueDeadCode), "Comma-separated techniques, one per cell ("+rewriter.TechniqueNames()+")")
+	samples := fs.String("samples", "internal/suspicious/suspicious.go", "Comma-separated corpus files rewritten in every cell")
+	jsonOut := fs.String("json", "", "Write the per-cell aggregates and raw results as JSON to this file")
+	rateLimits := fs.String("rate-limits", "", "Per-provider limits as provider=rpm[/tpm], comma-separated (e.g. openrouter=20,gemini=15/1000000)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := rewriter.ConfigureRateLimits(*rateLimits); err != nil {
+		return err
+	}
+	temps, err := parseFloats("temperatures", *temperatures)
+	if err != nil {
+		return err
+	}
+	ps, err := parseFloats("top-p", *topPs)
+	if err != nil {
+		return err
+	}
+
+	h := eval.NewHarness(eval.Config{})
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, err := h.RunSweep(ctx, eval.SweepConfig{
+		Strategy:     *strategy,
+		Models:       splitList(*models),
+		Temperatures: temps,
+		TopPs:        ps,
+		Techniques:   splitList(*techniques),
+		Samples:      splitList(*samples),
+	})
+	if err != nil {
+		return err
+	}
+
+	if *jsonOut != "" {
+		f, err := os.Create(*jsonOut)
+		if err != nil {
+			return fmt.Errorf("failed to create results file: %w", err)
+		}
+		defer f.Close()
+		if err := eval.WriteSweepJSON(f, report); err != nil {
+			return fmt.Errorf("failed to write results: %w", err)
+		}
+		fmt.Printf("Sweep results written to %s\n", *jsonOut)
+	}
+
+	fmt.Println("\nParameter Sweep Summary:")
+	fmt.Println("========================")
+	return eval.WriteSweepReport(os.Stdout, report)
+}
+
+// parseFloats parses a comma-separated list of numbers
+func parseFloats(name, value string) ([]float64, error) {
+	var values []float64
+	for _, item := range splitList(value) {
+		v, err := strconv.ParseFloat(item, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -%s value %q", name, item)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Hekzory/MetamorphLLM/internal/eval"
+)
+
+// runTradeoff implements the 'metamorph tradeoff' command
+func runTradeoff(args []string) error {
+	fs := flag.NewFlagSet("tradeoff", flag.ExitOnError)
+	history := fs.String("history", eval.DefaultHistoryPath, "Run history file written by 'metamorph eval'")
+	prices := fs.String("prices", "", "JSON price table (model -> {input, output} USD per 1M tokens) merged over the defaults")
+	csvOut := fs.String("csv", "", "Also write the points as CSV to this file for external plotting")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	entries, priceTable, err := loadHistoryAndPrices(*history, *prices)
+	if err != nil {
+		return err
+	}
+
+	board, err := eval.Leaderboard(entries, priceTable, eval.SortByCost)
+	if err != nil {
+		return err
+	}
+	points := eval.Tradeoff(board)
+
+	if *csvOut != "" {
+		f, err := os.Create(*csvOut)
+		if err != nil {
+			return fmt.Errorf("failed to create CSV file: %w", err)
+		}
+		defer f.Close()
+		if err := eval.WriteTradeoffCSV(f, points); err != nil {
+			return fmt.Errorf("failed to write CSV: %w", err)
+		}
+		fmt.Printf("Trade-off points written to %s\n", *csvOut)
+	}
+
+	fmt.Println("Cost/Quality Trade-off:")
+	fmt.Println("=======================")
+	return eval.WriteTradeoff(os.Stdout, points)
+}
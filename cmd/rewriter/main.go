@@ -1,69 +1,727 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"github.com/Hekzory/MetamorphLLM/internal/cache"
+	"github.com/Hekzory/MetamorphLLM/internal/config"
+	"github.com/Hekzory/MetamorphLLM/internal/diff"
+	"github.com/Hekzory/MetamorphLLM/internal/egress"
+	"github.com/Hekzory/MetamorphLLM/internal/export"
+	"github.com/Hekzory/MetamorphLLM/internal/log"
+	"github.com/Hekzory/MetamorphLLM/internal/metrics"
+	"github.com/Hekzory/MetamorphLLM/internal/prompts"
+	"github.com/Hekzory/MetamorphLLM/internal/retry"
 	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 )
 
+var logger = log.Component("rewriter")
+
 func main() {
 	// Define command-line flags
+	verbose := flag.Bool("v", false, "Also log debug messages")
+	quiet := flag.Bool("q", false, "Only log warnings and errors")
+	logFormat := flag.String("log-format", log.FormatText, "Log format: text, or json for one JSON object per line")
+	configPath := flag.String("config", "", "Config file (e.g. "+config.DefaultPath+") whose rewriter section sets defaults for these flags; flags given on the command line override it")
 	inputFile := flag.String("input", "", "Path to the Go file to rewrite")
 	outputFile := flag.String("output", "", "Path to save the rewritten file (defaults to <input>.rewritten.go)")
-	apiFlag := flag.String("api", "openrouter", "API to use for rewriting: 'gemini' or 'openrouter'")
+	inputDir := flag.String("input-dir", "", "Directory to rewrite every Go file of, including subdirectories, instead of -input")
+	outputDir := flag.String("output-dir", "", "Directory -input-dir writes the rewritten files to, keeping their relative paths (defaults to <file>.rewritten.go next to each file)")
+	tests := flag.Bool("tests", false, "Also rewrite _test.go files with -input-dir")
+	tags := flag.String("tags", "", "Comma-separated build tags -input-dir evaluates build constraints with; files they exclude are not rewritten")
+	apiFlag := flag.String("api", "openrouter", "API to use for rewriting: 'gemini', 'openrouter', 'anthropic', 'ollama' (a local Ollama server, no API key), 'openai-compatible' (any server with the OpenAI chat completions API), 'none' (deterministic AST transforms, no LLM) or the name of a strategy added with rewriter.RegisterStrategy")
+	model := flag.String("model", "", "Model to rewrite with (defaults to the API's default model)")
+	openAIBaseURL := flag.String("openai-base-url", "", "Base URL of the server for -api openai-compatible, e.g. http://localhost:1234/v1 (defaults to OPENAI_BASE_URL or "+rewriter.DefaultOpenAIBaseURL+")")
+	openAIKeyEnv := flag.String("openai-key-env", rewriter.DefaultOpenAIKeyEnv, "Environment variable holding the API key of the -api openai-compatible server, if it needs one")
+	ollamaHost := flag.String("ollama-host", "", "Ollama server for -api ollama and -local-strategy ollama (defaults to OLLAMA_HOST or "+rewriter.DefaultOllamaHost+")")
+	temperature := flag.Float64("temperature", rewriter.DefaultSampling.Temperature, "Sampling temperature of LLM requests, from 0 to 2")
+	topP := flag.Float64("top-p", rewriter.DefaultSampling.TopP, "Nucleus sampling (top-p) of LLM requests, above 0 and at most 1")
+	maxTokens := flag.Int("max-tokens", rewriter.DefaultMaxTokens, "Maximum tokens of every LLM answer (reasoning tokens of Claude models come on top)")
+	maxAttempts := flag.Int("max-attempts", retry.DefaultMaxAttempts, "Maximum calls per LLM request: rate limits and transient failures are retried with exponential backoff and jitter")
+	technique := flag.String("technique", string(rewriter.TechniqueDeadCode), "Comma-separated obfuscation techniques the prompt asks for, applied together: "+rewriter.TechniqueNames()+"; with -api none the transforms to apply (defaults to all): "+rewriter.TransformNames())
+	naming := flag.String("naming", string(rewriter.NamingOpaque), "Names -api none gives renamed variables and labels: opaque (lI0O-like tokens), corporate (generic names such as result or cfgEntry), domain (words of the function's own identifiers) or pool:<names.json> (a JSON array of names, e.g. suggested by an LLM and reviewed)")
+	namingSeed := flag.Uint64("naming-seed", 0, "Seed of the -naming names and of their style (abbreviations, snake_case, suffixes); rewrites with different seeds read as if different authors wrote them")
+	passes := flag.String("passes", "", "Comma-separated passes applied one after another instead of -technique, each a technique or several joined with + (e.g. dead-code,variable-renaming,control-flow-flattening); the file must parse after every pass")
+	reasoningEffort := flag.String("reasoning-effort", "", "Reasoning effort for reasoning models: none, minimal, low, medium, high or xhigh (OpenRouter only)")
+	providerOrder := flag.String("provider-order", "", "Comma-separated OpenRouter providers to try first, in order (e.g. deepinfra,together)")
+	providerOnly := flag.String("provider-only", "", "Comma-separated OpenRouter providers allowed to serve requests (empty allows all)")
+	providerIgnore := flag.String("provider-ignore", "", "Comma-separated OpenRouter providers never to use")
+	dataCollection := flag.String("data-collection", "", "OpenRouter data collection policy: 'deny' skips providers that may store or train on prompts, 'allow' keeps them")
+	noFallbacks := flag.Bool("no-provider-fallbacks", false, "Fail instead of falling back to OpenRouter providers outside -provider-order or -provider-only")
+	structured := flag.Bool("structured", true, "Request JSON-mode responses with a single \"code\" field instead of free text")
+	typeCheck := flag.Bool("type-check", true, "Type-check every rewritten function in the context of its file and keep the original body if the rewrite introduces type errors")
+	repairs := flag.Int("repairs", rewriter.DefaultRepairs, "Times a rewrite that does not parse or type-check is sent back to the LLM with the error before the function keeps its original body")
+	incremental := flag.Bool("incremental", false, "Reuse previous rewrites of functions whose source, prompt and model are unchanged")
+	statePath := flag.String("state", "", "Incremental state file (defaults to <output>.state.json)")
+	useCache := flag.Bool("cache", false, "Answer functions whose prompt, model and sampling are unchanged from the response cache instead of the API, and cache new responses")
+	cacheDir := flag.String("cache-dir", cache.DefaultDir(), "Directory of the response cache")
+	cacheBypass := flag.Bool("cache-bypass", false, "Send every function to the API even if a response is cached, and cache the new responses (implies -cache)")
+	cacheClear := flag.Bool("cache-clear", false, "Remove every cached response before rewriting; without an input, only clear the cache")
+	concurrency := flag.Int("concurrency", 1, "Functions sent to the API at once; results are applied in source order and -rpm/-tpm apply to all of them together")
+	rpm := flag.Int("rpm", 0, "Maximum API requests per minute (0 for unlimited)")
+	tpm := flag.Int("tpm", 0, "Maximum API tokens per minute, prompt and response (0 for unlimited)")
+	breakerThreshold := flag.Int("breaker-threshold", rewriter.DefaultBreakerThreshold, "Consecutive failed API calls that open the provider's circuit breaker (0 disables it)")
+	breakerCooldown := flag.Duration("breaker-cooldown", rewriter.DefaultBreakerCooldown, "How long an open circuit breaker rejects calls before probing the provider again")
+	fallbackAPI := flag.String("fallback-api", "", "API to send functions to while the primary API's circuit breaker is open: 'gemini', 'openrouter', 'anthropic', 'ollama', 'openai-compatible' or 'none' for deterministic AST transforms")
+	secrets := flag.String("secrets", string(rewriter.SecretsRedact), "Functions containing possible secrets: 'redact' them around the LLM call, 'refuse' to send them, or 'off'")
+	fallbackModel := flag.String("fallback-model", "", "Model for the fallback API (defaults to its default model)")
+	localStrategy := flag.String("local-strategy", "keep", "Rewriting of //metamorph:local-only functions, which are never sent to the API: 'keep' them unchanged, 'comment' them, 'replay:<recordings.json>', or 'ollama[:<model>]' to rewrite them with a local Ollama server")
+	egressFlag := flag.String("egress", "", "Restrict outbound connections: 'provider' for the configured API endpoints only, or a comma-separated host[:port] allowlist")
+	egressAudit := flag.String("egress-audit", egress.DefaultAuditPath, "File to log every outbound connection attempt to when -egress is set")
+	reportPath := flag.String("report", "", "Write the outcome and duration of every function as JSON to this file")
+	progress := flag.Bool("progress", false, "Print a progress bar to stderr with every function started, retried, rewritten or failed")
+	buildTag := flag.String("build-tag", rewriter.DefaultBuildTag, "Build tag the rewritten file is constrained to with //go:build and // +build lines (empty for none, only safe when -output is not a .go file next to -input)")
+	maxDuration := flag.Duration("max-duration", 0, "Stop sending functions to the API after this long and keep the rest unchanged (0 for no limit)")
+	maxTotalTokens := flag.Int64("max-total-tokens", 0, "Stop sending functions to the API once the run used this many prompt and completion tokens and keep the rest unchanged (0 for no limit)")
+	maxCost := flag.Float64("max-cost", 0, "Stop sending functions to the API once the run cost this many USD, as billed by the provider or estimated from -prices, and keep the rest unchanged (0 for no limit)")
+	pricesPath := flag.String("prices", "", "JSON price table (model -> {input, output} USD per 1M tokens) merged over the defaults, for -max-cost and the cost summary")
+	deadline := flag.Duration("deadline", 0, "Cancel the run, including API calls in flight, after this long and fail without writing output (0 for no limit)")
+	examplesPath := flag.String("examples", "", "Example bank (JSON) to draw prompt examples from (defaults to the built-in bank of reviewed corpus examples)")
+	promptTemplate := flag.String("prompt-template", "", "Prompt template (text/template) file, or directory of <technique>[.<variant>].tmpl and default[.<variant>].tmpl files, replacing the built-in prompt")
+	promptVariant := flag.String("prompt-variant", "", "Variant of the prompt templates to use, e.g. 'concise' for dead-code.concise.tmpl")
+	shots := flag.Int("shots", 0, "Show this many reviewed before/after examples from the example bank in every prompt instead of the single built-in one")
+	closures := flag.Bool("closures", false, "Also rewrite large function literals (goroutine bodies, handlers, closures) on their own, with the variables they capture described in the prompt")
+	closureLines := flag.Int("closure-lines", rewriter.DefaultClosureLines, "Minimum size in lines of the function literals -closures rewrites")
+	skip := flag.String("skip", rewriter.DefaultSkip, "Comma-separated kinds of input that are refused instead of rewritten: vendor (under vendor/), third_party (under third_party/) and generated (\"Code generated ... DO NOT EDIT.\" header); empty rewrites anything")
+	only := flag.String("only", "", "Comma-separated function names or regular expressions matching whole names (e.g. 'Handle.*,Server.Serve'); only matching functions are rewritten")
+	exclude := flag.String("exclude", "", "Comma-separated function names or regular expressions of functions never to rewrite (e.g. 'init,main'); functions marked "+rewriter.SkipDirective+" are never rewritten either")
+	minimize := flag.Bool("minimize", false, "Keep the smallest rewrite per function that grows -minimize-metric by -minimize-delta percent, found by binary search over the number of inserted statements (several requests per function)")
+	minimizeMetric := flag.String("minimize-metric", rewriter.DefaultMinimizeMetric, "Metric -minimize must grow: cc, cogc or loc")
+	minimizeDelta := flag.Float64("minimize-delta", rewriter.DefaultMinimizeDelta, "Growth of -minimize-metric in percent a -minimize rewrite must reach")
+	maxInsertions := flag.Int("max-insertions", rewriter.DefaultMaxInsertions, "Most statements -minimize lets the model insert in one function")
+	patchDir := flag.String("patch-dir", "", "Write a git-apply-able patch series (one patch per rewritten function) with apply.sh and revert.sh to this directory instead of the rewritten file")
+	dryRun := flag.Bool("dry-run", false, "Print the rewritten file and its metrics to stdout instead of writing it, its origin map and the incremental state")
+	printDiff := flag.Bool("print-diff", false, "Print a unified diff from -input to the rewrite to stdout instead of writing anything (with -dry-run, followed by the metrics)")
 	
 	// Parse flags
 	flag.Parse()
+	if *configPath != "" {
+		cfg, err := config.Load(*configPath)
+		if err == nil {
+			err = cfg.Apply(flag.CommandLine, "rewriter")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := log.Setup(log.Options{Verbose: *verbose, Quiet: *quiet, Format: *logFormat}); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	start := time.Now()
+
+	// Ctrl+C cancels the API calls in flight; a second one exits at once
+	interrupted, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-interrupted.Done()
+		stop()
+	}()
+	ctx := interrupted
+	if *deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *deadline)
+		defer cancel()
+	}
 	
 	// Determine which API to use
 	var apiType rewriter.APIType
 	switch *apiFlag {
 	case "openrouter":
 		apiType = rewriter.APITypeOpenRouter
-		fmt.Println("Using OpenRouter API for rewriting")
-	default:
+		logger.Info("Using OpenRouter API for rewriting")
+	case "anthropic":
+		apiType = rewriter.APITypeAnthropic
+		logger.Info("Using Anthropic API for rewriting")
+	case "ollama":
+		apiType = rewriter.APITypeOllama
+		logger.Info("Using a local Ollama server for rewriting")
+	case "openai-compatible":
+		apiType = rewriter.APITypeOpenAICompatible
+		logger.Info("Using an OpenAI-compatible server for rewriting")
+	case "none":
+		apiType = rewriter.APITypeNone
+		logger.Info("Using deterministic AST transforms for rewriting, no API")
+	case "gemini":
 		apiType = rewriter.APITypeGemini
-		fmt.Println("Using Gemini API for rewriting")
+		logger.Info("Using Gemini API for rewriting")
+	default:
+		if !rewriter.IsRegisteredStrategy(*apiFlag) {
+			fmt.Fprintf(os.Stderr, "Error: unknown -api %q (registered strategies: %s)\n", *apiFlag, strings.Join(rewriter.Strategies(), ", "))
+			os.Exit(1)
+		}
+		apiType = rewriter.APIType(*apiFlag)
+		logger.Info("Using a registered strategy for rewriting", "strategy", apiType)
+	}
+	// Strategies registered outside the rewriter package only receive the
+	// settings whose flags were given
+	configure := func(name string) bool {
+		return rewriter.IsBuiltinStrategy(string(apiType)) || isFlagSet(name)
 	}
 	
+	// Every strategy for the provider draws from the same shared limiter
+	rewriter.SharedLimiter(string(apiType)).SetLimits(*rpm, *tpm)
+	rewriter.SharedBreaker(string(apiType)).SetPolicy(*breakerThreshold, *breakerCooldown)
+	
+	// The egress allowlist and the strategies read the Ollama server from OLLAMA_HOST
+	if *ollamaHost != "" {
+		host, err := rewriter.NormalizeOllamaHost(*ollamaHost)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Setenv("OLLAMA_HOST", host)
+	}
+	// Likewise for the OpenAI-compatible server and OPENAI_BASE_URL
+	if *openAIBaseURL != "" {
+		base, err := rewriter.NormalizeOpenAIBaseURL(*openAIBaseURL)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Setenv("OPENAI_BASE_URL", base)
+	}
+
+	// The allowlist must be in place before any API client is created
+	if *egressFlag != "" {
+		hosts := strings.Split(*egressFlag, ",")
+		if *egressFlag == "provider" {
+			hosts = []string{rewriter.ProviderHost(apiType)}
+			if *fallbackAPI != "" {
+				hosts = append(hosts, rewriter.ProviderHost(rewriter.APIType(*fallbackAPI)))
+			}
+		}
+		allowlist, err := egress.NewAllowlist(hosts, *egressAudit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		egress.Install(allowlist)
+		logger.Info("Outbound connections restricted", "hosts", strings.Join(hosts, ","), "audit", *egressAudit)
+	}
+
 	// Create a new rewriter with the specified API
-	r := rewriter.NewLLMRewriterWithAPI(apiType)
+	r := rewriter.NewLLMRewriterWithModel(apiType, *model)
+	defer r.Close()
+	if err := r.SetReasoningEffort(*reasoningEffort); err != nil && configure("reasoning-effort") {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if sampling := (rewriter.Sampling{Temperature: *temperature, TopP: *topP}); sampling != rewriter.DefaultSampling {
+		if err := r.SetSampling(sampling); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *maxTokens != rewriter.DefaultMaxTokens {
+		if err := r.SetMaxTokens(*maxTokens); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *maxAttempts != retry.DefaultMaxAttempts {
+		if err := r.SetMaxAttempts(*maxAttempts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if apiType == rewriter.APITypeNone {
+		// The default technique asks an LLM for dead code, so without -technique every transform applies
+		if isFlagSet("technique") {
+			transforms, err := rewriter.ParseTransforms(*technique)
+			if err == nil {
+				err = r.SetTransforms(transforms...)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		naming, err := rewriter.ParseNaming(*naming)
+		if err == nil {
+			naming.Seed = *namingSeed
+			err = r.SetNaming(naming)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else if configure("technique") {
+		techniques, err := rewriter.ParseTechniques(*technique)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := r.SetTechniques(techniques...); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := r.SetStructuredOutput(*structured); err != nil && configure("structured") {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := r.SetTypeCheck(*typeCheck); err != nil && configure("type-check") {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := r.SetRepairs(*repairs); err != nil && configure("repairs") {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := r.SetSecretPolicy(rewriter.SecretPolicy(*secrets)); err != nil && configure("secrets") {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := r.SetBuildTag(*buildTag); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *fallbackAPI != "" {
+		if err := r.SetFallback(rewriter.APIType(*fallbackAPI), *fallbackModel); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		logger.Info("Failing over while the primary provider is unavailable", "fallback", *fallbackAPI, "primary", apiType)
+	}
+	if isFlagSet("openai-key-env") {
+		if err := r.SetOpenAIKeyEnv(*openAIKeyEnv); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	routing := rewriter.ProviderRouting{
+		Order:          commaList(*providerOrder),
+		Only:           commaList(*providerOnly),
+		Ignore:         commaList(*providerIgnore),
+		DataCollection: *dataCollection,
+		NoFallbacks:    *noFallbacks,
+	}
+	if !routing.IsZero() {
+		if err := r.SetProviderRouting(routing); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	
+	if *promptTemplate != "" || *promptVariant != "" {
+		lib := prompts.Builtin()
+		if *promptTemplate != "" {
+			var err error
+			if lib, err = prompts.Load(*promptTemplate); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if err := r.SetPrompts(lib, *promptVariant); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		logger.Info("Using prompt templates", "templates", fmt.Sprint(lib.Keys()), "variant", *promptVariant)
+	}
+	
+	if *examplesPath != "" && *shots == 0 {
+		fmt.Fprintln(os.Stderr, "Error: -examples requires -shots")
+		os.Exit(1)
+	}
+	if *shots != 0 {
+		bank := rewriter.BuiltinExampleBank()
+		if *examplesPath != "" {
+			var err error
+			if bank, err = rewriter.LoadExampleBank(*examplesPath); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if err := r.SetExamples(bank, *shots); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *closures {
+		if err := r.SetClosureRewriting(*closureLines); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *minimize {
+		m := rewriter.Minimization{Metric: *minimizeMetric, MinDelta: *minimizeDelta, MaxInsertions: *maxInsertions}
+		if err := r.SetMinimization(m); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *concurrency != 1 {
+		if *minimize {
+			fmt.Fprintln(os.Stderr, "Error: -minimize sends one function at a time and cannot be combined with -concurrency")
+			os.Exit(1)
+		}
+		if err := r.SetConcurrency(*concurrency); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *maxDuration > 0 {
+		if err := r.SetDeadline(start.Add(*maxDuration)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	// Tokens are counted for the summary even without a budget
+	usage := rewriter.NewTokenUsage(rewriter.DefaultPrices)
+	usage.MaxTokens, usage.MaxCost = *maxTotalTokens, *maxCost
+	if *pricesPath != "" {
+		prices, err := rewriter.LoadPrices(*pricesPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		usage.Prices = prices
+	}
+	if err := r.SetUsage(usage); err != nil {
+		if *maxTotalTokens > 0 || *maxCost > 0 {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		usage = nil
+	}
+	
+	switch {
+	case *localStrategy == "keep":
+	case *localStrategy == "comment":
+		r.LocalStrategy = rewriter.NewFunctionCommentStrategy(r.DefaultComment + " (local-only, not sent)")
+	case strings.HasPrefix(*localStrategy, "replay:"):
+		replay, err := rewriter.NewReplayRewriter(strings.TrimPrefix(*localStrategy, "replay:"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		r.LocalStrategy = replay.Strategy
+	case *localStrategy == "ollama" || strings.HasPrefix(*localStrategy, "ollama:"):
+		model := strings.TrimPrefix(strings.TrimPrefix(*localStrategy, "ollama"), ":")
+		r.LocalStrategy = rewriter.NewOllamaStrategy(r.ASTHandler, r.DefaultComment+" (local-only, rewritten by Ollama)", rewriter.WithModel(model))
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown -local-strategy %q (keep, comment, replay:<file> or ollama[:<model>])\n", *localStrategy)
+		os.Exit(1)
+	}
 	
 	// Handle non-flag arguments as input files
 	if flag.NArg() > 0 && *inputFile == "" {
 		*inputFile = flag.Arg(0)
 	}
 	
+	if *cacheClear {
+		c, err := cache.Open(*cacheDir)
+		if err == nil {
+			var removed int
+			removed, err = c.Clear()
+			logger.Info("Cleared the response cache", "removed", removed, "dir", *cacheDir)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if *inputFile == "" && *inputDir == "" {
+			return
+		}
+	}
+
 	// Validate input
-	if *inputFile == "" {
+	if *inputFile == "" && *inputDir == "" {
 		fmt.Fprintln(os.Stderr, "Error: No input file specified")
-		fmt.Fprintln(os.Stderr, "Usage: rewriter [options] -input <file.go>")
+		fmt.Fprintln(os.Stderr, "Usage: rewriter [options] -input <file.go> | -input-dir <dir>")
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
+	if *inputDir != "" && (*inputFile != "" || *outputFile != "" || *patchDir != "") {
+		fmt.Fprintln(os.Stderr, "Error: -input-dir cannot be combined with -input, -output or -patch-dir")
+		os.Exit(1)
+	}
+	if (*dryRun || *printDiff) && (*inputDir != "" || *patchDir != "") {
+		fmt.Fprintln(os.Stderr, "Error: -dry-run and -print-diff require -input and cannot be combined with -patch-dir")
+		os.Exit(1)
+	}
+	if *inputDir == "" && (*outputDir != "" || *tests || *tags != "") {
+		fmt.Fprintln(os.Stderr, "Error: -output-dir, -tests and -tags require -input-dir")
+		os.Exit(1)
+	}
+	
+	skipRules, err := rewriter.ParseSkipRules(*skip)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if content, err := os.ReadFile(*inputFile); *inputDir == "" && err == nil {
+		if reason := skipRules.Reason(*inputFile, string(content)); reason != "" {
+			fmt.Fprintf(os.Stderr, "Error: %s is %s and is not rewritten (override with -skip)\n", *inputFile, reason)
+			os.Exit(1)
+		}
+	}
 	
 	// Set default output file if not specified
-	if *outputFile == "" {
+	if *outputFile == "" && *inputDir == "" {
 		*outputFile = *inputFile + ".rewritten.go"
 	}
 	
-	// Perform the rewriting
-	fmt.Printf("Rewriting %s to %s...\n", *inputFile, *outputFile)
+	// Load the previous run's rewrites for incremental mode
+	var state *rewriter.IncrementalState
+	if *incremental {
+		if *statePath == "" && *inputDir != "" {
+			// One state for the whole directory, next to the rewritten files
+			*statePath = filepath.Join(cmp.Or(*outputDir, *inputDir), "metamorph.state.json")
+		} else if *statePath == "" {
+			*statePath = *outputFile + ".state.json"
+		}
+		var err error
+		state, err = rewriter.LoadIncrementalState(*statePath)
+		if err != nil {
+			logger.Error("Failed to load incremental state", "error", err)
+			os.Exit(1)
+		}
+		if err := r.SetIncrementalState(state); err != nil {
+			logger.Error("Failed to enable incremental rewriting", "error", err)
+			os.Exit(1)
+		}
+	}
 	
-	// Rewrite the file
-	rewritten, err := r.RewriteFile(*inputFile)
+	var responseCache *cache.Cache
+	if *useCache || *cacheBypass {
+		var err error
+		if responseCache, err = cache.Open(*cacheDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		responseCache.Bypass = *cacheBypass
+		if err := r.SetCache(responseCache); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var report *rewriter.RewriteReport
+	if *reportPath != "" || *minimize {
+		// The trade-offs of -minimize are printed from the report
+		report = &rewriter.RewriteReport{Source: cmp.Or(*inputFile, *inputDir)}
+		if *reportPath != "" {
+			report.Track(*reportPath)
+		}
+		if err := r.SetReport(report); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *progress {
+		if err := r.SetObserver(&progressBar{w: os.Stderr}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *only != "" || *exclude != "" {
+		var filter rewriter.FunctionFilter
+		filter.Only, err = rewriter.ParseFunctionPatterns(*only)
+		if err == nil {
+			filter.Exclude, err = rewriter.ParseFunctionPatterns(*exclude)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		r.SetFunctionFilter(filter)
+	}
+
+	if *passes != "" {
+		// Wraps the configured strategy, so this comes last
+		list, err := rewriter.ParsePasses(*passes)
+		if err == nil {
+			err = r.SetPasses(list...)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Perform the rewriting
+	var rewritten string
+	var files []rewriter.PackageFile
+	if *inputDir != "" {
+		logger.Info("Rewriting the Go files of a directory", "dir", *inputDir)
+		files, err = r.RewritePackage(ctx, *inputDir, rewriter.PackageOptions{
+			OutputDir: *outputDir,
+			Tests:     *tests,
+			BuildTags: commaList(*tags),
+			Skip:      skipRules,
+		})
+	} else {
+		logger.Info("Rewriting file", "input", *inputFile, "output", *outputFile)
+		rewritten, err = r.RewriteFile(ctx, *inputFile)
+	}
+	if usage != nil {
+		if report != nil {
+			report.Usage = usage.Models()
+		}
+		// Keep the diff of -print-diff clean
+		if out := log.Reports(); usage.Total().Calls > 0 {
+			if *dryRun || *printDiff {
+				out = os.Stderr
+			}
+			rewriter.WriteUsageSummary(out, usage.Models())
+		}
+	}
+	if *reportPath != "" {
+		// Saved even when rewriting failed, so the failing function is on record
+		if err := report.Save(*reportPath); err != nil {
+			logger.Error("Failed to save rewrite report", "error", err)
+			os.Exit(1)
+		}
+	}
 	if err != nil {
-		fmt.Printf("Error rewriting file: %v\n", err)
+		logger.Error("Rewriting failed", "input", cmp.Or(*inputFile, *inputDir), "error", err)
 		os.Exit(1)
 	}
+	if *minimize {
+		fmt.Fprintln(log.Reports(), "\nMinimal rewrites:")
+		if err := rewriter.WriteMinimalRewrites(log.Reports(), report.Minimized); err != nil {
+			logger.Error("Failed to print minimal rewrites", "error", err)
+			os.Exit(1)
+		}
+	}
 	
-	// Save the rewritten content
-	err = r.SaveRewrittenFile(*outputFile, rewritten)
-	if err != nil {
-		fmt.Printf("Error saving rewritten file: %v\n", err)
+	if *inputDir != "" {
+		rewrote := 0
+		for _, file := range files {
+			if file.Output == "" {
+				continue
+			}
+			rewrote++
+			content, err := r.FileHandler.ReadFile(file.Output)
+			if err == nil {
+				writeOriginMap(r, file.Input, file.Output, content)
+			}
+		}
+		logger.Info("Rewrote directory", "rewrote", rewrote, "files", len(files), "dir", *inputDir)
+	} else if *dryRun || *printDiff {
+		if err := writeDryRun(os.Stdout, r, *inputFile, *outputFile, rewritten, *printDiff, *dryRun); err != nil {
+			logger.Error("Failed to print the rewrite", "error", err)
+			os.Exit(1)
+		}
+	} else if *patchDir != "" {
+		// Patch the input in place rather than adding a sibling file
+		original, err := r.FileHandler.ReadFile(*inputFile)
+		if err != nil {
+			logger.Error("Failed to read input file", "error", err)
+			os.Exit(1)
+		}
+		patches, err := export.BuildPatchSeries(*inputFile, original, rewritten)
+		if err != nil {
+			logger.Error("Failed to build patch series", "error", err)
+			os.Exit(1)
+		}
+		if err := export.WritePatchSeries(*patchDir, patches); err != nil {
+			logger.Error("Failed to write patch series", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Wrote patch series", "patches", len(patches), "dir", *patchDir, "apply", filepath.Join(*patchDir, "apply.sh"))
+	} else if err := r.SaveRewrittenFile(*outputFile, rewritten); err != nil {
+		// Save the rewritten content
+		logger.Error("Failed to save rewritten file", "error", err)
 		os.Exit(1)
+	} else {
+		writeOriginMap(r, *inputFile, *outputFile, rewritten)
+	}
+	
+	if state != nil && !*dryRun && !*printDiff {
+		if err := state.Save(); err != nil {
+			logger.Error("Failed to save incremental state", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Saved incremental state", "reused", state.Reused(), "state", state.Path)
+	}
+	if responseCache != nil {
+		logger.Info("Response cache", "hits", responseCache.Hits(), "misses", responseCache.Misses(), "dir", responseCache.Dir)
 	}
 	
-	fmt.Println("Rewriting completed successfully!")
-} 
\ No newline at end of file
+	logger.Info("Rewriting completed successfully", "duration", time.Since(start).Round(time.Millisecond))
+} 
+
+// writeOriginMap writes the origin map of a rewritten file. The map is a
+// debugging aid, so failing to write it is not fatal.
+func writeOriginMap(r *rewriter.Rewriter, input, output, rewritten string) {
+	original, err := r.FileHandler.ReadFile(input)
+	if err == nil {
+		var om *rewriter.OriginMap
+		if om, err = rewriter.BuildOriginMap(input, original, output, rewritten); err == nil {
+			err = om.Save(rewriter.OriginMapPath(output))
+		}
+	}
+	if err != nil {
+		logger.Warn("No origin map written", "file", output, "error", err)
+	}
+}
+
+// writeDryRun prints the rewrite of input to w instead of writing it to
+// output: the rewritten file, or with showDiff a unified diff against input.
+// With showMetrics, the metric deltas follow.
+func writeDryRun(w io.Writer, r *rewriter.Rewriter, input, output, rewritten string, showDiff, showMetrics bool) error {
+	original, err := r.FileHandler.ReadFile(input)
+	if err != nil {
+		return fmt.Errorf("failed to read input file: %w", err)
+	}
+	if showDiff {
+		d, err := diff.Compare(original, rewritten)
+		if err != nil {
+			return fmt.Errorf("failed to diff the rewrite: %w", err)
+		}
+		opts := diff.Options{OriginalName: input, RewrittenName: output, Context: 3}
+		if err := d.Write(w, diff.FormatPatch, opts); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprint(w, rewritten)
+	}
+	if !showMetrics {
+		return nil
+	}
+
+	before, beforeErr := metrics.CalculateMetricsFromContent(input, original)
+	after, afterErr := metrics.CalculateMetricsFromContent(output, rewritten)
+	if err := errors.Join(beforeErr, afterErr); err != nil {
+		return fmt.Errorf("failed to calculate metrics: %w", err)
+	}
+	delta := metrics.CalculateDeltaMetrics(before, after)
+	fmt.Fprintf(w, "\nMetrics (not written to %s):\n", output)
+	fmt.Fprintf(w, "  LOC:  %d -> %d (%s)\n", before.LOC, after.LOC, delta.LOC)
+	fmt.Fprintf(w, "  CC:   %d -> %d (%s)\n", before.CC, after.CC, delta.CC)
+	fmt.Fprintf(w, "  CogC: %d -> %d (%s)\n", before.CogC, after.CogC, delta.CogC)
+	return nil
+}
+
+// commaList splits a comma-separated list, such as provider names or build tags
+func commaList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// isFlagSet reports whether a flag was given on the command line or in the config file
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
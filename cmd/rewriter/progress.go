@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+// progressWidth is the number of characters of a full progress bar
+const progressWidth = 20
+
+// progressBar prints a line per progress event, led by a bar of the
+// functions of the current file that have finished
+type progressBar struct {
+	w io.Writer
+
+	mu          sync.Mutex
+	done, total int
+}
+
+// Observe implements rewriter.Observer
+func (p *progressBar) Observe(e rewriter.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch e.Type {
+	case rewriter.EventStarted:
+		if e.Index == 1 {
+			// The first function of another file or pass
+			p.done, p.total = 0, e.Total
+		}
+	case rewriter.EventSucceeded, rewriter.EventFailed:
+		// Function literals are not counted among their file's functions
+		if e.Total > 0 {
+			p.done, p.total = e.Index, e.Total
+		}
+	}
+	if p.total == 0 {
+		fmt.Fprintln(p.w, e)
+		return
+	}
+	filled := progressWidth * p.done / p.total
+	fmt.Fprintf(p.w, "[%s%s] %d/%d %s\n", strings.Repeat("#", filled), strings.Repeat(".", progressWidth-filled), p.done, p.total, e)
+}
@@ -0,0 +1,218 @@
+// Package artifacts uploads run artifacts to S3-compatible object storage:
+// Amazon S3, Google Cloud Storage through its XML API with HMAC keys, and MinIO
+package artifacts
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/redact"
+)
+
+// maxErrorBody bounds how much of an error response is kept
+const maxErrorBody = 4096
+
+// Store is a bucket and key prefix that artifacts are uploaded under
+type Store struct {
+	Endpoint  *url.URL // Service endpoint, e.g. https://s3.us-east-1.amazonaws.com
+	Bucket    string
+	Prefix    string // Key prefix without leading or trailing slashes
+	Region    string
+	PathStyle bool // Address objects as endpoint/bucket/key instead of bucket.endpoint/key
+
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	Client *http.Client
+}
+
+// Open parses an s3://bucket/prefix or gs://bucket/prefix URL. A non-empty
+// endpoint (e.g. http://localhost:9000 for MinIO) replaces the provider's.
+// Credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN, which hold HMAC keys for Google Cloud Storage.
+func Open(rawURL, endpoint string) (*Store, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid artifact URL %q: expected s3://bucket/prefix or gs://bucket/prefix", rawURL)
+	}
+	s := &Store{
+		Bucket:       u.Host,
+		Prefix:       strings.Trim(u.Path, "/"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		Client:       &http.Client{Timeout: 10 * time.Minute},
+	}
+
+	switch u.Scheme {
+	case "s3":
+		s.Region = os.Getenv("AWS_REGION")
+		if s.Region == "" {
+			s.Region = "us-east-1"
+		}
+		endpointURL := "https://s3." + s.Region + ".amazonaws.com"
+		s.Endpoint, _ = url.Parse(endpointURL)
+	case "gs":
+		s.Region = "auto"
+		s.Endpoint, _ = url.Parse("https://storage.googleapis.com")
+		s.PathStyle = true
+	default:
+		return nil, fmt.Errorf("unsupported artifact URL scheme %q: expected s3 or gs", u.Scheme)
+	}
+
+	if endpoint != "" {
+		e, err := url.Parse(endpoint)
+		if err != nil || e.Host == "" || (e.Scheme != "http" && e.Scheme != "https") {
+			return nil, fmt.Errorf("invalid artifact endpoint %q: expected http(s)://host[:port]", endpoint)
+		}
+		s.Endpoint = e
+		s.PathStyle = true // MinIO and most S3-compatible servers do not resolve bucket subdomains
+	}
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set to upload artifacts")
+	}
+	return s, nil
+}
+
+// Key returns the object key of name under the prefix
+func (s *Store) Key(name string) string {
+	return path.Join(s.Prefix, name)
+}
+
+// URL returns the HTTP URL of an object
+func (s *Store) URL(key string) string {
+	u := *s.Endpoint
+	if s.PathStyle {
+		u.Path = "/" + s.Bucket + "/" + key
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	// Signature Version 4 signs the path with only unreserved characters left as is
+	u.RawPath = encodePath(u.Path)
+	return u.String()
+}
+
+// encodePath percent-encodes every byte of p except unreserved characters and '/'
+func encodePath(p string) string {
+	var sb strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+// Upload puts the file at localPath under key and returns the object URL
+func (s *Store) Upload(ctx context.Context, key, localPath string) (string, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open artifact: %w", err)
+	}
+	defer f.Close()
+
+	// The payload hash is signed, so the file is read once to hash it and once to send it
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return "", fmt.Errorf("failed to read artifact %s: %w", localPath, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to read artifact %s: %w", localPath, err)
+	}
+
+	objectURL := s.URL(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL, f)
+	if err != nil {
+		return "", fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	s.sign(req, hex.EncodeToString(hash.Sum(nil)), time.Now())
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload %s: %w", localPath, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return "", fmt.Errorf("failed to upload %s to %s: %s: %s", localPath, objectURL, resp.Status, redact.String(strings.TrimSpace(string(body))))
+	}
+	return objectURL, nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header covering the host
+// and every header already set on the request
+func (s *Store) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex(canonicalRequest)
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	for _, part := range []string{s.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+// sha256Hex returns the hex SHA-256 of s
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,280 @@
+// Package bindiff measures how different a binary compiled from rewritten
+// code is from the one compiled from the original: the file sizes, the
+// symbols added, removed or resized, the sections whose content changed and
+// a fuzzy hash of the whole file. Together they give a dissimilarity score of
+// the kind signature-based detection would see. ELF, Mach-O and PE binaries
+// are read with the standard library.
+package bindiff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+)
+
+// Binary is the part of an executable that is compared
+type Binary struct {
+	Format    string             // "elf", "macho" or "pe"
+	Size      int64              // Size of the file in bytes
+	Sections  map[string]Section // Every section with content in the file, by name
+	Symbols   map[string]uint64  // Size of every symbol by name
+	FuzzyHash string
+}
+
+// Section is the content of a section
+type Section struct {
+	Size   int64
+	SHA256 [32]byte
+}
+
+// Load reads the executable at path
+func Load(path string) (*Binary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read binary: %w", err)
+	}
+	b := &Binary{
+		Size:      int64(len(data)),
+		Sections:  make(map[string]Section),
+		Symbols:   make(map[string]uint64),
+		FuzzyHash: FuzzyHash(data),
+	}
+	r := bytes.NewReader(data)
+	if f, err := elf.NewFile(r); err == nil {
+		b.Format = "elf"
+		return b, b.loadELF(f)
+	}
+	if f, err := macho.NewFile(r); err == nil {
+		b.Format = "macho"
+		return b, b.loadMachO(f)
+	}
+	if f, err := pe.NewFile(r); err == nil {
+		b.Format = "pe"
+		return b, b.loadPE(f)
+	}
+	return nil, fmt.Errorf("%s is not an ELF, Mach-O or PE binary", path)
+}
+
+// addSection records the hash of a section's content
+func (b *Binary) addSection(name string, data []byte) {
+	b.Sections[name] = Section{Size: int64(len(data)), SHA256: sha256.Sum256(data)}
+}
+
+func (b *Binary) loadELF(f *elf.File) error {
+	for _, s := range f.Sections {
+		if s.Type == elf.SHT_NOBITS || s.Name == "" {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return fmt.Errorf("failed to read section %s: %w", s.Name, err)
+		}
+		b.addSection(s.Name, data)
+	}
+	symbols, err := f.Symbols()
+	if errors.Is(err, elf.ErrNoSymbols) {
+		// A stripped binary is compared by its sections only
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read symbols: %w", err)
+	}
+	for _, s := range symbols {
+		if t := elf.ST_TYPE(s.Info); s.Name != "" && (t == elf.STT_FUNC || t == elf.STT_OBJECT) {
+			b.Symbols[s.Name] = s.Size
+		}
+	}
+	return nil
+}
+
+func (b *Binary) loadMachO(f *macho.File) error {
+	ends := make(map[int]uint64)
+	for i, s := range f.Sections {
+		ends[i+1] = s.Addr + s.Size
+		// Zero-fill sections have no content in the file
+		if s.Offset == 0 {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return fmt.Errorf("failed to read section %s: %w", s.Name, err)
+		}
+		b.addSection(s.Seg+"."+s.Name, data)
+	}
+	if f.Symtab == nil {
+		return nil
+	}
+	var symbols []located
+	for _, s := range f.Symtab.Syms {
+		if s.Name != "" && s.Sect != 0 {
+			symbols = append(symbols, located{s.Name, int(s.Sect), s.Value})
+		}
+	}
+	b.addLocated(symbols, ends)
+	return nil
+}
+
+func (b *Binary) loadPE(f *pe.File) error {
+	ends := make(map[int]uint64)
+	for i, s := range f.Sections {
+		ends[i+1] = uint64(s.VirtualSize)
+		data, err := s.Data()
+		if err != nil {
+			return fmt.Errorf("failed to read section %s: %w", s.Name, err)
+		}
+		b.addSection(s.Name, data)
+	}
+	var symbols []located
+	for _, s := range f.Symbols {
+		if s.Name != "" && s.SectionNumber > 0 {
+			symbols = append(symbols, located{s.Name, int(s.SectionNumber), uint64(s.Value)})
+		}
+	}
+	b.addLocated(symbols, ends)
+	return nil
+}
+
+// located is a symbol of a format that records no sizes
+type located struct {
+	name    string
+	section int
+	addr    uint64
+}
+
+// addLocated records symbols sized by the distance to the next symbol of
+// their section, or to the section's end
+func (b *Binary) addLocated(symbols []located, ends map[int]uint64) {
+	sort.Slice(symbols, func(i, j int) bool {
+		if symbols[i].section != symbols[j].section {
+			return symbols[i].section < symbols[j].section
+		}
+		return symbols[i].addr < symbols[j].addr
+	})
+	for i, s := range symbols {
+		end := ends[s.section]
+		if i+1 < len(symbols) && symbols[i+1].section == s.section {
+			end = symbols[i+1].addr
+		}
+		var size uint64
+		if end > s.addr {
+			size = end - s.addr
+		}
+		b.Symbols[s.name] = size
+	}
+}
+
+// Report compares two binaries. Similarities go from 0 (nothing in common)
+// to 1 (the same).
+type Report struct {
+	OriginalSize  int64 `json:"original_size"`
+	RewrittenSize int64 `json:"rewritten_size"`
+
+	SymbolsAdded     int `json:"symbols_added"`
+	SymbolsRemoved   int `json:"symbols_removed"`
+	SymbolsResized   int `json:"symbols_resized"`
+	SymbolsUnchanged int `json:"symbols_unchanged"`
+	// SymbolSimilarity is the share of symbols of both binaries that kept their size
+	SymbolSimilarity float64 `json:"symbol_similarity"`
+
+	// SectionsChanged names the sections whose content differs or that only
+	// one binary has
+	SectionsChanged []string `json:"sections_changed"`
+	// SectionSimilarity is the share of section bytes in sections with the same content
+	SectionSimilarity float64 `json:"section_similarity"`
+
+	OriginalFuzzyHash  string `json:"original_fuzzy_hash"`
+	RewrittenFuzzyHash string `json:"rewritten_fuzzy_hash"`
+	// FuzzySimilarity is the fuzzy hash comparison score divided by 100
+	FuzzySimilarity float64 `json:"fuzzy_similarity"`
+}
+
+// Dissimilarity is 1 minus the mean of the symbol, section and fuzzy hash
+// similarities: 0 for the same binary, 1 for binaries with nothing in common
+func (r *Report) Dissimilarity() float64 {
+	return 1 - (r.SymbolSimilarity+r.SectionSimilarity+r.FuzzySimilarity)/3
+}
+
+// Compare compares the binary compiled from the original with the one
+// compiled from the rewrite
+func Compare(original, rewritten *Binary) (*Report, error) {
+	r := &Report{
+		OriginalSize:       original.Size,
+		RewrittenSize:      rewritten.Size,
+		OriginalFuzzyHash:  original.FuzzyHash,
+		RewrittenFuzzyHash: rewritten.FuzzyHash,
+	}
+
+	for name, size := range original.Symbols {
+		switch rewrittenSize, ok := rewritten.Symbols[name]; {
+		case !ok:
+			r.SymbolsRemoved++
+		case rewrittenSize != size:
+			r.SymbolsResized++
+		default:
+			r.SymbolsUnchanged++
+		}
+	}
+	for name := range rewritten.Symbols {
+		if _, ok := original.Symbols[name]; !ok {
+			r.SymbolsAdded++
+		}
+	}
+	r.SymbolSimilarity = ratio(r.SymbolsUnchanged, r.SymbolsAdded+r.SymbolsRemoved+r.SymbolsResized+r.SymbolsUnchanged)
+
+	var same, total int64
+	for name, section := range original.Sections {
+		other, ok := rewritten.Sections[name]
+		size := max(section.Size, other.Size)
+		total += size
+		if ok && other.SHA256 == section.SHA256 {
+			same += size
+		} else {
+			r.SectionsChanged = append(r.SectionsChanged, name)
+		}
+	}
+	for name, section := range rewritten.Sections {
+		if _, ok := original.Sections[name]; !ok {
+			total += section.Size
+			r.SectionsChanged = append(r.SectionsChanged, name)
+		}
+	}
+	slices.Sort(r.SectionsChanged)
+	r.SectionSimilarity = 1
+	if total > 0 {
+		r.SectionSimilarity = float64(same) / float64(total)
+	}
+
+	score, err := CompareFuzzy(original.FuzzyHash, rewritten.FuzzyHash)
+	if err != nil {
+		return nil, err
+	}
+	r.FuzzySimilarity = float64(score) / 100
+	return r, nil
+}
+
+// CompareFiles compares the binaries at the given paths
+func CompareFiles(originalPath, rewrittenPath string) (*Report, error) {
+	original, err := Load(originalPath)
+	if err != nil {
+		return nil, err
+	}
+	rewritten, err := Load(rewrittenPath)
+	if err != nil {
+		return nil, err
+	}
+	return Compare(original, rewritten)
+}
+
+// ratio returns n/total, or 1 when there is nothing to compare
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 1
+	}
+	return float64(n) / float64(total)
+}
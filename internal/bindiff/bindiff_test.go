@@ -0,0 +1,107 @@
+package bindiff
+
+import (
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestFuzzyHash tests that local changes keep fuzzy hashes similar and that
+// unrelated data scores low
+func TestFuzzyHash(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	data := make([]byte, 64<<10)
+	for i := range data {
+		data[i] = byte(rng.IntN(256))
+	}
+	changed := slices.Clone(data)
+	copy(changed[30000:], "a local change in the middle of the data")
+	other := make([]byte, len(data))
+	for i := range other {
+		other[i] = byte(rng.IntN(256))
+	}
+
+	hash := FuzzyHash(data)
+	score := func(a, b string) int {
+		s, err := CompareFuzzy(a, b)
+		if err != nil {
+			t.Fatalf("CompareFuzzy failed: %v", err)
+		}
+		return s
+	}
+	if s := score(hash, FuzzyHash(data)); s != 100 {
+		t.Errorf("Expected the same data to score 100, got %d", s)
+	}
+	if s := score(hash, FuzzyHash(changed)); s < 80 || s == 100 {
+		t.Errorf("Expected a local change to score high but below 100, got %d", s)
+	}
+	if s := score(hash, FuzzyHash(other)); s > 20 {
+		t.Errorf("Expected unrelated data to score low, got %d", s)
+	}
+	// The hash of twice the data has twice the block size and is still comparable
+	if s := score(hash, FuzzyHash(append(slices.Clone(data), data...))); s == 0 {
+		t.Error("Expected hashes of adjacent block sizes to be compared")
+	}
+	if _, err := CompareFuzzy(hash, "not a hash"); err == nil {
+		t.Error("Expected an invalid hash to be refused")
+	}
+}
+
+// TestCompareFiles tests comparing binaries built from two versions of a program
+func TestCompareFiles(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not found")
+	}
+	t.Setenv("GOFLAGS", "")
+	dir := t.TempDir()
+	build := func(name, body string) string {
+		src := filepath.Join(dir, name)
+		if err := os.MkdirAll(src, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		files := map[string]string{
+			"go.mod":  "module example.com/" + name + "\n\ngo 1.24\n",
+			"main.go": "package main\n\nimport \"os\"\n\n//go:noinline\nfunc compute(n int) int {\n" + body + "\n}\n\nfunc main() { os.Exit(compute(len(os.Args))) }\n",
+		}
+		for file, content := range files {
+			if err := os.WriteFile(filepath.Join(src, file), []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write %s: %v", file, err)
+			}
+		}
+		binary := filepath.Join(dir, name+".bin")
+		cmd := exec.Command("go", "build", "-o", binary, ".")
+		cmd.Dir = src
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("Failed to build %s: %v\n%s", name, err, output)
+		}
+		return binary
+	}
+	original := build("app", "\treturn n * 2")
+	rewritten := build("app2", "\ts := 0\n\tfor i := 0; i < n; i++ {\n\t\ts += 2\n\t}\n\treturn s")
+
+	same, err := CompareFiles(original, original)
+	if err != nil {
+		t.Fatalf("CompareFiles failed: %v", err)
+	}
+	if same.Dissimilarity() != 0 || len(same.SectionsChanged) != 0 {
+		t.Errorf("Expected a binary to be identical to itself, got %+v", same)
+	}
+
+	report, err := CompareFiles(original, rewritten)
+	if err != nil {
+		t.Fatalf("CompareFiles failed: %v", err)
+	}
+	if d := report.Dissimilarity(); d <= 0 || d >= 1 {
+		t.Errorf("Expected a dissimilarity between 0 and 1, got %v", d)
+	}
+	if report.SymbolsResized == 0 || report.SymbolsUnchanged == 0 || len(report.SectionsChanged) == 0 {
+		t.Errorf("Expected the rewritten function to change some symbols and sections, got %+v", report)
+	}
+
+	if _, err := CompareFiles(original, filepath.Join(dir, "app", "main.go")); err == nil {
+		t.Error("Expected a source file to be refused")
+	}
+}
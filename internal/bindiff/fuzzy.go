@@ -0,0 +1,185 @@
+package bindiff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The fuzzy hash is a context-triggered piecewise hash in the style of
+// ssdeep: a rolling hash over a small window cuts the data into pieces at
+// content-defined points, and every piece contributes one character. A local
+// change only alters the characters of the pieces it touches, so similar
+// data gets similar hashes even when bytes were inserted or removed.
+const (
+	rollingWindow = 7
+	minBlockSize  = 3
+	hashLength    = 64 // Characters of the first part; the second part gets half
+	hashPrime     = 0x01000193
+	hashInit      = 0x28021967
+	base64Chars   = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+)
+
+// rollingHash is the sum of the bytes, their position-weighted sum and a
+// shift-xor hash over the last rollingWindow bytes
+type rollingHash struct {
+	window     [rollingWindow]byte
+	h1, h2, h3 uint32
+	n          uint32
+}
+
+func (r *rollingHash) roll(c byte) uint32 {
+	r.h2 -= r.h1
+	r.h2 += rollingWindow * uint32(c)
+	r.h1 += uint32(c)
+	r.h1 -= uint32(r.window[r.n%rollingWindow])
+	r.window[r.n%rollingWindow] = c
+	r.n++
+	r.h3 = r.h3<<5 ^ uint32(c)
+	return r.h1 + r.h2 + r.h3
+}
+
+// FuzzyHash returns the fuzzy hash of data as "blocksize:hash:hash", where
+// the second hash uses twice the block size
+func FuzzyHash(data []byte) string {
+	blockSize := uint32(minBlockSize)
+	for uint64(blockSize)*hashLength < uint64(len(data)) {
+		blockSize *= 2
+	}
+	for {
+		var r rollingHash
+		var sum uint32
+		h1, h2 := uint32(hashInit), uint32(hashInit)
+		var sig1, sig2 []byte
+		for _, c := range data {
+			h1 = h1*hashPrime ^ uint32(c)
+			h2 = h2*hashPrime ^ uint32(c)
+			sum = r.roll(c)
+			// The last character covers the rest of the data once a part is full
+			if sum%blockSize == blockSize-1 && len(sig1) < hashLength-1 {
+				sig1 = append(sig1, base64Chars[h1%64])
+				h1 = hashInit
+			}
+			if sum%(2*blockSize) == 2*blockSize-1 && len(sig2) < hashLength/2-1 {
+				sig2 = append(sig2, base64Chars[h2%64])
+				h2 = hashInit
+			}
+		}
+		if sum != 0 {
+			sig1 = append(sig1, base64Chars[h1%64])
+			sig2 = append(sig2, base64Chars[h2%64])
+		}
+		// Too few pieces say little; retry with smaller ones
+		if blockSize > minBlockSize && len(sig1) < hashLength/2 {
+			blockSize /= 2
+			continue
+		}
+		return fmt.Sprintf("%d:%s:%s", blockSize, sig1, sig2)
+	}
+}
+
+// CompareFuzzy scores two fuzzy hashes from 0 (nothing in common) to 100
+// (the same data). Hashes of block sizes more than a factor of two apart
+// cannot be compared and score 0.
+func CompareFuzzy(a, b string) (int, error) {
+	sizeA, a1, a2, err := parseFuzzy(a)
+	if err != nil {
+		return 0, err
+	}
+	sizeB, b1, b2, err := parseFuzzy(b)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case sizeA == sizeB:
+		return max(scoreParts(a1, b1, sizeA), scoreParts(a2, b2, 2*sizeA)), nil
+	case sizeA == 2*sizeB:
+		return scoreParts(a1, b2, sizeA), nil
+	case sizeB == 2*sizeA:
+		return scoreParts(a2, b1, sizeB), nil
+	default:
+		return 0, nil
+	}
+}
+
+// parseFuzzy splits a fuzzy hash into its block size and parts, with runs of
+// more than three equal characters shortened to three, since they carry
+// little information
+func parseFuzzy(hash string) (uint32, string, string, error) {
+	fields := strings.Split(hash, ":")
+	if len(fields) != 3 {
+		return 0, "", "", fmt.Errorf("invalid fuzzy hash %q", hash)
+	}
+	size, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil || size < minBlockSize {
+		return 0, "", "", fmt.Errorf("invalid block size in fuzzy hash %q", hash)
+	}
+	return uint32(size), shortenRuns(fields[1]), shortenRuns(fields[2]), nil
+}
+
+// shortenRuns shortens runs of more than three equal characters to three
+func shortenRuns(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if i >= 3 && s[i] == s[i-1] && s[i] == s[i-2] && s[i] == s[i-3] {
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// scoreParts scores two hash parts of the same block size by their edit
+// distance. Parts without a common substring of rollingWindow characters
+// share no piece and score 0.
+func scoreParts(a, b string, blockSize uint32) int {
+	if a == b && a != "" {
+		return 100
+	}
+	if !commonSubstring(a, b) {
+		return 0
+	}
+	// The distance in characters, scaled to the length of both parts
+	distance := editDistance(a, b) * hashLength / (len(a) + len(b))
+	score := 100 - 100*distance/hashLength
+	if score <= 0 {
+		return 0
+	}
+	// Small block sizes match by chance more easily, so their scores are capped
+	if blockSize < (99+rollingWindow)/rollingWindow*minBlockSize {
+		score = min(score, int(blockSize)/minBlockSize*min(len(a), len(b)))
+	}
+	return score
+}
+
+// commonSubstring reports whether a and b share a substring of rollingWindow characters
+func commonSubstring(a, b string) bool {
+	for i := 0; i+rollingWindow <= len(a); i++ {
+		if strings.Contains(b, a[i:i+rollingWindow]) {
+			return true
+		}
+	}
+	return false
+}
+
+// editDistance returns the number of insertions and deletions that turn a
+// into b; a substitution counts as both
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := prev[j-1]
+			if a[i-1] != b[j-1] {
+				cost += 2
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
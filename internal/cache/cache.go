@@ -0,0 +1,148 @@
+// Package cache keeps LLM responses on disk, one JSON file per request, so
+// that rewriting an unchanged function again needs no API call
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// entry is a cached response as stored on disk
+type entry struct {
+	Key      string    `json:"key"`
+	Response string    `json:"response"`
+	Created  time.Time `json:"created"`
+}
+
+// Cache is a directory of cached responses. Keys are hashes of everything
+// that determines a response, such as the prompt and the model; the caller
+// computes them.
+type Cache struct {
+	Dir string
+	// Bypass makes every lookup miss; responses are still stored, so a
+	// bypassing run refreshes the cache
+	Bypass bool
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// DefaultDir returns the cache directory under the user's cache directory,
+// e.g. ~/.cache/metamorph/responses on Linux
+func DefaultDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "metamorph", "responses")
+}
+
+// Open creates dir if needed and returns the cache stored in it
+func Open(dir string) (*Cache, error) {
+	// Responses contain the rewritten code, which may be confidential
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &Cache{Dir: dir}, nil
+}
+
+// path returns the file of a key, in a subdirectory named after the first
+// two hex digits of its hash so no directory grows too large
+func (c *Cache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.Dir, name[:2], name+".json")
+}
+
+// Get returns the cached response for key
+func (c *Cache) Get(key string) (string, bool) {
+	if c.Bypass {
+		c.misses.Add(1)
+		return "", false
+	}
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		c.misses.Add(1)
+		return "", false
+	}
+	var e entry
+	// A damaged entry is a miss and is overwritten by the next Put
+	if err := json.Unmarshal(data, &e); err != nil || e.Key != key {
+		c.misses.Add(1)
+		return "", false
+	}
+	c.hits.Add(1)
+	return e.Response, true
+}
+
+// Put stores the response for key. It writes a temporary file and renames
+// it, so concurrent runs never read a half-written entry.
+func (c *Cache) Put(key, response string) error {
+	data, err := json.Marshal(entry{Key: key, Response: response, Created: time.Now().UTC()})
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to commit cache entry: %w", err)
+	}
+	return nil
+}
+
+// Clear removes every cached response and returns how many there were.
+// Files the cache did not write are left alone.
+func (c *Cache) Clear() (int, error) {
+	removed := 0
+	err := filepath.WalkDir(c.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".json") && !strings.Contains(d.Name(), ".json.tmp") {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		if strings.HasSuffix(d.Name(), ".json") {
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("failed to clear cache: %w", err)
+	}
+	return removed, nil
+}
+
+// Hits returns how many lookups found a response
+func (c *Cache) Hits() int64 {
+	return c.hits.Load()
+}
+
+// Misses returns how many lookups found none
+func (c *Cache) Misses() int64 {
+	return c.misses.Load()
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCache tests that responses survive reopening the cache and can be cleared
+func TestCache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "responses")
+	c, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, ok := c.Get("k1"); ok {
+		t.Fatal("Expected an empty cache to miss")
+	}
+	if err := c.Put("k1", "func a() {}"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := c.Put("k2", "func b() {}"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if response, ok := reopened.Get("k1"); !ok || response != "func a() {}" {
+		t.Errorf("Expected the stored response, got %q, %v", response, ok)
+	}
+	if reopened.Hits() != 1 || c.Misses() != 1 {
+		t.Errorf("Expected 1 hit and 1 miss, got %d and %d", reopened.Hits(), c.Misses())
+	}
+
+	// A damaged entry is a miss
+	if err := os.WriteFile(c.path("k2"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("k2"); ok {
+		t.Error("Expected a damaged entry to miss")
+	}
+
+	c.Bypass = true
+	if _, ok := c.Get("k1"); ok {
+		t.Error("Expected a bypassing cache to miss")
+	}
+	c.Bypass = false
+
+	other := filepath.Join(dir, "README")
+	if err := os.WriteFile(other, []byte("not an entry"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := c.Clear()
+	if err != nil || removed != 2 {
+		t.Fatalf("Expected 2 entries to be removed, got %d, %v", removed, err)
+	}
+	if _, ok := c.Get("k1"); ok {
+		t.Error("Expected a cleared cache to miss")
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("Expected other files to be kept: %v", err)
+	}
+}
@@ -0,0 +1,292 @@
+package capability
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Capability is something code can do to the system beyond computing values
+type Capability string
+
+const (
+	Exec      Capability = "exec"       // Start other programs
+	Network   Capability = "network"    // Open network connections
+	FileWrite Capability = "file-write" // Create, modify or remove files
+	Syscall   Capability = "syscall"    // Call the operating system directly
+	Unsafe    Capability = "unsafe"     // Bypass the type system
+	Cgo       Capability = "cgo"        // Call C code
+)
+
+// PackageScope is the pseudo-function that holds capabilities used outside
+// function bodies, such as in package-level variable initializers
+const PackageScope = "(package)"
+
+// Set is a set of capabilities
+type Set map[Capability]bool
+
+// List returns the capabilities in the set, sorted
+func (s Set) List() []Capability {
+	list := make([]Capability, 0, len(s))
+	for c := range s {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	return list
+}
+
+// String formats the set as a comma-separated list
+func (s Set) String() string {
+	names := make([]string, 0, len(s))
+	for _, c := range s.List() {
+		names = append(names, string(c))
+	}
+	return strings.Join(names, ", ")
+}
+
+// Report maps each function (by name, methods as Type.Method) to the capabilities it uses
+type Report map[string]Set
+
+// Total returns the union of all functions' capabilities
+func (r Report) Total() Set {
+	total := Set{}
+	for _, set := range r {
+		for c := range set {
+			total[c] = true
+		}
+	}
+	return total
+}
+
+// fileWriters are the functions of package os that modify the filesystem
+var fileWriters = map[string]bool{
+	"Create": true, "CreateTemp": true, "WriteFile": true, "Mkdir": true, "MkdirAll": true,
+	"MkdirTemp": true, "Remove": true, "RemoveAll": true, "Rename": true, "Chmod": true,
+	"Chown": true, "Lchown": true, "Chtimes": true, "Link": true, "Symlink": true,
+	"Truncate": true, "CopyFS": true,
+}
+
+// Analyze computes the capability report of a Go source file
+func Analyze(source string) (Report, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", source, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse source: %w", err)
+	}
+
+	// Map each import's local name to its path, so aliases cannot hide a capability
+	imports := make(map[string]string)
+	report := Report{}
+	for _, spec := range f.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := ImportName(path)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		switch {
+		case path == "C":
+			// cgo is a capability of the file even if no function names C
+			addCapability(report, PackageScope, Cgo)
+		case name == "_" || name == ".":
+			// Blank and dot imports can run init code or hide calls; attribute them
+			// to the package using the capabilities of the whole import
+			caps := importCapabilities(path)
+			switch path {
+			case "os":
+				caps = []Capability{Exec, FileWrite}
+			case "io/ioutil":
+				caps = []Capability{FileWrite}
+			}
+			for _, c := range caps {
+				addCapability(report, PackageScope, c)
+			}
+		default:
+			imports[name] = path
+		}
+	}
+
+	for _, decl := range f.Decls {
+		scope := PackageScope
+		if fd, ok := decl.(*ast.FuncDecl); ok {
+			scope = FuncName(fd)
+			if _, ok := report[scope]; !ok {
+				report[scope] = Set{}
+			}
+		}
+		ast.Inspect(decl, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			ident, ok := sel.X.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			if path, ok := imports[ident.Name]; ok {
+				for _, c := range selectorCapabilities(path, sel.Sel.Name) {
+					addCapability(report, scope, c)
+				}
+			}
+			return true
+		})
+
+		// os.OpenFile only writes when not opened read-only
+		ast.Inspect(decl, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) < 2 {
+				return true
+			}
+			if sel, ok := call.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "OpenFile" {
+				if ident, ok := sel.X.(*ast.Ident); ok && imports[ident.Name] == "os" && !readOnlyFlag(call.Args[1], imports) {
+					addCapability(report, scope, FileWrite)
+				}
+			}
+			return true
+		})
+	}
+	return report, nil
+}
+
+// importCapabilities returns what any use of a package grants
+func importCapabilities(path string) []Capability {
+	switch {
+	case path == "os/exec":
+		return []Capability{Exec}
+	case path == "net" || strings.HasPrefix(path, "net/") || path == "crypto/tls":
+		return []Capability{Network}
+	case path == "syscall" || strings.HasPrefix(path, "golang.org/x/sys/"):
+		return []Capability{Syscall}
+	case path == "unsafe":
+		return []Capability{Unsafe}
+	case path == "C":
+		return []Capability{Cgo}
+	}
+	return nil
+}
+
+// selectorCapabilities returns what using name from the package at path grants
+func selectorCapabilities(path, name string) []Capability {
+	switch path {
+	case "os":
+		switch {
+		case name == "StartProcess":
+			return []Capability{Exec}
+		case fileWriters[name]:
+			return []Capability{FileWrite}
+		}
+		return nil
+	case "io/ioutil":
+		if name == "WriteFile" || name == "TempFile" || name == "TempDir" {
+			return []Capability{FileWrite}
+		}
+		return nil
+	case "syscall":
+		if name == "Exec" || name == "ForkExec" || name == "StartProcess" {
+			return []Capability{Syscall, Exec}
+		}
+	}
+	return importCapabilities(path)
+}
+
+// readOnlyFlag reports whether an os.OpenFile flag argument is exactly os.O_RDONLY
+func readOnlyFlag(arg ast.Expr, imports map[string]string) bool {
+	sel, ok := arg.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	return ok && imports[ident.Name] == "os" && sel.Sel.Name == "O_RDONLY"
+}
+
+// ImportName returns the default local name of an import path, skipping a
+// major version suffix such as the v2 in math/rand/v2
+func ImportName(path string) string {
+	parts := strings.Split(path, "/")
+	name := parts[len(parts)-1]
+	if len(parts) > 1 && len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+		name = parts[len(parts)-2]
+	}
+	return name
+}
+
+func addCapability(report Report, scope string, c Capability) {
+	if report[scope] == nil {
+		report[scope] = Set{}
+	}
+	report[scope][c] = true
+}
+
+// FuncName names a function declaration, qualifying methods with their receiver type
+func FuncName(fd *ast.FuncDecl) string {
+	if fd.Recv == nil || len(fd.Recv.List) == 0 {
+		return fd.Name.Name
+	}
+	t := fd.Recv.List[0].Type
+	if star, ok := t.(*ast.StarExpr); ok {
+		t = star.X
+	}
+	switch rt := t.(type) {
+	case *ast.Ident:
+		return rt.Name + "." + fd.Name.Name
+	case *ast.IndexExpr:
+		if id, ok := rt.X.(*ast.Ident); ok {
+			return id.Name + "." + fd.Name.Name
+		}
+	case *ast.IndexListExpr:
+		if id, ok := rt.X.(*ast.Ident); ok {
+			return id.Name + "." + fd.Name.Name
+		}
+	}
+	return fd.Name.Name
+}
+
+// Gain is a capability a function has after rewriting but did not have before
+type Gain struct {
+	Function     string
+	Capabilities Set
+}
+
+// Compare returns the functions that gained capabilities in rewritten, in name order
+func Compare(original, rewritten Report) []Gain {
+	var gains []Gain
+	for name, set := range rewritten {
+		gained := Set{}
+		for c := range set {
+			if !original[name][c] {
+				gained[c] = true
+			}
+		}
+		if len(gained) > 0 {
+			gains = append(gains, Gain{Function: name, Capabilities: gained})
+		}
+	}
+	sort.Slice(gains, func(i, j int) bool { return gains[i].Function < gains[j].Function })
+	return gains
+}
+
+// CheckRewrite analyzes both versions of a file and returns an error listing
+// every function that gained a capability through rewriting
+func CheckRewrite(original, rewritten string) error {
+	before, err := Analyze(original)
+	if err != nil {
+		return fmt.Errorf("original: %w", err)
+	}
+	after, err := Analyze(rewritten)
+	if err != nil {
+		return fmt.Errorf("rewritten: %w", err)
+	}
+
+	gains := Compare(before, after)
+	if len(gains) == 0 {
+		return nil
+	}
+	details := make([]string, len(gains))
+	for i, g := range gains {
+		details[i] = fmt.Sprintf("%s gained %s", g.Function, g.Capabilities)
+	}
+	return fmt.Errorf("rewrite gained capabilities the original code did not have: %s", strings.Join(details, "; "))
+}
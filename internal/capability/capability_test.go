@@ -0,0 +1,98 @@
+package capability
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestAnalyze tests capability detection, including aliased imports
+func TestAnalyze(t *testing.T) {
+	src := `package p
+
+import (
+	"fmt"
+	"os"
+	run "os/exec"
+	"net/http"
+	"unsafe"
+)
+
+var client = http.DefaultClient
+
+func pure(x int) int { return x * 2 }
+
+func write() error { return os.WriteFile("x", nil, 0644) }
+
+func read() (*os.File, error) { return os.OpenFile("x", os.O_RDONLY, 0) }
+
+func append2() (*os.File, error) { return os.OpenFile("x", os.O_APPEND|os.O_WRONLY, 0) }
+
+func spawn() error { return run.Command("true").Run() }
+
+func (s *server) peek(p *int) uintptr { return uintptr(unsafe.Pointer(p)) }
+
+func show() { fmt.Println(os.Getenv("HOME")) }
+`
+	report, err := Analyze(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		PackageScope:  "network",
+		"pure":        "",
+		"write":       "file-write",
+		"read":        "",
+		"append2":     "file-write",
+		"spawn":       "exec",
+		"server.peek": "unsafe",
+		"show":        "",
+	}
+	for name, want := range expected {
+		if got := report[name].String(); got != want {
+			t.Errorf("%s: expected capabilities %q, got %q", name, want, got)
+		}
+	}
+	if got := report.Total().String(); got != "exec, file-write, network, unsafe" {
+		t.Errorf("Unexpected total capabilities %q", got)
+	}
+}
+
+// TestCheckRewrite tests that gained capabilities fail the check
+func TestCheckRewrite(t *testing.T) {
+	original := "package p\n\nimport \"os\"\n\nfunc a() error { return os.Remove(\"x\") }\n\nfunc b() int { return 1 }\n"
+
+	// Obfuscation that keeps the capabilities passes
+	same := "package p\n\nimport xx \"os\"\n\nfunc a() error { f := xx.Remove; return f(\"x\") }\n\nfunc b() int { return 2 - 1 }\n"
+	if err := CheckRewrite(original, same); err != nil {
+		t.Errorf("Expected no gained capabilities: %v", err)
+	}
+
+	gained := "package p\n\nimport (\n\t\"net\"\n\t\"os\"\n)\n\nfunc a() error { return os.Remove(\"x\") }\n\n" +
+		"func b() int { c, _ := net.Dial(\"tcp\", \"example.com:80\"); _ = os.Remove(\"y\"); _ = c; return 1 }\n"
+	err := CheckRewrite(original, gained)
+	if err == nil || !strings.Contains(err.Error(), "b gained file-write, network") {
+		t.Errorf("Expected b to have gained file-write and network, got %v", err)
+	}
+
+	dot := "package p\n\nimport . \"os\"\n\nfunc a() error { return Remove(\"x\") }\n\nfunc b() int { return 1 }\n"
+	if err := CheckRewrite(original, dot); err == nil {
+		t.Error("Expected a dot import of os to count as a gained capability")
+	}
+}
+
+// TestGoldenRewriteGainsNothing checks the recorded rewrite of the suspicious program
+func TestGoldenRewriteGainsNothing(t *testing.T) {
+	original, err := os.ReadFile("../rewriter/testdata/corpus/suspicious.go")
+	if err != nil {
+		t.Skipf("Corpus not available: %v", err)
+	}
+	rewritten, err := os.ReadFile("../rewriter/testdata/golden/suspicious.go.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckRewrite(string(original), string(rewritten)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,254 @@
+// Package config loads metamorph.yaml, which sets default flag values of the
+// rewriter and manager commands. Flags given on the command line override it.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultPath is the conventional name of the config file
+const DefaultPath = "metamorph.yaml"
+
+// Sections lists the commands a config file can configure
+var Sections = []string{"rewriter", "manager"}
+
+// Config is a loaded config file. It supports the subset of YAML that flag
+// values need: one mapping per section from flag names to scalars, or to
+// lists written as [a, b] or as "- item" lines.
+type Config struct {
+	Path     string
+	sections map[string][]entry
+}
+
+// entry is one flag value of a section
+type entry struct {
+	key    string
+	values []string
+	list   bool
+	line   int
+}
+
+// Load reads and parses a config file
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return Parse(path, string(data))
+}
+
+// Parse parses the content of a config file; path is used in errors
+func Parse(path, content string) (*Config, error) {
+	c := &Config{Path: path, sections: make(map[string][]entry)}
+	section, indent := "", 0
+	var pending *entry // A key without a value, which list items may follow
+
+	for i, raw := range strings.Split(content, "\n") {
+		line := i + 1
+		text := strings.TrimRight(stripComment(raw), " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || (line == 1 && trimmed == "---") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("%s:%d: tabs are not allowed in indentation", path, line)
+		}
+		depth := len(text) - len(trimmed)
+
+		if depth == 0 {
+			name, ok := strings.CutSuffix(trimmed, ":")
+			if !ok || strings.ContainsAny(name, ": ") {
+				return nil, fmt.Errorf("%s:%d: expected a section such as \"rewriter:\"", path, line)
+			}
+			if !slices.Contains(Sections, name) {
+				return nil, fmt.Errorf("%s:%d: unknown section %q (expected %s)", path, line, name, strings.Join(Sections, " or "))
+			}
+			if _, ok := c.sections[name]; ok {
+				return nil, fmt.Errorf("%s:%d: section %s is defined twice", path, line, name)
+			}
+			c.sections[name] = nil
+			section, indent, pending = name, 0, nil
+			continue
+		}
+		if section == "" {
+			return nil, fmt.Errorf("%s:%d: values must be inside a section", path, line)
+		}
+
+		if item, ok := strings.CutPrefix(trimmed, "-"); ok && (item == "" || item[0] == ' ') {
+			if pending == nil || depth < indent {
+				return nil, fmt.Errorf("%s:%d: list item without a key", path, line)
+			}
+			value, err := scalar(strings.TrimSpace(item))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			pending.values = append(pending.values, value)
+			pending.list = true
+			continue
+		}
+
+		if indent == 0 {
+			indent = depth
+		}
+		if depth != indent {
+			return nil, fmt.Errorf("%s:%d: unexpected indentation; nested mappings are not supported", path, line)
+		}
+		key, value, found := strings.Cut(trimmed, ":")
+		key = strings.TrimSpace(key)
+		if !found || key == "" || (value != "" && value[0] != ' ') {
+			return nil, fmt.Errorf("%s:%d: expected \"flag: value\"", path, line)
+		}
+		entries := c.sections[section]
+		if slices.ContainsFunc(entries, func(e entry) bool { return e.key == key }) {
+			return nil, fmt.Errorf("%s:%d: %s is set twice in section %s", path, line, key, section)
+		}
+		e := entry{key: key, line: line}
+		value = strings.TrimSpace(value)
+		switch {
+		case value == "":
+			// Either an empty value or the start of a block list
+		case strings.HasPrefix(value, "["):
+			items, err := flowList(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			e.values, e.list = items, true
+		case strings.HasPrefix(value, "{"):
+			return nil, fmt.Errorf("%s:%d: nested mappings are not supported", path, line)
+		default:
+			v, err := scalar(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			e.values = []string{v}
+		}
+		c.sections[section] = append(entries, e)
+		pending = nil
+		if value == "" {
+			pending = &c.sections[section][len(c.sections[section])-1]
+		}
+	}
+	return c, nil
+}
+
+// stripComment removes a # comment that is not inside quotes
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch ch := line[i]; {
+		case quote != 0:
+			if ch == '\\' && quote == '"' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// scalar returns the value of a plain, single-quoted or double-quoted scalar.
+// null and ~ are empty.
+func scalar(value string) (string, error) {
+	switch {
+	case value == "~" || value == "null":
+		return "", nil
+	case strings.HasPrefix(value, `"`):
+		s, err := strconv.Unquote(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid double-quoted value %s", value)
+		}
+		return s, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("invalid single-quoted value %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	}
+	return value, nil
+}
+
+// flowList returns the items of a list written as [a, "b", c]
+func flowList(value string) ([]string, error) {
+	if !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("unterminated list %s", value)
+	}
+	inner := strings.TrimSpace(value[1 : len(value)-1])
+	if inner == "" {
+		return []string{}, nil
+	}
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i <= len(inner); i++ {
+		if i < len(inner) {
+			ch := inner[i]
+			if quote != 0 {
+				if ch == '\\' && quote == '"' {
+					i++
+				} else if ch == quote {
+					quote = 0
+				}
+				continue
+			}
+			if ch == '"' || ch == '\'' {
+				quote = ch
+				continue
+			}
+			if ch == '[' || ch == '{' {
+				return nil, fmt.Errorf("nested lists are not supported")
+			}
+			if ch != ',' {
+				continue
+			}
+		}
+		item, err := scalar(strings.TrimSpace(inner[start:i]))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		start = i + 1
+	}
+	return items, nil
+}
+
+// Apply sets the flags of a section that were not given on the command line,
+// so it must be called after fs is parsed. Keys are flag names without the
+// dash, and a key that is not a flag of fs is an error, so a typo cannot go
+// unnoticed. A list sets a repeatable flag once per item and any other flag
+// to the comma-separated items.
+func (c *Config) Apply(fs *flag.FlagSet, section string) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	for _, e := range c.sections[section] {
+		f := fs.Lookup(e.key)
+		if f == nil || e.key == "config" {
+			return fmt.Errorf("%s:%d: %s has no flag -%s", c.Path, e.line, section, e.key)
+		}
+		if given[e.key] {
+			continue
+		}
+		values := []string{strings.Join(e.values, ",")}
+		// The standard flag types implement flag.Getter; repeatable flags
+		// such as the manager's -test-command collect one value per Set
+		if _, standard := f.Value.(flag.Getter); e.list && !standard {
+			values = e.values
+		}
+		for _, v := range values {
+			if err := fs.Set(e.key, v); err != nil {
+				return fmt.Errorf("%s:%d: invalid value for -%s: %w", c.Path, e.line, e.key, err)
+			}
+		}
+	}
+	return nil
+}
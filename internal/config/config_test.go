@@ -0,0 +1,113 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// repeatedFlag collects every value it is set to
+type repeatedFlag []string
+
+func (f *repeatedFlag) String() string { return strings.Join(*f, ";") }
+
+func (f *repeatedFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// TestApply tests that file values become flag defaults that the command line overrides
+func TestApply(t *testing.T) {
+	content := `---
+# Settings shared by every run
+rewriter:
+  api: anthropic
+  model: "claude-sonnet-4"   # quoted
+  technique: [dead-code, 'opaque-predicates']
+  concurrency: 4
+  comment: "# not a comment"
+
+manager:
+  timeout: 2m
+  keep: false
+  test-command:
+    - ./cmd/app=make test
+    - "go test -tags=x ./..."
+`
+	path := filepath.Join(t.TempDir(), DefaultPath)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	fs := flag.NewFlagSet("rewriter", flag.ContinueOnError)
+	api := fs.String("api", "openrouter", "")
+	model := fs.String("model", "", "")
+	technique := fs.String("technique", "dead-code", "")
+	concurrency := fs.Int("concurrency", 1, "")
+	comment := fs.String("comment", "", "")
+	if err := fs.Parse([]string{"-api", "gemini"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Apply(fs, "rewriter"); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if *api != "gemini" {
+		t.Errorf("Expected the command line to override the file, got api %q", *api)
+	}
+	if *model != "claude-sonnet-4" || *technique != "dead-code,opaque-predicates" || *concurrency != 4 || *comment != "# not a comment" {
+		t.Errorf("Unexpected values: model %q, technique %q, concurrency %d, comment %q", *model, *technique, *concurrency, *comment)
+	}
+
+	fs = flag.NewFlagSet("manager", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", 30*time.Second, "")
+	keep := fs.Bool("keep", true, "")
+	var commands repeatedFlag
+	fs.Var(&commands, "test-command", "")
+	if err := fs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Apply(fs, "manager"); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if *timeout != 2*time.Minute || *keep {
+		t.Errorf("Unexpected values: timeout %v, keep %v", *timeout, *keep)
+	}
+	if len(commands) != 2 || commands[1] != "go test -tags=x ./..." {
+		t.Errorf("Expected a repeatable flag to be set per item, got %q", commands)
+	}
+
+	// A key that is not a flag is a typo
+	fs = flag.NewFlagSet("rewriter", flag.ContinueOnError)
+	fs.String("api", "", "")
+	if err := cfg.Apply(fs, "rewriter"); err == nil || !strings.Contains(err.Error(), ":5: rewriter has no flag -model") {
+		t.Errorf("Expected an unknown flag to be reported with its line, got %v", err)
+	}
+}
+
+// TestParseErrors tests that unsupported or malformed files are rejected
+func TestParseErrors(t *testing.T) {
+	cases := map[string]string{
+		"unknown section":   "rewritter:\n  api: gemini\n",
+		"outside section":   "api: gemini\n",
+		"duplicate key":     "rewriter:\n  api: gemini\n  api: openrouter\n",
+		"nested mapping":    "rewriter:\n  api:\n    name: gemini\n",
+		"flow mapping":      "rewriter:\n  api: {name: gemini}\n",
+		"unterminated list": "rewriter:\n  technique: [dead-code\n",
+		"bad quote":         "rewriter:\n  model: \"gpt\n",
+		"orphan item":       "rewriter:\n  - gemini\n",
+		"tab indentation":   "rewriter:\n\tapi: gemini\n",
+		"duplicate section": "rewriter:\n  api: gemini\nrewriter:\n  model: m\n",
+	}
+	for name, content := range cases {
+		if _, err := Parse("metamorph.yaml", content); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
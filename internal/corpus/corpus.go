@@ -0,0 +1,167 @@
+package corpus
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Category describes the behavior class of a corpus function
+type Category string
+
+const (
+	CategoryComputation        Category = "computation"
+	CategoryEncoding           Category = "encoding"
+	CategoryFilesystem         Category = "filesystem"
+	CategoryLogging            Category = "logging"
+	CategoryNetwork            Category = "network"
+	CategoryStringManipulation Category = "string-manipulation"
+)
+
+// Difficulty describes how hard a function is expected to be to rewrite correctly
+type Difficulty string
+
+const (
+	DifficultyEasy   Difficulty = "easy"
+	DifficultyMedium Difficulty = "medium"
+	DifficultyHard   Difficulty = "hard"
+)
+
+// Label holds the ground-truth annotations for a single corpus function
+type Label struct {
+	Function   string     `json:"function"`
+	Category   Category   `json:"category"`
+	Pure       bool       `json:"pure"`    // No side effects and deterministic output
+	IO         bool       `json:"io"`      // Touches stdout, files or other OS resources
+	Network    bool       `json:"network"` // Performs network requests
+	Difficulty Difficulty `json:"difficulty"`
+}
+
+// LabelSet holds the labels for all functions of one corpus file
+type LabelSet struct {
+	File      string  `json:"file"`
+	Functions []Label `json:"functions"`
+}
+
+// LabelsPathFor returns the conventional labels file path for a corpus source file
+// (e.g. suspicious.go -> suspicious.labels.json)
+func LabelsPathFor(sourcePath string) string {
+	return strings.TrimSuffix(sourcePath, ".go") + ".labels.json"
+}
+
+// LoadLabels reads and validates a labels file
+func LoadLabels(path string) (*LabelSet, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read labels file: %w", err)
+	}
+
+	var ls LabelSet
+	if err := json.Unmarshal(content, &ls); err != nil {
+		return nil, fmt.Errorf("failed to parse labels file %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool)
+	for _, l := range ls.Functions {
+		if l.Function == "" {
+			return nil, fmt.Errorf("labels file %s contains an entry without a function name", path)
+		}
+		if seen[l.Function] {
+			return nil, fmt.Errorf("labels file %s contains duplicate entry for %s", path, l.Function)
+		}
+		seen[l.Function] = true
+		if !l.Difficulty.valid() {
+			return nil, fmt.Errorf("labels file %s: invalid difficulty %q for %s", path, l.Difficulty, l.Function)
+		}
+	}
+
+	return &ls, nil
+}
+
+// Lookup returns the label for the named function. Labels name methods by
+// their bare name, so a method qualified with its receiver type, as in
+// "Counter.Inc", falls back to the label of "Inc".
+func (ls *LabelSet) Lookup(function string) (Label, bool) {
+	for _, l := range ls.Functions {
+		if l.Function == function {
+			return l, true
+		}
+	}
+	if _, method, ok := strings.Cut(function, "."); ok {
+		return ls.Lookup(method)
+	}
+	return Label{}, false
+}
+
+// Categories returns the distinct categories present in the label set, sorted
+func (ls *LabelSet) Categories() []Category {
+	seen := make(map[Category]bool)
+	var categories []Category
+	for _, l := range ls.Functions {
+		if !seen[l.Category] {
+			seen[l.Category] = true
+			categories = append(categories, l.Category)
+		}
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i] < categories[j] })
+	return categories
+}
+
+// CheckCoverage verifies that every function declared in the Go source has a label
+// and that no label refers to a function missing from the source
+func (ls *LabelSet) CheckCoverage(content string) error {
+	names, err := FunctionNames(content)
+	if err != nil {
+		return err
+	}
+
+	declared := make(map[string]bool)
+	var missing []string
+	for _, name := range names {
+		declared[name] = true
+		if _, ok := ls.Lookup(name); !ok {
+			missing = append(missing, name)
+		}
+	}
+
+	var stale []string
+	for _, l := range ls.Functions {
+		if !declared[l.Function] {
+			stale = append(stale, l.Function)
+		}
+	}
+
+	if len(missing) > 0 || len(stale) > 0 {
+		return fmt.Errorf("labels out of sync with %s: unlabelled %v, unknown %v", ls.File, missing, stale)
+	}
+	return nil
+}
+
+// FunctionNames returns the names of the top-level functions with bodies in the Go source
+func FunctionNames(content string) ([]string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), "", content, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse source: %w", err)
+	}
+
+	var names []string
+	for _, decl := range f.Decls {
+		if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Body != nil {
+			names = append(names, funcDecl.Name.Name)
+		}
+	}
+	return names, nil
+}
+
+func (d Difficulty) valid() bool {
+	switch d {
+	case DifficultyEasy, DifficultyMedium, DifficultyHard:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package corpus
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSuspiciousLabelsCoverage ensures every function in the bundled corpus is labelled
+func TestSuspiciousLabelsCoverage(t *testing.T) {
+	sourcePath := filepath.Join("..", "suspicious", "suspicious.go")
+
+	ls, err := LoadLabels(LabelsPathFor(sourcePath))
+	if err != nil {
+		t.Fatalf("Failed to load labels: %v", err)
+	}
+
+	content, err := os.ReadFile(sourcePath)
+	if err != nil {
+		t.Fatalf("Failed to read corpus source: %v", err)
+	}
+
+	if err := ls.CheckCoverage(string(content)); err != nil {
+		t.Error(err)
+	}
+
+	label, ok := ls.Lookup("BeaconHome")
+	if !ok {
+		t.Fatal("Expected a label for BeaconHome")
+	}
+	if !label.Network || label.Category != CategoryNetwork {
+		t.Errorf("Expected BeaconHome to be labelled as network, got %+v", label)
+	}
+	if qualified, ok := ls.Lookup("Agent.BeaconHome"); !ok || qualified != label {
+		t.Errorf("Expected a method qualified with its receiver to use the bare label, got %+v", qualified)
+	}
+}
+
+func TestLoadLabelsRejectsInvalid(t *testing.T) {
+	tests := map[string]string{
+		"duplicate":  `{"functions": [{"function": "A", "difficulty": "easy"}, {"function": "A", "difficulty": "easy"}]}`,
+		"no name":    `{"functions": [{"difficulty": "easy"}]}`,
+		"difficulty": `{"functions": [{"function": "A", "difficulty": "trivial"}]}`,
+		"malformed":  `{"functions": [`,
+	}
+
+	for name, content := range tests {
+		path := filepath.Join(t.TempDir(), "labels.json")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write labels file: %v", err)
+		}
+		if _, err := LoadLabels(path); err == nil {
+			t.Errorf("%s: expected LoadLabels to fail", name)
+		}
+	}
+}
+
+func TestCheckCoverage(t *testing.T) {
+	ls := &LabelSet{
+		File: "test.go",
+		Functions: []Label{
+			{Function: "first", Category: CategoryComputation, Difficulty: DifficultyEasy},
+			{Function: "gone", Category: CategoryLogging, Difficulty: DifficultyEasy},
+		},
+	}
+
+	code := "package test\n\nfunc first() {}\n\nfunc second() {}\n"
+	if err := ls.CheckCoverage(code); err == nil {
+		t.Error("Expected coverage check to report unlabelled and unknown functions")
+	}
+
+	categories := ls.Categories()
+	if len(categories) != 2 || categories[0] != CategoryComputation {
+		t.Errorf("Unexpected categories: %v", categories)
+	}
+}
@@ -0,0 +1,567 @@
+// Package dashboard shows the progress of long manager runs. On a terminal it
+// redraws one view of every source file (its stages, function rewrites, metric
+// deltas and token spend) above the latest log lines. Elsewhere it falls back
+// to the plain log with one extra line per finished stage and file.
+package dashboard
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mode decides how progress is shown
+type Mode string
+
+const (
+	// ModeAuto uses ModeTUI on a terminal and ModePlain otherwise
+	ModeAuto Mode = "auto"
+	// ModeTUI redraws the dashboard in place and keeps the log in a file
+	ModeTUI Mode = "tui"
+	// ModePlain prints the log as it is written
+	ModePlain Mode = "plain"
+)
+
+// DefaultLogPath is where the full output goes while the TUI shows its tail
+const DefaultLogPath = ".metamorph/manager.log"
+
+// Status of a file, stage or function rewrite
+const (
+	Pending = "pending"
+	Running = "running"
+	Passed  = "passed"
+	Failed  = "failed"
+	Skipped = "skipped"
+)
+
+// Function is the outcome of rewriting one function, as the rewriter reports it
+type Function struct {
+	Name   string
+	Status string // rewritten, unchanged, failed or skipped
+	Tokens int64
+}
+
+// Stage is one pipeline stage of a file
+type Stage struct {
+	Name     string
+	Status   string
+	Started  time.Time
+	Duration time.Duration
+}
+
+// Item is the progress of one source file
+type Item struct {
+	Source     string
+	Status     string
+	Error      string // First line of the error of a failed run
+	Runs       int    // Runs started for the file, e.g. by a daemon
+	Started    time.Time
+	Duration   time.Duration
+	Stages     []Stage
+	Functions  []Function
+	HasMetrics bool
+	LOC        float64 // Change in percent
+	CC         float64
+	CogC       float64
+}
+
+// Tokens returns the tokens spent on the item's function rewrites
+func (it *Item) Tokens() int64 {
+	var tokens int64
+	for _, f := range it.Functions {
+		tokens += f.Tokens
+	}
+	return tokens
+}
+
+// stage returns the stage of the current run with the given name
+func (it *Item) stage(name string) *Stage {
+	for i := range it.Stages {
+		if it.Stages[i].Name == name {
+			return &it.Stages[i]
+		}
+	}
+	it.Stages = append(it.Stages, Stage{Name: name, Status: Pending})
+	return &it.Stages[len(it.Stages)-1]
+}
+
+// current returns the running stage, or the last one
+func (it *Item) current() string {
+	for _, s := range it.Stages {
+		if s.Status == Running {
+			return s.Name
+		}
+	}
+	if len(it.Stages) == 0 {
+		return ""
+	}
+	return it.Stages[len(it.Stages)-1].Name
+}
+
+// maxLogLines is how many output lines the TUI keeps for its log tail
+const maxLogLines = 200
+
+// Dashboard collects the progress of every file and shows it. A nil
+// *Dashboard ignores every call, so callers need not check for one.
+type Dashboard struct {
+	mode     Mode
+	out      io.Writer
+	term     *os.File // The terminal the TUI is drawn on
+	title    string
+	interval time.Duration
+	log      io.WriteCloser // Full output while the TUI is shown
+	logPath  string
+
+	mu      sync.Mutex
+	started time.Time
+	items   []*Item
+	lines   []string // Latest complete output lines
+	partial []byte   // Output after the last newline, e.g. a prompt
+
+	restore func()
+	stop    chan struct{}
+	done    sync.WaitGroup
+}
+
+// New creates a dashboard writing to out in the given mode, which must not be
+// ModeAuto (see Resolve). The title heads the TUI, e.g. "daemon, every 1h".
+func New(mode Mode, out *os.File, title string) *Dashboard {
+	return &Dashboard{mode: mode, out: out, term: out, title: title, interval: 250 * time.Millisecond, started: time.Now()}
+}
+
+// Resolve turns ModeAuto into ModeTUI when out is a terminal that understands
+// ANSI escapes, and ModePlain otherwise
+func Resolve(mode Mode, out *os.File) (Mode, error) {
+	switch mode {
+	case ModeTUI, ModePlain:
+		return mode, nil
+	case ModeAuto, "":
+		if info, err := out.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 && supportsANSI() {
+			return ModeTUI, nil
+		}
+		return ModePlain, nil
+	default:
+		return "", fmt.Errorf("unknown UI mode %q (auto, tui or plain)", mode)
+	}
+}
+
+// Start shows the dashboard. In ModeTUI everything written to os.Stdout and
+// os.Stderr is captured for the log tail and copied to logPath, until Stop.
+func (d *Dashboard) Start(logPath string) error {
+	if d == nil || d.mode != ModeTUI {
+		return nil
+	}
+	if logPath != "" {
+		if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+			return fmt.Errorf("failed to create log directory: %w", err)
+		}
+		log, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open log: %w", err)
+		}
+		d.log, d.logPath = log, logPath
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to capture output: %w", err)
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, w
+	d.restore = func() {
+		os.Stdout, os.Stderr = stdout, stderr
+		w.Close()
+	}
+
+	d.stop = make(chan struct{})
+	d.done.Add(2)
+	go d.capture(r)
+	go d.redraw()
+	return nil
+}
+
+// Stop restores the output, draws the final view and closes the log
+func (d *Dashboard) Stop() {
+	if d == nil || d.restore == nil {
+		return
+	}
+	d.restore()
+	d.restore = nil
+	close(d.stop)
+	d.done.Wait()
+	d.draw()
+	if d.log != nil {
+		d.log.Close()
+		fmt.Fprintf(d.out, "Full output in %s\n", d.logPath)
+	}
+}
+
+// capture reads the redirected output into the log tail and the log file
+func (d *Dashboard) capture(r io.ReadCloser) {
+	defer d.done.Done()
+	defer r.Close()
+	reader := bufio.NewReader(r)
+	buf := make([]byte, 4096)
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			if d.log != nil {
+				d.log.Write(buf[:n])
+			}
+			d.addOutput(buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// addOutput appends output to the log tail
+func (d *Dashboard) addOutput(p []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.partial = append(d.partial, p...)
+	for {
+		i := bytes.IndexByte(d.partial, '\n')
+		if i < 0 {
+			break
+		}
+		d.lines = append(d.lines, strings.TrimRight(string(d.partial[:i]), "\r"))
+		d.partial = d.partial[i+1:]
+	}
+	if len(d.lines) > maxLogLines {
+		d.lines = append([]string(nil), d.lines[len(d.lines)-maxLogLines:]...)
+	}
+}
+
+// redraw draws the TUI every interval until Stop
+func (d *Dashboard) redraw() {
+	defer d.done.Done()
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			d.draw()
+		}
+	}
+}
+
+// draw replaces the terminal contents with the current view
+func (d *Dashboard) draw() {
+	width, height := d.size()
+	var frame bytes.Buffer
+	d.Render(&frame, width, height)
+	// Home the cursor, clear each line's rest and everything below the view
+	view := "\x1b[H" + strings.ReplaceAll(frame.String(), "\n", "\x1b[K\n") + "\x1b[J"
+	io.WriteString(d.out, view)
+}
+
+// size returns the terminal size, from the terminal, COLUMNS and LINES, or defaults
+func (d *Dashboard) size() (int, int) {
+	if d.term != nil {
+		if width, height, ok := terminalSize(d.term); ok {
+			return width, height
+		}
+	}
+	width, height := 100, 40
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		width = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("LINES")); err == nil && n > 0 {
+		height = n
+	}
+	return width, height
+}
+
+// item returns the item of source, adding it if it is new. d.mu must be held.
+func (d *Dashboard) item(source string) *Item {
+	for _, it := range d.items {
+		if it.Source == source {
+			return it
+		}
+	}
+	it := &Item{Source: source, Status: Pending}
+	d.items = append(d.items, it)
+	return it
+}
+
+// Pending lists files that will be processed, so the view shows what is left
+func (d *Dashboard) Pending(sources ...string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, source := range sources {
+		d.item(source)
+	}
+}
+
+// Begin starts a new run of source, clearing the stages of a previous run
+func (d *Dashboard) Begin(source string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	it := d.item(source)
+	it.Status, it.Error, it.Started, it.Duration = Running, "", time.Now(), 0
+	it.Stages, it.Functions, it.HasMetrics = nil, nil, false
+	it.Runs++
+}
+
+// StageStarted marks a stage of source as running
+func (d *Dashboard) StageStarted(source, stage string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.item(source).stage(stage)
+	s.Status, s.Started = Running, time.Now()
+}
+
+// StageFinished records the outcome of a stage of source: Passed, Failed or Skipped
+func (d *Dashboard) StageFinished(source, stage, status string, duration time.Duration) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	s := d.item(source).stage(stage)
+	s.Status, s.Duration = status, duration
+	d.mu.Unlock()
+	if d.mode == ModePlain {
+		fmt.Fprintf(d.out, "==> %s: stage %s %s in %v\n", source, stage, status, duration.Round(time.Millisecond))
+	}
+}
+
+// Functions replaces the function rewrites of source with the latest report
+func (d *Dashboard) Functions(source string, functions []Function) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.item(source).Functions = functions
+}
+
+// Metrics records the LOC, CC and CogC changes of the rewrite of source in percent
+func (d *Dashboard) Metrics(source string, loc, cc, cogc float64) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	it := d.item(source)
+	it.HasMetrics, it.LOC, it.CC, it.CogC = true, loc, cc, cogc
+}
+
+// Finish ends the run of source; a nil err means it passed
+func (d *Dashboard) Finish(source string, err error) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	it := d.item(source)
+	it.Status, it.Duration = Passed, time.Since(it.Started)
+	if err != nil {
+		it.Status = Failed
+		it.Error, _, _ = strings.Cut(err.Error(), "\n")
+	}
+	line := fmt.Sprintf("==> %s: %s in %v", source, it.Status, it.Duration.Round(time.Second))
+	if err != nil {
+		line += ": " + it.Error
+	}
+	d.mu.Unlock()
+	if d.mode == ModePlain {
+		fmt.Fprintln(d.out, line)
+	}
+}
+
+// Items returns a copy of the progress of every file
+func (d *Dashboard) Items() []Item {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	items := make([]Item, len(d.items))
+	for i, it := range d.items {
+		items[i] = *it
+		items[i].Stages = append([]Stage(nil), it.Stages...)
+		items[i].Functions = append([]Function(nil), it.Functions...)
+	}
+	return items
+}
+
+// Render writes the view, cut to width columns and height lines
+func (d *Dashboard) Render(w io.Writer, width, height int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var lines []string
+	counts := make(map[string]int)
+	var tokens int64
+	for _, it := range d.items {
+		counts[it.Status]++
+		tokens += it.Tokens()
+	}
+	lines = append(lines,
+		fmt.Sprintf("MetamorphLLM manager - %s - %v elapsed - %s tokens", d.title, time.Since(d.started).Round(time.Second), thousands(tokens)),
+		fmt.Sprintf("%d running, %d passed, %d failed, %d pending", counts[Running], counts[Passed], counts[Failed], counts[Pending]),
+		"",
+		fmt.Sprintf("%-32s %-8s %-12s %-9s %8s %8s %8s %8s %8s", "FILE", "STATUS", "STAGE", "FUNCS", "LOC", "CC", "COGC", "TOKENS", "TIME"),
+	)
+
+	// Leave room for a line on the files left out and a few log lines
+	room := height - len(lines) - 6
+	for i, it := range d.ordered() {
+		block := []string{d.row(it)}
+		// Stages and functions are detailed for running files, and for the only file
+		if it.Status == Running || len(d.items) == 1 {
+			block = append(block, "  "+stagesLine(it))
+			if len(it.Functions) > 0 {
+				block = append(block, "  "+functionsLine(it))
+			}
+		}
+		if it.Status == Failed && it.Error != "" {
+			block = append(block, "  error: "+it.Error)
+		}
+		if len(block) > room && i > 0 {
+			lines = append(lines, fmt.Sprintf("... %d more", len(d.items)-i))
+			break
+		}
+		lines = append(lines, block...)
+		room -= len(block)
+	}
+
+	lines = append(lines, "", "--- log ---")
+	tail := d.lines
+	if len(d.partial) > 0 {
+		tail = append(tail[:len(tail):len(tail)], string(d.partial))
+	}
+	if room := max(height-len(lines)-1, 1); len(tail) > room {
+		tail = tail[len(tail)-room:]
+	}
+	lines = append(lines, tail...)
+
+	for _, line := range lines {
+		if len(line) > width {
+			line = line[:max(width-1, 0)] + "~"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// ordered returns running files first, then failed, pending and passed ones
+func (d *Dashboard) ordered() []*Item {
+	var ordered []*Item
+	for _, status := range []string{Running, Failed, Pending, Passed} {
+		for _, it := range d.items {
+			if it.Status == status {
+				ordered = append(ordered, it)
+			}
+		}
+	}
+	return ordered
+}
+
+// row is the table line of one file
+func (d *Dashboard) row(it *Item) string {
+	status := it.Status
+	if it.Runs > 1 {
+		status = fmt.Sprintf("%s#%d", status, it.Runs)
+	}
+	functions, metrics := "-", [3]string{"-", "-", "-"}
+	if len(it.Functions) > 0 {
+		done := 0
+		for _, f := range it.Functions {
+			if f.Status == "rewritten" {
+				done++
+			}
+		}
+		functions = fmt.Sprintf("%d/%d", done, len(it.Functions))
+	}
+	if it.HasMetrics {
+		metrics = [3]string{percent(it.LOC), percent(it.CC), percent(it.CogC)}
+	}
+	elapsed := it.Duration
+	if it.Status == Running {
+		elapsed = time.Since(it.Started)
+	}
+	var clock string
+	if it.Status != Pending {
+		clock = elapsed.Round(time.Second).String()
+	}
+	return fmt.Sprintf("%-32s %-8s %-12s %-9s %8s %8s %8s %8s %8s",
+		shorten(it.Source, 32), status, it.current(), functions, metrics[0], metrics[1], metrics[2], thousands(it.Tokens()), clock)
+}
+
+// stagesLine lists the stages of the current run with their outcome and duration
+func stagesLine(it *Item) string {
+	if len(it.Stages) == 0 {
+		return "stages: -"
+	}
+	parts := make([]string, len(it.Stages))
+	for i, s := range it.Stages {
+		switch s.Status {
+		case Running:
+			parts[i] = fmt.Sprintf("%s ...%v", s.Name, time.Since(s.Started).Round(time.Second))
+		case Passed:
+			parts[i] = fmt.Sprintf("%s ok %v", s.Name, s.Duration.Round(100*time.Millisecond))
+		default:
+			parts[i] = fmt.Sprintf("%s %s", s.Name, strings.ToUpper(s.Status))
+		}
+	}
+	return "stages: " + strings.Join(parts, " | ")
+}
+
+// functionsLine counts the function rewrites by outcome and names the failed ones
+func functionsLine(it *Item) string {
+	counts := make(map[string]int)
+	var failed []string
+	for _, f := range it.Functions {
+		counts[f.Status]++
+		if f.Status == "failed" {
+			failed = append(failed, f.Name)
+		}
+	}
+	line := fmt.Sprintf("functions: %d rewritten, %d unchanged, %d failed, %d skipped, last %s",
+		counts["rewritten"], counts["unchanged"], counts["failed"], counts["skipped"], it.Functions[len(it.Functions)-1].Name)
+	if len(failed) > 0 {
+		line += " (failed: " + strings.Join(failed, ", ") + ")"
+	}
+	return line
+}
+
+// percent formats a change in percent with its sign
+func percent(v float64) string {
+	return fmt.Sprintf("%+.1f%%", v)
+}
+
+// thousands formats n with thousands separators
+func thousands(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	for i := len(s) - 3; i > 0 && s[i-1] != '-'; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// shorten keeps the end of a path that is longer than n
+func shorten(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return "..." + s[len(s)-n+3:]
+}
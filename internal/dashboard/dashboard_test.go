@@ -0,0 +1,161 @@
+package dashboard
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestResolve tests the choice of mode
+func TestResolve(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	defer file.Close()
+
+	for mode, want := range map[Mode]Mode{ModeAuto: ModePlain, "": ModePlain, ModeTUI: ModeTUI, ModePlain: ModePlain} {
+		if got, err := Resolve(mode, file); err != nil || got != want {
+			t.Errorf("Resolve(%q) = %q, %v, want %q", mode, got, err, want)
+		}
+	}
+	if _, err := Resolve("fancy", file); err == nil {
+		t.Error("Expected an unknown mode to be rejected")
+	}
+}
+
+// TestRender tests that the view shows every file's progress and the log tail
+func TestRender(t *testing.T) {
+	d := &Dashboard{mode: ModeTUI, title: "corpus of 3 item(s)", started: time.Now()}
+	d.Pending("a.go", "b.go", "c.go")
+
+	d.Begin("a.go")
+	d.StageStarted("a.go", "rewrite")
+	d.StageFinished("a.go", "rewrite", Passed, 2*time.Second)
+	d.StageStarted("a.go", "compile")
+	d.Functions("a.go", []Function{
+		{Name: "Add", Status: "rewritten", Tokens: 1200},
+		{Name: "Sub", Status: "failed", Tokens: 800},
+	})
+	d.Metrics("a.go", 12.5, -3, 40)
+
+	d.Begin("b.go")
+	d.Finish("b.go", errors.New("test: exit status 1\nmore detail"))
+	d.addOutput([]byte("Compiling rewritten code...\nApprove deployment? [y/N] "))
+
+	var out bytes.Buffer
+	d.Render(&out, 200, 40)
+	view := out.String()
+	for _, want := range []string{
+		"corpus of 3 item(s)", "2,000 tokens", "1 running, 0 passed, 1 failed, 1 pending",
+		"compile", "1/2", "+12.5%", "-3.0%", "+40.0%",
+		"rewrite ok 2s", "1 rewritten, 0 unchanged, 1 failed, 0 skipped, last Sub (failed: Sub)",
+		"error: test: exit status 1", "Compiling rewritten code...", "Approve deployment? [y/N] ",
+	} {
+		if !strings.Contains(view, want) {
+			t.Errorf("Expected the view to contain %q:\n%s", want, view)
+		}
+	}
+	if strings.Contains(view, "more detail") {
+		t.Errorf("Expected only the first line of the error:\n%s", view)
+	}
+	// Running files come first
+	if strings.Index(view, "a.go") > strings.Index(view, "b.go") || strings.Index(view, "b.go") > strings.Index(view, "c.go") {
+		t.Errorf("Expected running, failed, then pending files:\n%s", view)
+	}
+
+	out.Reset()
+	d.Render(&out, 40, 12)
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) > 11 {
+		t.Errorf("Expected at most 11 lines for a 12-line terminal, got %d:\n%s", len(lines), out.String())
+	}
+	for _, line := range lines {
+		if len(line) > 40 {
+			t.Errorf("Expected lines cut to 40 columns, got %q", line)
+		}
+	}
+}
+
+// TestPlain tests the log lines printed in plain mode
+func TestPlain(t *testing.T) {
+	var out bytes.Buffer
+	d := &Dashboard{mode: ModePlain, out: &out, started: time.Now()}
+	d.Begin("a.go")
+	d.StageStarted("a.go", "compile")
+	d.StageFinished("a.go", "compile", Failed, 1500*time.Millisecond)
+	d.Finish("a.go", errors.New("compilation failed"))
+
+	for _, want := range []string{"==> a.go: stage compile failed in 1.5s", "==> a.go: failed in", ": compilation failed"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in:\n%s", want, out.String())
+		}
+	}
+
+	// A second run starts over
+	d.Begin("a.go")
+	items := d.Items()
+	if len(items) != 1 || items[0].Runs != 2 || items[0].Status != Running || len(items[0].Stages) != 0 {
+		t.Errorf("Expected a fresh second run, got %+v", items)
+	}
+}
+
+// TestNil tests that a nil dashboard ignores every call
+func TestNil(t *testing.T) {
+	var d *Dashboard
+	if err := d.Start(""); err != nil {
+		t.Errorf("Start failed: %v", err)
+	}
+	d.Pending("a.go")
+	d.Begin("a.go")
+	d.StageStarted("a.go", "rewrite")
+	d.StageFinished("a.go", "rewrite", Passed, time.Second)
+	d.Functions("a.go", nil)
+	d.Metrics("a.go", 1, 2, 3)
+	d.Finish("a.go", nil)
+	d.Stop()
+	if d.Items() != nil {
+		t.Error("Expected no items")
+	}
+}
+
+// TestCapture tests that the TUI captures the output into its log tail and log file
+func TestCapture(t *testing.T) {
+	dir := t.TempDir()
+	term, err := os.Create(dir + "/term")
+	if err != nil {
+		t.Fatalf("Failed to create terminal file: %v", err)
+	}
+	defer term.Close()
+	t.Setenv("COLUMNS", "80")
+	t.Setenv("LINES", "20")
+
+	d := New(ModeTUI, term, "run")
+	logPath := dir + "/logs/manager.log"
+	if err := d.Start(logPath); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	os.Stdout.WriteString("Running rewriter...\n")
+	os.Stderr.WriteString("Warning: slow provider\n")
+	d.Stop()
+
+	log, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	view, err := os.ReadFile(term.Name())
+	if err != nil {
+		t.Fatalf("Failed to read terminal file: %v", err)
+	}
+	for _, want := range []string{"Running rewriter...", "Warning: slow provider"} {
+		if !strings.Contains(string(log), want) || !strings.Contains(string(view), want) {
+			t.Errorf("Expected %q in the log and the view:\nlog: %s\nview: %q", want, log, view)
+		}
+	}
+	if !strings.Contains(string(view), "Full output in "+logPath) {
+		t.Errorf("Expected the log path after the final view, got %q", view)
+	}
+}
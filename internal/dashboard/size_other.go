@@ -0,0 +1,24 @@
+//go:build !windows
+
+package dashboard
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// terminalSize returns the columns and rows of the terminal f is attached to
+func terminalSize(f *os.File) (int, int, bool) {
+	var ws struct{ Row, Col, Xpixel, Ypixel uint16 }
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 || ws.Col == 0 || ws.Row == 0 {
+		return 0, 0, false
+	}
+	return int(ws.Col), int(ws.Row), true
+}
+
+// supportsANSI reports whether a terminal understands the escapes that redraw the view
+func supportsANSI() bool {
+	return os.Getenv("TERM") != "dumb"
+}
@@ -0,0 +1,14 @@
+package dashboard
+
+import "os"
+
+// terminalSize is not queried on Windows; COLUMNS and LINES or the defaults apply
+func terminalSize(f *os.File) (int, int, bool) {
+	return 0, 0, false
+}
+
+// supportsANSI reports whether the console understands the escapes that redraw
+// the view. Windows Terminal does; the legacy console does not by default.
+func supportsANSI() bool {
+	return os.Getenv("WT_SESSION") != ""
+}
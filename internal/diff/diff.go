@@ -0,0 +1,440 @@
+// Package diff compares original and rewritten Go source line by line and
+// classifies every change: identifiers renamed, dead code inserted and
+// control flow restructured. Renames are found by aligning the tokens of each
+// function in both versions, so a line that differs only by renamed
+// identifiers is reported as renamed rather than deleted and inserted.
+package diff
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Hekzory/MetamorphLLM/internal/metrics"
+)
+
+// Kind classifies a line of a diff
+type Kind string
+
+const (
+	Same     Kind = "same"     // Unchanged
+	Renamed  Kind = "renamed"  // Unchanged apart from renamed identifiers
+	Deleted  Kind = "deleted"  // Only in the original
+	Inserted Kind = "inserted" // Only in the rewritten code
+	DeadCode Kind = "dead"     // Inserted and never executed
+	Control  Kind = "control"  // A control flow statement only in one version
+)
+
+// Line is one line of a diff
+type Line struct {
+	Kind Kind
+	// Line numbers in both versions, starting at 1; 0 where the line is absent
+	Original, Rewritten int
+	// Text of the line in both versions; empty where the line is absent
+	OriginalText, RewrittenText string
+	// Function holds the line, e.g. T.Method, or is empty outside functions
+	Function string
+}
+
+// Diff is the classified line diff of two versions of a file
+type Diff struct {
+	Lines []Line
+	// Renames maps each function to the identifiers renamed in it
+	Renames map[string]map[string]string
+}
+
+// Compare diffs original and rewritten Go source
+func Compare(original, rewritten string) (*Diff, error) {
+	before, err := parse(original)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse original code: %w", err)
+	}
+	after, err := parse(rewritten)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rewritten code: %w", err)
+	}
+
+	d := &Diff{Renames: make(map[string]map[string]string)}
+	for name, fn := range before.funcs {
+		if other, ok := after.funcs[name]; ok {
+			if renames := findRenames(fn.tokens, other.tokens); len(renames) > 0 {
+				d.Renames[name] = renames
+			}
+		}
+	}
+	dead := after.deadLines()
+
+	// Lines are equal if the original with the renames of its function
+	// applied reads like the rewritten line. Comments count, whitespace
+	// does not.
+	a, b := lineTokens(before), lineTokens(after)
+	equal := func(i, j int) bool {
+		renames := d.Renames[before.lineFuncs[i]]
+		if len(a[i]) != len(b[j]) {
+			return false
+		}
+		for k, t := range a[i] {
+			if t.tok == token.IDENT && renames[t.lit] != "" {
+				t.lit = renames[t.lit]
+			}
+			if t != b[j][k] {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, op := range align(len(a), len(b), equal) {
+		line := Line{Original: op.a + 1, Rewritten: op.b + 1}
+		switch {
+		case op.a < 0:
+			line.Original = 0
+			line.RewrittenText, line.Function = after.lines[op.b], after.lineFuncs[op.b]
+			line.Kind = Inserted
+			if isControl(b[op.b]) {
+				line.Kind = Control
+			}
+			if dead[op.b+1] {
+				line.Kind = DeadCode
+			}
+		case op.b < 0:
+			line.Rewritten = 0
+			line.OriginalText, line.Function = before.lines[op.a], before.lineFuncs[op.a]
+			line.Kind = Deleted
+			if isControl(a[op.a]) {
+				line.Kind = Control
+			}
+		default:
+			line.OriginalText, line.RewrittenText = before.lines[op.a], after.lines[op.b]
+			line.Function = after.lineFuncs[op.b]
+			line.Kind = Same
+			if !slices.Equal(a[op.a], b[op.b]) {
+				line.Kind = Renamed
+			}
+		}
+		d.Lines = append(d.Lines, line)
+	}
+	return d, nil
+}
+
+// Count returns how many lines of the diff are of kind k
+func (d *Diff) Count(k Kind) int {
+	n := 0
+	for _, line := range d.Lines {
+		if line.Kind == k {
+			n++
+		}
+	}
+	return n
+}
+
+// tok is a token of Go source
+type tok struct {
+	tok token.Token
+	lit string
+}
+
+// source is a parsed version of a file
+type source struct {
+	fset      *token.FileSet
+	file      *ast.File
+	lines     []string
+	lineFuncs []string // The function each line belongs to, by 0-based line
+	funcs     map[string]*function
+}
+
+// function holds the tokens of a function, for finding renames
+type function struct {
+	tokens []tok
+}
+
+// parse parses src and splits it into lines and functions
+func parse(src string) (*source, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	s := &source{
+		fset:  fset,
+		file:  f,
+		lines: strings.Split(strings.TrimSuffix(src, "\n"), "\n"),
+		funcs: make(map[string]*function),
+	}
+	s.lineFuncs = make([]string, len(s.lines))
+	for _, decl := range f.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		name := metrics.FunctionName(fd)
+		if _, ok := s.funcs[name]; ok {
+			continue // init functions may repeat; only the first is compared
+		}
+		start, end := fset.Position(fd.Pos()), fset.Position(fd.End())
+		s.funcs[name] = &function{tokens: scan(src[start.Offset:end.Offset], 0)}
+		for line := start.Line; line <= end.Line; line++ {
+			s.lineFuncs[line-1] = name
+		}
+	}
+	return s, nil
+}
+
+// scan returns the tokens of src, leaving out the semicolons inserted at line
+// ends, and comments unless mode includes scanner.ScanComments
+func scan(src string, mode scanner.Mode) []tok {
+	fset := token.NewFileSet()
+	var s scanner.Scanner
+	s.Init(fset.AddFile("", fset.Base(), len(src)), []byte(src), nil, mode)
+	var tokens []tok
+	for {
+		_, t, lit := s.Scan()
+		if t == token.EOF {
+			return tokens
+		}
+		if t == token.SEMICOLON && lit == "\n" {
+			continue
+		}
+		if !t.IsLiteral() && t != token.COMMENT {
+			lit = ""
+		}
+		tokens = append(tokens, tok{t, lit})
+	}
+}
+
+// lineTokens returns the tokens of every line of s
+func lineTokens(s *source) [][]tok {
+	tokens := make([][]tok, len(s.lines))
+	for i, line := range s.lines {
+		tokens[i] = scan(line, scanner.ScanComments)
+	}
+	return tokens
+}
+
+// findRenames aligns the tokens of two versions of a function, treating all
+// identifiers as equal, and maps every identifier to the name it is aligned
+// with most often. Only names that are gone from the rewritten function count
+// as renamed, and only to names the original function did not use.
+func findRenames(a, b []tok) map[string]string {
+	names := func(tokens []tok) map[string]bool {
+		set := make(map[string]bool)
+		for _, t := range tokens {
+			if t.tok == token.IDENT {
+				set[t.lit] = true
+			}
+		}
+		return set
+	}
+	before, after := names(a), names(b)
+
+	equal := func(i, j int) bool {
+		if a[i].tok == token.IDENT && b[j].tok == token.IDENT {
+			return true
+		}
+		return a[i] == b[j]
+	}
+	votes := make(map[string]map[string]int)
+	for _, op := range align(len(a), len(b), equal) {
+		if op.a < 0 || op.b < 0 || a[op.a].tok != token.IDENT {
+			continue
+		}
+		from, to := a[op.a].lit, b[op.b].lit
+		if votes[from] == nil {
+			votes[from] = make(map[string]int)
+		}
+		votes[from][to]++
+	}
+	// When several names were renamed to the same one, the most frequent wins
+	renames := make(map[string]string)
+	counts := make(map[string]int)
+	for _, from := range slices.Sorted(maps.Keys(votes)) {
+		candidates := votes[from]
+		best := from
+		for _, to := range slices.Sorted(maps.Keys(candidates)) {
+			if candidates[to] > candidates[best] {
+				best = to
+			}
+		}
+		if after[from] || before[best] || predeclared(from) || predeclared(best) || candidates[best] <= counts[best] {
+			continue
+		}
+		for other, to := range renames {
+			if to == best {
+				delete(renames, other)
+			}
+		}
+		renames[from], counts[best] = best, candidates[best]
+	}
+	return renames
+}
+
+// predeclared reports whether name is the blank identifier or predeclared,
+// e.g. false or int, and so cannot be renamed
+func predeclared(name string) bool {
+	return name == "_" || types.Universe.Lookup(name) != nil
+}
+
+// op is a step of an alignment: a pair of equal elements, or an element of
+// only one sequence with -1 for the other
+type op struct{ a, b int }
+
+// align returns a longest common subsequence alignment of two sequences of
+// lengths n and m, with deletions before insertions in every changed run
+func align(n, m int, equal func(i, j int) bool) []op {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if equal(i, j) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []op
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && equal(i, j) && lcs[i][j] == lcs[i+1][j+1]+1:
+			ops = append(ops, op{i, j})
+			i, j = i+1, j+1
+		case i < n && (j == m || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{i, -1})
+			i++
+		default:
+			ops = append(ops, op{-1, j})
+			j++
+		}
+	}
+	return ops
+}
+
+// controlKeywords start lines that direct control flow
+var controlKeywords = map[token.Token]bool{
+	token.IF: true, token.ELSE: true, token.FOR: true, token.SWITCH: true,
+	token.SELECT: true, token.CASE: true, token.DEFAULT: true, token.GOTO: true,
+	token.BREAK: true, token.CONTINUE: true, token.FALLTHROUGH: true,
+}
+
+// isControl reports whether a line starts a control flow statement or a
+// label, ignoring a leading closing brace as in "} else {"
+func isControl(line []tok) bool {
+	if len(line) > 0 && line[0].tok == token.RBRACE {
+		line = line[1:]
+	}
+	if len(line) == 0 {
+		return false
+	}
+	if len(line) >= 2 && line[0].tok == token.IDENT && line[1].tok == token.COLON {
+		return true
+	}
+	return controlKeywords[line[0].tok]
+}
+
+// deadLines returns the lines, starting at 1, of code that never runs: the
+// branches of if and for statements whose condition is a constant that rules
+// them out, and statements after a return, goto, break, continue or panic
+// that no label makes reachable
+func (s *source) deadLines() map[int]bool {
+	dead := make(map[int]bool)
+	mark := func(n ast.Node) {
+		if n == nil {
+			return
+		}
+		for line := s.fset.Position(n.Pos()).Line; line <= s.fset.Position(n.End()).Line; line++ {
+			dead[line] = true
+		}
+	}
+	// Only the statements of a block are dead, not the line that opens it
+	markBranch := func(n ast.Stmt) {
+		if block, ok := n.(*ast.BlockStmt); ok {
+			for _, stmt := range block.List {
+				mark(stmt)
+			}
+			return
+		}
+		mark(n)
+	}
+	unreachable := func(list []ast.Stmt) {
+		for i, stmt := range list {
+			if !terminates(stmt) {
+				continue
+			}
+			for _, next := range list[i+1:] {
+				if _, ok := next.(*ast.LabeledStmt); ok {
+					break
+				}
+				mark(next)
+			}
+			return
+		}
+	}
+
+	ast.Inspect(s.file, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.IfStmt:
+			if value, ok := constantBool(s.fset, node.Cond); ok {
+				if value {
+					markBranch(node.Else)
+				} else {
+					markBranch(node.Body)
+				}
+			}
+		case *ast.ForStmt:
+			if value, ok := constantBool(s.fset, node.Cond); ok && !value {
+				markBranch(node.Body)
+			}
+		case *ast.BlockStmt:
+			unreachable(node.List)
+		case *ast.CaseClause:
+			unreachable(node.Body)
+		case *ast.CommClause:
+			unreachable(node.Body)
+		}
+		return true
+	})
+	return dead
+}
+
+// terminates reports whether control never continues past stmt
+func terminates(stmt ast.Stmt) bool {
+	switch s := stmt.(type) {
+	case *ast.ReturnStmt:
+		return true
+	case *ast.BranchStmt:
+		return s.Tok != token.FALLTHROUGH
+	case *ast.ExprStmt:
+		call, ok := s.X.(*ast.CallExpr)
+		if !ok {
+			return false
+		}
+		id, ok := call.Fun.(*ast.Ident)
+		return ok && id.Name == "panic"
+	}
+	return false
+}
+
+// constantBool evaluates a condition that involves only constants, e.g.
+// false or 1 > 2
+func constantBool(fset *token.FileSet, cond ast.Expr) (bool, bool) {
+	if cond == nil {
+		return false, false
+	}
+	tv, err := types.Eval(fset, nil, token.NoPos, types.ExprString(cond))
+	if err != nil || tv.Value == nil || tv.Value.Kind() != constant.Bool {
+		return false, false
+	}
+	return constant.BoolVal(tv.Value), true
+}
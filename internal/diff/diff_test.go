@@ -0,0 +1,151 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const original = `package p
+
+func sum(items []int) int {
+	total := 0
+	for _, item := range items {
+		total += item
+	}
+	return total
+}
+`
+
+const rewritten = `package p
+
+func sum(items []int) int {
+	acc := 0
+	if false {
+		acc = -1
+	}
+	for i := 0; i < len(items); i++ {
+		acc += items[i]
+	}
+	return acc
+	panic("unreachable")
+}
+`
+
+// kinds returns the kind of every line, keyed by its text in the version that has it
+func kinds(d *Diff) map[string]Kind {
+	result := make(map[string]Kind)
+	for _, line := range d.Lines {
+		text := line.RewrittenText
+		if line.Rewritten == 0 {
+			text = line.OriginalText
+		}
+		result[strings.TrimSpace(text)] = line.Kind
+	}
+	return result
+}
+
+// TestCompare tests that renames, dead code and control flow are told apart
+func TestCompare(t *testing.T) {
+	d, err := Compare(original, rewritten)
+	if err != nil {
+		t.Fatalf("Compare failed: %v", err)
+	}
+
+	if renames := d.Renames["sum"]; len(renames) != 1 || renames["total"] != "acc" {
+		t.Errorf("Expected total to be renamed to acc, got %v", d.Renames)
+	}
+	want := map[string]Kind{
+		"func sum(items []int) int {":       Same,
+		"acc := 0":                          Renamed,
+		"return acc":                        Renamed,
+		"if false {":                        Control,
+		"acc = -1":                          DeadCode,
+		`panic("unreachable")`:              DeadCode,
+		"for i := 0; i < len(items); i++ {": Control,
+		"for _, item := range items {":      Control,
+		"acc += items[i]":                   Inserted,
+		"total += item":                     Deleted,
+	}
+	got := kinds(d)
+	for text, kind := range want {
+		if got[text] != kind {
+			t.Errorf("Expected %q to be %s, got %s", text, kind, got[text])
+		}
+	}
+	for _, line := range d.Lines {
+		if line.Kind == Deleted && (line.Original == 0 || line.Rewritten != 0 || line.Function != "sum") {
+			t.Errorf("Unexpected deleted line %+v", line)
+		}
+	}
+
+	if _, err := Compare(original, "package"); err == nil || !strings.Contains(err.Error(), "rewritten") {
+		t.Errorf("Expected a parse error for the rewritten code, got %v", err)
+	}
+}
+
+// TestWrite tests the output formats and the context around changes
+func TestWrite(t *testing.T) {
+	d, err := Compare(original, rewritten)
+	if err != nil {
+		t.Fatalf("Compare failed: %v", err)
+	}
+	opts := Options{OriginalName: "a.go", RewrittenName: "b.go", Context: 0}
+
+	var text bytes.Buffer
+	if err := d.Write(&text, FormatText, opts); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	for _, want := range []string{"--- a.go\n+++ b.go\n", "renamed in sum: total -> acc\n", "@@ -4,3 +4,3 @@ sum\n", "@@ -8,1 +8,5 @@ sum\n", "~  \tacc := 0\n", "+d \t\tacc = -1\n", "-c \tfor _, item", "+c \tif false {\n"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("Expected %q in the text diff:\n%s", want, text.String())
+		}
+	}
+	if strings.Contains(text.String(), "package p") {
+		t.Errorf("Expected no unchanged lines without context:\n%s", text.String())
+	}
+
+	var side bytes.Buffer
+	opts.Context, opts.Width = -1, 20
+	if err := d.Write(&side, FormatSideBySide, opts); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if !strings.Contains(side.String(), "package p            ") || !strings.Contains(side.String(), "    total := 0       ~     acc := 0\n") {
+		t.Errorf("Unexpected side-by-side diff:\n%s", side.String())
+	}
+
+	var page bytes.Buffer
+	if err := d.Write(&page, FormatHTML, opts); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	for _, want := range []string{"<!DOCTYPE html>", `<mark title="was total">acc</mark>`, `<td class="dead">`, "i &lt; len(items)"} {
+		if !strings.Contains(page.String(), want) {
+			t.Errorf("Expected %q in the HTML diff", want)
+		}
+	}
+
+	// With the whole file as context, the patch holds both versions
+	var patch bytes.Buffer
+	if err := d.Write(&patch, FormatPatch, opts); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	var before, after strings.Builder
+	for _, line := range strings.SplitAfter(patch.String(), "\n")[3:] {
+		switch {
+		case strings.HasPrefix(line, " "):
+			before.WriteString(line[1:])
+			after.WriteString(line[1:])
+		case strings.HasPrefix(line, "-"):
+			before.WriteString(line[1:])
+		case strings.HasPrefix(line, "+"):
+			after.WriteString(line[1:])
+		}
+	}
+	if !strings.HasPrefix(patch.String(), "--- a.go\n+++ b.go\n@@ -1,9 +1,13 @@\n") || before.String() != original || after.String() != rewritten {
+		t.Errorf("Unexpected patch:\n%s", patch.String())
+	}
+
+	if err := d.Write(&page, "pdf", opts); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
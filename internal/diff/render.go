@@ -0,0 +1,361 @@
+package diff
+
+import (
+	"bufio"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"html"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Format is an output format of a diff
+type Format string
+
+const (
+	FormatText       Format = "text"         // Unified diff with a tag per line
+	FormatSideBySide Format = "side-by-side" // Both versions in columns
+	FormatHTML       Format = "html"         // Standalone page with both versions
+	FormatPatch      Format = "patch"        // Plain unified diff for patch and git apply
+)
+
+// Formats lists the supported output formats
+var Formats = []Format{FormatText, FormatSideBySide, FormatHTML, FormatPatch}
+
+// Options control how a diff is written
+type Options struct {
+	OriginalName  string // Shown in headers
+	RewrittenName string
+	Context       int // Unchanged lines around changes; negative for the whole file
+	Width         int // Width of each column of the side-by-side view
+}
+
+// Write writes the diff in the given format
+func (d *Diff) Write(w io.Writer, format Format, opts Options) error {
+	bw := bufio.NewWriter(w)
+	switch format {
+	case FormatText:
+		d.writeText(bw, opts)
+	case FormatSideBySide:
+		d.writeSideBySide(bw, opts)
+	case FormatHTML:
+		d.writeHTML(bw, opts)
+	case FormatPatch:
+		d.writePatch(bw, opts)
+	default:
+		return fmt.Errorf("unknown diff format %q (expected one of %v)", format, Formats)
+	}
+	return bw.Flush()
+}
+
+// prefixes mark the lines of the text format: whether the line was kept,
+// renamed, deleted or inserted, and whether it is dead code or control flow
+var prefixes = map[Kind]string{
+	Same:     "  ",
+	Renamed:  "~ ",
+	Deleted:  "- ",
+	Inserted: "+ ",
+	DeadCode: "+d",
+}
+
+// prefix returns the marker of a line in the text format
+func prefix(line Line) string {
+	if line.Kind == Control {
+		if line.Rewritten == 0 {
+			return "-c"
+		}
+		return "+c"
+	}
+	return prefixes[line.Kind]
+}
+
+// writeText writes a unified diff. Renamed lines show the rewritten text; the
+// renames of every function are listed before the hunks.
+func (d *Diff) writeText(w io.Writer, opts Options) {
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", opts.OriginalName, opts.RewrittenName)
+	for _, name := range slices.Sorted(maps.Keys(d.Renames)) {
+		fmt.Fprintf(w, "renamed in %s: %s\n", name, renameList(d.Renames[name]))
+	}
+	for _, hunk := range hunks(d.Lines, opts.Context) {
+		header := fmt.Sprintf("@@ -%s +%s @@", hunkRange(hunk, false), hunkRange(hunk, true))
+		if hunk[0].Function != "" {
+			header += " " + hunk[0].Function
+		}
+		fmt.Fprintln(w, header)
+		for _, line := range hunk {
+			text := line.RewrittenText
+			if line.Rewritten == 0 {
+				text = line.OriginalText
+			}
+			fmt.Fprintf(w, "%s %s\n", prefix(line), text)
+		}
+	}
+}
+
+// writePatch writes a unified diff without tags, which patch and git apply
+// accept. Renamed lines are deleted and inserted, and in every run of changes
+// the deletions come first.
+func (d *Diff) writePatch(w io.Writer, opts Options) {
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", opts.OriginalName, opts.RewrittenName)
+	for _, hunk := range hunks(d.Lines, opts.Context) {
+		fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(hunk, false), hunkRange(hunk, true))
+		var inserted []string
+		flush := func() {
+			for _, text := range inserted {
+				fmt.Fprintf(w, "+%s\n", text)
+			}
+			inserted = inserted[:0]
+		}
+		for _, line := range hunk {
+			if line.Kind == Same {
+				flush()
+				fmt.Fprintf(w, " %s\n", line.OriginalText)
+				continue
+			}
+			if line.Original != 0 {
+				fmt.Fprintf(w, "-%s\n", line.OriginalText)
+			}
+			if line.Rewritten != 0 {
+				inserted = append(inserted, line.RewrittenText)
+			}
+		}
+		flush()
+	}
+}
+
+// writeSideBySide writes both versions in columns, with a marker between them
+func (d *Diff) writeSideBySide(w io.Writer, opts Options) {
+	width := opts.Width
+	if width <= 0 {
+		width = 60
+	}
+	fmt.Fprintf(w, "%s   %s\n", column(opts.OriginalName, width), opts.RewrittenName)
+	for i, hunk := range hunks(d.Lines, opts.Context) {
+		if i > 0 {
+			fmt.Fprintf(w, "%s   %s\n", column("...", width), "...")
+		}
+		for _, r := range rows(hunk) {
+			left, right := "", ""
+			if r.left != nil {
+				left = r.left.OriginalText
+			}
+			if r.right != nil {
+				right = r.right.RewrittenText
+			}
+			fmt.Fprintf(w, "%s %c %s\n", column(left, width), r.marker(), strings.TrimRight(column(right, width), " "))
+		}
+	}
+}
+
+// column expands tabs and pads or cuts text to width
+func column(text string, width int) string {
+	runes := []rune(strings.ReplaceAll(text, "\t", "    "))
+	if len(runes) > width {
+		return string(runes[:width-1]) + "…"
+	}
+	return string(runes) + strings.Repeat(" ", width-len(runes))
+}
+
+// htmlStyle colors the rows of the HTML view by kind
+const htmlStyle = `body { font-family: sans-serif; }
+table { border-collapse: collapse; font-family: monospace; white-space: pre; }
+td { padding: 0 0.5em; vertical-align: top; }
+td.num { color: #888; text-align: right; }
+td.renamed { background: #fff8c5; }
+td.deleted { background: #ffebe9; }
+td.inserted { background: #dafbe1; }
+td.dead { background: #eeeeee; color: #777; text-decoration: line-through; }
+td.control { background: #ddf4ff; font-weight: bold; }
+td.gap { color: #888; }
+mark { background: #f9c513; }`
+
+// writeHTML writes a standalone page with both versions side by side.
+// Renamed identifiers are highlighted with their original name as title.
+func (d *Diff) writeHTML(w io.Writer, opts Options) {
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n",
+		html.EscapeString(opts.RewrittenName), htmlStyle)
+	fmt.Fprintf(w, "<h1>%s &rarr; %s</h1>\n", html.EscapeString(opts.OriginalName), html.EscapeString(opts.RewrittenName))
+	fmt.Fprintf(w, "<p>%d renamed, %d inserted, %d dead, %d control flow, %d deleted lines</p>\n",
+		d.Count(Renamed), d.Count(Inserted), d.Count(DeadCode), d.Count(Control), d.Count(Deleted))
+	if len(d.Renames) > 0 {
+		fmt.Fprintln(w, "<ul>")
+		for _, name := range slices.Sorted(maps.Keys(d.Renames)) {
+			fmt.Fprintf(w, "<li>%s: %s</li>\n", html.EscapeString(name), html.EscapeString(renameList(d.Renames[name])))
+		}
+		fmt.Fprintln(w, "</ul>")
+	}
+
+	fmt.Fprintln(w, "<table>")
+	for i, hunk := range hunks(d.Lines, opts.Context) {
+		if i > 0 {
+			fmt.Fprintln(w, `<tr><td></td><td class="gap">&hellip;</td><td></td><td class="gap">&hellip;</td></tr>`)
+		}
+		for _, r := range rows(hunk) {
+			var oldKind, newKind Kind
+			oldNum, oldText, newNum, newText := "", "", "", ""
+			if r.left != nil {
+				oldKind = r.left.Kind
+				oldNum, oldText = fmt.Sprint(r.left.Original), html.EscapeString(r.left.OriginalText)
+			}
+			if r.right != nil {
+				newKind = r.right.Kind
+				newNum, newText = fmt.Sprint(r.right.Rewritten), html.EscapeString(r.right.RewrittenText)
+				if newKind == Renamed {
+					newText = markRenames(r.right.RewrittenText, d.Renames[r.right.Function])
+				}
+			}
+			fmt.Fprintf(w, "<tr><td class=\"num\">%s</td><td class=\"%s\">%s</td><td class=\"num\">%s</td><td class=\"%s\">%s</td></tr>\n",
+				oldNum, oldKind, oldText, newNum, newKind, newText)
+		}
+	}
+	fmt.Fprintln(w, "</table>\n</body>\n</html>")
+}
+
+// markRenames escapes a line for HTML, wrapping the identifiers that renames
+// introduced in <mark> elements titled with the original name
+func markRenames(text string, renames map[string]string) string {
+	original := make(map[string]string, len(renames))
+	for from, to := range renames {
+		original[to] = from
+	}
+	fset := token.NewFileSet()
+	var s scanner.Scanner
+	s.Init(fset.AddFile("", fset.Base(), len(text)), []byte(text), nil, scanner.ScanComments)
+
+	var sb strings.Builder
+	last := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		from, ok := original[lit]
+		if tok != token.IDENT || !ok {
+			continue
+		}
+		offset := fset.Position(pos).Offset
+		sb.WriteString(html.EscapeString(text[last:offset]))
+		fmt.Fprintf(&sb, `<mark title="was %s">%s</mark>`, html.EscapeString(from), html.EscapeString(lit))
+		last = offset + len(lit)
+	}
+	sb.WriteString(html.EscapeString(text[last:]))
+	return sb.String()
+}
+
+// hunks splits lines into runs of changes with up to context unchanged lines
+// around them; a negative context keeps every line in one hunk
+func hunks(lines []Line, context int) [][]Line {
+	if context < 0 && len(lines) > 0 {
+		return [][]Line{lines}
+	}
+	var result [][]Line
+	start, end := -1, -1
+	for i, line := range lines {
+		if line.Kind == Same {
+			continue
+		}
+		from, to := max(i-context, 0), min(i+context+1, len(lines))
+		if start >= 0 && from > end {
+			result = append(result, lines[start:end])
+			start = -1
+		}
+		if start < 0 {
+			start = from
+		}
+		end = to
+	}
+	if start >= 0 {
+		result = append(result, lines[start:end])
+	}
+	return result
+}
+
+// hunkRange formats where a hunk starts in one version and how many lines of
+// it the version has, as "line,count"
+func hunkRange(hunk []Line, rewritten bool) string {
+	first, count := 0, 0
+	for _, line := range hunk {
+		n := line.Original
+		if rewritten {
+			n = line.Rewritten
+		}
+		if n == 0 {
+			continue
+		}
+		if count == 0 {
+			first = n
+		}
+		count++
+	}
+	return fmt.Sprintf("%d,%d", first, count)
+}
+
+// row is a line of a side-by-side view. In a run of changes, deleted and
+// inserted lines share rows.
+type row struct {
+	left, right *Line
+}
+
+// marker shows the kind of a row between the columns
+func (r row) marker() rune {
+	switch {
+	case r.left == nil && r.right.Kind == DeadCode:
+		return 'd'
+	case r.left == nil && r.right.Kind == Control, r.right == nil && r.left.Kind == Control:
+		return 'c'
+	case r.left == nil:
+		return '>'
+	case r.right == nil:
+		return '<'
+	case r.left != r.right:
+		return '|'
+	case r.left.Kind == Renamed:
+		return '~'
+	}
+	return ' '
+}
+
+// rows pairs the lines of a hunk for a side-by-side view
+func rows(hunk []Line) []row {
+	var result []row
+	var deleted, inserted []*Line
+	flush := func() {
+		for i := 0; i < max(len(deleted), len(inserted)); i++ {
+			var r row
+			if i < len(deleted) {
+				r.left = deleted[i]
+			}
+			if i < len(inserted) {
+				r.right = inserted[i]
+			}
+			result = append(result, r)
+		}
+		deleted, inserted = nil, nil
+	}
+	for i := range hunk {
+		line := &hunk[i]
+		switch {
+		case line.Original == 0:
+			inserted = append(inserted, line)
+		case line.Rewritten == 0:
+			deleted = append(deleted, line)
+		default:
+			flush()
+			result = append(result, row{line, line})
+		}
+	}
+	flush()
+	return result
+}
+
+// renameList formats renames as "a -> b, c -> d", sorted by original name
+func renameList(renames map[string]string) string {
+	var parts []string
+	for _, from := range slices.Sorted(maps.Keys(renames)) {
+		parts = append(parts, from+" -> "+renames[from])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,244 @@
+// Package difftest generates differential tests for a rewrite: Go tests that
+// call the original and the rewritten implementation of a function with the
+// same table of inputs and fail when their results differ, so that go test
+// itself shows the rewrite preserved behavior.
+//
+// The original and the rewritten file declare the same functions and are
+// told apart by a build tag. The generator therefore copies the original's
+// functions, renamed with OriginalPrefix, into a test file built with the
+// tag, next to the tests calling both versions.
+package difftest
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// OriginalPrefix is prepended to the names of the original's functions in
+// the copy the tests call
+const OriginalPrefix = "original_"
+
+// MaxCases is the most inputs a function is tested with
+const MaxCases = 32
+
+// header marks the files as generated
+const header = "// Code generated by metamorph difftest. DO NOT EDIT.\n\n"
+
+// impure are the packages whose functions depend on the environment or
+// change it. Functions that call them, directly or through other functions
+// of the file, would not return the same results twice and are not tested.
+var impure = map[string]bool{
+	"crypto/rand":  true,
+	"math/rand":    true,
+	"math/rand/v2": true,
+	"net":          true,
+	"net/http":     true,
+	"os":           true,
+	"os/exec":      true,
+	"os/signal":    true,
+	"syscall":      true,
+	"time":         true,
+}
+
+// values are the inputs tried for each supported parameter type. They are
+// small, so functions that loop over a parameter finish quickly.
+var values = map[string][]string{
+	"bool":     {"false", "true"},
+	"string":   {`""`, `"a"`, `"hello world"`, `"Hello, 世界"`, `"123"`, `"  padded  "`},
+	"int":      {"0", "1", "-1", "2", "7", "100", "-100"},
+	"int8":     {"0", "1", "-1", "2", "7", "100", "-100"},
+	"int16":    {"0", "1", "-1", "2", "7", "100", "-100"},
+	"int32":    {"0", "1", "-1", "2", "7", "100", "-100"},
+	"int64":    {"0", "1", "-1", "2", "7", "100", "-100"},
+	"rune":     {"0", "'a'", "'Z'", "'0'", "' '", "'世'"},
+	"uint":     {"0", "1", "2", "7", "100", "255"},
+	"uint8":    {"0", "1", "2", "7", "100", "255"},
+	"byte":     {"0", "'a'", "'Z'", "'0'", "' '", "255"},
+	"uint16":   {"0", "1", "2", "7", "100", "255"},
+	"uint32":   {"0", "1", "2", "7", "100", "255"},
+	"uint64":   {"0", "1", "2", "7", "100", "255"},
+	"float32":  {"0", "1", "-1", "0.5", "-2.25", "100"},
+	"float64":  {"0", "1", "-1", "0.5", "-2.25", "100"},
+	"[]byte":   {"nil", "[]byte{}", `[]byte("abc")`, "[]byte{0, 255, 10}"},
+	"[]string": {"nil", "[]string{}", `[]string{"a"}`, `[]string{"b", "a", ""}`},
+	"[]int":    {"nil", "[]int{}", "[]int{1}", "[]int{3, -1, 2, 0}"},
+	"[]int64":  {"nil", "[]int64{}", "[]int64{1}", "[]int64{3, -1, 2, 0}"},
+}
+
+// Files are the generated test files of a source file
+type Files struct {
+	Original  []byte            // The original's functions, renamed, to be written to OriginalPath
+	Test      []byte            // The differential tests, to be written to TestPath; nil if no function can be tested
+	Functions []string          // Functions with a differential test
+	Skipped   map[string]string // Why the other requested functions have none
+}
+
+// OriginalPath returns where the renamed copy of the original source is written
+func OriginalPath(source string) string {
+	return strings.TrimSuffix(source, ".go") + "_original_test.go"
+}
+
+// TestPath returns where the differential tests of source are written
+func TestPath(source string) string {
+	return strings.TrimSuffix(source, ".go") + "_differential_test.go"
+}
+
+// Generate returns differential tests of the named functions of the original
+// source, or of all of them if functions is nil, constrained to tag (no
+// constraint if empty). Only functions without a receiver or type
+// parameters, with parameters of basic types and with results are tested;
+// the others are listed in Skipped.
+func Generate(filename string, src []byte, functions []string, tag string) (*Files, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+	g := &generator{fset: fset, funcs: make(map[string]*ast.FuncDecl), imports: make(map[string]string)}
+	for _, spec := range file.Imports {
+		p, _ := strconv.Unquote(spec.Path.Value)
+		g.imports[importName(spec)] = p
+	}
+	for _, decl := range file.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv == nil && fd.Body != nil {
+			g.funcs[fd.Name.Name] = fd
+		}
+	}
+
+	constraint := ""
+	if tag != "" {
+		constraint = "//go:build " + tag + "\n// +build " + tag + "\n\n"
+	}
+	files := &Files{Skipped: make(map[string]string)}
+	if files.Original, err = original(header+constraint, filename, src); err != nil {
+		return nil, err
+	}
+
+	var tests bytes.Buffer
+	for _, name := range slices.Sorted(maps.Keys(g.funcs)) {
+		if functions != nil && !slices.Contains(functions, name) {
+			continue
+		}
+		if name == "init" || name == "main" {
+			continue
+		}
+		test, reason := g.test(g.funcs[name])
+		if reason != "" {
+			files.Skipped[name] = reason
+			continue
+		}
+		tests.WriteString(test)
+		files.Functions = append(files.Functions, name)
+	}
+	for _, name := range functions {
+		if _, ok := g.funcs[name]; !ok {
+			if _, ok := files.Skipped[name]; !ok {
+				files.Skipped[name] = "not a function without receiver of the source"
+			}
+		}
+	}
+	if len(files.Functions) == 0 {
+		return files, nil
+	}
+
+	test := header + constraint + "package " + file.Name.Name + "\n\n" +
+		"import (\n\t\"fmt\"\n\t\"reflect\"\n\t\"testing\"\n)\n\n" + tests.String() + helpers
+	if files.Test, err = format.Source([]byte(test)); err != nil {
+		return nil, fmt.Errorf("failed to format differential tests: %w", err)
+	}
+	return files, nil
+}
+
+type generator struct {
+	fset    *token.FileSet
+	funcs   map[string]*ast.FuncDecl // Functions without a receiver by name
+	imports map[string]string        // Import paths by the name the file uses
+}
+
+// importName returns the name a file refers to an import by
+func importName(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+	p, _ := strconv.Unquote(spec.Path.Value)
+	name := path.Base(p)
+	// math/rand/v2 is rand, gopkg.in/yaml.v3 is yaml
+	if len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+		name = path.Base(path.Dir(p))
+	}
+	name, _, _ = strings.Cut(name, ".")
+	return strings.TrimPrefix(name, "go-")
+}
+
+// original returns the file's functions, renamed with OriginalPrefix, with
+// calls between them renamed too. Types, variables and constants are shared
+// with the rewritten file and not copied.
+func original(header, filename string, src []byte) ([]byte, error) {
+	// A tree of its own, since the functions are renamed in place
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+	funcs := make(map[*ast.Object]bool)
+	var decls []ast.Decl
+	for _, decl := range file.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv == nil && fd.Body != nil {
+			funcs[fd.Name.Obj] = true
+			decls = append(decls, fd)
+		}
+	}
+	// Identifiers that resolve to nothing in the file are the package names
+	// of imports, among others
+	used := make(map[string]bool)
+	for _, decl := range decls {
+		ast.Inspect(decl, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok {
+				if id.Obj == nil {
+					used[id.Name] = true
+				} else if funcs[id.Obj] {
+					id.Name = OriginalPrefix + id.Name
+				}
+			}
+			return true
+		})
+	}
+
+	var out bytes.Buffer
+	out.WriteString(header + "package " + file.Name.Name + "\n\n")
+	if len(file.Imports) > 0 {
+		out.WriteString("import (\n")
+		for _, spec := range file.Imports {
+			name := importName(spec)
+			// An import only the types or variables use is kept for its side effects
+			if !used[name] && name != "_" && name != "." {
+				name = "_"
+			} else if spec.Name == nil {
+				name = ""
+			}
+			fmt.Fprintf(&out, "\t%s %s\n", name, spec.Path.Value)
+		}
+		out.WriteString(")\n\n")
+	}
+	for _, decl := range decls {
+		if err := printer.Fprint(&out, fset, decl); err != nil {
+			return nil, fmt.Errorf("failed to print %s: %w", decl.(*ast.FuncDecl).Name.Name, err)
+		}
+		out.WriteString("\n\n")
+	}
+	formatted, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format the original's functions: %w", err)
+	}
+	return formatted, nil
+}
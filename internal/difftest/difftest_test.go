@@ -0,0 +1,193 @@
+package difftest
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const originalSource = `//go:build !rewritten
+
+package calc
+
+import (
+	"os"
+	"strings"
+)
+
+// Limit is shared with the rewrite
+const Limit = 10
+
+// Sum adds the values up to Limit
+func Sum(values ...int) int {
+	total := 0
+	for i, v := range values {
+		if i == Limit {
+			break
+		}
+		total += double(v) / 2
+	}
+	return total
+}
+
+func double(n int) int {
+	return n * 2
+}
+
+// Shout upper-cases s n times
+func Shout(s string, n int) (string, error) {
+	if n < 0 {
+		return "", os.ErrInvalid
+	}
+	return strings.Repeat(strings.ToUpper(s), n), nil
+}
+
+// Env reads the environment
+func Env(key string) string {
+	return os.Getenv(key)
+}
+
+func viaEnv(key string) string {
+	return Env(key)
+}
+
+func Print(s string) {
+	println(s)
+}
+
+func Max[T int | float64](a, b T) T {
+	return max(a, b)
+}
+`
+
+// rewrittenSource keeps Sum and Shout equivalent except for Shout on negative
+// counts, which panics instead of failing
+const rewrittenSource = `//go:build rewritten
+
+package calc
+
+import (
+	"os"
+	"strings"
+)
+
+const Limit = 10
+
+func Sum(values ...int) int {
+	total := 0
+	for i := 0; i < len(values) && i < Limit; i++ {
+		total += values[i]
+	}
+	return total
+}
+
+func double(n int) int {
+	return n + n
+}
+
+func Shout(s string, n int) (string, error) {
+	return strings.Repeat(strings.ToUpper(s), n), nil
+}
+
+func Env(key string) string {
+	return os.Getenv(key)
+}
+
+func viaEnv(key string) string {
+	return Env(key)
+}
+
+func Print(s string) {
+	println(s)
+}
+
+func Max[T int | float64](a, b T) T {
+	return max(a, b)
+}
+`
+
+// TestGenerate tests which functions get differential tests
+func TestGenerate(t *testing.T) {
+	files, err := Generate("calc.go", []byte(originalSource), nil, "rewritten")
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if !slices.Equal(files.Functions, []string{"Shout", "Sum", "double"}) {
+		t.Errorf("Expected Shout, Sum and double to be tested, got %v", files.Functions)
+	}
+	for name, reason := range map[string]string{"Env": "uses os", "viaEnv": "uses os", "Print": "no results to compare", "Max": "generic"} {
+		if files.Skipped[name] != reason {
+			t.Errorf("Expected %s to be skipped because of %q, got %q", name, reason, files.Skipped[name])
+		}
+	}
+	for _, want := range []string{"//go:build rewritten", "func original_Sum(values ...int) int", "original_double(v)", "\t\"os\"", "\t\"strings\""} {
+		if !strings.Contains(string(files.Original), want) {
+			t.Errorf("Expected the original's copy to contain %q:\n%s", want, files.Original)
+		}
+	}
+	if strings.Contains(string(files.Original), "Limit = 10") {
+		t.Error("Expected the constant not to be copied")
+	}
+
+	only, err := Generate("calc.go", []byte(originalSource), []string{"Sum", "Env", "Missing"}, "")
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if !slices.Equal(only.Functions, []string{"Sum"}) || only.Skipped["Missing"] == "" || len(only.Skipped) != 2 {
+		t.Errorf("Expected only the requested functions, got %v and %v", only.Functions, only.Skipped)
+	}
+	if strings.Contains(string(only.Test), "go:build") {
+		t.Error("Expected no build constraint without a tag")
+	}
+}
+
+// TestGeneratedTests tests that the generated tests pass for an equivalent
+// rewrite and catch a changed function
+func TestGeneratedTests(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not found")
+	}
+	t.Setenv("GOFLAGS", "")
+	dir := t.TempDir()
+	files, err := Generate("calc.go", []byte(originalSource), nil, "rewritten")
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	for path, content := range map[string]string{
+		"go.mod":                "module example.com/calc\n\ngo 1.24\n",
+		"calc.go":               originalSource,
+		"calc.go.rewritten.go":  rewrittenSource,
+		OriginalPath("calc.go"): string(files.Original),
+		TestPath("calc.go"):     string(files.Test),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, path), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	cmd := exec.Command("go", "test", "-tags", "rewritten", "-v", ".")
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("Expected the changed Shout to fail:\n%s", output)
+	}
+	out := string(output)
+	for _, want := range []string{"--- PASS: TestDifferentialSum", "--- PASS: TestDifferentialDouble", "--- FAIL: TestDifferentialShout"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in the output:\n%s", want, out)
+		}
+	}
+	if !strings.Contains(out, `original returned []interface {}{"", "error: invalid argument"}`) {
+		t.Errorf("Expected the failure to show both results:\n%s", out)
+	}
+
+	// Without the tag the original builds alone and the generated files are left out
+	cmd = exec.Command("go", "vet", ".")
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("Expected the package to build without the tag: %v\n%s", err, output)
+	}
+}
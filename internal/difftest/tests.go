@@ -0,0 +1,188 @@
+package difftest
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"hash/fnv"
+	"math/rand/v2"
+	"strings"
+)
+
+// param is a parameter of a tested function
+type param struct {
+	typ      string // e.g. "[]byte"; the slice type for a variadic parameter
+	variadic bool
+}
+
+// test returns the differential test of fd, or why it has none
+func (g *generator) test(fd *ast.FuncDecl) (string, string) {
+	name := fd.Name.Name
+	if fd.Type.TypeParams != nil {
+		return "", "generic"
+	}
+	if fd.Type.Results.NumFields() == 0 {
+		return "", "no results to compare"
+	}
+	if fd.Type.Params.NumFields() == 0 {
+		return "", "no parameters to vary"
+	}
+	var params []param
+	for _, field := range fd.Type.Params.List {
+		p := param{}
+		typ := field.Type
+		if ellipsis, ok := typ.(*ast.Ellipsis); ok {
+			p.variadic, typ = true, &ast.ArrayType{Elt: ellipsis.Elt}
+		}
+		var buf bytes.Buffer
+		if err := printer.Fprint(&buf, g.fset, typ); err != nil {
+			return "", "unprintable parameter type"
+		}
+		p.typ = buf.String()
+		if _, ok := values[p.typ]; !ok {
+			return "", "unsupported parameter type " + p.typ
+		}
+		for range max(1, len(field.Names)) {
+			params = append(params, p)
+		}
+	}
+	if pkg := g.impure(name, make(map[string]bool)); pkg != "" {
+		return "", "uses " + pkg
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// TestDifferential%s compares %s with the original's on a table of inputs\n", exported(name), name)
+	fmt.Fprintf(&b, "func TestDifferential%s(t *testing.T) {\n\ttype input struct {\n", exported(name))
+	for i, p := range params {
+		fmt.Fprintf(&b, "\t\tp%d %s\n", i, p.typ)
+	}
+	// Built anew for every call, so that a function changing its slices
+	// cannot change the other's inputs
+	b.WriteString("\t}\n\tinputs := func() []input {\n\t\treturn []input{\n")
+	for _, c := range cases(name, params) {
+		fmt.Fprintf(&b, "\t\t\t{%s},\n", strings.Join(c, ", "))
+	}
+	b.WriteString("\t\t}\n\t}\n")
+
+	args := make([]string, len(params))
+	for i, p := range params {
+		args[i] = fmt.Sprintf("in.p%d", i)
+		if p.variadic {
+			args[i] += "..."
+		}
+	}
+	results := make([]string, fd.Type.Results.NumFields())
+	for i := range results {
+		results[i] = fmt.Sprintf("r%d", i)
+	}
+	call := func(fn string) string {
+		return fmt.Sprintf("func() []any {\n\t\t\tin := inputs()[i]\n\t\t\t%s := %s(%s)\n\t\t\treturn []any{%s}\n\t\t}",
+			strings.Join(results, ", "), fn, strings.Join(args, ", "), strings.Join(results, ", "))
+	}
+	b.WriteString("\tfor i, in := range inputs() {\n")
+	fmt.Fprintf(&b, "\t\twant := differentialCall(%s)\n", call(OriginalPrefix+name))
+	fmt.Fprintf(&b, "\t\tgot := differentialCall(%s)\n", call(name))
+	b.WriteString("\t\tif !differentialEqual(got, want) {\n")
+	fmt.Fprintf(&b, "\t\t\tt.Errorf(\"%s(%%+v): rewrite returned %%#v, original returned %%#v\", in, got, want)\n", name)
+	b.WriteString("\t\t}\n\t}\n}\n\n")
+	return b.String(), ""
+}
+
+// exported returns name with an upper-case first letter, for a test name
+func exported(name string) string {
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// cases returns the inputs of a function: every value of every parameter at
+// least once, then random combinations, up to MaxCases and without
+// duplicates. A function always gets the same inputs.
+func cases(name string, params []param) [][]string {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	rng := rand.New(rand.NewPCG(h.Sum64(), 0))
+
+	longest := 0
+	for _, p := range params {
+		longest = max(longest, len(values[p.typ]))
+	}
+	var cases [][]string
+	seen := make(map[string]bool)
+	add := func(pick func(vs []string) string) {
+		c := make([]string, len(params))
+		for i, p := range params {
+			c[i] = pick(values[p.typ])
+		}
+		if key := strings.Join(c, "\x00"); !seen[key] {
+			seen[key] = true
+			cases = append(cases, c)
+		}
+	}
+	for n := range min(longest, MaxCases) {
+		add(func(vs []string) string { return vs[n%len(vs)] })
+	}
+	// Random picks repeat, so try more often than there are cases left
+	for range 4 * MaxCases {
+		if len(cases) >= MaxCases {
+			break
+		}
+		add(func(vs []string) string { return vs[rng.IntN(len(vs))] })
+	}
+	return cases
+}
+
+// impure returns an impure package the function uses, directly or through
+// other functions of the file, or "" if it uses none
+func (g *generator) impure(name string, visited map[string]bool) string {
+	if visited[name] {
+		// Checked already, or being checked further up a recursion
+		return ""
+	}
+	visited[name] = true
+	pkg := ""
+	ast.Inspect(g.funcs[name].Body, func(n ast.Node) bool {
+		if pkg != "" {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			// Only calls count: variables such as os.ErrNotExist are fine
+			if sel, ok := n.Fun.(*ast.SelectorExpr); ok {
+				if id, ok := sel.X.(*ast.Ident); ok && id.Obj == nil && impure[g.imports[id.Name]] {
+					pkg = g.imports[id.Name]
+				}
+			}
+		case *ast.Ident:
+			if n.Obj != nil && n.Obj.Kind == ast.Fun && n.Obj.Decl == g.funcs[n.Name] {
+				pkg = g.impure(n.Name, visited)
+			}
+		}
+		return true
+	})
+	return pkg
+}
+
+// helpers are the functions the differential tests share
+const helpers = `// differentialCall calls f and returns its results, with errors replaced by
+// their messages and a panic by its value
+func differentialCall(f func() []any) (results []any) {
+	defer func() {
+		if r := recover(); r != nil {
+			results = []any{fmt.Sprintf("panic: %v", r)}
+		}
+	}()
+	results = f()
+	for i, r := range results {
+		if err, ok := r.(error); ok {
+			results[i] = "error: " + err.Error()
+		}
+	}
+	return results
+}
+
+// differentialEqual reports whether two calls returned the same results,
+// counting NaN as equal to itself
+func differentialEqual(a, b []any) bool {
+	return reflect.DeepEqual(a, b) || fmt.Sprintf("%#v", a) == fmt.Sprintf("%#v", b)
+}
+`
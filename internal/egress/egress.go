@@ -0,0 +1,148 @@
+package egress
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/log"
+)
+
+var logger = log.Component("egress")
+
+// DefaultAuditPath is where attempted connections are logged by default
+const DefaultAuditPath = ".metamorph/egress.jsonl"
+
+// ErrDenied is returned for connections to hosts that are not allowlisted
+var ErrDenied = errors.New("egress denied")
+
+// Attempt is one outbound connection attempt, allowed or denied
+type Attempt struct {
+	Time    time.Time `json:"time"`
+	Address string    `json:"address"` // host:port as dialed
+	Allowed bool      `json:"allowed"`
+}
+
+// Allowlist permits outbound connections only to the listed endpoints and
+// records every attempt. Entries are host or host:port; a bare host allows
+// port 443 only.
+type Allowlist struct {
+	AuditPath string // Append attempts as JSON lines to this file (empty disables the file)
+
+	mu       sync.Mutex
+	allowed  map[string]bool
+	attempts []Attempt
+}
+
+// NewAllowlist creates an allowlist from host or host:port entries
+func NewAllowlist(entries []string, auditPath string) (*Allowlist, error) {
+	a := &Allowlist{AuditPath: auditPath, allowed: make(map[string]bool)}
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(entry); err != nil {
+			entry = net.JoinHostPort(entry, "443")
+		}
+		a.allowed[entry] = true
+	}
+	if len(a.allowed) == 0 {
+		return nil, fmt.Errorf("egress allowlist is empty")
+	}
+	return a, nil
+}
+
+// Allows reports whether a connection to address (host:port) is permitted
+func (a *Allowlist) Allows(address string) bool {
+	return a.allowed[strings.ToLower(address)]
+}
+
+// Attempts returns every connection attempt seen so far
+func (a *Allowlist) Attempts() []Attempt {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]Attempt(nil), a.attempts...)
+}
+
+// check records an attempt and returns ErrDenied if it is not allowlisted
+func (a *Allowlist) check(address string) error {
+	attempt := Attempt{Time: time.Now().UTC(), Address: address, Allowed: a.Allows(address)}
+
+	a.mu.Lock()
+	a.attempts = append(a.attempts, attempt)
+	auditErr := a.appendAudit(attempt)
+	a.mu.Unlock()
+
+	if auditErr != nil {
+		// An attempt that cannot be audited is not made
+		return fmt.Errorf("egress audit failed for %s: %w", address, auditErr)
+	}
+	if !attempt.Allowed {
+		host, port, _ := net.SplitHostPort(address)
+		logger.Warn("Blocked outbound connection, not in the egress allowlist", "host", host, "port", port, "address", address)
+		return fmt.Errorf("%w: %s is not in the allowlist", ErrDenied, address)
+	}
+	return nil
+}
+
+// appendAudit writes one attempt to the audit file; callers hold a.mu
+func (a *Allowlist) appendAudit(attempt Attempt) error {
+	if a.AuditPath == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(a.AuditPath), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.AuditPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(attempt); err != nil {
+		return err
+	}
+	_, err = f.Write(buf.Bytes())
+	return err
+}
+
+// Transport returns a copy of base that only dials allowlisted addresses and
+// never uses a proxy, so the address checked is the address connected to
+func (a *Allowlist) Transport(base *http.Transport) *http.Transport {
+	t := base.Clone()
+	t.Proxy = nil
+	dial := t.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	t.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if err := a.check(address); err != nil {
+			return nil, err
+		}
+		return dial(ctx, network, address)
+	}
+	// A custom TLS dialer would bypass the check, so none is allowed
+	t.DialTLSContext = nil
+	t.DialTLS = nil
+	return t
+}
+
+// Install routes every HTTP client in the process that uses the default
+// transport (including the provider SDKs, which clone it) through the
+// allowlist. It must be called before any client is created.
+func Install(a *Allowlist) {
+	transport := a.Transport(http.DefaultTransport.(*http.Transport))
+	http.DefaultTransport = transport
+	http.DefaultClient.Transport = transport
+}
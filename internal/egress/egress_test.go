@@ -0,0 +1,76 @@
+package egress
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestAllowlist tests that only allowlisted endpoints are dialed and every attempt is audited
+func TestAllowlist(t *testing.T) {
+	allowed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer allowed.Close()
+	blocked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Request reached a host outside the allowlist")
+	}))
+	defer blocked.Close()
+
+	auditPath := filepath.Join(t.TempDir(), "egress.jsonl")
+	a, err := NewAllowlist([]string{allowed.Listener.Addr().String()}, auditPath)
+	if err != nil {
+		t.Fatalf("Failed to create allowlist: %v", err)
+	}
+	client := &http.Client{Transport: a.Transport(http.DefaultTransport.(*http.Transport))}
+
+	resp, err := client.Get(allowed.URL)
+	if err != nil {
+		t.Fatalf("Expected the allowlisted host to be reachable: %v", err)
+	}
+	resp.Body.Close()
+
+	if _, err := client.Get(blocked.URL); !errors.Is(err, ErrDenied) {
+		t.Errorf("Expected ErrDenied for a host outside the allowlist, got %v", err)
+	}
+
+	attempts := a.Attempts()
+	if len(attempts) != 2 || !attempts[0].Allowed || attempts[1].Allowed {
+		t.Fatalf("Expected one allowed and one denied attempt, got %+v", attempts)
+	}
+	if attempts[1].Address != blocked.Listener.Addr().String() {
+		t.Errorf("Expected the denied attempt to record %s, got %s", blocked.Listener.Addr(), attempts[1].Address)
+	}
+
+	data, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatalf("Failed to read audit file: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 {
+		t.Errorf("Expected 2 audit lines, got %d:\n%s", len(lines), data)
+	}
+}
+
+// TestNewAllowlist tests entry normalization
+func TestNewAllowlist(t *testing.T) {
+	a, err := NewAllowlist([]string{" OpenRouter.ai ", "localhost:8080", ""}, "")
+	if err != nil {
+		t.Fatalf("Failed to create allowlist: %v", err)
+	}
+	if !a.Allows("openrouter.ai:443") {
+		t.Error("Expected a bare host to allow port 443")
+	}
+	if a.Allows("openrouter.ai:80") {
+		t.Error("Expected a bare host not to allow other ports")
+	}
+	if !a.Allows("localhost:8080") {
+		t.Error("Expected an explicit host:port to be allowed")
+	}
+	if _, err := NewAllowlist([]string{" "}, ""); err == nil {
+		t.Error("Expected an error for an empty allowlist")
+	}
+}
@@ -0,0 +1,167 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"text/tabwriter"
+)
+
+// Variant is one pipeline configuration taking part in an A/B experiment
+type Variant struct {
+	Name     string
+	Strategy string
+	Model    string
+}
+
+// ParseVariant parses a "strategy[:model]" specification. Only the first colon
+// separates the strategy, so model names such as "vendor/model:free" are kept intact.
+func ParseVariant(name, spec string) (Variant, error) {
+	strategy, model, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	if strategy == "" {
+		return Variant{}, fmt.Errorf("variant %s: empty strategy in %q", name, spec)
+	}
+	return Variant{Name: name, Strategy: strategy, Model: model}, nil
+}
+
+// String returns a printable description of the variant
+func (v Variant) String() string {
+	return fmt.Sprintf("%s (%s/%s)", v.Name, v.Strategy, displayModel(v.Model))
+}
+
+// ABConfig describes an A/B experiment
+type ABConfig struct {
+	A       Variant
+	B       Variant
+	Runs    int      // Number of repetitions per variant
+	Samples []string // Corpus files rewritten in every run
+}
+
+// RunObservation holds the per-run aggregate for one variant
+type RunObservation struct {
+	AcceptanceRate float64
+	LOCDelta       float64
+	CCDelta        float64
+	CogCDelta      float64
+}
+
+// ABComparison is the statistical summary for one metric
+type ABComparison struct {
+	Metric string
+	A      Summary
+	B      Summary
+	T      float64
+	DF     float64
+	P      float64
+}
+
+// Significant reports whether the difference is significant at the given level
+func (c ABComparison) Significant(alpha float64) bool {
+	return !math.IsNaN(c.P) && c.P < alpha
+}
+
+// ABReport holds the raw observations and their comparison
+type ABReport struct {
+	Config      ABConfig
+	A           []RunObservation
+	B           []RunObservation
+	Comparisons []ABComparison
+}
+
+// RunAB runs both variants the configured number of times and compares them
+func (h *Harness) RunAB(ctx context.Context, cfg ABConfig) (*ABReport, error) {
+	if cfg.Runs < 1 {
+		return nil, fmt.Errorf("number of runs must be positive, got %d", cfg.Runs)
+	}
+	if len(cfg.Samples) == 0 {
+		return nil, fmt.Errorf("at least one sample is required")
+	}
+
+	report := &ABReport{Config: cfg}
+	for run := 1; run <= cfg.Runs; run++ {
+		report.A = append(report.A, h.runVariant(ctx, cfg.A, cfg.Samples, run, cfg.Runs))
+		report.B = append(report.B, h.runVariant(ctx, cfg.B, cfg.Samples, run, cfg.Runs))
+	}
+
+	report.Comparisons = compareObservations(report.A, report.B)
+	return report, nil
+}
+
+// runVariant rewrites every sample once with the variant's configuration
+func (h *Harness) runVariant(ctx context.Context, v Variant, samples []string, run, runs int) RunObservation {
+	fmt.Printf("[run %d/%d] Variant %s\n", run, runs, v)
+
+	var results []Result
+	for _, sample := range samples {
+		results = append(results, h.RunCase(ctx, Case{Strategy: v.Strategy, Model: v.Model, Sample: sample}))
+	}
+	return observe(results)
+}
+
+// observe collapses the results of one run into a single observation
+func observe(results []Result) RunObservation {
+	row := Aggregate(results, false)
+	if len(row) == 0 {
+		return RunObservation{}
+	}
+	r := row[0]
+	return RunObservation{
+		AcceptanceRate: r.AcceptanceRate(),
+		LOCDelta:       r.LOCDelta,
+		CCDelta:        r.CCDelta,
+		CogCDelta:      r.CogCDelta,
+	}
+}
+
+// compareObservations runs a Welch's t-test for every tracked metric
+func compareObservations(a, b []RunObservation) []ABComparison {
+	metricsOf := []struct {
+		name string
+		get  func(RunObservation) float64
+	}{
+		{"Acceptance rate %", func(o RunObservation) float64 { return o.AcceptanceRate }},
+		{"LOC Δ%", func(o RunObservation) float64 { return o.LOCDelta }},
+		{"CC Δ%", func(o RunObservation) float64 { return o.CCDelta }},
+		{"CogC Δ%", func(o RunObservation) float64 { return o.CogCDelta }},
+	}
+
+	var comparisons []ABComparison
+	for _, m := range metricsOf {
+		sa := Summarize(collect(a, m.get))
+		sb := Summarize(collect(b, m.get))
+		t, df, p := WelchTTest(sa, sb)
+		comparisons = append(comparisons, ABComparison{Metric: m.name, A: sa, B: sb, T: t, DF: df, P: p})
+	}
+	return comparisons
+}
+
+func collect(obs []RunObservation, get func(RunObservation) float64) []float64 {
+	values := make([]float64, len(obs))
+	for i, o := range obs {
+		values[i] = get(o)
+	}
+	return values
+}
+
+// WriteABReport prints the statistical summary of an A/B experiment
+func WriteABReport(w io.Writer, report *ABReport, alpha float64) error {
+	fmt.Fprintf(w, "A: %s\nB: %s\nRuns per variant: %d, samples per run: %d, alpha: %.3f\n\n",
+		report.Config.A, report.Config.B, report.Config.Runs, len(report.Config.Samples), alpha)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "METRIC\tMEAN A\tVAR A\tMEAN B\tVAR B\tΔ (B-A)\tt\tdf\tp\tSIGNIFICANT")
+	for _, c := range report.Comparisons {
+		verdict := "no"
+		if math.IsNaN(c.P) {
+			verdict = "n/a (need ≥2 runs)"
+		} else if c.Significant(alpha) {
+			verdict = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%.2f\t%.2f\t%.2f\t%.2f\t%+.2f\t%.3f\t%.1f\t%.4f\t%s\n",
+			c.Metric, c.A.Mean, c.A.Variance, c.B.Mean, c.B.Variance, c.B.Mean-c.A.Mean,
+			c.T, c.DF, c.P, verdict)
+	}
+	return tw.Flush()
+}
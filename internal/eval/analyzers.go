@@ -0,0 +1,344 @@
+package eval
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Finding is a single diagnostic reported by a static analyzer
+type Finding struct {
+	Tool    string `json:"tool"`
+	Rule    string `json:"rule"`
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// StaticAnalyzer runs an external source-level analyzer on a module directory
+type StaticAnalyzer interface {
+	Name() string
+	Analyze(dir string) ([]Finding, error)
+}
+
+// NewStaticAnalyzer returns the analyzer with the given name.
+// semgrepConfig is passed to semgrep's --config flag (e.g. "p/golang" or a rules file).
+func NewStaticAnalyzer(name, semgrepConfig string) (StaticAnalyzer, error) {
+	switch name {
+	case "gosec":
+		return gosecAnalyzer{}, nil
+	case "staticcheck":
+		return staticcheckAnalyzer{}, nil
+	case "semgrep":
+		if semgrepConfig == "" {
+			semgrepConfig = "p/golang"
+		}
+		return semgrepAnalyzer{config: semgrepConfig}, nil
+	default:
+		return nil, fmt.Errorf("unknown static analyzer %q", name)
+	}
+}
+
+// RuleDelta is the change in findings for one rule
+type RuleDelta struct {
+	Tool      string `json:"tool"`
+	Rule      string `json:"rule"`
+	Original  int    `json:"original"`
+	Rewritten int    `json:"rewritten"`
+}
+
+// AnalyzerReport compares analyzer findings on original and rewritten sources
+type AnalyzerReport struct {
+	Deltas []RuleDelta       `json:"deltas"`
+	Errors map[string]string `json:"errors,omitempty"` // Tool name -> failure
+}
+
+// Gained returns the total number of findings that appeared after rewriting
+func (ar *AnalyzerReport) Gained() int {
+	n := 0
+	for _, d := range ar.Deltas {
+		if d.Rewritten > d.Original {
+			n += d.Rewritten - d.Original
+		}
+	}
+	return n
+}
+
+// Lost returns the total number of findings that disappeared after rewriting
+func (ar *AnalyzerReport) Lost() int {
+	n := 0
+	for _, d := range ar.Deltas {
+		if d.Original > d.Rewritten {
+			n += d.Original - d.Rewritten
+		}
+	}
+	return n
+}
+
+// CompareFindings counts findings per tool and rule for both versions
+func CompareFindings(original, rewritten []Finding) []RuleDelta {
+	type key struct{ tool, rule string }
+	counts := make(map[key]*RuleDelta)
+	get := func(f Finding) *RuleDelta {
+		k := key{f.Tool, f.Rule}
+		if d, ok := counts[k]; ok {
+			return d
+		}
+		d := &RuleDelta{Tool: f.Tool, Rule: f.Rule}
+		counts[k] = d
+		return d
+	}
+	for _, f := range original {
+		get(f).Original++
+	}
+	for _, f := range rewritten {
+		get(f).Rewritten++
+	}
+
+	deltas := make([]RuleDelta, 0, len(counts))
+	for _, d := range counts {
+		deltas = append(deltas, *d)
+	}
+	sort.Slice(deltas, func(i, j int) bool {
+		if deltas[i].Tool != deltas[j].Tool {
+			return deltas[i].Tool < deltas[j].Tool
+		}
+		return deltas[i].Rule < deltas[j].Rule
+	})
+	return deltas
+}
+
+// RunAnalyzers runs every analyzer on the original and rewritten source and compares the findings.
+// Analyzer failures (e.g. tool not installed) are recorded per tool and do not abort the comparison.
+func RunAnalyzers(analyzers []StaticAnalyzer, original, rewritten string) *AnalyzerReport {
+	report := &AnalyzerReport{Errors: make(map[string]string)}
+
+	var before, after []Finding
+	for _, a := range analyzers {
+		o, err := analyzeSource(a, original)
+		if err != nil {
+			report.Errors[a.Name()] = err.Error()
+			continue
+		}
+		r, err := analyzeSource(a, rewritten)
+		if err != nil {
+			report.Errors[a.Name()] = err.Error()
+			continue
+		}
+		before = append(before, o...)
+		after = append(after, r...)
+	}
+
+	report.Deltas = CompareFindings(before, after)
+	return report
+}
+
+// analyzeSource writes the source into a throwaway module and runs the analyzer on it
+func analyzeSource(a StaticAnalyzer, source string) ([]Finding, error) {
+	dir, err := os.MkdirTemp("", "metamorph-analyze-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create analysis directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module sample\n\ngo 1.24\n"), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write go.mod: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sample.go"), []byte(stripBuildConstraints(source)), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write source: %w", err)
+	}
+
+	return a.Analyze(dir)
+}
+
+// stripBuildConstraints removes leading build constraint lines so analyzers see the file
+// without having to know the rewritten build tag
+func stripBuildConstraints(source string) string {
+	lines := strings.Split(source, "\n")
+	i := 0
+	for i < len(lines) {
+		line := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(line, "//go:build") || strings.HasPrefix(line, "// +build") || line == "" {
+			i++
+			continue
+		}
+		break
+	}
+	return strings.Join(lines[i:], "\n")
+}
+
+// runTool executes an analyzer binary in dir and returns its stdout.
+// Analyzers exit non-zero when they report findings, so only a missing
+// binary or empty output is treated as a failure.
+func runTool(dir, name string, args ...string) ([]byte, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s not found in PATH", name)
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil && stdout.Len() == 0 {
+		return nil, fmt.Errorf("%s failed: %v\nStderr: %s", name, err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+type gosecAnalyzer struct{}
+
+func (gosecAnalyzer) Name() string { return "gosec" }
+
+func (g gosecAnalyzer) Analyze(dir string) ([]Finding, error) {
+	out, err := runTool(dir, "gosec", "-fmt=json", "-quiet", "-no-fail", "./...")
+	if err != nil {
+		return nil, err
+	}
+
+	var report struct {
+		Issues []struct {
+			RuleID  string `json:"rule_id"`
+			Line    string `json:"line"`
+			Details string `json:"details"`
+		} `json:"Issues"`
+	}
+	if err := json.Unmarshal(out, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse gosec output: %w", err)
+	}
+
+	findings := make([]Finding, 0, len(report.Issues))
+	for _, issue := range report.Issues {
+		var line int
+		fmt.Sscanf(issue.Line, "%d", &line)
+		findings = append(findings, Finding{Tool: g.Name(), Rule: issue.RuleID, Line: line, Message: issue.Details})
+	}
+	return findings, nil
+}
+
+type staticcheckAnalyzer struct{}
+
+func (staticcheckAnalyzer) Name() string { return "staticcheck" }
+
+func (s staticcheckAnalyzer) Analyze(dir string) ([]Finding, error) {
+	out, err := runTool(dir, "staticcheck", "-f", "json", "-checks", "all", "./...")
+	if err != nil {
+		return nil, err
+	}
+
+	// staticcheck emits one JSON object per line
+	var findings []Finding
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		var diag struct {
+			Code     string `json:"code"`
+			Message  string `json:"message"`
+			Location struct {
+				Line int `json:"line"`
+			} `json:"location"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &diag); err != nil {
+			return nil, fmt.Errorf("failed to parse staticcheck output: %w", err)
+		}
+		findings = append(findings, Finding{Tool: s.Name(), Rule: diag.Code, Line: diag.Location.Line, Message: diag.Message})
+	}
+	return findings, scanner.Err()
+}
+
+type semgrepAnalyzer struct {
+	config string
+}
+
+func (semgrepAnalyzer) Name() string { return "semgrep" }
+
+func (s semgrepAnalyzer) Analyze(dir string) ([]Finding, error) {
+	out, err := runTool(dir, "semgrep", "scan", "--json", "--quiet", "--metrics=off", "--config", s.config, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var report struct {
+		Results []struct {
+			CheckID string `json:"check_id"`
+			Start   struct {
+				Line int `json:"line"`
+			} `json:"start"`
+			Extra struct {
+				Message string `json:"message"`
+			} `json:"extra"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(out, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse semgrep output: %w", err)
+	}
+
+	findings := make([]Finding, 0, len(report.Results))
+	for _, r := range report.Results {
+		findings = append(findings, Finding{Tool: s.Name(), Rule: r.CheckID, Line: r.Start.Line, Message: r.Extra.Message})
+	}
+	return findings, nil
+}
+
+// WriteAnalyzerTable prints per-rule finding changes aggregated over all results
+func WriteAnalyzerTable(w io.Writer, results []Result) error {
+	type key struct{ strategy, model, tool, rule string }
+	totals := make(map[key]*RuleDelta)
+	var keys []key
+	for _, res := range results {
+		if res.Analysis == nil {
+			continue
+		}
+		for _, d := range res.Analysis.Deltas {
+			k := key{res.Strategy, res.Model, d.Tool, d.Rule}
+			if _, ok := totals[k]; !ok {
+				totals[k] = &RuleDelta{Tool: d.Tool, Rule: d.Rule}
+				keys = append(keys, k)
+			}
+			totals[k].Original += d.Original
+			totals[k].Rewritten += d.Rewritten
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STRATEGY\tMODEL\tTOOL\tRULE\tORIGINAL\tREWRITTEN\tCHANGE")
+	for _, k := range keys {
+		d := totals[k]
+		change := "="
+		if d.Rewritten > d.Original {
+			change = fmt.Sprintf("gained %d", d.Rewritten-d.Original)
+		} else if d.Original > d.Rewritten {
+			change = fmt.Sprintf("lost %d", d.Original-d.Rewritten)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%s\n",
+			k.strategy, displayModel(k.model), k.tool, k.rule, d.Original, d.Rewritten, change)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, res := range results {
+		if res.Analysis == nil {
+			continue
+		}
+		for tool, msg := range res.Analysis.Errors {
+			fmt.Fprintf(w, "Warning: %s skipped for %s: %s\n", tool, res.Sample, firstLine(msg))
+		}
+	}
+	return nil
+}
+
+// firstLine returns the first line of a possibly multi-line message
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
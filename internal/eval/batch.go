@@ -0,0 +1,401 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/metrics"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+	"github.com/Hekzory/MetamorphLLM/internal/sandbox"
+)
+
+// BatchConfig describes a batch run over a directory of sample programs
+type BatchConfig struct {
+	Dir         string // Every package below Dir is a sample program
+	Strategies  []string
+	Models      []string                 // An empty model name selects the strategy's default model
+	Techniques  []rewriter.TechniqueType // Empty keeps each strategy's default
+	Runs        int                      // Repetitions of every sample, strategy and model; defaults to 1
+	Sandbox     sandbox.Config           // Isolation for the test binaries of rewritten samples
+	TestTimeout string                   // Passed to go test -timeout; defaults to 5m
+}
+
+// BatchResult is the outcome of one run of a sample program
+type BatchResult struct {
+	Sample   string `json:"sample"`
+	Strategy string `json:"strategy"`
+	Model    string `json:"model"`
+	Files    int    `json:"files"`   // Go files rewritten, tests excluded
+	Changed  int    `json:"changed"` // Files the rewrite changed
+	Compiled bool   `json:"compiled"`
+	Tested   bool   `json:"tested"` // The sample has tests and they ran
+	Passed   bool   `json:"passed"` // The tests passed
+	// Percentage changes of the metrics summed over the files of the sample
+	LOCDelta  float64       `json:"loc_delta"`
+	CCDelta   float64       `json:"cc_delta"`
+	CogCDelta float64       `json:"cogc_delta"`
+	Latency   time.Duration `json:"latency"` // Time spent rewriting
+	Error     string        `json:"error,omitempty"`
+}
+
+// Succeeded reports whether the rewrite changed the sample, compiled and
+// passed its tests, if it has any
+func (r BatchResult) Succeeded() bool {
+	return r.Error == "" && r.Changed > 0 && r.Compiled && (!r.Tested || r.Passed)
+}
+
+// FindBatchSamples returns the directories below dir that hold Go files other
+// than tests, skipping testdata, vendor and hidden directories
+func FindBatchSamples(dir string) ([]string, error) {
+	var samples []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != dir && (name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isSampleSource(d.Name()) && !slices.Contains(samples, filepath.Dir(path)) {
+			samples = append(samples, filepath.Dir(path))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find samples: %w", err)
+	}
+	return samples, nil
+}
+
+// isSampleSource reports whether a file of a sample is rewritten
+func isSampleSource(name string) bool {
+	return strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") && !strings.HasSuffix(name, ".rewritten.go")
+}
+
+// RunBatch rewrites every sample program below cfg.Dir with every strategy
+// and model, then compiles and tests it. The rewritten files replace the
+// originals through a go build overlay, so the samples are never modified.
+// Failures are recorded in the results rather than aborting the batch.
+func (h *Harness) RunBatch(ctx context.Context, cfg BatchConfig) ([]BatchResult, error) {
+	if len(cfg.Strategies) == 0 {
+		return nil, fmt.Errorf("at least one strategy is required")
+	}
+	samples, err := FindBatchSamples(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no Go packages found in %s", cfg.Dir)
+	}
+	models := cfg.Models
+	if len(models) == 0 {
+		models = []string{""}
+	}
+	runs := max(cfg.Runs, 1)
+
+	var results []BatchResult
+	total := len(samples) * len(cfg.Strategies) * len(models) * runs
+	for _, sample := range samples {
+		for _, strategy := range cfg.Strategies {
+			for _, model := range models {
+				for range runs {
+					if ctx.Err() != nil {
+						return results, fmt.Errorf("batch stopped: %w", context.Cause(ctx))
+					}
+					fmt.Printf("[%d/%d] Rewriting sample=%s strategy=%s model=%s\n",
+						len(results)+1, total, sample, strategy, displayModel(model))
+					results = append(results, h.runBatchSample(ctx, cfg, sample, strategy, model))
+				}
+			}
+		}
+	}
+	return results, nil
+}
+
+// runBatchSample rewrites, compiles and tests one sample
+func (h *Harness) runBatchSample(ctx context.Context, cfg BatchConfig, sample, strategy, model string) BatchResult {
+	result := BatchResult{Sample: sample, Strategy: strategy, Model: model}
+
+	r, err := h.NewRewriter(strategy, model)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer r.Close()
+	if len(cfg.Techniques) > 0 {
+		if err := r.SetTechniques(cfg.Techniques...); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+	}
+
+	scratch, err := os.MkdirTemp("", "metamorph-batch-*")
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to create scratch directory: %v", err)
+		return result
+	}
+	defer os.RemoveAll(scratch)
+
+	entries, err := os.ReadDir(sample)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to read sample: %v", err)
+		return result
+	}
+	overlay := struct{ Replace map[string]string }{Replace: make(map[string]string)}
+	var before, after metrics.Metrics
+	hasTests := false
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(entry.Name(), "_test.go") {
+			hasTests = true
+		}
+		if !isSampleSource(entry.Name()) {
+			continue
+		}
+		path, err := filepath.Abs(filepath.Join(sample, entry.Name()))
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			result.Error = fmt.Sprintf("failed to read sample: %v", err)
+			return result
+		}
+		original := string(content)
+
+		start := time.Now()
+		rewritten, err := r.RewriteContent(ctx, original)
+		result.Latency += time.Since(start)
+		if err != nil {
+			result.Error = fmt.Sprintf("rewrite of %s failed: %v", entry.Name(), err)
+			return result
+		}
+		result.Files++
+		// A rewrite that failed or changed nothing only appends a comment
+		if !strings.HasPrefix(rewritten, original) {
+			result.Changed++
+		}
+		addMetrics(&before, original)
+		addMetrics(&after, rewritten)
+
+		// The rewritten file keeps its build constraint, which the overlay
+		// build selects with the rewriter's tag like the manager does
+		replacement := filepath.Join(scratch, entry.Name())
+		if err := os.WriteFile(replacement, []byte(rewritten), 0644); err != nil {
+			result.Error = fmt.Sprintf("failed to write rewritten file: %v", err)
+			return result
+		}
+		overlay.Replace[path] = replacement
+	}
+	delta := metrics.CalculateDeltaMetrics(&before, &after)
+	result.LOCDelta, result.CCDelta, result.CogCDelta = delta.LOC.Percent, delta.CC.Percent, delta.CogC.Percent
+
+	overlayPath := filepath.Join(scratch, "overlay.json")
+	data, err := json.Marshal(overlay)
+	if err == nil {
+		err = os.WriteFile(overlayPath, data, 0644)
+	}
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to write build overlay: %v", err)
+		return result
+	}
+
+	var tags []string
+	if tag := r.EffectiveBuildTag(); tag != "" {
+		tags = []string{"-tags=" + tag}
+	}
+	if err := runGo(ctx, sample, append([]string{"build", "-overlay", overlayPath, "-o", os.DevNull}, append(tags, ".")...)...); err != nil {
+		result.Error = fmt.Sprintf("build failed: %v", err)
+		return result
+	}
+	result.Compiled = true
+	if !hasTests {
+		return result
+	}
+
+	// Test binaries run LLM-modified code, so they run in a sandbox of their own
+	sb, err := sandbox.New(cfg.Sandbox)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer sb.Close()
+	timeout := cfg.TestTimeout
+	if timeout == "" {
+		timeout = "5m"
+	}
+	args := append([]string{"test", "-overlay", overlayPath, "-count=1", "-timeout", timeout}, tags...)
+	if execFlag := sb.ExecFlag(); execFlag != "" {
+		args = append(args, "-exec", execFlag)
+	}
+	result.Tested = true
+	if err := runGo(ctx, sample, append(args, ".")...); err != nil {
+		result.Error = fmt.Sprintf("tests failed: %v", err)
+		return result
+	}
+	result.Passed = true
+	return result
+}
+
+// addMetrics adds the LOC, CC and CogC of src to m, ignoring source that does
+// not parse; the build reports it
+func addMetrics(m *metrics.Metrics, src string) {
+	if fm, err := metrics.CalculateMetricsFromContent("sample.go", src); err == nil {
+		m.LOC += fm.LOC
+		m.CC += fm.CC
+		m.CogC += fm.CogC
+	}
+}
+
+// runGo runs the go command in dir without credentials in its environment.
+// The error includes the output of the command.
+func runGo(ctx context.Context, dir string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	cmd.Env = sandbox.ScrubEnv(os.Environ())
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		if out := strings.TrimSpace(output.String()); out != "" {
+			return fmt.Errorf("%w: %s", err, out)
+		}
+		return err
+	}
+	return nil
+}
+
+// BatchRow aggregates the runs of one sample with one strategy and model
+type BatchRow struct {
+	Sample      string
+	Strategy    string
+	Model       string
+	Runs        int
+	Succeeded   int
+	Compiled    int
+	Tested      int
+	Passed      int
+	LOCDelta    float64 // Mean over runs that rewrote the sample
+	CCDelta     float64
+	CogCDelta   float64
+	MeanLatency time.Duration
+}
+
+// SuccessRate is the percentage of runs that succeeded
+func (r BatchRow) SuccessRate() float64 {
+	return percentage(r.Succeeded, r.Runs)
+}
+
+// percentage is part of total in percent, or 0 for no total
+func percentage(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
+
+// AggregateBatch groups results by sample, strategy and model, in the order
+// they were first seen
+func AggregateBatch(results []BatchResult) []BatchRow {
+	var rows []BatchRow
+	index := make(map[[3]string]int)
+	rewritten := make(map[[3]string]int)
+	for _, res := range results {
+		key := [3]string{res.Sample, res.Strategy, res.Model}
+		i, ok := index[key]
+		if !ok {
+			i = len(rows)
+			index[key] = i
+			rows = append(rows, BatchRow{Sample: res.Sample, Strategy: res.Strategy, Model: res.Model})
+		}
+		row := &rows[i]
+		row.Runs++
+		row.MeanLatency += res.Latency
+		if res.Succeeded() {
+			row.Succeeded++
+		}
+		if res.Compiled {
+			row.Compiled++
+		}
+		if res.Tested {
+			row.Tested++
+		}
+		if res.Passed {
+			row.Passed++
+		}
+		if res.Files > 0 {
+			rewritten[key]++
+			row.LOCDelta += res.LOCDelta
+			row.CCDelta += res.CCDelta
+			row.CogCDelta += res.CogCDelta
+		}
+	}
+	for key, i := range index {
+		row := &rows[i]
+		row.MeanLatency /= time.Duration(row.Runs)
+		if n := rewritten[key]; n > 0 {
+			row.LOCDelta /= float64(n)
+			row.CCDelta /= float64(n)
+			row.CogCDelta /= float64(n)
+		}
+	}
+	return rows
+}
+
+// WriteBatchCSV writes one CSV record per sample, strategy and model
+func WriteBatchCSV(w io.Writer, rows []BatchRow) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"sample", "strategy", "model", "runs", "success_rate", "compile_rate", "test_pass_rate", "loc_delta", "cc_delta", "cogc_delta", "latency_ms"}); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		// Samples without tests have no pass rate
+		testPassRate := ""
+		if r.Tested > 0 {
+			testPassRate = strconv.FormatFloat(percentage(r.Passed, r.Tested), 'f', 2, 64)
+		}
+		record := []string{
+			r.Sample,
+			r.Strategy,
+			r.Model,
+			strconv.Itoa(r.Runs),
+			strconv.FormatFloat(r.SuccessRate(), 'f', 2, 64),
+			strconv.FormatFloat(percentage(r.Compiled, r.Runs), 'f', 2, 64),
+			testPassRate,
+			strconv.FormatFloat(r.LOCDelta, 'f', 2, 64),
+			strconv.FormatFloat(r.CCDelta, 'f', 2, 64),
+			strconv.FormatFloat(r.CogCDelta, 'f', 2, 64),
+			strconv.FormatInt(r.MeanLatency.Milliseconds(), 10),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteBatchJSON writes raw batch results as indented JSON
+func WriteBatchJSON(w io.Writer, results []BatchResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
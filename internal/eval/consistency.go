@@ -0,0 +1,411 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Hekzory/MetamorphLLM/internal/export"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+// Prompt constraints checked by the consistency report
+const (
+	ViolationParse      = "parse"      // Output is not valid Go
+	ViolationMissing    = "missing"    // Function disappeared from the output
+	ViolationSignature  = "signature"  // Signature changed
+	ViolationUnchanged  = "unchanged"  // Body was not rewritten
+	ViolationTypeCheck  = "type-check" // Rewritten body does not compile
+	ViolationDisallowed = "disallowed" // Body uses a package outside rewriter.AllowedImports
+)
+
+// violationOrder fixes the column order of the report
+var violationOrder = []string{
+	ViolationParse, ViolationMissing, ViolationSignature,
+	ViolationUnchanged, ViolationTypeCheck, ViolationDisallowed,
+}
+
+// ModelOutput is one variant's rewrite of a single function
+type ModelOutput struct {
+	Variant    Variant
+	Source     string // Rewritten function source, empty if missing
+	Compiles   bool
+	Violations []string
+}
+
+// FunctionConsistency gathers every variant's output for one function
+type FunctionConsistency struct {
+	Sample   string
+	Function string
+	Outputs  []ModelOutput
+	// Similarity[i][j] is the token-level similarity of Outputs[i] and Outputs[j] (0..1)
+	Similarity [][]float64
+}
+
+// CompileAgreement returns how many variants produced compiling code
+func (fc FunctionConsistency) CompileAgreement() int {
+	n := 0
+	for _, o := range fc.Outputs {
+		if o.Compiles {
+			n++
+		}
+	}
+	return n
+}
+
+// MeanSimilarity returns the mean pairwise similarity between variants' outputs
+func (fc FunctionConsistency) MeanSimilarity() float64 {
+	sum, pairs := 0.0, 0
+	for i := range fc.Similarity {
+		for j := i + 1; j < len(fc.Similarity); j++ {
+			sum += fc.Similarity[i][j]
+			pairs++
+		}
+	}
+	if pairs == 0 {
+		return 0
+	}
+	return sum / float64(pairs)
+}
+
+// ConsistencyReport is the outcome of rewriting the same functions with several variants
+type ConsistencyReport struct {
+	Variants  []Variant
+	Functions []FunctionConsistency
+}
+
+// CheckConsistency rewrites every sample with every variant and compares the outputs per function
+func (h *Harness) CheckConsistency(ctx context.Context, variants []Variant, samples []string) (*ConsistencyReport, error) {
+	if len(variants) < 2 {
+		return nil, fmt.Errorf("at least two variants are required, got %d", len(variants))
+	}
+
+	report := &ConsistencyReport{Variants: variants}
+	checker := newTypeChecker()
+
+	for _, sample := range samples {
+		var (
+			original   string
+			results    []Result
+			rewrittens []string
+		)
+		for _, v := range variants {
+			fmt.Printf("Rewriting %s with %s\n", sample, v)
+			res, orig, rw := h.rewriteCase(ctx, Case{Strategy: v.Strategy, Model: v.Model, Sample: sample})
+			if res.Error != "" && orig == "" {
+				return nil, fmt.Errorf("failed to rewrite %s: %s", sample, res.Error)
+			}
+			original = orig
+			results = append(results, res)
+			rewrittens = append(rewrittens, rw)
+		}
+
+		functions, err := compareOutputs(checker, sample, original, variants, results, rewrittens)
+		if err != nil {
+			return nil, err
+		}
+		report.Functions = append(report.Functions, functions...)
+	}
+	return report, nil
+}
+
+// compareOutputs builds the per-function consistency entries for one sample
+func compareOutputs(tc *typeChecker, sample, original string, variants []Variant, results []Result, rewrittens []string) ([]FunctionConsistency, error) {
+	baseline, _, err := tc.check(original)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sample %s: %w", sample, err)
+	}
+
+	type variantData struct {
+		sources    map[string]string
+		typeErrors map[string]int
+		disallowed map[string]bool
+	}
+	data := make([]variantData, len(variants))
+	for i, rw := range rewrittens {
+		if !results[i].Parsed {
+			continue
+		}
+		errs, disallowed, err := tc.check(rw)
+		if err != nil {
+			continue
+		}
+		sources, err := export.Functions(rw)
+		if err != nil {
+			continue
+		}
+		data[i] = variantData{sources: sources, typeErrors: errs, disallowed: disallowed}
+	}
+
+	// Every function of the original is compared, whichever variants failed
+	originalFuncs, err := export.Functions(original)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sample %s: %w", sample, err)
+	}
+	names := make([]string, 0, len(originalFuncs))
+	for name := range originalFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var functions []FunctionConsistency
+	for _, name := range names {
+		fc := FunctionConsistency{Sample: sample, Function: name}
+		for i, v := range variants {
+			out := ModelOutput{Variant: v}
+			outcome := findOutcome(results[i], name)
+
+			switch {
+			case !results[i].Parsed:
+				out.Violations = append(out.Violations, ViolationParse)
+			case !outcome.Found:
+				out.Violations = append(out.Violations, ViolationMissing)
+			default:
+				out.Source = data[i].sources[name]
+				if !outcome.SignatureKept {
+					out.Violations = append(out.Violations, ViolationSignature)
+				}
+				if !outcome.BodyChanged {
+					out.Violations = append(out.Violations, ViolationUnchanged)
+				}
+				// Errors already present in the original are not the model's fault
+				newErrors := data[i].typeErrors[name] > baseline[name]
+				if newErrors {
+					out.Violations = append(out.Violations, ViolationTypeCheck)
+				}
+				if data[i].disallowed[name] {
+					out.Violations = append(out.Violations, ViolationDisallowed)
+				}
+				out.Compiles = !newErrors
+			}
+			fc.Outputs = append(fc.Outputs, out)
+		}
+
+		fc.Similarity = make([][]float64, len(fc.Outputs))
+		for i := range fc.Outputs {
+			fc.Similarity[i] = make([]float64, len(fc.Outputs))
+			for j := range fc.Outputs {
+				if i == j {
+					fc.Similarity[i][j] = 1
+				} else if j < i {
+					fc.Similarity[i][j] = fc.Similarity[j][i]
+				} else {
+					fc.Similarity[i][j] = TokenSimilarity(fc.Outputs[i].Source, fc.Outputs[j].Source)
+				}
+			}
+		}
+		functions = append(functions, fc)
+	}
+	return functions, nil
+}
+
+func findOutcome(res Result, function string) FunctionOutcome {
+	for _, fo := range res.Functions {
+		if fo.Function == function {
+			return fo
+		}
+	}
+	return FunctionOutcome{Function: function}
+}
+
+// typeChecker type-checks single-file packages against the standard library
+type typeChecker struct {
+	fset     *token.FileSet
+	importer types.Importer
+	allowed  map[string]bool
+}
+
+func newTypeChecker() *typeChecker {
+	fset := token.NewFileSet()
+	allowed := make(map[string]bool)
+	for _, path := range rewriter.AllowedImports {
+		allowed[path] = true
+	}
+	return &typeChecker{
+		fset:     fset,
+		importer: importer.ForCompiler(fset, "source", nil),
+		allowed:  allowed,
+	}
+}
+
+// check type-checks the source and returns, per function, the number of type errors
+// and whether the body uses a package outside the allowed list
+func (tc *typeChecker) check(content string) (map[string]int, map[string]bool, error) {
+	f, err := parser.ParseFile(tc.fset, "", content, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var typeErrors []types.Error
+	conf := types.Config{
+		Importer: tc.importer,
+		Error: func(err error) {
+			if te, ok := err.(types.Error); ok {
+				typeErrors = append(typeErrors, te)
+			}
+		},
+	}
+	info := &types.Info{Uses: make(map[*ast.Ident]types.Object)}
+	_, _ = conf.Check(f.Name.Name, tc.fset, []*ast.File{f}, info)
+
+	errs := make(map[string]int)
+	disallowed := make(map[string]bool)
+	for _, decl := range f.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || funcDecl.Body == nil {
+			continue
+		}
+		name := export.QualifiedName(funcDecl)
+		for _, te := range typeErrors {
+			if te.Pos >= funcDecl.Pos() && te.Pos < funcDecl.End() {
+				errs[name]++
+			}
+		}
+		ast.Inspect(funcDecl.Body, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok {
+				if pkg, ok := info.Uses[id].(*types.PkgName); ok && !tc.allowed[pkg.Imported().Path()] {
+					disallowed[name] = true
+				}
+			}
+			return true
+		})
+	}
+	return errs, disallowed, nil
+}
+
+// TokenSimilarity returns 2·LCS/(|a|+|b|) over the Go token streams of two snippets:
+// 1 for token-identical code, 0 when nothing is shared or either side is empty
+func TokenSimilarity(a, b string) float64 {
+	ta, tb := tokenize(a), tokenize(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+
+	prev := make([]int, len(tb)+1)
+	curr := make([]int, len(tb)+1)
+	for i := 1; i <= len(ta); i++ {
+		for j := 1; j <= len(tb); j++ {
+			if ta[i-1] == tb[j-1] {
+				curr[j] = prev[j-1] + 1
+			} else {
+				curr[j] = max(prev[j], curr[j-1])
+			}
+		}
+		prev, curr = curr, prev
+	}
+	return 2 * float64(prev[len(tb)]) / float64(len(ta)+len(tb))
+}
+
+// tokenize returns the Go tokens of a snippet, ignoring comments and automatic semicolons
+func tokenize(src string) []string {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	s.Init(file, []byte(src), nil, 0)
+
+	var tokens []string
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue
+		}
+		if lit != "" {
+			tokens = append(tokens, lit)
+		} else {
+			tokens = append(tokens, tok.String())
+		}
+	}
+	return tokens
+}
+
+// WriteConsistencyReport prints per-variant constraint statistics, the pairwise
+// similarity matrix and per-function agreement
+func WriteConsistencyReport(w io.Writer, report *ConsistencyReport) error {
+	n := len(report.Variants)
+
+	fmt.Fprintln(w, "Per-variant compile rate and constraint violations:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "VARIANT\tFUNCTIONS\tCOMPILES\t%s\n", strings.ToUpper(strings.Join(violationOrder, "\t")))
+	for i, v := range report.Variants {
+		compiles := 0
+		counts := make(map[string]int)
+		for _, fc := range report.Functions {
+			if fc.Outputs[i].Compiles {
+				compiles++
+			}
+			for _, violation := range fc.Outputs[i].Violations {
+				counts[violation]++
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s", v, len(report.Functions), percent(compiles, len(report.Functions)))
+		for _, violation := range violationOrder {
+			fmt.Fprintf(tw, "\t%d", counts[violation])
+		}
+		fmt.Fprintln(tw)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nMean pairwise output similarity (token LCS):")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "\t")
+	for _, v := range report.Variants {
+		fmt.Fprintf(tw, "%s\t", v.Name)
+	}
+	fmt.Fprintln(tw)
+	for i, v := range report.Variants {
+		fmt.Fprintf(tw, "%s\t", v.Name)
+		for j := 0; j < n; j++ {
+			sum := 0.0
+			for _, fc := range report.Functions {
+				sum += fc.Similarity[i][j]
+			}
+			mean := 0.0
+			if len(report.Functions) > 0 {
+				mean = sum / float64(len(report.Functions))
+			}
+			fmt.Fprintf(tw, "%.2f\t", mean)
+		}
+		fmt.Fprintln(tw)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nPer-function agreement:")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SAMPLE\tFUNCTION\tCOMPILING\tMEAN SIMILARITY\tVIOLATIONS")
+	for _, fc := range report.Functions {
+		var violations []string
+		for _, o := range fc.Outputs {
+			if len(o.Violations) > 0 {
+				violations = append(violations, fmt.Sprintf("%s: %s", o.Variant.Name, strings.Join(o.Violations, ",")))
+			}
+		}
+		sort.Strings(violations)
+		fmt.Fprintf(tw, "%s\t%s\t%d/%d\t%.2f\t%s\n",
+			fc.Sample, fc.Function, fc.CompileAgreement(), n, fc.MeanSimilarity(), strings.Join(violations, "; "))
+	}
+	return tw.Flush()
+}
+
+// percent formats part/total as a percentage
+func percent(part, total int) string {
+	if total == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.1f%%", float64(part)/float64(total)*100)
+}
@@ -0,0 +1,76 @@
+package eval
+
+import (
+	"os"
+
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+// promptOverheadTokens approximates the size of the fixed rewriting prompt sent with every function
+const promptOverheadTokens = 900
+
+// Price is the cost of a model in USD per million tokens
+type Price = rewriter.Price
+
+// PriceTable maps model names to prices; the rewriter prices its API calls
+// with the same table
+type PriceTable map[string]Price
+
+// DefaultPrices contains list prices for the default models. Models with a
+// ":free" suffix are always priced at zero.
+var DefaultPrices = PriceTable(rewriter.DefaultPrices)
+
+// LoadPrices reads a JSON price table and merges it over the defaults
+func LoadPrices(path string) (PriceTable, error) {
+	prices, err := rewriter.LoadPrices(path)
+	return PriceTable(prices), err
+}
+
+// Lookup returns the price of a model and whether it is known
+func (pt PriceTable) Lookup(model string) (Price, bool) {
+	return rewriter.PriceTable(pt).Lookup(model)
+}
+
+// Cost returns the estimated cost in USD of a result, and whether the model's price is known
+func (pt PriceTable) Cost(res Result) (float64, bool) {
+	price, ok := pt.Lookup(ResolveModel(res.Strategy, res.Model))
+	if !ok {
+		return 0, false
+	}
+	return (float64(res.PromptTokens)*price.Input + float64(res.CompletionTokens)*price.Output) / 1e6, true
+}
+
+// ResolveModel returns the model actually used for a strategy when none was given
+func ResolveModel(strategy, model string) string {
+	if model != "" {
+		return model
+	}
+	switch strategy {
+	case StrategyGemini, StrategyGeminiText:
+		return rewriter.DefaultGeminiModel
+	case StrategyOpenRouter, StrategyOpenRouterText:
+		return rewriter.DefaultOpenRouterModel
+	case StrategyAnthropic, StrategyAnthropicText:
+		return rewriter.DefaultAnthropicModel
+	case StrategyOllama:
+		return rewriter.DefaultOllamaModel
+	case StrategyOpenAICompatible:
+		return os.Getenv("OPENAI_MODEL")
+	}
+	return ""
+}
+
+// estimateTokens approximates the token count of a text (about four characters per token)
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// estimateUsage approximates the tokens exchanged with the LLM for one sample:
+// every function is sent with the fixed prompt and returned rewritten
+func estimateUsage(res *Result, original, rewritten string) {
+	if res.Strategy == StrategyComment || res.Strategy == StrategyNone {
+		return
+	}
+	res.PromptTokens = len(res.Functions)*promptOverheadTokens + estimateTokens(original)
+	res.CompletionTokens = estimateTokens(rewritten)
+}
@@ -0,0 +1,520 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/corpus"
+	"github.com/Hekzory/MetamorphLLM/internal/export"
+	"github.com/Hekzory/MetamorphLLM/internal/metrics"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+	"github.com/Hekzory/MetamorphLLM/internal/telemetry"
+)
+
+// Strategy names understood by DefaultRewriterFactory
+const (
+	StrategyComment    = "comment"
+	StrategyGemini     = "gemini"
+	StrategyOpenRouter = "openrouter"
+	StrategyAnthropic  = "anthropic"
+	StrategyOllama     = "ollama"
+	// StrategyOpenAICompatible uses the server in OPENAI_BASE_URL, such as vLLM or LM Studio
+	StrategyOpenAICompatible = "openai-compatible"
+	// StrategyNone applies the deterministic AST transforms, as a baseline without an LLM
+	StrategyNone = "none"
+	// Free-text variants without JSON-mode responses, for measuring its effect on parse success
+	StrategyGeminiText     = "gemini-text"
+	StrategyOpenRouterText = "openrouter-text"
+	StrategyAnthropicText  = "anthropic-text"
+)
+
+// UnlabelledCategory is used for functions that have no entry in a labels file
+const UnlabelledCategory corpus.Category = "unlabelled"
+
+// RewriterFactory builds a rewriter for a strategy/model pair
+type RewriterFactory func(strategy, model string) (*rewriter.Rewriter, error)
+
+// DefaultRewriterFactory maps strategy names to the rewriters shipped with the
+// project and to the strategies registered with rewriter.RegisterStrategy
+func DefaultRewriterFactory(strategy, model string) (*rewriter.Rewriter, error) {
+	switch strategy {
+	case StrategyComment:
+		return rewriter.NewRewriter(), nil
+	case StrategyGemini:
+		return rewriter.NewLLMRewriterWithModel(rewriter.APITypeGemini, model), nil
+	case StrategyOpenRouter:
+		return rewriter.NewLLMRewriterWithModel(rewriter.APITypeOpenRouter, model), nil
+	case StrategyAnthropic:
+		return rewriter.NewLLMRewriterWithModel(rewriter.APITypeAnthropic, model), nil
+	case StrategyOllama:
+		return rewriter.NewLLMRewriterWithModel(rewriter.APITypeOllama, model), nil
+	case StrategyOpenAICompatible:
+		return rewriter.NewLLMRewriterWithModel(rewriter.APITypeOpenAICompatible, model), nil
+	case StrategyNone:
+		return rewriter.NewLLMRewriterWithModel(rewriter.APITypeNone, model), nil
+	case StrategyGeminiText, StrategyOpenRouterText, StrategyAnthropicText:
+		api := rewriter.APITypeGemini
+		switch strategy {
+		case StrategyOpenRouterText:
+			api = rewriter.APITypeOpenRouter
+		case StrategyAnthropicText:
+			api = rewriter.APITypeAnthropic
+		}
+		r := rewriter.NewLLMRewriterWithModel(api, model)
+		return r, r.SetStructuredOutput(false)
+	default:
+		// Strategies added with rewriter.RegisterStrategy
+		return rewriter.NewStrategyRewriter(strategy, model)
+	}
+}
+
+// Config describes the evaluation matrix
+type Config struct {
+	Strategies []string
+	Models     []string // An empty model name selects the strategy's default model
+	Samples    []string // Paths to corpus Go files
+}
+
+// Case is a single cell of the evaluation matrix
+type Case struct {
+	Strategy string
+	Model    string
+	Sample   string
+}
+
+// FunctionOutcome is the validation result for one function of a sample
+type FunctionOutcome struct {
+	Function      string          `json:"function"`
+	Category      corpus.Category `json:"category"`
+	Found         bool            `json:"found"`          // Function still present in the output
+	SignatureKept bool            `json:"signature_kept"` // Signature unchanged
+	BodyChanged   bool            `json:"body_changed"`   // Body differs from the original
+}
+
+// Accepted reports whether the function was rewritten without breaking its contract
+func (fo FunctionOutcome) Accepted() bool {
+	return fo.Found && fo.SignatureKept && fo.BodyChanged
+}
+
+// Result holds everything collected for one evaluation case
+type Result struct {
+	Strategy  string            `json:"strategy"`
+	Model     string            `json:"model"`
+	Sample    string            `json:"sample"`
+	Parsed    bool              `json:"parsed"` // Rewritten output is valid Go
+	Functions []FunctionOutcome `json:"functions"`
+	Original  *metrics.Metrics  `json:"original,omitempty"`
+	Rewritten *metrics.Metrics  `json:"rewritten,omitempty"`
+	LOCDelta  float64           `json:"loc_delta"`
+	CCDelta   float64           `json:"cc_delta"`
+	CogCDelta float64           `json:"cogc_delta"`
+	Duration  time.Duration     `json:"duration"`
+	Error     string            `json:"error,omitempty"`
+
+	// Static analyzer findings on original vs rewritten source, when analyzers are configured
+	Analysis *AnalyzerReport `json:"analysis,omitempty"`
+
+	// Estimated token usage, see estimateUsage
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// Harness runs the evaluation matrix
+type Harness struct {
+	Config      Config
+	NewRewriter RewriterFactory
+	Analyzers   []StaticAnalyzer      // Optional source-level analyzers run on every parsed rewrite
+	Dataset     *export.DatasetWriter // Optional sink for per-function training records
+}
+
+// NewHarness creates a new Harness using the default rewriter factory
+func NewHarness(cfg Config) *Harness {
+	return &Harness{
+		Config:      cfg,
+		NewRewriter: DefaultRewriterFactory,
+	}
+}
+
+// Cases expands the configuration into the full strategy × model × sample matrix
+func (h *Harness) Cases() []Case {
+	models := h.Config.Models
+	if len(models) == 0 {
+		models = []string{""}
+	}
+
+	var cases []Case
+	for _, strategy := range h.Config.Strategies {
+		for _, model := range models {
+			for _, sample := range h.Config.Samples {
+				cases = append(cases, Case{Strategy: strategy, Model: model, Sample: sample})
+			}
+		}
+	}
+	return cases
+}
+
+// Run evaluates every case of the matrix. Failures are recorded in the results
+// rather than aborting the run.
+func (h *Harness) Run(ctx context.Context) []Result {
+	cases := h.Cases()
+	results := make([]Result, 0, len(cases))
+	for i, c := range cases {
+		fmt.Printf("[%d/%d] Evaluating strategy=%s model=%s sample=%s\n",
+			i+1, len(cases), c.Strategy, displayModel(c.Model), c.Sample)
+		results = append(results, h.RunCase(ctx, c))
+	}
+	return results
+}
+
+// RunCase rewrites one sample and validates the output
+func (h *Harness) RunCase(ctx context.Context, c Case) Result {
+	result, _, _ := h.rewriteCase(ctx, c)
+	return result
+}
+
+// rewriteCase rewrites one sample and validates the output, also returning both sources.
+// The sources are empty when the case failed before rewriting.
+func (h *Harness) rewriteCase(ctx context.Context, c Case) (Result, string, string) {
+	result := Result{Strategy: c.Strategy, Model: c.Model, Sample: c.Sample}
+
+	content, err := os.ReadFile(c.Sample)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to read sample: %v", err)
+		return result, "", ""
+	}
+	original := string(content)
+
+	labels := loadLabels(c.Sample)
+
+	r, err := h.NewRewriter(c.Strategy, c.Model)
+	if err != nil {
+		result.Error = err.Error()
+		return result, original, ""
+	}
+	defer r.Close()
+
+	start := time.Now()
+	rewritten, err := r.RewriteContent(ctx, original)
+	result.Duration = time.Since(start)
+	telemetry.StageDuration.Observe(result.Duration.Seconds(), "rewrite", telemetry.Status(err))
+	if err != nil {
+		result.Error = fmt.Sprintf("rewrite failed: %v", err)
+		return result, original, ""
+	}
+
+	result = validate(result, original, rewritten, labels)
+	estimateUsage(&result, original, rewritten)
+
+	if len(h.Analyzers) > 0 && result.Parsed {
+		result.Analysis = RunAnalyzers(h.Analyzers, original, rewritten)
+	}
+
+	if h.Dataset != nil {
+		if err := writeDataset(h.Dataset, result, original, rewritten); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+	return result, original, rewritten
+}
+
+// validate compares original and rewritten sources and fills in the result
+func validate(result Result, original, rewritten string, labels *corpus.LabelSet) Result {
+	originalFuncs, err := parseFunctions(original)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to parse sample: %v", err)
+		return result
+	}
+
+	rewrittenFuncs, err := parseFunctions(rewritten)
+	result.Parsed = err == nil
+
+	names := make([]string, 0, len(originalFuncs))
+	for name := range originalFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		outcome := FunctionOutcome{Function: name, Category: UnlabelledCategory}
+		if labels != nil {
+			if label, ok := labels.Lookup(name); ok {
+				outcome.Category = label.Category
+			}
+		}
+		if rw, found := rewrittenFuncs[name]; found {
+			orig := originalFuncs[name]
+			outcome.Found = true
+			outcome.SignatureKept = orig.signature == rw.signature
+			outcome.BodyChanged = orig.body != rw.body
+		}
+		result.Functions = append(result.Functions, outcome)
+	}
+
+	if !result.Parsed {
+		return result
+	}
+
+	originalMetrics, err := metrics.CalculateMetricsFromContent(result.Sample, original)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to calculate metrics for original code: %v", err)
+		return result
+	}
+	rewrittenMetrics, err := metrics.CalculateMetricsFromContent(result.Sample, rewritten)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to calculate metrics for rewritten code: %v", err)
+		return result
+	}
+	result.Original = originalMetrics
+	result.Rewritten = rewrittenMetrics
+	delta := metrics.CalculateDeltaMetrics(originalMetrics, rewrittenMetrics)
+	result.LOCDelta, result.CCDelta, result.CogCDelta = delta.LOC.Percent, delta.CC.Percent, delta.CogC.Percent
+
+	return result
+}
+
+// functionSource holds the printed signature and body of a function
+type functionSource struct {
+	signature string
+	body      string
+}
+
+// parseFunctions returns the printed signature and body of every top-level function
+func parseFunctions(content string) (map[string]functionSource, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", content, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	funcs := make(map[string]functionSource)
+	for _, decl := range f.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || funcDecl.Body == nil {
+			continue
+		}
+
+		var sig, body bytes.Buffer
+		if funcDecl.Recv != nil {
+			_ = printer.Fprint(&sig, fset, funcDecl.Recv)
+		}
+		_ = printer.Fprint(&sig, fset, funcDecl.Type)
+		_ = printer.Fprint(&body, fset, funcDecl.Body)
+
+		funcs[export.QualifiedName(funcDecl)] = functionSource{signature: sig.String(), body: body.String()}
+	}
+	return funcs, nil
+}
+
+// writeDataset emits one dataset record per function of the sample
+func writeDataset(dw *export.DatasetWriter, result Result, original, rewritten string) error {
+	originalFuncs, err := export.Functions(original)
+	if err != nil {
+		return fmt.Errorf("failed to extract functions for dataset: %w", err)
+	}
+	rewrittenFuncs := map[string]string{}
+	if result.Parsed {
+		if rewrittenFuncs, err = export.Functions(rewritten); err != nil {
+			return fmt.Errorf("failed to extract rewritten functions for dataset: %w", err)
+		}
+	}
+
+	for _, fo := range result.Functions {
+		rec := export.DatasetRecord{
+			Sample:           result.Sample,
+			Function:         fo.Function,
+			Category:         string(fo.Category),
+			Strategy:         result.Strategy,
+			Model:            ResolveModel(result.Strategy, result.Model),
+			Original:         originalFuncs[fo.Function],
+			Rewritten:        rewrittenFuncs[fo.Function],
+			Parsed:           result.Parsed,
+			SignatureKept:    fo.SignatureKept,
+			BodyChanged:      fo.BodyChanged,
+			Accepted:         fo.Accepted(),
+			OriginalMetrics:  result.Original,
+			RewrittenMetrics: result.Rewritten,
+		}
+		if err := dw.Write(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadLabels loads the labels file next to a sample, if there is one
+func loadLabels(sample string) *corpus.LabelSet {
+	path := corpus.LabelsPathFor(sample)
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	labels, err := corpus.LoadLabels(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring labels for %s: %v\n", sample, err)
+		return nil
+	}
+	return labels
+}
+
+// Row is one line of the aggregate table
+type Row struct {
+	Strategy     string
+	Model        string
+	Category     corpus.Category // Empty when not sliced by category
+	Samples      int
+	Errors       int
+	Functions    int
+	Accepted     int
+	LOCDelta     float64 // Mean over samples with metrics
+	CCDelta      float64
+	CogCDelta    float64
+	MeanDuration time.Duration
+}
+
+// AcceptanceRate returns the percentage of functions that were accepted
+func (r Row) AcceptanceRate() float64 {
+	if r.Functions == 0 {
+		return 0
+	}
+	return float64(r.Accepted) / float64(r.Functions) * 100
+}
+
+// Aggregate groups results per strategy and model, optionally slicing by function category.
+// Metric deltas are whole-file values and are therefore repeated across category slices.
+func Aggregate(results []Result, byCategory bool) []Row {
+	type key struct {
+		strategy, model string
+		category        corpus.Category
+	}
+	type acc struct {
+		row        Row
+		withDelta  int
+		durations  time.Duration
+		seenSample map[string]bool
+	}
+
+	groups := make(map[key]*acc)
+	var order []key
+
+	get := func(k key) *acc {
+		if a, ok := groups[k]; ok {
+			return a
+		}
+		a := &acc{
+			row:        Row{Strategy: k.strategy, Model: k.model, Category: k.category},
+			seenSample: make(map[string]bool),
+		}
+		groups[k] = a
+		order = append(order, k)
+		return a
+	}
+
+	for _, res := range results {
+		categories := []corpus.Category{""}
+		if byCategory {
+			categories = categories[:0]
+			seen := make(map[corpus.Category]bool)
+			for _, fo := range res.Functions {
+				if !seen[fo.Category] {
+					seen[fo.Category] = true
+					categories = append(categories, fo.Category)
+				}
+			}
+			if len(categories) == 0 {
+				// Failed cases have no functions but must still be counted
+				categories = append(categories, "")
+			}
+		}
+
+		for _, category := range categories {
+			a := get(key{res.Strategy, res.Model, category})
+			a.row.Samples++
+			a.durations += res.Duration
+			if res.Error != "" {
+				a.row.Errors++
+			}
+			for _, fo := range res.Functions {
+				if byCategory && fo.Category != category {
+					continue
+				}
+				a.row.Functions++
+				if fo.Accepted() {
+					a.row.Accepted++
+				}
+			}
+			if res.Original != nil && res.Rewritten != nil {
+				a.withDelta++
+				a.row.LOCDelta += res.LOCDelta
+				a.row.CCDelta += res.CCDelta
+				a.row.CogCDelta += res.CogCDelta
+			}
+		}
+	}
+
+	rows := make([]Row, 0, len(order))
+	for _, k := range order {
+		a := groups[k]
+		if a.withDelta > 0 {
+			a.row.LOCDelta /= float64(a.withDelta)
+			a.row.CCDelta /= float64(a.withDelta)
+			a.row.CogCDelta /= float64(a.withDelta)
+		}
+		if a.row.Samples > 0 {
+			a.row.MeanDuration = a.durations / time.Duration(a.row.Samples)
+		}
+		rows = append(rows, a.row)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].Strategy != rows[j].Strategy {
+			return rows[i].Strategy < rows[j].Strategy
+		}
+		if rows[i].Model != rows[j].Model {
+			return rows[i].Model < rows[j].Model
+		}
+		return rows[i].Category < rows[j].Category
+	})
+	return rows
+}
+
+// WriteTable prints the aggregate rows as an aligned text table
+func WriteTable(w io.Writer, rows []Row) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STRATEGY\tMODEL\tCATEGORY\tSAMPLES\tERRORS\tACCEPTED\tRATE\tLOC Δ%\tCC Δ%\tCogC Δ%\tMEAN TIME")
+	for _, r := range rows {
+		category := string(r.Category)
+		if category == "" {
+			category = "all"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d/%d\t%.1f%%\t%.2f\t%.2f\t%.2f\t%v\n",
+			r.Strategy, displayModel(r.Model), category, r.Samples, r.Errors,
+			r.Accepted, r.Functions, r.AcceptanceRate(),
+			r.LOCDelta, r.CCDelta, r.CogCDelta, r.MeanDuration.Round(time.Millisecond))
+	}
+	return tw.Flush()
+}
+
+// displayModel returns a printable model name
+func displayModel(model string) string {
+	if model == "" {
+		return "default"
+	}
+	return model
+}
+
+// WriteJSON writes the raw results as indented JSON
+func WriteJSON(w io.Writer, results []Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
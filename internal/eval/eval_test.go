@@ -0,0 +1,653 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go/ast"
+	"go/token"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/export"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+	"github.com/Hekzory/MetamorphLLM/internal/sandbox"
+)
+
+const sampleCode = `package sample
+
+func Add(a, b int) int {
+	return a + b
+}
+
+func Greet(name string) string {
+	return "hello " + name
+}
+`
+
+const sampleLabels = `{
+  "file": "sample.go",
+  "functions": [
+    {"function": "Add", "category": "computation", "pure": true, "difficulty": "easy"},
+    {"function": "Greet", "category": "string-manipulation", "pure": true, "difficulty": "easy"}
+  ]
+}`
+
+// padStrategy inserts a no-op statement at the start of selected function bodies
+type padStrategy struct {
+	only string
+}
+
+func (ps *padStrategy) Rewrite(_ context.Context, f *ast.File) (bool, error) {
+	changed := false
+	for _, decl := range f.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok && (ps.only == "" || fd.Name.Name == ps.only) {
+			stmt := &ast.AssignStmt{
+				Lhs: []ast.Expr{ast.NewIdent("_")},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{&ast.BasicLit{Kind: token.INT, Value: "0"}},
+			}
+			fd.Body.List = append([]ast.Stmt{stmt}, fd.Body.List...)
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// hotStrategy pads every function only at a temperature of 0.5 or more
+type hotStrategy struct {
+	padStrategy
+	sampling rewriter.Sampling
+}
+
+func (hs *hotStrategy) SetSampling(s rewriter.Sampling) error {
+	hs.sampling = s
+	return nil
+}
+
+func (hs *hotStrategy) Rewrite(ctx context.Context, f *ast.File) (bool, error) {
+	if hs.sampling.Temperature < 0.5 {
+		return false, nil
+	}
+	return hs.padStrategy.Rewrite(ctx, f)
+}
+
+func writeSample(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sample.go")
+	if err := os.WriteFile(path, []byte(sampleCode), 0644); err != nil {
+		t.Fatalf("Failed to write sample: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sample.labels.json"), []byte(sampleLabels), 0644); err != nil {
+		t.Fatalf("Failed to write labels: %v", err)
+	}
+	return path
+}
+
+func testFactory(strategy, model string) (*rewriter.Rewriter, error) {
+	r := rewriter.NewRewriter()
+	switch strategy {
+	case "pad-all":
+		r.SetStrategy(&padStrategy{})
+	case "pad-add":
+		r.SetStrategy(&padStrategy{only: "Add"})
+	case "pad-hot":
+		r.SetStrategy(&hotStrategy{})
+	}
+	return r, nil
+}
+
+func TestCases(t *testing.T) {
+	h := NewHarness(Config{
+		Strategies: []string{"a", "b"},
+		Models:     []string{"m1", "m2", "m3"},
+		Samples:    []string{"x.go", "y.go"},
+	})
+
+	if got := len(h.Cases()); got != 12 {
+		t.Errorf("Expected 12 cases, got %d", got)
+	}
+
+	h.Config.Models = nil
+	if got := len(h.Cases()); got != 4 {
+		t.Errorf("Expected 4 cases with default model, got %d", got)
+	}
+}
+
+func TestRunAndAggregate(t *testing.T) {
+	sample := writeSample(t)
+
+	h := NewHarness(Config{
+		Strategies: []string{"pad-all", "pad-add", StrategyComment, "missing"},
+		Samples:    []string{sample},
+	})
+	h.NewRewriter = func(strategy, model string) (*rewriter.Rewriter, error) {
+		if strategy == "missing" {
+			return DefaultRewriterFactory(strategy, model)
+		}
+		return testFactory(strategy, model)
+	}
+
+	results := h.Run(context.Background())
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 results, got %d", len(results))
+	}
+
+	if results[3].Error == "" {
+		t.Error("Expected an error for an unknown strategy")
+	}
+
+	rows := Aggregate(results, false)
+	rates := make(map[string]float64)
+	for _, r := range rows {
+		rates[r.Strategy] = r.AcceptanceRate()
+	}
+	if rates["pad-all"] != 100 {
+		t.Errorf("Expected pad-all acceptance of 100%%, got %.1f", rates["pad-all"])
+	}
+	if rates["pad-add"] != 50 {
+		t.Errorf("Expected pad-add acceptance of 50%%, got %.1f", rates["pad-add"])
+	}
+	if rates[StrategyComment] != 0 {
+		t.Errorf("Expected comment strategy acceptance of 0%%, got %.1f", rates[StrategyComment])
+	}
+
+	byCategory := Aggregate(results[1:2], true)
+	if len(byCategory) != 2 {
+		t.Fatalf("Expected 2 category rows, got %d", len(byCategory))
+	}
+	for _, r := range byCategory {
+		if r.Category == "computation" && r.Accepted != 1 {
+			t.Errorf("Expected Add to be accepted, got %+v", r)
+		}
+		if r.Category == "string-manipulation" && r.Accepted != 0 {
+			t.Errorf("Expected Greet not to be accepted, got %+v", r)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteTable(&buf, rows); err != nil {
+		t.Fatalf("WriteTable failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "pad-all") {
+		t.Errorf("Expected table to contain strategy names, got:\n%s", buf.String())
+	}
+}
+
+func TestWelchTTest(t *testing.T) {
+	a := Summarize([]float64{1, 2, 3, 4, 5})
+	b := Summarize([]float64{3, 5, 7, 9, 11})
+
+	if a.Mean != 3 || a.Variance != 2.5 {
+		t.Errorf("Unexpected summary for A: %+v", a)
+	}
+
+	tStat, df, p := WelchTTest(a, b)
+	if math.Abs(tStat+2.5298) > 1e-3 {
+		t.Errorf("Expected t ≈ -2.5298, got %.4f", tStat)
+	}
+	if math.Abs(df-5.8824) > 1e-3 {
+		t.Errorf("Expected df ≈ 5.8824, got %.4f", df)
+	}
+	if math.Abs(p-0.0455) > 1e-3 {
+		t.Errorf("Expected p ≈ 0.0455, got %.4f", p)
+	}
+
+	if _, _, p := WelchTTest(Summarize([]float64{1}), b); !math.IsNaN(p) {
+		t.Errorf("Expected NaN p-value for a single observation, got %f", p)
+	}
+}
+
+func TestRunAB(t *testing.T) {
+	sample := writeSample(t)
+
+	h := NewHarness(Config{})
+	h.NewRewriter = testFactory
+
+	a, err := ParseVariant("A", "pad-all")
+	if err != nil {
+		t.Fatalf("ParseVariant failed: %v", err)
+	}
+	b, err := ParseVariant("B", "pad-add:vendor/model:free")
+	if err != nil {
+		t.Fatalf("ParseVariant failed: %v", err)
+	}
+	if b.Strategy != "pad-add" || b.Model != "vendor/model:free" {
+		t.Errorf("Unexpected variant: %+v", b)
+	}
+
+	report, err := h.RunAB(context.Background(), ABConfig{A: a, B: b, Runs: 3, Samples: []string{sample}})
+	if err != nil {
+		t.Fatalf("RunAB failed: %v", err)
+	}
+
+	if len(report.A) != 3 || len(report.B) != 3 {
+		t.Fatalf("Expected 3 observations per variant, got %d and %d", len(report.A), len(report.B))
+	}
+
+	acceptance := report.Comparisons[0]
+	if acceptance.A.Mean != 100 || acceptance.B.Mean != 50 {
+		t.Errorf("Unexpected acceptance means: A=%.1f B=%.1f", acceptance.A.Mean, acceptance.B.Mean)
+	}
+	if !acceptance.Significant(0.05) {
+		t.Errorf("Expected a deterministic 50 point gap to be significant, p=%f", acceptance.P)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteABReport(&buf, report, 0.05); err != nil {
+		t.Fatalf("WriteABReport failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Acceptance rate") {
+		t.Errorf("Expected report to list the acceptance rate, got:\n%s", buf.String())
+	}
+
+	if _, err := h.RunAB(context.Background(), ABConfig{A: a, B: b, Runs: 0, Samples: []string{sample}}); err == nil {
+		t.Error("Expected an error for zero runs")
+	}
+}
+
+func TestHistoryAndLeaderboard(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history", "runs.jsonl")
+
+	fast := Result{
+		Strategy:     StrategyGemini,
+		Functions:    []FunctionOutcome{{Function: "A", Found: true, SignatureKept: true, BodyChanged: true}},
+		Duration:     time.Second,
+		PromptTokens: 1_000_000,
+	}
+	slow := Result{
+		Strategy:  StrategyOpenRouter,
+		Model:     "vendor/model",
+		Functions: []FunctionOutcome{{Function: "A", Found: true}, {Function: "B", Found: true, SignatureKept: true, BodyChanged: true}},
+		Duration:  3 * time.Second,
+	}
+
+	if err := AppendHistory(path, "run-1", []Result{fast, slow}); err != nil {
+		t.Fatalf("AppendHistory failed: %v", err)
+	}
+	if err := AppendHistory(path, "run-2", []Result{fast}); err != nil {
+		t.Fatalf("AppendHistory failed: %v", err)
+	}
+
+	history, err := LoadHistory(path)
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("Expected 3 history entries, got %d", len(history))
+	}
+
+	board, err := Leaderboard(history, DefaultPrices, SortByAcceptance)
+	if err != nil {
+		t.Fatalf("Leaderboard failed: %v", err)
+	}
+	if len(board) != 2 {
+		t.Fatalf("Expected 2 leaderboard entries, got %d", len(board))
+	}
+
+	top := board[0]
+	if top.Provider != StrategyGemini || top.Model != rewriter.DefaultGeminiModel {
+		t.Errorf("Expected gemini with its default model to rank first, got %s/%s", top.Provider, top.Model)
+	}
+	if top.Runs != 2 || top.AcceptanceRate() != 100 {
+		t.Errorf("Unexpected top entry: %+v", top)
+	}
+	if math.Abs(top.CostPerRun-0.15) > 1e-9 {
+		t.Errorf("Expected cost of $0.15 per sample, got %f", top.CostPerRun)
+	}
+	if board[1].CostKnown {
+		t.Error("Expected unknown model price to be flagged")
+	}
+
+	board, err = Leaderboard(history, DefaultPrices, SortByCost)
+	if err != nil {
+		t.Fatalf("Leaderboard failed: %v", err)
+	}
+	if board[0].Provider != StrategyOpenRouter {
+		t.Errorf("Expected cheapest provider first, got %s", board[0].Provider)
+	}
+
+	if _, err := Leaderboard(history, DefaultPrices, "vibes"); err == nil {
+		t.Error("Expected an error for an unknown sort key")
+	}
+
+	var buf bytes.Buffer
+	if err := WriteLeaderboard(&buf, board); err != nil {
+		t.Fatalf("WriteLeaderboard failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "vendor/model") {
+		t.Errorf("Expected leaderboard to list models, got:\n%s", buf.String())
+	}
+}
+
+func TestTradeoff(t *testing.T) {
+	entries := []LeaderboardEntry{
+		{Provider: "cheap", Functions: 10, Accepted: 5, CCDelta: 20, CogCDelta: 20, CostPerRun: 0, MeanLatency: time.Second},
+		{Provider: "strong", Functions: 10, Accepted: 10, CCDelta: 50, CogCDelta: 30, CostPerRun: 0.5, MeanLatency: 2 * time.Second},
+		{Provider: "dominated", Functions: 10, Accepted: 5, CCDelta: 10, CogCDelta: 10, CostPerRun: 0.6, MeanLatency: 3 * time.Second},
+	}
+
+	points := Tradeoff(entries)
+	if points[0].Score != 10 || points[1].Score != 40 {
+		t.Errorf("Unexpected scores: %.2f, %.2f", points[0].Score, points[1].Score)
+	}
+
+	pareto := map[string]bool{}
+	for _, p := range points {
+		pareto[p.Provider] = p.Pareto
+	}
+	if !pareto["cheap"] || !pareto["strong"] || pareto["dominated"] {
+		t.Errorf("Unexpected Pareto frontier: %v", pareto)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteTradeoff(&buf, points); err != nil {
+		t.Fatalf("WriteTradeoff failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "[2]") {
+		t.Errorf("Expected the plot to mark frontier points, got:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteTradeoffCSV(&buf, points); err != nil {
+		t.Fatalf("WriteTradeoffCSV failed: %v", err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 4 {
+		t.Errorf("Expected header and 3 CSV rows, got %d lines", lines)
+	}
+}
+
+// printlnAnalyzer reports one finding per fmt.Println call
+type printlnAnalyzer struct{}
+
+func (printlnAnalyzer) Name() string { return "println" }
+
+func (printlnAnalyzer) Analyze(dir string) ([]Finding, error) {
+	content, err := os.ReadFile(filepath.Join(dir, "sample.go"))
+	if err != nil {
+		return nil, err
+	}
+	var findings []Finding
+	for i := 0; i < strings.Count(string(content), "fmt.Println"); i++ {
+		findings = append(findings, Finding{Tool: "println", Rule: "P001"})
+	}
+	return findings, nil
+}
+
+func TestRunAnalyzers(t *testing.T) {
+	original := "package sample\n\nimport \"fmt\"\n\nfunc A() {\n\tfmt.Println(1)\n}\n"
+	rewritten := "// +build rewritten\n\npackage sample\n\nimport \"fmt\"\n\nfunc A() {\n\tfmt.Println(1)\n\tfmt.Println(2)\n}\n"
+
+	missing, err := NewStaticAnalyzer("semgrep", "")
+	if err != nil {
+		t.Fatalf("NewStaticAnalyzer failed: %v", err)
+	}
+	t.Setenv("PATH", t.TempDir())
+
+	report := RunAnalyzers([]StaticAnalyzer{printlnAnalyzer{}, missing}, original, rewritten)
+	if report.Gained() != 1 || report.Lost() != 0 {
+		t.Errorf("Expected 1 gained and 0 lost findings, got %d and %d", report.Gained(), report.Lost())
+	}
+	if _, ok := report.Errors["semgrep"]; !ok {
+		t.Error("Expected a missing semgrep binary to be reported as an error")
+	}
+
+	if _, err := NewStaticAnalyzer("lint9000", ""); err == nil {
+		t.Error("Expected an error for an unknown analyzer")
+	}
+
+	var buf bytes.Buffer
+	if err := WriteAnalyzerTable(&buf, []Result{{Strategy: "s", Sample: "x.go", Analysis: report}}); err != nil {
+		t.Fatalf("WriteAnalyzerTable failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "gained 1") {
+		t.Errorf("Expected the table to show gained findings, got:\n%s", buf.String())
+	}
+}
+
+func TestStripBuildConstraints(t *testing.T) {
+	src := "//go:build rewritten\n// +build rewritten\n\npackage sample\n"
+	if got := stripBuildConstraints(src); got != "package sample\n" {
+		t.Errorf("Unexpected result: %q", got)
+	}
+}
+
+func TestDatasetExport(t *testing.T) {
+	sample := writeSample(t)
+
+	var buf bytes.Buffer
+	h := NewHarness(Config{Strategies: []string{"pad-add"}, Samples: []string{sample}})
+	h.NewRewriter = testFactory
+	h.Dataset = export.NewDatasetWriter(&buf)
+	h.Run(context.Background())
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected one record per function, got %d", len(lines))
+	}
+
+	var rec export.DatasetRecord
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatalf("Failed to decode record: %v", err)
+	}
+	if rec.Function != "Add" || !rec.Accepted || rec.Category != "computation" {
+		t.Errorf("Unexpected record: %+v", rec)
+	}
+	if !strings.Contains(rec.Rewritten, "_ = 0") || strings.Contains(rec.Original, "_ = 0") {
+		t.Errorf("Expected record to hold both versions, got original %q and rewritten %q", rec.Original, rec.Rewritten)
+	}
+}
+
+func TestTokenSimilarity(t *testing.T) {
+	a := "func Add(a, b int) int { return a + b }"
+	if got := TokenSimilarity(a, a); got != 1 {
+		t.Errorf("Expected identical code to have similarity 1, got %f", got)
+	}
+	if got := TokenSimilarity(a, "// only a comment\n"+a); got != 1 {
+		t.Errorf("Expected comments to be ignored, got %f", got)
+	}
+	if got := TokenSimilarity(a, ""); got != 0 {
+		t.Errorf("Expected similarity 0 against missing output, got %f", got)
+	}
+	if got := TokenSimilarity(a, "func Add(a, b int) int { _ = 0; return a + b }"); got <= 0.5 || got >= 1 {
+		t.Errorf("Expected partial similarity, got %f", got)
+	}
+}
+
+func TestCheckConsistency(t *testing.T) {
+	sample := writeSample(t)
+	h := NewHarness(Config{})
+	h.NewRewriter = testFactory
+
+	variants := []Variant{
+		{Name: "all", Strategy: "pad-all"},
+		{Name: "add", Strategy: "pad-add"},
+	}
+	report, err := h.CheckConsistency(context.Background(), variants, []string{sample})
+	if err != nil {
+		t.Fatalf("CheckConsistency failed: %v", err)
+	}
+	if len(report.Functions) != 2 {
+		t.Fatalf("Expected 2 functions, got %d", len(report.Functions))
+	}
+
+	for _, fc := range report.Functions {
+		switch fc.Function {
+		case "Add":
+			if fc.CompileAgreement() != 2 || fc.MeanSimilarity() != 1 {
+				t.Errorf("Expected both variants to agree on Add, got %d compiling and similarity %f",
+					fc.CompileAgreement(), fc.MeanSimilarity())
+			}
+		case "Greet":
+			if v := fc.Outputs[1].Violations; len(v) != 1 || v[0] != ViolationUnchanged {
+				t.Errorf("Expected pad-add to leave Greet unchanged, got %v", v)
+			}
+			if fc.MeanSimilarity() >= 1 {
+				t.Errorf("Expected Greet outputs to differ, got similarity %f", fc.MeanSimilarity())
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteConsistencyReport(&buf, report); err != nil {
+		t.Fatalf("WriteConsistencyReport failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Per-function agreement") {
+		t.Errorf("Unexpected report:\n%s", buf.String())
+	}
+
+	if _, err := h.CheckConsistency(context.Background(), variants[:1], []string{sample}); err == nil {
+		t.Error("Expected an error for a single variant")
+	}
+
+	// A first variant that fails to parse still lists every function
+	original, err := os.ReadFile(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []Result{{Parsed: false}, {Parsed: true, Functions: []FunctionOutcome{{Function: "Add", Found: true, SignatureKept: true, BodyChanged: true}}}}
+	functions, err := compareOutputs(newTypeChecker(), sample, string(original), variants, results, []string{"", string(original)})
+	if err != nil {
+		t.Fatalf("compareOutputs failed: %v", err)
+	}
+	if len(functions) != 2 {
+		t.Fatalf("Expected 2 functions with a failed first variant, got %d", len(functions))
+	}
+	for _, fc := range functions {
+		if v := fc.Outputs[0].Violations; len(v) != 1 || v[0] != ViolationParse {
+			t.Errorf("Expected a parse violation of the first variant for %s, got %v", fc.Function, v)
+		}
+	}
+}
+
+func TestSweep(t *testing.T) {
+	sample := writeSample(t)
+
+	cells, err := SweepConfig{Models: []string{"a", "b"}, Temperatures: []float64{0, 1}, TopPs: []float64{0.5, 1}}.Cells()
+	if err != nil {
+		t.Fatalf("Cells failed: %v", err)
+	}
+	if len(cells) != 8 || cells[0].Technique != rewriter.TechniqueDeadCode {
+		t.Errorf("Expected 8 dead-code cells, got %+v", cells)
+	}
+	for _, cfg := range []SweepConfig{
+		{Temperatures: []float64{3}},
+		{TopPs: []float64{0}},
+		{Techniques: []string{"renaming"}},
+	} {
+		if _, err := cfg.Cells(); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg)
+		}
+	}
+
+	h := NewHarness(Config{})
+	h.NewRewriter = testFactory
+	report, err := h.RunSweep(context.Background(), SweepConfig{Strategy: "pad-hot", Temperatures: []float64{0.1, 0.9}, Samples: []string{sample}})
+	if err != nil {
+		t.Fatalf("RunSweep failed: %v", err)
+	}
+	if len(report.Cells) != 2 {
+		t.Fatalf("Expected 2 cells, got %d", len(report.Cells))
+	}
+	if cold, hot := report.Cells[0].Row.AcceptanceRate(), report.Cells[1].Row.AcceptanceRate(); cold != 0 || hot != 100 {
+		t.Errorf("Expected 0%% accepted at 0.1 and 100%% at 0.9, got %.1f and %.1f", cold, hot)
+	}
+	if best, _ := report.Best(); best.Cell.Temperature != 0.9 {
+		t.Errorf("Expected the hot cell to be the best, got %s", best.Cell)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSweepReport(&buf, report); err != nil {
+		t.Fatalf("WriteSweepReport failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Best cell: model=default temperature=0.9 top_p=0.9") {
+		t.Errorf("Expected the report to name the best cell, got:\n%s", buf.String())
+	}
+
+	// Strategies without sampling parameters fail every case instead of ignoring the grid
+	report, err = h.RunSweep(context.Background(), SweepConfig{Strategy: "pad-all", Samples: []string{sample}})
+	if err != nil {
+		t.Fatalf("RunSweep failed: %v", err)
+	}
+	if report.Cells[0].Row.Errors != 1 {
+		t.Errorf("Expected the case to fail without sampling support, got %+v", report.Cells[0].Row)
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	// The samples form a module of their own
+	t.Setenv("GOFLAGS", "")
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":                "module corpus\n\ngo 1.21\n",
+		"sum/sum.go":            "//go:build !plan9\n\npackage sum\n\nfunc Sum(items []int) int {\n\ttotal := 0\n\tfor _, item := range items {\n\t\ttotal += item\n\t}\n\treturn total\n}\n",
+		"sum/sum_test.go":       "package sum\n\nimport \"testing\"\n\nfunc TestSum(t *testing.T) {\n\tif Sum([]int{1, 2}) != 3 {\n\t\tt.Fatal(\"wrong sum\")\n\t}\n}\n",
+		"broken/broken.go":      "package broken\n\nfunc Broken() int {\n\treturn \"x\"\n}\n",
+		"testdata/skip/skip.go": "package skip\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := NewHarness(Config{})
+	results, err := h.RunBatch(context.Background(), BatchConfig{
+		Dir:        dir,
+		Strategies: []string{StrategyNone},
+		Runs:       2,
+		Sandbox:    sandbox.Config{Mode: sandbox.ModeNone},
+	})
+	if err != nil {
+		t.Fatalf("RunBatch failed: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("Expected 2 samples × 2 runs, got %d results", len(results))
+	}
+	for _, r := range results {
+		switch filepath.Base(r.Sample) {
+		case "sum":
+			if !r.Succeeded() || !r.Tested || r.Changed != 1 {
+				t.Errorf("Expected sum to be rewritten, compiled and tested, got %+v", r)
+			}
+		case "broken":
+			if r.Compiled || r.Succeeded() || !strings.Contains(r.Error, "build failed") {
+				t.Errorf("Expected the broken sample to fail to build, got %+v", r)
+			}
+		default:
+			t.Errorf("Unexpected sample %s", r.Sample)
+		}
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "sum/sum.go")); string(content) != files["sum/sum.go"] {
+		t.Error("Expected the sample to be left unmodified")
+	}
+
+	rows := AggregateBatch(results)
+	var csvOut bytes.Buffer
+	if err := WriteBatchCSV(&csvOut, rows); err != nil {
+		t.Fatalf("WriteBatchCSV failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(csvOut.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "sample,strategy,model,runs,success_rate") {
+		t.Fatalf("Unexpected CSV:\n%s", csvOut.String())
+	}
+	for _, line := range lines[1:] {
+		fields := strings.Split(line, ",")
+		want := []string{"none", "", "2", "0.00", "0.00", ""}
+		if filepath.Base(fields[0]) == "sum" {
+			want = []string{"none", "", "2", "100.00", "100.00", "100.00"}
+		}
+		if got := fields[1:7]; strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("Expected %v for %s, got %v", want, fields[0], got)
+		}
+	}
+}
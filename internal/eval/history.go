@@ -0,0 +1,80 @@
+package eval
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/redact"
+)
+
+// DefaultHistoryPath is where evaluation results are accumulated between runs
+const DefaultHistoryPath = ".metamorph/history.jsonl"
+
+// HistoryEntry is one evaluation result as stored in the run history
+type HistoryEntry struct {
+	RunID     string    `json:"run_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Result
+}
+
+// AppendHistory appends results to a JSON Lines history file, creating it if needed
+func AppendHistory(path, runID string, results []Result) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer f.Close()
+
+	now := time.Now().UTC()
+	enc := json.NewEncoder(f)
+	for _, res := range results {
+		// History files are shared; provider errors must not carry credentials into them
+		res.Error = redact.String(res.Error)
+		if err := enc.Encode(HistoryEntry{RunID: runID, Timestamp: now, Result: res}); err != nil {
+			return fmt.Errorf("failed to write history entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// LoadHistory reads every entry from a JSON Lines history file
+func LoadHistory(path string) ([]HistoryEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse history line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+	return entries, nil
+}
+
+// NewRunID returns an identifier for a new evaluation run
+func NewRunID() string {
+	return time.Now().UTC().Format("20060102T150405Z")
+}
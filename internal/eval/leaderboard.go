@@ -0,0 +1,153 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Leaderboard sort keys
+const (
+	SortByAcceptance = "acceptance"
+	SortByCost       = "cost"
+	SortByLatency    = "latency"
+	SortByComplexity = "complexity"
+)
+
+// LeaderboardEntry summarizes the accumulated history of one provider/model pair
+type LeaderboardEntry struct {
+	Provider    string
+	Model       string
+	Runs        int
+	Samples     int
+	Functions   int
+	Accepted    int
+	LOCDelta    float64 // Mean over samples with metrics
+	CCDelta     float64
+	CogCDelta   float64
+	CostPerRun  float64 // Mean estimated USD per sample rewrite
+	CostKnown   bool
+	MeanLatency time.Duration
+}
+
+// AcceptanceRate returns the percentage of functions that were accepted
+func (e LeaderboardEntry) AcceptanceRate() float64 {
+	if e.Functions == 0 {
+		return 0
+	}
+	return float64(e.Accepted) / float64(e.Functions) * 100
+}
+
+// Leaderboard ranks provider/model pairs from the run history
+func Leaderboard(history []HistoryEntry, prices PriceTable, sortBy string) ([]LeaderboardEntry, error) {
+	type key struct{ provider, model string }
+	type acc struct {
+		entry     LeaderboardEntry
+		runs      map[string]bool
+		withDelta int
+		latency   time.Duration
+	}
+
+	groups := make(map[key]*acc)
+	for _, h := range history {
+		model := ResolveModel(h.Strategy, h.Model)
+		k := key{h.Strategy, model}
+		a, ok := groups[k]
+		if !ok {
+			a = &acc{
+				entry: LeaderboardEntry{Provider: h.Strategy, Model: model, CostKnown: true},
+				runs:  make(map[string]bool),
+			}
+			groups[k] = a
+		}
+
+		a.runs[h.RunID] = true
+		a.entry.Samples++
+		a.latency += h.Duration
+		for _, fo := range h.Functions {
+			a.entry.Functions++
+			if fo.Accepted() {
+				a.entry.Accepted++
+			}
+		}
+		if h.Original != nil && h.Rewritten != nil {
+			a.withDelta++
+			a.entry.LOCDelta += h.LOCDelta
+			a.entry.CCDelta += h.CCDelta
+			a.entry.CogCDelta += h.CogCDelta
+		}
+		cost, known := prices.Cost(h.Result)
+		a.entry.CostPerRun += cost
+		a.entry.CostKnown = a.entry.CostKnown && known
+	}
+
+	entries := make([]LeaderboardEntry, 0, len(groups))
+	for _, a := range groups {
+		e := a.entry
+		e.Runs = len(a.runs)
+		if a.withDelta > 0 {
+			e.LOCDelta /= float64(a.withDelta)
+			e.CCDelta /= float64(a.withDelta)
+			e.CogCDelta /= float64(a.withDelta)
+		}
+		e.CostPerRun /= float64(e.Samples)
+		e.MeanLatency = a.latency / time.Duration(e.Samples)
+		entries = append(entries, e)
+	}
+
+	var less func(a, b LeaderboardEntry) bool
+	switch sortBy {
+	case SortByAcceptance, "":
+		less = func(a, b LeaderboardEntry) bool { return a.AcceptanceRate() > b.AcceptanceRate() }
+	case SortByCost:
+		less = func(a, b LeaderboardEntry) bool { return a.CostPerRun < b.CostPerRun }
+	case SortByLatency:
+		less = func(a, b LeaderboardEntry) bool { return a.MeanLatency < b.MeanLatency }
+	case SortByComplexity:
+		less = func(a, b LeaderboardEntry) bool { return a.CCDelta+a.CogCDelta > b.CCDelta+b.CogCDelta }
+	default:
+		return nil, fmt.Errorf("unknown sort key %q", sortBy)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if less(entries[i], entries[j]) {
+			return true
+		}
+		if less(entries[j], entries[i]) {
+			return false
+		}
+		// Deterministic tie-break
+		if entries[i].Provider != entries[j].Provider {
+			return entries[i].Provider < entries[j].Provider
+		}
+		return entries[i].Model < entries[j].Model
+	})
+	return entries, nil
+}
+
+// WriteLeaderboard prints the ranked leaderboard
+func WriteLeaderboard(w io.Writer, entries []LeaderboardEntry) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RANK\tPROVIDER\tMODEL\tRUNS\tSAMPLES\tACCEPTANCE\tLOC Δ%\tCC Δ%\tCogC Δ%\tCOST/SAMPLE\tLATENCY")
+	for i, e := range entries {
+		cost := fmt.Sprintf("$%.4f", e.CostPerRun)
+		if !e.CostKnown {
+			cost += "?"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%d\t%.1f%%\t%.2f\t%.2f\t%.2f\t%s\t%v\n",
+			i+1, e.Provider, displayModel(e.Model), e.Runs, e.Samples, e.AcceptanceRate(),
+			e.LOCDelta, e.CCDelta, e.CogCDelta, cost, e.MeanLatency.Round(time.Millisecond))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.CostKnown {
+			fmt.Fprintln(w, "\n? cost includes models missing from the price table (counted as free)")
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package eval
+
+import "math"
+
+// Summary holds descriptive statistics for a sample of observations
+type Summary struct {
+	N        int
+	Mean     float64
+	Variance float64 // Unbiased sample variance
+}
+
+// Summarize computes the mean and unbiased variance of the values
+func Summarize(values []float64) Summary {
+	s := Summary{N: len(values)}
+	if s.N == 0 {
+		return s
+	}
+
+	for _, v := range values {
+		s.Mean += v
+	}
+	s.Mean /= float64(s.N)
+
+	if s.N > 1 {
+		for _, v := range values {
+			d := v - s.Mean
+			s.Variance += d * d
+		}
+		s.Variance /= float64(s.N - 1)
+	}
+	return s
+}
+
+// StdDev returns the sample standard deviation
+func (s Summary) StdDev() float64 {
+	return math.Sqrt(s.Variance)
+}
+
+// WelchTTest performs a two-sided Welch's t-test for a difference in means.
+// It returns the t statistic, the Welch–Satterthwaite degrees of freedom and the p-value.
+// When either sample has fewer than two observations the test is undefined and p is NaN.
+func WelchTTest(a, b Summary) (t, df, p float64) {
+	if a.N < 2 || b.N < 2 {
+		return math.NaN(), math.NaN(), math.NaN()
+	}
+
+	va := a.Variance / float64(a.N)
+	vb := b.Variance / float64(b.N)
+	se := va + vb
+	if se == 0 {
+		// Both samples are constant: identical means are indistinguishable, different means are certain
+		if a.Mean == b.Mean {
+			return 0, math.Inf(1), 1
+		}
+		return math.Copysign(math.Inf(1), a.Mean-b.Mean), math.Inf(1), 0
+	}
+
+	t = (a.Mean - b.Mean) / math.Sqrt(se)
+	df = se * se / (va*va/float64(a.N-1) + vb*vb/float64(b.N-1))
+	p = studentTTwoSided(t, df)
+	return t, df, p
+}
+
+// studentTTwoSided returns P(|T| >= |t|) for a Student t distribution with df degrees of freedom
+func studentTTwoSided(t, df float64) float64 {
+	x := df / (df + t*t)
+	return regularizedIncompleteBeta(df/2, 0.5, x)
+}
+
+// regularizedIncompleteBeta computes I_x(a, b) using the continued fraction expansion
+func regularizedIncompleteBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	lgab, _ := math.Lgamma(a + b)
+	front := math.Exp(lgab - lga - lgb + a*math.Log(x) + b*math.Log(1-x))
+
+	// The continued fraction converges quickly for x < (a+1)/(a+b+2); use symmetry otherwise
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(a, b, x) / a
+	}
+	return 1 - front*betaContinuedFraction(b, a, 1-x)/b
+}
+
+// betaContinuedFraction evaluates the continued fraction for the incomplete beta function (Lentz's method)
+func betaContinuedFraction(a, b, x float64) float64 {
+	const (
+		maxIterations = 200
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+
+	c := 1.0
+	d := 1 - (a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+
+		// Even step
+		num := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+
+		// Odd step
+		num = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return h
+}
@@ -0,0 +1,196 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+// SweepConfig describes a grid of generation parameters tried with one strategy
+type SweepConfig struct {
+	Strategy     string
+	Models       []string  // An empty model name selects the strategy's default model
+	Temperatures []float64 // Defaults to rewriter.DefaultSampling
+	TopPs        []float64 // Defaults to rewriter.DefaultSampling
+	Techniques   []string  // Defaults to rewriter.TechniqueDeadCode
+	Samples      []string  // Corpus files rewritten in every cell
+}
+
+// SweepCell is one configuration of the grid
+type SweepCell struct {
+	Model       string                 `json:"model"`
+	Temperature float64                `json:"temperature"`
+	TopP        float64                `json:"top_p"`
+	Technique   rewriter.TechniqueType `json:"technique"`
+}
+
+// Sampling returns the generation parameters of the cell
+func (c SweepCell) Sampling() rewriter.Sampling {
+	return rewriter.Sampling{Temperature: c.Temperature, TopP: c.TopP}
+}
+
+// String returns a printable description of the cell
+func (c SweepCell) String() string {
+	return fmt.Sprintf("model=%s %s technique=%s", displayModel(c.Model), c.Sampling(), c.Technique)
+}
+
+// SweepResult holds the aggregate and raw results of one cell
+type SweepResult struct {
+	Cell    SweepCell `json:"cell"`
+	Row     Row       `json:"aggregate"`
+	Results []Result  `json:"results"`
+}
+
+// SweepReport holds the results of every cell in grid order
+type SweepReport struct {
+	Strategy string        `json:"strategy"`
+	Samples  []string      `json:"samples"`
+	Cells    []SweepResult `json:"cells"`
+}
+
+// Cells expands the configuration into the model × temperature × top-p ×
+// technique grid and rejects values no cell could run with
+func (cfg SweepConfig) Cells() ([]SweepCell, error) {
+	models := cfg.Models
+	if len(models) == 0 {
+		models = []string{""}
+	}
+	temperatures := cfg.Temperatures
+	if len(temperatures) == 0 {
+		temperatures = []float64{rewriter.DefaultSampling.Temperature}
+	}
+	topPs := cfg.TopPs
+	if len(topPs) == 0 {
+		topPs = []float64{rewriter.DefaultSampling.TopP}
+	}
+	techniques := []rewriter.TechniqueType{rewriter.TechniqueDeadCode}
+	if len(cfg.Techniques) > 0 {
+		techniques = nil
+		for _, name := range cfg.Techniques {
+			technique, err := rewriter.ParseTechnique(name)
+			if err != nil {
+				return nil, err
+			}
+			techniques = append(techniques, technique)
+		}
+	}
+
+	var cells []SweepCell
+	for _, model := range models {
+		for _, temperature := range temperatures {
+			for _, topP := range topPs {
+				for _, technique := range techniques {
+					cell := SweepCell{Model: model, Temperature: temperature, TopP: topP, Technique: technique}
+					if err := cell.Sampling().Validate(); err != nil {
+						return nil, err
+					}
+					cells = append(cells, cell)
+				}
+			}
+		}
+	}
+	return cells, nil
+}
+
+// RunSweep rewrites every sample with every cell of the grid. Failures are
+// recorded in the results rather than aborting the sweep.
+func (h *Harness) RunSweep(ctx context.Context, cfg SweepConfig) (*SweepReport, error) {
+	if cfg.Strategy == "" {
+		return nil, fmt.Errorf("a strategy is required")
+	}
+	if len(cfg.Samples) == 0 {
+		return nil, fmt.Errorf("at least one sample is required")
+	}
+	cells, err := cfg.Cells()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SweepReport{Strategy: cfg.Strategy, Samples: cfg.Samples}
+	for i, cell := range cells {
+		fmt.Printf("[cell %d/%d] %s\n", i+1, len(cells), cell)
+
+		// The cell's parameters are applied to every rewriter the harness creates
+		ch := *h
+		ch.NewRewriter = func(strategy, model string) (*rewriter.Rewriter, error) {
+			r, err := h.NewRewriter(strategy, model)
+			if err != nil {
+				return nil, err
+			}
+			if err := r.SetSampling(cell.Sampling()); err != nil {
+				r.Close()
+				return nil, err
+			}
+			// The default technique needs no support from the strategy
+			if cell.Technique != rewriter.TechniqueDeadCode {
+				if err := r.SetTechniques(cell.Technique); err != nil {
+					r.Close()
+					return nil, err
+				}
+			}
+			return r, nil
+		}
+
+		var results []Result
+		for _, sample := range cfg.Samples {
+			results = append(results, ch.RunCase(ctx, Case{Strategy: cfg.Strategy, Model: cell.Model, Sample: sample}))
+		}
+		result := SweepResult{Cell: cell, Results: results}
+		if rows := Aggregate(results, false); len(rows) > 0 {
+			result.Row = rows[0]
+		}
+		report.Cells = append(report.Cells, result)
+	}
+	return report, nil
+}
+
+// Best returns the cell with the highest acceptance rate, preferring the
+// larger CC growth among equally accepted cells
+func (r *SweepReport) Best() (SweepResult, bool) {
+	if len(r.Cells) == 0 {
+		return SweepResult{}, false
+	}
+	best := r.Cells[0]
+	for _, c := range r.Cells[1:] {
+		rate, bestRate := c.Row.AcceptanceRate(), best.Row.AcceptanceRate()
+		if rate > bestRate || rate == bestRate && c.Row.CCDelta > best.Row.CCDelta {
+			best = c
+		}
+	}
+	return best, true
+}
+
+// WriteSweepReport prints one line per cell with its acceptance rate and metric deltas
+func WriteSweepReport(w io.Writer, report *SweepReport) error {
+	fmt.Fprintf(w, "Strategy: %s, samples per cell: %d\n\n", report.Strategy, len(report.Samples))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODEL\tTEMPERATURE\tTOP-P\tTECHNIQUE\tERRORS\tACCEPTED\tRATE\tLOC Δ%\tCC Δ%\tCogC Δ%\tMEAN TIME")
+	for _, c := range report.Cells {
+		r := c.Row
+		fmt.Fprintf(tw, "%s\t%g\t%g\t%s\t%d\t%d/%d\t%.1f%%\t%.2f\t%.2f\t%.2f\t%v\n",
+			displayModel(c.Cell.Model), c.Cell.Temperature, c.Cell.TopP, c.Cell.Technique, r.Errors,
+			r.Accepted, r.Functions, r.AcceptanceRate(),
+			r.LOCDelta, r.CCDelta, r.CogCDelta, r.MeanDuration.Round(time.Millisecond))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if best, ok := report.Best(); ok {
+		fmt.Fprintf(w, "\nBest cell: %s (%.1f%% accepted, CC Δ %.2f%%)\n", best.Cell, best.Row.AcceptanceRate(), best.Row.CCDelta)
+	}
+	return nil
+}
+
+// WriteSweepJSON writes the sweep report as indented JSON
+func WriteSweepJSON(w io.Writer, report *SweepReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,159 @@
+package eval
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// TradeoffPoint places one configuration in the cost/quality space
+type TradeoffPoint struct {
+	LeaderboardEntry
+	Score  float64 // Obfuscation score, see ObfuscationScore
+	Pareto bool    // Not dominated by any other configuration
+}
+
+// ObfuscationScore combines acceptance and complexity growth into a single number:
+// the fraction of accepted functions times the mean of the CC and CogC deltas.
+// A configuration that rarely produces valid rewrites scores low no matter how
+// complex its few accepted outputs are.
+func ObfuscationScore(e LeaderboardEntry) float64 {
+	return e.AcceptanceRate() / 100 * (e.CCDelta + e.CogCDelta) / 2
+}
+
+// Tradeoff computes the score of every configuration and flags the Pareto frontier
+// (maximal score, minimal cost, minimal latency)
+func Tradeoff(entries []LeaderboardEntry) []TradeoffPoint {
+	points := make([]TradeoffPoint, len(entries))
+	for i, e := range entries {
+		points[i] = TradeoffPoint{LeaderboardEntry: e, Score: ObfuscationScore(e)}
+	}
+
+	for i := range points {
+		points[i].Pareto = true
+		for j := range points {
+			if i != j && dominates(points[j], points[i]) {
+				points[i].Pareto = false
+				break
+			}
+		}
+	}
+	return points
+}
+
+// dominates reports whether a is at least as good as b everywhere and strictly better somewhere
+func dominates(a, b TradeoffPoint) bool {
+	if a.Score < b.Score || a.CostPerRun > b.CostPerRun || a.MeanLatency > b.MeanLatency {
+		return false
+	}
+	return a.Score > b.Score || a.CostPerRun < b.CostPerRun || a.MeanLatency < b.MeanLatency
+}
+
+// WriteTradeoff prints the trade-off table followed by a score-vs-cost scatter plot
+func WriteTradeoff(w io.Writer, points []TradeoffPoint) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tPROVIDER\tMODEL\tSCORE\tCOST/SAMPLE\tLATENCY\tPARETO")
+	for i, p := range points {
+		pareto := ""
+		if p.Pareto {
+			pareto = "*"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%.2f\t$%.4f\t%v\t%s\n",
+			i+1, p.Provider, displayModel(p.Model), p.Score, p.CostPerRun,
+			p.MeanLatency.Round(time.Millisecond), pareto)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nObfuscation score vs estimated cost (Pareto frontier in brackets):")
+	_, err := io.WriteString(w, plotTradeoff(points, 60, 15))
+	return err
+}
+
+// plotTradeoff renders an ASCII scatter plot with cost on the x axis and score on the y axis
+func plotTradeoff(points []TradeoffPoint, width, height int) string {
+	if len(points) == 0 {
+		return "(no data)\n"
+	}
+
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, p := range points {
+		minX, maxX = math.Min(minX, p.CostPerRun), math.Max(maxX, p.CostPerRun)
+		minY, maxY = math.Min(minY, p.Score), math.Max(maxY, p.Score)
+	}
+	if maxX == minX {
+		maxX = minX + 1
+	}
+	if maxY == minY {
+		maxY = minY + 1
+	}
+
+	grid := make([][]string, height)
+	for i := range grid {
+		grid[i] = make([]string, width)
+		for j := range grid[i] {
+			grid[i][j] = " "
+		}
+	}
+
+	for i, p := range points {
+		x := int(math.Round((p.CostPerRun - minX) / (maxX - minX) * float64(width-4)))
+		y := height - 1 - int(math.Round((p.Score-minY)/(maxY-minY)*float64(height-1)))
+		label := strconv.Itoa(i + 1)
+		if p.Pareto {
+			label = "[" + label + "]"
+		}
+		for k, r := range label {
+			if x+k < width {
+				grid[y][x+k] = string(r)
+			}
+		}
+	}
+
+	var b strings.Builder
+	for i, row := range grid {
+		axis := "        "
+		if i == 0 {
+			axis = fmt.Sprintf("%7.2f ", maxY)
+		} else if i == height-1 {
+			axis = fmt.Sprintf("%7.2f ", minY)
+		}
+		b.WriteString(axis + "|" + strings.TrimRight(strings.Join(row, ""), " ") + "\n")
+	}
+	b.WriteString("        +" + strings.Repeat("-", width) + "\n")
+	fmt.Fprintf(&b, "         $%.4f%s$%.4f\n", minX, strings.Repeat(" ", max(1, width-16)), maxX)
+	return b.String()
+}
+
+// WriteTradeoffCSV writes the trade-off points as CSV for external plotting
+func WriteTradeoffCSV(w io.Writer, points []TradeoffPoint) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"provider", "model", "score", "acceptance_rate", "cc_delta", "cogc_delta", "cost_per_sample_usd", "latency_ms", "pareto"}); err != nil {
+		return err
+	}
+	for _, p := range points {
+		record := []string{
+			p.Provider,
+			p.Model,
+			strconv.FormatFloat(p.Score, 'f', 4, 64),
+			strconv.FormatFloat(p.AcceptanceRate(), 'f', 2, 64),
+			strconv.FormatFloat(p.CCDelta, 'f', 2, 64),
+			strconv.FormatFloat(p.CogCDelta, 'f', 2, 64),
+			strconv.FormatFloat(p.CostPerRun, 'f', 6, 64),
+			strconv.FormatInt(p.MeanLatency.Milliseconds(), 10),
+			strconv.FormatBool(p.Pareto),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
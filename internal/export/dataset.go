@@ -0,0 +1,57 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/Hekzory/MetamorphLLM/internal/metrics"
+)
+
+// DatasetRecord is one original/rewritten function pair with its provenance and outcome
+type DatasetRecord struct {
+	Sample    string `json:"sample"`
+	Function  string `json:"function"`
+	Category  string `json:"category,omitempty"`
+	Strategy  string `json:"strategy"`
+	Model     string `json:"model"`
+	Original  string `json:"original"`
+	Rewritten string `json:"rewritten,omitempty"` // Empty when the function is missing from the output
+
+	// Validation outcome
+	Parsed        bool `json:"parsed"`
+	SignatureKept bool `json:"signature_kept"`
+	BodyChanged   bool `json:"body_changed"`
+	Accepted      bool `json:"accepted"`
+
+	// Whole-file metrics of the sample the function belongs to
+	OriginalMetrics  *metrics.Metrics `json:"original_metrics,omitempty"`
+	RewrittenMetrics *metrics.Metrics `json:"rewritten_metrics,omitempty"`
+}
+
+// DatasetWriter writes dataset records as JSON Lines
+type DatasetWriter struct {
+	enc   *json.Encoder
+	count int
+}
+
+// NewDatasetWriter creates a new DatasetWriter
+func NewDatasetWriter(w io.Writer) *DatasetWriter {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &DatasetWriter{enc: enc}
+}
+
+// Write appends one record
+func (dw *DatasetWriter) Write(rec DatasetRecord) error {
+	if err := dw.enc.Encode(rec); err != nil {
+		return fmt.Errorf("failed to write dataset record: %w", err)
+	}
+	dw.count++
+	return nil
+}
+
+// Count returns the number of records written so far
+func (dw *DatasetWriter) Count() int {
+	return dw.count
+}
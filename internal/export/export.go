@@ -0,0 +1,103 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"sort"
+)
+
+// FunctionPair is an original function and its rewritten counterpart
+type FunctionPair struct {
+	Sample    string // Path of the original source file
+	Function  string
+	Original  string // Formatted source without comments
+	Rewritten string
+}
+
+// PairFunctions extracts every function present in both sources whose rewritten
+// version differs from the original. Comments are dropped so that annotations
+// added by the rewriter cannot reveal which version is which.
+func PairFunctions(sample, original, rewritten string) ([]FunctionPair, error) {
+	originalFuncs, err := Functions(original)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse original %s: %w", sample, err)
+	}
+	rewrittenFuncs, err := Functions(rewritten)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rewritten version of %s: %w", sample, err)
+	}
+
+	var pairs []FunctionPair
+	for name, orig := range originalFuncs {
+		rw, ok := rewrittenFuncs[name]
+		if !ok || rw == orig {
+			continue
+		}
+		pairs = append(pairs, FunctionPair{Sample: sample, Function: name, Original: orig, Rewritten: rw})
+	}
+
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Function < pairs[j].Function })
+	return pairs, nil
+}
+
+// Functions returns the formatted, comment-free source of every top-level function,
+// keyed by QualifiedName
+func Functions(content string) (map[string]string, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", content, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	funcs := make(map[string]string)
+	for _, decl := range f.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || funcDecl.Body == nil {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := format.Node(&buf, fset, funcDecl); err != nil {
+			return nil, fmt.Errorf("failed to print function %s: %w", funcDecl.Name.Name, err)
+		}
+		funcs[QualifiedName(funcDecl)] = buf.String()
+	}
+	return funcs, nil
+}
+
+// QualifiedName returns the function name, prefixed with the receiver type for methods
+// (e.g. "Counter.Inc")
+func QualifiedName(funcDecl *ast.FuncDecl) string {
+	if recv := receiverType(funcDecl); recv != "" {
+		return recv + "." + funcDecl.Name.Name
+	}
+	return funcDecl.Name.Name
+}
+
+// receiverType returns the receiver type name of a method, or "" for plain functions
+func receiverType(funcDecl *ast.FuncDecl) string {
+	if funcDecl.Recv == nil || len(funcDecl.Recv.List) == 0 {
+		return ""
+	}
+	expr := funcDecl.Recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.IndexExpr:
+		if id, ok := t.X.(*ast.Ident); ok {
+			return id.Name
+		}
+	case *ast.IndexListExpr:
+		if id, ok := t.X.(*ast.Ident); ok {
+			return id.Name
+		}
+	}
+	return ""
+}
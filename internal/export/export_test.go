@@ -0,0 +1,170 @@
+package export
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const originalCode = `package sample
+
+// Add adds two numbers
+func Add(a, b int) int {
+	return a + b
+}
+
+func Same() {}
+
+func (c *Counter) Inc() {
+	c.n++
+}
+`
+
+const rewrittenCode = `// +build rewritten
+
+package sample
+
+// Add adds two numbers
+// This function was rewritten by MetamorphLLM
+func Add(a, b int) int {
+	unused := a * b
+	_ = unused
+	return a + b
+}
+
+func Same() {}
+
+func (c *Counter) Inc() {
+	c.n += 1
+}
+`
+
+func TestPairFunctions(t *testing.T) {
+	pairs, err := PairFunctions("sample.go", originalCode, rewrittenCode)
+	if err != nil {
+		t.Fatalf("PairFunctions failed: %v", err)
+	}
+
+	if len(pairs) != 2 {
+		t.Fatalf("Expected 2 changed functions, got %d", len(pairs))
+	}
+	if pairs[0].Function != "Add" || pairs[1].Function != "Counter.Inc" {
+		t.Errorf("Unexpected functions: %s, %s", pairs[0].Function, pairs[1].Function)
+	}
+	for _, p := range pairs {
+		if strings.Contains(p.Rewritten, "MetamorphLLM") || strings.Contains(p.Original, "//") {
+			t.Errorf("Expected comments to be stripped from %s", p.Function)
+		}
+	}
+}
+
+func TestBuildStudy(t *testing.T) {
+	var pairs []FunctionPair
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		pairs = append(pairs, FunctionPair{Function: name, Original: "orig-" + name, Rewritten: "rw-" + name})
+	}
+
+	items, key := BuildStudy(pairs, 7, 0)
+	again, _ := BuildStudy(pairs, 7, 0)
+	if len(items) != 6 || len(key) != 6 {
+		t.Fatalf("Expected 6 items, got %d", len(items))
+	}
+
+	for i, item := range items {
+		if item != again[i] {
+			t.Error("Expected the same seed to produce the same packet")
+		}
+		rewritten := item.B
+		if key[i].RewrittenIs == "A" {
+			rewritten = item.A
+		}
+		if rewritten != "rw-"+key[i].Function {
+			t.Errorf("Answer key for %s points at the wrong snippet", item.ID)
+		}
+	}
+
+	if limited, _ := BuildStudy(pairs, 7, 2); len(limited) != 2 {
+		t.Errorf("Expected limit to cap the packet at 2 items, got %d", len(limited))
+	}
+}
+
+func TestWriteStudyAndAnswerKey(t *testing.T) {
+	dir := t.TempDir()
+	studyDir := filepath.Join(dir, "study")
+	items, key := BuildStudy([]FunctionPair{{Function: "Add", Original: "func Add() {}", Rewritten: "func Add() { _ = 1 }"}}, 1, 0)
+
+	if err := WriteStudy(studyDir, items); err != nil {
+		t.Fatalf("WriteStudy failed: %v", err)
+	}
+	for _, name := range []string{"packet.md", "responses.csv", filepath.Join("snippets", "item-001-A.go.txt")} {
+		if _, err := os.Stat(filepath.Join(studyDir, name)); err != nil {
+			t.Errorf("Expected %s to be written: %v", name, err)
+		}
+	}
+
+	if err := WriteAnswerKey(filepath.Join(studyDir, "key.json"), studyDir, key); err == nil {
+		t.Error("Expected the answer key to be refused inside the study directory")
+	}
+	if err := WriteAnswerKey(filepath.Join(studyDir, "..key.json"), studyDir, key); err == nil {
+		t.Error("Expected a key named ..key.json to be refused inside the study directory")
+	}
+	if err := WriteAnswerKey(filepath.Join(dir, "key.json"), studyDir, key); err != nil {
+		t.Errorf("WriteAnswerKey failed: %v", err)
+	}
+}
+
+func TestPatchSeries(t *testing.T) {
+	rewritten := strings.Replace(rewrittenCode, "package sample\n", "package sample\n\nimport \"fmt\"\n", 1) +
+		"\nfunc helper() { fmt.Println() }\n"
+	patches, err := BuildPatchSeries("sample/sample.go", originalCode, rewritten)
+	if err != nil {
+		t.Fatalf("BuildPatchSeries failed: %v", err)
+	}
+	var subjects []string
+	for _, p := range patches {
+		subjects = append(subjects, p.Subject)
+	}
+	want := "Update imports of sample/sample.go|Rewrite Add in sample/sample.go|Rewrite Counter.Inc in sample/sample.go|Add helper to sample/sample.go"
+	if strings.Join(subjects, "|") != want {
+		t.Fatalf("Unexpected series:\n%s", strings.Join(subjects, "\n"))
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	tree := filepath.Join(dir, "tree")
+	if err := os.MkdirAll(filepath.Join(tree, "sample"), 0755); err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	source := filepath.Join(tree, "sample", "sample.go")
+	if err := os.WriteFile(source, []byte(originalCode), 0644); err != nil {
+		t.Fatalf("Failed to write source: %v", err)
+	}
+	patchDir := filepath.Join(dir, "patches")
+	if err := WritePatchSeries(patchDir, patches); err != nil {
+		t.Fatalf("WritePatchSeries failed: %v", err)
+	}
+
+	run := func(script string) string {
+		cmd := exec.Command(filepath.Join(patchDir, script))
+		cmd.Dir = tree
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s failed: %v\n%s", script, err, out)
+		}
+		data, _ := os.ReadFile(source)
+		return string(data)
+	}
+	applied := run("apply.sh")
+	if !strings.Contains(applied, "import \"fmt\"") || !strings.Contains(applied, "c.n += 1") || !strings.HasSuffix(applied, "func helper() { fmt.Println() }\n") {
+		t.Errorf("Unexpected source after apply.sh:\n%s", applied)
+	}
+	if strings.Contains(applied, "+build") {
+		t.Error("Expected the build constraint of the rewrite not to be patched in")
+	}
+	if reverted := run("revert.sh"); reverted != originalCode {
+		t.Errorf("Expected revert.sh to restore the original, got:\n%s", reverted)
+	}
+}
@@ -0,0 +1,276 @@
+package export
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// patchContext is the number of unchanged lines around each hunk
+const patchContext = 3
+
+// Patch is one step of a patch series against a source file
+type Patch struct {
+	Path    string // Slash-separated path the diff applies to
+	Subject string
+	Diff    string // Unified diff in git format
+}
+
+// span is the byte range of a declaration, including its doc comment
+type span struct {
+	start, end int
+}
+
+// BuildPatchSeries turns a rewrite of the file at path into patches that are
+// applied in order: one for the imports, if they changed, then one per changed
+// function in source order, then one per function the rewrite added. Other
+// declarations are left alone, as are functions missing from the rewrite.
+func BuildPatchSeries(path, original, rewritten string) ([]Patch, error) {
+	path = filepath.ToSlash(filepath.Clean(path))
+	rwFile, rwFset, err := parseFile(rewritten)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rewritten version of %s: %w", path, err)
+	}
+	rwImports, rwFuncs, rwOrder := declSpans(rwFile, rwFset)
+	origFile, origFset, err := parseFile(original)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse original %s: %w", path, err)
+	}
+	_, _, origOrder := declSpans(origFile, origFset)
+
+	var patches []Patch
+	current := original
+	// step replaces a range of the current text and records the change as a patch
+	step := func(subject string, at span, replacement string) {
+		next := current[:at.start] + replacement + current[at.end:]
+		if next != current {
+			patches = append(patches, Patch{Path: path, Subject: subject, Diff: unifiedDiff(path, current, next)})
+			current = next
+		}
+	}
+
+	// Imports come first so every later patch compiles on its own
+	f, fset, _ := parseFile(current)
+	imports, _, _ := declSpans(f, fset)
+	newImports := rwImports.text(rewritten)
+	if imports == nil {
+		if newImports != "" {
+			end := fset.Position(f.Name.End()).Offset
+			step("Update imports of "+path, span{end, end}, "\n\n"+newImports)
+		}
+	} else {
+		step("Update imports of "+path, *imports, newImports)
+	}
+
+	for _, name := range origOrder {
+		at, ok := rwFuncs[name]
+		if !ok {
+			continue
+		}
+		// Offsets move with every applied patch, so locate the function again
+		f, fset, err := parseFile(current)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s after patching: %w", path, err)
+		}
+		_, funcs, _ := declSpans(f, fset)
+		step("Rewrite "+name+" in "+path, funcs[name], rewritten[at.start:at.end])
+	}
+
+	known := make(map[string]bool, len(origOrder))
+	for _, name := range origOrder {
+		known[name] = true
+	}
+	for _, name := range rwOrder {
+		if known[name] {
+			continue
+		}
+		at := rwFuncs[name]
+		end := len(strings.TrimRight(current, "\n"))
+		step("Add "+name+" to "+path, span{end, end}, "\n\n"+rewritten[at.start:at.end])
+	}
+	return patches, nil
+}
+
+// parseFile parses Go source with comments
+func parseFile(content string) (*ast.File, *token.FileSet, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", content, parser.ParseComments)
+	return f, fset, err
+}
+
+// declSpans returns the range covering every import declaration (nil if there
+// is none), the range of each function by QualifiedName and their source order
+func declSpans(f *ast.File, fset *token.FileSet) (*span, map[string]span, []string) {
+	var imports *span
+	funcs := make(map[string]span)
+	var order []string
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok != token.IMPORT {
+				continue
+			}
+			start, end := fset.Position(d.Pos()).Offset, fset.Position(d.End()).Offset
+			if d.Doc != nil {
+				start = fset.Position(d.Doc.Pos()).Offset
+			}
+			if imports == nil {
+				imports = &span{start, end}
+			} else {
+				imports.end = end
+			}
+		case *ast.FuncDecl:
+			start := fset.Position(d.Pos()).Offset
+			if d.Doc != nil {
+				start = fset.Position(d.Doc.Pos()).Offset
+			}
+			name := QualifiedName(d)
+			if _, ok := funcs[name]; ok {
+				continue // init functions may repeat; only the first is patched
+			}
+			funcs[name] = span{start, fset.Position(d.End()).Offset}
+			order = append(order, name)
+		}
+	}
+	return imports, funcs, order
+}
+
+// text returns the source of a span, or "" for a nil span
+func (s *span) text(content string) string {
+	if s == nil {
+		return ""
+	}
+	return content[s.start:s.end]
+}
+
+// unifiedDiff returns a git diff of a single-region change from before to after
+func unifiedDiff(path, before, after string) string {
+	a, b := splitLines(before), splitLines(after)
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	start := max(prefix-patchContext, 0)
+	aEnd := min(len(a)-suffix+patchContext, len(a))
+	bEnd := min(len(b)-suffix+patchContext, len(b))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "diff --git a/%s b/%s\n--- a/%s\n+++ b/%s\n", path, path, path, path)
+	fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(start, aEnd-start), hunkRange(start, bEnd-start))
+	for _, line := range a[start:prefix] {
+		writeDiffLine(&sb, ' ', line)
+	}
+	for _, line := range a[prefix : len(a)-suffix] {
+		writeDiffLine(&sb, '-', line)
+	}
+	for _, line := range b[prefix : len(b)-suffix] {
+		writeDiffLine(&sb, '+', line)
+	}
+	for _, line := range a[len(a)-suffix : aEnd] {
+		writeDiffLine(&sb, ' ', line)
+	}
+	return sb.String()
+}
+
+// splitLines splits text into lines that keep their "\n", so a missing final
+// newline stays visible
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// hunkRange formats the 0-based start and length of a hunk side as "line,count"
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// writeDiffLine writes one diff line, marking a missing final newline
+func writeDiffLine(sb *strings.Builder, op byte, line string) {
+	sb.WriteByte(op)
+	sb.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		sb.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+// unsafeFileChars are replaced in patch file names
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// applyScript applies the series listed in the series file in one atomic git apply
+const applyScript = `#!/bin/sh
+# Applies the MetamorphLLM patch series to the working tree. Run it from the
+# directory the patch paths are relative to. Extra arguments are passed to
+# git apply, e.g. --check to only test the series or --index to stage it.
+set -e
+dir=$(cd "$(dirname "$0")" && pwd)
+[ -s "$dir/series" ] || { echo "The series is empty"; exit 0; }
+for patch in $(cat "$dir/series"); do set -- "$@" "$dir/$patch"; done
+git apply "$@"
+`
+
+// revertScript reverses the series in the opposite order
+const revertScript = `#!/bin/sh
+# Reverts the MetamorphLLM patch series applied by apply.sh. Extra arguments
+# are passed to git apply, e.g. --check or --index.
+set -e
+dir=$(cd "$(dirname "$0")" && pwd)
+[ -s "$dir/series" ] || { echo "The series is empty"; exit 0; }
+for patch in $(cat "$dir/series"); do set -- "$dir/$patch" "$@"; done
+git apply -R "$@"
+`
+
+// WritePatchSeries writes the patches as numbered files in the format of git
+// format-patch, a series file listing them in order, and apply.sh and
+// revert.sh scripts that apply or revert the whole series at once
+func WritePatchSeries(dir string, patches []Patch) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create patch directory: %w", err)
+	}
+
+	var series strings.Builder
+	for i, p := range patches {
+		slug := unsafeFileChars.ReplaceAllString(p.Subject, "-")
+		if len(slug) > 52 {
+			slug = slug[:52] // The limit git format-patch uses
+		}
+		name := fmt.Sprintf("%04d-%s.patch", i+1, strings.Trim(slug, "-."))
+		content := fmt.Sprintf("From: MetamorphLLM <metamorph@localhost>\nSubject: [PATCH %d/%d] %s\n\n---\n%s",
+			i+1, len(patches), p.Subject, p.Diff)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write patch: %w", err)
+		}
+		series.WriteString(name + "\n")
+	}
+
+	files := []struct {
+		name    string
+		content string
+		mode    os.FileMode
+	}{
+		{"series", series.String(), 0644},
+		{"apply.sh", applyScript, 0755},
+		{"revert.sh", revertScript, 0755},
+	}
+	for _, file := range files {
+		if err := os.WriteFile(filepath.Join(dir, file.name), []byte(file.content), file.mode); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StudyItem is one blinded pair shown to a participant
+type StudyItem struct {
+	ID string
+	A  string
+	B  string
+}
+
+// AnswerKeyEntry reveals which snippet of a study item is the rewritten one
+type AnswerKeyEntry struct {
+	ID          string `json:"id"`
+	Sample      string `json:"sample"`
+	Function    string `json:"function"`
+	RewrittenIs string `json:"rewritten_is"` // "A" or "B"
+}
+
+// BuildStudy shuffles the pairs and randomly assigns original and rewritten code to
+// positions A and B. The same seed always produces the same packet.
+func BuildStudy(pairs []FunctionPair, seed int64, limit int) ([]StudyItem, []AnswerKeyEntry) {
+	rng := rand.New(rand.NewSource(seed))
+
+	shuffled := make([]FunctionPair, len(pairs))
+	copy(shuffled, pairs)
+	rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	if limit > 0 && limit < len(shuffled) {
+		shuffled = shuffled[:limit]
+	}
+
+	items := make([]StudyItem, 0, len(shuffled))
+	key := make([]AnswerKeyEntry, 0, len(shuffled))
+	for i, p := range shuffled {
+		id := fmt.Sprintf("item-%03d", i+1)
+		item := StudyItem{ID: id, A: p.Original, B: p.Rewritten}
+		rewrittenIs := "B"
+		if rng.Intn(2) == 0 {
+			item.A, item.B = p.Rewritten, p.Original
+			rewrittenIs = "A"
+		}
+		items = append(items, item)
+		key = append(key, AnswerKeyEntry{ID: id, Sample: p.Sample, Function: p.Function, RewrittenIs: rewrittenIs})
+	}
+	return items, key
+}
+
+// WriteStudy writes the participant packet: a Markdown document with every pair,
+// a CSV response sheet and the individual snippets as files
+func WriteStudy(dir string, items []StudyItem) error {
+	if err := os.MkdirAll(filepath.Join(dir, "snippets"), 0755); err != nil {
+		return fmt.Errorf("failed to create study directory: %w", err)
+	}
+
+	var md strings.Builder
+	md.WriteString("# Code Readability Study\n\n")
+	md.WriteString("Each item shows two implementations of the same function. For each item, rate how easy\n")
+	md.WriteString("each snippet is to understand (1 = very hard, 5 = very easy) and answer the questions in\n")
+	md.WriteString("`responses.csv`. Please do not run or search for the code.\n")
+
+	for _, item := range items {
+		fmt.Fprintf(&md, "\n## %s\n\n### Snippet A\n\n```go\n%s\n```\n\n### Snippet B\n\n```go\n%s\n```\n", item.ID, item.A, item.B)
+
+		for label, code := range map[string]string{"A": item.A, "B": item.B} {
+			path := filepath.Join(dir, "snippets", fmt.Sprintf("%s-%s.go.txt", item.ID, label))
+			if err := os.WriteFile(path, []byte(code+"\n"), 0644); err != nil {
+				return fmt.Errorf("failed to write snippet: %w", err)
+			}
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "packet.md"), []byte(md.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write study packet: %w", err)
+	}
+
+	f, err := os.Create(filepath.Join(dir, "responses.csv"))
+	if err != nil {
+		return fmt.Errorf("failed to create response sheet: %w", err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	_ = w.Write([]string{"item", "readability_a", "readability_b", "same_behavior (yes/no/unsure)", "seconds_spent", "notes"})
+	for _, item := range items {
+		_ = w.Write([]string{item.ID, "", "", "", "", ""})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// WriteAnswerKey writes the answer key as JSON. It refuses to place the key inside
+// the participant packet directory so the two can't be shipped together by accident.
+func WriteAnswerKey(path, studyDir string, key []AnswerKeyEntry) error {
+	absKey, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	absDir, err := filepath.Abs(studyDir)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(absDir, absKey); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("answer key %s must not be stored inside the study directory %s", path, studyDir)
+	}
+
+	content, err := json.MarshalIndent(key, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode answer key: %w", err)
+	}
+	return os.WriteFile(path, append(content, '\n'), 0600)
+}
@@ -0,0 +1,268 @@
+// Package grpcapi serves the rewriter over gRPC. The service is defined in
+// proto/metamorph/v1/rewriter.proto; run 'make proto' after changing it.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/Hekzory/MetamorphLLM/internal/grpcapi/metamorphv1"
+	"github.com/Hekzory/MetamorphLLM/internal/metrics"
+	"github.com/Hekzory/MetamorphLLM/internal/redact"
+	"github.com/Hekzory/MetamorphLLM/internal/server"
+)
+
+// Service implements the Rewriter gRPC service on top of the REST server, so
+// both APIs share strategies, limits and the concurrency cap
+type Service struct {
+	pb.UnimplementedRewriterServer
+	Server *server.Server
+}
+
+// New creates a service backed by s
+func New(s *server.Server) *Service {
+	return &Service{Server: s}
+}
+
+// Rewrite rewrites one Go file
+func (svc *Service) Rewrite(ctx context.Context, req *pb.RewriteRequest) (*pb.RewriteResponse, error) {
+	if err := svc.checkSize(len(req.Source)); err != nil {
+		return nil, err
+	}
+	if err := svc.Server.Admit(ctx); err != nil {
+		return nil, statusError(codes.ResourceExhausted, err)
+	}
+	rw, err := svc.Server.Prepare(ctx, req.Source, req.Strategy, req.Model)
+	if err != nil {
+		return nil, statusError(codes.InvalidArgument, err)
+	}
+	result, err := svc.Server.Run(ctx, rw, req.Source, nil)
+	if err != nil {
+		return nil, statusError(codes.Unavailable, err)
+	}
+	return toResponse(result), nil
+}
+
+// RewritePackage rewrites every file of a package; a file that fails does not
+// fail the others
+func (svc *Service) RewritePackage(ctx context.Context, req *pb.RewritePackageRequest) (*pb.RewritePackageResponse, error) {
+	return svc.rewritePackage(ctx, req, nil)
+}
+
+// StreamProgress rewrites a package like RewritePackage and streams an event as
+// each file starts and finishes, then the full response
+func (svc *Service) StreamProgress(req *pb.RewritePackageRequest, stream pb.Rewriter_StreamProgressServer) error {
+	resp, err := svc.rewritePackage(stream.Context(), req, stream.Send)
+	if err != nil {
+		return err
+	}
+	return stream.Send(&pb.ProgressEvent{
+		Kind:     pb.ProgressEvent_KIND_PACKAGE_FINISHED,
+		Done:     int32(len(resp.Files)),
+		Total:    int32(len(resp.Files)),
+		Response: resp,
+	})
+}
+
+// GetMetrics computes the code metrics of a file without rewriting it
+func (svc *Service) GetMetrics(ctx context.Context, req *pb.GetMetricsRequest) (*pb.GetMetricsResponse, error) {
+	if err := svc.checkSize(len(req.Source)); err != nil {
+		return nil, err
+	}
+	m, err := metrics.CalculateMetricsFromContent("source.go", req.Source)
+	if err != nil {
+		return nil, statusError(codes.InvalidArgument, fmt.Errorf("source is not a valid Go file: %w", err))
+	}
+	return &pb.GetMetricsResponse{Metrics: toFileMetrics(server.NewFileMetrics(m))}, nil
+}
+
+// rewritePackage rewrites the files concurrently, bounded by the server's
+// concurrency limit. If send is not nil it receives started and finished
+// events; a send error (the client went away) skips the files not yet started.
+func (svc *Service) rewritePackage(ctx context.Context, req *pb.RewritePackageRequest, send func(*pb.ProgressEvent) error) (*pb.RewritePackageResponse, error) {
+	if err := validateFiles(req.Files); err != nil {
+		return nil, statusError(codes.InvalidArgument, err)
+	}
+	total := 0
+	for _, f := range req.Files {
+		total += len(f.Source)
+	}
+	if err := svc.checkSize(total); err != nil {
+		return nil, err
+	}
+	// A package counts as one request against the tenant's rate quota
+	if err := svc.Server.Admit(ctx); err != nil {
+		return nil, statusError(codes.ResourceExhausted, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu      sync.Mutex
+		done    int
+		sendErr error
+	)
+	emit := func(kind pb.ProgressEvent_Kind, file string, result *pb.FileResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		if kind == pb.ProgressEvent_KIND_FILE_FINISHED {
+			done++
+		}
+		if send != nil && sendErr == nil {
+			sendErr = send(&pb.ProgressEvent{Kind: kind, File: file, Done: int32(done), Total: int32(len(req.Files)), Result: result})
+			if sendErr != nil {
+				cancel()
+			}
+		}
+	}
+
+	results := make([]*pb.FileResult, len(req.Files))
+	var wg sync.WaitGroup
+	for i, f := range req.Files {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := &pb.FileResult{Name: f.Name}
+			results[i] = result
+			if ctx.Err() != nil {
+				result.Error = ctx.Err().Error()
+				return
+			}
+
+			rw, err := svc.Server.Prepare(ctx, f.Source, req.Strategy, req.Model)
+			if err == nil {
+				var rewritten *server.RewriteResult
+				rewritten, err = svc.Server.Run(ctx, rw, f.Source, func() {
+					emit(pb.ProgressEvent_KIND_FILE_STARTED, f.Name, nil)
+				})
+				if err == nil {
+					result.Result = toResponse(rewritten)
+				}
+			}
+			if err != nil {
+				result.Error = redact.String(err.Error())
+			}
+			emit(pb.ProgressEvent_KIND_FILE_FINISHED, f.Name, result)
+		}()
+	}
+	wg.Wait()
+
+	if sendErr != nil {
+		return nil, sendErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	return &pb.RewritePackageResponse{Files: results}, nil
+}
+
+// UnaryInterceptor authenticates unary calls with the API key of one of the
+// server's tenants, like the REST API. Without tenants it accepts every call.
+func UnaryInterceptor(s *server.Server) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticate(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor authenticates streaming calls like UnaryInterceptor
+func StreamInterceptor(s *server.Server) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(stream.Context(), s)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &tenantStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// tenantStream is a stream whose context carries the caller's tenant
+type tenantStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ts *tenantStream) Context() context.Context {
+	return ts.ctx
+}
+
+// authenticate reads the API key from the "authorization: Bearer <key>" or
+// "x-api-key" metadata and adds the tenant it belongs to to ctx
+func authenticate(ctx context.Context, s *server.Server) (context.Context, error) {
+	if len(s.Tenants) == 0 {
+		return ctx, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	var key string
+	if values := md.Get("authorization"); len(values) > 0 {
+		key = server.BearerToken(values[0])
+	}
+	if values := md.Get("x-api-key"); key == "" && len(values) > 0 {
+		key = values[0]
+	}
+	t, err := s.Authenticate(key)
+	if err != nil {
+		return nil, statusError(codes.Unauthenticated, err)
+	}
+	return server.WithTenant(ctx, t), nil
+}
+
+// validateFiles requires at least one file and unique .go file names
+func validateFiles(files []*pb.SourceFile) error {
+	if len(files) == 0 {
+		return errors.New("no files to rewrite")
+	}
+	seen := make(map[string]bool, len(files))
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name, ".go") || strings.ContainsAny(f.Name, `/\`) {
+			return fmt.Errorf("invalid file name %q: expected a .go file name without directories", f.Name)
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("duplicate file %q", f.Name)
+		}
+		seen[f.Name] = true
+	}
+	return nil
+}
+
+// checkSize applies the server's source size limit, as the REST API does for request bodies
+func (svc *Service) checkSize(n int) error {
+	if int64(n) > svc.Server.MaxSourceBytes {
+		return status.Errorf(codes.ResourceExhausted, "source exceeds %d bytes", svc.Server.MaxSourceBytes)
+	}
+	return nil
+}
+
+// statusError converts err to a gRPC status, redacted like every other error the tools print
+func statusError(code codes.Code, err error) error {
+	return status.Error(code, redact.String(err.Error()))
+}
+
+func toResponse(r *server.RewriteResult) *pb.RewriteResponse {
+	resp := &pb.RewriteResponse{Rewritten: r.Rewritten, Changed: r.Changed}
+	if r.Metrics != nil {
+		resp.Metrics = &pb.MetricsReport{
+			Original:         toFileMetrics(r.Metrics.Original),
+			Rewritten:        toFileMetrics(r.Metrics.Rewritten),
+			LocDeltaPercent:  r.Metrics.LOCDelta,
+			CcDeltaPercent:   r.Metrics.CCDelta,
+			CogcDeltaPercent: r.Metrics.CogCDelta,
+		}
+	}
+	return resp
+}
+
+func toFileMetrics(m server.FileMetrics) *pb.FileMetrics {
+	return &pb.FileMetrics{Loc: int32(m.LOC), Cc: int32(m.CC), Cogc: int32(m.CogC), Functions: int32(m.Functions)}
+}
@@ -0,0 +1,174 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/Hekzory/MetamorphLLM/internal/eval"
+	pb "github.com/Hekzory/MetamorphLLM/internal/grpcapi/metamorphv1"
+	"github.com/Hekzory/MetamorphLLM/internal/server"
+)
+
+const source = "package p\n\nfunc add(a, b int) int {\n\tif a > b {\n\t\treturn a + b\n\t}\n\treturn b + a\n}\n"
+
+// dial serves a comment-strategy service over an in-memory connection
+func dial(t *testing.T) pb.RewriterClient {
+	t.Helper()
+	return dialServer(t, server.New(eval.StrategyComment, 2))
+}
+
+// dialServer serves s, with the authentication interceptors, over an in-memory connection
+func dialServer(t *testing.T, s *server.Server) pb.RewriterClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(grpc.UnaryInterceptor(UnaryInterceptor(s)), grpc.StreamInterceptor(StreamInterceptor(s)))
+	pb.RegisterRewriterServer(srv, New(s))
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewRewriterClient(conn)
+}
+
+// TestRewrite tests single-file rewrites, metrics and argument validation
+func TestRewrite(t *testing.T) {
+	client := dial(t)
+	ctx := context.Background()
+
+	resp, err := client.Rewrite(ctx, &pb.RewriteRequest{Source: source})
+	if err != nil {
+		t.Fatalf("Rewrite failed: %v", err)
+	}
+	if !resp.Changed || !strings.Contains(resp.Rewritten, "package p") {
+		t.Errorf("Unexpected response: %v", resp)
+	}
+	if resp.Metrics.GetOriginal().GetFunctions() != 1 {
+		t.Errorf("Expected metrics of the original source, got %v", resp.Metrics)
+	}
+
+	metrics, err := client.GetMetrics(ctx, &pb.GetMetricsRequest{Source: source})
+	if err != nil || metrics.Metrics.GetCc() == 0 {
+		t.Errorf("Expected metrics, got %v (%v)", metrics, err)
+	}
+
+	cases := []struct {
+		name string
+		call func() error
+	}{
+		{"invalid Go", func() error {
+			_, err := client.Rewrite(ctx, &pb.RewriteRequest{Source: "package p\nfunc {"})
+			return err
+		}},
+		{"unknown strategy", func() error {
+			_, err := client.Rewrite(ctx, &pb.RewriteRequest{Source: source, Strategy: "oracle"})
+			return err
+		}},
+		{"metrics of invalid Go", func() error {
+			_, err := client.GetMetrics(ctx, &pb.GetMetricsRequest{Source: "func {"})
+			return err
+		}},
+		{"duplicate file", func() error {
+			file := &pb.SourceFile{Name: "a.go", Source: source}
+			_, err := client.RewritePackage(ctx, &pb.RewritePackageRequest{Files: []*pb.SourceFile{file, file}})
+			return err
+		}},
+	}
+	for _, c := range cases {
+		if code := status.Code(c.call()); code != codes.InvalidArgument {
+			t.Errorf("%s: expected InvalidArgument, got %v", c.name, code)
+		}
+	}
+}
+
+// TestStreamProgress tests that every file is reported and a bad file does not fail the package
+func TestStreamProgress(t *testing.T) {
+	client := dial(t)
+	req := &pb.RewritePackageRequest{Files: []*pb.SourceFile{
+		{Name: "a.go", Source: source},
+		{Name: "b.go", Source: "package p\nfunc {"},
+		{Name: "c.go", Source: source},
+	}}
+
+	stream, err := client.StreamProgress(context.Background(), req)
+	if err != nil {
+		t.Fatalf("StreamProgress failed: %v", err)
+	}
+	var finished []string
+	var last *pb.ProgressEvent
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if event.Kind == pb.ProgressEvent_KIND_FILE_FINISHED {
+			finished = append(finished, event.File)
+			if int(event.Done) != len(finished) || event.Total != 3 {
+				t.Errorf("Unexpected progress %d/%d after %d files", event.Done, event.Total, len(finished))
+			}
+		}
+		last = event
+	}
+	if len(finished) != 3 {
+		t.Errorf("Expected 3 finished files, got %v", finished)
+	}
+	if last.GetKind() != pb.ProgressEvent_KIND_PACKAGE_FINISHED {
+		t.Fatalf("Expected the package result last, got %v", last)
+	}
+
+	files := last.Response.Files
+	if len(files) != 3 || files[0].Name != "a.go" || files[1].Name != "b.go" {
+		t.Fatalf("Expected results in request order, got %v", files)
+	}
+	if files[0].Result == nil || files[2].Result == nil || files[1].Error == "" || files[1].Result != nil {
+		t.Errorf("Expected b.go alone to fail, got %v", files)
+	}
+}
+
+// TestAuthentication tests that calls need a tenant's API key and count against its quota
+func TestAuthentication(t *testing.T) {
+	sum := sha256.Sum256([]byte("alpha-key"))
+	s := server.New(eval.StrategyComment, 2)
+	s.Tenants = []*server.Tenant{{Name: "alpha", KeySHA256: hex.EncodeToString(sum[:]), RequestsPerMinute: 1}}
+	client := dialServer(t, s)
+	req := &pb.RewritePackageRequest{Files: []*pb.SourceFile{{Name: "a.go", Source: source}}}
+
+	if _, err := client.Rewrite(context.Background(), &pb.RewriteRequest{Source: source}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated without a key, got %v", err)
+	}
+	stream, err := client.StreamProgress(metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "beta-key"), req)
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated for an unknown key, got %v", err)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer alpha-key")
+	if _, err := client.RewritePackage(ctx, req); err != nil {
+		t.Fatalf("RewritePackage failed: %v", err)
+	}
+	if _, err := client.Rewrite(ctx, &pb.RewriteRequest{Source: source}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected ResourceExhausted past the rate quota, got %v", err)
+	}
+}
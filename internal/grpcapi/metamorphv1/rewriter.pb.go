@@ -0,0 +1,881 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v5.29.3
+// source: metamorph/v1/rewriter.proto
+
+// gRPC API of the MetamorphLLM rewriter, served by 'metamorph serve -grpc-addr'.
+
+package metamorphv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ProgressEvent_Kind int32
+
+const (
+	ProgressEvent_KIND_UNSPECIFIED      ProgressEvent_Kind = 0
+	ProgressEvent_KIND_FILE_STARTED     ProgressEvent_Kind = 1
+	ProgressEvent_KIND_FILE_FINISHED    ProgressEvent_Kind = 2
+	ProgressEvent_KIND_PACKAGE_FINISHED ProgressEvent_Kind = 3
+)
+
+// Enum value maps for ProgressEvent_Kind.
+var (
+	ProgressEvent_Kind_name = map[int32]string{
+		0: "KIND_UNSPECIFIED",
+		1: "KIND_FILE_STARTED",
+		2: "KIND_FILE_FINISHED",
+		3: "KIND_PACKAGE_FINISHED",
+	}
+	ProgressEvent_Kind_value = map[string]int32{
+		"KIND_UNSPECIFIED":      0,
+		"KIND_FILE_STARTED":     1,
+		"KIND_FILE_FINISHED":    2,
+		"KIND_PACKAGE_FINISHED": 3,
+	}
+)
+
+func (x ProgressEvent_Kind) Enum() *ProgressEvent_Kind {
+	p := new(ProgressEvent_Kind)
+	*p = x
+	return p
+}
+
+func (x ProgressEvent_Kind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ProgressEvent_Kind) Descriptor() protoreflect.EnumDescriptor {
+	return file_metamorph_v1_rewriter_proto_enumTypes[0].Descriptor()
+}
+
+func (ProgressEvent_Kind) Type() protoreflect.EnumType {
+	return &file_metamorph_v1_rewriter_proto_enumTypes[0]
+}
+
+func (x ProgressEvent_Kind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ProgressEvent_Kind.Descriptor instead.
+func (ProgressEvent_Kind) EnumDescriptor() ([]byte, []int) {
+	return file_metamorph_v1_rewriter_proto_rawDescGZIP(), []int{10, 0}
+}
+
+type RewriteRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Complete Go source file.
+	Source string `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
+	// Strategy name (comment, gemini, openrouter, gemini-text, openrouter-text).
+	// Empty selects the server's default strategy.
+	Strategy string `protobuf:"bytes,2,opt,name=strategy,proto3" json:"strategy,omitempty"`
+	// Model name. Empty selects the strategy's default model.
+	Model         string `protobuf:"bytes,3,opt,name=model,proto3" json:"model,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RewriteRequest) Reset() {
+	*x = RewriteRequest{}
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RewriteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RewriteRequest) ProtoMessage() {}
+
+func (x *RewriteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RewriteRequest.ProtoReflect.Descriptor instead.
+func (*RewriteRequest) Descriptor() ([]byte, []int) {
+	return file_metamorph_v1_rewriter_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *RewriteRequest) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *RewriteRequest) GetStrategy() string {
+	if x != nil {
+		return x.Strategy
+	}
+	return ""
+}
+
+func (x *RewriteRequest) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+type FileMetrics struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Loc           int32                  `protobuf:"varint,1,opt,name=loc,proto3" json:"loc,omitempty"`
+	Cc            int32                  `protobuf:"varint,2,opt,name=cc,proto3" json:"cc,omitempty"`
+	Cogc          int32                  `protobuf:"varint,3,opt,name=cogc,proto3" json:"cogc,omitempty"`
+	Functions     int32                  `protobuf:"varint,4,opt,name=functions,proto3" json:"functions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileMetrics) Reset() {
+	*x = FileMetrics{}
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileMetrics) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileMetrics) ProtoMessage() {}
+
+func (x *FileMetrics) ProtoReflect() protoreflect.Message {
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileMetrics.ProtoReflect.Descriptor instead.
+func (*FileMetrics) Descriptor() ([]byte, []int) {
+	return file_metamorph_v1_rewriter_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *FileMetrics) GetLoc() int32 {
+	if x != nil {
+		return x.Loc
+	}
+	return 0
+}
+
+func (x *FileMetrics) GetCc() int32 {
+	if x != nil {
+		return x.Cc
+	}
+	return 0
+}
+
+func (x *FileMetrics) GetCogc() int32 {
+	if x != nil {
+		return x.Cogc
+	}
+	return 0
+}
+
+func (x *FileMetrics) GetFunctions() int32 {
+	if x != nil {
+		return x.Functions
+	}
+	return 0
+}
+
+type MetricsReport struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Original         *FileMetrics           `protobuf:"bytes,1,opt,name=original,proto3" json:"original,omitempty"`
+	Rewritten        *FileMetrics           `protobuf:"bytes,2,opt,name=rewritten,proto3" json:"rewritten,omitempty"`
+	LocDeltaPercent  float64                `protobuf:"fixed64,3,opt,name=loc_delta_percent,json=locDeltaPercent,proto3" json:"loc_delta_percent,omitempty"`
+	CcDeltaPercent   float64                `protobuf:"fixed64,4,opt,name=cc_delta_percent,json=ccDeltaPercent,proto3" json:"cc_delta_percent,omitempty"`
+	CogcDeltaPercent float64                `protobuf:"fixed64,5,opt,name=cogc_delta_percent,json=cogcDeltaPercent,proto3" json:"cogc_delta_percent,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *MetricsReport) Reset() {
+	*x = MetricsReport{}
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricsReport) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricsReport) ProtoMessage() {}
+
+func (x *MetricsReport) ProtoReflect() protoreflect.Message {
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricsReport.ProtoReflect.Descriptor instead.
+func (*MetricsReport) Descriptor() ([]byte, []int) {
+	return file_metamorph_v1_rewriter_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *MetricsReport) GetOriginal() *FileMetrics {
+	if x != nil {
+		return x.Original
+	}
+	return nil
+}
+
+func (x *MetricsReport) GetRewritten() *FileMetrics {
+	if x != nil {
+		return x.Rewritten
+	}
+	return nil
+}
+
+func (x *MetricsReport) GetLocDeltaPercent() float64 {
+	if x != nil {
+		return x.LocDeltaPercent
+	}
+	return 0
+}
+
+func (x *MetricsReport) GetCcDeltaPercent() float64 {
+	if x != nil {
+		return x.CcDeltaPercent
+	}
+	return 0
+}
+
+func (x *MetricsReport) GetCogcDeltaPercent() float64 {
+	if x != nil {
+		return x.CogcDeltaPercent
+	}
+	return 0
+}
+
+type RewriteResponse struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Rewritten string                 `protobuf:"bytes,1,opt,name=rewritten,proto3" json:"rewritten,omitempty"`
+	Changed   bool                   `protobuf:"varint,2,opt,name=changed,proto3" json:"changed,omitempty"`
+	// Unset if the rewritten source does not parse.
+	Metrics       *MetricsReport `protobuf:"bytes,3,opt,name=metrics,proto3" json:"metrics,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RewriteResponse) Reset() {
+	*x = RewriteResponse{}
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RewriteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RewriteResponse) ProtoMessage() {}
+
+func (x *RewriteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RewriteResponse.ProtoReflect.Descriptor instead.
+func (*RewriteResponse) Descriptor() ([]byte, []int) {
+	return file_metamorph_v1_rewriter_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *RewriteResponse) GetRewritten() string {
+	if x != nil {
+		return x.Rewritten
+	}
+	return ""
+}
+
+func (x *RewriteResponse) GetChanged() bool {
+	if x != nil {
+		return x.Changed
+	}
+	return false
+}
+
+func (x *RewriteResponse) GetMetrics() *MetricsReport {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+type SourceFile struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// File name within the package, e.g. "parse.go".
+	Name          string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Source        string `protobuf:"bytes,2,opt,name=source,proto3" json:"source,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SourceFile) Reset() {
+	*x = SourceFile{}
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SourceFile) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SourceFile) ProtoMessage() {}
+
+func (x *SourceFile) ProtoReflect() protoreflect.Message {
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SourceFile.ProtoReflect.Descriptor instead.
+func (*SourceFile) Descriptor() ([]byte, []int) {
+	return file_metamorph_v1_rewriter_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SourceFile) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SourceFile) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+type RewritePackageRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Files         []*SourceFile          `protobuf:"bytes,1,rep,name=files,proto3" json:"files,omitempty"`
+	Strategy      string                 `protobuf:"bytes,2,opt,name=strategy,proto3" json:"strategy,omitempty"`
+	Model         string                 `protobuf:"bytes,3,opt,name=model,proto3" json:"model,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RewritePackageRequest) Reset() {
+	*x = RewritePackageRequest{}
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RewritePackageRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RewritePackageRequest) ProtoMessage() {}
+
+func (x *RewritePackageRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RewritePackageRequest.ProtoReflect.Descriptor instead.
+func (*RewritePackageRequest) Descriptor() ([]byte, []int) {
+	return file_metamorph_v1_rewriter_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *RewritePackageRequest) GetFiles() []*SourceFile {
+	if x != nil {
+		return x.Files
+	}
+	return nil
+}
+
+func (x *RewritePackageRequest) GetStrategy() string {
+	if x != nil {
+		return x.Strategy
+	}
+	return ""
+}
+
+func (x *RewritePackageRequest) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+type FileResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// Set if the file was rewritten.
+	Result *RewriteResponse `protobuf:"bytes,2,opt,name=result,proto3" json:"result,omitempty"`
+	// Set if the file could not be rewritten; the other files are unaffected.
+	Error         string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileResult) Reset() {
+	*x = FileResult{}
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileResult) ProtoMessage() {}
+
+func (x *FileResult) ProtoReflect() protoreflect.Message {
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileResult.ProtoReflect.Descriptor instead.
+func (*FileResult) Descriptor() ([]byte, []int) {
+	return file_metamorph_v1_rewriter_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *FileResult) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *FileResult) GetResult() *RewriteResponse {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *FileResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type RewritePackageResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Files         []*FileResult          `protobuf:"bytes,1,rep,name=files,proto3" json:"files,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RewritePackageResponse) Reset() {
+	*x = RewritePackageResponse{}
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RewritePackageResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RewritePackageResponse) ProtoMessage() {}
+
+func (x *RewritePackageResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RewritePackageResponse.ProtoReflect.Descriptor instead.
+func (*RewritePackageResponse) Descriptor() ([]byte, []int) {
+	return file_metamorph_v1_rewriter_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *RewritePackageResponse) GetFiles() []*FileResult {
+	if x != nil {
+		return x.Files
+	}
+	return nil
+}
+
+type GetMetricsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Source        string                 `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetMetricsRequest) Reset() {
+	*x = GetMetricsRequest{}
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMetricsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMetricsRequest) ProtoMessage() {}
+
+func (x *GetMetricsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMetricsRequest.ProtoReflect.Descriptor instead.
+func (*GetMetricsRequest) Descriptor() ([]byte, []int) {
+	return file_metamorph_v1_rewriter_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *GetMetricsRequest) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+type GetMetricsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Metrics       *FileMetrics           `protobuf:"bytes,1,opt,name=metrics,proto3" json:"metrics,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetMetricsResponse) Reset() {
+	*x = GetMetricsResponse{}
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMetricsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMetricsResponse) ProtoMessage() {}
+
+func (x *GetMetricsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMetricsResponse.ProtoReflect.Descriptor instead.
+func (*GetMetricsResponse) Descriptor() ([]byte, []int) {
+	return file_metamorph_v1_rewriter_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *GetMetricsResponse) GetMetrics() *FileMetrics {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+type ProgressEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Kind  ProgressEvent_Kind     `protobuf:"varint,1,opt,name=kind,proto3,enum=metamorph.v1.ProgressEvent_Kind" json:"kind,omitempty"`
+	// File the event is about; empty for KIND_PACKAGE_FINISHED.
+	File string `protobuf:"bytes,2,opt,name=file,proto3" json:"file,omitempty"`
+	// Files finished so far and in total.
+	Done  int32 `protobuf:"varint,3,opt,name=done,proto3" json:"done,omitempty"`
+	Total int32 `protobuf:"varint,4,opt,name=total,proto3" json:"total,omitempty"`
+	// Set for KIND_FILE_FINISHED.
+	Result *FileResult `protobuf:"bytes,5,opt,name=result,proto3" json:"result,omitempty"`
+	// Set for KIND_PACKAGE_FINISHED.
+	Response      *RewritePackageResponse `protobuf:"bytes,6,opt,name=response,proto3" json:"response,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProgressEvent) Reset() {
+	*x = ProgressEvent{}
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProgressEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProgressEvent) ProtoMessage() {}
+
+func (x *ProgressEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_metamorph_v1_rewriter_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProgressEvent.ProtoReflect.Descriptor instead.
+func (*ProgressEvent) Descriptor() ([]byte, []int) {
+	return file_metamorph_v1_rewriter_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ProgressEvent) GetKind() ProgressEvent_Kind {
+	if x != nil {
+		return x.Kind
+	}
+	return ProgressEvent_KIND_UNSPECIFIED
+}
+
+func (x *ProgressEvent) GetFile() string {
+	if x != nil {
+		return x.File
+	}
+	return ""
+}
+
+func (x *ProgressEvent) GetDone() int32 {
+	if x != nil {
+		return x.Done
+	}
+	return 0
+}
+
+func (x *ProgressEvent) GetTotal() int32 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *ProgressEvent) GetResult() *FileResult {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *ProgressEvent) GetResponse() *RewritePackageResponse {
+	if x != nil {
+		return x.Response
+	}
+	return nil
+}
+
+var File_metamorph_v1_rewriter_proto protoreflect.FileDescriptor
+
+const file_metamorph_v1_rewriter_proto_rawDesc = "" +
+	"\n" +
+	"\x1bmetamorph/v1/rewriter.proto\x12\fmetamorph.v1\"Z\n" +
+	"\x0eRewriteRequest\x12\x16\n" +
+	"\x06source\x18\x01 \x01(\tR\x06source\x12\x1a\n" +
+	"\bstrategy\x18\x02 \x01(\tR\bstrategy\x12\x14\n" +
+	"\x05model\x18\x03 \x01(\tR\x05model\"a\n" +
+	"\vFileMetrics\x12\x10\n" +
+	"\x03loc\x18\x01 \x01(\x05R\x03loc\x12\x0e\n" +
+	"\x02cc\x18\x02 \x01(\x05R\x02cc\x12\x12\n" +
+	"\x04cogc\x18\x03 \x01(\x05R\x04cogc\x12\x1c\n" +
+	"\tfunctions\x18\x04 \x01(\x05R\tfunctions\"\x83\x02\n" +
+	"\rMetricsReport\x125\n" +
+	"\boriginal\x18\x01 \x01(\v2\x19.metamorph.v1.FileMetricsR\boriginal\x127\n" +
+	"\trewritten\x18\x02 \x01(\v2\x19.metamorph.v1.FileMetricsR\trewritten\x12*\n" +
+	"\x11loc_delta_percent\x18\x03 \x01(\x01R\x0flocDeltaPercent\x12(\n" +
+	"\x10cc_delta_percent\x18\x04 \x01(\x01R\x0eccDeltaPercent\x12,\n" +
+	"\x12cogc_delta_percent\x18\x05 \x01(\x01R\x10cogcDeltaPercent\"\x80\x01\n" +
+	"\x0fRewriteResponse\x12\x1c\n" +
+	"\trewritten\x18\x01 \x01(\tR\trewritten\x12\x18\n" +
+	"\achanged\x18\x02 \x01(\bR\achanged\x125\n" +
+	"\ametrics\x18\x03 \x01(\v2\x1b.metamorph.v1.MetricsReportR\ametrics\"8\n" +
+	"\n" +
+	"SourceFile\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x16\n" +
+	"\x06source\x18\x02 \x01(\tR\x06source\"y\n" +
+	"\x15RewritePackageRequest\x12.\n" +
+	"\x05files\x18\x01 \x03(\v2\x18.metamorph.v1.SourceFileR\x05files\x12\x1a\n" +
+	"\bstrategy\x18\x02 \x01(\tR\bstrategy\x12\x14\n" +
+	"\x05model\x18\x03 \x01(\tR\x05model\"m\n" +
+	"\n" +
+	"FileResult\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x125\n" +
+	"\x06result\x18\x02 \x01(\v2\x1d.metamorph.v1.RewriteResponseR\x06result\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"H\n" +
+	"\x16RewritePackageResponse\x12.\n" +
+	"\x05files\x18\x01 \x03(\v2\x18.metamorph.v1.FileResultR\x05files\"+\n" +
+	"\x11GetMetricsRequest\x12\x16\n" +
+	"\x06source\x18\x01 \x01(\tR\x06source\"I\n" +
+	"\x12GetMetricsResponse\x123\n" +
+	"\ametrics\x18\x01 \x01(\v2\x19.metamorph.v1.FileMetricsR\ametrics\"\xdf\x02\n" +
+	"\rProgressEvent\x124\n" +
+	"\x04kind\x18\x01 \x01(\x0e2 .metamorph.v1.ProgressEvent.KindR\x04kind\x12\x12\n" +
+	"\x04file\x18\x02 \x01(\tR\x04file\x12\x12\n" +
+	"\x04done\x18\x03 \x01(\x05R\x04done\x12\x14\n" +
+	"\x05total\x18\x04 \x01(\x05R\x05total\x120\n" +
+	"\x06result\x18\x05 \x01(\v2\x18.metamorph.v1.FileResultR\x06result\x12@\n" +
+	"\bresponse\x18\x06 \x01(\v2$.metamorph.v1.RewritePackageResponseR\bresponse\"f\n" +
+	"\x04Kind\x12\x14\n" +
+	"\x10KIND_UNSPECIFIED\x10\x00\x12\x15\n" +
+	"\x11KIND_FILE_STARTED\x10\x01\x12\x16\n" +
+	"\x12KIND_FILE_FINISHED\x10\x02\x12\x19\n" +
+	"\x15KIND_PACKAGE_FINISHED\x10\x032\xd6\x02\n" +
+	"\bRewriter\x12F\n" +
+	"\aRewrite\x12\x1c.metamorph.v1.RewriteRequest\x1a\x1d.metamorph.v1.RewriteResponse\x12[\n" +
+	"\x0eRewritePackage\x12#.metamorph.v1.RewritePackageRequest\x1a$.metamorph.v1.RewritePackageResponse\x12O\n" +
+	"\n" +
+	"GetMetrics\x12\x1f.metamorph.v1.GetMetricsRequest\x1a .metamorph.v1.GetMetricsResponse\x12T\n" +
+	"\x0eStreamProgress\x12#.metamorph.v1.RewritePackageRequest\x1a\x1b.metamorph.v1.ProgressEvent0\x01BJZHgithub.com/Hekzory/MetamorphLLM/internal/grpcapi/metamorphv1;metamorphv1b\x06proto3"
+
+var (
+	file_metamorph_v1_rewriter_proto_rawDescOnce sync.Once
+	file_metamorph_v1_rewriter_proto_rawDescData []byte
+)
+
+func file_metamorph_v1_rewriter_proto_rawDescGZIP() []byte {
+	file_metamorph_v1_rewriter_proto_rawDescOnce.Do(func() {
+		file_metamorph_v1_rewriter_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_metamorph_v1_rewriter_proto_rawDesc), len(file_metamorph_v1_rewriter_proto_rawDesc)))
+	})
+	return file_metamorph_v1_rewriter_proto_rawDescData
+}
+
+var file_metamorph_v1_rewriter_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_metamorph_v1_rewriter_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_metamorph_v1_rewriter_proto_goTypes = []any{
+	(ProgressEvent_Kind)(0),        // 0: metamorph.v1.ProgressEvent.Kind
+	(*RewriteRequest)(nil),         // 1: metamorph.v1.RewriteRequest
+	(*FileMetrics)(nil),            // 2: metamorph.v1.FileMetrics
+	(*MetricsReport)(nil),          // 3: metamorph.v1.MetricsReport
+	(*RewriteResponse)(nil),        // 4: metamorph.v1.RewriteResponse
+	(*SourceFile)(nil),             // 5: metamorph.v1.SourceFile
+	(*RewritePackageRequest)(nil),  // 6: metamorph.v1.RewritePackageRequest
+	(*FileResult)(nil),             // 7: metamorph.v1.FileResult
+	(*RewritePackageResponse)(nil), // 8: metamorph.v1.RewritePackageResponse
+	(*GetMetricsRequest)(nil),      // 9: metamorph.v1.GetMetricsRequest
+	(*GetMetricsResponse)(nil),     // 10: metamorph.v1.GetMetricsResponse
+	(*ProgressEvent)(nil),          // 11: metamorph.v1.ProgressEvent
+}
+var file_metamorph_v1_rewriter_proto_depIdxs = []int32{
+	2,  // 0: metamorph.v1.MetricsReport.original:type_name -> metamorph.v1.FileMetrics
+	2,  // 1: metamorph.v1.MetricsReport.rewritten:type_name -> metamorph.v1.FileMetrics
+	3,  // 2: metamorph.v1.RewriteResponse.metrics:type_name -> metamorph.v1.MetricsReport
+	5,  // 3: metamorph.v1.RewritePackageRequest.files:type_name -> metamorph.v1.SourceFile
+	4,  // 4: metamorph.v1.FileResult.result:type_name -> metamorph.v1.RewriteResponse
+	7,  // 5: metamorph.v1.RewritePackageResponse.files:type_name -> metamorph.v1.FileResult
+	2,  // 6: metamorph.v1.GetMetricsResponse.metrics:type_name -> metamorph.v1.FileMetrics
+	0,  // 7: metamorph.v1.ProgressEvent.kind:type_name -> metamorph.v1.ProgressEvent.Kind
+	7,  // 8: metamorph.v1.ProgressEvent.result:type_name -> metamorph.v1.FileResult
+	8,  // 9: metamorph.v1.ProgressEvent.response:type_name -> metamorph.v1.RewritePackageResponse
+	1,  // 10: metamorph.v1.Rewriter.Rewrite:input_type -> metamorph.v1.RewriteRequest
+	6,  // 11: metamorph.v1.Rewriter.RewritePackage:input_type -> metamorph.v1.RewritePackageRequest
+	9,  // 12: metamorph.v1.Rewriter.GetMetrics:input_type -> metamorph.v1.GetMetricsRequest
+	6,  // 13: metamorph.v1.Rewriter.StreamProgress:input_type -> metamorph.v1.RewritePackageRequest
+	4,  // 14: metamorph.v1.Rewriter.Rewrite:output_type -> metamorph.v1.RewriteResponse
+	8,  // 15: metamorph.v1.Rewriter.RewritePackage:output_type -> metamorph.v1.RewritePackageResponse
+	10, // 16: metamorph.v1.Rewriter.GetMetrics:output_type -> metamorph.v1.GetMetricsResponse
+	11, // 17: metamorph.v1.Rewriter.StreamProgress:output_type -> metamorph.v1.ProgressEvent
+	14, // [14:18] is the sub-list for method output_type
+	10, // [10:14] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_metamorph_v1_rewriter_proto_init() }
+func file_metamorph_v1_rewriter_proto_init() {
+	if File_metamorph_v1_rewriter_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_metamorph_v1_rewriter_proto_rawDesc), len(file_metamorph_v1_rewriter_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_metamorph_v1_rewriter_proto_goTypes,
+		DependencyIndexes: file_metamorph_v1_rewriter_proto_depIdxs,
+		EnumInfos:         file_metamorph_v1_rewriter_proto_enumTypes,
+		MessageInfos:      file_metamorph_v1_rewriter_proto_msgTypes,
+	}.Build()
+	File_metamorph_v1_rewriter_proto = out.File
+	file_metamorph_v1_rewriter_proto_goTypes = nil
+	file_metamorph_v1_rewriter_proto_depIdxs = nil
+}
@@ -0,0 +1,255 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: metamorph/v1/rewriter.proto
+
+// gRPC API of the MetamorphLLM rewriter, served by 'metamorph serve -grpc-addr'.
+
+package metamorphv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Rewriter_Rewrite_FullMethodName        = "/metamorph.v1.Rewriter/Rewrite"
+	Rewriter_RewritePackage_FullMethodName = "/metamorph.v1.Rewriter/RewritePackage"
+	Rewriter_GetMetrics_FullMethodName     = "/metamorph.v1.Rewriter/GetMetrics"
+	Rewriter_StreamProgress_FullMethodName = "/metamorph.v1.Rewriter/StreamProgress"
+)
+
+// RewriterClient is the client API for Rewriter service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Rewriter rewrites Go source with the configured strategies.
+type RewriterClient interface {
+	// Rewrite rewrites one Go file.
+	Rewrite(ctx context.Context, in *RewriteRequest, opts ...grpc.CallOption) (*RewriteResponse, error)
+	// RewritePackage rewrites every file of a package.
+	RewritePackage(ctx context.Context, in *RewritePackageRequest, opts ...grpc.CallOption) (*RewritePackageResponse, error)
+	// GetMetrics computes code metrics without rewriting.
+	GetMetrics(ctx context.Context, in *GetMetricsRequest, opts ...grpc.CallOption) (*GetMetricsResponse, error)
+	// StreamProgress rewrites a package like RewritePackage, reporting each file
+	// as it starts and finishes. The last event carries the full response.
+	StreamProgress(ctx context.Context, in *RewritePackageRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ProgressEvent], error)
+}
+
+type rewriterClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRewriterClient(cc grpc.ClientConnInterface) RewriterClient {
+	return &rewriterClient{cc}
+}
+
+func (c *rewriterClient) Rewrite(ctx context.Context, in *RewriteRequest, opts ...grpc.CallOption) (*RewriteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RewriteResponse)
+	err := c.cc.Invoke(ctx, Rewriter_Rewrite_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rewriterClient) RewritePackage(ctx context.Context, in *RewritePackageRequest, opts ...grpc.CallOption) (*RewritePackageResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RewritePackageResponse)
+	err := c.cc.Invoke(ctx, Rewriter_RewritePackage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rewriterClient) GetMetrics(ctx context.Context, in *GetMetricsRequest, opts ...grpc.CallOption) (*GetMetricsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetMetricsResponse)
+	err := c.cc.Invoke(ctx, Rewriter_GetMetrics_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rewriterClient) StreamProgress(ctx context.Context, in *RewritePackageRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ProgressEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Rewriter_ServiceDesc.Streams[0], Rewriter_StreamProgress_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[RewritePackageRequest, ProgressEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Rewriter_StreamProgressClient = grpc.ServerStreamingClient[ProgressEvent]
+
+// RewriterServer is the server API for Rewriter service.
+// All implementations must embed UnimplementedRewriterServer
+// for forward compatibility.
+//
+// Rewriter rewrites Go source with the configured strategies.
+type RewriterServer interface {
+	// Rewrite rewrites one Go file.
+	Rewrite(context.Context, *RewriteRequest) (*RewriteResponse, error)
+	// RewritePackage rewrites every file of a package.
+	RewritePackage(context.Context, *RewritePackageRequest) (*RewritePackageResponse, error)
+	// GetMetrics computes code metrics without rewriting.
+	GetMetrics(context.Context, *GetMetricsRequest) (*GetMetricsResponse, error)
+	// StreamProgress rewrites a package like RewritePackage, reporting each file
+	// as it starts and finishes. The last event carries the full response.
+	StreamProgress(*RewritePackageRequest, grpc.ServerStreamingServer[ProgressEvent]) error
+	mustEmbedUnimplementedRewriterServer()
+}
+
+// UnimplementedRewriterServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedRewriterServer struct{}
+
+func (UnimplementedRewriterServer) Rewrite(context.Context, *RewriteRequest) (*RewriteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Rewrite not implemented")
+}
+func (UnimplementedRewriterServer) RewritePackage(context.Context, *RewritePackageRequest) (*RewritePackageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RewritePackage not implemented")
+}
+func (UnimplementedRewriterServer) GetMetrics(context.Context, *GetMetricsRequest) (*GetMetricsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMetrics not implemented")
+}
+func (UnimplementedRewriterServer) StreamProgress(*RewritePackageRequest, grpc.ServerStreamingServer[ProgressEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamProgress not implemented")
+}
+func (UnimplementedRewriterServer) mustEmbedUnimplementedRewriterServer() {}
+func (UnimplementedRewriterServer) testEmbeddedByValue()                  {}
+
+// UnsafeRewriterServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RewriterServer will
+// result in compilation errors.
+type UnsafeRewriterServer interface {
+	mustEmbedUnimplementedRewriterServer()
+}
+
+func RegisterRewriterServer(s grpc.ServiceRegistrar, srv RewriterServer) {
+	// If the following call pancis, it indicates UnimplementedRewriterServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Rewriter_ServiceDesc, srv)
+}
+
+func _Rewriter_Rewrite_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RewriteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RewriterServer).Rewrite(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Rewriter_Rewrite_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RewriterServer).Rewrite(ctx, req.(*RewriteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rewriter_RewritePackage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RewritePackageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RewriterServer).RewritePackage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Rewriter_RewritePackage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RewriterServer).RewritePackage(ctx, req.(*RewritePackageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rewriter_GetMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMetricsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RewriterServer).GetMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Rewriter_GetMetrics_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RewriterServer).GetMetrics(ctx, req.(*GetMetricsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rewriter_StreamProgress_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RewritePackageRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RewriterServer).StreamProgress(m, &grpc.GenericServerStream[RewritePackageRequest, ProgressEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Rewriter_StreamProgressServer = grpc.ServerStreamingServer[ProgressEvent]
+
+// Rewriter_ServiceDesc is the grpc.ServiceDesc for Rewriter service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Rewriter_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "metamorph.v1.Rewriter",
+	HandlerType: (*RewriterServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Rewrite",
+			Handler:    _Rewriter_Rewrite_Handler,
+		},
+		{
+			MethodName: "RewritePackage",
+			Handler:    _Rewriter_RewritePackage_Handler,
+		},
+		{
+			MethodName: "GetMetrics",
+			Handler:    _Rewriter_GetMetrics_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamProgress",
+			Handler:       _Rewriter_StreamProgress_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "metamorph/v1/rewriter.proto",
+}
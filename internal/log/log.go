@@ -0,0 +1,243 @@
+// Package log is the structured logger of the rewriter and the manager. It
+// writes readable lines by default and JSON objects for CI pipelines, and
+// components log through their own logger so records can be told apart.
+package log
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/Hekzory/MetamorphLLM/internal/redact"
+)
+
+// Output formats
+const (
+	FormatText = "text" // One readable line per record: message, then key=value pairs
+	FormatJSON = "json" // One JSON object per record, with time, level and component
+)
+
+// Options configure the records that are written and their format
+type Options struct {
+	Verbose bool   // Also write debug records
+	Quiet   bool   // Only write warnings and errors
+	Format  string // FormatText or FormatJSON; empty means FormatText
+}
+
+// Level returns the lowest level that is written
+func (o Options) Level() slog.Level {
+	switch {
+	case o.Verbose:
+		return slog.LevelDebug
+	case o.Quiet:
+		return slog.LevelWarn
+	}
+	return slog.LevelInfo
+}
+
+// Args returns the command-line flags that select these options, so a
+// command can run another one with the same logging
+func (o Options) Args() []string {
+	var args []string
+	if o.Verbose {
+		args = append(args, "-v")
+	}
+	if o.Quiet {
+		args = append(args, "-q")
+	}
+	if o.Format != "" && o.Format != FormatText {
+		args = append(args, "-log-format", o.Format)
+	}
+	return args
+}
+
+// current is the setup every logger writes with
+var current atomic.Pointer[Options]
+
+func init() {
+	current.Store(&Options{Format: FormatText})
+}
+
+// Setup validates and applies the options to every logger, including those
+// created before
+func Setup(opts Options) error {
+	if opts.Verbose && opts.Quiet {
+		return fmt.Errorf("-v and -q cannot be combined")
+	}
+	switch opts.Format {
+	case "":
+		opts.Format = FormatText
+	case FormatText, FormatJSON:
+	default:
+		return fmt.Errorf("unknown log format %q (text or json)", opts.Format)
+	}
+	current.Store(&opts)
+	return nil
+}
+
+// Current returns the options loggers write with
+func Current() Options {
+	return *current.Load()
+}
+
+// Reports returns where reports and prompts meant for people are written,
+// such as the test summary: stdout, or stderr when stdout carries JSON
+// records
+func Reports() io.Writer {
+	if Current().Format == FormatJSON {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// Component returns the logger of a part of the program, such as "rewriter"
+// or "manager". Packages keep theirs in a variable; records follow the setup
+// at the time they are written.
+func Component(name string) *slog.Logger {
+	return slog.New(&handler{component: name})
+}
+
+// handler formats records with the current setup. Records are written to
+// the os.Stdout or os.Stderr of the moment, which the manager's dashboard
+// redirects while it is shown.
+type handler struct {
+	component string
+	attrs     []slog.Attr
+	groups    []string
+}
+
+// mu keeps records of concurrent goroutines from interleaving
+var mu sync.Mutex
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= Current().Level()
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	for _, a := range attrs {
+		c.attrs = append(c.attrs[:len(c.attrs):len(c.attrs)], qualify(h.groups, a))
+	}
+	return &c
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.groups = append(c.groups[:len(c.groups):len(c.groups)], name)
+	return &c
+}
+
+func (h *handler) Handle(_ context.Context, r slog.Record) error {
+	// Provider responses and errors may carry credentials, so every record
+	// is redacted, whether or not the caller wrapped its error
+	var attrs []slog.Attr
+	for _, a := range h.attrs {
+		attrs = append(attrs, redactAttr(a))
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, redactAttr(qualify(h.groups, a)))
+		return true
+	})
+	msg := redact.String(r.Message)
+
+	var buf bytes.Buffer
+	if Current().Format == FormatJSON {
+		record := slog.NewRecord(r.Time, r.Level, msg, r.PC)
+		if h.component != "" {
+			record.AddAttrs(slog.String("component", h.component))
+		}
+		record.AddAttrs(attrs...)
+		if err := slog.NewJSONHandler(&buf, nil).Handle(context.Background(), record); err != nil {
+			return err
+		}
+	} else {
+		writeText(&buf, r.Level, msg, attrs)
+	}
+
+	var out io.Writer = os.Stdout
+	if r.Level >= slog.LevelWarn {
+		out = os.Stderr
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	_, err := out.Write(buf.Bytes())
+	return err
+}
+
+// qualify prefixes an attribute with the open groups, e.g. "report.path"
+func qualify(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		a.Key = strings.Join(groups, ".") + "." + a.Key
+	}
+	return a
+}
+
+// redactAttr masks credentials in string, error and Stringer values, also
+// within groups
+func redactAttr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(redact.String(a.Value.String()))
+	case slog.KindGroup:
+		group := make([]slog.Attr, 0, len(a.Value.Group()))
+		for _, g := range a.Value.Group() {
+			group = append(group, redactAttr(g))
+		}
+		a.Value = slog.GroupValue(group...)
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			a.Value = slog.StringValue(redact.String(v.Error()))
+		case fmt.Stringer:
+			a.Value = slog.StringValue(redact.String(v.String()))
+		}
+	}
+	return a
+}
+
+// writeText writes a record as the readable line of FormatText. Values with
+// spaces or quotes are quoted; warnings and errors are marked.
+func writeText(buf *bytes.Buffer, level slog.Level, msg string, attrs []slog.Attr) {
+	switch {
+	case level >= slog.LevelError:
+		buf.WriteString("Error: ")
+	case level >= slog.LevelWarn:
+		buf.WriteString("Warning: ")
+	}
+	buf.WriteString(msg)
+	for _, a := range attrs {
+		writeAttr(buf, "", a)
+	}
+	buf.WriteByte('\n')
+}
+
+// writeAttr writes " key=value", flattening groups into dotted keys
+func writeAttr(buf *bytes.Buffer, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, g := range a.Value.Group() {
+			writeAttr(buf, prefix+a.Key+".", g)
+		}
+		return
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(prefix + a.Key)
+	buf.WriteByte('=')
+	value := a.Value.String()
+	if value == "" || strings.ContainsFunc(value, func(r rune) bool { return unicode.IsSpace(r) || r == '"' || r == '=' }) {
+		value = strconv.Quote(value)
+	}
+	buf.WriteString(value)
+}
@@ -0,0 +1,141 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// capture runs fn with opts and returns what it wrote to stdout and stderr
+func capture(t *testing.T, opts Options, fn func()) (string, string) {
+	t.Helper()
+	previous := Current()
+	t.Cleanup(func() { _ = Setup(previous) })
+	if err := Setup(opts); err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+
+	stdout, stderr := os.Stdout, os.Stderr
+	outR, outW, _ := os.Pipe()
+	errR, errW, _ := os.Pipe()
+	os.Stdout, os.Stderr = outW, errW
+	fn()
+	os.Stdout, os.Stderr = stdout, stderr
+	outW.Close()
+	errW.Close()
+	out, _ := io.ReadAll(outR)
+	errOut, _ := io.ReadAll(errR)
+	return string(out), string(errOut)
+}
+
+// TestText tests the readable format and where each level is written
+func TestText(t *testing.T) {
+	logger := Component("rewriter")
+	stdout, stderr := capture(t, Options{}, func() {
+		logger.Info("Processing function", "function", "a")
+		logger.Debug("Hidden")
+		logger.Warn("Retrying", "error", "rate limited", "wait", "2s")
+		logger.With("file", "x.go").WithGroup("metrics").Error("Failed", "loc", 3)
+		logger.Info("Empty", "value", "", "quoted", `say "hi"`)
+	})
+
+	wantOut := "Processing function function=a\nEmpty value=\"\" quoted=\"say \\\"hi\\\"\"\n"
+	if stdout != wantOut {
+		t.Errorf("Expected stdout %q, got %q", wantOut, stdout)
+	}
+	wantErr := "Warning: Retrying error=\"rate limited\" wait=2s\nError: Failed file=x.go metrics.loc=3\n"
+	if stderr != wantErr {
+		t.Errorf("Expected stderr %q, got %q", wantErr, stderr)
+	}
+}
+
+// TestJSON tests that JSON records carry the component and grouped attributes
+func TestJSON(t *testing.T) {
+	logger := Component("manager")
+	stdout, _ := capture(t, Options{Format: FormatJSON}, func() {
+		logger.Info("Code metrics", slog.Group("original", "loc", 10), "file", "a.go")
+	})
+
+	var record map[string]any
+	if err := json.Unmarshal([]byte(stdout), &record); err != nil {
+		t.Fatalf("Expected one JSON object, got %q: %v", stdout, err)
+	}
+	if record["msg"] != "Code metrics" || record["level"] != "INFO" || record["component"] != "manager" || record["file"] != "a.go" {
+		t.Errorf("Unexpected record: %v", record)
+	}
+	if original, _ := record["original"].(map[string]any); original["loc"] != float64(10) {
+		t.Errorf("Expected original.loc 10, got %v", record["original"])
+	}
+	if _, ok := record["time"]; !ok {
+		t.Errorf("Expected a time in the record: %v", record)
+	}
+}
+
+// TestLevels tests that -v and -q select the written records
+func TestLevels(t *testing.T) {
+	logger := Component("")
+	emit := func() {
+		logger.Debug("debug")
+		logger.Info("info")
+		logger.Warn("warn")
+	}
+
+	stdout, stderr := capture(t, Options{Verbose: true}, emit)
+	if stdout != "debug\ninfo\n" || stderr != "Warning: warn\n" {
+		t.Errorf("Expected every record with -v, got %q and %q", stdout, stderr)
+	}
+	stdout, stderr = capture(t, Options{Quiet: true}, emit)
+	if stdout != "" || stderr != "Warning: warn\n" {
+		t.Errorf("Expected only the warning with -q, got %q and %q", stdout, stderr)
+	}
+}
+
+// TestSetup tests validation of the options and the flags that repeat them
+func TestSetup(t *testing.T) {
+	previous := Current()
+	defer func() { _ = Setup(previous) }()
+
+	if err := Setup(Options{Verbose: true, Quiet: true}); err == nil {
+		t.Error("Expected -v with -q to be rejected")
+	}
+	if err := Setup(Options{Format: "xml"}); err == nil || !strings.Contains(err.Error(), "xml") {
+		t.Errorf("Expected an unknown format to be rejected, got %v", err)
+	}
+	if err := Setup(Options{}); err != nil || Current().Format != FormatText {
+		t.Errorf("Expected the text format by default, got %q (%v)", Current().Format, err)
+	}
+	if Reports() != os.Stdout {
+		t.Error("Expected reports on stdout in the text format")
+	}
+
+	opts := Options{Verbose: true, Format: FormatJSON}
+	if args := opts.Args(); !slices.Equal(args, []string{"-v", "-log-format", "json"}) {
+		t.Errorf("Unexpected args %v", args)
+	}
+	if args := (Options{Format: FormatText}).Args(); len(args) != 0 {
+		t.Errorf("Expected no args for the defaults, got %v", args)
+	}
+	if err := Setup(opts); err != nil || Reports() != os.Stderr {
+		t.Errorf("Expected reports on stderr in the JSON format (%v)", err)
+	}
+}
+
+// TestRedaction tests that credentials are masked in messages and attributes
+// of both formats, even in errors the caller did not redact
+func TestRedaction(t *testing.T) {
+	const key = "sk-or-v1-0123456789abcdef0123456789abcdef"
+	logger := Component("rewriter").With("request", "Authorization: Bearer "+key)
+	for _, format := range []string{FormatText, FormatJSON} {
+		_, stderr := capture(t, Options{Format: format}, func() {
+			logger.Warn("Provider rejected "+key, "error", errors.New("invalid api_key="+key), slog.Group("response", "body", key))
+		})
+		if strings.Contains(stderr, key) || strings.Count(stderr, "[REDACTED]") != 4 {
+			t.Errorf("Expected the key masked 4 times in %s, got %q", format, stderr)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultAuditLogPath is where the manager CLI records filesystem mutations
+const DefaultAuditLogPath = ".metamorph/audit.jsonl"
+
+// Audit operations
+const (
+	AuditRename = "rename"
+	AuditRemove = "remove"
+	AuditMkdir  = "mkdir"
+	AuditCreate = "create" // File written by a subprocess (rewriter output, go build binary)
+)
+
+// AuditEntry is one filesystem mutation performed by the manager
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Op     string    `json:"op"`
+	Path   string    `json:"path"`
+	Target string    `json:"target,omitempty"` // Destination of a rename
+	// BeforeSHA256 is the content hash of Path before the operation
+	BeforeSHA256 string `json:"before_sha256,omitempty"`
+	// AfterSHA256 is the content hash of Target (or Path) after the operation
+	AfterSHA256 string `json:"after_sha256,omitempty"`
+	// ReplacedSHA256 is the hash of a file that a rename overwrote at Target
+	ReplacedSHA256 string `json:"replaced_sha256,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// LoadAuditLog reads all entries from an audit log
+func LoadAuditLog(path string) ([]AuditEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	dec := json.NewDecoder(f)
+	for {
+		var entry AuditEntry
+		if err := dec.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse audit log %s: %w", path, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// appendAudit appends an entry to the audit log, which is only ever opened for appending
+func appendAudit(path string, entry AuditEntry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// audit records an entry if an audit log is configured. A failure to record is
+// reported but does not abort the pipeline, which may be mid-way through a file shuffle.
+func (m *Manager) audit(entry AuditEntry, opErr error) {
+	if m.AuditLogPath == "" {
+		return
+	}
+	entry.Time = time.Now().UTC()
+	if opErr != nil {
+		entry.Error = opErr.Error()
+	}
+	if err := appendAudit(m.AuditLogPath, entry); err != nil {
+		logger.Warn("Failed to write the audit log", "error", err)
+	}
+}
+
+// rename moves src to dst and records the mutation
+func (m *Manager) rename(src, dst string) error {
+	entry := AuditEntry{Op: AuditRename, Path: src, Target: dst}
+	if m.AuditLogPath != "" {
+		entry.BeforeSHA256 = fileHash(src)
+		entry.ReplacedSHA256 = fileHash(dst)
+	}
+	err := retryLocked(func() error { return os.Rename(src, dst) })
+	if m.AuditLogPath != "" {
+		entry.AfterSHA256 = fileHash(dst)
+	}
+	m.audit(entry, err)
+	return err
+}
+
+// remove deletes path and records the mutation
+func (m *Manager) remove(path string) error {
+	entry := AuditEntry{Op: AuditRemove, Path: path}
+	if m.AuditLogPath != "" {
+		entry.BeforeSHA256 = fileHash(path)
+	}
+	err := retryLocked(func() error { return os.Remove(path) })
+	m.audit(entry, err)
+	return err
+}
+
+// lockRetries is how often an operation on a file in use is retried
+const lockRetries = 5
+
+// retryLocked runs op again while it fails because another process briefly
+// holds the file, e.g. a virus scanner on Windows inspecting a new binary
+func retryLocked(op func() error) error {
+	err := op()
+	for i := 0; i < lockRetries && isLocked(err); i++ {
+		time.Sleep(time.Duration(50<<i) * time.Millisecond)
+		err = op()
+	}
+	return err
+}
+
+// mkdirAll creates dir and its parents, recording the mutation only if dir did not exist
+func (m *Manager) mkdirAll(dir string) error {
+	_, statErr := os.Stat(dir)
+	err := os.MkdirAll(dir, 0755)
+	if os.IsNotExist(statErr) {
+		m.audit(AuditEntry{Op: AuditMkdir, Path: dir}, err)
+	}
+	return err
+}
+
+// recordCreate records a file written by a subprocess; before is the hash of the
+// previous content (empty if the file did not exist)
+func (m *Manager) recordCreate(path, before string, opErr error) {
+	if m.AuditLogPath == "" {
+		return
+	}
+	m.audit(AuditEntry{Op: AuditCreate, Path: path, BeforeSHA256: before, AfterSHA256: fileHash(path)}, opErr)
+}
+
+// hashIfAudited returns the content hash of path when auditing is enabled
+func (m *Manager) hashIfAudited(path string) string {
+	if m.AuditLogPath == "" {
+		return ""
+	}
+	return fileHash(path)
+}
+
+// fileHash returns the hex SHA-256 of a file's content, or "" if it cannot be read
+func fileHash(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
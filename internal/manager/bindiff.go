@@ -0,0 +1,89 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/Hekzory/MetamorphLLM/internal/bindiff"
+)
+
+// DiffBinaries compiles every target from the original source and compares
+// it with the binary compiled from the rewrite. The dissimilarity of each
+// binary is logged and recorded in its manifest. The YaraRules are matched
+// against both binaries too.
+func (m *Manager) DiffBinaries(ctx context.Context) error {
+	m.binaryDiffs = nil
+	if !m.BinaryDiff {
+		logger.Info("Binary comparison disabled, skipping")
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "metamorph-bindiff-*")
+	if err != nil {
+		return fmt.Errorf("failed to create directory for original binaries: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	diffs := make(map[string]*bindiff.Report)
+	for i, target := range m.Targets() {
+		original, err := m.compileOriginal(ctx, dir, i, target)
+		if err != nil {
+			return err
+		}
+
+		rewritten := newBinaryPath(target)
+		report, err := bindiff.CompareFiles(original, rewritten)
+		if err != nil {
+			return fmt.Errorf("failed to compare %s with the original: %w", rewritten, err)
+		}
+		diffs[rewritten] = report
+		if err := m.MatchYaraRules(ctx, original, rewritten); err != nil {
+			return fmt.Errorf("failed to match YARA rules against %s: %w", rewritten, err)
+		}
+		logger.Info("Binary comparison", "binary", rewritten, "dissimilarity", round2(report.Dissimilarity()),
+			slog.Group("size", "original", report.OriginalSize, "rewritten", report.RewrittenSize),
+			slog.Group("symbols", "added", report.SymbolsAdded, "removed", report.SymbolsRemoved,
+				"resized", report.SymbolsResized, "unchanged", report.SymbolsUnchanged),
+			"sections_changed", report.SectionsChanged,
+			slog.Group("similarity", "symbols", round2(report.SymbolSimilarity), "sections", round2(report.SectionSimilarity),
+				"fuzzy_hash", round2(report.FuzzySimilarity)))
+	}
+	m.binaryDiffs = diffs
+	return nil
+}
+
+// compileOriginal compiles the i-th target from the original source into dir
+// and returns the binary's path
+func (m *Manager) compileOriginal(ctx context.Context, dir string, i int, target string) (string, error) {
+	// Built from the original, so the build tag is not set
+	original := filepath.Join(dir, fmt.Sprintf("%d-%s", i, filepath.Base(BinaryPath(target))))
+	cmd := m.goCommand(ctx, "build", "-o", original, goPackage(target))
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to compile the original of %s: %v\n%s", goPackage(target), err, output.String())
+	}
+	return original, nil
+}
+
+// binaryDissimilarity returns the dissimilarity of a binary compiled from the
+// rewrite, or nil if it was not compared
+func (m *Manager) binaryDissimilarity(newBinary string) *float64 {
+	report, ok := m.binaryDiffs[newBinary]
+	if !ok {
+		return nil
+	}
+	d := round2(report.Dissimilarity())
+	return &d
+}
+
+// round2 rounds v to two decimals
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,97 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+// ErrBudgetExceeded stops a run whose MaxDuration passed before its next stage
+var ErrBudgetExceeded = errors.New("time budget exceeded")
+
+// StartBudget starts the MaxDuration budget of a run; Run calls it. Without a
+// MaxDuration the run is not limited.
+func (m *Manager) StartBudget() {
+	m.deadline = time.Time{}
+	if m.MaxDuration > 0 {
+		m.deadline = time.Now().Add(m.MaxDuration)
+	}
+}
+
+// remainingBudget returns the time left before the deadline, and false if the
+// run is not limited
+func (m *Manager) remainingBudget() (time.Duration, bool) {
+	if m.deadline.IsZero() {
+		return 0, false
+	}
+	return time.Until(m.deadline), true
+}
+
+// checkBudget returns ErrBudgetExceeded once the deadline passed, before stage
+// starts. The binaries validated so far are kept with a partial manifest.
+func (m *Manager) checkBudget(stage string) error {
+	if left, ok := m.remainingBudget(); !ok || left > 0 {
+		return nil
+	}
+	logger.Warn("Time budget exceeded", "budget", m.MaxDuration, "stopped_before", stage)
+	if err := m.writePartialManifests(stage); err != nil {
+		logger.Warn("Failed to write partial manifests", "error", err)
+	}
+	return fmt.Errorf("%w after %v, stopped before %s", ErrBudgetExceeded, m.MaxDuration, stage)
+}
+
+// writePartialManifests records the provenance of every compiled binary that
+// was not deployed because the run stopped before stage
+func (m *Manager) writePartialManifests(stage string) error {
+	for _, dir := range m.Targets() {
+		newBinary := newBinaryPath(dir)
+		if _, err := os.Stat(newBinary); err != nil {
+			continue
+		}
+		manifest, err := m.buildManifest(newBinary, newBinary)
+		if err != nil {
+			return err
+		}
+		// Nothing is uploaded for a stopped run
+		manifest.StoppedAt, manifest.Artifacts = stage, nil
+		data, signature, err := m.encodeManifest(manifest)
+		if err != nil {
+			return err
+		}
+		if err := m.writeManifest(newBinary, data, signature); err != nil {
+			return fmt.Errorf("failed to write partial manifest: %w", err)
+		}
+		logger.Info("Kept binary with a partial manifest", "binary", newBinary, "manifest", ManifestPath(newBinary))
+	}
+	return nil
+}
+
+// usageArgs returns the flags that pass the token and cost budgets on
+func (m *Manager) usageArgs() []string {
+	var args []string
+	if m.MaxCost > 0 {
+		args = append(args, "-max-cost", strconv.FormatFloat(m.MaxCost, 'f', -1, 64))
+	}
+	if m.MaxTotalTokens > 0 {
+		args = append(args, "-max-total-tokens", strconv.FormatInt(m.MaxTotalTokens, 10))
+	}
+	return args
+}
+
+// logUsage logs the tokens and cost of the run's API calls, as the rewriter
+// reported them. A reused rewritten file cost nothing this run.
+func (m *Manager) logUsage() {
+	if !m.rewrote || m.rewriteReport == nil || len(m.rewriteReport.Usage) == 0 {
+		return
+	}
+	total := rewriter.TotalUsage(m.rewriteReport.Usage)
+	attrs := []any{"calls", total.Calls, "prompt_tokens", total.PromptTokens, "completion_tokens", total.CompletionTokens, "cost_usd", total.Cost}
+	if total.Unpriced > 0 {
+		attrs = append(attrs, "unpriced_calls", total.Unpriced)
+	}
+	logger.Info("API usage of the run", attrs...)
+}
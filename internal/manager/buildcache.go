@@ -0,0 +1,66 @@
+package manager
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// cacheDefeatingFlags are go flags that make every build or test recompile all
+// packages; they are dropped from an inherited GOFLAGS
+var cacheDefeatingFlags = map[string]bool{"-a": true, "-a=true": true}
+
+// goCommand prepares a go command whose builds share one build cache, so that
+// across rounds only the rewritten package and its dependents are
+// recompiled while unchanged dependencies come from the cache. Canceling ctx
+// kills the command.
+func (m *Manager) goCommand(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Env = m.goEnv()
+	return cmd
+}
+
+// goEnv returns the environment for go commands: GOCACHE points at
+// BuildCacheDir when set and cache-defeating flags are removed from GOFLAGS
+func (m *Manager) goEnv() []string {
+	env := make([]string, 0, len(os.Environ())+1)
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		switch {
+		case key == "GOCACHE" && m.BuildCacheDir != "":
+			continue
+		case key == "GOFLAGS":
+			var kept []string
+			for _, flag := range strings.Fields(value) {
+				if !cacheDefeatingFlags[flag] {
+					kept = append(kept, flag)
+				}
+			}
+			kv = "GOFLAGS=" + strings.Join(kept, " ")
+		}
+		env = append(env, kv)
+	}
+	if m.BuildCacheDir != "" {
+		// GOCACHE must be absolute
+		dir, err := filepath.Abs(m.BuildCacheDir)
+		if err != nil {
+			dir = m.BuildCacheDir
+		}
+		env = append(env, "GOCACHE="+dir)
+	}
+	return env
+}
+
+// rebuiltPackages counts the packages listed by go build -v, which names only
+// the packages it had to compile rather than take from the build cache
+func rebuiltPackages(verboseOutput string) int {
+	n := 0
+	for _, line := range strings.Split(verboseOutput, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			n++
+		}
+	}
+	return n
+}
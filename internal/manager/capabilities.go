@@ -0,0 +1,64 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Hekzory/MetamorphLLM/internal/capability"
+	"github.com/Hekzory/MetamorphLLM/internal/policy"
+)
+
+// CheckCapabilities fails if any rewritten function can do something its
+// original could not, such as starting processes, using the network or writing
+// files. The rewrite must only obfuscate, never add behaviour.
+func (m *Manager) CheckCapabilities() error {
+	logger.Info("Comparing capabilities of original and rewritten code")
+
+	original, err := os.ReadFile(m.SuspiciousPath)
+	if err != nil {
+		return fmt.Errorf("failed to read original source: %w", err)
+	}
+	rewritten, err := os.ReadFile(m.OutputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read rewritten source: %w", err)
+	}
+
+	if err := capability.CheckRewrite(string(original), string(rewritten)); err != nil {
+		return fmt.Errorf("%w (inspect %s, then rerun with -force-rewrite)", err, m.OutputPath)
+	}
+	logger.Info("Rewritten code gained no capabilities")
+	return nil
+}
+
+// CheckPolicy evaluates the rewrite against the policy file, if one is
+// configured, and fails with every violation listed per function
+func (m *Manager) CheckPolicy() error {
+	if m.PolicyPath == "" {
+		return nil
+	}
+	logger.Info("Checking rewritten code against policy", "policy", m.PolicyPath)
+
+	p, err := policy.Load(m.PolicyPath)
+	if err != nil {
+		return err
+	}
+	original, err := os.ReadFile(m.SuspiciousPath)
+	if err != nil {
+		return fmt.Errorf("failed to read original source: %w", err)
+	}
+	rewritten, err := os.ReadFile(m.OutputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read rewritten source: %w", err)
+	}
+
+	violations, err := p.Evaluate(string(original), string(rewritten))
+	if err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("rewrite violates %d policy rule(s) (inspect %s, then rerun with -force-rewrite):\n%s",
+			len(violations), m.OutputPath, policy.Summary(violations))
+	}
+	logger.Info("Rewritten code complies with the policy")
+	return nil
+}
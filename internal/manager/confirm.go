@@ -0,0 +1,213 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/Hekzory/MetamorphLLM/internal/bindiff"
+	"github.com/Hekzory/MetamorphLLM/internal/log"
+	"github.com/Hekzory/MetamorphLLM/internal/metrics"
+)
+
+// ConfirmMode decides how a deployment is approved
+type ConfirmMode string
+
+const (
+	// ConfirmPrompt asks on the terminal before every deployment (the default)
+	ConfirmPrompt ConfirmMode = "prompt"
+	// ConfirmFile deploys only if the approval file holds the new binary's SHA-256
+	ConfirmFile ConfirmMode = "file"
+	// ConfirmNone deploys as soon as the tests and smoke run pass
+	ConfirmNone ConfirmMode = "none"
+)
+
+// DefaultApprovalFile is where ConfirmFile looks for approvals
+const DefaultApprovalFile = ".metamorph/approve-deploy"
+
+// ErrDeployDeclined is returned when a deployment is not approved
+var ErrDeployDeclined = errors.New("deployment not approved")
+
+// ConfirmDeploy shows what is about to be deployed and waits for approval
+// according to m.Confirm. Canceling ctx declines the deployment.
+func (m *Manager) ConfirmDeploy(ctx context.Context) error {
+	switch m.Confirm {
+	case ConfirmNone:
+		return nil
+	case ConfirmPrompt, "", ConfirmFile:
+	default:
+		return fmt.Errorf("unknown confirm mode %q (prompt, file or none)", m.Confirm)
+	}
+
+	var hashes []string
+	for _, dir := range m.Targets() {
+		newHash := fileHash(newBinaryPath(dir))
+		if newHash == "" {
+			return fmt.Errorf("new binary not found at %s", newBinaryPath(dir))
+		}
+		hashes = append(hashes, newHash)
+	}
+	m.writeDeploySummary(log.Reports())
+
+	if m.Confirm == ConfirmFile {
+		return m.checkApprovalFile(hashes)
+	}
+	return m.promptApproval(ctx)
+}
+
+// writeDeploySummary prints the metrics deltas, the mutation score and how
+// each binary changes, down to its symbols and sections
+func (m *Manager) writeDeploySummary(w io.Writer) {
+	fmt.Fprintln(w, "\nDeployment Summary:")
+	fmt.Fprintln(w, "===================")
+
+	original, origErr := metrics.CalculateMetrics(m.SuspiciousPath)
+	rewritten, rewErr := metrics.CalculateMetrics(m.OutputPath)
+	if origErr == nil && rewErr == nil {
+		delta := metrics.CalculateDeltaMetrics(original, rewritten)
+		fmt.Fprintf(w, "  LOC:  %d -> %d (%s)\n", original.LOC, rewritten.LOC, delta.LOC)
+		fmt.Fprintf(w, "  CC:   %d -> %d (%s)\n", original.CC, rewritten.CC, delta.CC)
+		fmt.Fprintf(w, "  CogC: %d -> %d (%s)\n", original.CogC, rewritten.CogC, delta.CogC)
+	} else {
+		fmt.Fprintf(w, "  Metrics unavailable: %v\n", errors.Join(origErr, rewErr))
+	}
+	if r := m.mutationReport; r != nil {
+		killed, valid := r.Counts()
+		fmt.Fprintf(w, "  Mutation score: %.1f%% (%d of %d mutants killed by the tests)\n", r.Score()*100, killed, valid)
+	}
+
+	for _, dir := range m.Targets() {
+		origBinary, newBinary := BinaryPath(dir), newBinaryPath(dir)
+		fmt.Fprintf(w, "  Binary: %s\n", origBinary)
+		current, err := os.Stat(origBinary)
+		if err == nil {
+			fmt.Fprintf(w, "    current: %d bytes, SHA-256 %s\n", current.Size(), fileHash(origBinary))
+		} else {
+			fmt.Fprintln(w, "    current: none")
+		}
+		info, err := os.Stat(newBinary)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(w, "    new:     %d bytes, SHA-256 %s\n", info.Size(), fileHash(newBinary))
+		if current != nil {
+			writeBinaryDiff(w, origBinary, newBinary)
+		}
+	}
+}
+
+// writeBinaryDiff prints the symbols and sections that differ between the
+// deployed binary and the new one
+func writeBinaryDiff(w io.Writer, current, next string) {
+	report, err := bindiff.CompareFiles(current, next)
+	if err != nil {
+		fmt.Fprintf(w, "    diff:    unavailable: %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "    symbols: %d added, %d removed, %d resized, %d unchanged\n",
+		report.SymbolsAdded, report.SymbolsRemoved, report.SymbolsResized, report.SymbolsUnchanged)
+	sections := "none"
+	if len(report.SectionsChanged) > 0 {
+		sections = strings.Join(report.SectionsChanged, ", ")
+	}
+	fmt.Fprintf(w, "    sections changed: %s\n", sections)
+	fmt.Fprintf(w, "    dissimilarity: %.2f\n", report.Dissimilarity())
+}
+
+// promptApproval asks on m.Stdin (os.Stdin by default) whether to deploy
+func (m *Manager) promptApproval(ctx context.Context) error {
+	in := m.Stdin
+	if in == nil {
+		// Without a terminal nobody can answer, and waiting would hang daemons and CI
+		if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			return fmt.Errorf("%w: no terminal to confirm on (use -confirm file or -confirm none)", ErrDeployDeclined)
+		}
+		in = os.Stdin
+	}
+
+	if len(m.Targets()) > 1 {
+		fmt.Fprintf(log.Reports(), "Deploy these %d binaries? [y/N] ", len(m.Targets()))
+	} else {
+		fmt.Fprint(log.Reports(), "Deploy this binary? [y/N] ")
+	}
+	type reply struct {
+		answer string
+		err    error
+	}
+	// The read cannot be interrupted, so it is left behind on cancellation
+	replies := make(chan reply, 1)
+	go func() {
+		answer, err := bufio.NewReader(in).ReadString('\n')
+		replies <- reply{answer, err}
+	}()
+	var r reply
+	select {
+	case r = <-replies:
+	case <-ctx.Done():
+		fmt.Fprintln(log.Reports())
+		return fmt.Errorf("%w: %w", ErrDeployDeclined, context.Cause(ctx))
+	}
+	if r.err != nil && r.answer == "" {
+		return fmt.Errorf("%w: %v", ErrDeployDeclined, r.err)
+	}
+	switch strings.ToLower(strings.TrimSpace(r.answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return ErrDeployDeclined
+}
+
+// checkApprovalFile deploys only if the approval file names exactly these
+// binaries, one SHA-256 per line in any order. The approval is consumed, so
+// it cannot approve a later binary.
+func (m *Manager) checkApprovalFile(hashes []string) error {
+	path := m.ApprovalFile
+	if path == "" {
+		path = DefaultApprovalFile
+	}
+	data, err := os.ReadFile(path)
+	approved := strings.Fields(decodeText(data))
+	slices.Sort(approved)
+	want := slices.Sorted(slices.Values(hashes))
+	if err != nil || !slices.Equal(approved, want) {
+		if len(hashes) > 1 {
+			return fmt.Errorf("%w: to approve, write %s to %s, one per line, and run again", ErrDeployDeclined, strings.Join(hashes, ", "), path)
+		}
+		return fmt.Errorf("%w: to approve, write %s to %s and run again", ErrDeployDeclined, hashes[0], path)
+	}
+	if err := m.remove(path); err != nil {
+		return fmt.Errorf("failed to consume approval file: %w", err)
+	}
+	logger.Info("Deployment approved", "approval_file", path)
+	return nil
+}
+
+// decodeText returns a hand-written text file as a string. Windows PowerShell
+// writes files with 'echo ... >' as UTF-16 with a byte order mark, and other
+// editors may add a UTF-8 byte order mark.
+func decodeText(data []byte) string {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return string(data[3:])
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		order = binary.BigEndian
+	default:
+		return string(data)
+	}
+	units := make([]uint16, 0, len(data)/2)
+	for i := 2; i+1 < len(data); i += 2 {
+		units = append(units, order.Uint16(data[i:]))
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,45 @@
+package manager
+
+import (
+	"context"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/telemetry"
+)
+
+// RunStage runs one pipeline step and records its duration under the stage name
+func RunStage(stage string, step func() error) error {
+	start := time.Now()
+	err := step()
+	telemetry.StageDuration.ObserveSince(start, stage, telemetry.Status(err))
+	return err
+}
+
+// RunDaemon repeats the full process every interval until ctx is done, which
+// also stops the current run. Failed runs are reported and counted but do not
+// end the loop.
+func (m *Manager) RunDaemon(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for run := 1; ; run++ {
+		logger.Info("Starting daemon run", "run", run)
+		err := m.Run(ctx)
+		telemetry.PipelineRuns.Inc(telemetry.Status(err))
+		if ctx.Err() != nil {
+			logger.Info("Daemon stopped", "run", run, "error", err)
+			return
+		}
+		if err != nil {
+			logger.Error("Daemon run failed", "run", run, "error", err)
+		}
+
+		logger.Info("Waiting for the next run", "interval", interval)
+		select {
+		case <-ctx.Done():
+			logger.Info("Daemon stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
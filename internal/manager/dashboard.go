@@ -0,0 +1,47 @@
+package manager
+
+import (
+	"os"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/dashboard"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+// stageStatus maps the error of a stage to its dashboard status
+func stageStatus(err error) string {
+	if err != nil {
+		return dashboard.Failed
+	}
+	return dashboard.Passed
+}
+
+// showFunctions passes the function outcomes of a rewrite report to the dashboard
+func (m *Manager) showFunctions(rr *rewriter.RewriteReport) {
+	functions := make([]dashboard.Function, len(rr.Functions))
+	for i, f := range rr.Functions {
+		functions[i] = dashboard.Function{Name: f.Function, Status: f.Status, Tokens: f.Tokens}
+	}
+	m.Dashboard.Functions(m.SuspiciousPath, functions)
+}
+
+// watchRewrite shows the function outcomes the running rewriter saves to its
+// report, until stop is closed. A report older than start is from an earlier run.
+func (m *Manager) watchRewrite(start time.Time, stop <-chan struct{}) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	path := rewriter.ReportPath(m.OutputPath)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if info, err := os.Stat(path); err != nil || info.ModTime().Before(start) {
+				continue
+			}
+			if rr, err := rewriter.LoadRewriteReport(path); err == nil {
+				m.showFunctions(rr)
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Hekzory/MetamorphLLM/internal/difftest"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+// differentialTests generates the differential tests of the rewritten
+// functions, or of every function if the rewrite was not reported, for the
+// test overlay. It returns nil if DifferentialTest is off.
+func (m *Manager) differentialTests() (map[string][]byte, error) {
+	if !m.DifferentialTest {
+		return nil, nil
+	}
+	src, err := os.ReadFile(m.SuspiciousPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read original source: %w", err)
+	}
+	var functions []string
+	if m.rewriteReport != nil {
+		functions = []string{}
+		for _, f := range m.rewriteReport.Functions {
+			if f.Status == rewriter.FunctionRewritten {
+				functions = append(functions, f.Function)
+			}
+		}
+	}
+	files, err := difftest.Generate(filepath.Base(m.SuspiciousPath), src, functions, m.BuildTag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate differential tests: %w", err)
+	}
+	logger.Info("Generated differential tests", "functions", files.Functions, "skipped", len(files.Skipped))
+	for name, reason := range files.Skipped {
+		logger.Debug("No differential test", "function", name, "reason", reason)
+	}
+	if files.Test == nil {
+		return nil, nil
+	}
+	return map[string][]byte{
+		difftest.OriginalPath(m.SuspiciousPath): files.Original,
+		difftest.TestPath(m.SuspiciousPath):     files.Test,
+	}, nil
+}
@@ -0,0 +1,238 @@
+package manager
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/metrics"
+	"github.com/Hekzory/MetamorphLLM/internal/redact"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+	"github.com/Hekzory/MetamorphLLM/internal/similarity"
+)
+
+// DefaultGenerationsDir is where RunGenerations keeps the source of every generation
+const DefaultGenerationsDir = ".metamorph/generations"
+
+// Generation is the outcome of one generation of RunGenerations. Metrics are
+// of the generation's source; deltas and similarity compare it to the original.
+type Generation struct {
+	Number      int           `json:"generation"`
+	Source      string        `json:"source"`                 // Where the generation's source is kept
+	FailedStage string        `json:"failed_stage,omitempty"` // Empty when every stage passed
+	Error       string        `json:"error,omitempty"`
+	Duration    time.Duration `json:"duration"`
+	Rewritten   int           `json:"rewritten"` // Functions the rewriter rewrote
+	Failed      int           `json:"failed"`    // Functions whose rewrite failed and were kept as they were
+	Tokens      int64         `json:"tokens"`
+	LOC         int           `json:"loc"`
+	CC          int           `json:"cc"`
+	CogC        int           `json:"cogc"`
+	// MaintainabilityIndex is 0 to 100, higher is easier to maintain
+	MaintainabilityIndex float64 `json:"maintainability_index"`
+	LOCDelta             float64 `json:"loc_delta"`
+	CCDelta              float64 `json:"cc_delta"`
+	CogCDelta            float64 `json:"cogc_delta"`
+	// Similarity is the structural similarity, 1 for the same structure, when
+	// both versions type-check on their own
+	Similarity *float64 `json:"similarity,omitempty"`
+	// BinaryDissimilarity is how different the first target's binary is from
+	// the one compiled from the original, 0 to 1, when the binaries were compared
+	BinaryDissimilarity *float64 `json:"binary_dissimilarity,omitempty"`
+}
+
+// Passed reports whether the generation was rewritten, compiled and tested successfully
+func (g Generation) Passed() bool {
+	return g.FailedStage == ""
+}
+
+// GenerationPath returns where the source of generation n is kept
+func (m *Manager) GenerationPath(n int) string {
+	return filepath.Join(cmp.Or(m.GenerationsDir, DefaultGenerationsDir), fmt.Sprintf("%s.gen%d.go", filepath.Base(m.SuspiciousPath), n))
+}
+
+// GenerationsReportPath returns where RunGenerations saves its results
+func (m *Manager) GenerationsReportPath() string {
+	return filepath.Join(cmp.Or(m.GenerationsDir, DefaultGenerationsDir), filepath.Base(m.SuspiciousPath)+".generations.json")
+}
+
+// RunGenerations rewrites the source n times, each generation from the
+// source of the one before, and measures, compiles and tests every
+// generation. Nothing is deployed. The run stops at the first generation
+// that fails, which is then the last of the results. The results are also
+// saved to GenerationsReportPath.
+func (m *Manager) RunGenerations(ctx context.Context, n int) ([]Generation, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("number of generations must be at least 1, got %d", n)
+	}
+	logger.Info("Starting metamorphic generations", "file", m.SuspiciousPath, "generations", n)
+	m.RunID = newRunID()
+	m.stages, m.rewriteReport = nil, nil
+	m.StartBudget()
+
+	original, err := metrics.CalculateMetrics(m.SuspiciousPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate metrics for original code: %w", err)
+	}
+	if err := m.mkdirAll(filepath.Dir(m.GenerationPath(1))); err != nil {
+		return nil, fmt.Errorf("failed to create generations directory: %w", err)
+	}
+
+	var generations []Generation
+	for i := 1; i <= n; i++ {
+		gen, err := m.runGeneration(ctx, i, original)
+		generations = append(generations, gen)
+		if err != nil {
+			err = fmt.Errorf("generation %d failed: %w", i, err)
+			if saveErr := m.saveGenerations(generations); saveErr != nil {
+				logger.Warn("Failed to save generations", "error", saveErr)
+			}
+			return generations, err
+		}
+	}
+	if err := m.saveGenerations(generations); err != nil {
+		return generations, err
+	}
+	logger.Info("Generations completed successfully", "generations", n, "results", m.GenerationsReportPath())
+	return generations, nil
+}
+
+// runGeneration rewrites generation n from the one before and runs the
+// metrics, compile, binary comparison and test steps on it
+func (m *Manager) runGeneration(ctx context.Context, n int, original *metrics.Metrics) (Generation, error) {
+	start := time.Now()
+	gen := Generation{Number: n, Source: m.GenerationPath(n)}
+	input := m.SuspiciousPath
+	if n > 1 {
+		input = m.GenerationPath(n - 1)
+	}
+	logger.Info("Rewriting generation", "generation", n, "input", input)
+
+	defaults := DefaultPipeline()
+	pipeline := &Pipeline{Steps: []Step{
+		NewStep(StepRewrite, func(ctx context.Context, m *Manager) error {
+			return m.rewriteGeneration(ctx, input, &gen)
+		}),
+		NewStep(StepMetrics, func(context.Context, *Manager) error {
+			return m.measureGeneration(&gen, original)
+		}),
+		defaults.Steps[defaults.Index(StepCompile)],
+		defaults.Steps[defaults.Index(StepBinaryDiff)],
+		defaults.Steps[defaults.Index(StepTest)],
+	}}
+	stages := len(m.stages)
+	err := pipeline.Run(ctx, m)
+	if err != nil {
+		if len(m.stages) > stages {
+			gen.FailedStage = m.stages[len(m.stages)-1].Name
+		}
+		gen.Error = redact.String(err.Error())
+	}
+	if targets := m.Targets(); len(targets) > 0 {
+		gen.BinaryDissimilarity = m.binaryDissimilarity(newBinaryPath(targets[0]))
+	}
+	gen.Duration = time.Since(start)
+	attrs := []any{"generation", n, "passed", gen.Passed(), "loc", gen.LOC, "cc", gen.CC, "cogc", gen.CogC}
+	if gen.Similarity != nil {
+		attrs = append(attrs, "similarity", *gen.Similarity)
+	}
+	logger.Info("Generation finished", append(attrs, "duration", gen.Duration.Round(time.Millisecond))...)
+	return gen, err
+}
+
+// rewriteGeneration rewrites input into OutputPath, where the compile and
+// test steps find it, and keeps a copy at the generation's path
+func (m *Manager) rewriteGeneration(ctx context.Context, input string, gen *Generation) error {
+	err := m.execRewriter(ctx, input, "-output", m.OutputPath)
+	m.loadRewriteReport()
+	if err != nil {
+		return err
+	}
+	if m.rewriteReport != nil {
+		for _, f := range m.rewriteReport.Functions {
+			switch f.Status {
+			case rewriter.FunctionRewritten:
+				gen.Rewritten++
+			case rewriter.FunctionFailed:
+				gen.Failed++
+			}
+		}
+		gen.Tokens = m.rewriteReport.Tokens()
+	}
+
+	content, err := os.ReadFile(m.OutputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read rewritten source file: %w", err)
+	}
+	before := m.hashIfAudited(gen.Source)
+	err = os.WriteFile(gen.Source, content, 0644)
+	m.recordCreate(gen.Source, before, err)
+	if err != nil {
+		return fmt.Errorf("failed to keep generation %d: %w", gen.Number, err)
+	}
+	return nil
+}
+
+// measureGeneration records the metrics of the generation and how they
+// drifted from the original
+func (m *Manager) measureGeneration(gen *Generation, original *metrics.Metrics) error {
+	rewritten, err := metrics.CalculateMetrics(m.OutputPath)
+	if err != nil {
+		return fmt.Errorf("failed to calculate metrics for generation %d: %w", gen.Number, err)
+	}
+	delta := metrics.CalculateDeltaMetrics(original, rewritten)
+	gen.LOC, gen.CC, gen.CogC = rewritten.LOC, rewritten.CC, rewritten.CogC
+	gen.MaintainabilityIndex = math.Round(rewritten.MaintainabilityIndex*100) / 100
+	gen.LOCDelta, gen.CCDelta, gen.CogCDelta = delta.LOC.Percent, delta.CC.Percent, delta.CogC.Percent
+	// Code that does not type-check fails to compile later, with a better error
+	score, err := similarity.CompareFiles(m.SuspiciousPath, m.OutputPath)
+	if err != nil {
+		logger.Warn("Failed to compare the structure of the generation", "generation", gen.Number, "error", err)
+		return nil
+	}
+	s := math.Round(score.Similarity()*100) / 100
+	gen.Similarity = &s
+	return nil
+}
+
+// saveGenerations writes the results to GenerationsReportPath as JSON
+func (m *Manager) saveGenerations(generations []Generation) error {
+	data, err := json.MarshalIndent(generations, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode generations: %w", err)
+	}
+	if err := os.WriteFile(m.GenerationsReportPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write generations: %w", err)
+	}
+	return nil
+}
+
+// WriteGenerations prints one line per generation with its metric drift
+func WriteGenerations(w io.Writer, generations []Generation) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "GEN\tRESULT\tFUNCS\tLOC\tCC\tCOGC\tMI\tSIMILARITY\tBINARY\tTOKENS")
+	for _, g := range generations {
+		status := "PASS"
+		if !g.Passed() {
+			status = "FAIL (" + g.FailedStage + ")"
+		}
+		structure, binary := "-", "-"
+		if g.Similarity != nil {
+			structure = fmt.Sprintf("%.2f", *g.Similarity)
+		}
+		if g.BinaryDissimilarity != nil {
+			binary = fmt.Sprintf("%.2f", *g.BinaryDissimilarity)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d/%d\t%d (%+.1f%%)\t%d (%+.1f%%)\t%d (%+.1f%%)\t%.1f\t%s\t%s\t%d\n",
+			g.Number, status, g.Rewritten, g.Rewritten+g.Failed, g.LOC, g.LOCDelta, g.CC, g.CCDelta, g.CogC, g.CogCDelta,
+			g.MaintainabilityIndex, structure, binary, g.Tokens)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,164 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultImageBase is the base image of built containers. It ships glibc, so
+// binaries built with cgo (the default for net) run unchanged.
+const DefaultImageBase = "gcr.io/distroless/base-debian12"
+
+// ImageLabelPrefix prefixes the labels that carry the run manifest, one per
+// manifest field (e.g. io.metamorphllm.manifest.binary_sha256)
+const ImageLabelPrefix = "io.metamorphllm.manifest."
+
+// imageManifestPath is where the manifest is copied inside the image
+const imageManifestPath = "/etc/metamorph/manifest.json"
+
+// BuildImage builds a container image of the deployed binary tagged ImageTag,
+// with its manifest embedded as a file and as labels, and pushes it if
+// ImagePush is set. The binary must still match its manifest.
+func (m *Manager) BuildImage(ctx context.Context) error {
+	if m.ImageTag == "" {
+		logger.Info("No image tag set, skipping image build")
+		return nil
+	}
+
+	if len(m.Targets()) > 1 {
+		return fmt.Errorf("an image holds one binary, but %d targets were deployed", len(m.Targets()))
+	}
+	if goos != "linux" {
+		return fmt.Errorf("container images run Linux binaries, but the deployed binary was built for %s", goos)
+	}
+	binary := BinaryPath(m.Targets()[0])
+	manifest, err := VerifyBinary(binary, nil)
+	if err != nil {
+		return fmt.Errorf("refusing to package %s: %w", binary, err)
+	}
+
+	buildContext, err := os.MkdirTemp("", "metamorph-image-*")
+	if err != nil {
+		return fmt.Errorf("failed to create build context: %w", err)
+	}
+	defer os.RemoveAll(buildContext)
+
+	name := filepath.Base(binary)
+	files := map[string]string{name: binary, "manifest.json": ManifestPath(binary)}
+	if _, err := os.Stat(SignaturePath(binary)); err == nil {
+		files["manifest.json.sig"] = SignaturePath(binary)
+	}
+	for dst, src := range files {
+		if err := copyFile(src, filepath.Join(buildContext, dst)); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(buildContext, "Dockerfile"), []byte(m.dockerfile(name, files)), 0644); err != nil {
+		return fmt.Errorf("failed to write Dockerfile: %w", err)
+	}
+
+	args := []string{"build", "-t", m.ImageTag}
+	labels, err := imageLabels(manifest)
+	if err != nil {
+		return err
+	}
+	for _, label := range labels {
+		args = append(args, "--label", label)
+	}
+	args = append(args, buildContext)
+
+	logger.Info("Building image", "image", m.ImageTag, "binary", binary, "run", manifest.RunID)
+	if err := m.runImageBuilder(ctx, args...); err != nil {
+		return fmt.Errorf("image build failed: %w", err)
+	}
+	if !m.ImagePush {
+		logger.Info("Built image", "image", m.ImageTag)
+		return nil
+	}
+
+	logger.Info("Pushing image", "image", m.ImageTag)
+	if err := m.runImageBuilder(ctx, "push", m.ImageTag); err != nil {
+		return fmt.Errorf("image push failed: %w", err)
+	}
+	logger.Info("Built and pushed image", "image", m.ImageTag)
+	return nil
+}
+
+// dockerfile returns the Dockerfile that installs the binary and its manifest
+func (m *Manager) dockerfile(name string, files map[string]string) string {
+	base := m.ImageBase
+	if base == "" {
+		base = DefaultImageBase
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "FROM %s\n", base)
+	fmt.Fprintf(&sb, "COPY %s /usr/local/bin/%s\n", name, name)
+	fmt.Fprintf(&sb, "COPY manifest.json %s\n", imageManifestPath)
+	if _, ok := files["manifest.json.sig"]; ok {
+		fmt.Fprintf(&sb, "COPY manifest.json.sig %s.sig\n", imageManifestPath)
+	}
+	fmt.Fprintf(&sb, "ENTRYPOINT [\"/usr/local/bin/%s\"]\n", name)
+	return sb.String()
+}
+
+// imageLabels returns the manifest as sorted key=value labels, plus the
+// standard OCI creation time
+func imageLabels(manifest Manifest) ([]string, error) {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	labels := []string{"org.opencontainers.image.created=" + manifest.Time.UTC().Format(time.RFC3339)}
+	for key, value := range fields {
+		// Nested fields such as artifacts become one label per entry
+		if nested, ok := value.(map[string]any); ok {
+			for subkey, subvalue := range nested {
+				labels = append(labels, fmt.Sprintf("%s%s.%s=%v", ImageLabelPrefix, key, subkey, subvalue))
+			}
+			continue
+		}
+		labels = append(labels, fmt.Sprintf("%s%s=%v", ImageLabelPrefix, key, value))
+	}
+	sort.Strings(labels)
+	return labels, nil
+}
+
+// runImageBuilder runs the docker-compatible CLI with output passed through
+func (m *Manager) runImageBuilder(ctx context.Context, args ...string) error {
+	builder := m.ImageBuilder
+	if builder == "" {
+		builder = "docker"
+	}
+	cmd := exec.CommandContext(ctx, builder, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// copyFile copies src to dst with src's permissions
+func copyFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", src, err)
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", src, err)
+	}
+	if err := os.WriteFile(dst, data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+	return nil
+}
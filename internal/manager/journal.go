@@ -0,0 +1,84 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// swapJournal was written by earlier versions before they swapped the rewritten
+// file into the original's place, so an interrupted swap can be undone on the
+// next start. Builds now use an overlay and leave the tree alone.
+type swapJournal struct {
+	Original        string    `json:"original"`
+	Backup          string    `json:"backup"`
+	Rewritten       string    `json:"rewritten"`
+	OriginalSHA256  string    `json:"original_sha256"`
+	RewrittenSHA256 string    `json:"rewritten_sha256"`
+	Started         time.Time `json:"started"`
+}
+
+// JournalPath returns where the swap journal for the suspicious file is kept
+func (m *Manager) JournalPath() string {
+	return m.SuspiciousPath + ".journal"
+}
+
+// endSwap removes the journal once the original layout has been restored
+func (m *Manager) endSwap() {
+	if err := os.Remove(m.JournalPath()); err != nil && !os.IsNotExist(err) {
+		logger.Warn("Failed to remove swap journal", "error", err)
+	}
+}
+
+// Recover completes the restoration of an interrupted swap recorded in the journal.
+// Files are identified by content hash, so it is safe to call at any time; it does
+// nothing when no journal exists.
+func (m *Manager) Recover() error {
+	data, err := os.ReadFile(m.JournalPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read swap journal: %w", err)
+	}
+
+	var j swapJournal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return fmt.Errorf("failed to parse swap journal %s: %w", m.JournalPath(), err)
+	}
+	logger.Info("Found swap journal, checking the original file", "started", j.Started.Format(time.RFC3339), "original", j.Original)
+
+	// The rewritten content is still in the original's place: move it back
+	if j.RewrittenSHA256 != "" && fileHash(j.Original) == j.RewrittenSHA256 && !exists(j.Rewritten) {
+		logger.Info("Recovering rewritten file", "file", j.Rewritten)
+		if err := m.rename(j.Original, j.Rewritten); err != nil {
+			return fmt.Errorf("failed to recover rewritten file: %w", err)
+		}
+	}
+
+	// The original content is still in the backup: put it back
+	if !exists(j.Original) && fileHash(j.Backup) == j.OriginalSHA256 {
+		logger.Info("Restoring original file from backup", "file", j.Original, "backup", j.Backup)
+		if err := m.rename(j.Backup, j.Original); err != nil {
+			return fmt.Errorf("failed to restore original file from backup: %w", err)
+		}
+	}
+
+	if fileHash(j.Original) != j.OriginalSHA256 {
+		return fmt.Errorf("cannot recover %s automatically: content does not match the journal; inspect %s, %s and the journal %s",
+			j.Original, j.Backup, j.Rewritten, m.JournalPath())
+	}
+	if j.RewrittenSHA256 != "" && fileHash(j.Rewritten) != j.RewrittenSHA256 {
+		logger.Warn("Rewritten file does not match the journal", "file", j.Rewritten)
+	}
+
+	m.endSwap()
+	logger.Info("Swap journal resolved, original source is intact")
+	return nil
+}
+
+// exists reports whether a path exists
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,180 @@
+package manager
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/dashboard"
+	"github.com/Hekzory/MetamorphLLM/internal/redact"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+// StageResult is the outcome of one pipeline stage run through Stage
+type StageResult struct {
+	Name     string
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+	Skipped  bool // Not run because the time budget was exceeded or the run was canceled
+}
+
+// Stage runs one pipeline step like RunStage and also records its outcome
+// for the JUnit report and the dashboard. Once ctx is done, the step is not
+// started.
+func (m *Manager) Stage(ctx context.Context, name string, step func() error) error {
+	start := time.Now()
+	err := m.checkBudget(name)
+	if err == nil && ctx.Err() != nil {
+		err = fmt.Errorf("run stopped before %s: %w", name, context.Cause(ctx))
+	}
+	if err != nil {
+		m.stages = append(m.stages, StageResult{Name: name, Start: start, Err: err, Skipped: true})
+		m.Dashboard.StageFinished(m.SuspiciousPath, name, dashboard.Skipped, 0)
+		return err
+	}
+	m.Dashboard.StageStarted(m.SuspiciousPath, name)
+	err = RunStage(name, step)
+	m.stages = append(m.stages, StageResult{Name: name, Start: start, Duration: time.Since(start), Err: err})
+	m.Dashboard.StageFinished(m.SuspiciousPath, name, stageStatus(err), time.Since(start))
+	return err
+}
+
+// junitSuites is the root element of a JUnit XML report
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Time     float64      `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+// junitSuite groups the stages, or the function rewrites of one file
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      float64     `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr,omitempty"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+// junitCase is one stage or function rewrite
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+// junitFailure carries the error of a failed stage or function
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"` // Kind of a function's error, e.g. "rate_limited"
+	Text    string `xml:",chardata"`
+}
+
+// junitSkipped marks a function the strategy returned unchanged, or a stage
+// or function the time budget did not leave room for
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+// add appends a test case and updates the suite totals
+func (s *junitSuite) add(c junitCase) {
+	s.Cases = append(s.Cases, c)
+	s.Tests++
+	s.Time += c.Time
+	if c.Failure != nil {
+		s.Failures++
+	}
+	if c.Skipped != nil {
+		s.Skipped++
+	}
+}
+
+// loadRewriteReport reads the function outcomes the rewriter reported. A
+// reused rewritten file may have been produced without a report.
+func (m *Manager) loadRewriteReport() {
+	rr, err := rewriter.LoadRewriteReport(rewriter.ReportPath(m.OutputPath))
+	if err != nil {
+		m.rewriteReport = nil
+		return
+	}
+	m.rewriteReport = rr
+	if m.Dashboard != nil {
+		m.showFunctions(rr)
+	}
+}
+
+// WriteJUnit writes the stages run so far, and the function rewrites the
+// rewriter reported, as JUnit XML to JUnitPath. It does nothing without a path.
+func (m *Manager) WriteJUnit() error {
+	if m.JUnitPath == "" {
+		return nil
+	}
+
+	stages := junitSuite{Name: "pipeline"}
+	for _, s := range m.stages {
+		if stages.Timestamp == "" {
+			stages.Timestamp = s.Start.UTC().Format(time.RFC3339)
+		}
+		c := junitCase{Name: s.Name, Classname: "metamorph.pipeline", Time: s.Duration.Seconds()}
+		switch {
+		case s.Skipped:
+			c.Skipped = &junitSkipped{Message: redact.String(s.Err.Error())}
+		case s.Err != nil:
+			message := redact.String(s.Err.Error())
+			c.Failure = &junitFailure{Message: firstLine(message), Text: message}
+		}
+		stages.add(c)
+	}
+	report := junitSuites{Name: "metamorph", Suites: []junitSuite{stages}}
+
+	if rr := m.rewriteReport; rr != nil {
+		functions := junitSuite{Name: "rewrite " + rr.Source}
+		for _, f := range rr.Functions {
+			c := junitCase{Name: f.Function, Classname: "metamorph.rewrite." + filepath.ToSlash(rr.Source), Time: f.Duration.Seconds()}
+			switch f.Status {
+			case rewriter.FunctionFailed:
+				c.Failure = &junitFailure{Message: firstLine(f.Error), Type: f.Kind, Text: f.Error}
+			case rewriter.FunctionUnchanged:
+				c.Skipped = &junitSkipped{Message: "returned unchanged"}
+			case rewriter.FunctionSkipped:
+				c.Skipped = &junitSkipped{Message: f.Error}
+			}
+			functions.add(c)
+		}
+		report.Suites = append(report.Suites, functions)
+	}
+
+	for _, s := range report.Suites {
+		report.Tests += s.Tests
+		report.Failures += s.Failures
+		report.Time += s.Time
+	}
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JUnit report: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(m.JUnitPath), 0755); err != nil {
+		return fmt.Errorf("failed to create JUnit report directory: %w", err)
+	}
+	if err := os.WriteFile(m.JUnitPath, append([]byte(xml.Header), append(data, '\n')...), 0644); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	return nil
+}
+
+// firstLine returns the first line of a multi-line message
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
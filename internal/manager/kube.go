@@ -0,0 +1,467 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/log"
+	"github.com/Hekzory/MetamorphLLM/internal/metrics"
+	"github.com/Hekzory/MetamorphLLM/internal/redact"
+)
+
+// JobResultPrefix marks the line where a job prints its JobResult as JSON
+const JobResultPrefix = "METAMORPH_JOB_RESULT "
+
+// jobTTL is how long finished Jobs are kept for inspection before Kubernetes deletes them
+const jobTTL = time.Hour
+
+// CorpusItem is one suspicious source file run as its own Kubernetes Job
+type CorpusItem struct {
+	Source    string // Source file, relative to the image's working directory
+	TargetDir string // Binary directory built from it (empty uses the manager's)
+}
+
+// ParseCorpusItem parses "source.go" or "source.go=cmd/target"
+func ParseCorpusItem(spec string) (CorpusItem, error) {
+	source, target, _ := strings.Cut(strings.TrimSpace(spec), "=")
+	if source == "" {
+		return CorpusItem{}, fmt.Errorf("invalid corpus item %q: expected source.go[=target-dir]", spec)
+	}
+	return CorpusItem{Source: source, TargetDir: target}, nil
+}
+
+// JobResult is the outcome of the dry-run pipeline for one corpus item
+type JobResult struct {
+	Source      string        `json:"source"`
+	Job         string        `json:"job,omitempty"`
+	FailedStage string        `json:"failed_stage,omitempty"` // Empty when every stage passed
+	Error       string        `json:"error,omitempty"`
+	Duration    time.Duration `json:"duration"`
+	LOCDelta    float64       `json:"loc_delta"`
+	CCDelta     float64       `json:"cc_delta"`
+	CogCDelta   float64       `json:"cogc_delta"`
+}
+
+// Passed reports whether the item was rewritten, compiled and tested successfully
+func (r JobResult) Passed() bool {
+	return r.FailedStage == ""
+}
+
+// RunJob runs the pipeline up to the smoke run without deploying and returns
+// its outcome instead of an error. This is what each Kubernetes Job executes.
+func (m *Manager) RunJob(ctx context.Context) JobResult {
+	start := time.Now()
+	result := JobResult{Source: m.SuspiciousPath}
+	m.StartBudget()
+	// Every step up to the deployment
+	pipeline := DefaultPipeline()
+	for _, step := range pipeline.Steps[:pipeline.Index(StepConfirm)] {
+		name := step.Name()
+		err := m.checkBudget(name)
+		if err == nil && ctx.Err() != nil {
+			err = fmt.Errorf("run stopped before %s: %w", name, context.Cause(ctx))
+		}
+		if err == nil {
+			err = RunStage(name, func() error { return step.Run(ctx, m) })
+		}
+		if err != nil {
+			result.FailedStage, result.Error = name, redact.String(err.Error())
+			break
+		}
+		if name == StepMetrics {
+			result.LOCDelta, result.CCDelta, result.CogCDelta = m.deltas()
+		}
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+// deltas returns the LOC, CC and CogC changes of the rewrite in percent
+func (m *Manager) deltas() (float64, float64, float64) {
+	original, err := metrics.CalculateMetrics(m.SuspiciousPath)
+	if err != nil {
+		return 0, 0, 0
+	}
+	rewritten, err := metrics.CalculateMetrics(m.OutputPath)
+	if err != nil {
+		return 0, 0, 0
+	}
+	delta := metrics.CalculateDeltaMetrics(original, rewritten)
+	return delta.LOC.Percent, delta.CC.Percent, delta.CogC.Percent
+}
+
+// WriteJobResult prints the result line that RunCorpusJobs collects from job logs
+func WriteJobResult(w io.Writer, result JobResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode job result: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", JobResultPrefix, data)
+	return err
+}
+
+// KubeConfig describes how corpus items are scheduled as Kubernetes Jobs
+type KubeConfig struct {
+	Image        string        // Image with the repository as working directory, go, manager and rewriter
+	Namespace    string        // Empty uses kubectl's current namespace
+	Secret       string        // Secret whose keys are exposed to jobs as environment variables (API keys)
+	Parallelism  int           // Maximum number of Jobs running at once
+	Timeout      time.Duration // Deadline of each Job
+	Kubectl      string        // kubectl binary (defaults to "kubectl")
+	PollInterval time.Duration // Time between Job status checks (defaults to 5s)
+}
+
+// FilterCorpus drops the items whose source is vendored or generated code
+// (see Manager.Skip), so no Job is scheduled for them
+func (m *Manager) FilterCorpus(items []CorpusItem) ([]CorpusItem, error) {
+	var kept []CorpusItem
+	for _, item := range items {
+		reason, err := m.skipReason(item.Source)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			logger.Info("Skipping file", "file", item.Source, "reason", reason)
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept, nil
+}
+
+// RunCorpusJobs schedules one Job per corpus item, at most cfg.Parallelism at
+// a time, waits for each and collects its result from the job log. Jobs that
+// end without a result are reported as failed in the "job" stage. Results are
+// returned in the order of items. Once ctx is done, no more Jobs are created
+// and the running ones are deleted.
+func (m *Manager) RunCorpusJobs(ctx context.Context, cfg KubeConfig, items []CorpusItem) []JobResult {
+	if m.RunID == "" {
+		m.RunID = newRunID()
+	}
+	parallelism := cfg.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	for _, item := range items {
+		m.Dashboard.Pending(item.Source)
+	}
+
+	results := make([]JobResult, len(items))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			m.Dashboard.Begin(item.Source)
+			m.Dashboard.StageStarted(item.Source, "job")
+			results[i] = m.runCorpusJob(ctx, cfg, item, i)
+			m.showJobResult(results[i])
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// showJobResult passes the outcome of a corpus job to the dashboard
+func (m *Manager) showJobResult(result JobResult) {
+	var err error
+	if !result.Passed() {
+		err = fmt.Errorf("%s: %s", result.FailedStage, result.Error)
+	}
+	if result.Passed() || result.LOCDelta != 0 || result.CCDelta != 0 || result.CogCDelta != 0 {
+		m.Dashboard.Metrics(result.Source, result.LOCDelta, result.CCDelta, result.CogCDelta)
+	}
+	m.Dashboard.StageFinished(result.Source, "job", stageStatus(err), result.Duration)
+	m.Dashboard.Finish(result.Source, err)
+}
+
+// runCorpusJob creates the Job of one corpus item and waits for its result
+func (m *Manager) runCorpusJob(ctx context.Context, cfg KubeConfig, item CorpusItem, index int) JobResult {
+	name := fmt.Sprintf("metamorph-%s-%d", kubeName(m.RunID), index)
+	failed := func(err error) JobResult {
+		return JobResult{Source: item.Source, Job: name, FailedStage: "job", Error: redact.String(err.Error())}
+	}
+	if ctx.Err() != nil {
+		return failed(fmt.Errorf("job %s not created: %w", name, context.Cause(ctx)))
+	}
+
+	manifest, err := json.Marshal(m.jobManifest(cfg, item, name))
+	if err != nil {
+		return failed(fmt.Errorf("failed to encode job: %w", err))
+	}
+	if _, err := kubectl(ctx, cfg, manifest, "apply", "-f", "-"); err != nil {
+		return failed(fmt.Errorf("failed to create job %s: %w", name, err))
+	}
+	logger.Info("Created job", "job", name, "file", item.Source)
+
+	if err := waitForJob(ctx, cfg, name); err != nil {
+		if ctx.Err() != nil {
+			// A canceled run leaves nothing running in the cluster
+			if _, err := kubectl(context.WithoutCancel(ctx), cfg, nil, "delete", "job", name, "--ignore-not-found"); err != nil {
+				logger.Warn("Failed to delete job", "job", name, "error", err)
+			}
+		}
+		return failed(err)
+	}
+	logs, err := kubectl(ctx, cfg, nil, "logs", "job/"+name)
+	if err != nil {
+		return failed(fmt.Errorf("failed to read logs of job %s: %w", name, err))
+	}
+	result, ok := parseJobResult(logs)
+	if !ok {
+		return failed(fmt.Errorf("job %s ended without a result:\n%s", name, lastLines(logs, 20)))
+	}
+	result.Job = name
+	logger.Info("Job finished", "job", name, "status", result.status())
+	return result
+}
+
+// jobManifest returns the batch/v1 Job that runs the manager for one item
+func (m *Manager) jobManifest(cfg KubeConfig, item CorpusItem, name string) map[string]any {
+	labels := map[string]string{"app.kubernetes.io/name": "metamorph", "metamorph/run": kubeName(m.RunID)}
+	container := map[string]any{
+		"name":    "manager",
+		"image":   cfg.Image,
+		"command": append([]string{"manager"}, m.jobArgs(item)...),
+	}
+	if cfg.Secret != "" {
+		container["envFrom"] = []map[string]any{{"secretRef": map[string]string{"name": cfg.Secret}}}
+	}
+	spec := map[string]any{
+		"backoffLimit":            0, // A rewrite is not retried; its failure is the result
+		"ttlSecondsAfterFinished": int(jobTTL.Seconds()),
+		"template": map[string]any{
+			"metadata": map[string]any{"labels": labels},
+			"spec": map[string]any{
+				"restartPolicy": "Never",
+				"containers":    []map[string]any{container},
+			},
+		},
+	}
+	if cfg.Timeout > 0 {
+		spec["activeDeadlineSeconds"] = int(cfg.Timeout.Seconds())
+	}
+	metadata := map[string]any{"name": name, "labels": labels}
+	if cfg.Namespace != "" {
+		metadata["namespace"] = cfg.Namespace
+	}
+	return map[string]any{"apiVersion": "batch/v1", "kind": "Job", "metadata": metadata, "spec": spec}
+}
+
+// jobArgs returns the manager flags that run one item inside a Job
+func (m *Manager) jobArgs(item CorpusItem) []string {
+	target := item.TargetDir
+	if target == "" {
+		target = m.TargetBinaryDir
+	}
+	args := []string{
+		"-job",
+		"-rewriter", m.RewriterBinary,
+		"-api", m.RewriterAPI,
+		"-suspicious", item.Source,
+		"-target-dir", target,
+		"-timeout", m.TestTimeout,
+		"-sandbox", string(m.Sandbox.Mode),
+		"-sandbox-network=" + strconv.FormatBool(m.Sandbox.Network),
+		"-smoke=" + strconv.FormatBool(m.SmokeTest),
+		"-smoke-timeout", m.SmokeTimeout.String(),
+		"-build-tag", m.BuildTag,
+	}
+	args = append(args, log.Current().Args()...)
+	if m.PolicyPath != "" {
+		args = append(args, "-policy", m.PolicyPath)
+	}
+	if m.ConfigPath != "" {
+		// Relative to the repository, the working directory of the jobs
+		args = append(args, "-config", m.ConfigPath)
+	}
+	if len(m.TestPackages) > 0 {
+		args = append(args, "-test-packages", strings.Join(m.TestPackages, ","))
+	}
+	if m.DifferentialTest {
+		args = append(args, "-differential-tests")
+	}
+	if m.Mutants > 0 {
+		args = append(args, "-mutants", strconv.Itoa(m.Mutants), "-min-mutation-score", strconv.FormatFloat(m.MinMutationScore, 'f', -1, 64))
+	}
+	if m.MaxDuration > 0 {
+		args = append(args, "-max-duration", m.MaxDuration.String())
+	}
+	args = append(args, m.usageArgs()...)
+	args = append(args, m.exampleArgs()...)
+	return append(args, m.skipArgs()...)
+}
+
+// waitForJob polls the Job until it has succeeded or failed, or ctx is done
+func waitForJob(ctx context.Context, cfg KubeConfig, name string) error {
+	interval := cfg.PollInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	// The Job enforces its own deadline; this only guards against a stuck API
+	var deadline time.Time
+	if cfg.Timeout > 0 {
+		deadline = time.Now().Add(cfg.Timeout + time.Minute)
+	}
+	for {
+		status, err := kubectl(ctx, cfg, nil, "get", "job", name, "-o", "jsonpath={.status.succeeded}/{.status.failed}")
+		if err != nil {
+			return fmt.Errorf("failed to get status of job %s: %w", name, err)
+		}
+		succeeded, failed, _ := strings.Cut(strings.TrimSpace(string(status)), "/")
+		if (succeeded != "" && succeeded != "0") || (failed != "" && failed != "0") {
+			return nil
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return fmt.Errorf("job %s did not finish within %v", name, cfg.Timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for job %s: %w", name, context.Cause(ctx))
+		case <-time.After(interval):
+		}
+	}
+}
+
+// kubectl runs kubectl with the configured namespace and returns its stdout
+func kubectl(ctx context.Context, cfg KubeConfig, stdin []byte, args ...string) ([]byte, error) {
+	binary := cfg.Kubectl
+	if binary == "" {
+		binary = "kubectl"
+	}
+	if cfg.Namespace != "" {
+		args = append([]string{"--namespace", cfg.Namespace}, args...)
+	}
+	cmd := exec.CommandContext(ctx, binary, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// parseJobResult returns the last result line of a job log
+func parseJobResult(logs []byte) (JobResult, bool) {
+	var result JobResult
+	found := false
+	scanner := bufio.NewScanner(bytes.NewReader(logs))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), JobResultPrefix)
+		if ok && json.Unmarshal([]byte(data), &result) == nil {
+			found = true
+		}
+	}
+	return result, found
+}
+
+// lastLines returns at most n trailing lines of a log
+func lastLines(logs []byte, n int) string {
+	lines := strings.Split(strings.TrimRight(string(logs), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// kubeName turns a run ID into a valid Kubernetes name segment
+func kubeName(runID string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		default:
+			return '-'
+		}
+	}, runID)
+}
+
+// status describes a result in one word for progress output
+func (r JobResult) status() string {
+	if r.Passed() {
+		return "passed"
+	}
+	return "failed at " + r.FailedStage
+}
+
+// WriteJobReport prints one row per corpus item followed by the pass rate,
+// the failures per stage and the mean metric deltas of the passed items
+func WriteJobReport(w io.Writer, results []JobResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SOURCE\tJOB\tSTATUS\tLOC Δ%\tCC Δ%\tCogC Δ%\tTIME")
+	var passed int
+	var loc, cc, cogc float64
+	failures := make(map[string]int)
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.2f\t%.2f\t%.2f\t%v\n",
+			r.Source, r.Job, r.status(), r.LOCDelta, r.CCDelta, r.CogCDelta, r.Duration.Round(time.Second))
+		if r.Passed() {
+			passed++
+			loc, cc, cogc = loc+r.LOCDelta, cc+r.CCDelta, cogc+r.CogCDelta
+		} else {
+			failures[r.FailedStage]++
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nPassed: %d/%d\n", passed, len(results))
+	if len(failures) > 0 {
+		stages := make([]string, 0, len(failures))
+		for stage := range failures {
+			stages = append(stages, stage)
+		}
+		sort.Strings(stages)
+		parts := make([]string, len(stages))
+		for i, stage := range stages {
+			parts[i] = fmt.Sprintf("%s=%d", stage, failures[stage])
+		}
+		fmt.Fprintf(w, "Failures by stage: %s\n", strings.Join(parts, ", "))
+	}
+	if passed > 0 {
+		n := float64(passed)
+		fmt.Fprintf(w, "Mean deltas of passed items: LOC %.2f%%, CC %.2f%%, CogC %.2f%%\n", loc/n, cc/n, cogc/n)
+	}
+	for _, r := range results {
+		if !r.Passed() {
+			fmt.Fprintf(w, "\n%s (%s):\n%s\n", r.Source, r.FailedStage, r.Error)
+		}
+	}
+	return nil
+}
+
+// WriteJobResults writes the raw results as indented JSON to path
+func WriteJobResults(path string, results []JobResult) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode job results: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write job results: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package manager
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Windows error codes of files held open by another process, such as a
+// running binary or a virus scanner inspecting a freshly built one
+const (
+	errorAccessDenied     syscall.Errno = 5
+	errorSharingViolation syscall.Errno = 32
+	errorLockViolation    syscall.Errno = 33
+)
+
+// isLocked reports whether err means the file is in use by another process
+func isLocked(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	return errno == errorAccessDenied || errno == errorSharingViolation || errno == errorLockViolation
+}
@@ -2,230 +2,420 @@
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
-
+	"runtime"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/bindiff"
+	"github.com/Hekzory/MetamorphLLM/internal/dashboard"
+	"github.com/Hekzory/MetamorphLLM/internal/log"
 	"github.com/Hekzory/MetamorphLLM/internal/metrics"
+	"github.com/Hekzory/MetamorphLLM/internal/mutation"
+	"github.com/Hekzory/MetamorphLLM/internal/redact"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+	"github.com/Hekzory/MetamorphLLM/internal/sandbox"
+	"github.com/Hekzory/MetamorphLLM/internal/scanner"
+	"github.com/Hekzory/MetamorphLLM/internal/similarity"
+	"github.com/Hekzory/MetamorphLLM/internal/telemetry"
 )
 
+var logger = log.Component("manager")
+
 // Manager handles the automated process of rewriting code, testing, and deploying
 type Manager struct {
-	RewriterBinary  string
-	SuspiciousPath  string // Path to the suspicious source file (e.g., internal/suspicious/suspicious.go)
-	OutputPath      string // Path for the rewritten source file
-	TargetBinaryDir string // Directory where the final binary should be built (e.g., cmd/suspicious)
-	TestTimeout     string
-	KeepRewritten   bool
-	ForceRewrite    bool
+	RewriterBinary   string
+	RewriterAPI      string // API passed to the rewriter binary ("openrouter", "gemini", "anthropic", "ollama", "openai-compatible" or "none")
+	ConfigPath       string // Config file passed to the rewriter binary, which applies its rewriter section (empty for none)
+	SuspiciousPath   string // Path to the suspicious source file (e.g., internal/suspicious/suspicious.go)
+	OutputPath       string // Path for the rewritten source file
+	TargetBinaryDir  string // Directory where the final binary should be built (e.g., cmd/suspicious)
+	BuildTag         string // Build tag the rewritten file is constrained to (empty for none)
+	TestTimeout      string
+	TestPackages     []string          // Packages tested against the rewritten code (defaults to the suspicious package)
+	TestCommands     map[string]string // Shell commands replacing go test, keyed by tested package ("" for every package)
+	TargetDirs       []string          // Directories of every binary built and deployed in one run (defaults to TargetBinaryDir)
+	TestJobs         int               // Maximum number of packages tested concurrently
+	Mutants          int               // Mutants of the original tested before trusting the tests (0 disables mutation testing)
+	MinMutationScore float64           // Share of compiling mutants the tests must kill, from 0 to 1
+	KeepRewritten    bool
+	ForceRewrite     bool
+	Incremental      bool               // Let the rewriter reuse previous rewrites of unchanged functions
+	Shots            int                // Reviewed examples shown in each rewrite prompt (0 for the single built-in one)
+	ExampleBank      string             // Example bank the shots are drawn from (empty for the built-in bank)
+	Skip             rewriter.SkipRules // Kinds of suspicious files that are not rewritten (vendored, generated)
+	AuditLogPath     string             // Append-only JSONL log of every file mutation (empty disables auditing)
+	BuildCacheDir    string             // GOCACHE shared by every build and test (empty uses the go default)
+	Sandbox          sandbox.Config     // Isolation for test binaries and the smoke run of rewritten code
+	SmokeTest        bool               // Run the compiled rewritten binary in the sandbox before deploying
+	BinaryDiff       bool               // Compare the binaries compiled from the original and the rewrite
+	Scanners         []scanner.Scanner  // Static scanners run over the binaries of the original and the rewrite
+	YaraRules        []string           // YARA rule files matched against the source and binaries of the original and the rewrite
+	DifferentialTest bool               // Test the rewritten functions against the original's on generated tables of inputs
+	SmokeTimeout     time.Duration
+	SigningKeyPath   string      // Ed25519 key that signs the manifest of each deployed binary (empty leaves it unsigned)
+	RunID            string      // Identifies the pipeline run in deployment manifests (set by Run)
+	PolicyPath       string      // JSON policy every rewrite is checked against (empty disables it)
+	Confirm          ConfirmMode // How a deployment is approved
+	ApprovalFile     string      // Approval file for ConfirmFile (defaults to DefaultApprovalFile)
+	Stdin            io.Reader   // Where ConfirmPrompt reads the answer (defaults to the terminal)
+	ImageTag         string      // Container image built from the deployed binary (empty skips the image)
+	ImagePush        bool        // Push ImageTag after building it
+	ImageBase        string      // Base image (defaults to DefaultImageBase)
+	ImageBuilder     string      // docker-compatible CLI that builds and pushes the image
+	JUnitPath        string      // JUnit XML report of the stages and function rewrites (empty disables it)
+	ArtifactURL      string      // s3:// or gs:// bucket and prefix run artifacts are uploaded to (empty disables uploads)
+	ArtifactEndpoint string      // S3-compatible endpoint replacing the provider's, e.g. for MinIO
+	Restart          RestartMode // How a running instance picks up the deployed binary
+	RestartPIDFile   string      // PID file of the running instance for RestartSignal
+	ReloadSignal     string      // Signal sent to the process in RestartPIDFile (defaults to DefaultReloadSignal)
+	RestartUnit      string      // systemd unit restarted with RestartSystemd
+	Systemctl        string      // systemctl-compatible CLI that restarts RestartUnit
+	RestartTimeout   time.Duration
+	MaxDuration      time.Duration        // Time budget of a run; no stage starts once it is exceeded (0 for no limit)
+	MaxCost          float64              // USD the rewriter may spend on API calls per run (0 for no limit)
+	MaxTotalTokens   int64                // Tokens the rewriter may use on API calls per run (0 for no limit)
+	Dashboard        *dashboard.Dashboard // Shows the progress of runs (nil for the log only)
+	Pipeline         *Pipeline            // Steps of a run (nil for DefaultPipeline)
+	GenerationsDir   string               // Where RunGenerations keeps every generation's source (defaults to DefaultGenerationsDir)
+
+	stages         []StageResult              // Stages of the current run, for the JUnit report
+	rewriteReport  *rewriter.RewriteReport    // Function outcomes and token usage of the current rewrite
+	mutationReport *mutation.Report           // Mutants of the current run, for the deployment summary and manifest
+	binaryDiffs    map[string]*bindiff.Report // Comparisons with the original by new binary path, for the manifests
+	scanDeltas     map[string][]scanner.Delta // Detections of each scanner by new binary path, for the manifests
+	yaraStopped    map[string][]string        // YARA rules that stopped matching by rewritten source or new binary path
+	deadline       time.Time                  // When the current run's time budget is exceeded (zero for no limit)
+	rewrote        bool                       // Whether the current run ran the rewriter
 }
 
 // NewManager creates a new Manager instance with default values
 func NewManager() *Manager {
 	return &Manager{
 		RewriterBinary:  "rewriter",
+		RewriterAPI:     "openrouter",
 		SuspiciousPath:  "internal/suspicious/suspicious.go",              // Default to the actual logic file
 		OutputPath:      "internal/suspicious/suspicious.go.rewritten.go", // Default rewritten output path
 		TargetBinaryDir: "cmd/suspicious",                                 // Default directory for the final binary
+		BuildTag:        rewriter.DefaultBuildTag,
+		Skip:            rewriter.DefaultSkipRules(),
 		TestTimeout:     "30s",
+		TestJobs:        runtime.NumCPU(),
+		Sandbox:         sandbox.Config{Mode: sandbox.ModeAuto},
+		SmokeTest:       true,
+		BinaryDiff:      true,
+		SmokeTimeout:    30 * time.Second,
+		Confirm:         ConfirmPrompt,
+		ApprovalFile:    DefaultApprovalFile,
+		ImageBase:       DefaultImageBase,
+		ImageBuilder:    "docker",
+		Restart:         RestartNone,
+		ReloadSignal:    DefaultReloadSignal,
+		RestartTimeout:  30 * time.Second,
+		Systemctl:       "systemctl",
 		KeepRewritten:   true, // Default to keeping rewritten files
 		ForceRewrite:    false,
 	}
 }
 
-// RunRewriter executes the rewriter binary to generate rewritten code
-func (m *Manager) RunRewriter() error {
-	fmt.Println("Running rewriter...")
+// RunRewriter executes the rewriter binary to generate rewritten code.
+// Canceling ctx kills the rewriter.
+func (m *Manager) RunRewriter(ctx context.Context) error {
+	logger.Info("Running rewriter")
+	if reason, err := m.skipReason(m.SuspiciousPath); err != nil {
+		return err
+	} else if reason != "" {
+		return fmt.Errorf("%s is %s and is not rewritten (override with -skip)", m.SuspiciousPath, reason)
+	}
+	// Also picks up the report of a rewritten file that is reused
+	defer m.loadRewriteReport()
 
 	// Check if the rewritten file already exists
 	if !m.ForceRewrite {
 		if _, err := os.Stat(m.OutputPath); err == nil {
-			fmt.Printf("Rewritten file already exists at %s, skipping rewriting step\n", m.OutputPath)
+			telemetry.CacheLookups.Inc("rewritten-file", telemetry.CacheHit)
+			logger.Info("Rewritten file already exists, skipping rewriting step", "file", m.OutputPath)
 			return nil
 		}
+		telemetry.CacheLookups.Inc("rewritten-file", telemetry.CacheMiss)
 	} else if _, err := os.Stat(m.OutputPath); err == nil {
-		fmt.Printf("Rewritten file exists at %s but force rewrite is enabled, proceeding with rewrite\n", m.OutputPath)
+		logger.Info("Rewritten file exists but force rewrite is enabled, proceeding with rewrite", "file", m.OutputPath)
 	}
 
-	cmd := exec.Command(m.RewriterBinary, "-input", m.SuspiciousPath)
+	return m.execRewriter(ctx, m.SuspiciousPath)
+}
+
+// execRewriter runs the rewriter binary on input with the run's options,
+// followed by extra flags
+func (m *Manager) execRewriter(ctx context.Context, input string, extra ...string) error {
+	args := []string{"-api", m.RewriterAPI, "-input", input, "-build-tag", m.BuildTag}
+	if m.ConfigPath != "" {
+		args = append(args, "-config", m.ConfigPath)
+	}
+	if m.Incremental {
+		args = append(args, "-incremental")
+	}
+	args = append(args, log.Current().Args()...)
+	args = append(args, m.exampleArgs()...)
+	args = append(args, m.skipArgs()...)
+	// The report carries the function outcomes and the token usage of the run
+	args = append(args, "-report", rewriter.ReportPath(m.OutputPath))
+	if left, ok := m.remainingBudget(); ok {
+		// The rewriter stops sending functions when the run's budget is exceeded
+		args = append(args, "-max-duration", left.String())
+	}
+	args = append(args, m.usageArgs()...)
+	args = append(args, extra...)
+	cmd := exec.CommandContext(ctx, m.RewriterBinary, args...)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("rewriter failed: %v\nStderr: %s", err, stderr.String())
+	before := m.hashIfAudited(m.OutputPath)
+	stop := make(chan struct{})
+	if m.Dashboard != nil {
+		go m.watchRewrite(time.Now(), stop)
+	}
+	err := cmd.Run()
+	close(stop)
+	m.rewrote = true
+	m.recordCreate(m.OutputPath, before, err)
+	if err != nil {
+		return fmt.Errorf("rewriter failed: %v\nStderr: %s", err, redact.String(stderr.String()))
 	}
 
-	fmt.Println("Rewriter output:", stdout.String())
+	// The rewriter logs with the same options, so its records pass through
+	_, _ = os.Stdout.Write(stdout.Bytes())
+	_, _ = os.Stderr.Write(stderr.Bytes())
 	return nil
 }
 
-// CompileRewritten compiles the suspicious code using the rewritten source file
-func (m *Manager) CompileRewritten() error {
-	fmt.Println("Compiling rewritten code...")
-
-	// Get the directory of the suspicious source file
-	suspSourceDir := filepath.Dir(m.SuspiciousPath)
-	rewrittenFile := m.OutputPath
-
-	// Original source file name (e.g., suspicious.go)
-	originalFileName := filepath.Base(m.SuspiciousPath)
-	originalFile := filepath.Join(suspSourceDir, originalFileName)
-	backupFile := filepath.Join(suspSourceDir, originalFileName+".backup")
-
-	// Ensure the target binary directory exists
-	if err := os.MkdirAll(m.TargetBinaryDir, 0755); err != nil {
-		return fmt.Errorf("failed to create target binary directory %s: %w", m.TargetBinaryDir, err)
+// exampleArgs returns the flags that select the prompt examples, which the
+// rewriter and manager jobs share
+func (m *Manager) exampleArgs() []string {
+	var args []string
+	if m.Shots > 0 {
+		args = append(args, "-shots", strconv.Itoa(m.Shots))
 	}
+	if m.ExampleBank != "" {
+		args = append(args, "-examples", m.ExampleBank)
+	}
+	return args
+}
 
-	// Backup original source file
-	if _, err := os.Stat(originalFile); err == nil {
-		if err := os.Rename(originalFile, backupFile); err != nil {
-			return fmt.Errorf("failed to backup original source file %s: %w", originalFile, err)
-		}
-	} else if !os.IsNotExist(err) {
-		return fmt.Errorf("failed to check original source file %s: %w", originalFile, err)
+// skipArgs passes rules other than the default on, so the rewriter and
+// manager jobs skip the same files as this manager
+func (m *Manager) skipArgs() []string {
+	if rules := m.Skip.String(); rules != rewriter.DefaultSkip {
+		return []string{"-skip", rules}
 	}
+	return nil
+}
 
-	// Move rewritten source file to the original source file name
-	if err := os.Rename(rewrittenFile, originalFile); err != nil {
-		// If this fails, try to restore backup
-		_ = os.Rename(backupFile, originalFile)
-		return fmt.Errorf("failed to move rewritten source file %s to %s: %w", rewrittenFile, originalFile, err)
+// skipReason returns why the source file at path is not rewritten, or "" if it is
+func (m *Manager) skipReason(path string) (string, error) {
+	if reason := m.Skip.PathReason(path); reason != "" {
+		return reason, nil
 	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return m.Skip.Reason(path, string(content)), nil
+}
 
-	// Compile the target binary package using the rewritten tag
-	outputBinaryPath := filepath.Join(m.TargetBinaryDir, filepath.Base(m.TargetBinaryDir)+".new") // e.g., cmd/suspicious/suspicious.new
-	compileTarget := "./" + m.TargetBinaryDir                                                     // e.g., ./cmd/suspicious
+// CompileRewritten compiles the suspicious code using the rewritten source file
+func (m *Manager) CompileRewritten(ctx context.Context) error {
+	logger.Info("Compiling rewritten code")
 
-	cmd := exec.Command("go", "build", "-tags=rewritten", "-o", outputBinaryPath, compileTarget)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout // Capture stdout for potential info
-	cmd.Stderr = &stderr
+	// Undo any swap left behind by an interrupted run of an earlier version
+	if err := m.Recover(); err != nil {
+		return err
+	}
 
-	if err := cmd.Run(); err != nil {
-		// Restore original source file from backup before returning error
-		_ = os.Rename(backupFile, originalFile)
-		return fmt.Errorf("compilation failed for target %s: %v\nStdout:\n%s\nStderr:\n%s",
-			compileTarget, err, stdout.String(), stderr.String())
+	// Refuse to run rewritten code before building anything if no sandbox is available
+	if _, err := sandbox.Resolve(m.Sandbox.Mode); err != nil {
+		return err
 	}
 
-	// Restore original source file name (move rewritten content back to .rewritten.go file)
-	if err := os.Rename(originalFile, rewrittenFile); err != nil {
-		// Try to restore backup if renaming fails
-		_ = os.Rename(backupFile, originalFile)
-		return fmt.Errorf("failed to restore rewritten source file name from %s to %s: %w", originalFile, rewrittenFile, err)
+	// Ensure the target binary directories exist
+	for _, dir := range m.Targets() {
+		if err := m.mkdirAll(dir); err != nil {
+			return fmt.Errorf("failed to create target binary directory %s: %w", dir, err)
+		}
 	}
 
-	// Restore original source file from backup
-	if _, err := os.Stat(backupFile); err == nil {
-		if err := os.Rename(backupFile, originalFile); err != nil {
-			fmt.Fprintf(os.Stderr, "CRITICAL: Failed to restore original source file %s from backup %s: %v\n", originalFile, backupFile, err)
-			// Attempt to keep the rewritten file as the original if restoration fails catastrophically
-			_ = os.Rename(rewrittenFile, originalFile)
-			return fmt.Errorf("failed to restore original source file from backup: %w", err)
+	// The rewritten source replaces the original only through the overlay
+	overlay, cleanup, err := m.writeOverlay(nil)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	// Compile every target binary package using the build tag with the rewritten source in place
+	rebuilt := make([]int, 0, len(m.Targets()))
+	for _, dir := range m.Targets() {
+		outputBinaryPath := newBinaryPath(dir) // e.g., cmd/suspicious/suspicious.new
+		compileTarget := goPackage(dir)        // e.g., ./cmd/suspicious
+
+		// -v lists the packages that were recompiled rather than taken from the build cache
+		args := append([]string{"build", "-v", "-overlay", overlay}, m.tagsFlag()...)
+		cmd := m.goCommand(ctx, append(args, "-o", outputBinaryPath, compileTarget)...)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout // Capture stdout for potential info
+		cmd.Stderr = &stderr
+
+		before := m.hashIfAudited(outputBinaryPath)
+		err := cmd.Run()
+		m.recordCreate(outputBinaryPath, before, err)
+		if err != nil {
+			return fmt.Errorf("compilation failed for target %s: %v\nStdout:\n%s\nStderr:\n%s",
+				compileTarget, err, stdout.String(), stderr.String())
 		}
+		rebuilt = append(rebuilt, rebuiltPackages(stderr.String()))
 	}
 
-	fmt.Printf("Successfully compiled binary: %s\n", outputBinaryPath)
+	for i, dir := range m.Targets() {
+		logger.Info("Compiled binary", "binary", newBinaryPath(dir), "recompiled_packages", rebuilt[i])
+	}
 	return nil
 }
 
 // RunTests executes tests for the suspicious package, using the rewritten code
-func (m *Manager) RunTests() error {
-	fmt.Println("Running tests...")
+func (m *Manager) RunTests(ctx context.Context) error {
+	logger.Info("Running tests")
 
-	// Get the directory of the suspicious source file
-	suspSourceDir := filepath.Dir(m.SuspiciousPath)
-	rewrittenFile := m.OutputPath
-
-	// Original source file name (e.g., suspicious.go)
-	originalFileName := filepath.Base(m.SuspiciousPath)
-	originalFile := filepath.Join(suspSourceDir, originalFileName)
-	backupFile := filepath.Join(suspSourceDir, originalFileName+".backup")
-
-	// Backup original source file
-	if _, err := os.Stat(originalFile); err == nil {
-		if err := os.Rename(originalFile, backupFile); err != nil {
-			return fmt.Errorf("failed to backup original source file for testing: %w", err)
-		}
-	} else if !os.IsNotExist(err) {
-		return fmt.Errorf("failed to check original source file for testing: %w", err)
+	// Undo any swap left behind by an interrupted run of an earlier version
+	if err := m.Recover(); err != nil {
+		return err
 	}
 
-	// Move rewritten to original file location for testing
-	if err := os.Rename(rewrittenFile, originalFile); err != nil {
-		// If this fails, try to restore backup
-		_ = os.Rename(backupFile, originalFile)
-		return fmt.Errorf("failed to move rewritten file for testing: %w", err)
+	// The rewritten source replaces the original only through the overlay,
+	// next to the differential tests
+	tests, err := m.differentialTests()
+	if err != nil {
+		return err
+	}
+	overlay, cleanup, err := m.writeOverlay(tests)
+	if err != nil {
+		return err
 	}
+	defer cleanup()
 
 	// Run the tests with the rewritten code
-	fmt.Println("Testing rewritten code...")
-	cmd := exec.Command("go", "test", "-tags=rewritten", "-timeout", m.TestTimeout, "./"+suspSourceDir)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	packages := m.testTargets()
+	logger.Info("Testing rewritten code", "packages", len(packages))
+	results := m.testPackages(ctx, packages, overlay)
 
-	testErr := cmd.Run()
+	if err := WriteTestSummary(log.Reports(), results); err != nil {
+		return err
+	}
+	return testFailure(results)
+}
 
-	// Always restore original file structure, regardless of test result
-	restoreErr := os.Rename(originalFile, rewrittenFile)
-	if restoreErr != nil {
-		fmt.Fprintf(os.Stderr, "WARNING: Failed to restore rewritten file after testing: %v\n", restoreErr)
+// DeployBinary replaces the original binary of every target with the new one if tests passed
+func (m *Manager) DeployBinary() error {
+	logger.Info("Deploying new binary")
+
+	// Hash and sign every binary before touching any deployed one, so a
+	// missing binary or a bad key aborts the whole deployment
+	type deployment struct {
+		newBinary, origBinary string
+		manifest              Manifest
+		data, signature       []byte
 	}
+	var deployments []deployment
+	for _, dir := range m.Targets() {
+		d := deployment{newBinary: newBinaryPath(dir), origBinary: BinaryPath(dir)}
 
-	// Restore original from backup
-	if _, err := os.Stat(backupFile); err == nil {
-		if err := os.Rename(backupFile, originalFile); err != nil {
-			fmt.Fprintf(os.Stderr, "CRITICAL: Failed to restore original source file after testing: %v\n", err)
+		// Check if new binary exists
+		if _, err := os.Stat(d.newBinary); err != nil {
+			return fmt.Errorf("new binary not found at %s: %w", d.newBinary, err)
 		}
-	}
 
-	// Now handle any test errors
-	if testErr != nil {
-		return fmt.Errorf("tests failed on rewritten code: %v\nStdout:\n%s\nStderr:\n%s",
-			testErr, stdout.String(), stderr.String())
+		manifest, err := m.buildManifest(d.newBinary, d.origBinary)
+		if err != nil {
+			return err
+		}
+		d.manifest = manifest
+		if d.data, d.signature, err = m.encodeManifest(manifest); err != nil {
+			return err
+		}
+		deployments = append(deployments, d)
 	}
 
-	fmt.Println("Test output:", stdout.String())
+	for _, d := range deployments {
+		if err := m.deployTarget(d.newBinary, d.origBinary, d.data, d.signature); err != nil {
+			return err
+		}
+		logger.Info("Deployed new binary", "binary", d.origBinary)
+		logger.Info("Recorded manifest", "sha256", d.manifest.BinarySHA256, "run", d.manifest.RunID, "manifest", ManifestPath(d.origBinary))
+		if d.signature != nil {
+			logger.Info("Signed manifest", "signature", SignaturePath(d.origBinary))
+		}
+	}
 	return nil
 }
 
-// DeployBinary replaces the original binary with the new one if tests passed
-func (m *Manager) DeployBinary() error {
-	fmt.Println("Deploying new binary...")
-
-	// Use TargetBinaryDir for paths
-	newBinary := filepath.Join(m.TargetBinaryDir, filepath.Base(m.TargetBinaryDir)+".new")
-	origBinary := filepath.Join(m.TargetBinaryDir, filepath.Base(m.TargetBinaryDir))
-
-	// Check if new binary exists
-	if _, err := os.Stat(newBinary); err != nil {
-		return fmt.Errorf("new binary not found at %s: %w", newBinary, err)
-	}
-
+// deployTarget moves newBinary over origBinary, keeping a backup, and writes its manifest
+func (m *Manager) deployTarget(newBinary, origBinary string, manifestData, signature []byte) error {
 	// Backup original binary if it exists
 	if _, err := os.Stat(origBinary); err == nil {
 		backupBinary := origBinary + ".backup"
-		if err := os.Rename(origBinary, backupBinary); err != nil {
+		if err := m.moveAsideLocked(backupBinary); err != nil {
+			return err
+		}
+		if err := m.rename(origBinary, backupBinary); err != nil {
 			return fmt.Errorf("failed to backup original binary %s to %s: %w", origBinary, backupBinary, err)
 		}
-		fmt.Printf("Backed up existing binary to %s\n", backupBinary)
+		logger.Info("Backed up existing binary", "backup", backupBinary)
 	}
 
 	// Move new binary to replace original
-	if err := os.Rename(newBinary, origBinary); err != nil {
+	if err := m.rename(newBinary, origBinary); err != nil {
 		// Attempt to restore backup if deployment fails
 		backupBinary := origBinary + ".backup"
 		if _, backupErr := os.Stat(backupBinary); backupErr == nil {
-			_ = os.Rename(backupBinary, origBinary)
+			_ = m.rename(backupBinary, origBinary)
 		}
 		return fmt.Errorf("failed to deploy new binary from %s to %s: %w", newBinary, origBinary, err)
 	}
 
-	fmt.Println("Successfully deployed new binary:", origBinary)
+	if err := m.writeManifest(origBinary, manifestData, signature); err != nil {
+		return fmt.Errorf("deployed %s but failed to record its provenance: %w", origBinary, err)
+	}
+	return nil
+}
+
+// moveAsideLocked removes a stale backup binary. Windows cannot remove or
+// replace a binary that is still running, e.g. a process started before the
+// previous deployment, but it can rename it: such a backup is moved to a
+// unique .old name that CleanUp removes once the process has exited.
+func (m *Manager) moveAsideLocked(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	err := m.remove(path)
+	if err == nil {
+		return nil
+	}
+	if !isLocked(err) {
+		return fmt.Errorf("failed to remove stale backup %s: %w", path, err)
+	}
+	stale := fmt.Sprintf("%s.%d.old", path, time.Now().UnixNano())
+	if err := m.rename(path, stale); err != nil {
+		return fmt.Errorf("failed to move running backup %s aside: %w", path, err)
+	}
+	logger.Info("Backup is still running, moved it aside", "backup", path, "moved_to", stale)
 	return nil
 }
 
@@ -239,48 +429,64 @@ func (m *Manager) CleanUp() error {
 		// Remove rewritten source file if it exists
 		rewrittenFile := m.OutputPath
 		if _, err := os.Stat(rewrittenFile); err == nil {
-			if err := os.Remove(rewrittenFile); err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to remove rewritten source file %s: %v\n", rewrittenFile, err)
+			if err := m.remove(rewrittenFile); err != nil {
+				logger.Warn("Failed to remove rewritten source file", "file", rewrittenFile, "error", err)
 				// Continue cleanup even if one removal fails
 			} else {
-				fmt.Printf("Removed temporary rewritten source file: %s\n", rewrittenFile)
+				logger.Info("Removed temporary rewritten source file", "file", rewrittenFile)
+			}
+		}
+		// The rewrite report and origin map describe the removed file
+		for _, sidecar := range []string{rewriter.ReportPath(rewrittenFile), rewriter.OriginMapPath(rewrittenFile)} {
+			if _, err := os.Stat(sidecar); err == nil {
+				if err := m.remove(sidecar); err != nil {
+					logger.Warn("Failed to remove file", "file", sidecar, "error", err)
+				}
 			}
 		}
 	} else {
-		fmt.Printf("Keeping rewritten source file for future use: %s\n", m.OutputPath)
+		logger.Info("Keeping rewritten source file for future use", "file", m.OutputPath)
 	}
 
-	// Always remove backup files (source and binary)
-	backupFiles := []string{
-		filepath.Join(suspSourceDir, originalFileName+".backup"),                     // Backup of suspicious.go
-		filepath.Join(m.TargetBinaryDir, filepath.Base(m.TargetBinaryDir)+".backup"), // Backup of the binary
+	// Always remove backup files (source and binaries)
+	backupFiles := []string{filepath.Join(suspSourceDir, originalFileName+".backup")} // Backup of suspicious.go
+	for _, dir := range m.Targets() {
+		backupFiles = append(backupFiles, BinaryPath(dir)+".backup") // Backup of the binary
+		// Backups moved aside while still running (Windows)
+		stale, _ := filepath.Glob(BinaryPath(dir) + ".backup.*.old")
+		backupFiles = append(backupFiles, stale...)
 	}
 
 	for _, file := range backupFiles {
 		if _, err := os.Stat(file); err == nil {
-			if err := os.Remove(file); err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to remove backup file %s: %v\n", file, err)
+			if err := m.remove(file); err != nil {
+				logger.Warn("Failed to remove backup file", "file", file, "error", err)
 			} else {
-				fmt.Printf("Removed backup file: %s\n", file)
+				logger.Info("Removed backup file", "file", file)
 			}
 		}
 	}
 
-	// Remove the temporary .new binary if it exists
-	newBinary := filepath.Join(m.TargetBinaryDir, filepath.Base(m.TargetBinaryDir)+".new")
-	if _, err := os.Stat(newBinary); err == nil {
-		if err := os.Remove(newBinary); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to remove temporary new binary %s: %v\n", newBinary, err)
+	// Remove the temporary .new binaries, and the partial manifests of a
+	// stopped run, if they exist
+	for _, dir := range m.Targets() {
+		newBinary := newBinaryPath(dir)
+		for _, file := range []string{newBinary, ManifestPath(newBinary), SignaturePath(newBinary)} {
+			if _, err := os.Stat(file); err == nil {
+				if err := m.remove(file); err != nil {
+					logger.Warn("Failed to remove temporary file", "file", file, "error", err)
+				}
+			}
 		}
 	}
 
-	fmt.Println("Cleanup finished.")
+	logger.Info("Cleanup finished")
 	return nil
 }
 
 // CalculateMetrics calculates and reports code metrics for both original and rewritten code
-func (m *Manager) CalculateMetrics() error {
-	fmt.Println("Calculating code metrics...")
+func (m *Manager) CalculateMetrics(ctx context.Context) error {
+	logger.Info("Calculating code metrics")
 
 	// Calculate metrics for original code
 	originalMetrics, err := metrics.CalculateMetrics(m.SuspiciousPath)
@@ -295,63 +501,95 @@ func (m *Manager) CalculateMetrics() error {
 	}
 
 	// Calculate deltas
-	locDelta, ccDelta, cogCDelta := metrics.CalculateDeltaMetrics(originalMetrics, rewrittenMetrics)
-
-	// Print metrics report
-	fmt.Printf("\nCode Metrics Report:\n")
-	fmt.Printf("===================\n")
-	fmt.Printf("Original Code:\n")
-	fmt.Printf("  Lines of Code (LOC): %d\n", originalMetrics.LOC)
-	fmt.Printf("  Cyclomatic Complexity (CC): %d\n", originalMetrics.CC)
-	fmt.Printf("  Cognitive Complexity (CogC): %d\n", originalMetrics.CogC)
-	fmt.Printf("  Total Functions: %d\n", originalMetrics.FuncCount)
-	fmt.Printf("\nRewritten Code:\n")
-	fmt.Printf("  Lines of Code (LOC): %d\n", rewrittenMetrics.LOC)
-	fmt.Printf("  Cyclomatic Complexity (CC): %d\n", rewrittenMetrics.CC)
-	fmt.Printf("  Cognitive Complexity (CogC): %d\n", rewrittenMetrics.CogC)
-	fmt.Printf("  Total Functions: %d\n", rewrittenMetrics.FuncCount)
-	fmt.Printf("\nDelta Metrics:\n")
-	fmt.Printf("  LOC Change: %.2f%%\n", locDelta)
-	fmt.Printf("  CC Change: %.2f%%\n", ccDelta)
-	fmt.Printf("  CogC Change: %.2f%%\n", cogCDelta)
-
-	return nil
-}
-
-// Run executes the entire process: rewrite, compile, test, and deploy
-func (m *Manager) Run() error {
-	fmt.Println("Starting automated rewrite and deploy process...")
-
-	// Step 1: Run the rewriter
-	if err := m.RunRewriter(); err != nil {
-		return fmt.Errorf("rewriter step failed: %w", err)
+	delta := metrics.CalculateDeltaMetrics(originalMetrics, rewrittenMetrics)
+
+	logger.Info("Code metrics",
+		slog.Group("original", "loc", originalMetrics.LOC, "cc", originalMetrics.CC, "cogc", originalMetrics.CogC, "functions", originalMetrics.FuncCount),
+		slog.Group("rewritten", "loc", rewrittenMetrics.LOC, "cc", rewrittenMetrics.CC, "cogc", rewrittenMetrics.CogC, "functions", rewrittenMetrics.FuncCount),
+		slog.Group("delta_percent", "loc", percentValue(delta.LOC), "cc", percentValue(delta.CC), "cogc", percentValue(delta.CogC)))
+	logger.Info("Halstead metrics",
+		slog.Group("original", halsteadAttrs(originalMetrics)...),
+		slog.Group("rewritten", halsteadAttrs(rewrittenMetrics)...))
+	if score, err := similarity.CompareFiles(m.SuspiciousPath, m.OutputPath); err != nil {
+		logger.Warn("Failed to compare the structure of the rewritten code", "error", err)
+	} else {
+		logger.Info("Structural similarity",
+			"similarity", math.Round(score.Similarity()*100)/100,
+			"blocks", math.Round(score.BlockSimilarity*100)/100,
+			"call_graph", math.Round(score.CallGraphSimilarity*100)/100,
+			"call_graph_distance", score.CallGraphDistance)
 	}
 
-	// Step 2: Calculate metrics
-	if err := m.CalculateMetrics(); err != nil {
-		return fmt.Errorf("metrics calculation failed: %w", err)
+	// Report every function present in both files, flagging those that got
+	// more complex
+	for _, name := range slices.Sorted(maps.Keys(delta.Functions)) {
+		before, after := originalMetrics.Functions[name], rewrittenMetrics.Functions[name]
+		logger.Info("Function metrics", "function", name,
+			"more_complex", delta.Functions[name].MoreComplex(),
+			slog.Group("original", "loc", before.LOC, "cc", before.CC, "cogc", before.CogC, "nesting", before.Nesting, "params", before.Params),
+			slog.Group("rewritten", "loc", after.LOC, "cc", after.CC, "cogc", after.CogC, "nesting", after.Nesting, "params", after.Params))
+	}
+	if len(delta.Added) > 0 || len(delta.Removed) > 0 {
+		logger.Info("Functions added or removed by the rewrite", "added", delta.Added, "removed", delta.Removed)
 	}
+	m.Dashboard.Metrics(m.SuspiciousPath, delta.LOC.Percent, delta.CC.Percent, delta.CogC.Percent)
 
-	// Step 3: Compile the rewritten code
-	if err := m.CompileRewritten(); err != nil {
-		return fmt.Errorf("compilation step failed: %w", err)
+	if err := m.MatchYaraRules(ctx, m.SuspiciousPath, m.OutputPath); err != nil {
+		return fmt.Errorf("failed to match YARA rules against the source: %w", err)
 	}
+	return nil
+}
 
-	// Step 4: Run tests
-	if err := m.RunTests(); err != nil {
-		return fmt.Errorf("testing step failed: %w", err)
+// percentValue returns the percentage of d rounded to two decimals, or "n/a"
+// if it is undefined
+func percentValue(d metrics.Delta) any {
+	if d.Undefined {
+		return "n/a"
 	}
+	return math.Round(d.Percent*100) / 100
+}
 
-	// Step 5: Deploy the binary
-	if err := m.DeployBinary(); err != nil {
-		return fmt.Errorf("deployment step failed: %w", err)
+// halsteadAttrs returns the Halstead measures and maintainability index of m
+// as log attributes, rounded to two decimals
+func halsteadAttrs(m *metrics.Metrics) []any {
+	round := func(v float64) float64 { return math.Round(v*100) / 100 }
+	return []any{
+		"volume", round(m.Halstead.Volume()),
+		"difficulty", round(m.Halstead.Difficulty()),
+		"effort", round(m.Halstead.Effort()),
+		"maintainability", round(m.MaintainabilityIndex),
 	}
+}
 
-	// Step 6: Clean up
-	if err := m.CleanUp(); err != nil {
-		return fmt.Errorf("cleanup step failed: %w", err)
+// Run executes the entire process: rewrite, compile, test, and deploy.
+// Canceling ctx stops the running stage and skips the rest, up to the
+// deployment.
+func (m *Manager) Run(ctx context.Context) (err error) {
+	logger.Info("Starting automated rewrite and deploy process", "file", m.SuspiciousPath)
+	m.RunID = newRunID()
+	m.stages, m.rewriteReport, m.mutationReport = nil, nil, nil
+	m.yaraStopped = nil
+	m.rewrote = false
+	m.StartBudget()
+	m.Dashboard.Begin(m.SuspiciousPath)
+	defer func() {
+		m.Dashboard.Finish(m.SuspiciousPath, err)
+		m.logUsage()
+		if err := m.WriteJUnit(); err != nil {
+			logger.Warn("Failed to write JUnit report", "error", err)
+		} else if err := m.uploadJUnit(ctx); err != nil {
+			logger.Warn("Failed to upload JUnit report", "error", err)
+		}
+	}()
+
+	pipeline := m.Pipeline
+	if pipeline == nil {
+		pipeline = DefaultPipeline()
+	}
+	if err := pipeline.Run(ctx, m); err != nil {
+		return err
 	}
 
-	fmt.Println("Process completed successfully!")
+	logger.Info("Process completed successfully")
 	return nil
 }
@@ -1,30 +1,56 @@
 package manager
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/dashboard"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+	"github.com/Hekzory/MetamorphLLM/internal/sandbox"
+	"github.com/Hekzory/MetamorphLLM/internal/scanner"
+	"github.com/Hekzory/MetamorphLLM/internal/telemetry"
 )
 
 func TestNewManager(t *testing.T) {
 	m := NewManager()
-	
+
 	if m.RewriterBinary != "rewriter" {
 		t.Errorf("Expected RewriterBinary to be 'rewriter', got '%s'", m.RewriterBinary)
 	}
-	
+
 	if m.SuspiciousPath != "internal/suspicious/suspicious.go" {
 		t.Errorf("Expected SuspiciousPath to be 'internal/suspicious/suspicious.go', got '%s'", m.SuspiciousPath)
 	}
-	
+
 	if m.OutputPath != "internal/suspicious/suspicious.go.rewritten.go" {
 		t.Errorf("Expected OutputPath to be 'internal/suspicious/suspicious.go.rewritten.go', got '%s'", m.OutputPath)
 	}
-	
+
 	if m.TestTimeout != "30s" {
 		t.Errorf("Expected TestTimeout to be '30s', got '%s'", m.TestTimeout)
 	}
-	
+
 	if m.KeepRewritten != true {
 		t.Errorf("Expected KeepRewritten to be true, got %v", m.KeepRewritten)
 	}
@@ -38,20 +64,20 @@ func TestCleanUp(t *testing.T) {
 		t.Fatalf("Failed to create temp dir: %v", err)
 	}
 	defer os.RemoveAll(tempDir)
-	
+
 	// Create test files
 	suspDir := filepath.Join(tempDir, "internal", "suspicious")
 	if err := os.MkdirAll(suspDir, 0755); err != nil {
 		t.Fatalf("Failed to create test directory: %v", err)
 	}
-	
+
 	// Create test files to clean up
 	testFiles := []string{
 		filepath.Join(suspDir, "suspicious.go.rewritten.go"),
 		filepath.Join(suspDir, "suspicious.go.backup"),
-		filepath.Join(filepath.Join(tempDir, "cmd", "suspicious"), "suspicious.backup"),
+		BinaryPath(filepath.Join(tempDir, "cmd", "suspicious")) + ".backup",
 	}
-	
+
 	for _, file := range testFiles {
 		// Make sure parent directory exists
 		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
@@ -61,18 +87,18 @@ func TestCleanUp(t *testing.T) {
 			t.Fatalf("Failed to create test file %s: %v", file, err)
 		}
 	}
-	
+
 	// Create a manager with test paths
 	m := NewManager()
 	m.SuspiciousPath = filepath.Join(suspDir, "suspicious.go")
 	m.OutputPath = filepath.Join(suspDir, "suspicious.go.rewritten.go")
 	m.TargetBinaryDir = filepath.Join(tempDir, "cmd", "suspicious")
-	
+
 	// Run cleanup
 	if err := m.CleanUp(); err != nil {
 		t.Fatalf("CleanUp failed: %v", err)
 	}
-	
+
 	// Verify files were deleted or kept as expected
 	for _, file := range testFiles {
 		if filepath.Base(file) == "suspicious.go.rewritten.go" {
@@ -87,7 +113,7 @@ func TestCleanUp(t *testing.T) {
 			}
 		}
 	}
-	
+
 	// Test with KeepRewritten = false
 	for _, file := range testFiles {
 		// Make sure parent directory exists
@@ -98,16 +124,1536 @@ func TestCleanUp(t *testing.T) {
 			t.Fatalf("Failed to create test file %s: %v", file, err)
 		}
 	}
-	
+
 	m.KeepRewritten = false
 	if err := m.CleanUp(); err != nil {
 		t.Fatalf("CleanUp failed: %v", err)
 	}
-	
+
 	// All files should be deleted with KeepRewritten = false
 	for _, file := range testFiles {
 		if _, err := os.Stat(file); !os.IsNotExist(err) {
 			t.Errorf("Expected file %s to be deleted, but it still exists", file)
 		}
 	}
-}
\ No newline at end of file
+}
+
+// TestRunStage tests that stage durations are recorded with their outcome
+func TestRunStage(t *testing.T) {
+	before := telemetry.StageDuration.Count("test-stage", telemetry.StatusError)
+
+	err := RunStage("test-stage", func() error { return fmt.Errorf("boom") })
+	if err == nil || err.Error() != "boom" {
+		t.Errorf("Expected the step error to be returned, got %v", err)
+	}
+
+	if got := telemetry.StageDuration.Count("test-stage", telemetry.StatusError); got != before+1 {
+		t.Errorf("Expected one failed stage observation, got %d", got-before)
+	}
+}
+
+// TestAuditLog tests that renames and removals are recorded with content hashes
+func TestAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.go")
+	dst := filepath.Join(dir, "b.go")
+	if err := os.WriteFile(src, []byte("package a"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	m := NewManager()
+	m.AuditLogPath = filepath.Join(dir, "audit", "audit.jsonl")
+
+	if err := m.rename(src, dst); err != nil {
+		t.Fatalf("rename failed: %v", err)
+	}
+	if err := m.remove(dst); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if err := m.remove(dst); err == nil {
+		t.Fatal("Expected removing a missing file to fail")
+	}
+
+	entries, err := LoadAuditLog(m.AuditLogPath)
+	if err != nil {
+		t.Fatalf("LoadAuditLog failed: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 audit entries, got %d", len(entries))
+	}
+
+	hash := entries[0].BeforeSHA256
+	if entries[0].Op != AuditRename || entries[0].Target != dst || hash == "" || entries[0].AfterSHA256 != hash {
+		t.Errorf("Unexpected rename entry: %+v", entries[0])
+	}
+	if entries[1].Op != AuditRemove || entries[1].BeforeSHA256 != hash || entries[1].Error != "" {
+		t.Errorf("Unexpected remove entry: %+v", entries[1])
+	}
+	if entries[2].Error == "" {
+		t.Errorf("Expected the failed removal to be recorded with its error: %+v", entries[2])
+	}
+}
+
+// TestRecover tests that an interrupted swap is undone from a legacy journal
+func TestRecover(t *testing.T) {
+	// Each case simulates a crash at a different point of the swap
+	crashes := map[string]func(original, backup, rewritten string) error{
+		"after backup": func(original, backup, rewritten string) error {
+			return os.Rename(original, backup)
+		},
+		"after swap-in": func(original, backup, rewritten string) error {
+			if err := os.Rename(original, backup); err != nil {
+				return err
+			}
+			return os.Rename(rewritten, original)
+		},
+		"after swap-out": func(original, backup, rewritten string) error {
+			if err := os.Rename(original, backup); err != nil {
+				return err
+			}
+			if err := os.Rename(rewritten, original); err != nil {
+				return err
+			}
+			return os.Rename(original, rewritten)
+		},
+	}
+
+	for name, crash := range crashes {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			original := filepath.Join(dir, "suspicious.go")
+			backup := original + ".backup"
+			rewritten := original + ".rewritten.go"
+			if err := os.WriteFile(original, []byte("original"), 0644); err != nil {
+				t.Fatalf("Failed to write original: %v", err)
+			}
+			if err := os.WriteFile(rewritten, []byte("rewritten"), 0644); err != nil {
+				t.Fatalf("Failed to write rewritten: %v", err)
+			}
+
+			m := NewManager()
+			m.SuspiciousPath = original
+			m.OutputPath = rewritten
+			// The journal earlier versions wrote before swapping
+			journal, err := json.Marshal(swapJournal{
+				Original:        original,
+				Backup:          backup,
+				Rewritten:       rewritten,
+				OriginalSHA256:  fileHash(original),
+				RewrittenSHA256: fileHash(rewritten),
+				Started:         time.Now().UTC(),
+			})
+			if err != nil {
+				t.Fatalf("Failed to encode journal: %v", err)
+			}
+			if err := os.WriteFile(m.JournalPath(), journal, 0644); err != nil {
+				t.Fatalf("Failed to write journal: %v", err)
+			}
+			if err := crash(original, backup, rewritten); err != nil {
+				t.Fatalf("Failed to simulate crash: %v", err)
+			}
+
+			if err := m.Recover(); err != nil {
+				t.Fatalf("Recover failed: %v", err)
+			}
+			for path, want := range map[string]string{original: "original", rewritten: "rewritten"} {
+				if got, err := os.ReadFile(path); err != nil || string(got) != want {
+					t.Errorf("Expected %s to contain %q, got %q (%v)", filepath.Base(path), want, got, err)
+				}
+			}
+			if _, err := os.Stat(m.JournalPath()); !os.IsNotExist(err) {
+				t.Error("Expected the journal to be removed after recovery")
+			}
+		})
+	}
+
+	// Without a journal there is nothing to do
+	m := NewManager()
+	m.SuspiciousPath = filepath.Join(t.TempDir(), "suspicious.go")
+	if err := m.Recover(); err != nil {
+		t.Errorf("Expected Recover without a journal to succeed, got %v", err)
+	}
+}
+
+// TestTestPackages tests concurrent per-package test runs and result aggregation
+func TestTestPackages(t *testing.T) {
+	m := NewManager()
+	m.TestJobs = 2
+	m.Sandbox = testSandbox()
+	packages := []string{"../metrics", "./does-not-exist", "../corpus"}
+
+	results := m.testPackages(context.Background(), packages, "")
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	for i, r := range results {
+		if r.Package != packages[i] {
+			t.Errorf("Expected results in input order, got %s at %d", r.Package, i)
+		}
+	}
+	if results[0].Err != nil || results[2].Err != nil {
+		t.Errorf("Expected existing packages to pass: %v / %v", results[0].Err, results[2].Err)
+	}
+
+	err := testFailure(results)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 packages (./does-not-exist)") {
+		t.Errorf("Expected an aggregated failure for the missing package, got %v", err)
+	}
+	if testFailure(results[:1]) != nil {
+		t.Error("Expected no error when every package passes")
+	}
+}
+
+// TestGoEnv tests that go commands share the build cache and drop cache-defeating flags
+func TestGoEnv(t *testing.T) {
+	t.Setenv("GOFLAGS", "-a -mod=mod")
+	t.Setenv("GOCACHE", "/tmp/other-cache")
+
+	m := NewManager()
+	m.BuildCacheDir = t.TempDir()
+	var gocache, goflags []string
+	for _, kv := range m.goEnv() {
+		if strings.HasPrefix(kv, "GOCACHE=") {
+			gocache = append(gocache, kv)
+		}
+		if strings.HasPrefix(kv, "GOFLAGS=") {
+			goflags = append(goflags, kv)
+		}
+	}
+	if len(gocache) != 1 || gocache[0] != "GOCACHE="+m.BuildCacheDir {
+		t.Errorf("Expected GOCACHE=%s only, got %v", m.BuildCacheDir, gocache)
+	}
+	if len(goflags) != 1 || goflags[0] != "GOFLAGS=-mod=mod" {
+		t.Errorf("Expected -a to be dropped from GOFLAGS, got %v", goflags)
+	}
+
+	if n := rebuiltPackages("# github.com/x/y\ngithub.com/x/y\ngithub.com/x/z\n"); n != 2 {
+		t.Errorf("Expected 2 rebuilt packages, got %d", n)
+	}
+}
+
+// testSandbox sandboxes test programs where the host supports it
+func testSandbox() sandbox.Config {
+	if _, err := sandbox.Resolve(sandbox.ModeAuto); err != nil {
+		return sandbox.Config{Mode: sandbox.ModeNone}
+	}
+	return sandbox.Config{Mode: sandbox.ModeAuto}
+}
+
+// skipWithoutShell skips tests that fake binaries with shell scripts
+func skipWithoutShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake binaries are shell scripts")
+	}
+}
+
+// TestSmokeRun tests running the compiled binary in the sandbox
+func TestSmokeRun(t *testing.T) {
+	skipWithoutShell(t)
+	m := NewManager()
+	m.Sandbox = testSandbox()
+	m.SmokeTimeout = 10 * time.Second
+	m.TargetBinaryDir = filepath.Join(t.TempDir(), "app")
+	if err := os.MkdirAll(m.TargetBinaryDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	binary := newBinaryPath(m.TargetBinaryDir)
+
+	t.Setenv("METAMORPH_TEST_API_KEY", "secret")
+	script := "#!/bin/sh\n[ -z \"$METAMORPH_TEST_API_KEY\" ] || exit 3\necho hello > \"$TMPDIR/out\"\n"
+	if err := os.WriteFile(binary, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SmokeRun(context.Background()); err != nil {
+		t.Fatalf("Expected the smoke run to pass without credentials in the environment: %v", err)
+	}
+
+	if err := os.WriteFile(binary, []byte("#!/bin/sh\necho broken\nexit 2\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := m.SmokeRun(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Expected a failing smoke run with its output, got %v", err)
+	}
+
+	m.SmokeTest = false
+	if err := m.SmokeRun(context.Background()); err != nil {
+		t.Errorf("Disabled smoke run should be skipped: %v", err)
+	}
+}
+
+// TestCheckCapabilities tests that the pipeline refuses rewrites that gained capabilities
+func TestCheckCapabilities(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager()
+	m.SuspiciousPath = filepath.Join(dir, "s.go")
+	m.OutputPath = filepath.Join(dir, "s.go.rewritten.go")
+
+	original := "package s\n\nfunc F() int { return 1 }\n"
+	if err := os.WriteFile(m.SuspiciousPath, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(m.OutputPath, []byte("package s\n\nfunc F() int { return 2 - 1 }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CheckCapabilities(); err != nil {
+		t.Errorf("Expected a faithful rewrite to pass: %v", err)
+	}
+
+	malicious := "package s\n\nimport \"os/exec\"\n\nfunc F() int { exec.Command(\"sh\").Run(); return 1 }\n"
+	if err := os.WriteFile(m.OutputPath, []byte(malicious), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CheckCapabilities(); err == nil || !strings.Contains(err.Error(), "F gained exec") {
+		t.Errorf("Expected the rewrite to fail for gaining exec, got %v", err)
+	}
+}
+
+// TestDeployManifest tests that deployment records and signs the binary's hash
+func TestDeployManifest(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager()
+	m.TargetBinaryDir = filepath.Join(dir, "app")
+	m.SuspiciousPath = filepath.Join(dir, "app.go")
+	m.OutputPath = filepath.Join(dir, "app.go.rewritten.go")
+	m.RewriterAPI = "gemini"
+	m.RunID = "run-1"
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("Failed to encode key: %v", err)
+	}
+	m.SigningKeyPath = filepath.Join(dir, "signing.pem")
+	if err := os.WriteFile(m.SigningKeyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	for path, content := range map[string]string{
+		m.SuspiciousPath: "package app", m.OutputPath: "package app // rewritten",
+		newBinaryPath(m.TargetBinaryDir): "binary v2",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	if err := m.DeployBinary(); err != nil {
+		t.Fatalf("DeployBinary failed: %v", err)
+	}
+	binary := BinaryPath(m.TargetBinaryDir)
+	manifest, err := VerifyBinary(binary, publicKey)
+	if err != nil {
+		t.Fatalf("Expected the deployed binary to verify: %v", err)
+	}
+	if manifest.RunID != "run-1" || manifest.BinarySHA256 != fileHash(binary) || manifest.SourceSHA256 != fileHash(m.SuspiciousPath) {
+		t.Errorf("Unexpected manifest: %+v", manifest)
+	}
+
+	otherKey, _, _ := ed25519.GenerateKey(nil)
+	if _, err := VerifyBinary(binary, otherKey); err == nil {
+		t.Error("Expected verification with another key to fail")
+	}
+	if err := os.WriteFile(binary, []byte("tampered"), 0755); err != nil {
+		t.Fatalf("Failed to overwrite binary: %v", err)
+	}
+	if _, err := VerifyBinary(binary, publicKey); err == nil {
+		t.Error("Expected a modified binary to fail verification")
+	}
+}
+
+// TestConfirmDeploy tests the prompt and approval-file gates
+func TestConfirmDeploy(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager()
+	m.TargetBinaryDir = filepath.Join(dir, "app")
+	m.SuspiciousPath = filepath.Join(dir, "missing.go")
+	m.OutputPath = filepath.Join(dir, "missing.go.rewritten.go")
+	m.ApprovalFile = filepath.Join(dir, "approve")
+	newBinary := newBinaryPath(m.TargetBinaryDir)
+	if err := os.MkdirAll(m.TargetBinaryDir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(newBinary, []byte("binary v2"), 0755); err != nil {
+		t.Fatalf("Failed to write binary: %v", err)
+	}
+
+	m.Stdin = strings.NewReader("yes\n")
+	if err := m.ConfirmDeploy(context.Background()); err != nil {
+		t.Errorf("Expected 'yes' to approve, got %v", err)
+	}
+	m.Stdin = strings.NewReader("\n")
+	if err := m.ConfirmDeploy(context.Background()); !errors.Is(err, ErrDeployDeclined) {
+		t.Errorf("Expected an empty answer to decline, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	unanswered, w := io.Pipe()
+	defer w.Close()
+	m.Stdin = unanswered
+	if err := m.ConfirmDeploy(ctx); !errors.Is(err, ErrDeployDeclined) || !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a canceled prompt to decline, got %v", err)
+	}
+
+	m.Confirm = ConfirmFile
+	if err := m.ConfirmDeploy(context.Background()); !errors.Is(err, ErrDeployDeclined) || !strings.Contains(err.Error(), fileHash(newBinary)) {
+		t.Errorf("Expected a missing approval to decline and name the hash, got %v", err)
+	}
+	if err := os.WriteFile(m.ApprovalFile, []byte("0123\n"), 0644); err != nil {
+		t.Fatalf("Failed to write approval: %v", err)
+	}
+	if err := m.ConfirmDeploy(context.Background()); !errors.Is(err, ErrDeployDeclined) {
+		t.Errorf("Expected an approval for another binary to decline, got %v", err)
+	}
+	if err := os.WriteFile(m.ApprovalFile, []byte(fileHash(newBinary)+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write approval: %v", err)
+	}
+	if err := m.ConfirmDeploy(context.Background()); err != nil {
+		t.Errorf("Expected a matching approval to approve, got %v", err)
+	}
+	if _, err := os.Stat(m.ApprovalFile); !os.IsNotExist(err) {
+		t.Error("Expected the approval file to be consumed")
+	}
+
+	m.Confirm = ConfirmNone
+	if err := m.ConfirmDeploy(context.Background()); err != nil {
+		t.Errorf("Expected no confirmation with -confirm none, got %v", err)
+	}
+}
+
+// TestBuildImage tests that the image carries the deployed binary and its manifest
+func TestBuildImage(t *testing.T) {
+	skipWithoutShell(t)
+	dir := t.TempDir()
+	m := NewManager()
+	m.TargetBinaryDir = filepath.Join(dir, "app")
+	m.SuspiciousPath = filepath.Join(dir, "app.go")
+	m.OutputPath = filepath.Join(dir, "app.go.rewritten.go")
+	m.RunID = "run-1"
+	m.ImageTag = "registry.example/app:run-1"
+	m.ImagePush = true
+
+	// The fake builder logs its arguments and keeps the generated Dockerfile
+	log := filepath.Join(dir, "builder.log")
+	m.ImageBuilder = filepath.Join(dir, "builder")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$@\" >> %s\nif [ \"$1\" = build ]; then for ctx; do :; done; cp \"$ctx/Dockerfile\" %s; fi\n",
+		log, filepath.Join(dir, "Dockerfile"))
+	if err := os.WriteFile(m.ImageBuilder, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write builder: %v", err)
+	}
+	for path, content := range map[string]string{
+		m.SuspiciousPath: "package app", m.OutputPath: "package app // rewritten",
+		newBinaryPath(m.TargetBinaryDir): "binary v2",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	if err := m.DeployBinary(); err != nil {
+		t.Fatalf("DeployBinary failed: %v", err)
+	}
+
+	if err := m.BuildImage(context.Background()); err != nil {
+		t.Fatalf("BuildImage failed: %v", err)
+	}
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("Builder was not run: %v", err)
+	}
+	calls := strings.Split(strings.TrimSpace(string(data)), "\n")
+	hash := fileHash(BinaryPath(m.TargetBinaryDir))
+	if len(calls) != 2 || !strings.HasPrefix(calls[0], "build -t "+m.ImageTag) || calls[1] != "push "+m.ImageTag {
+		t.Fatalf("Expected a build and a push, got %q", calls)
+	}
+	for _, label := range []string{ImageLabelPrefix + "run_id=run-1", ImageLabelPrefix + "binary_sha256=" + hash} {
+		if !strings.Contains(calls[0], "--label "+label) {
+			t.Errorf("Expected label %s, got %q", label, calls[0])
+		}
+	}
+	dockerfile, _ := os.ReadFile(filepath.Join(dir, "Dockerfile"))
+	if !strings.Contains(string(dockerfile), "FROM "+DefaultImageBase) || !strings.Contains(string(dockerfile), "COPY manifest.json "+imageManifestPath) {
+		t.Errorf("Unexpected Dockerfile:\n%s", dockerfile)
+	}
+
+	// A binary that no longer matches its manifest is not packaged
+	if err := os.WriteFile(BinaryPath(m.TargetBinaryDir), []byte("tampered"), 0755); err != nil {
+		t.Fatalf("Failed to overwrite binary: %v", err)
+	}
+	if err := m.BuildImage(context.Background()); err == nil {
+		t.Error("Expected a modified binary to be refused")
+	}
+}
+
+// TestRunCorpusJobs tests scheduling corpus items as Jobs with a fake kubectl
+func TestRunCorpusJobs(t *testing.T) {
+	skipWithoutShell(t)
+	dir := t.TempDir()
+	m := NewManager()
+	m.RunID = "20260101T120000.000Z"
+
+	// The fake kubectl keeps applied manifests and reports a result only for the first job
+	kubectl := filepath.Join(dir, "kubectl")
+	script := fmt.Sprintf(`#!/bin/sh
+shift 2
+case "$1" in
+apply) cat > %[1]s/$$.json ;;
+get) echo "1/" ;;
+logs)
+	case "$2" in
+	*-0) echo "building..."; echo 'METAMORPH_JOB_RESULT {"source":"a.go","loc_delta":12.5}' ;;
+	*) echo "panic: no space left on device" ;;
+	esac ;;
+esac
+`, dir)
+	if err := os.WriteFile(kubectl, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write kubectl: %v", err)
+	}
+
+	items := []CorpusItem{{Source: "a.go"}, {Source: "b.go", TargetDir: "cmd/b"}}
+	cfg := KubeConfig{Image: "registry.example/metamorph:dev", Namespace: "research", Secret: "llm-keys", Parallelism: 2, Kubectl: kubectl, PollInterval: time.Millisecond}
+	results := m.RunCorpusJobs(context.Background(), cfg, items)
+
+	if !results[0].Passed() || results[0].LOCDelta != 12.5 || results[0].Job != "metamorph-20260101t120000-000z-0" {
+		t.Errorf("Expected the first item to pass, got %+v", results[0])
+	}
+	if results[1].FailedStage != "job" || !strings.Contains(results[1].Error, "no space left") {
+		t.Errorf("Expected the second item to fail without a result, got %+v", results[1])
+	}
+
+	manifests, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(manifests) != 2 {
+		t.Fatalf("Expected two applied jobs, got %d", len(manifests))
+	}
+	var found bool
+	for _, path := range manifests {
+		data, _ := os.ReadFile(path)
+		if strings.Contains(string(data), `"-suspicious","b.go","-target-dir","cmd/b"`) {
+			found = true
+			for _, want := range []string{`"namespace":"research"`, `"image":"registry.example/metamorph:dev"`, `"secretRef":{"name":"llm-keys"}`, `"backoffLimit":0`} {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("Expected %s in the job manifest:\n%s", want, data)
+				}
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected a job for b.go with its target directory")
+	}
+
+	var report strings.Builder
+	if err := WriteJobReport(&report, results); err != nil {
+		t.Fatalf("WriteJobReport failed: %v", err)
+	}
+	if !strings.Contains(report.String(), "Passed: 1/2") || !strings.Contains(report.String(), "Failures by stage: job=1") {
+		t.Errorf("Unexpected report:\n%s", report.String())
+	}
+}
+
+// TestWriteJUnit tests the report of stages and function rewrites
+func TestWriteJUnit(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager()
+	m.OutputPath = filepath.Join(dir, "app.go.rewritten.go")
+	m.JUnitPath = filepath.Join(dir, "reports", "junit.xml")
+
+	report := &rewriter.RewriteReport{Source: "app.go", Functions: []rewriter.FunctionReport{
+		{Function: "Add", Status: rewriter.FunctionRewritten, Duration: time.Second},
+		{Function: "Sub", Status: rewriter.FunctionFailed, Error: "failed to parse rewritten function code: 1:5: expected '('"},
+	}}
+	if err := report.Save(rewriter.ReportPath(m.OutputPath)); err != nil {
+		t.Fatalf("Failed to save report: %v", err)
+	}
+	m.loadRewriteReport()
+	m.Stage(context.Background(), "rewrite", func() error { return nil })
+	m.Stage(context.Background(), "compile", func() error { return errors.New("compilation failed\nStderr: undefined: x") })
+
+	if err := m.WriteJUnit(); err != nil {
+		t.Fatalf("WriteJUnit failed: %v", err)
+	}
+	data, err := os.ReadFile(m.JUnitPath)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	var suites junitSuites
+	if err := xml.Unmarshal(data, &suites); err != nil {
+		t.Fatalf("Invalid JUnit XML: %v\n%s", err, data)
+	}
+	if suites.Tests != 4 || suites.Failures != 2 || len(suites.Suites) != 2 {
+		t.Fatalf("Expected 4 tests with 2 failures in 2 suites, got:\n%s", data)
+	}
+	compile := suites.Suites[0].Cases[1]
+	if compile.Name != "compile" || compile.Failure == nil || compile.Failure.Message != "compilation failed" || !strings.Contains(compile.Failure.Text, "undefined: x") {
+		t.Errorf("Unexpected compile case: %+v", compile)
+	}
+	if sub := suites.Suites[1].Cases[1]; sub.Name != "Sub" || sub.Failure == nil {
+		t.Errorf("Expected the failed function rewrite, got %+v", sub)
+	}
+}
+
+func TestUploadArtifacts(t *testing.T) {
+	uploaded := make(map[string]string)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		uploaded[r.URL.Path] = string(body)
+	}))
+	defer ts.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", "id")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	dir := t.TempDir()
+	m := NewManager()
+	m.TargetBinaryDir = filepath.Join(dir, "app")
+	m.SuspiciousPath = filepath.Join(dir, "app.go")
+	m.OutputPath = filepath.Join(dir, "app.go.rewritten.go")
+	m.RunID = "run-1"
+	m.ArtifactURL = "s3://runs/ci"
+	m.ArtifactEndpoint = ts.URL
+	for path, content := range map[string]string{
+		m.SuspiciousPath: "package app", m.OutputPath: "package app // rewritten",
+		newBinaryPath(m.TargetBinaryDir): "binary v2",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	if err := m.DeployBinary(); err != nil {
+		t.Fatalf("DeployBinary failed: %v", err)
+	}
+
+	// The manifest references where the artifacts are uploaded
+	manifest, err := VerifyBinary(BinaryPath(m.TargetBinaryDir), nil)
+	if err != nil {
+		t.Fatalf("VerifyBinary failed: %v", err)
+	}
+	app := filepath.Base(BinaryPath(m.TargetBinaryDir))
+	want := map[string]string{
+		"binary":    ts.URL + "/runs/ci/run-1/" + app,
+		"rewritten": ts.URL + "/runs/ci/run-1/app.go.rewritten.go",
+	}
+	if fmt.Sprint(manifest.Artifacts) != fmt.Sprint(want) {
+		t.Errorf("Expected artifact URLs %v, got %v", want, manifest.Artifacts)
+	}
+
+	if err := m.UploadArtifacts(context.Background()); err != nil {
+		t.Fatalf("UploadArtifacts failed: %v", err)
+	}
+	for path, content := range map[string]string{
+		"/runs/ci/run-1/" + app:                    "binary v2",
+		"/runs/ci/run-1/app.go.rewritten.go":       "package app // rewritten",
+		"/runs/ci/run-1/" + app + ".manifest.json": "",
+	} {
+		got, ok := uploaded[path]
+		if !ok || (content != "" && got != content) {
+			t.Errorf("Expected %s to be uploaded with %q, got %q", path, content, got)
+		}
+	}
+
+	// Without credentials nothing is deployed with dangling artifact URLs
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	if err := os.WriteFile(newBinaryPath(m.TargetBinaryDir), []byte("binary v3"), 0755); err != nil {
+		t.Fatalf("Failed to write binary: %v", err)
+	}
+	if err := m.DeployBinary(); err == nil {
+		t.Error("Expected deployment to fail without artifact credentials")
+	}
+}
+
+// TestTargets tests discovering, compiling and deploying several binaries in one run
+func TestTargets(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("GOFLAGS", "")
+	for path, content := range map[string]string{
+		"go.mod":                           "module example.com/multi\n\ngo 1.24\n",
+		"internal/lib/lib.go":              "//go:build !rewritten\n\npackage lib\n\nfunc Name() string { return \"original\" }\n",
+		"internal/lib/lib.go.rewritten.go": "//go:build rewritten\n\npackage lib\n\nfunc Name() string { return \"rewritten\" }\n",
+		"cmd/alpha/main.go":                "package main\n\nimport \"example.com/multi/internal/lib\"\n\nfunc main() { println(lib.Name()) }\n",
+		"cmd/beta/main.go":                 "package main\n\nimport \"example.com/multi/internal/wrap\"\n\nfunc main() { println(wrap.Name()) }\n",
+		"internal/wrap/wrap.go":            "package wrap\n\nimport \"example.com/multi/internal/lib\"\n\nfunc Name() string { return lib.Name() }\n",
+		"cmd/other/main.go":                "package main\n\nfunc main() {}\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	m := NewManager()
+	m.SuspiciousPath = "internal/lib/lib.go"
+	m.OutputPath = "internal/lib/lib.go.rewritten.go"
+	m.Sandbox = testSandbox()
+	targets, err := m.DiscoverTargets(context.Background())
+	if err != nil {
+		t.Fatalf("DiscoverTargets failed: %v", err)
+	}
+	// cmd/other does not import the rewritten package
+	if strings.Join(targets, ",") != filepath.Join("cmd", "alpha")+","+filepath.Join("cmd", "beta") {
+		t.Fatalf("Expected cmd/alpha and cmd/beta, got %v", targets)
+	}
+	m.TargetDirs = targets
+	if got := m.testTargets(); strings.Join(got, ",") != "./internal/lib,./cmd/alpha,./cmd/beta" {
+		t.Errorf("Expected the targets to be tested with the rewritten package, got %v", got)
+	}
+
+	if err := m.CompileRewritten(context.Background()); err != nil {
+		t.Fatalf("CompileRewritten failed: %v", err)
+	}
+	// The rewrite is built through an overlay, so the tree is never changed
+	if data, _ := os.ReadFile(m.SuspiciousPath); !strings.Contains(string(data), "original") || !exists(m.OutputPath) || exists(m.JournalPath()) {
+		t.Errorf("Expected the source files to stay in place, got %q", data)
+	}
+	if output, err := exec.Command(newBinaryPath("cmd/alpha")).CombinedOutput(); err != nil || strings.TrimSpace(string(output)) != "rewritten" {
+		t.Errorf("Expected the binary to be built from the rewrite, got %q (%v)", output, err)
+	}
+	if err := m.DiffBinaries(context.Background()); err != nil {
+		t.Fatalf("DiffBinaries failed: %v", err)
+	}
+	m.Scanners = []scanner.Scanner{stringScanner{}}
+	if err := m.ScanBinaries(context.Background()); err != nil {
+		t.Fatalf("ScanBinaries failed: %v", err)
+	}
+	m.Confirm = ConfirmFile
+	m.ApprovalFile = "approve"
+	alpha, beta := newBinaryPath("cmd/alpha"), newBinaryPath("cmd/beta")
+	if err := os.WriteFile(m.ApprovalFile, []byte(fileHash(alpha)+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write approval: %v", err)
+	}
+	if err := m.ConfirmDeploy(context.Background()); !errors.Is(err, ErrDeployDeclined) {
+		t.Errorf("Expected an approval of one binary to decline, got %v", err)
+	}
+	if err := os.WriteFile(m.ApprovalFile, []byte(fileHash(beta)+"\n"+fileHash(alpha)+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write approval: %v", err)
+	}
+	if err := m.ConfirmDeploy(context.Background()); err != nil {
+		t.Errorf("Expected an approval of both binaries to approve, got %v", err)
+	}
+
+	if err := m.DeployBinary(); err != nil {
+		t.Fatalf("DeployBinary failed: %v", err)
+	}
+	for _, target := range targets {
+		binary := BinaryPath(target)
+		manifest, err := VerifyBinary(binary, nil)
+		if err != nil {
+			t.Errorf("Expected %s to match its manifest: %v", binary, err)
+		} else if manifest.RunID != m.RunID {
+			t.Errorf("Expected %s to be deployed by run %s, got %s", binary, m.RunID, manifest.RunID)
+		} else if manifest.BinaryDissimilarity == nil {
+			t.Errorf("Expected the manifest of %s to record its dissimilarity", binary)
+		} else if d := manifest.Detections; len(d) != 1 || !slices.Equal(d[0].Lost, []string{"Prints.Original"}) || !slices.Equal(d[0].Gained, []string{"Prints.Rewritten"}) {
+			t.Errorf("Expected the manifest of %s to record the detections the rewrite changed, got %+v", binary, d)
+		}
+	}
+	if _, err := os.Stat(BinaryPath("cmd/other")); !os.IsNotExist(err) {
+		t.Error("Expected cmd/other not to be built")
+	}
+
+	// The image stage packages a single binary
+	m.ImageTag = "registry.example/app:latest"
+	if err := m.BuildImage(context.Background()); err == nil {
+		t.Error("Expected an image of several targets to be refused")
+	}
+}
+
+// TestWindowsPaths tests binary names, package patterns and approval files as they are on Windows
+// stringScanner detects the strings the test programs print
+type stringScanner struct{}
+
+func (stringScanner) Name() string {
+	return "strings"
+}
+
+func (stringScanner) Scan(_ context.Context, path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var detections []string
+	for _, s := range []string{"Original", "Rewritten"} {
+		if bytes.Contains(data, []byte(strings.ToLower(s))) {
+			detections = append(detections, "Prints."+s)
+		}
+	}
+	return detections, nil
+}
+
+// TestMatchYaraRules tests recording the YARA rules a rewrite stopped matching
+func TestMatchYaraRules(t *testing.T) {
+	skipWithoutShell(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	// Prints a rule for every marker the scanned file contains, like yara
+	script := "#!/bin/sh\nfor last; do :; done\n" +
+		"grep -q FAIL \"$last\" && exit 2\n" +
+		"for rule in Source Binary Both; do grep -q $rule \"$last\" && echo \"$rule $last\"; done\nexit 0\n"
+	for path, content := range map[string]string{
+		"bin/yara":       script,
+		"rules.yar":      "rule Source { condition: true }\n",
+		"lib.go":         "Source Both",
+		"lib.rewritten":  "Both",
+		"app.original":   "Binary",
+		"app.new":        "Source",
+		"broken.new":     "FAIL",
+		"other.new":      "",
+		"other.original": "",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	t.Setenv("PATH", filepath.Join(dir, "bin")+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	m := NewManager()
+	m.SuspiciousPath, m.OutputPath = "lib.go", "lib.rewritten"
+	if err := m.MatchYaraRules(context.Background(), m.SuspiciousPath, m.OutputPath); err != nil {
+		t.Fatalf("MatchYaraRules failed without rules: %v", err)
+	}
+	if m.yaraStopped != nil {
+		t.Error("Expected nothing to be matched without rules")
+	}
+
+	m.YaraRules = []string{"rules.yar"}
+	for _, pair := range [][2]string{{"lib.go", "lib.rewritten"}, {"app.original", "app.new"}} {
+		if err := m.MatchYaraRules(context.Background(), pair[0], pair[1]); err != nil {
+			t.Fatalf("MatchYaraRules failed: %v", err)
+		}
+	}
+	// Source stopped matching the source but started matching the binary,
+	// which is still recorded for the source
+	if got := m.yaraStoppedMatching("app.new"); !slices.Equal(got, []string{"Binary", "Source"}) {
+		t.Errorf("Expected Binary and Source to have stopped matching, got %v", got)
+	}
+	if got := m.yaraStoppedMatching("other.new"); !slices.Equal(got, []string{"Source"}) {
+		t.Errorf("Expected only the source's rules for a binary that was not matched, got %v", got)
+	}
+	if err := m.MatchYaraRules(context.Background(), "app.original", "broken.new"); err == nil {
+		t.Error("Expected a failing yara to fail")
+	}
+}
+
+func TestWindowsPaths(t *testing.T) {
+	defer func(saved string) { goos = saved }(goos)
+	goos = "windows"
+
+	dir := t.TempDir()
+	m := NewManager()
+	m.TargetBinaryDir = filepath.Join(dir, "app")
+	m.SuspiciousPath = filepath.Join(dir, "app.go")
+	m.OutputPath = filepath.Join(dir, "app.go.rewritten.go")
+	m.ApprovalFile = filepath.Join(dir, "approve")
+	m.Confirm = ConfirmFile
+	if got := BinaryPath(m.TargetBinaryDir); got != filepath.Join(dir, "app", "app.exe") {
+		t.Errorf("Expected an .exe binary, got %s", got)
+	}
+	if got := newBinaryPath(m.TargetBinaryDir); got != filepath.Join(dir, "app", "app.new.exe") {
+		t.Errorf("Expected the new binary to keep the .exe suffix, got %s", got)
+	}
+	if got := goPackage(filepath.Join("cmd", "app")); got != "./cmd/app" {
+		t.Errorf("Expected a slash-separated package pattern, got %s", got)
+	}
+
+	for path, content := range map[string]string{
+		m.SuspiciousPath: "package app", m.OutputPath: "package app // rewritten",
+		BinaryPath(m.TargetBinaryDir): "binary v1", BinaryPath(m.TargetBinaryDir) + ".backup": "binary v0",
+		newBinaryPath(m.TargetBinaryDir): "binary v2",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	// Windows PowerShell writes 'echo <hash> > file' as UTF-16 with a byte order mark
+	approval := []byte{0xFF, 0xFE}
+	for _, r := range fileHash(newBinaryPath(m.TargetBinaryDir)) + "\r\n" {
+		approval = append(approval, byte(r), 0)
+	}
+	if err := os.WriteFile(m.ApprovalFile, approval, 0644); err != nil {
+		t.Fatalf("Failed to write approval: %v", err)
+	}
+	if err := m.ConfirmDeploy(context.Background()); err != nil {
+		t.Errorf("Expected a UTF-16 approval file to approve, got %v", err)
+	}
+
+	if err := m.DeployBinary(); err != nil {
+		t.Fatalf("DeployBinary failed: %v", err)
+	}
+	if _, err := VerifyBinary(BinaryPath(m.TargetBinaryDir), nil); err != nil {
+		t.Errorf("Expected the .exe binary to match its manifest: %v", err)
+	}
+	if data, _ := os.ReadFile(BinaryPath(m.TargetBinaryDir) + ".backup"); string(data) != "binary v1" {
+		t.Errorf("Expected the stale backup to be replaced by the previous binary, got %q", data)
+	}
+
+	m.ImageTag = "registry.example/app:latest"
+	if err := m.BuildImage(context.Background()); err == nil {
+		t.Error("Expected a Windows binary not to be packaged as a Linux image")
+	}
+}
+
+// TestRestartHelper is the running instance TestRestartRunning restarts: it
+// writes its PID file and re-executes its binary on SIGHUP, or dies of it
+func TestRestartHelper(t *testing.T) {
+	pidFile := os.Getenv("METAMORPH_RESTART_PID_FILE")
+	if pidFile == "" {
+		t.Skip("only runs as the instance of TestRestartRunning")
+	}
+	signals := make(chan os.Signal, 1)
+	if os.Getenv("METAMORPH_RESTART_REEXEC") != "" {
+		signal.Notify(signals, syscall.SIGHUP)
+	}
+	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		t.Fatalf("Failed to write PID file: %v", err)
+	}
+	<-signals
+	binary, _ := filepath.Abs(os.Args[0])
+	t.Fatal(syscall.Exec(binary, os.Args, os.Environ()))
+}
+
+// TestRestartRunning tests that a signalled instance must come back running
+// the deployed binary
+func TestRestartRunning(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs signals and /proc")
+	}
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatalf("Failed to find the test binary: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		reexec  bool
+		wantErr bool
+	}{
+		{"re-executes", true, false},
+		{"dies", false, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			m := NewManager()
+			m.TargetBinaryDir = filepath.Join(dir, "app")
+			m.SuspiciousPath = filepath.Join(dir, "app.go")
+			m.OutputPath = filepath.Join(dir, "app.go.rewritten.go")
+			m.Restart = RestartSignal
+			m.RestartPIDFile = filepath.Join(dir, "app.pid")
+			m.RestartTimeout = 2 * time.Second
+			for path, src := range map[string]string{
+				BinaryPath(m.TargetBinaryDir): self, newBinaryPath(m.TargetBinaryDir): self,
+			} {
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("Failed to create dir: %v", err)
+				}
+				if err := copyFile(src, path); err != nil {
+					t.Fatalf("Failed to copy the test binary: %v", err)
+				}
+				if err := os.Chmod(path, 0755); err != nil {
+					t.Fatalf("Failed to make %s executable: %v", path, err)
+				}
+			}
+			for path, content := range map[string]string{m.SuspiciousPath: "package app", m.OutputPath: "package app // rewritten"} {
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", path, err)
+				}
+			}
+
+			// Start the instance from the binary about to be replaced
+			cmd := exec.Command(BinaryPath(m.TargetBinaryDir), "-test.run=^TestRestartHelper$")
+			cmd.Env = append(os.Environ(), "METAMORPH_RESTART_PID_FILE="+m.RestartPIDFile)
+			if tc.reexec {
+				cmd.Env = append(cmd.Env, "METAMORPH_RESTART_REEXEC=1")
+			}
+			if err := cmd.Start(); err != nil {
+				t.Fatalf("Failed to start the instance: %v", err)
+			}
+			defer func() {
+				cmd.Process.Kill()
+				cmd.Wait()
+			}()
+			for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+				if _, err := readPIDFile(m.RestartPIDFile); err == nil {
+					break
+				} else if time.Now().After(deadline) {
+					t.Fatalf("The instance did not write its PID file: %v", err)
+				}
+			}
+
+			if err := m.DeployBinary(); err != nil {
+				t.Fatalf("DeployBinary failed: %v", err)
+			}
+			if binary, _ := processBinary(cmd.Process.Pid); resolvedPath(binary) != resolvedPath(BinaryPath(m.TargetBinaryDir)+".backup") {
+				t.Fatalf("Expected the instance to run the backed up binary, got %s", binary)
+			}
+
+			err := m.RestartRunning()
+			if tc.wantErr {
+				if err == nil {
+					t.Error("Expected a restart to fail when the instance does not come back")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RestartRunning failed: %v", err)
+			}
+			if binary, _ := processBinary(cmd.Process.Pid); resolvedPath(binary) != resolvedPath(BinaryPath(m.TargetBinaryDir)) {
+				t.Errorf("Expected the instance to run the deployed binary, got %s", binary)
+			}
+		})
+	}
+}
+
+// TestRestartSystemd tests the systemd restart against a fake systemctl
+func TestRestartSystemd(t *testing.T) {
+	skipWithoutShell(t)
+	dir := t.TempDir()
+	m := NewManager()
+	m.TargetBinaryDir = filepath.Join(dir, "app")
+	m.Restart = RestartSystemd
+	m.RestartUnit = "app.service"
+	m.RestartTimeout = time.Second
+
+	// The fake unit's main process is the test itself, which neither runs the
+	// deployed binary nor changes its PID
+	calls := filepath.Join(dir, "calls")
+	m.Systemctl = filepath.Join(dir, "systemctl")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$@\" >> %s\n[ \"$1\" = show ] && echo %d\nexit 0\n", calls, os.Getpid())
+	if err := os.WriteFile(m.Systemctl, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write systemctl: %v", err)
+	}
+
+	if err := m.RestartRunning(); err == nil {
+		t.Error("Expected a main process running another binary to fail the restart")
+	}
+	data, _ := os.ReadFile(calls)
+	if !strings.Contains(string(data), "restart app.service\n") {
+		t.Errorf("Expected systemctl restart app.service, got %q", data)
+	}
+
+	m.Restart = "reload"
+	if err := m.RestartRunning(); err == nil {
+		t.Error("Expected an unknown restart mode to fail")
+	}
+}
+
+// TestTestCommands tests custom test commands replacing go test per package
+func TestTestCommands(t *testing.T) {
+	skipWithoutShell(t)
+	t.Setenv("OPENROUTER_API_KEY", "sk-or-secret")
+	m := NewManager()
+	m.Sandbox = testSandbox()
+	m.TestCommands = map[string]string{
+		"cmd/app": `echo "$METAMORPH_TEST_PACKAGE $METAMORPH_TEST_TAGS $METAMORPH_TEST_TIMEOUT key=$OPENROUTER_API_KEY"`,
+		"":        "exit 3",
+	}
+
+	results := m.testPackages(context.Background(), []string{"./cmd/app", "./internal/other"}, "")
+	if results[0].Err != nil {
+		t.Fatalf("Expected the package's own command to pass: %v", results[0].Err)
+	}
+	if got := strings.TrimSpace(results[0].Output); got != "./cmd/app rewritten 30s key=" {
+		t.Errorf("Expected the package, tags and timeout without credentials, got %q", got)
+	}
+	if results[1].Err == nil {
+		t.Error("Expected the command for every other package to fail the package")
+	}
+
+	delete(m.TestCommands, "")
+	if _, ok := m.testCommand("./internal/other"); ok {
+		t.Error("Expected packages without a command to use go test")
+	}
+
+	// go commands of a test command get the overlay through GOFLAGS
+	t.Setenv("GOFLAGS", "-mod=mod")
+	m.TestCommands = map[string]string{"": `echo "$METAMORPH_TEST_OVERLAY $GOFLAGS"`}
+	results = m.testPackages(context.Background(), []string{"./cmd/app"}, "/tmp/overlay.json")
+	if got := strings.TrimSpace(results[0].Output); got != "/tmp/overlay.json -mod=mod -overlay=/tmp/overlay.json" {
+		t.Errorf("Expected the overlay to be passed to the command, got %q", got)
+	}
+}
+
+// TestMutationTest tests that mutants of the original measure the strength of its tests
+func TestMutationTest(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("GOFLAGS", "")
+	lib := "package lib\n\nfunc Over(x, limit int) bool {\n\treturn x > limit\n}\n"
+	for path, content := range map[string]string{
+		"go.mod":                           "module example.com/mutants\n\ngo 1.24\n",
+		"internal/lib/lib.go":              lib,
+		"internal/lib/lib.go.rewritten.go": "//go:build rewritten\n\n" + lib,
+		"internal/lib/lib_test.go":         "package lib\n\nimport \"testing\"\n\nfunc TestOver(t *testing.T) {\n\tif !Over(5, 3) {\n\t\tt.Error(\"5 is not over 3\")\n\t}\n}\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	m := NewManager()
+	m.SuspiciousPath = "internal/lib/lib.go"
+	m.OutputPath = "internal/lib/lib.go.rewritten.go"
+	m.Sandbox = testSandbox()
+	m.Mutants = 10
+	m.MinMutationScore = 0.9
+
+	// The test never hits the boundary, so turning > into >= goes unnoticed
+	err := m.MutationTest(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "mutation score 0.0%") {
+		t.Fatalf("Expected the weak test to fail the gate, got %v", err)
+	}
+	if data, _ := os.ReadFile(m.SuspiciousPath); string(data) != lib {
+		t.Error("Expected the original source to be left untouched")
+	}
+
+	boundary := "\nfunc TestBoundary(t *testing.T) {\n\tif Over(3, 3) {\n\t\tt.Error(\"3 is over 3\")\n\t}\n}\n"
+	f, err := os.OpenFile("internal/lib/lib_test.go", os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open test: %v", err)
+	}
+	f.WriteString(boundary)
+	f.Close()
+	m.MinMutationScore = 0.5
+	if err := m.MutationTest(context.Background()); err != nil {
+		t.Fatalf("Expected the boundary test to pass the gate: %v", err)
+	}
+	if score := m.mutationScore(); score == nil || *score != 1 {
+		t.Errorf("Expected every mutant to be killed, got %v", score)
+	}
+
+	m.Mutants = 0
+	if err := m.MutationTest(context.Background()); err != nil || m.mutationScore() != nil {
+		t.Errorf("Expected disabled mutation testing to record no score, got %v", err)
+	}
+}
+
+// TestDifferentialTest tests that the generated differential tests run with
+// the tests and catch a rewritten function that behaves differently
+func TestDifferentialTest(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("GOFLAGS", "")
+	lib := "package lib\n\nfunc Over(x, limit int) bool {\n\treturn x > limit\n}\n\nfunc Twice(s string) string {\n\treturn s + s\n}\n"
+	// Over is off by one at the boundary, which no test covers
+	rewritten := "//go:build rewritten\n\npackage lib\n\nfunc Over(x, limit int) bool {\n\treturn x >= limit\n}\n\nfunc Twice(s string) string {\n\treturn s + s\n}\n"
+	for path, content := range map[string]string{
+		"go.mod":                           "module example.com/difftest\n\ngo 1.24\n",
+		"internal/lib/lib.go":              lib,
+		"internal/lib/lib.go.rewritten.go": rewritten,
+		"internal/lib/lib_test.go":         "package lib\n\nimport \"testing\"\n\nfunc TestOver(t *testing.T) {\n\tif !Over(5, 3) {\n\t\tt.Error(\"5 is not over 3\")\n\t}\n}\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	m := NewManager()
+	m.SuspiciousPath = "internal/lib/lib.go"
+	m.OutputPath = "internal/lib/lib.go.rewritten.go"
+	m.Sandbox = testSandbox()
+	if err := m.RunTests(context.Background()); err != nil {
+		t.Fatalf("Expected the weak test to pass without differential tests: %v", err)
+	}
+
+	m.DifferentialTest = true
+	err := m.RunTests(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "TestDifferentialOver") || strings.Contains(err.Error(), "TestDifferentialTwice") {
+		t.Fatalf("Expected the differential test of Over to fail, got %v", err)
+	}
+	// The tests only exist in the overlay
+	if matches, _ := filepath.Glob("internal/lib/*_test.go"); len(matches) != 1 {
+		t.Errorf("Expected the generated tests not to be written, got %v", matches)
+	}
+
+	// Only rewritten functions are tested once the rewrite is reported
+	m.rewriteReport = &rewriter.RewriteReport{Functions: []rewriter.FunctionReport{
+		{Function: "Over", Status: rewriter.FunctionFailed},
+		{Function: "Twice", Status: rewriter.FunctionRewritten},
+	}}
+	if err := m.RunTests(context.Background()); err != nil {
+		t.Errorf("Expected only Twice to be tested, got %v", err)
+	}
+}
+
+// TestMaxDuration tests that no stage starts after the time budget and that
+// compiled binaries are kept with a partial manifest
+func TestMaxDuration(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager()
+	m.TargetBinaryDir = filepath.Join(dir, "app")
+	m.SuspiciousPath = filepath.Join(dir, "app.go")
+	m.OutputPath = filepath.Join(dir, "app.go.rewritten.go")
+	m.JUnitPath = filepath.Join(dir, "junit.xml")
+	m.MaxDuration = time.Hour
+	newBinary := newBinaryPath(m.TargetBinaryDir)
+	for path, content := range map[string]string{
+		m.SuspiciousPath: "package app", m.OutputPath: "package app // rewritten", newBinary: "binary v2",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	m.StartBudget()
+	if err := m.Stage(context.Background(), "compile", func() error { return nil }); err != nil {
+		t.Fatalf("Expected a stage within the budget to run, got %v", err)
+	}
+	m.deadline = time.Now().Add(-time.Second)
+	ran := false
+	err := m.Stage(context.Background(), "test", func() error { ran = true; return nil })
+	if !errors.Is(err, ErrBudgetExceeded) || ran {
+		t.Fatalf("Expected the stage to be skipped with ErrBudgetExceeded, got %v (ran: %v)", err, ran)
+	}
+
+	manifest, err := VerifyBinary(newBinary, nil)
+	if err != nil {
+		t.Fatalf("Expected a partial manifest for the compiled binary: %v", err)
+	}
+	if manifest.StoppedAt != "test" {
+		t.Errorf("Expected the manifest to record the stage the run stopped at, got %+v", manifest)
+	}
+
+	if err := m.WriteJUnit(); err != nil {
+		t.Fatalf("WriteJUnit failed: %v", err)
+	}
+	data, err := os.ReadFile(m.JUnitPath)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	var suites junitSuites
+	if err := xml.Unmarshal(data, &suites); err != nil {
+		t.Fatalf("Invalid JUnit XML: %v\n%s", err, data)
+	}
+	if test := suites.Suites[0].Cases[1]; test.Skipped == nil || test.Failure != nil || suites.Failures != 0 {
+		t.Errorf("Expected the stopped stage to be skipped, got:\n%s", data)
+	}
+
+	if err := m.CleanUp(); err != nil {
+		t.Fatalf("CleanUp failed: %v", err)
+	}
+	if _, err := os.Stat(ManifestPath(newBinary)); !os.IsNotExist(err) {
+		t.Error("Expected CleanUp to remove the partial manifest")
+	}
+
+	m.MaxCost, m.MaxTotalTokens = 0.5, 20000
+	args := strings.Join(m.jobArgs(CorpusItem{Source: m.SuspiciousPath}), " ")
+	if !strings.Contains(args, "-max-cost 0.5") || !strings.Contains(args, "-max-total-tokens 20000") {
+		t.Errorf("Expected the token and cost budgets to be passed to jobs, got %s", args)
+	}
+}
+
+// TestCanceledRun tests that no stage starts once the run is canceled
+func TestCanceledRun(t *testing.T) {
+	m := NewManager()
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := m.Stage(ctx, "compile", func() error { return nil }); err != nil {
+		t.Fatalf("Expected a stage of a running run to run, got %v", err)
+	}
+	cancel()
+	ran := false
+	err := m.Stage(ctx, "test", func() error { ran = true; return nil })
+	if !errors.Is(err, context.Canceled) || ran {
+		t.Fatalf("Expected the stage to be skipped with context.Canceled, got %v (ran: %v)", err, ran)
+	}
+	if len(m.stages) != 2 || !m.stages[1].Skipped {
+		t.Errorf("Expected the stopped stage to be recorded as skipped, got %+v", m.stages)
+	}
+
+	if result := m.RunJob(ctx); result.FailedStage != "rewrite" || !strings.Contains(result.Error, "canceled") {
+		t.Errorf("Expected a canceled job to stop before the rewrite, got %+v", result)
+	}
+}
+
+// TestDashboard tests that stages, function rewrites and corpus jobs reach the dashboard
+func TestDashboard(t *testing.T) {
+	dir := t.TempDir()
+	out, err := os.Create(filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatalf("Failed to create output: %v", err)
+	}
+	defer out.Close()
+	m := NewManager()
+	m.SuspiciousPath = "app.go"
+	m.OutputPath = filepath.Join(dir, "app.go.rewritten.go")
+	m.Dashboard = dashboard.New(dashboard.ModePlain, out, "run")
+
+	report := &rewriter.RewriteReport{Source: "app.go", Functions: []rewriter.FunctionReport{
+		{Function: "Add", Status: rewriter.FunctionRewritten, Tokens: 300},
+	}}
+	if err := report.Save(rewriter.ReportPath(m.OutputPath)); err != nil {
+		t.Fatalf("Failed to save report: %v", err)
+	}
+	m.Dashboard.Begin(m.SuspiciousPath)
+	m.Stage(context.Background(), "rewrite", func() error { m.loadRewriteReport(); return nil })
+	m.Stage(context.Background(), "compile", func() error { return errors.New("compilation failed") })
+	m.showJobResult(JobResult{Source: "lib.go", FailedStage: "test", Error: "exit status 1", LOCDelta: 10})
+
+	items := m.Dashboard.Items()
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 files, got %+v", items)
+	}
+	app, lib := items[0], items[1]
+	if len(app.Stages) != 2 || app.Stages[0].Status != dashboard.Passed || app.Stages[1].Status != dashboard.Failed || app.Tokens() != 300 {
+		t.Errorf("Unexpected progress of app.go: %+v", app)
+	}
+	if lib.Status != dashboard.Failed || lib.Error != "test: exit status 1" || !lib.HasMetrics || lib.LOC != 10 {
+		t.Errorf("Unexpected progress of lib.go: %+v", lib)
+	}
+}
+
+// TestSkip tests that generated and vendored sources are neither scheduled nor rewritten
+func TestSkip(t *testing.T) {
+	dir := t.TempDir()
+	generated := filepath.Join(dir, "gen.go")
+	plain := filepath.Join(dir, "plain.go")
+	if err := os.WriteFile(generated, []byte("// Code generated by stringer. DO NOT EDIT.\n\npackage p\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(plain, []byte("package p\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager()
+	items, err := m.FilterCorpus([]CorpusItem{{Source: generated}, {Source: "vendor/x/x.go"}, {Source: plain}})
+	if err != nil {
+		t.Fatalf("FilterCorpus failed: %v", err)
+	}
+	if len(items) != 1 || items[0].Source != plain {
+		t.Errorf("Expected only the plain source to be kept, got %+v", items)
+	}
+	if slices.Contains(m.jobArgs(items[0]), "-skip") {
+		t.Error("Expected the default rules not to be passed to jobs")
+	}
+
+	m.SuspiciousPath = generated
+	m.ForceRewrite = true
+	if err := m.RunRewriter(context.Background()); err == nil || !strings.Contains(err.Error(), "generated code") {
+		t.Errorf("Expected the generated source to be refused, got %v", err)
+	}
+
+	m.Skip = rewriter.SkipRules{}
+	if args := m.jobArgs(items[0]); !slices.Contains(args, "-skip") || args[len(args)-1] != "" {
+		t.Errorf("Expected the override to be passed to jobs, got %v", args)
+	}
+}
+
+// TestPipeline tests that steps can be selected, skipped and inserted and
+// that hooks run around every step
+func TestPipeline(t *testing.T) {
+	if names := DryRunPipeline().Names(); strings.Join(names, ",") != "rewrite,capabilities,policy,compile,bindiff,scan,test,mutation,smoke" {
+		t.Errorf("Unexpected dry run steps: %v", names)
+	}
+	p := DefaultPipeline()
+	if err := p.Select([]string{"rewrite", "lint"}); err == nil || !strings.Contains(err.Error(), `unknown step "lint"`) {
+		t.Errorf("Expected an unknown step to be refused, got %v", err)
+	}
+	if err := p.Select([]string{StepDeploy}); err == nil {
+		t.Error("Expected deploy to be refused without confirm")
+	}
+	if err := p.Select([]string{StepMetrics, StepRewrite, StepCleanup}); err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if names := strings.Join(p.Names(), ","); names != "rewrite,metrics,cleanup" {
+		t.Errorf("Expected the selected steps in pipeline order, got %s", names)
+	}
+
+	var calls []string
+	step := func(name string, err error) Step {
+		return NewStep(name, func(context.Context, *Manager) error { calls = append(calls, name); return err })
+	}
+	p = &Pipeline{Steps: []Step{step("a", nil), step("c", errors.New("c broke")), step("d", nil)}}
+	if err := p.Insert("a", step("b", nil)); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := p.Insert("", step("first", nil)); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := p.Skip("first"); err != nil {
+		t.Fatalf("Skip failed: %v", err)
+	}
+	if err := p.Skip("first"); err == nil {
+		t.Error("Expected skipping a missing step to fail")
+	}
+	p.Pre = append(p.Pre, func(_ context.Context, _ *Manager, name string) error {
+		calls = append(calls, "pre "+name)
+		return nil
+	})
+	p.Post = append(p.Post, func(_ context.Context, _ *Manager, name string, err error) error {
+		calls = append(calls, "post "+name)
+		if name == "c" {
+			return fmt.Errorf("hook saw: %w", err)
+		}
+		return err
+	})
+
+	m := NewManager()
+	m.Pipeline = p
+	err := m.Run(context.Background())
+	if err == nil || err.Error() != "c step failed: hook saw: c broke" {
+		t.Fatalf("Expected the run to fail at c through the hook, got %v", err)
+	}
+	if got := strings.Join(calls, ","); got != "pre a,a,post a,pre b,b,post b,pre c,c,post c" {
+		t.Errorf("Unexpected calls: %s", got)
+	}
+	if len(m.stages) != 3 || m.stages[2].Name != "c" {
+		t.Errorf("Expected the steps to be recorded as stages, got %+v", m.stages)
+	}
+}
+
+// TestRunGenerations tests that every generation is rewritten from the one
+// before, measured, compiled and tested, and that the first failure ends the run
+func TestRunGenerations(t *testing.T) {
+	skipWithoutShell(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("GOFLAGS", "")
+	// Appends a function per generation; the third one does not compile
+	fake := `#!/bin/sh
+while [ $# -gt 0 ]; do
+	case "$1" in
+	-input) in=$2; shift ;;
+	-output) out=$2; shift ;;
+	esac
+	shift
+done
+n=$(grep -c '^func' "$in")
+body=""
+[ "$n" -ge 3 ] && body="undefined()"
+{ printf '//go:build rewritten\n\n'; grep -v '^//go:build' "$in"; printf '\nfunc extra%s() { %s }\n' "$n" "$body"; } > "$out"
+`
+	for path, content := range map[string]string{
+		"go.mod":                   "module example.com/gen\n\ngo 1.24\n",
+		"internal/lib/lib.go":      "//go:build !rewritten\n\npackage lib\n\nfunc Name() string { return \"lib\" }\n",
+		"internal/lib/lib_test.go": "package lib\n\nimport \"testing\"\n\nfunc TestName(t *testing.T) {\n\tif Name() != \"lib\" {\n\t\tt.Fail()\n\t}\n}\n",
+		"cmd/app/main.go":          "package main\n\nimport \"example.com/gen/internal/lib\"\n\nfunc main() { println(lib.Name()) }\n",
+		"rewriter":                 fake,
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	m := NewManager()
+	m.RewriterBinary = filepath.Join(dir, "rewriter")
+	m.SuspiciousPath = "internal/lib/lib.go"
+	m.OutputPath = "internal/lib/lib.go.rewritten.go"
+	m.TargetBinaryDir = "cmd/app"
+	m.Sandbox = testSandbox()
+	generations, err := m.RunGenerations(context.Background(), 5)
+	if err == nil || !strings.Contains(err.Error(), "generation 3 failed") {
+		t.Fatalf("Expected the third generation to fail, got %v", err)
+	}
+	if len(generations) != 3 || !generations[0].Passed() || !generations[1].Passed() || generations[2].FailedStage != StepCompile {
+		t.Fatalf("Expected two passing generations and a compile failure, got %+v", generations)
+	}
+	if generations[0].BinaryDissimilarity == nil || *generations[0].BinaryDissimilarity <= 0 {
+		t.Errorf("Expected the binary of every generation to be compared with the original, got %+v", generations[0])
+	}
+	if generations[0].LOC >= generations[1].LOC || generations[1].LOCDelta <= 0 {
+		t.Errorf("Expected the code to grow with every generation, got %+v", generations)
+	}
+	if data, _ := os.ReadFile(m.GenerationPath(2)); !strings.Contains(string(data), "func extra1()") || !strings.Contains(string(data), "func extra2()") {
+		t.Errorf("Expected generation 2 to be rewritten from generation 1, got %q", data)
+	}
+	if data, _ := os.ReadFile(m.SuspiciousPath); strings.Contains(string(data), "extra") {
+		t.Errorf("Expected the original to be left alone, got %q", data)
+	}
+
+	data, err := os.ReadFile(m.GenerationsReportPath())
+	if err != nil {
+		t.Fatalf("Expected the results to be saved: %v", err)
+	}
+	var saved []Generation
+	if err := json.Unmarshal(data, &saved); err != nil || len(saved) != 3 || saved[2].Error == "" {
+		t.Errorf("Unexpected saved results: %s (%v)", data, err)
+	}
+	var out bytes.Buffer
+	if err := WriteGenerations(&out, generations); err != nil || !strings.Contains(out.String(), "FAIL (compile)") {
+		t.Errorf("Unexpected summary: %s (%v)", out.String(), err)
+	}
+}
+
+// TestDeploySummaryBinaryDiff tests that the summary compares the symbols and
+// sections of the deployed and the new binary
+func TestDeploySummaryBinaryDiff(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skipf("test binary not found: %v", err)
+	}
+	dir := t.TempDir()
+	m := NewManager()
+	m.TargetBinaryDir = filepath.Join(dir, "app")
+	m.SuspiciousPath = filepath.Join(dir, "missing.go")
+	m.OutputPath = filepath.Join(dir, "missing.go.rewritten.go")
+	if err := os.MkdirAll(m.TargetBinaryDir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	for _, path := range []string{BinaryPath(m.TargetBinaryDir), newBinaryPath(m.TargetBinaryDir)} {
+		if err := os.Symlink(exe, path); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	var out bytes.Buffer
+	m.writeDeploySummary(&out)
+	for _, want := range []string{"0 added, 0 removed, 0 resized", "sections changed: none", "dissimilarity: 0.00"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the summary:\n%s", want, out.String())
+		}
+	}
+}
+
+// TestRunDaemonCancel tests that canceling the daemon's context stops the run
+// in flight rather than waiting for it to finish
+func TestRunDaemonCancel(t *testing.T) {
+	started := make(chan struct{})
+	m := NewManager()
+	m.Pipeline = &Pipeline{Steps: []Step{&funcStep{name: "block", failure: "block failed", run: func(_ *Manager, ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.RunDaemon(ctx, time.Hour)
+		close(done)
+	}()
+	<-started
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected canceling the context to stop the daemon during a run")
+	}
+}
@@ -0,0 +1,143 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Hekzory/MetamorphLLM/internal/mutation"
+	"github.com/Hekzory/MetamorphLLM/internal/sandbox"
+)
+
+// MutationTest runs the tests against mutants of the original SuspiciousPath
+// and fails if they kill fewer than MinMutationScore of them. Passing tests
+// only show equivalence if the same tests catch small semantic changes.
+func (m *Manager) MutationTest(ctx context.Context) error {
+	m.mutationReport = nil
+	if m.Mutants <= 0 {
+		logger.Info("Mutation testing disabled, skipping")
+		return nil
+	}
+
+	src, err := os.ReadFile(m.SuspiciousPath)
+	if err != nil {
+		return fmt.Errorf("failed to read original source: %w", err)
+	}
+	all, err := mutation.Generate(m.SuspiciousPath, src)
+	if err != nil {
+		return err
+	}
+	mutants := mutation.Sample(all, m.Mutants)
+	logger.Info("Testing mutants", "mutants", len(mutants), "total", len(all), "file", m.SuspiciousPath)
+
+	// Mutants replace the original only through go test -overlay, so the
+	// source on disk is never modified
+	dir, err := os.MkdirTemp("", "metamorph-mutants-*")
+	if err != nil {
+		return fmt.Errorf("failed to create mutant directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	original, err := filepath.Abs(m.SuspiciousPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve source path: %w", err)
+	}
+
+	jobs := m.TestJobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	results := make([]mutation.Result, len(mutants))
+	errs := make([]error, len(mutants))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, mu := range mutants {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			status, err := m.testMutant(ctx, dir, i, original, mu)
+			results[i], errs[i] = mutation.Result{Mutant: mu, Status: status}, err
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	report := mutation.Report{Results: results}
+	m.mutationReport = &report
+	killed, valid := report.Counts()
+	logger.Info("Mutation testing finished", "score_percent", math.Round(report.Score()*1000)/10,
+		"killed", killed, "compiled", valid, "not_compiled", len(results)-valid)
+	for _, mu := range report.Survivors() {
+		logger.Info("Mutant survived", "mutant", mu)
+	}
+	if report.Score() < m.MinMutationScore {
+		return fmt.Errorf("mutation score %.1f%% is below the required %.1f%%: the tests are too weak to show the rewrite is equivalent",
+			report.Score()*100, m.MinMutationScore*100)
+	}
+	return nil
+}
+
+// testMutant runs the tested packages with the original source replaced by
+// mutant i and tells whether the tests noticed
+func (m *Manager) testMutant(ctx context.Context, dir string, i int, original string, mu mutation.Mutant) (mutation.Status, error) {
+	source := filepath.Join(dir, fmt.Sprintf("mutant-%d.go", i))
+	if err := os.WriteFile(source, mu.Source, 0644); err != nil {
+		return "", fmt.Errorf("failed to write mutant: %w", err)
+	}
+	overlay, err := json.Marshal(map[string]map[string]string{"Replace": {original: source}})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode overlay: %w", err)
+	}
+	overlayPath := filepath.Join(dir, fmt.Sprintf("overlay-%d.json", i))
+	if err := os.WriteFile(overlayPath, overlay, 0644); err != nil {
+		return "", fmt.Errorf("failed to write overlay: %w", err)
+	}
+
+	// Mutants are built from the original, so the build tag is not set
+	sb, err := sandbox.New(m.Sandbox)
+	if err != nil {
+		return "", err
+	}
+	defer sb.Close()
+	args := []string{"test", "-vet=off", "-overlay", overlayPath, "-timeout", m.TestTimeout}
+	if execFlag := sb.ExecFlag(); execFlag != "" {
+		args = append(args, "-exec", execFlag)
+	}
+	cmd := m.goCommand(ctx, append(args, m.testTargets()...)...)
+	cmd.Env = sandbox.ScrubEnv(cmd.Env)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	switch err := cmd.Run(); {
+	case ctx.Err() != nil:
+		// Killed by the cancellation, not by the tests
+		return "", fmt.Errorf("mutation testing stopped: %w", context.Cause(ctx))
+	case err == nil:
+		return mutation.Survived, nil
+	case strings.Contains(output.String(), "[build failed]") || strings.Contains(output.String(), "[setup failed]"):
+		return mutation.Invalid, nil
+	default:
+		return mutation.Killed, nil
+	}
+}
+
+// mutationScore returns the score of the last mutation test, or nil if none ran
+func (m *Manager) mutationScore() *float64 {
+	if m.mutationReport == nil {
+		return nil
+	}
+	score := m.mutationReport.Score()
+	return &score
+}
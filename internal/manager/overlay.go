@@ -0,0 +1,80 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// writeOverlay writes a go build -overlay file that puts a copy of the
+// rewritten source in the original's place and hides the rewritten file
+// itself, so builds and tests see the rewrite while the tree on disk is never
+// changed. The extra files, by path, are added to the overlay too. The
+// returned function removes the overlay.
+func (m *Manager) writeOverlay(extra map[string][]byte) (string, func(), error) {
+	original, err := filepath.Abs(m.SuspiciousPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to resolve source path: %w", err)
+	}
+	rewritten, err := filepath.Abs(m.OutputPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to resolve rewritten path: %w", err)
+	}
+	// A copy, so the build sees the file as it was when the step started
+	content, err := os.ReadFile(rewritten)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read rewritten source file: %w", err)
+	}
+
+	dir, err := os.MkdirTemp("", "metamorph-overlay-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create overlay directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	source := filepath.Join(dir, filepath.Base(original))
+	if err := os.WriteFile(source, content, 0644); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write overlay source: %w", err)
+	}
+	// An empty replacement makes go treat the file as deleted
+	replace := map[string]string{original: source, rewritten: ""}
+	for i, path := range slices.Sorted(maps.Keys(extra)) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			cleanup()
+			return "", nil, fmt.Errorf("failed to resolve %s: %w", path, err)
+		}
+		replace[abs] = filepath.Join(dir, fmt.Sprintf("%d-%s", i, filepath.Base(path)))
+		if err := os.WriteFile(replace[abs], extra[path], 0644); err != nil {
+			cleanup()
+			return "", nil, fmt.Errorf("failed to write overlay file: %w", err)
+		}
+	}
+	overlay, err := json.Marshal(map[string]map[string]string{"Replace": replace})
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to encode overlay: %w", err)
+	}
+	path := filepath.Join(dir, "overlay.json")
+	if err := os.WriteFile(path, overlay, 0644); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write overlay: %w", err)
+	}
+	return path, cleanup, nil
+}
+
+// withGoFlag adds flag to the GOFLAGS of env, so go commands that a custom
+// test command runs pick it up
+func withGoFlag(env []string, flag string) []string {
+	for i, kv := range env {
+		if value, ok := strings.CutPrefix(kv, "GOFLAGS="); ok {
+			env[i] = "GOFLAGS=" + strings.Join(append(strings.Fields(value), flag), " ")
+			return env
+		}
+	}
+	return append(env, "GOFLAGS="+flag)
+}
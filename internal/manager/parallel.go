@@ -0,0 +1,167 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/sandbox"
+)
+
+// PackageTestResult is the outcome of testing one package against the rewritten code
+type PackageTestResult struct {
+	Package  string
+	Duration time.Duration
+	Output   string // Combined stdout and stderr of go test or the custom test command
+	Err      error
+}
+
+// testTargets returns the packages tested against the rewritten code: by
+// default the suspicious package and the packages of TargetDirs
+func (m *Manager) testTargets() []string {
+	if len(m.TestPackages) > 0 {
+		return m.TestPackages
+	}
+	packages := []string{goPackage(filepath.Dir(m.SuspiciousPath))}
+	for _, dir := range m.TargetDirs {
+		packages = append(packages, goPackage(dir))
+	}
+	return packages
+}
+
+// testPackages runs go test for every package with the given -overlay, at most
+// m.TestJobs at a time. Results are returned in the order of packages.
+// Canceling ctx kills the running tests.
+func (m *Manager) testPackages(ctx context.Context, packages []string, overlay string) []PackageTestResult {
+	jobs := m.TestJobs
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	results := make([]PackageTestResult, len(packages))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, pkg := range packages {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = m.testPackage(ctx, pkg, overlay)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// tagsFlag returns the go flag selecting the rewritten file, or nothing if it
+// is not constrained by a build tag
+func (m *Manager) tagsFlag() []string {
+	if m.BuildTag == "" {
+		return nil
+	}
+	return []string{"-tags=" + m.BuildTag}
+}
+
+// testCommand returns the shell command that replaces go test for a package:
+// its own entry in TestCommands, or the "" entry that applies to all packages
+func (m *Manager) testCommand(pkg string) (string, bool) {
+	normalize := func(p string) string { return strings.TrimPrefix(filepath.ToSlash(p), "./") }
+	for key, command := range m.TestCommands {
+		if key != "" && normalize(key) == normalize(pkg) {
+			return command, true
+		}
+	}
+	command, ok := m.TestCommands[""]
+	return command, ok
+}
+
+// testPackage runs go test for a single package with the build tag and
+// overlay, or the package's custom test command
+func (m *Manager) testPackage(ctx context.Context, pkg, overlay string) PackageTestResult {
+	start := time.Now()
+
+	// Test binaries run LLM-modified code, so they run in a sandbox of their own
+	sb, err := sandbox.New(m.Sandbox)
+	if err != nil {
+		return PackageTestResult{Package: pkg, Err: err}
+	}
+	defer sb.Close()
+
+	var cmd *exec.Cmd
+	if command, ok := m.testCommand(pkg); ok {
+		// The command runs on the host like go test itself; it keeps test
+		// binaries in the sandbox by passing METAMORPH_TEST_EXEC to go test -exec.
+		// Its go commands get the overlay through GOFLAGS.
+		shell := []string{"sh", "-c"}
+		if goos == "windows" {
+			shell = []string{"cmd", "/C"}
+		}
+		cmd = exec.CommandContext(ctx, shell[0], shell[1], command)
+		cmd.Env = append(m.goEnv(),
+			"METAMORPH_TEST_PACKAGE="+pkg,
+			"METAMORPH_TEST_TAGS="+m.BuildTag,
+			"METAMORPH_TEST_TIMEOUT="+m.TestTimeout,
+			"METAMORPH_TEST_EXEC="+sb.ExecFlag(),
+			"METAMORPH_TEST_OVERLAY="+overlay,
+		)
+		if overlay != "" {
+			cmd.Env = withGoFlag(cmd.Env, "-overlay="+overlay)
+		}
+	} else {
+		args := []string{"test"}
+		if overlay != "" {
+			args = append(args, "-overlay", overlay)
+		}
+		args = append(args, m.tagsFlag()...)
+		args = append(args, "-timeout", m.TestTimeout)
+		if execFlag := sb.ExecFlag(); execFlag != "" {
+			args = append(args, "-exec", execFlag)
+		}
+		cmd = m.goCommand(ctx, append(args, pkg)...)
+	}
+	cmd.Env = sandbox.ScrubEnv(cmd.Env)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err = cmd.Run()
+	return PackageTestResult{Package: pkg, Duration: time.Since(start), Output: output.String(), Err: err}
+}
+
+// WriteTestSummary prints one line per tested package
+func WriteTestSummary(w io.Writer, results []PackageTestResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGE\tRESULT\tDURATION")
+	for _, r := range results {
+		status := "PASS"
+		if r.Err != nil {
+			status = "FAIL"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Package, status, r.Duration.Round(time.Millisecond))
+	}
+	return tw.Flush()
+}
+
+// testFailure aggregates the failed packages into a single error
+func testFailure(results []PackageTestResult) error {
+	var failed []string
+	var details strings.Builder
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r.Package)
+			fmt.Fprintf(&details, "\n--- %s: %v\n%s", r.Package, r.Err, r.Output)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("tests failed on rewritten code in %d of %d packages (%s):%s",
+		len(failed), len(results), strings.Join(failed, ", "), details.String())
+}
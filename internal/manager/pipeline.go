@@ -0,0 +1,215 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Names of the steps of DefaultPipeline, in order
+const (
+	StepRewrite      = "rewrite"
+	StepCapabilities = "capabilities"
+	StepPolicy       = "policy"
+	StepMetrics      = "metrics"
+	StepCompile      = "compile"
+	StepBinaryDiff   = "bindiff"
+	StepScan         = "scan"
+	StepTest         = "test"
+	StepMutation     = "mutation"
+	StepSmoke        = "smoke"
+	StepConfirm      = "confirm"
+	StepDeploy       = "deploy"
+	StepRestart      = "restart"
+	StepImage        = "image"
+	StepUpload       = "upload"
+	StepCleanup      = "cleanup"
+)
+
+// Step is one stage of a pipeline run
+type Step interface {
+	Name() string
+	Run(ctx context.Context, m *Manager) error
+}
+
+// funcStep is a Step that calls a function
+type funcStep struct {
+	name    string
+	failure string                                      // Prefix of the step's errors, e.g. "compilation step failed"
+	run     func(m *Manager, ctx context.Context) error // A method expression such as (*Manager).RunTests
+	// commits makes the step and every later one run to completion, even
+	// past the time budget or once the run is canceled
+	commits bool
+}
+
+// NewStep returns a step that calls run
+func NewStep(name string, run func(ctx context.Context, m *Manager) error) Step {
+	return &funcStep{name: name, run: func(m *Manager, ctx context.Context) error { return run(ctx, m) }}
+}
+
+func (s *funcStep) Name() string {
+	return s.name
+}
+
+func (s *funcStep) Run(ctx context.Context, m *Manager) error {
+	return s.run(m, ctx)
+}
+
+// PreHook runs before every step of a pipeline; an error fails the step
+// without running it
+type PreHook func(ctx context.Context, m *Manager, step string) error
+
+// PostHook runs after every step that ran, with its error; the error it
+// returns becomes the step's
+type PostHook func(ctx context.Context, m *Manager, step string, err error) error
+
+// Pipeline is the sequence of steps a run executes. Steps run in order until
+// one fails.
+type Pipeline struct {
+	Steps []Step
+	Pre   []PreHook
+	Post  []PostHook
+}
+
+// DefaultPipeline returns the steps of a full run, from rewriting to cleaning up
+func DefaultPipeline() *Pipeline {
+	return &Pipeline{Steps: []Step{
+		&funcStep{name: StepRewrite, failure: "rewriter step failed", run: (*Manager).RunRewriter},
+		// Refuse rewrites that gained capabilities
+		&funcStep{name: StepCapabilities, failure: "capability check failed", run: withoutContext((*Manager).CheckCapabilities)},
+		// Enforce the environment's policy
+		&funcStep{name: StepPolicy, failure: "policy check failed", run: withoutContext((*Manager).CheckPolicy)},
+		&funcStep{name: StepMetrics, failure: "metrics calculation failed", run: (*Manager).CalculateMetrics},
+		&funcStep{name: StepCompile, failure: "compilation step failed", run: (*Manager).CompileRewritten},
+		// Measure how different the rewrite made the binaries
+		&funcStep{name: StepBinaryDiff, failure: "binary comparison failed", run: (*Manager).DiffBinaries},
+		// Report what static scanners detect in the binaries
+		&funcStep{name: StepScan, failure: "scan step failed", run: (*Manager).ScanBinaries},
+		&funcStep{name: StepTest, failure: "testing step failed", run: (*Manager).RunTests},
+		// Check that the tests catch mutants of the original
+		&funcStep{name: StepMutation, failure: "mutation testing step failed", run: (*Manager).MutationTest},
+		// Run the rewritten binary in the sandbox
+		&funcStep{name: StepSmoke, failure: "smoke run failed", run: (*Manager).SmokeRun},
+		// Wait for a human to approve the deployment
+		&funcStep{name: StepConfirm, failure: "confirmation step failed", run: (*Manager).ConfirmDeploy},
+		// A deployment that starts is completed, however long it takes and
+		// even if the run is canceled
+		&funcStep{name: StepDeploy, failure: "deployment step failed", run: withoutContext((*Manager).DeployBinary), commits: true},
+		// Make the running instance execute the deployed binary
+		&funcStep{name: StepRestart, failure: "restart step failed", run: withoutContext((*Manager).RestartRunning)},
+		// Package the deployed binary as a container image
+		&funcStep{name: StepImage, failure: "image step failed", run: (*Manager).BuildImage},
+		&funcStep{name: StepUpload, failure: "upload step failed", run: (*Manager).UploadArtifacts},
+		&funcStep{name: StepCleanup, failure: "cleanup step failed", run: withoutContext((*Manager).CleanUp)},
+	}}
+}
+
+// DryRunPipeline returns the steps of a dry run: rewriting and testing, up
+// to the smoke run, without deploying
+func DryRunPipeline() *Pipeline {
+	p := DefaultPipeline()
+	p.Steps = slices.DeleteFunc(p.Steps[:p.Index(StepConfirm)], func(s Step) bool { return s.Name() == StepMetrics })
+	return p
+}
+
+// withoutContext adapts a step method that takes no context
+func withoutContext(run func(m *Manager) error) func(*Manager, context.Context) error {
+	return func(m *Manager, _ context.Context) error { return run(m) }
+}
+
+// Names returns the names of the steps in order
+func (p *Pipeline) Names() []string {
+	names := make([]string, len(p.Steps))
+	for i, s := range p.Steps {
+		names[i] = s.Name()
+	}
+	return names
+}
+
+// Index returns the position of the named step, or -1
+func (p *Pipeline) Index(name string) int {
+	return slices.IndexFunc(p.Steps, func(s Step) bool { return s.Name() == name })
+}
+
+// Insert adds step right after the step named after, or first if after is empty
+func (p *Pipeline) Insert(after string, step Step) error {
+	i := 0
+	if after != "" {
+		if i = p.Index(after); i < 0 {
+			return p.unknown(after)
+		}
+		i++
+	}
+	p.Steps = slices.Insert(p.Steps, i, step)
+	return nil
+}
+
+// Skip removes the named steps
+func (p *Pipeline) Skip(names ...string) error {
+	for _, name := range names {
+		i := p.Index(name)
+		if i < 0 {
+			return p.unknown(name)
+		}
+		p.Steps = slices.Delete(p.Steps, i, i+1)
+	}
+	return nil
+}
+
+// Select keeps only the named steps, in pipeline order. A deployment needs
+// its approval, so deploy cannot be selected without confirm.
+func (p *Pipeline) Select(names []string) error {
+	for _, name := range names {
+		if p.Index(name) < 0 {
+			return p.unknown(name)
+		}
+	}
+	if slices.Contains(names, StepDeploy) && p.Index(StepConfirm) >= 0 && !slices.Contains(names, StepConfirm) {
+		return fmt.Errorf("step %s needs step %s", StepDeploy, StepConfirm)
+	}
+	p.Steps = slices.DeleteFunc(p.Steps, func(s Step) bool { return !slices.Contains(names, s.Name()) })
+	return nil
+}
+
+// unknown describes a step name that is not in the pipeline
+func (p *Pipeline) unknown(name string) error {
+	return fmt.Errorf("unknown step %q (steps: %s)", name, strings.Join(p.Names(), ", "))
+}
+
+// Run executes the steps through Stage, so each is recorded for the JUnit
+// report and the dashboard, and stops at the first failure
+func (p *Pipeline) Run(ctx context.Context, m *Manager) error {
+	for _, step := range p.Steps {
+		fs, _ := step.(*funcStep)
+		if fs != nil && fs.commits {
+			m.deadline = time.Time{}
+			ctx = context.WithoutCancel(ctx)
+		}
+		err := m.Stage(ctx, step.Name(), func() error {
+			return p.runStep(ctx, m, step)
+		})
+		if err != nil {
+			if fs != nil && fs.failure != "" {
+				return fmt.Errorf("%s: %w", fs.failure, err)
+			}
+			return fmt.Errorf("%s step failed: %w", step.Name(), err)
+		}
+	}
+	return nil
+}
+
+// runStep runs one step between the hooks
+func (p *Pipeline) runStep(ctx context.Context, m *Manager, step Step) error {
+	for _, hook := range p.Pre {
+		if err := hook(ctx, m, step.Name()); err != nil {
+			return err
+		}
+	}
+	err := step.Run(ctx, m)
+	for _, hook := range p.Post {
+		err = hook(ctx, m, step.Name(), err)
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+package manager
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/Hekzory/MetamorphLLM/internal/artifacts"
+	"github.com/Hekzory/MetamorphLLM/internal/policy"
+	"github.com/Hekzory/MetamorphLLM/internal/preflight"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+	"github.com/Hekzory/MetamorphLLM/internal/sandbox"
+)
+
+// Preflight validates everything the pipeline needs before any expensive work:
+// the rewriter binary, provider credentials and model, the go toolchain and
+// write access to every directory the manager mutates
+func (m *Manager) Preflight(checker *preflight.Checker) []preflight.Check {
+	var checks []preflight.Check
+
+	binary := preflight.Check{Name: "rewriter binary", Status: preflight.StatusOK, Detail: m.RewriterBinary}
+	if _, err := exec.LookPath(m.RewriterBinary); err != nil {
+		binary.Status, binary.Detail = preflight.StatusFail, err.Error()
+	}
+	checks = append(checks, binary)
+
+	checks = append(checks, checker.CheckProvider(rewriter.APIType(m.RewriterAPI), "")...)
+	checks = append(checks, preflight.CheckGoToolchain("go.mod"))
+
+	tag := preflight.Check{Name: "build tag", Status: preflight.StatusOK, Detail: m.BuildTag}
+	if m.BuildTag == "" {
+		tag.Detail = "none"
+		if strings.HasSuffix(m.OutputPath, ".go") && filepath.Dir(m.OutputPath) == filepath.Dir(m.SuspiciousPath) {
+			tag.Status, tag.Detail = preflight.StatusFail, "the rewritten file would build together with the original; set a build tag or move -output out of the package"
+		}
+	} else if err := rewriter.ValidateBuildTag(m.BuildTag); err != nil {
+		tag.Status, tag.Detail = preflight.StatusFail, err.Error()
+	}
+	checks = append(checks, tag)
+
+	isolation := preflight.Check{Name: "sandbox", Status: preflight.StatusOK}
+	mode, err := sandbox.Resolve(m.Sandbox.Mode)
+	switch {
+	case err != nil:
+		isolation.Status, isolation.Detail = preflight.StatusFail, err.Error()
+	case mode == sandbox.ModeNone:
+		isolation.Status, isolation.Detail = preflight.StatusWarn, "disabled: rewritten code runs on the host"
+	default:
+		isolation.Detail = string(mode)
+		if m.Sandbox.Network {
+			isolation.Detail += " with network access"
+		}
+	}
+	checks = append(checks, isolation)
+
+	if m.SigningKeyPath != "" {
+		signing := preflight.Check{Name: "signing key", Status: preflight.StatusOK, Detail: m.SigningKeyPath}
+		if _, err := LoadSigningKey(m.SigningKeyPath); err != nil {
+			signing.Status, signing.Detail = preflight.StatusFail, err.Error()
+		}
+		checks = append(checks, signing)
+	}
+
+	if m.PolicyPath != "" {
+		rules := preflight.Check{Name: "policy", Status: preflight.StatusOK, Detail: m.PolicyPath}
+		if _, err := policy.Load(m.PolicyPath); err != nil {
+			rules.Status, rules.Detail = preflight.StatusFail, err.Error()
+		}
+		checks = append(checks, rules)
+	}
+
+	if m.ImageTag != "" {
+		builder := preflight.Check{Name: "image builder", Status: preflight.StatusOK, Detail: m.ImageBuilder}
+		if _, err := exec.LookPath(m.ImageBuilder); err != nil {
+			builder.Status, builder.Detail = preflight.StatusFail, err.Error()
+		} else if len(m.Targets()) > 1 {
+			builder.Status, builder.Detail = preflight.StatusFail, "an image holds one binary, but several targets are set"
+		} else if goos != "linux" {
+			builder.Status, builder.Detail = preflight.StatusFail, "images run Linux binaries, but binaries are built for "+goos
+		}
+		checks = append(checks, builder)
+	}
+
+	if m.Restart != RestartNone && m.Restart != "" {
+		restart := preflight.Check{Name: "restart", Status: preflight.StatusOK, Detail: string(m.Restart)}
+		switch m.Restart {
+		case RestartSignal:
+			if pid, err := readPIDFile(m.RestartPIDFile); err != nil {
+				restart.Status, restart.Detail = preflight.StatusWarn, err.Error()
+			} else if !processAlive(pid) {
+				restart.Status, restart.Detail = preflight.StatusWarn, fmt.Sprintf("process %d from %s is not running", pid, m.RestartPIDFile)
+			} else {
+				restart.Detail = fmt.Sprintf("SIG%s to process %d", strings.TrimPrefix(strings.ToUpper(m.ReloadSignal), "SIG"), pid)
+			}
+		case RestartSystemd:
+			if _, err := exec.LookPath(m.Systemctl); err != nil {
+				restart.Status, restart.Detail = preflight.StatusFail, err.Error()
+			} else if m.RestartUnit == "" {
+				restart.Status, restart.Detail = preflight.StatusFail, "no systemd unit set"
+			} else {
+				restart.Detail = "systemd unit " + m.RestartUnit
+			}
+		default:
+			restart.Status, restart.Detail = preflight.StatusFail, fmt.Sprintf("unknown restart mode %q", m.Restart)
+		}
+		checks = append(checks, restart)
+	}
+
+	if m.ArtifactURL != "" {
+		store := preflight.Check{Name: "artifact store", Status: preflight.StatusOK, Detail: m.ArtifactURL}
+		if _, err := artifacts.Open(m.ArtifactURL, m.ArtifactEndpoint); err != nil {
+			store.Status, store.Detail = preflight.StatusFail, err.Error()
+		}
+		checks = append(checks, store)
+	}
+
+	dirs := append([]string{filepath.Dir(m.SuspiciousPath), filepath.Dir(m.OutputPath)}, m.Targets()...)
+	if m.AuditLogPath != "" {
+		dirs = append(dirs, filepath.Dir(m.AuditLogPath))
+	}
+	if m.BuildCacheDir != "" {
+		dirs = append(dirs, m.BuildCacheDir)
+	}
+	if m.Confirm == ConfirmFile {
+		// Approvals are consumed by removing the file
+		dirs = append(dirs, filepath.Dir(m.ApprovalFile))
+	}
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		dir = filepath.Clean(dir)
+		if !seen[dir] {
+			seen[dir] = true
+			checks = append(checks, preflight.CheckWritable(dir))
+		}
+	}
+	return checks
+}
@@ -0,0 +1,224 @@
+package manager
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/scanner"
+)
+
+// Manifest records which pipeline run produced a deployed binary
+type Manifest struct {
+	RunID           string    `json:"run_id"`
+	Time            time.Time `json:"time"`
+	Binary          string    `json:"binary"`
+	BinarySHA256    string    `json:"binary_sha256"`
+	Source          string    `json:"source"`
+	SourceSHA256    string    `json:"source_sha256"`
+	Rewritten       string    `json:"rewritten"`
+	RewrittenSHA256 string    `json:"rewritten_sha256"`
+	RewriterAPI     string    `json:"rewriter_api"`
+	GoVersion       string    `json:"go_version"`
+
+	// MutationScore is the share of mutants of the source the tests killed,
+	// when mutation testing ran
+	MutationScore *float64 `json:"mutation_score,omitempty"`
+
+	// BinaryDissimilarity is how different the binary is from the one compiled
+	// from the source, 0 to 1, when the binaries were compared
+	BinaryDissimilarity *float64 `json:"binary_dissimilarity,omitempty"`
+
+	// Detections compares what each scanner detected in the binary and in the
+	// one compiled from the source, when scanners were configured
+	Detections []scanner.Delta `json:"detections,omitempty"`
+
+	// YaraStoppedMatching lists the YARA rules that match the source or its
+	// binary but not the rewrite or this binary, when rules were configured
+	YaraStoppedMatching []string `json:"yara_stopped_matching,omitempty"`
+
+	// StoppedAt is the stage a run ran out of time before, in the partial
+	// manifest of a binary that was compiled but not deployed
+	StoppedAt string `json:"stopped_at,omitempty"`
+
+	// Artifacts maps each uploaded artifact (binary, rewritten, rewrite_report,
+	// junit) to its object URL
+	Artifacts map[string]string `json:"artifacts,omitempty"`
+}
+
+// ManifestPath returns where the manifest of a deployed binary is written
+func ManifestPath(binary string) string {
+	return binary + ".manifest.json"
+}
+
+// SignaturePath returns where the signature of a manifest is written
+func SignaturePath(binary string) string {
+	return ManifestPath(binary) + ".sig"
+}
+
+// newRunID returns an identifier for a new pipeline run
+func newRunID() string {
+	return time.Now().UTC().Format("20060102T150405.000Z")
+}
+
+// buildManifest hashes the binary about to be deployed as binary and the
+// sources it was built from
+func (m *Manager) buildManifest(newBinary, binary string) (Manifest, error) {
+	binaryHash := fileHash(newBinary)
+	if binaryHash == "" {
+		return Manifest{}, fmt.Errorf("failed to hash binary %s", newBinary)
+	}
+	if m.RunID == "" {
+		m.RunID = newRunID()
+	}
+	urls, err := m.artifactURLs(binary)
+	if err != nil {
+		return Manifest{}, err
+	}
+	return Manifest{
+		RunID:               m.RunID,
+		Time:                time.Now().UTC(),
+		Binary:              binary,
+		BinarySHA256:        binaryHash,
+		Source:              m.SuspiciousPath,
+		SourceSHA256:        fileHash(m.SuspiciousPath),
+		Rewritten:           m.OutputPath,
+		RewrittenSHA256:     fileHash(m.OutputPath),
+		RewriterAPI:         m.RewriterAPI,
+		GoVersion:           runtime.Version(),
+		MutationScore:       m.mutationScore(),
+		BinaryDissimilarity: m.binaryDissimilarity(newBinary),
+		Detections:          m.scanDeltas[newBinary],
+		YaraStoppedMatching: m.yaraStoppedMatching(newBinary),
+		Artifacts:           urls,
+	}, nil
+}
+
+// encodeManifest returns the manifest file content and, if a signing key is
+// configured, its detached base64 Ed25519 signature
+func (m *Manager) encodeManifest(manifest Manifest) ([]byte, []byte, error) {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	data = append(data, '\n')
+	if m.SigningKeyPath == "" {
+		return data, nil, nil
+	}
+
+	key, err := LoadSigningKey(m.SigningKeyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, data))
+	return data, []byte(signature + "\n"), nil
+}
+
+// writeManifest writes the manifest (and signature) of a deployed binary
+func (m *Manager) writeManifest(binary string, data, signature []byte) error {
+	files := map[string][]byte{ManifestPath(binary): data}
+	if signature != nil {
+		files[SignaturePath(binary)] = signature
+	} else if _, err := os.Stat(SignaturePath(binary)); err == nil {
+		// A stale signature would not match the new manifest
+		if err := m.remove(SignaturePath(binary)); err != nil {
+			return fmt.Errorf("failed to remove stale signature: %w", err)
+		}
+	}
+	for path, content := range files {
+		before := m.hashIfAudited(path)
+		err := os.WriteFile(path, content, 0644)
+		m.recordCreate(path, before, err)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// LoadSigningKey reads a PEM-encoded PKCS#8 Ed25519 private key, as written by
+// 'openssl genpkey -algorithm ed25519'
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key %s: %w", path, err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is a %T, not an Ed25519 key", path, key)
+	}
+	return edKey, nil
+}
+
+// LoadVerifyKey reads a PEM-encoded PKIX Ed25519 public key
+func LoadVerifyKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %w", path, err)
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %s is a %T, not an Ed25519 key", path, key)
+	}
+	return edKey, nil
+}
+
+// readPEM returns the DER bytes of the first PEM block of the given type in path
+func readPEM(path, blockType string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s does not contain a PEM %q block", path, blockType)
+	}
+	return block.Bytes, nil
+}
+
+// VerifyBinary checks that binary matches its manifest and, if publicKey is
+// not nil, that the manifest carries a valid signature from that key
+func VerifyBinary(binary string, publicKey ed25519.PublicKey) (Manifest, error) {
+	var manifest Manifest
+	data, err := os.ReadFile(ManifestPath(binary))
+	if err != nil {
+		return manifest, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("failed to parse manifest %s: %w", ManifestPath(binary), err)
+	}
+
+	if publicKey != nil {
+		encoded, err := os.ReadFile(SignaturePath(binary))
+		if err != nil {
+			return manifest, fmt.Errorf("failed to read signature: %w", err)
+		}
+		signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+		if err != nil {
+			return manifest, fmt.Errorf("failed to decode signature %s: %w", SignaturePath(binary), err)
+		}
+		if !ed25519.Verify(publicKey, data, signature) {
+			return manifest, fmt.Errorf("manifest signature of %s is invalid", binary)
+		}
+	}
+
+	if actual := fileHash(binary); actual != manifest.BinarySHA256 {
+		return manifest, fmt.Errorf("%s has SHA-256 %s, manifest of run %s records %s", binary, actual, manifest.RunID, manifest.BinarySHA256)
+	}
+	return manifest, nil
+}
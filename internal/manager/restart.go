@@ -0,0 +1,168 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RestartMode decides how a running instance picks up a deployed binary
+type RestartMode string
+
+const (
+	// RestartNone only replaces the binary on disk (the default)
+	RestartNone RestartMode = "none"
+	// RestartSignal sends ReloadSignal to the process in RestartPIDFile,
+	// which restarts itself or is restarted by its supervisor
+	RestartSignal RestartMode = "signal"
+	// RestartSystemd restarts RestartUnit with systemctl
+	RestartSystemd RestartMode = "systemd"
+)
+
+// DefaultReloadSignal asks a process to re-execute its binary gracefully
+const DefaultReloadSignal = "HUP"
+
+// RestartRunning makes a running instance execute the deployed binary
+// according to m.Restart and waits until it does
+func (m *Manager) RestartRunning() error {
+	switch m.Restart {
+	case RestartNone, "":
+		return nil
+	case RestartSignal:
+		return m.restartSignal()
+	case RestartSystemd:
+		return m.restartSystemd()
+	default:
+		return fmt.Errorf("unknown restart mode %q (none, signal or systemd)", m.Restart)
+	}
+}
+
+// restartSignal signals the process in the PID file and waits for the PID
+// file to name a process running the deployed binary
+func (m *Manager) restartSignal() error {
+	if m.RestartPIDFile == "" {
+		return fmt.Errorf("restart mode signal requires a PID file")
+	}
+	pid, err := readPIDFile(m.RestartPIDFile)
+	if err != nil {
+		return err
+	}
+	if !processAlive(pid) {
+		return fmt.Errorf("process %d from %s is not running", pid, m.RestartPIDFile)
+	}
+
+	name := m.ReloadSignal
+	if name == "" {
+		name = DefaultReloadSignal
+	}
+	logger.Info("Sending signal", "signal", "SIG"+strings.TrimPrefix(strings.ToUpper(name), "SIG"), "pid", pid)
+	if err := signalProcess(pid, name); err != nil {
+		return fmt.Errorf("failed to signal process %d: %w", pid, err)
+	}
+	return m.waitRestarted(pid, func() (int, error) { return readPIDFile(m.RestartPIDFile) })
+}
+
+// restartSystemd restarts the unit and waits for its main process to run the
+// deployed binary
+func (m *Manager) restartSystemd() error {
+	if m.RestartUnit == "" {
+		return fmt.Errorf("restart mode systemd requires a unit")
+	}
+	oldPID, _ := m.unitMainPID()
+
+	logger.Info("Restarting systemd unit", "unit", m.RestartUnit)
+	cmd := exec.Command(m.Systemctl, "restart", m.RestartUnit)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("systemctl restart %s failed: %v\nStderr: %s", m.RestartUnit, err, stderr.String())
+	}
+	return m.waitRestarted(oldPID, m.unitMainPID)
+}
+
+// unitMainPID returns the main process of the unit, or an error while it has none
+func (m *Manager) unitMainPID() (int, error) {
+	out, err := exec.Command(m.Systemctl, "show", "--property", "MainPID", "--value", m.RestartUnit).Output()
+	if err != nil {
+		return 0, fmt.Errorf("systemctl show %s failed: %w", m.RestartUnit, err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("unit %s has no main process", m.RestartUnit)
+	}
+	return pid, nil
+}
+
+// waitRestarted polls currentPID until it names a live process running a
+// deployed binary, or RestartTimeout passes. Where the binary of a process
+// cannot be read, a new PID is taken as the restarted instance.
+func (m *Manager) waitRestarted(oldPID int, currentPID func() (int, error)) error {
+	deployed := make(map[string]bool)
+	for _, dir := range m.Targets() {
+		deployed[resolvedPath(BinaryPath(dir))] = true
+	}
+
+	deadline := time.Now().Add(m.RestartTimeout)
+	lastErr := fmt.Errorf("process %d still runs the previous binary", oldPID)
+	for {
+		pid, err := currentPID()
+		switch {
+		case err != nil:
+			lastErr = err
+		case !processAlive(pid):
+			lastErr = fmt.Errorf("process %d is not running", pid)
+		default:
+			binary, ok := processBinary(pid)
+			if ok && deployed[resolvedPath(binary)] || !ok && pid != oldPID {
+				logger.Info("Process runs the deployed binary", "pid", pid)
+				return nil
+			}
+			if ok {
+				lastErr = fmt.Errorf("process %d runs %s, not the deployed binary", pid, binary)
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("restarted instance did not come up within %v (the previous binary is kept as .backup): %w", m.RestartTimeout, lastErr)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// readPIDFile returns the process ID stored in a PID file
+func readPIDFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read PID file: %w", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("PID file %s does not hold a process ID", path)
+	}
+	return pid, nil
+}
+
+// processBinary returns the executable a process runs, where /proc exposes it
+func processBinary(pid int) (string, bool) {
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSuffix(exe, " (deleted)"), true
+}
+
+// resolvedPath returns the absolute path of a file with symlinks resolved,
+// as /proc reports it
+func resolvedPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return path
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// restartSignals are the signals a running instance can be restarted with
+var restartSignals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// signalProcess sends the named signal (e.g. HUP or SIGHUP) to a process
+func signalProcess(pid int, name string) error {
+	sig, ok := restartSignals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return fmt.Errorf("unsupported signal %q (HUP, INT, QUIT, TERM, USR1 or USR2)", name)
+	}
+	return syscall.Kill(pid, sig)
+}
+
+// processAlive reports whether a process exists, including one owned by
+// another user
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
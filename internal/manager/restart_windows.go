@@ -0,0 +1,21 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+)
+
+// signalProcess fails: Windows processes cannot be asked to restart with a signal
+func signalProcess(pid int, name string) error {
+	return fmt.Errorf("signals are not supported on Windows; restart the service another way")
+}
+
+// processAlive reports whether a process exists
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
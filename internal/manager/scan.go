@@ -0,0 +1,47 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/Hekzory/MetamorphLLM/internal/scanner"
+)
+
+// ScanBinaries scans every target compiled from the original source and from
+// the rewrite with each of the Scanners, and logs which detections the
+// rewrite lost or gained. Detections are only reported; they never fail the
+// run. The deltas are recorded in the manifests.
+func (m *Manager) ScanBinaries(ctx context.Context) error {
+	m.scanDeltas = nil
+	if len(m.Scanners) == 0 {
+		logger.Info("No scanners configured, skipping scan")
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "metamorph-scan-*")
+	if err != nil {
+		return fmt.Errorf("failed to create directory for original binaries: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	deltas := make(map[string][]scanner.Delta)
+	for i, target := range m.Targets() {
+		original, err := m.compileOriginal(ctx, dir, i, target)
+		if err != nil {
+			return err
+		}
+		rewritten := newBinaryPath(target)
+		for _, s := range m.Scanners {
+			delta, err := scanner.ScanBoth(ctx, s, original, rewritten)
+			if err != nil {
+				return err
+			}
+			deltas[rewritten] = append(deltas[rewritten], delta)
+			logger.Info("Scan", "binary", rewritten, "scanner", delta.Scanner, "original", delta.Original,
+				"rewritten", delta.Rewritten, "lost", delta.Lost, "gained", delta.Gained)
+		}
+	}
+	m.scanDeltas = deltas
+	return nil
+}
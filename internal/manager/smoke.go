@@ -0,0 +1,64 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/sandbox"
+)
+
+// SmokeRun executes the compiled rewritten binary of every target in the
+// sandbox and requires each to exit successfully within SmokeTimeout
+func (m *Manager) SmokeRun(ctx context.Context) error {
+	if !m.SmokeTest {
+		logger.Info("Smoke run disabled, skipping")
+		return nil
+	}
+
+	sb, err := sandbox.New(m.Sandbox)
+	if err != nil {
+		return err
+	}
+	defer sb.Close()
+	for _, dir := range m.Targets() {
+		if err := m.smokeRunBinary(ctx, sb, newBinaryPath(dir)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// smokeRunBinary runs one binary in the sandbox
+func (m *Manager) smokeRunBinary(parent context.Context, sb *sandbox.Sandbox, binary string) error {
+	logger.Info("Running binary in sandbox", "binary", binary, "sandbox", sb.Mode)
+
+	ctx, cancel := context.WithTimeout(parent, m.SmokeTimeout)
+	defer cancel()
+
+	abs, err := filepath.Abs(binary)
+	if err != nil {
+		return fmt.Errorf("failed to resolve binary path: %w", err)
+	}
+	cmd := sb.Command(ctx, abs)
+	cmd.Dir = sb.Scratch
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	start := time.Now()
+	err = cmd.Run()
+	if parent.Err() != nil {
+		return fmt.Errorf("smoke run of %s stopped: %w", binary, context.Cause(parent))
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("smoke run of %s timed out after %v\nOutput:\n%s", binary, m.SmokeTimeout, output.String())
+	}
+	if err != nil {
+		return fmt.Errorf("smoke run of %s failed: %v\nOutput:\n%s", binary, err, output.String())
+	}
+	logger.Info("Smoke run passed", "duration", time.Since(start).Round(time.Millisecond))
+	return nil
+}
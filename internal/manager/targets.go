@@ -0,0 +1,95 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// Targets returns the directories of the binaries built from the rewritten
+// code: TargetDirs, or TargetBinaryDir if none are set
+func (m *Manager) Targets() []string {
+	if len(m.TargetDirs) > 0 {
+		return m.TargetDirs
+	}
+	return []string{m.TargetBinaryDir}
+}
+
+// goos is the platform binaries are built for and deployed on; tests override it
+var goos = runtime.GOOS
+
+// exeSuffix returns the file name suffix of executables on goos
+func exeSuffix() string {
+	if goos == "windows" {
+		return ".exe"
+	}
+	return ""
+}
+
+// BinaryPath returns the deployed binary of a target, e.g. cmd/suspicious/suspicious
+// (cmd\suspicious\suspicious.exe on Windows)
+func BinaryPath(dir string) string {
+	return filepath.Join(dir, filepath.Base(dir)+exeSuffix())
+}
+
+// newBinaryPath returns where the rewritten binary of a target is compiled
+// before it is deployed. It keeps the .exe suffix, so Windows can run it.
+func newBinaryPath(dir string) string {
+	return filepath.Join(dir, filepath.Base(dir)+".new"+exeSuffix())
+}
+
+// goPackage returns the go command package pattern of a relative directory
+func goPackage(dir string) string {
+	return "./" + filepath.ToSlash(dir)
+}
+
+// DiscoverTargets returns every main package directly under cmd/ that imports
+// the package of SuspiciousPath, directly or through other packages
+func (m *Manager) DiscoverTargets(ctx context.Context) ([]string, error) {
+	list := func(format, pattern string) (string, error) {
+		cmd := m.goCommand(ctx, "list", "-f", format, pattern)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("go list %s failed: %v\nStderr: %s", pattern, err, stderr.String())
+		}
+		return stdout.String(), nil
+	}
+
+	rewritten, err := list("{{.ImportPath}}", goPackage(filepath.Dir(m.SuspiciousPath)))
+	if err != nil {
+		return nil, err
+	}
+	rewritten = strings.TrimSpace(rewritten)
+	packages, err := list("{{.Name}}\t{{.Dir}}\t{{join .Deps \" \"}}", "./cmd/...")
+	if err != nil {
+		return nil, err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	var targets []string
+	for _, line := range strings.Split(strings.TrimSpace(packages), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) < 3 || fields[0] != "main" || !slices.Contains(strings.Fields(fields[2]), rewritten) {
+			continue
+		}
+		dir, err := filepath.Rel(wd, fields[1])
+		if err != nil || filepath.Dir(dir) != "cmd" {
+			continue // Only binaries directly under cmd/
+		}
+		targets = append(targets, dir)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no main package under cmd/ imports %s", rewritten)
+	}
+	return targets, nil
+}
@@ -0,0 +1,119 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+
+	"github.com/Hekzory/MetamorphLLM/internal/artifacts"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+// artifactFile is a run artifact: its name in the manifest and its local path
+type artifactFile struct {
+	name string
+	path string
+}
+
+// artifactFiles returns the artifacts of the current run: the deployed binary,
+// the sources that exist locally and the JUnit report. The report is only
+// complete once the run ends, so it is uploaded by uploadJUnit.
+func (m *Manager) artifactFiles(binary string) []artifactFile {
+	files := []artifactFile{{"binary", binary}}
+	for _, f := range []artifactFile{{"rewritten", m.OutputPath}, {"rewrite_report", rewriter.ReportPath(m.OutputPath)}, {"origin_map", rewriter.OriginMapPath(m.OutputPath)}} {
+		if _, err := os.Stat(f.path); err == nil {
+			files = append(files, f)
+		}
+	}
+	if m.JUnitPath != "" {
+		files = append(files, artifactFile{"junit", m.JUnitPath})
+	}
+	return files
+}
+
+// artifactKey returns the object key of a run artifact: <prefix>/<run ID>/<file name>
+func artifactKey(store *artifacts.Store, runID, file string) string {
+	return store.Key(path.Join(runID, filepath.Base(file)))
+}
+
+// artifactURLs returns the URL every artifact of the run will be uploaded to,
+// or nil if uploads are disabled
+func (m *Manager) artifactURLs(binary string) (map[string]string, error) {
+	if m.ArtifactURL == "" {
+		return nil, nil
+	}
+	store, err := artifacts.Open(m.ArtifactURL, m.ArtifactEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	urls := make(map[string]string)
+	for _, f := range m.artifactFiles(binary) {
+		urls[f.name] = store.URL(artifactKey(store, m.RunID, f.path))
+	}
+	return urls, nil
+}
+
+// UploadArtifacts uploads the deployed binaries, their manifests and signatures, the
+// rewritten source and the rewrite report to ArtifactURL under the run ID
+func (m *Manager) UploadArtifacts(ctx context.Context) error {
+	if m.ArtifactURL == "" {
+		logger.Info("No artifact URL set, skipping upload")
+		return nil
+	}
+	store, err := artifacts.Open(m.ArtifactURL, m.ArtifactEndpoint)
+	if err != nil {
+		return err
+	}
+
+	// Every target's binary, manifest and signature; the sources are shared
+	var runID string
+	var files []string
+	for _, dir := range m.Targets() {
+		binary := BinaryPath(dir)
+		manifest, err := VerifyBinary(binary, nil)
+		if err != nil {
+			return fmt.Errorf("refusing to upload %s: %w", binary, err)
+		}
+		runID = manifest.RunID
+
+		files = append(files, ManifestPath(binary))
+		if _, err := os.Stat(SignaturePath(binary)); err == nil {
+			files = append(files, SignaturePath(binary))
+		}
+		for _, f := range m.artifactFiles(binary) {
+			if f.name != "junit" && !slices.Contains(files, f.path) {
+				files = append(files, f.path)
+			}
+		}
+	}
+
+	logger.Info("Uploading artifacts", "artifacts", len(files), "run", runID, "url", m.ArtifactURL)
+	for _, file := range files {
+		url, err := store.Upload(ctx, artifactKey(store, runID, file), file)
+		if err != nil {
+			return err
+		}
+		logger.Info("Uploaded artifact", "url", url)
+	}
+	return nil
+}
+
+// uploadJUnit uploads the JUnit report written at the end of a run
+func (m *Manager) uploadJUnit(ctx context.Context) error {
+	if m.ArtifactURL == "" || m.JUnitPath == "" {
+		return nil
+	}
+	store, err := artifacts.Open(m.ArtifactURL, m.ArtifactEndpoint)
+	if err != nil {
+		return err
+	}
+	url, err := store.Upload(ctx, artifactKey(store, m.RunID, m.JUnitPath), m.JUnitPath)
+	if err != nil {
+		return err
+	}
+	logger.Info("Uploaded artifact", "url", url)
+	return nil
+}
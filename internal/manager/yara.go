@@ -0,0 +1,43 @@
+package manager
+
+import (
+	"context"
+	"slices"
+
+	"github.com/Hekzory/MetamorphLLM/internal/scanner"
+)
+
+// MatchYaraRules matches the YaraRules against an artifact of the original
+// and of the rewrite, a source file or a binary, and logs which rules stopped
+// or started matching. The rules that stopped matching are recorded for the
+// manifests.
+func (m *Manager) MatchYaraRules(ctx context.Context, original, rewritten string) error {
+	if len(m.YaraRules) == 0 {
+		return nil
+	}
+	var before, after []string
+	for _, rules := range m.YaraRules {
+		d, err := scanner.ScanBoth(ctx, &scanner.Yara{Rules: rules}, original, rewritten)
+		if err != nil {
+			return err
+		}
+		before = append(before, d.Original...)
+		after = append(after, d.Rewritten...)
+	}
+	d := scanner.Compare("yara", before, after)
+	logger.Info("YARA rule matches", "artifact", rewritten, "original", d.Original, "rewritten", d.Rewritten,
+		"stopped_matching", d.Lost, "started_matching", d.Gained)
+	if m.yaraStopped == nil {
+		m.yaraStopped = make(map[string][]string)
+	}
+	m.yaraStopped[rewritten] = d.Lost
+	return nil
+}
+
+// yaraStoppedMatching returns the rules that match the original source or
+// binary but not the rewrite or newBinary
+func (m *Manager) yaraStoppedMatching(newBinary string) []string {
+	rules := slices.Concat(m.yaraStopped[m.OutputPath], m.yaraStopped[newBinary])
+	slices.Sort(rules)
+	return slices.Compact(rules)
+}
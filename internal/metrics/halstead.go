@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"go/scanner"
+	"go/token"
+	"math"
+)
+
+// Halstead holds the token counts behind the Halstead measures. Operators are
+// Go's operators, delimiters and keywords; operands are identifiers and
+// literals. Paired delimiters count once, at the opening one, and semicolons
+// inserted at line ends do not count.
+type Halstead struct {
+	DistinctOperators int // n1
+	DistinctOperands  int // n2
+	Operators         int // N1
+	Operands          int // N2
+}
+
+// Vocabulary is the number of distinct operators and operands
+func (h Halstead) Vocabulary() int {
+	return h.DistinctOperators + h.DistinctOperands
+}
+
+// Length is the total number of operators and operands
+func (h Halstead) Length() int {
+	return h.Operators + h.Operands
+}
+
+// Volume is the length times the bits needed to pick one token of the vocabulary
+func (h Halstead) Volume() float64 {
+	if h.Vocabulary() == 0 {
+		return 0
+	}
+	return float64(h.Length()) * math.Log2(float64(h.Vocabulary()))
+}
+
+// Difficulty grows with the distinct operators and with how often operands are reused
+func (h Halstead) Difficulty() float64 {
+	if h.DistinctOperands == 0 {
+		return 0
+	}
+	return float64(h.DistinctOperators) / 2 * float64(h.Operands) / float64(h.DistinctOperands)
+}
+
+// Effort is the difficulty times the volume
+func (h Halstead) Effort() float64 {
+	return h.Difficulty() * h.Volume()
+}
+
+// calculateHalstead counts the operators and operands of Go source
+func calculateHalstead(content string) Halstead {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(content))
+	var s scanner.Scanner
+	// Errors were already reported by the parser
+	s.Init(file, []byte(content), nil, 0)
+
+	var h Halstead
+	operators := make(map[string]bool)
+	operands := make(map[string]bool)
+	for {
+		_, tok, lit := s.Scan()
+		switch {
+		case tok == token.EOF:
+			h.DistinctOperators, h.DistinctOperands = len(operators), len(operands)
+			return h
+		case tok == token.SEMICOLON && lit == "\n",
+			tok == token.RPAREN, tok == token.RBRACK, tok == token.RBRACE:
+			continue
+		case tok.IsLiteral():
+			h.Operands++
+			operands[lit] = true
+		default:
+			h.Operators++
+			operators[tok.String()] = true
+		}
+	}
+}
+
+// maintainabilityIndex combines Halstead volume, cyclomatic complexity and
+// lines of code into a score from 0 (hard to maintain) to 100, using the
+// normalized formula of Visual Studio
+func maintainabilityIndex(volume float64, cc, loc int) float64 {
+	mi := 171 - 0.23*float64(cc)
+	if volume > 0 {
+		mi -= 5.2 * math.Log(volume)
+	}
+	if loc > 0 {
+		mi -= 16.2 * math.Log(float64(loc))
+	}
+	return math.Max(0, math.Min(100, mi*100/171))
+}
@@ -2,11 +2,15 @@
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"go/ast"
 	"go/parser"
+	"go/printer"
 	"go/token"
+	"math"
 	"os"
+	"slices"
 	"strings"
 )
 
@@ -17,6 +21,21 @@ type Metrics struct {
 	CogC          int // Cognitive complexity
 	FuncCount     int // Total number of functions
 	TestPassCount int // Number of functions that passed tests
+	Halstead      Halstead
+	// MaintainabilityIndex scores the file from 0 to 100, higher being easier
+	// to maintain
+	MaintainabilityIndex float64
+	// Functions holds the metrics of every function, keyed by FunctionName
+	Functions map[string]FunctionMetrics
+}
+
+// FunctionMetrics represents code metrics for a single function
+type FunctionMetrics struct {
+	LOC     int // Lines of code, counted as printed from the AST without comments
+	CC      int // Cyclomatic complexity
+	CogC    int // Cognitive complexity
+	Nesting int // Deepest nesting of control flow statements
+	Params  int // Number of parameters, not counting the receiver
 }
 
 // CalculateMetrics calculates all metrics for a given file
@@ -27,9 +46,14 @@ func CalculateMetrics(filePath string) (*Metrics, error) {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
+	return CalculateMetricsFromContent(filePath, string(content))
+}
+
+// CalculateMetricsFromContent calculates all metrics for Go source held in memory
+func CalculateMetricsFromContent(filename, content string) (*Metrics, error) {
 	// Parse the Go code
 	fset := token.NewFileSet()
-	f, err := parser.ParseFile(fset, filePath, content, parser.ParseComments)
+	f, err := parser.ParseFile(fset, filename, content, parser.ParseComments)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse file: %w", err)
 	}
@@ -37,7 +61,7 @@ func CalculateMetrics(filePath string) (*Metrics, error) {
 	metrics := &Metrics{}
 
 	// Calculate LOC
-	metrics.LOC = calculateLOC(string(content))
+	metrics.LOC = calculateLOC(content)
 
 	// Calculate cyclomatic complexity
 	metrics.CC = calculateCyclomaticComplexity(f)
@@ -48,9 +72,106 @@ func CalculateMetrics(filePath string) (*Metrics, error) {
 	// Count functions
 	metrics.FuncCount = countFunctions(f)
 
+	// Calculate Halstead measures and the maintainability index
+	metrics.Halstead = calculateHalstead(content)
+	metrics.MaintainabilityIndex = maintainabilityIndex(metrics.Halstead.Volume(), metrics.CC, metrics.LOC)
+
+	// Calculate metrics per function
+	metrics.Functions = make(map[string]FunctionMetrics)
+	for _, decl := range f.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		// Several init functions may share a name
+		name := FunctionName(fd)
+		for i := 2; ; i++ {
+			if _, taken := metrics.Functions[name]; !taken {
+				break
+			}
+			name = fmt.Sprintf("%s#%d", FunctionName(fd), i)
+		}
+		metrics.Functions[name] = CalculateFunctionMetrics(fd)
+	}
+
 	return metrics, nil
 }
 
+// CalculateFunctionMetrics calculates the metrics of a single function. LOC
+// is counted on the function as printed from its AST, so it does not depend
+// on comments or on how the source was laid out.
+func CalculateFunctionMetrics(f *ast.FuncDecl) FunctionMetrics {
+	m := FunctionMetrics{
+		CC:      calculateCyclomaticComplexity(f),
+		CogC:    calculateCognitiveComplexity(f),
+		Nesting: nestingDepth(f),
+	}
+	decl := *f
+	decl.Doc = nil
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, token.NewFileSet(), &decl); err == nil {
+		m.LOC = calculateLOC(buf.String())
+	}
+	for _, field := range f.Type.Params.List {
+		m.Params += max(len(field.Names), 1)
+	}
+	return m
+}
+
+// FunctionName returns the name a function is reported under: its own name,
+// or Type.Method for a method
+func FunctionName(f *ast.FuncDecl) string {
+	if f.Recv == nil || len(f.Recv.List) == 0 {
+		return f.Name.Name
+	}
+	typ := f.Recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	switch generic := typ.(type) {
+	case *ast.IndexExpr:
+		typ = generic.X
+	case *ast.IndexListExpr:
+		typ = generic.X
+	}
+	if id, ok := typ.(*ast.Ident); ok {
+		return id.Name + "." + f.Name.Name
+	}
+	return f.Name.Name
+}
+
+// nestingDepth returns how deeply control flow statements nest below n. An
+// else if continues its chain rather than nesting.
+func nestingDepth(n ast.Node) int {
+	deepest := 0
+	chained := make(map[ast.Node]bool)
+	var walk func(n ast.Node, level int)
+	walk = func(n ast.Node, level int) {
+		ast.Inspect(n, func(c ast.Node) bool {
+			if c == n {
+				return true
+			}
+			switch node := c.(type) {
+			case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt,
+				*ast.TypeSwitchStmt, *ast.SelectStmt:
+				if ifStmt, ok := node.(*ast.IfStmt); ok && ifStmt.Else != nil {
+					chained[ifStmt.Else] = true
+				}
+				next := level + 1
+				if chained[node] {
+					next = level
+				}
+				deepest = max(deepest, next)
+				walk(node, next)
+				return false
+			}
+			return true
+		})
+	}
+	walk(n, 0)
+	return deepest
+}
+
 // calculateLOC calculates the number of lines of code
 func calculateLOC(content string) int {
 	scanner := bufio.NewScanner(strings.NewReader(content))
@@ -64,8 +185,9 @@ func calculateLOC(content string) int {
 	return loc
 }
 
-// calculateCyclomaticComplexity calculates the cyclomatic complexity
-func calculateCyclomaticComplexity(f *ast.File) int {
+// calculateCyclomaticComplexity calculates the cyclomatic complexity of a
+// file or function
+func calculateCyclomaticComplexity(f ast.Node) int {
 	v := &cyclomaticVisitor{complexity: 1}
 
 	ast.Inspect(f, func(n ast.Node) bool {
@@ -110,8 +232,9 @@ type cyclomaticVisitor struct {
 	complexity int
 }
 
-// calculateCognitiveComplexity calculates the cognitive complexity
-func calculateCognitiveComplexity(f *ast.File) int {
+// calculateCognitiveComplexity calculates the cognitive complexity of a file
+// or function
+func calculateCognitiveComplexity(f ast.Node) int {
 	complexity := 0
 	nestingLevels := make(map[ast.Node]int)
 
@@ -242,10 +365,99 @@ func CalculateFunctionalEquivalence(passedTests, totalTests int) float64 {
 	return float64(passedTests) / float64(totalTests) * 100
 }
 
+// Delta is the change of one metric from the original to the metamorphic code
+type Delta struct {
+	Original    float64
+	Metamorphic float64
+	Absolute    float64 // Metamorphic minus Original
+	// Percent is the change relative to Original. It is always finite: when
+	// there is no relative change to report, e.g. growth from 0, it is 0 and
+	// Undefined is set.
+	Percent   float64
+	Undefined bool
+}
+
+// NewDelta calculates the delta from original to metamorphic
+func NewDelta(original, metamorphic float64) Delta {
+	d := Delta{Original: original, Metamorphic: metamorphic, Absolute: metamorphic - original}
+	if d.Absolute == 0 {
+		return d
+	}
+	percent := d.Absolute / math.Abs(original) * 100
+	if math.IsNaN(percent) || math.IsInf(percent, 0) {
+		d.Undefined = true
+		return d
+	}
+	d.Percent = percent
+	return d
+}
+
+// String formats the percentage, e.g. "+20.00%", or "n/a" if it is undefined
+func (d Delta) String() string {
+	if d.Undefined {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.2f%%", d.Percent)
+}
+
+// FunctionDelta holds the deltas of the metrics of one function
+type FunctionDelta struct {
+	LOC     Delta
+	CC      Delta
+	CogC    Delta
+	Nesting Delta
+	Params  Delta
+}
+
+// MoreComplex reports whether the complexity or nesting of the function grew
+func (d FunctionDelta) MoreComplex() bool {
+	return d.CC.Absolute > 0 || d.CogC.Absolute > 0 || d.Nesting.Absolute > 0
+}
+
+// DeltaReport compares the metrics of original and metamorphic code
+type DeltaReport struct {
+	LOC                  Delta
+	CC                   Delta
+	CogC                 Delta
+	HalsteadVolume       Delta
+	MaintainabilityIndex Delta
+	// Functions holds the deltas of functions present in both versions;
+	// Added and Removed list the other functions, sorted
+	Functions map[string]FunctionDelta
+	Added     []string
+	Removed   []string
+}
+
 // CalculateDeltaMetrics calculates the delta metrics between original and metamorphic code
-func CalculateDeltaMetrics(original, metamorphic *Metrics) (float64, float64, float64) {
-	locDelta := float64(metamorphic.LOC-original.LOC) / float64(original.LOC) * 100
-	ccDelta := float64(metamorphic.CC-original.CC) / float64(original.CC) * 100
-	cogCDelta := float64(metamorphic.CogC-original.CogC) / float64(original.CogC) * 100
-	return locDelta, ccDelta, cogCDelta
+func CalculateDeltaMetrics(original, metamorphic *Metrics) DeltaReport {
+	report := DeltaReport{
+		LOC:                  NewDelta(float64(original.LOC), float64(metamorphic.LOC)),
+		CC:                   NewDelta(float64(original.CC), float64(metamorphic.CC)),
+		CogC:                 NewDelta(float64(original.CogC), float64(metamorphic.CogC)),
+		HalsteadVolume:       NewDelta(original.Halstead.Volume(), metamorphic.Halstead.Volume()),
+		MaintainabilityIndex: NewDelta(original.MaintainabilityIndex, metamorphic.MaintainabilityIndex),
+		Functions:            make(map[string]FunctionDelta),
+	}
+	for name, before := range original.Functions {
+		after, ok := metamorphic.Functions[name]
+		if !ok {
+			report.Removed = append(report.Removed, name)
+			continue
+		}
+		report.Functions[name] = FunctionDelta{
+			LOC:     NewDelta(float64(before.LOC), float64(after.LOC)),
+			CC:      NewDelta(float64(before.CC), float64(after.CC)),
+			CogC:    NewDelta(float64(before.CogC), float64(after.CogC)),
+			Nesting: NewDelta(float64(before.Nesting), float64(after.Nesting)),
+			Params:  NewDelta(float64(before.Params), float64(after.Params)),
+		}
+	}
+	for name := range metamorphic.Functions {
+		if _, ok := original.Functions[name]; !ok {
+			report.Added = append(report.Added, name)
+		}
+	}
+	slices.Sort(report.Added)
+	slices.Sort(report.Removed)
+	return report
 }
@@ -1,7 +1,9 @@
 package metrics
 
 import (
+	"math"
 	"os"
+	"slices"
 	"testing"
 )
 
@@ -100,21 +102,191 @@ func TestCalculateDeltaMetrics(t *testing.T) {
 		CogC: 18,
 	}
 
-	locDelta, ccDelta, cogCDelta := CalculateDeltaMetrics(original, metamorphic)
+	delta := CalculateDeltaMetrics(original, metamorphic)
 
 	expectedLocDelta := 20.0  // (120-100)/100 * 100
 	expectedCCDelta := 20.0   // (12-10)/10 * 100
 	expectedCogCDelta := 20.0 // (18-15)/15 * 100
 
-	if locDelta != expectedLocDelta {
-		t.Errorf("LOC delta = %.2f%%, want %.2f%%", locDelta, expectedLocDelta)
+	if delta.LOC.Percent != expectedLocDelta || delta.LOC.Absolute != 20 {
+		t.Errorf("LOC delta = %s (%+.0f), want %.2f%%", delta.LOC, delta.LOC.Absolute, expectedLocDelta)
 	}
 
-	if ccDelta != expectedCCDelta {
-		t.Errorf("CC delta = %.2f%%, want %.2f%%", ccDelta, expectedCCDelta)
+	if delta.CC.Percent != expectedCCDelta || delta.CC.Absolute != 2 {
+		t.Errorf("CC delta = %s (%+.0f), want %.2f%%", delta.CC, delta.CC.Absolute, expectedCCDelta)
 	}
 
-	if cogCDelta != expectedCogCDelta {
-		t.Errorf("CogC delta = %.2f%%, want %.2f%%", cogCDelta, expectedCogCDelta)
+	if math.Abs(delta.CogC.Percent-expectedCogCDelta) > 1e-9 || delta.CogC.Absolute != 3 {
+		t.Errorf("CogC delta = %s (%+.0f), want %.2f%%", delta.CogC, delta.CogC.Absolute, expectedCogCDelta)
+	}
+
+	if got := delta.LOC.String(); got != "+20.00%" {
+		t.Errorf("Expected +20.00%%, got %s", got)
+	}
+}
+
+func TestDeltaFromZero(t *testing.T) {
+	if d := NewDelta(0, 5); !d.Undefined || d.Percent != 0 || d.Absolute != 5 || d.String() != "n/a" {
+		t.Errorf("Expected growth from 0 to be undefined, got %+v", d)
+	}
+	if d := NewDelta(0, 0); d.Undefined || d.Percent != 0 {
+		t.Errorf("Expected no change from 0 to 0, got %+v", d)
+	}
+	if d := NewDelta(math.NaN(), 1); !d.Undefined || d.Percent != 0 {
+		t.Errorf("Expected NaN to be undefined, got %+v", d)
+	}
+	if d := NewDelta(4, 2); d.Percent != -50 || d.String() != "-50.00%" {
+		t.Errorf("Expected -50%%, got %+v", d)
+	}
+
+	// Neither a zero original nor a zero result may panic or produce Inf
+	delta := CalculateDeltaMetrics(&Metrics{}, &Metrics{LOC: 3, CC: 1})
+	for _, d := range []Delta{delta.LOC, delta.CC, delta.CogC, delta.HalsteadVolume, delta.MaintainabilityIndex} {
+		if math.IsInf(d.Percent, 0) || math.IsNaN(d.Percent) {
+			t.Errorf("Expected a finite percentage, got %+v", d)
+		}
+	}
+}
+
+func TestFunctionDeltas(t *testing.T) {
+	original, err := CalculateMetricsFromContent("original.go", `package p
+
+func kept(a int) int {
+	return a
+}
+
+func dropped() {}
+`)
+	if err != nil {
+		t.Fatalf("Failed to calculate metrics: %v", err)
+	}
+	metamorphic, err := CalculateMetricsFromContent("metamorphic.go", `package p
+
+func kept(a int) int {
+	if a > 0 {
+		return a
+	}
+	return a
+}
+
+func helper() {}
+`)
+	if err != nil {
+		t.Fatalf("Failed to calculate metrics: %v", err)
+	}
+
+	delta := CalculateDeltaMetrics(original, metamorphic)
+	kept, ok := delta.Functions["kept"]
+	if !ok || len(delta.Functions) != 1 {
+		t.Fatalf("Expected deltas for kept only, got %v", delta.Functions)
+	}
+	if !kept.MoreComplex() || kept.CC.Absolute != 1 || kept.Nesting.Absolute != 1 || kept.Params.Absolute != 0 {
+		t.Errorf("Unexpected deltas for kept: %+v", kept)
+	}
+	if !slices.Equal(delta.Added, []string{"helper"}) || !slices.Equal(delta.Removed, []string{"dropped"}) {
+		t.Errorf("Expected helper added and dropped removed, got %v and %v", delta.Added, delta.Removed)
+	}
+}
+
+func TestCalculateFunctionMetrics(t *testing.T) {
+	testCode := `package test
+
+type T struct{}
+
+// Documented, which does not count
+func (t *T) Method(a, b int, _ string) {
+	if a > b {
+		for i := 0; i < a; i++ {
+			switch {
+			case i > b:
+				return
+			}
+		}
+	} else if a < b {
+		return
+	}
+}
+
+func init() {}
+
+func init() {
+	fmt.Println("second")
+}
+`
+	metrics, err := CalculateMetricsFromContent("test.go", testCode)
+	if err != nil {
+		t.Fatalf("Failed to calculate metrics: %v", err)
+	}
+
+	if len(metrics.Functions) != 3 {
+		t.Fatalf("Expected 3 functions, got %v", metrics.Functions)
+	}
+	method, ok := metrics.Functions["T.Method"]
+	if !ok {
+		t.Fatalf("Expected a method named T.Method, got %v", metrics.Functions)
+	}
+	if method.Params != 3 {
+		t.Errorf("Expected 3 parameters, got %d", method.Params)
+	}
+	if method.Nesting != 3 {
+		t.Errorf("Expected nesting depth 3, got %d", method.Nesting)
+	}
+	if method.LOC != 12 {
+		t.Errorf("Expected 12 lines of code, got %d", method.LOC)
+	}
+	if method.CC != 4 || method.CogC != 5 {
+		t.Errorf("Expected CC 4 and CogC 5, got %d and %d", method.CC, method.CogC)
+	}
+	if second, ok := metrics.Functions["init#2"]; !ok || second.LOC != 3 || second.Nesting != 0 {
+		t.Errorf("Expected the second init as init#2, got %v", metrics.Functions)
+	}
+}
+
+func TestHalstead(t *testing.T) {
+	h := calculateHalstead(`package p
+
+func add(a, b int) int {
+	return a + b
+}
+`)
+	// Operators: package func ( , { return + (7 in total, 7 distinct)
+	// Operands: p add a b int int a b (8 in total, 5 distinct)
+	want := Halstead{DistinctOperators: 7, DistinctOperands: 5, Operators: 7, Operands: 8}
+	if h != want {
+		t.Fatalf("Expected %+v, got %+v", want, h)
+	}
+	if volume := 15 * math.Log2(12); math.Abs(h.Volume()-volume) > 1e-9 {
+		t.Errorf("Expected volume %f, got %f", volume, h.Volume())
+	}
+	if math.Abs(h.Difficulty()-5.6) > 1e-9 || math.Abs(h.Effort()-5.6*h.Volume()) > 1e-9 {
+		t.Errorf("Expected difficulty 5.6, got %f (effort %f)", h.Difficulty(), h.Effort())
+	}
+	if (Halstead{}).Volume() != 0 || (Halstead{}).Difficulty() != 0 {
+		t.Error("Expected empty source to have no volume or difficulty")
+	}
+
+	simple, err := CalculateMetricsFromContent("simple.go", "package p\n\nfunc f() {}\n")
+	if err != nil {
+		t.Fatalf("Failed to calculate metrics: %v", err)
+	}
+	branchy, err := CalculateMetricsFromContent("branchy.go", `package p
+
+func f(a, b int) int {
+	if a > b && b > 0 {
+		for i := 0; i < a; i++ {
+			b += i * a
+		}
+	}
+	return b
+}
+`)
+	if err != nil {
+		t.Fatalf("Failed to calculate metrics: %v", err)
+	}
+	if simple.MaintainabilityIndex <= branchy.MaintainabilityIndex || branchy.MaintainabilityIndex <= 0 || simple.MaintainabilityIndex > 100 {
+		t.Errorf("Expected simpler code to be more maintainable, got %f and %f", simple.MaintainabilityIndex, branchy.MaintainabilityIndex)
+	}
+	if branchy.Halstead.Effort() <= simple.Halstead.Effort() {
+		t.Errorf("Expected more effort for complex code, got %f and %f", branchy.Halstead.Effort(), simple.Halstead.Effort())
 	}
 }
@@ -0,0 +1,166 @@
+// Package mutation generates mutants of a Go source file, small semantic
+// changes such as a flipped comparison, to estimate how likely a test suite
+// is to notice when a rewrite changes behavior
+package mutation
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+)
+
+// Mutant is the source file with one operator replaced
+type Mutant struct {
+	Pos         string // file:line:column of the replaced operator
+	Original    string // e.g. "<"
+	Replacement string // e.g. "<="
+	Source      []byte // The whole mutated file
+}
+
+// String describes the mutant, e.g. "app.go:12:9: < -> <="
+func (mu Mutant) String() string {
+	return fmt.Sprintf("%s: %s -> %s", mu.Pos, mu.Original, mu.Replacement)
+}
+
+// binaryMutations replaces arithmetic, comparison and logical operators
+var binaryMutations = map[token.Token]token.Token{
+	token.ADD:  token.SUB,
+	token.SUB:  token.ADD,
+	token.MUL:  token.QUO,
+	token.QUO:  token.MUL,
+	token.REM:  token.MUL,
+	token.EQL:  token.NEQ,
+	token.NEQ:  token.EQL,
+	token.LSS:  token.LEQ,
+	token.LEQ:  token.LSS,
+	token.GTR:  token.GEQ,
+	token.GEQ:  token.GTR,
+	token.LAND: token.LOR,
+	token.LOR:  token.LAND,
+}
+
+// Generate returns every mutant of src in source order. Mutants that do not
+// compile (e.g. - on strings) are included; the test run tells them apart.
+func Generate(path string, src []byte) ([]Mutant, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	type edit struct {
+		pos         token.Pos
+		original    string
+		replacement string
+	}
+	var edits []edit
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BinaryExpr:
+			if to, ok := binaryMutations[n.Op]; ok {
+				edits = append(edits, edit{n.OpPos, n.Op.String(), to.String()})
+			}
+		case *ast.IncDecStmt:
+			to := token.DEC
+			if n.Tok == token.DEC {
+				to = token.INC
+			}
+			edits = append(edits, edit{n.TokPos, n.Tok.String(), to.String()})
+		case *ast.Ident:
+			switch n.Name {
+			case "true":
+				edits = append(edits, edit{n.Pos(), "true", "false"})
+			case "false":
+				edits = append(edits, edit{n.Pos(), "false", "true"})
+			}
+		}
+		return true
+	})
+	sort.Slice(edits, func(i, j int) bool { return edits[i].pos < edits[j].pos })
+
+	mutants := make([]Mutant, 0, len(edits))
+	for _, e := range edits {
+		position := fset.Position(e.pos)
+		mutated := make([]byte, 0, len(src)-len(e.original)+len(e.replacement))
+		mutated = append(mutated, src[:position.Offset]...)
+		mutated = append(mutated, e.replacement...)
+		mutated = append(mutated, src[position.Offset+len(e.original):]...)
+		mutants = append(mutants, Mutant{
+			Pos:         position.String(),
+			Original:    e.original,
+			Replacement: e.replacement,
+			Source:      mutated,
+		})
+	}
+	return mutants, nil
+}
+
+// Sample returns at most n mutants spread evenly over the file, so the same
+// source always yields the same sample. n <= 0 returns all of them.
+func Sample(mutants []Mutant, n int) []Mutant {
+	if n <= 0 || len(mutants) <= n {
+		return mutants
+	}
+	sample := make([]Mutant, n)
+	for i := range sample {
+		sample[i] = mutants[i*len(mutants)/n]
+	}
+	return sample
+}
+
+// Status is the outcome of running the tests against a mutant
+type Status string
+
+const (
+	Killed   Status = "killed"   // The tests failed: they notice the change
+	Survived Status = "survived" // The tests passed: they miss the change
+	Invalid  Status = "invalid"  // The mutant does not compile and says nothing about the tests
+)
+
+// Result is the outcome of one mutant
+type Result struct {
+	Mutant Mutant
+	Status Status
+}
+
+// Report holds the outcomes of every tested mutant
+type Report struct {
+	Results []Result
+}
+
+// Counts returns the killed mutants and the mutants that compiled
+func (r Report) Counts() (killed, valid int) {
+	for _, res := range r.Results {
+		switch res.Status {
+		case Killed:
+			killed++
+			valid++
+		case Survived:
+			valid++
+		}
+	}
+	return killed, valid
+}
+
+// Score returns the share of compiling mutants the tests killed, from 0 to 1.
+// Without any compiling mutant there is nothing to measure, and the score is 1.
+func (r Report) Score() float64 {
+	killed, valid := r.Counts()
+	if valid == 0 {
+		return 1
+	}
+	return float64(killed) / float64(valid)
+}
+
+// Survivors returns the compiling mutants the tests did not notice
+func (r Report) Survivors() []Mutant {
+	var survivors []Mutant
+	for _, res := range r.Results {
+		if res.Status == Survived {
+			survivors = append(survivors, res.Mutant)
+		}
+	}
+	return survivors
+}
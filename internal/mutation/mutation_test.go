@@ -0,0 +1,103 @@
+package mutation
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+const source = `package sample
+
+func Clamp(x, max int) int {
+	if x > max && max != 0 {
+		return max
+	}
+	return x + 1
+}
+
+func Count(done bool) int {
+	n := 0
+	n++
+	if done == true {
+		return -n
+	}
+	return n
+}
+`
+
+func TestGenerate(t *testing.T) {
+	mutants, err := Generate("sample.go", []byte(source))
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	want := []string{
+		"sample.go:4:7: > -> >=",
+		"sample.go:4:13: && -> ||",
+		"sample.go:4:20: != -> ==",
+		"sample.go:7:11: + -> -",
+		"sample.go:12:3: ++ -> --",
+		"sample.go:13:10: == -> !=",
+		"sample.go:13:13: true -> false",
+	}
+	var got []string
+	for _, mu := range mutants {
+		got = append(got, mu.String())
+		if _, err := parser.ParseFile(token.NewFileSet(), "", mu.Source, 0); err != nil {
+			t.Errorf("Mutant %s does not parse: %v", mu, err)
+		}
+		if strings.Count(string(mu.Source), "\n") != strings.Count(source, "\n") {
+			t.Errorf("Mutant %s changed more than the operator", mu)
+		}
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected mutants:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if !strings.Contains(string(mutants[0].Source), "if x >= max && max != 0 {") {
+		t.Errorf("Expected only the first operator to change, got:\n%s", mutants[0].Source)
+	}
+
+	if _, err := Generate("bad.go", []byte("not go")); err == nil {
+		t.Error("Expected unparsable source to fail")
+	}
+}
+
+func TestSample(t *testing.T) {
+	mutants := make([]Mutant, 10)
+	for i := range mutants {
+		mutants[i].Pos = string(rune('a' + i))
+	}
+	var got string
+	for _, mu := range Sample(mutants, 4) {
+		got += mu.Pos
+	}
+	if got != "acfh" {
+		t.Errorf("Expected an evenly spread sample, got %q", got)
+	}
+	if len(Sample(mutants, 0)) != 10 || len(Sample(mutants, 20)) != 10 {
+		t.Error("Expected every mutant without a smaller limit")
+	}
+}
+
+func TestReport(t *testing.T) {
+	report := Report{Results: []Result{
+		{Mutant{Pos: "a"}, Killed},
+		{Mutant{Pos: "b"}, Survived},
+		{Mutant{Pos: "c"}, Invalid},
+		{Mutant{Pos: "d"}, Killed},
+		{Mutant{Pos: "e"}, Killed},
+	}}
+	if killed, valid := report.Counts(); killed != 3 || valid != 4 {
+		t.Errorf("Expected 3 of 4 killed, got %d of %d", killed, valid)
+	}
+	if report.Score() != 0.75 {
+		t.Errorf("Expected a score of 0.75, got %v", report.Score())
+	}
+	if s := report.Survivors(); len(s) != 1 || s[0].Pos != "b" {
+		t.Errorf("Expected mutant b to survive, got %v", s)
+	}
+	if (Report{}).Score() != 1 {
+		t.Error("Expected a report without compiling mutants to score 1")
+	}
+}
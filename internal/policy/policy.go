@@ -0,0 +1,215 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Hekzory/MetamorphLLM/internal/capability"
+)
+
+// FileScope is the pseudo-function that holds violations of the file as a whole
+const FileScope = "(file)"
+
+// Policy is the set of red lines a rewrite must respect. Zero values leave a
+// rule disabled.
+type Policy struct {
+	// AllowedImports lists the import paths rewritten code may use; "*" as the
+	// last path element allows a whole tree (e.g. "golang.org/x/*")
+	AllowedImports []string `json:"allowed_imports,omitempty"`
+	// ForbiddenIdentifiers are names rewritten code must not use: a plain name
+	// ("panic") or an import path and name ("os.Exit", "net/http.Get")
+	ForbiddenIdentifiers []string `json:"forbidden_identifiers,omitempty"`
+	// MaxGoroutinesAdded is how many more go statements a function may have
+	// after rewriting than before (nil for no limit)
+	MaxGoroutinesAdded *int `json:"max_goroutines_added,omitempty"`
+	// MaxFileGrowthPercent is how much larger the rewritten file may be than
+	// the original, in percent of bytes (0 for no limit)
+	MaxFileGrowthPercent float64 `json:"max_file_growth_percent,omitempty"`
+}
+
+// Violation is one rule broken by a rewritten function
+type Violation struct {
+	Function string
+	Rule     string
+	Detail   string
+}
+
+// Load reads a JSON policy file, rejecting unknown fields so typos do not
+// silently disable a rule
+func Load(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open policy: %w", err)
+	}
+	defer f.Close()
+
+	var p Policy
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("failed to parse policy %s: %w", path, err)
+	}
+	if p.MaxGoroutinesAdded != nil && *p.MaxGoroutinesAdded < 0 {
+		return nil, fmt.Errorf("policy %s: max_goroutines_added must not be negative", path)
+	}
+	if p.MaxFileGrowthPercent < 0 {
+		return nil, fmt.Errorf("policy %s: max_file_growth_percent must not be negative", path)
+	}
+	return &p, nil
+}
+
+// file is the part of a parsed source file the rules look at
+type file struct {
+	imports    map[string]string          // Local name to import path
+	paths      []string                   // All import paths, including blank and dot imports
+	goroutines map[string]int             // go statements per function
+	idents     map[string]map[string]bool // Identifiers used per function, as "name" and "path.name"
+}
+
+// parse collects imports, go statements and identifiers of Go source
+func parse(source string) (*file, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", source, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse source: %w", err)
+	}
+
+	pf := &file{imports: make(map[string]string), goroutines: make(map[string]int), idents: make(map[string]map[string]bool)}
+	for _, spec := range f.Imports {
+		p, _ := strconv.Unquote(spec.Path.Value)
+		pf.paths = append(pf.paths, p)
+		name := capability.ImportName(p)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		pf.imports[name] = p
+	}
+
+	for _, decl := range f.Decls {
+		scope := capability.PackageScope
+		if fd, ok := decl.(*ast.FuncDecl); ok {
+			scope = capability.FuncName(fd)
+		}
+		if pf.idents[scope] == nil {
+			pf.idents[scope] = make(map[string]bool)
+		}
+		if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			continue
+		}
+		ast.Inspect(decl, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.GoStmt:
+				pf.goroutines[scope]++
+			case *ast.SelectorExpr:
+				if ident, ok := n.X.(*ast.Ident); ok {
+					if p, ok := pf.imports[ident.Name]; ok {
+						pf.idents[scope][p+"."+n.Sel.Name] = true
+						return false
+					}
+				}
+			case *ast.Ident:
+				pf.idents[scope][n.Name] = true
+			}
+			return true
+		})
+	}
+	return pf, nil
+}
+
+// allowed reports whether an import path matches the allowlist
+func (p *Policy) allowed(importPath string) bool {
+	for _, pattern := range p.AllowedImports {
+		if pattern == importPath {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(importPath, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate checks a rewrite against the policy and returns its violations,
+// ordered by function
+func (p *Policy) Evaluate(original, rewritten string) ([]Violation, error) {
+	before, err := parse(original)
+	if err != nil {
+		return nil, fmt.Errorf("original: %w", err)
+	}
+	after, err := parse(rewritten)
+	if err != nil {
+		return nil, fmt.Errorf("rewritten: %w", err)
+	}
+
+	var violations []Violation
+	if len(p.AllowedImports) > 0 {
+		for _, importPath := range after.paths {
+			if p.allowed(importPath) {
+				continue
+			}
+			// Charge the import to the functions that use it, or to the file
+			users := 0
+			for scope, idents := range after.idents {
+				for ident := range idents {
+					if strings.HasPrefix(ident, importPath+".") && !strings.Contains(ident[len(importPath)+1:], ".") {
+						violations = append(violations, Violation{scope, "allowed_imports", fmt.Sprintf("uses %s, which is not allowed", importPath)})
+						users++
+						break
+					}
+				}
+			}
+			if users == 0 {
+				violations = append(violations, Violation{FileScope, "allowed_imports", fmt.Sprintf("imports %s, which is not allowed", importPath)})
+			}
+		}
+	}
+
+	for _, forbidden := range p.ForbiddenIdentifiers {
+		for scope, idents := range after.idents {
+			if idents[forbidden] {
+				violations = append(violations, Violation{scope, "forbidden_identifiers", "uses " + forbidden})
+			}
+		}
+	}
+
+	if p.MaxGoroutinesAdded != nil {
+		for scope, n := range after.goroutines {
+			if added := n - before.goroutines[scope]; added > *p.MaxGoroutinesAdded {
+				violations = append(violations, Violation{scope, "max_goroutines_added",
+					fmt.Sprintf("adds %d go statement(s), at most %d allowed", added, *p.MaxGoroutinesAdded)})
+			}
+		}
+	}
+
+	if p.MaxFileGrowthPercent > 0 && len(original) > 0 {
+		growth := float64(len(rewritten)-len(original)) / float64(len(original)) * 100
+		if growth > p.MaxFileGrowthPercent {
+			violations = append(violations, Violation{FileScope, "max_file_growth_percent",
+				fmt.Sprintf("grew by %.1f%% (%d to %d bytes), at most %.1f%% allowed", growth, len(original), len(rewritten), p.MaxFileGrowthPercent)})
+		}
+	}
+
+	sort.Slice(violations, func(i, j int) bool {
+		if violations[i].Function != violations[j].Function {
+			return violations[i].Function < violations[j].Function
+		}
+		return violations[i].Rule < violations[j].Rule
+	})
+	return violations, nil
+}
+
+// Summary formats violations one per line, prefixed by function
+func Summary(violations []Violation) string {
+	lines := make([]string, len(violations))
+	for i, v := range violations {
+		lines[i] = fmt.Sprintf("%s: %s (%s)", v.Function, v.Detail, v.Rule)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,129 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const original = `package p
+
+import "fmt"
+
+func Hello(name string) {
+	fmt.Println("hello", name)
+}
+
+func Worker(jobs chan int) {
+	go func() { <-jobs }()
+}
+`
+
+// TestEvaluate tests that each rule reports violations against the functions that break it
+func TestEvaluate(t *testing.T) {
+	rewritten := `package p
+
+import (
+	"fmt"
+	xo "os"
+	_ "net/http/pprof"
+)
+
+func Hello(name string) {
+	for i := 0; i < 2; i++ {
+		go fmt.Println("hello", name)
+	}
+	xo.Exit(0)
+}
+
+func Worker(jobs chan int) {
+	go func() { <-jobs }()
+	panic("unreachable")
+}
+`
+	none := 0
+	p := &Policy{
+		AllowedImports:       []string{"fmt", "os"},
+		ForbiddenIdentifiers: []string{"os.Exit", "panic"},
+		MaxGoroutinesAdded:   &none,
+		MaxFileGrowthPercent: 50,
+	}
+	violations, err := p.Evaluate(original, rewritten)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+
+	var got []string
+	for _, v := range violations {
+		got = append(got, v.Function+" "+v.Rule)
+	}
+	want := []string{
+		"(file) allowed_imports",
+		"(file) max_file_growth_percent",
+		"Hello forbidden_identifiers",
+		"Hello max_goroutines_added",
+		"Worker forbidden_identifiers",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected violations:\n%s\nwant:\n%s", Summary(violations), strings.Join(want, "\n"))
+	}
+
+	// An empty policy allows everything
+	if violations, err := (&Policy{}).Evaluate(original, rewritten); err != nil || len(violations) != 0 {
+		t.Errorf("Expected no violations from an empty policy, got %v, %v", violations, err)
+	}
+}
+
+// TestAllowedImportPatterns tests exact and tree patterns and per-function attribution
+func TestAllowedImportPatterns(t *testing.T) {
+	rewritten := `package p
+
+import (
+	"fmt"
+	"golang.org/x/text/cases"
+	"net/http"
+)
+
+func Hello(name string) {
+	fmt.Println(cases.Title, name)
+}
+
+func Fetch() { http.Get("https://example.com") }
+`
+	p := &Policy{AllowedImports: []string{"fmt", "golang.org/x/*"}}
+	violations, err := p.Evaluate(original, rewritten)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if len(violations) != 1 || violations[0].Function != "Fetch" || !strings.Contains(violations[0].Detail, "net/http") {
+		t.Errorf("Expected only Fetch to violate the import allowlist, got:\n%s", Summary(violations))
+	}
+}
+
+// TestLoad tests parsing and validation of policy files
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write policy: %v", err)
+		}
+		return path
+	}
+
+	p, err := Load(write("ok.json", `{"allowed_imports": ["fmt"], "max_goroutines_added": 0, "max_file_growth_percent": 200}`))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if p.MaxGoroutinesAdded == nil || *p.MaxGoroutinesAdded != 0 || p.MaxFileGrowthPercent != 200 {
+		t.Errorf("Unexpected policy: %+v", p)
+	}
+
+	if _, err := Load(write("typo.json", `{"allowed_import": ["fmt"]}`)); err == nil {
+		t.Error("Expected an error for an unknown field")
+	}
+	if _, err := Load(write("negative.json", `{"max_goroutines_added": -1}`)); err == nil {
+		t.Error("Expected an error for a negative limit")
+	}
+}
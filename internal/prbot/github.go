@@ -0,0 +1,268 @@
+package prbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/redact"
+)
+
+// DefaultAPIURL is the GitHub REST API used unless GITHUB_API_URL says otherwise
+const DefaultAPIURL = "https://api.github.com"
+
+// errNotFound is returned for 404 responses
+var errNotFound = errors.New("not found")
+
+// GitHub is a minimal client for the REST endpoints the bot needs
+type GitHub struct {
+	BaseURL string
+	Token   string
+	HTTP    *http.Client
+}
+
+// NewGitHub creates a client for baseURL (DefaultAPIURL if empty)
+func NewGitHub(baseURL, token string) *GitHub {
+	if baseURL == "" {
+		baseURL = DefaultAPIURL
+	}
+	return &GitHub{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Token:   token,
+		HTTP:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// PullFile is a file changed by a pull request
+type PullFile struct {
+	Filename string `json:"filename"`
+	Status   string `json:"status"` // added, modified, removed, renamed, ...
+	Patch    string `json:"patch"`  // Unified diff; empty for binary or very large changes
+}
+
+// Comment is an issue or pull request comment
+type Comment struct {
+	ID   int64  `json:"id"`
+	Body string `json:"body"`
+}
+
+// TreeEntry is a file written by CreateTree
+type TreeEntry struct {
+	Path    string `json:"path"`
+	Mode    string `json:"mode"`
+	Type    string `json:"type"`
+	Content string `json:"content"`
+}
+
+// PullFiles lists the files changed by pull request number
+func (gh *GitHub) PullFiles(ctx context.Context, repo string, number int) ([]PullFile, error) {
+	var all []PullFile
+	for page := 1; ; page++ {
+		var files []PullFile
+		path := fmt.Sprintf("/repos/%s/pulls/%d/files?per_page=100&page=%d", repo, number, page)
+		if err := gh.do(ctx, http.MethodGet, path, nil, &files); err != nil {
+			return nil, err
+		}
+		all = append(all, files...)
+		if len(files) < 100 {
+			return all, nil
+		}
+	}
+}
+
+// FileContent returns the content of path at ref
+func (gh *GitHub) FileContent(ctx context.Context, repo, path, ref string) (string, error) {
+	var file struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	endpoint := fmt.Sprintf("/repos/%s/contents/%s?ref=%s", repo, escapePath(path), url.QueryEscape(ref))
+	if err := gh.do(ctx, http.MethodGet, endpoint, nil, &file); err != nil {
+		return "", err
+	}
+	if file.Encoding != "base64" {
+		return "", fmt.Errorf("unexpected encoding %q for %s", file.Encoding, path)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(file.Content, "\n", ""))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return string(data), nil
+}
+
+// CommitTree returns the tree SHA of a commit
+func (gh *GitHub) CommitTree(ctx context.Context, repo, sha string) (string, error) {
+	var commit struct {
+		Tree struct {
+			SHA string `json:"sha"`
+		} `json:"tree"`
+	}
+	if err := gh.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/git/commits/%s", repo, sha), nil, &commit); err != nil {
+		return "", err
+	}
+	return commit.Tree.SHA, nil
+}
+
+// CreateTree writes entries on top of baseTree and returns the new tree SHA
+func (gh *GitHub) CreateTree(ctx context.Context, repo, baseTree string, entries []TreeEntry) (string, error) {
+	body := map[string]any{"base_tree": baseTree, "tree": entries}
+	var tree struct {
+		SHA string `json:"sha"`
+	}
+	if err := gh.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/git/trees", repo), body, &tree); err != nil {
+		return "", err
+	}
+	return tree.SHA, nil
+}
+
+// CreateCommit creates a commit of tree with one parent and returns its SHA
+func (gh *GitHub) CreateCommit(ctx context.Context, repo, message, tree, parent string) (string, error) {
+	body := map[string]any{"message": message, "tree": tree, "parents": []string{parent}}
+	var commit struct {
+		SHA string `json:"sha"`
+	}
+	if err := gh.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/git/commits", repo), body, &commit); err != nil {
+		return "", err
+	}
+	return commit.SHA, nil
+}
+
+// SetBranch points branch at sha, creating the branch if needed. Existing
+// branches are force-updated: the companion branch is regenerated every time.
+func (gh *GitHub) SetBranch(ctx context.Context, repo, branch, sha string) error {
+	path := fmt.Sprintf("/repos/%s/git/refs/heads/%s", repo, escapePath(branch))
+	err := gh.do(ctx, http.MethodPatch, path, map[string]any{"sha": sha, "force": true}, nil)
+	if err == nil {
+		return nil
+	}
+	var apiErr *APIError
+	if !errors.Is(err, errNotFound) && !(errors.As(err, &apiErr) && apiErr.Status == http.StatusUnprocessableEntity) {
+		return err
+	}
+	body := map[string]any{"ref": "refs/heads/" + branch, "sha": sha}
+	return gh.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/git/refs", repo), body, nil)
+}
+
+// OpenPull returns the number of the open pull request from head into base,
+// creating it with title and body if there is none
+func (gh *GitHub) OpenPull(ctx context.Context, repo, head, base, title, body string) (int, error) {
+	owner, _, _ := strings.Cut(repo, "/")
+	var pulls []struct {
+		Number int `json:"number"`
+	}
+	path := fmt.Sprintf("/repos/%s/pulls?state=open&head=%s&base=%s", repo, url.QueryEscape(owner+":"+head), url.QueryEscape(base))
+	if err := gh.do(ctx, http.MethodGet, path, nil, &pulls); err != nil {
+		return 0, err
+	}
+	if len(pulls) > 0 {
+		return pulls[0].Number, nil
+	}
+
+	var pull struct {
+		Number int `json:"number"`
+	}
+	req := map[string]any{"title": title, "head": head, "base": base, "body": body}
+	if err := gh.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/pulls", repo), req, &pull); err != nil {
+		return 0, err
+	}
+	return pull.Number, nil
+}
+
+// UpsertComment updates the first comment on issue number that contains
+// marker, or creates a new comment if there is none
+func (gh *GitHub) UpsertComment(ctx context.Context, repo string, number int, marker, body string) error {
+	for page := 1; ; page++ {
+		var comments []Comment
+		path := fmt.Sprintf("/repos/%s/issues/%d/comments?per_page=100&page=%d", repo, number, page)
+		if err := gh.do(ctx, http.MethodGet, path, nil, &comments); err != nil {
+			return err
+		}
+		for _, c := range comments {
+			if strings.Contains(c.Body, marker) {
+				return gh.do(ctx, http.MethodPatch, fmt.Sprintf("/repos/%s/issues/comments/%d", repo, c.ID), map[string]string{"body": body}, nil)
+			}
+		}
+		if len(comments) < 100 {
+			break
+		}
+	}
+	return gh.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/issues/%d/comments", repo, number), map[string]string{"body": body}, nil)
+}
+
+// APIError is a non-2xx response from the API
+type APIError struct {
+	Method  string
+	Path    string
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("GitHub API %s %s: %d %s", e.Method, e.Path, e.Status, e.Message)
+}
+
+// Is makes 404 responses match errNotFound
+func (e *APIError) Is(target error) bool {
+	return target == errNotFound && e.Status == http.StatusNotFound
+}
+
+// do sends a JSON request and decodes the JSON response into out (if not nil)
+func (gh *GitHub) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, gh.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if gh.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+gh.Token)
+	}
+
+	resp, err := gh.HTTP.Do(req)
+	if err != nil {
+		return redact.Error(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&apiErr)
+		return &APIError{Method: method, Path: strings.SplitN(path, "?", 2)[0], Status: resp.StatusCode, Message: redact.String(apiErr.Message)}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// escapePath escapes each segment of a slash-separated path
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
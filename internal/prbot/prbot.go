@@ -0,0 +1,378 @@
+// Package prbot rewrites the functions changed by a GitHub pull request and
+// publishes the variant on a companion branch, with a metrics comment on the
+// pull request. It runs from a webhook or inside a workflow.
+package prbot
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Hekzory/MetamorphLLM/internal/eval"
+	"github.com/Hekzory/MetamorphLLM/internal/metrics"
+	"github.com/Hekzory/MetamorphLLM/internal/redact"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+// DefaultBranchPrefix names companion branches, followed by the PR number
+const DefaultBranchPrefix = "metamorph/pr-"
+
+// commentMarker identifies the bot's comment so later runs update it
+const commentMarker = "<!-- metamorph-prbot -->"
+
+// PullRequest identifies the head of a pull request
+type PullRequest struct {
+	Repo     string // owner/name of the base repository
+	Number   int
+	HeadSHA  string
+	HeadRef  string // Branch name of the head
+	HeadRepo string // owner/name of the head repository; differs from Repo for forks
+}
+
+// Bot rewrites pull requests
+type Bot struct {
+	GitHub       *GitHub
+	NewRewriter  eval.RewriterFactory
+	Strategy     string
+	Model        string
+	BranchPrefix string
+	// OpenPull opens a companion pull request from the variant branch into the
+	// PR's head branch. Forks are skipped: their branches are not writable.
+	OpenPull bool
+	// Skip selects the vendored and generated files that are not rewritten
+	Skip rewriter.SkipRules
+}
+
+// New creates a bot using the default rewriter factory
+func New(gh *GitHub, strategy, model string) *Bot {
+	return &Bot{
+		GitHub:       gh,
+		NewRewriter:  eval.DefaultRewriterFactory,
+		Strategy:     strategy,
+		Model:        model,
+		BranchPrefix: DefaultBranchPrefix,
+		Skip:         rewriter.DefaultSkipRules(),
+	}
+}
+
+// FileResult is the outcome for one changed Go file
+type FileResult struct {
+	Path      string
+	Functions []string // Changed functions sent to the rewriter
+	Before    *metrics.Metrics
+	After     *metrics.Metrics // Nil if the rewrite failed
+	Error     string
+}
+
+// Result is the outcome of handling a pull request
+type Result struct {
+	Files     []FileResult
+	Branch    string // Companion branch; empty if no file was rewritten
+	CommitSHA string
+	Companion int // Number of the companion pull request, if opened
+}
+
+// Handle rewrites the Go functions changed by pr, pushes the rewritten files
+// to the companion branch and comments the metrics on pr
+func (b *Bot) Handle(ctx context.Context, pr PullRequest) (*Result, error) {
+	if strings.HasPrefix(pr.HeadRef, b.BranchPrefix) {
+		return nil, fmt.Errorf("pull request #%d comes from a companion branch", pr.Number)
+	}
+
+	files, err := b.GitHub.PullFiles(ctx, pr.Repo, pr.Number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list changed files: %w", err)
+	}
+
+	result := &Result{}
+	var entries []TreeEntry
+	for _, file := range files {
+		if !isRewritable(file) || b.Skip.PathReason(file.Filename) != "" {
+			continue
+		}
+		source, err := b.GitHub.FileContent(ctx, pr.Repo, file.Filename, pr.HeadSHA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s: %w", file.Filename, err)
+		}
+		if b.Skip.Reason(file.Filename, source) != "" {
+			continue
+		}
+		fr, variant := b.rewriteFile(ctx, file, source)
+		if fr == nil {
+			continue
+		}
+		result.Files = append(result.Files, *fr)
+		if variant != "" {
+			entries = append(entries, TreeEntry{Path: file.Filename, Mode: "100644", Type: "blob", Content: variant})
+		}
+	}
+
+	if len(entries) > 0 {
+		if err := b.publish(ctx, pr, entries, result); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := b.GitHub.UpsertComment(ctx, pr.Repo, pr.Number, commentMarker, renderComment(pr, result)); err != nil {
+		return nil, fmt.Errorf("failed to comment on #%d: %w", pr.Number, err)
+	}
+	return result, nil
+}
+
+// rewriteFile rewrites the changed functions of one file. It returns nil if no
+// function changed, and an empty variant if the rewrite failed.
+func (b *Bot) rewriteFile(ctx context.Context, file PullFile, source string) (*FileResult, string) {
+	changed, err := ChangedFunctions(source, file.Patch, file.Status == "added" || file.Patch == "")
+	if err != nil {
+		return &FileResult{Path: file.Filename, Error: err.Error()}, ""
+	}
+	if len(changed) == 0 {
+		return nil, ""
+	}
+
+	fr := &FileResult{Path: file.Filename, Functions: sortedKeys(changed)}
+	fr.Before, _ = metrics.CalculateMetricsFromContent(file.Filename, source)
+
+	rw, err := b.NewRewriter(b.Strategy, b.Model)
+	if err != nil {
+		fr.Error = err.Error()
+		return fr, ""
+	}
+	defer rw.Close()
+	rw.Select = func(fd *ast.FuncDecl) bool { return changed[FuncKey(fd)] }
+	// The variant replaces the original on the companion branch, so it must
+	// build without the rewritten tag, keeping any constraint of its own
+	_ = rw.SetBuildTag("")
+
+	variant, err := rw.RewriteContent(ctx, source)
+	if err == nil && strings.HasPrefix(variant, source) {
+		// RewriteContent reports failures and unchanged files with a comment
+		// appended to the source
+		note := strings.TrimSpace(strings.TrimPrefix(variant, source))
+		err = fmt.Errorf("%s", strings.TrimPrefix(note, "// "))
+	}
+	if err != nil {
+		fr.Error = redact.String(err.Error())
+		return fr, ""
+	}
+	fr.After, _ = metrics.CalculateMetricsFromContent(file.Filename, variant)
+	return fr, variant
+}
+
+// publish commits the variant files on top of the PR head and points the
+// companion branch at the commit
+func (b *Bot) publish(ctx context.Context, pr PullRequest, entries []TreeEntry, result *Result) error {
+	baseTree, err := b.GitHub.CommitTree(ctx, pr.Repo, pr.HeadSHA)
+	if err != nil {
+		return fmt.Errorf("failed to read head commit: %w", err)
+	}
+	tree, err := b.GitHub.CreateTree(ctx, pr.Repo, baseTree, entries)
+	if err != nil {
+		return fmt.Errorf("failed to create tree: %w", err)
+	}
+	message := fmt.Sprintf("Metamorph variant of #%d at %s\n\nRewritten with the %s strategy.", pr.Number, shortSHA(pr.HeadSHA), b.Strategy)
+	commit, err := b.GitHub.CreateCommit(ctx, pr.Repo, message, tree, pr.HeadSHA)
+	if err != nil {
+		return fmt.Errorf("failed to create commit: %w", err)
+	}
+
+	branch := b.BranchPrefix + strconv.Itoa(pr.Number)
+	if err := b.GitHub.SetBranch(ctx, pr.Repo, branch, commit); err != nil {
+		return fmt.Errorf("failed to update branch %s: %w", branch, err)
+	}
+	result.Branch, result.CommitSHA = branch, commit
+
+	if b.OpenPull && (pr.HeadRepo == "" || pr.HeadRepo == pr.Repo) {
+		title := fmt.Sprintf("Metamorph variant of #%d", pr.Number)
+		body := fmt.Sprintf("Rewritten functions changed by #%d. This branch is regenerated on every push to #%d.", pr.Number, pr.Number)
+		number, err := b.GitHub.OpenPull(ctx, pr.Repo, branch, pr.HeadRef, title, body)
+		if err != nil {
+			return fmt.Errorf("failed to open companion pull request: %w", err)
+		}
+		result.Companion = number
+	}
+	return nil
+}
+
+// isRewritable reports whether a changed file is Go source the bot rewrites
+func isRewritable(file PullFile) bool {
+	if !strings.HasSuffix(file.Filename, ".go") || strings.HasSuffix(file.Filename, "_test.go") {
+		return false
+	}
+	if strings.HasSuffix(file.Filename, ".rewritten.go") || strings.Contains("/"+file.Filename, "/testdata/") {
+		return false
+	}
+	return file.Status == "added" || file.Status == "modified" || file.Status == "renamed" || file.Status == "changed"
+}
+
+// ChangedFunctions returns the keys (see FuncKey) of the functions in source
+// touched by patch, a unified diff against source. With all set, every
+// function counts as changed.
+func ChangedFunctions(source, patch string, all bool) (map[string]bool, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "source.go", source, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse: %w", err)
+	}
+	lines := changedLines(patch)
+
+	changed := make(map[string]bool)
+	for _, decl := range f.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Body == nil {
+			continue
+		}
+		start, end := fset.Position(fd.Pos()).Line, fset.Position(fd.End()).Line
+		if fd.Doc != nil {
+			start = fset.Position(fd.Doc.Pos()).Line
+		}
+		if all || touches(lines, start, end) {
+			changed[FuncKey(fd)] = true
+		}
+	}
+	return changed, nil
+}
+
+// changedLines returns the new-file line numbers added by a unified diff.
+// A pure deletion counts as a change of the line that follows it.
+func changedLines(patch string) []int {
+	var lines []int
+	line := 0
+	for _, text := range strings.Split(patch, "\n") {
+		switch {
+		case strings.HasPrefix(text, "@@"):
+			// @@ -a,b +c,d @@
+			fields := strings.Fields(text)
+			if len(fields) >= 3 && strings.HasPrefix(fields[2], "+") {
+				start, _, _ := strings.Cut(fields[2][1:], ",")
+				line, _ = strconv.Atoi(start)
+			}
+		case strings.HasPrefix(text, "+"):
+			lines = append(lines, line)
+			line++
+		case strings.HasPrefix(text, "-"):
+			lines = append(lines, line)
+		case strings.HasPrefix(text, `\`):
+			// "\ No newline at end of file"
+		default:
+			line++
+		}
+	}
+	return lines
+}
+
+// touches reports whether any line lies within [start, end]
+func touches(lines []int, start, end int) bool {
+	for _, l := range lines {
+		if l >= start && l <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// FuncKey identifies a function within a package: Name for functions and
+// Type.Name for methods
+func FuncKey(fd *ast.FuncDecl) string {
+	if fd.Recv == nil || len(fd.Recv.List) == 0 {
+		return fd.Name.Name
+	}
+	typ := fd.Recv.List[0].Type
+	for {
+		switch t := typ.(type) {
+		case *ast.StarExpr:
+			typ = t.X
+			continue
+		case *ast.IndexExpr:
+			typ = t.X
+			continue
+		case *ast.IndexListExpr:
+			typ = t.X
+			continue
+		case *ast.Ident:
+			return t.Name + "." + fd.Name.Name
+		}
+		return fd.Name.Name
+	}
+}
+
+// renderComment formats the metrics comment posted on the pull request
+func renderComment(pr PullRequest, result *Result) string {
+	var sb strings.Builder
+	sb.WriteString(commentMarker + "\n")
+	sb.WriteString("### MetamorphLLM variant\n\n")
+	switch {
+	case len(result.Files) == 0:
+		fmt.Fprintf(&sb, "No changed Go functions to rewrite at %s.\n", shortSHA(pr.HeadSHA))
+		return sb.String()
+	case result.Branch == "":
+		fmt.Fprintf(&sb, "No file could be rewritten at %s.\n\n", shortSHA(pr.HeadSHA))
+	default:
+		fmt.Fprintf(&sb, "Rewrote the changed functions of %s into branch `%s` (%s).", shortSHA(pr.HeadSHA), result.Branch, shortSHA(result.CommitSHA))
+		if result.Companion != 0 {
+			fmt.Fprintf(&sb, " Companion pull request: #%d.", result.Companion)
+		}
+		sb.WriteString("\n\n")
+	}
+
+	sb.WriteString("| File | Functions | LOC | CC | CogC |\n|---|---|---|---|---|\n")
+	for _, f := range result.Files {
+		if f.Error != "" || f.Before == nil || f.After == nil {
+			msg := f.Error
+			if msg == "" {
+				msg = "metrics unavailable"
+			}
+			fmt.Fprintf(&sb, "| `%s` | %d | failed: %s | | |\n", f.Path, len(f.Functions), escapeCell(msg))
+			continue
+		}
+		fmt.Fprintf(&sb, "| `%s` | %d | %s | %s | %s |\n", f.Path, len(f.Functions),
+			change(f.Before.LOC, f.After.LOC), change(f.Before.CC, f.After.CC), change(f.Before.CogC, f.After.CogC))
+	}
+
+	var names []string
+	for _, f := range result.Files {
+		for _, fn := range f.Functions {
+			names = append(names, "`"+path.Base(f.Path)+":"+fn+"`")
+		}
+	}
+	if len(names) > 0 {
+		fmt.Fprintf(&sb, "\nFunctions: %s\n", strings.Join(names, ", "))
+	}
+	return sb.String()
+}
+
+// change formats a metric before and after, with the relative change when defined
+func change(before, after int) string {
+	if before == 0 {
+		return fmt.Sprintf("%d → %d", before, after)
+	}
+	return fmt.Sprintf("%d → %d (%+.1f%%)", before, after, float64(after-before)/float64(before)*100)
+}
+
+// escapeCell keeps a message on one line of a Markdown table
+func escapeCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,230 @@
+package prbot
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"go/ast"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Hekzory/MetamorphLLM/internal/eval"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+const source = `package p
+
+// Add adds
+func Add(a, b int) int {
+	return a + b
+}
+
+func (c *Counter) Inc() {
+	c.n++
+}
+
+func Sub(a, b int) int {
+	return a - b
+}
+`
+
+// patch changes the body of Inc only
+const patch = `@@ -9,3 +9,3 @@ func Add(a, b int) int {
+ func (c *Counter) Inc() {
+-	c.n += 1
++	c.n++
+ }`
+
+// TestChangedFunctions tests mapping diff hunks to function keys
+func TestChangedFunctions(t *testing.T) {
+	changed, err := ChangedFunctions(source, patch, false)
+	if err != nil {
+		t.Fatalf("ChangedFunctions failed: %v", err)
+	}
+	if len(changed) != 1 || !changed["Counter.Inc"] {
+		t.Errorf("Expected only Counter.Inc, got %v", changed)
+	}
+
+	// A deleted line just before a doc comment belongs to the function it documents
+	changed, _ = ChangedFunctions(source, "@@ -3,2 +3,1 @@\n-// old\n // Add adds", false)
+	if !changed["Add"] || len(changed) != 1 {
+		t.Errorf("Expected Add, got %v", changed)
+	}
+
+	changed, _ = ChangedFunctions(source, "", true)
+	if len(changed) != 3 {
+		t.Errorf("Expected every function of an added file, got %v", changed)
+	}
+}
+
+// fakeGitHub implements the endpoints used by the bot
+type fakeGitHub struct {
+	mu       sync.Mutex
+	files    []PullFile
+	content  map[string]string
+	trees    [][]TreeEntry
+	refs     map[string]string
+	comments []Comment
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var body map[string]any
+	json.NewDecoder(r.Body).Decode(&body)
+	reply := func(v any) { json.NewEncoder(w).Encode(v) }
+
+	path := r.URL.Path
+	switch {
+	case strings.HasSuffix(path, "/pulls/7/files"):
+		reply(f.files)
+	case strings.Contains(path, "/contents/"):
+		name := path[strings.Index(path, "/contents/")+len("/contents/"):]
+		reply(map[string]string{"encoding": "base64", "content": base64.StdEncoding.EncodeToString([]byte(f.content[name]))})
+	case strings.Contains(path, "/git/commits/"):
+		reply(map[string]any{"tree": map[string]string{"sha": "basetree"}})
+	case strings.HasSuffix(path, "/git/trees"):
+		data, _ := json.Marshal(body["tree"])
+		var entries []TreeEntry
+		json.Unmarshal(data, &entries)
+		f.trees = append(f.trees, entries)
+		reply(map[string]string{"sha": "tree1"})
+	case strings.HasSuffix(path, "/git/commits"):
+		reply(map[string]string{"sha": "commit1"})
+	case strings.Contains(path, "/git/refs/heads/") && r.Method == http.MethodPatch:
+		name := strings.TrimPrefix(path[strings.Index(path, "/git/refs/heads/"):], "/git/refs/heads/")
+		if _, ok := f.refs[name]; !ok {
+			http.Error(w, `{"message": "Reference does not exist"}`, http.StatusUnprocessableEntity)
+			return
+		}
+		f.refs[name] = body["sha"].(string)
+	case strings.HasSuffix(path, "/git/refs"):
+		f.refs[strings.TrimPrefix(body["ref"].(string), "refs/heads/")] = body["sha"].(string)
+		w.WriteHeader(http.StatusCreated)
+	case strings.HasSuffix(path, "/issues/7/comments") && r.Method == http.MethodGet:
+		reply(f.comments)
+	case strings.HasSuffix(path, "/issues/7/comments"):
+		f.comments = append(f.comments, Comment{ID: int64(len(f.comments) + 1), Body: body["body"].(string)})
+		w.WriteHeader(http.StatusCreated)
+	case strings.Contains(path, "/issues/comments/"):
+		f.comments[0].Body = body["body"].(string)
+	default:
+		http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+	}
+}
+
+// markerStrategy appends a marker() call to every function it is given
+type markerStrategy struct{}
+
+// Rewrite implements the RewriteStrategy interface
+func (markerStrategy) Rewrite(_ context.Context, f *ast.File) (bool, error) {
+	for _, decl := range f.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok {
+			fd.Body.List = append(fd.Body.List, &ast.ExprStmt{X: &ast.CallExpr{Fun: ast.NewIdent("marker")}})
+		}
+	}
+	return true, nil
+}
+
+// TestHandle tests that only changed functions are rewritten, pushed and commented on
+func TestHandle(t *testing.T) {
+	fake := &fakeGitHub{
+		files: []PullFile{
+			{Filename: "p/p.go", Status: "modified", Patch: patch},
+			{Filename: "p/p_test.go", Status: "modified", Patch: patch},
+			{Filename: "README.md", Status: "modified"},
+		},
+		content: map[string]string{"p/p.go": source},
+		refs:    map[string]string{},
+	}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	bot := New(NewGitHub(ts.URL, "test-token"), "marker", "")
+	bot.NewRewriter = func(strategy, model string) (*rewriter.Rewriter, error) {
+		r := rewriter.NewRewriter()
+		r.Strategy = markerStrategy{}
+		return r, nil
+	}
+	pr := PullRequest{Repo: "o/r", Number: 7, HeadSHA: "0123456789abcdef", HeadRef: "feature"}
+	result, err := bot.Handle(context.Background(), pr)
+	if err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+
+	if len(result.Files) != 1 || strings.Join(result.Files[0].Functions, ",") != "Counter.Inc" {
+		t.Fatalf("Expected p/p.go with Counter.Inc, got %+v", result.Files)
+	}
+	if len(fake.trees) != 1 || len(fake.trees[0]) != 1 || fake.trees[0][0].Path != "p/p.go" {
+		t.Fatalf("Expected one tree with p/p.go, got %+v", fake.trees)
+	}
+	variant := fake.trees[0][0].Content
+	if strings.HasPrefix(variant, rewriter.BuildTagHeader) {
+		t.Errorf("Expected the variant without the rewritten build tag:\n%s", variant)
+	}
+	if strings.Count(variant, "marker()") != 1 || !strings.Contains(variant, "c.n++\n\tmarker()") {
+		t.Errorf("Expected only Inc to be rewritten:\n%s", variant)
+	}
+	if fake.refs["metamorph/pr-7"] != "commit1" {
+		t.Errorf("Expected the companion branch to be created, got %v", fake.refs)
+	}
+	if len(fake.comments) != 1 || !strings.Contains(fake.comments[0].Body, "`p/p.go`") || !strings.Contains(fake.comments[0].Body, "metamorph/pr-7") {
+		t.Errorf("Expected a metrics comment, got %+v", fake.comments)
+	}
+
+	// A new push updates the branch and the comment instead of adding another
+	pr.HeadSHA = "fedcba9876543210"
+	if _, err := bot.Handle(context.Background(), pr); err != nil {
+		t.Fatalf("Second Handle failed: %v", err)
+	}
+	if len(fake.comments) != 1 || !strings.Contains(fake.comments[0].Body, "fedcba9") {
+		t.Errorf("Expected the comment to be updated, got %+v", fake.comments)
+	}
+
+	// Companion branches are never rewritten again
+	pr.HeadRef = "metamorph/pr-7"
+	if _, err := bot.Handle(context.Background(), pr); err == nil {
+		t.Error("Expected a companion branch to be refused")
+	}
+}
+
+// TestWebhook tests signature verification and event filtering
+func TestWebhook(t *testing.T) {
+	wh := &Webhook{Bot: New(NewGitHub("http://127.0.0.1:0", ""), eval.StrategyComment, ""), Secret: "s3cret"}
+	payload := []byte(`{"action": "closed", "number": 7, "repository": {"full_name": "o/r"}, "pull_request": {"head": {"sha": "abc", "ref": "feature"}}}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(payload)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	cases := []struct {
+		name      string
+		signature string
+		status    int
+	}{
+		{"valid signature", signature, http.StatusAccepted},
+		{"wrong signature", "sha256=" + strings.Repeat("0", 64), http.StatusUnauthorized},
+		{"missing signature", "", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(payload))
+		req.Header.Set("X-GitHub-Event", "pull_request")
+		req.Header.Set("X-Hub-Signature-256", c.signature)
+		rec := httptest.NewRecorder()
+		wh.ServeHTTP(rec, req)
+		if rec.Code != c.status {
+			t.Errorf("%s: expected %d, got %d", c.name, c.status, rec.Code)
+		}
+	}
+	wh.Wait()
+
+	if _, ok, err := ParseEvent(payload); ok || err != nil {
+		t.Errorf("Expected a closed pull request to be ignored, got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,166 @@
+package prbot
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/redact"
+)
+
+// maxPayloadBytes bounds webhook payloads; GitHub caps them at 25 MB
+const maxPayloadBytes = 25 << 20
+
+// pullRequestEvent is the part of a pull_request webhook payload the bot reads
+type pullRequestEvent struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Head struct {
+			SHA  string `json:"sha"`
+			Ref  string `json:"ref"`
+			Repo struct {
+				FullName string `json:"full_name"`
+			} `json:"repo"`
+		} `json:"head"`
+	} `json:"pull_request"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// ParseEvent extracts the pull request from a pull_request event payload. It
+// reports false for actions that do not change the head (closed, labeled, ...).
+func ParseEvent(payload []byte) (PullRequest, bool, error) {
+	var event pullRequestEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return PullRequest{}, false, fmt.Errorf("invalid pull_request event: %w", err)
+	}
+	switch event.Action {
+	case "opened", "synchronize", "reopened":
+	default:
+		return PullRequest{}, false, nil
+	}
+	pr := PullRequest{
+		Repo:     event.Repository.FullName,
+		Number:   event.Number,
+		HeadSHA:  event.PullRequest.Head.SHA,
+		HeadRef:  event.PullRequest.Head.Ref,
+		HeadRepo: event.PullRequest.Head.Repo.FullName,
+	}
+	if pr.Repo == "" || pr.Number == 0 || pr.HeadSHA == "" {
+		return PullRequest{}, false, fmt.Errorf("pull_request event lacks the repository, number or head commit")
+	}
+	return pr, true, nil
+}
+
+// LoadEvent reads a pull_request event from a file, such as GITHUB_EVENT_PATH
+// inside a workflow
+func LoadEvent(path string) (PullRequest, bool, error) {
+	payload, err := os.ReadFile(path)
+	if err != nil {
+		return PullRequest{}, false, fmt.Errorf("failed to read event: %w", err)
+	}
+	return ParseEvent(payload)
+}
+
+// Webhook receives pull_request events from GitHub and handles them one at a
+// time in the background, so deliveries are acknowledged within GitHub's timeout
+type Webhook struct {
+	Bot     *Bot
+	Secret  string        // Verifies X-Hub-Signature-256; required
+	Timeout time.Duration // Limit for handling one event
+
+	mu sync.Mutex // Serializes Handle so pushes to the same PR do not race
+	wg sync.WaitGroup
+}
+
+// ServeHTTP implements http.Handler
+func (wh *Webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadBytes))
+	if err != nil {
+		http.Error(w, "failed to read payload", http.StatusBadRequest)
+		return
+	}
+	if !validSignature(wh.Secret, payload, r.Header.Get("X-Hub-Signature-256")) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Header.Get("X-GitHub-Event") {
+	case "ping":
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case "pull_request":
+	default:
+		http.Error(w, "event ignored", http.StatusAccepted)
+		return
+	}
+
+	pr, ok, err := ParseEvent(payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !ok || strings.HasPrefix(pr.HeadRef, wh.Bot.BranchPrefix) {
+		http.Error(w, "action ignored", http.StatusAccepted)
+		return
+	}
+
+	wh.wg.Add(1)
+	go func() {
+		defer wh.wg.Done()
+		wh.mu.Lock()
+		defer wh.mu.Unlock()
+
+		ctx := context.Background()
+		if wh.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, wh.Timeout)
+			defer cancel()
+		}
+		result, err := wh.Bot.Handle(ctx, pr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s#%d: %v\n", pr.Repo, pr.Number, redact.String(err.Error()))
+			return
+		}
+		fmt.Printf("%s#%d: handled %d changed Go file(s) at %s\n", pr.Repo, pr.Number, len(result.Files), shortSHA(pr.HeadSHA))
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Wait blocks until the events received so far have been handled
+func (wh *Webhook) Wait() {
+	wh.wg.Wait()
+}
+
+// validSignature checks GitHub's "sha256=<hex HMAC of the payload>" signature
+func validSignature(secret string, payload []byte, signature string) bool {
+	if secret == "" {
+		return false
+	}
+	sum, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sum)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(got, mac.Sum(nil))
+}
@@ -0,0 +1,464 @@
+package preflight
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/redact"
+	"github.com/Hekzory/MetamorphLLM/internal/retry"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+// Status is the outcome of a single check
+type Status string
+
+const (
+	StatusOK   Status = "ok"
+	StatusWarn Status = "warn" // Work can start but may run into trouble
+	StatusFail Status = "fail" // Work would fail; do not start
+)
+
+// Check is the result of one preflight check
+type Check struct {
+	Name   string
+	Status Status
+	Detail string
+}
+
+// Passed reports whether none of the checks failed
+func Passed(checks []Check) bool {
+	for _, c := range checks {
+		if c.Status == StatusFail {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteReport prints the checks as a table
+func WriteReport(w io.Writer, checks []Check) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tDETAIL")
+	for _, c := range checks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Name, strings.ToUpper(string(c.Status)), c.Detail)
+	}
+	return tw.Flush()
+}
+
+// Checker validates the environment before expensive work starts
+type Checker struct {
+	Client        *http.Client
+	OpenRouterURL string // Base URL of the OpenRouter API
+	GeminiURL     string // Base URL of the Gemini API
+	AnthropicURL  string // Base URL of the Anthropic API
+	OllamaURL     string // Base URL of the local Ollama server
+	OpenAIURL     string // Base URL of the OpenAI-compatible server
+}
+
+// NewChecker creates a Checker talking to the public provider endpoints
+func NewChecker() *Checker {
+	return &Checker{
+		Client:        &http.Client{Timeout: 15 * time.Second},
+		OpenRouterURL: "https://openrouter.ai/api/v1",
+		GeminiURL:     "https://generativelanguage.googleapis.com/v1beta",
+		AnthropicURL:  rewriter.DefaultAnthropicURL + "/v1",
+		OllamaURL:     rewriter.OllamaHost(),
+		OpenAIURL:     rewriter.OpenAIBaseURL(),
+	}
+}
+
+// CheckProvider validates the API key and model availability for a provider
+// using free metadata endpoints, so no tokens are spent
+func (c *Checker) CheckProvider(api rewriter.APIType, model string) []Check {
+	switch api {
+	case rewriter.APITypeOpenRouter:
+		if model == "" {
+			model = rewriter.DefaultOpenRouterModel
+		}
+		return c.checkOpenRouter(model)
+	case rewriter.APITypeGemini:
+		if model == "" {
+			model = rewriter.DefaultGeminiModel
+		}
+		return c.checkGemini(model)
+	case rewriter.APITypeAnthropic:
+		if model == "" {
+			model = rewriter.DefaultAnthropicModel
+		}
+		return c.checkAnthropic(model)
+	case rewriter.APITypeOllama:
+		if model == "" {
+			model = rewriter.DefaultOllamaModel
+		}
+		return c.checkOllama(model)
+	case rewriter.APITypeOpenAICompatible:
+		if model == "" {
+			model = os.Getenv("OPENAI_MODEL")
+		}
+		return c.checkOpenAICompatible(model)
+	case rewriter.APITypeNone:
+		return []Check{{Name: "api none", Status: StatusOK, Detail: "deterministic transforms, no API key needed"}}
+	default:
+		if rewriter.IsRegisteredStrategy(string(api)) {
+			return []Check{{Name: "api " + string(api), Status: StatusOK, Detail: "registered strategy, not checked"}}
+		}
+		return []Check{{Name: "api", Status: StatusFail, Detail: fmt.Sprintf("unknown API %q", api)}}
+	}
+}
+
+// checkOpenRouter validates the key on the key info endpoint and looks the
+// model up in the public model list
+func (c *Checker) checkOpenRouter(model string) []Check {
+	key := Check{Name: "OPENROUTER_API_KEY"}
+	models := Check{Name: "model " + model}
+
+	apiKey, ok := os.LookupEnv("OPENROUTER_API_KEY")
+	if !ok || apiKey == "" {
+		key.Status, key.Detail = StatusFail, "environment variable not set"
+		models.Status, models.Detail = StatusWarn, "not checked without an API key"
+		return []Check{key, models}
+	}
+
+	// The key info endpoint rejects expired or revoked keys
+	var info struct {
+		Data struct {
+			Label      string   `json:"label"`
+			Limit      *float64 `json:"limit"`
+			Usage      float64  `json:"usage"`
+			IsFreeTier bool     `json:"is_free_tier"`
+		} `json:"data"`
+	}
+	if err := c.getJSON(c.OpenRouterURL+"/key", apiKey, &info); err != nil {
+		key.Status, key.Detail = StatusFail, err.Error()
+	} else if info.Data.Limit != nil && info.Data.Usage >= *info.Data.Limit {
+		key.Status, key.Detail = StatusFail, fmt.Sprintf("credit limit reached (%.2f of %.2f used)", info.Data.Usage, *info.Data.Limit)
+	} else {
+		key.Status, key.Detail = StatusOK, fmt.Sprintf("valid key %q", info.Data.Label)
+		if info.Data.IsFreeTier {
+			key.Detail += " (free tier)"
+		}
+	}
+
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := c.getJSON(c.OpenRouterURL+"/models", "", &list); err != nil {
+		models.Status, models.Detail = StatusWarn, fmt.Sprintf("could not list models: %v", err)
+		return []Check{key, models}
+	}
+	models.Status, models.Detail = StatusFail, "not offered by OpenRouter"
+	for _, m := range list.Data {
+		if m.ID == model {
+			models.Status, models.Detail = StatusOK, "available"
+			break
+		}
+	}
+	return []Check{key, models}
+}
+
+// checkGemini fetches the model's metadata, which fails with 404 for an
+// unknown model and with another status for an invalid key
+func (c *Checker) checkGemini(model string) []Check {
+	key := Check{Name: "GEMINI_API_KEY"}
+	models := Check{Name: "model " + model}
+
+	apiKey, ok := os.LookupEnv("GEMINI_API_KEY")
+	if !ok || apiKey == "" {
+		key.Status, key.Detail = StatusFail, "environment variable not set"
+		models.Status, models.Detail = StatusWarn, "not checked without an API key"
+		return []Check{key, models}
+	}
+
+	// Fetching the model's metadata validates the key and the model in one call
+	var info struct {
+		Name string `json:"name"`
+	}
+	endpoint := fmt.Sprintf("%s/models/%s?key=%s", c.GeminiURL, url.PathEscape(model), url.QueryEscape(apiKey))
+	err := c.getJSON(endpoint, "", &info)
+	switch {
+	case err == nil:
+		key.Status, key.Detail = StatusOK, "valid key"
+		models.Status, models.Detail = StatusOK, "available"
+	case isNotFound(err):
+		key.Status, key.Detail = StatusOK, "valid key"
+		models.Status, models.Detail = StatusFail, "not offered by Gemini"
+	default:
+		key.Status, key.Detail = StatusFail, err.Error()
+		models.Status, models.Detail = StatusWarn, "not checked"
+	}
+	return []Check{key, models}
+}
+
+// checkAnthropic fetches the model's metadata like checkGemini
+func (c *Checker) checkAnthropic(model string) []Check {
+	key := Check{Name: "ANTHROPIC_API_KEY"}
+	models := Check{Name: "model " + model}
+
+	apiKey, ok := os.LookupEnv("ANTHROPIC_API_KEY")
+	if !ok || apiKey == "" {
+		key.Status, key.Detail = StatusFail, "environment variable not set"
+		models.Status, models.Detail = StatusWarn, "not checked without an API key"
+		return []Check{key, models}
+	}
+
+	// Like on Gemini, the model's metadata validates the key and the model
+	var info struct {
+		ID string `json:"id"`
+	}
+	header := http.Header{"X-Api-Key": {apiKey}, "Anthropic-Version": {rewriter.AnthropicVersion}}
+	err := c.getJSONWithHeader(c.AnthropicURL+"/models/"+url.PathEscape(model), header, &info)
+	switch {
+	case err == nil:
+		key.Status, key.Detail = StatusOK, "valid key"
+		models.Status, models.Detail = StatusOK, "available"
+	case isNotFound(err):
+		key.Status, key.Detail = StatusOK, "valid key"
+		models.Status, models.Detail = StatusFail, "not offered by Anthropic"
+	default:
+		key.Status, key.Detail = StatusFail, err.Error()
+		models.Status, models.Detail = StatusWarn, "not checked"
+	}
+	return []Check{key, models}
+}
+
+// checkOllama checks that the local server runs and has pulled the model
+func (c *Checker) checkOllama(model string) []Check {
+	server := Check{Name: "ollama server"}
+	models := Check{Name: "model " + model}
+
+	// The server needs no key; listing the pulled models checks that it runs
+	var list struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := c.getJSON(c.OllamaURL+"/api/tags", "", &list); err != nil {
+		server.Status, server.Detail = StatusFail, fmt.Sprintf("%v (start it with 'ollama serve')", err)
+		models.Status, models.Detail = StatusWarn, "not checked"
+		return []Check{server, models}
+	}
+	server.Status, server.Detail = StatusOK, "reachable at "+c.OllamaURL
+
+	// Ollama tags a model pulled without a tag as latest
+	name := model
+	if !strings.Contains(name, ":") {
+		name += ":latest"
+	}
+	models.Status, models.Detail = StatusFail, fmt.Sprintf("not pulled (run 'ollama pull %s')", model)
+	for _, m := range list.Models {
+		if m.Name == name {
+			models.Status, models.Detail = StatusOK, "available"
+			break
+		}
+	}
+	return []Check{server, models}
+}
+
+// checkOpenAICompatible checks that the server runs and serves the model
+func (c *Checker) checkOpenAICompatible(model string) []Check {
+	server := Check{Name: "openai-compatible server"}
+	models := Check{Name: "model " + model}
+	if model == "" {
+		models.Name = "model"
+	}
+
+	// The key is optional; listing the served models checks that the server runs
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := c.getJSON(c.OpenAIURL+"/models", os.Getenv(rewriter.DefaultOpenAIKeyEnv), &list); err != nil {
+		server.Status, server.Detail = StatusFail, fmt.Sprintf("%v (start it or set OPENAI_BASE_URL)", err)
+		models.Status, models.Detail = StatusWarn, "not checked"
+		return []Check{server, models}
+	}
+	server.Status, server.Detail = StatusOK, "reachable at "+c.OpenAIURL
+
+	if model == "" {
+		models.Status, models.Detail = StatusFail, "no model given; set OPENAI_MODEL or pass -model"
+		return []Check{server, models}
+	}
+	models.Status, models.Detail = StatusFail, "not served"
+	for _, m := range list.Data {
+		if m.ID == model {
+			models.Status, models.Detail = StatusOK, "available"
+			break
+		}
+	}
+	return []Check{server, models}
+}
+
+// statusError is a response of a metadata endpoint with a status other than 200
+type statusError struct {
+	StatusCode int
+	Body       string // Redacted
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+// HTTPStatus implements retry.StatusError
+func (e *statusError) HTTPStatus() int {
+	return e.StatusCode
+}
+
+// isNotFound reports whether err is a 404 response
+func isNotFound(err error) bool {
+	var se retry.StatusError
+	return errors.As(err, &se) && se.HTTPStatus() == http.StatusNotFound
+}
+
+// getJSON fetches url and decodes the JSON response into v
+func (c *Checker) getJSON(endpoint, bearer string, v any) error {
+	header := make(http.Header)
+	if bearer != "" {
+		header.Set("Authorization", "Bearer "+bearer)
+	}
+	return c.getJSONWithHeader(endpoint, header, v)
+}
+
+// getJSONWithHeader fetches url with the given request headers and decodes
+// the JSON response into v
+func (c *Checker) getJSONWithHeader(endpoint string, header http.Header, v any) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		// Never echo the URL: Gemini carries the key in the query string
+		if ue, ok := err.(*url.Error); ok {
+			err = ue.Err
+		}
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		// Error bodies can echo the credentials that were sent
+		return &statusError{StatusCode: resp.StatusCode, Body: redact.String(strings.TrimSpace(string(body)))}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// CheckGoToolchain verifies that the go command is available and at least as new
+// as the version required by goModPath (skipped if the file does not exist)
+func CheckGoToolchain(goModPath string) Check {
+	check := Check{Name: "go toolchain"}
+
+	out, err := exec.Command("go", "env", "GOVERSION").Output()
+	if err != nil {
+		check.Status, check.Detail = StatusFail, fmt.Sprintf("go command not available: %v", err)
+		return check
+	}
+	installed := strings.TrimPrefix(strings.TrimSpace(string(out)), "go")
+
+	required := requiredGoVersion(goModPath)
+	if required != "" && compareVersions(installed, required) < 0 {
+		check.Status, check.Detail = StatusFail, fmt.Sprintf("go %s installed, %s requires go %s", installed, goModPath, required)
+		return check
+	}
+	check.Status, check.Detail = StatusOK, "go "+installed
+	return check
+}
+
+// requiredGoVersion returns the version in the go directive of a go.mod file
+func requiredGoVersion(goModPath string) string {
+	data, err := os.ReadFile(goModPath)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "go" {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// compareVersions compares dotted version numbers such as 1.24.2, ignoring
+// pre-release suffixes; it returns -1, 0 or 1
+func compareVersions(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		va, vb := versionPart(pa, i), versionPart(pb, i)
+		if va != vb {
+			if va < vb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionPart(parts []string, i int) int {
+	if i >= len(parts) {
+		return 0
+	}
+	digits := parts[i]
+	if end := strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' }); end >= 0 {
+		digits = digits[:end]
+	}
+	n, _ := strconv.Atoi(digits)
+	return n
+}
+
+// CheckWritable verifies that files can be created in dir, or in its nearest
+// existing parent if dir does not exist yet
+func CheckWritable(dir string) Check {
+	check := Check{Name: "write " + dir}
+
+	target := dir
+	for {
+		if info, err := os.Stat(target); err == nil {
+			if !info.IsDir() {
+				check.Status, check.Detail = StatusFail, target+" is not a directory"
+				return check
+			}
+			break
+		}
+		parent := filepath.Dir(target)
+		if parent == target {
+			break
+		}
+		target = parent
+	}
+
+	f, err := os.CreateTemp(target, ".metamorph-preflight-*")
+	if err != nil {
+		check.Status, check.Detail = StatusFail, fmt.Sprintf("cannot create files in %s: %v", target, err)
+		return check
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	check.Status, check.Detail = StatusOK, "writable"
+	if target != dir {
+		check.Detail = fmt.Sprintf("will be created in %s", target)
+	}
+	return check
+}
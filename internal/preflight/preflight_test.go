@@ -0,0 +1,212 @@
+package preflight
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+func TestCheckOpenRouter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/key":
+			if r.Header.Get("Authorization") != "Bearer good" {
+				http.Error(w, `{"error":"invalid key"}`, http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"data":{"label":"test","usage":1,"limit":10}}`))
+		case "/models":
+			w.Write([]byte(`{"data":[{"id":"vendor/model"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	c := NewChecker()
+	c.OpenRouterURL = server.URL
+
+	t.Setenv("OPENROUTER_API_KEY", "good")
+	checks := c.CheckProvider(rewriter.APITypeOpenRouter, "vendor/model")
+	if !Passed(checks) || checks[0].Status != StatusOK || checks[1].Status != StatusOK {
+		t.Errorf("Expected a valid key and model, got %+v", checks)
+	}
+
+	checks = c.CheckProvider(rewriter.APITypeOpenRouter, "vendor/missing")
+	if checks[1].Status != StatusFail {
+		t.Errorf("Expected an unknown model to fail, got %+v", checks[1])
+	}
+
+	t.Setenv("OPENROUTER_API_KEY", "expired")
+	checks = c.CheckProvider(rewriter.APITypeOpenRouter, "vendor/model")
+	if checks[0].Status != StatusFail || !strings.Contains(checks[0].Detail, "401") {
+		t.Errorf("Expected a rejected key to fail, got %+v", checks[0])
+	}
+
+	t.Setenv("OPENROUTER_API_KEY", "")
+	if checks := c.CheckProvider(rewriter.APITypeOpenRouter, ""); Passed(checks) {
+		t.Error("Expected a missing key to fail")
+	}
+}
+
+func TestCheckGemini(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Query().Get("key") != "good":
+			http.Error(w, "API key not valid", http.StatusBadRequest)
+		case r.URL.Path == "/models/gemini-broken":
+			// Only the status tells a missing model apart
+			http.Error(w, "upstream said HTTP 404", http.StatusInternalServerError)
+		case r.URL.Path == "/models/gemini-test":
+			w.Write([]byte(`{"name":"models/gemini-test"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := NewChecker()
+	c.GeminiURL = server.URL
+
+	t.Setenv("GEMINI_API_KEY", "good")
+	if checks := c.CheckProvider(rewriter.APITypeGemini, "gemini-test"); !Passed(checks) {
+		t.Errorf("Expected a valid key and model, got %+v", checks)
+	}
+	if checks := c.CheckProvider(rewriter.APITypeGemini, "gemini-missing"); checks[0].Status != StatusOK || checks[1].Status != StatusFail {
+		t.Errorf("Expected the key to pass and the model to fail, got %+v", checks)
+	}
+	if checks := c.CheckProvider(rewriter.APITypeGemini, "gemini-broken"); checks[0].Status != StatusFail || checks[1].Status != StatusWarn {
+		t.Errorf("Expected a server error to fail the key check, got %+v", checks)
+	}
+
+	t.Setenv("GEMINI_API_KEY", "bad")
+	checks := c.CheckProvider(rewriter.APITypeGemini, "gemini-test")
+	if checks[0].Status != StatusFail || strings.Contains(checks[0].Detail, "bad") {
+		t.Errorf("Expected a rejected key to fail without leaking it, got %+v", checks[0])
+	}
+}
+
+func TestCheckAnthropic(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get("X-Api-Key") != "good-anthropic-key" || r.Header.Get("Anthropic-Version") == "":
+			http.Error(w, `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`, http.StatusUnauthorized)
+		case r.URL.Path == "/models/claude-test":
+			w.Write([]byte(`{"id":"claude-test","type":"model"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := NewChecker()
+	c.AnthropicURL = server.URL
+
+	t.Setenv("ANTHROPIC_API_KEY", "good-anthropic-key")
+	if checks := c.CheckProvider(rewriter.APITypeAnthropic, "claude-test"); !Passed(checks) {
+		t.Errorf("Expected a valid key and model, got %+v", checks)
+	}
+	if checks := c.CheckProvider(rewriter.APITypeAnthropic, "claude-missing"); checks[0].Status != StatusOK || checks[1].Status != StatusFail {
+		t.Errorf("Expected the key to pass and the model to fail, got %+v", checks)
+	}
+
+	t.Setenv("ANTHROPIC_API_KEY", "bad-anthropic-key")
+	if checks := c.CheckProvider(rewriter.APITypeAnthropic, "claude-test"); checks[0].Status != StatusFail {
+		t.Errorf("Expected a rejected key to fail, got %+v", checks[0])
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+
+	if c := CheckWritable(dir); c.Status != StatusOK {
+		t.Errorf("Expected temp dir to be writable, got %+v", c)
+	}
+	if c := CheckWritable(filepath.Join(dir, "new", "nested")); c.Status != StatusOK || !strings.Contains(c.Detail, "will be created") {
+		t.Errorf("Expected a missing dir to be checked via its parent, got %+v", c)
+	}
+
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if c := CheckWritable(file); c.Status != StatusFail {
+		t.Errorf("Expected a file path to fail, got %+v", c)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.24.2", "1.24.2", 0},
+		{"1.24", "1.24.0", 0},
+		{"1.23.8", "1.24.2", -1},
+		{"1.25rc1", "1.24.2", 1},
+		{"1.24.10", "1.24.9", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCheckOllama(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tags" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"models":[{"name":"qwen2.5-coder:7b"},{"name":"llama3:latest"}]}`))
+	}))
+
+	c := NewChecker()
+	c.OllamaURL = server.URL
+	if checks := c.CheckProvider(rewriter.APITypeOllama, ""); !Passed(checks) {
+		t.Errorf("Expected the default model to be available, got %+v", checks)
+	}
+	if checks := c.CheckProvider(rewriter.APITypeOllama, "llama3"); !Passed(checks) {
+		t.Errorf("Expected an untagged model to match its latest tag, got %+v", checks)
+	}
+	if checks := c.CheckProvider(rewriter.APITypeOllama, "mistral"); checks[0].Status != StatusOK || !strings.Contains(checks[1].Detail, "ollama pull mistral") {
+		t.Errorf("Expected a missing model to fail with a pull hint, got %+v", checks)
+	}
+
+	server.Close()
+	if checks := c.CheckProvider(rewriter.APITypeOllama, ""); checks[0].Status != StatusFail || !strings.Contains(checks[0].Detail, "ollama serve") {
+		t.Errorf("Expected an unreachable server to fail, got %+v", checks)
+	}
+}
+
+func TestCheckOpenAICompatible(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"object":"list","data":[{"id":"qwen2.5-coder-32b","object":"model"}]}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("OPENAI_MODEL", "")
+	c := NewChecker()
+	c.OpenAIURL = server.URL + "/v1"
+	if checks := c.CheckProvider(rewriter.APITypeOpenAICompatible, "qwen2.5-coder-32b"); !Passed(checks) {
+		t.Errorf("Expected the served model to be available, got %+v", checks)
+	}
+	if checks := c.CheckProvider(rewriter.APITypeOpenAICompatible, "gpt-4o"); checks[0].Status != StatusOK || checks[1].Status != StatusFail {
+		t.Errorf("Expected a model the server does not serve to fail, got %+v", checks)
+	}
+	if checks := c.CheckProvider(rewriter.APITypeOpenAICompatible, ""); checks[1].Status != StatusFail || !strings.Contains(checks[1].Detail, "OPENAI_MODEL") {
+		t.Errorf("Expected a missing model to fail, got %+v", checks)
+	}
+	t.Setenv("OPENAI_MODEL", "qwen2.5-coder-32b")
+	if checks := c.CheckProvider(rewriter.APITypeOpenAICompatible, ""); !Passed(checks) {
+		t.Errorf("Expected the model to default to OPENAI_MODEL, got %+v", checks)
+	}
+}
@@ -0,0 +1,214 @@
+// Package prompts renders the prompts sent to LLMs from text/template
+// templates. A Library holds templates keyed by technique and variant, so a
+// technique can have a prompt of its own and a variant, such as a prompt in
+// another language, can be selected at run time. The built-in library has a
+// single template for every technique, the prompt the rewriter always used.
+package prompts
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var builtinFS embed.FS
+
+// Extension is the file extension of template files
+const Extension = ".tmpl"
+
+// DefaultName is the file name of the template used for every technique and
+// variant without a template of its own
+const DefaultName = "default"
+
+// Technique describes a selected technique to templates
+type Technique struct {
+	Key          string // As passed to -technique, e.g. "dead-code"
+	Name         string // As the prompt names it, e.g. "Dead Code Insertion"
+	Instructions string // What the model is asked to do
+}
+
+// Data holds the variables available to templates
+type Data struct {
+	Function   string      // Source of the function to rewrite
+	Imports    []string    // Packages the rewrite may use
+	Techniques []Technique // The selected techniques, in order
+	// Instructions describes the selected techniques as the built-in prompt does
+	Instructions string
+	// TechniqueList names the selected techniques as a phrase, e.g.
+	// "Dead Code Insertion and Opaque Predicates"
+	TechniqueList string
+	// Constraints are further requirements, such as a limit on inserted statements
+	Constraints []string
+	// Examples is the example section, built-in or from an example bank
+	Examples string
+}
+
+// Key selects a template. Empty fields match any technique or variant.
+type Key struct {
+	Technique string
+	Variant   string
+}
+
+// String is the file name of the template without its extension, e.g.
+// "dead-code.concise", "dead-code", "default.concise" or "default"
+func (k Key) String() string {
+	name := k.Technique
+	if name == "" {
+		name = DefaultName
+	}
+	if k.Variant != "" {
+		name += "." + k.Variant
+	}
+	return name
+}
+
+// parseKey is the reverse of Key.String
+func parseKey(name string) Key {
+	technique, variant, _ := strings.Cut(name, ".")
+	if technique == DefaultName {
+		technique = ""
+	}
+	return Key{Technique: technique, Variant: variant}
+}
+
+// Library holds prompt templates keyed by technique and variant
+type Library struct {
+	templates map[Key]*template.Template
+}
+
+// Builtin returns the library of the templates shipped with the rewriter
+func Builtin() *Library {
+	lib, err := loadFS(builtinFS, "templates")
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in prompt template: %v", err))
+	}
+	return lib
+}
+
+// Load reads templates from a file or a directory. A file becomes the
+// default template. In a directory, every file named after its key (see
+// Key.String) with the .tmpl extension is loaded. Templates missing from the
+// directory fall back to the built-in ones.
+func Load(name string) (*Library, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt templates: %w", err)
+	}
+	lib := Builtin()
+	if !info.IsDir() {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt template: %w", err)
+		}
+		if err := lib.Add(Key{}, string(content)); err != nil {
+			return nil, err
+		}
+		return lib, nil
+	}
+	custom, err := loadFS(os.DirFS(name), ".")
+	if err != nil {
+		return nil, err
+	}
+	if len(custom.templates) == 0 {
+		return nil, fmt.Errorf("no %s files in %s", Extension, name)
+	}
+	for key, tmpl := range custom.templates {
+		lib.templates[key] = tmpl
+	}
+	return lib, nil
+}
+
+// loadFS parses the template files in dir of fsys
+func loadFS(fsys fs.FS, dir string) (*Library, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt templates: %w", err)
+	}
+	lib := &Library{templates: make(map[Key]*template.Template)}
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != Extension {
+			continue
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt template: %w", err)
+		}
+		if err := lib.Add(parseKey(strings.TrimSuffix(entry.Name(), Extension)), string(content)); err != nil {
+			return nil, err
+		}
+	}
+	return lib, nil
+}
+
+// Add parses a template and stores it under key. A final newline is dropped,
+// so template files can end with one. The template is rendered with sample
+// data to catch references to variables that do not exist.
+func (l *Library) Add(key Key, text string) error {
+	tmpl, err := template.New(key.String()).Parse(strings.TrimSuffix(text, "\n"))
+	if err != nil {
+		return fmt.Errorf("failed to parse prompt template %s: %w", key, err)
+	}
+	sample := Data{
+		Function:      "func f() {}",
+		Imports:       []string{"fmt"},
+		Techniques:    []Technique{{Key: "dead-code", Name: "Dead Code Insertion", Instructions: "Add dead code."}},
+		Instructions:  "Add dead code.",
+		TechniqueList: "Dead Code Insertion",
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, sample); err != nil {
+		return fmt.Errorf("invalid prompt template %s: %w", key, err)
+	}
+	if l.templates == nil {
+		l.templates = make(map[Key]*template.Template)
+	}
+	l.templates[key] = tmpl
+	return nil
+}
+
+// Lookup returns the most specific template for a technique and variant: the
+// technique's template of the variant, the default template of the variant,
+// the technique's template, then the default template. An empty technique
+// skips the technique's templates.
+func (l *Library) Lookup(technique, variant string) (*template.Template, bool) {
+	for _, key := range []Key{{technique, variant}, {"", variant}, {technique, ""}, {"", ""}} {
+		if tmpl, ok := l.templates[key]; ok {
+			return tmpl, true
+		}
+	}
+	return nil, false
+}
+
+// Keys returns the keys of the templates in the library, sorted by name
+func (l *Library) Keys() []Key {
+	keys := make([]Key, 0, len(l.templates))
+	for key := range l.templates {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b Key) int { return strings.Compare(a.String(), b.String()) })
+	return keys
+}
+
+// Render renders the template selected by Lookup. With several techniques,
+// only the templates for every technique apply.
+func (l *Library) Render(variant string, data Data) (string, error) {
+	technique := ""
+	if len(data.Techniques) == 1 {
+		technique = data.Techniques[0].Key
+	}
+	tmpl, ok := l.Lookup(technique, variant)
+	if !ok {
+		return "", fmt.Errorf("no prompt template for %s", Key{technique, variant})
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template %s: %w", tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,95 @@
+package prompts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var data = Data{
+	Function:      "func add(a, b int) int {\n\treturn a + b\n}",
+	Imports:       []string{"fmt", "strings"},
+	Techniques:    []Technique{{Key: "dead-code", Name: "Dead Code Insertion", Instructions: "Add dead code."}},
+	Instructions:  "Rewrite the function below using **only the Dead Code Insertion technique**. Add dead code.",
+	TechniqueList: "Dead Code Insertion",
+	Constraints:   []string{"MINIMAL CHANGE: insert at most 2 dead code statements."},
+	Examples:      "Example of the transformation:",
+}
+
+func TestBuiltin(t *testing.T) {
+	prompt, err := Builtin().Render("", data)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	for _, want := range []string{
+		"technique**. Add dead code.\n\nMINIMAL CHANGE: insert at most 2 dead code statements.\n\nCRITICAL REQUIREMENTS:",
+		"NO OTHER LIBRARIES ARE ALLOWED:\n    *   \"fmt\"\n    *   \"strings\"\n\nExample of the transformation:\n\n",
+		"using only Dead Code Insertion:\n\nfunc add(a, b int) int {\n\treturn a + b\n}\n\nReturn **only**",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Expected the prompt to contain %q, got:\n%s", want, prompt)
+		}
+	}
+	if strings.HasSuffix(prompt, "\n") {
+		t.Error("Expected the final newline of the template file to be dropped")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"default.tmpl":         "generic {{.TechniqueList}}\n",
+		"dead-code.tmpl":       "dead code {{.Function}}\n",
+		"dead-code.terse.tmpl": "terse {{range .Techniques}}{{.Key}}{{end}}\n",
+		"default.terse.tmpl":   "terse generic\n",
+		"notes.txt":            "ignored",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lib, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	several := data
+	several.Techniques = append(several.Techniques, Technique{Key: "opaque-predicates"})
+	for _, tc := range []struct {
+		variant string
+		data    Data
+		want    string
+	}{
+		{"", data, "dead code func add"},
+		{"terse", data, "terse dead-code"},
+		{"terse", several, "terse generic"},
+		{"", several, "generic Dead Code Insertion"},
+		{"unknown", data, "dead code func add"},
+	} {
+		got, err := lib.Render(tc.variant, tc.data)
+		if err != nil || !strings.HasPrefix(got, tc.want) {
+			t.Errorf("Render(%q) with %d techniques = %q, %v; expected %q", tc.variant, len(tc.data.Techniques), got, err, tc.want)
+		}
+	}
+
+	// A single file replaces the default template
+	file := filepath.Join(dir, "dead-code.tmpl")
+	if lib, err = Load(file); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got, _ := lib.Render("", several); !strings.HasPrefix(got, "dead code func add") {
+		t.Errorf("Expected the file to be the default template, got %q", got)
+	}
+
+	if err := os.WriteFile(file, []byte("{{.Source}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), "dead-code") {
+		t.Errorf("Expected an unknown variable to be reported, got %v", err)
+	}
+	if _, err := Load(t.TempDir()); err == nil {
+		t.Error("Expected a directory without templates to be rejected")
+	}
+}
@@ -0,0 +1,97 @@
+package redact
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Mask replaces every redacted value
+const Mask = "[REDACTED]"
+
+// sensitiveMarkers identify environment variables that hold credentials
+var sensitiveMarkers = []string{"KEY", "TOKEN", "SECRET", "PASSWORD", "CREDENTIAL"}
+
+// IsSensitiveName reports whether an environment variable name looks like it
+// holds a credential, such as OPENROUTER_API_KEY
+func IsSensitiveName(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, marker := range sensitiveMarkers {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// patterns match credentials in free text. Where there is a submatch, only the
+// submatch is masked, so the header or parameter name stays readable.
+var patterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\bauthorization\s*[:=]\s*"?(?:bearer|basic|token)?\s*([^\s",]+)`),
+	regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/=-]{8,})`),
+	regexp.MustCompile(`(?i)\b(?:x-goog-api-key|x-api-key|api[_-]?key)"?\s*[:=]\s*"?([^\s"'&,;]+)`),
+	regexp.MustCompile(`(?i)[?&](?:key|api_key|access_token|token)=([^&\s"']+)`),
+	regexp.MustCompile(`\b(sk-or-v1-[0-9a-f]{16,}|sk-(?:proj-)?[A-Za-z0-9_-]{20,})`),
+	regexp.MustCompile(`\b(AIza[0-9A-Za-z_-]{35})`),
+	regexp.MustCompile(`\b((?:ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36}|github_pat_[A-Za-z0-9_]{22,})\b`),
+	regexp.MustCompile(`\b((?:AKIA|ASIA)[0-9A-Z]{16})\b`),
+	regexp.MustCompile(`\b(xox[abprs]-[A-Za-z0-9-]{10,})`),
+}
+
+// minSecretLength keeps short values such as "1" or "true" in sensitive
+// variables from being masked all over the output
+const minSecretLength = 8
+
+// envSecrets returns the values of sensitive environment variables, longest
+// first so a value containing another is masked whole
+func envSecrets() []string {
+	var secrets []string
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if IsSensitiveName(name) && len(value) >= minSecretLength {
+			secrets = append(secrets, value)
+		}
+	}
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	return secrets
+}
+
+// String masks credentials in s: the values of sensitive environment
+// variables wherever they appear, auth headers and key parameters, and
+// strings shaped like provider keys
+func String(s string) string {
+	for _, secret := range envSecrets() {
+		s = strings.ReplaceAll(s, secret, Mask)
+	}
+	for _, re := range patterns {
+		s = re.ReplaceAllStringFunc(s, func(match string) string {
+			sub := re.FindStringSubmatch(match)
+			if len(sub) < 2 || sub[1] == "" || sub[1] == Mask {
+				return match
+			}
+			return strings.Replace(match, sub[1], Mask, 1)
+		})
+	}
+	return s
+}
+
+// redactedError masks its message but keeps the wrapped error for errors.Is and errors.As
+type redactedError struct {
+	err error
+}
+
+func (e *redactedError) Error() string { return String(e.err.Error()) }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// Error wraps err so its message is redacted wherever it is printed. It
+// returns nil for a nil err.
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*redactedError); ok {
+		return err
+	}
+	return &redactedError{err: err}
+}
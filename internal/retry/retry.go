@@ -0,0 +1,250 @@
+// Package retry retries failed calls to LLM providers. Errors are classified
+// by type rather than by their message: rate limits and transient failures
+// are retried with exponential backoff and jitter, at least as long as the
+// server asked in Retry-After, and anything else fails at once.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Class is how a failed call is retried
+type Class int
+
+const (
+	// Permanent failures are not retried, e.g. invalid requests or credentials
+	Permanent Class = iota
+	// RateLimit failures are retried once the provider accepts calls again
+	RateLimit
+	// Transient failures are retried, e.g. an overloaded server or a dropped connection
+	Transient
+)
+
+// String is the name of the class, as used in metrics
+func (c Class) String() string {
+	switch c {
+	case RateLimit:
+		return "rate_limited"
+	case Transient:
+		return "transient"
+	default:
+		return "permanent"
+	}
+}
+
+// Retryable reports whether failures of the class are retried
+func (c Class) Retryable() bool {
+	return c == RateLimit || c == Transient
+}
+
+// StatusError is implemented by errors of failed HTTP requests
+type StatusError interface {
+	error
+	HTTPStatus() int
+}
+
+// DelayError is implemented by errors that carry how long the server asked
+// to wait before the next request
+type DelayError interface {
+	error
+	RetryDelay() time.Duration
+}
+
+// ClassifyStatus classifies a failed HTTP request by its status code
+func ClassifyStatus(code int) Class {
+	switch code {
+	case http.StatusTooManyRequests:
+		return RateLimit
+	case http.StatusRequestTimeout, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout, 529: // 529: Anthropic is overloaded
+		return Transient
+	default:
+		return Permanent
+	}
+}
+
+// Classify classifies an error by its type: HTTP and gRPC status codes, and
+// network errors. Canceled calls and unknown errors are permanent.
+func Classify(err error) Class {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return Permanent
+	}
+	var se StatusError
+	if errors.As(err, &se) {
+		return ClassifyStatus(se.HTTPStatus())
+	}
+	// Errors of Google's REST clients
+	var hc interface{ HTTPCode() int }
+	if errors.As(err, &hc) && hc.HTTPCode() > 0 {
+		return ClassifyStatus(hc.HTTPCode())
+	}
+	var gs interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &gs) {
+		switch gs.GRPCStatus().Code() {
+		case codes.ResourceExhausted:
+			return RateLimit
+		case codes.Unavailable, codes.Aborted:
+			return Transient
+		}
+		return Permanent
+	}
+	// A server that is not running stays down; one that dropped the
+	// connection may answer the next request
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return Permanent
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return Transient
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return Transient
+	}
+	return Permanent
+}
+
+// ParseRetryAfter parses a Retry-After header, in seconds or as an HTTP date.
+// It returns 0 for an absent or invalid header.
+func ParseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
+
+// Default values of a Policy
+const (
+	DefaultMaxAttempts = 5
+	DefaultBaseDelay   = time.Second
+	DefaultMaxDelay    = 60 * time.Second
+)
+
+// Policy is how a call is retried. The zero value retries with the defaults.
+type Policy struct {
+	MaxAttempts int           // Calls including the first; 0 uses DefaultMaxAttempts
+	BaseDelay   time.Duration // Backoff before the first retry, doubled for every later one; 0 uses DefaultBaseDelay
+	MaxDelay    time.Duration // Cap of a backoff before jitter; 0 uses DefaultMaxDelay
+	// Classify decides which failures are retried; nil uses Classify
+	Classify func(error) Class
+	// Wait waits before a retry; nil sleeps until ctx is done
+	Wait func(ctx context.Context, d time.Duration) error
+	// OnRetry, when set, is called before every retry
+	OnRetry func(attempt int, class Class, wait time.Duration, err error)
+	// rand returns a number in [0, 1); tests replace it
+	rand func() float64
+}
+
+// Attempts returns the maximum number of calls
+func (p Policy) Attempts() int {
+	if p.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+	return p.MaxAttempts
+}
+
+// Backoff returns the wait before retry number attempt (1 for the first):
+// the base delay doubled for every earlier retry, capped at MaxDelay, of
+// which a random half is dropped so that callers failing together do not
+// retry together
+func (p Policy) Backoff(attempt int) time.Duration {
+	base, maxDelay := p.BaseDelay, p.MaxDelay
+	if base <= 0 {
+		base = DefaultBaseDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxDelay
+	}
+	d := maxDelay
+	if shift := attempt - 1; shift < 32 && base<<shift < maxDelay {
+		d = base << shift
+	}
+	random := p.rand
+	if random == nil {
+		random = rand.Float64
+	}
+	return d/2 + time.Duration(random()*float64(d/2))
+}
+
+// ExhaustedError is returned by Do when the last attempt failed with a
+// retryable error
+type ExhaustedError struct {
+	Attempts int
+	Class    Class
+	Err      error // Error of the last attempt
+}
+
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("still failing (%s) after %d attempts: %v", e.Class, e.Attempts, e.Err)
+}
+
+func (e *ExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+// Do calls call until it succeeds, fails with an error that is not
+// retryable, or the attempts are used up. A permanent error is returned as
+// is and a retryable one as an ExhaustedError.
+func (p Policy) Do(ctx context.Context, call func(ctx context.Context) error) error {
+	classify, wait := p.Classify, p.Wait
+	if classify == nil {
+		classify = Classify
+	}
+	if wait == nil {
+		wait = sleep
+	}
+	attempts := p.Attempts()
+	for attempt := 1; ; attempt++ {
+		err := call(ctx)
+		if err == nil {
+			return nil
+		}
+		class := classify(err)
+		if !class.Retryable() || ctx.Err() != nil {
+			return err
+		}
+		if attempt >= attempts {
+			return &ExhaustedError{Attempts: attempts, Class: class, Err: err}
+		}
+		d := p.Backoff(attempt)
+		var de DelayError
+		if errors.As(err, &de) {
+			d = max(d, de.RetryDelay())
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, class, d, err)
+		}
+		if err := wait(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,148 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// httpError is a failed HTTP request, as provider clients report them
+type httpError struct {
+	code  int
+	delay time.Duration
+}
+
+func (e *httpError) Error() string             { return fmt.Sprintf("HTTP %d", e.code) }
+func (e *httpError) HTTPStatus() int           { return e.code }
+func (e *httpError) RetryDelay() time.Duration { return e.delay }
+
+// TestClassify tests that errors are classified by their type
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want Class
+	}{
+		{"rate limit", &httpError{code: http.StatusTooManyRequests}, RateLimit},
+		{"wrapped rate limit", fmt.Errorf("request failed: %w", &httpError{code: http.StatusTooManyRequests}), RateLimit},
+		{"overloaded", &httpError{code: 529}, Transient},
+		{"unavailable", &httpError{code: http.StatusServiceUnavailable}, Transient},
+		{"unauthorized", &httpError{code: http.StatusUnauthorized}, Permanent},
+		{"gRPC quota", status.Error(codes.ResourceExhausted, "quota"), RateLimit},
+		{"gRPC unavailable", status.Error(codes.Unavailable, "down"), Transient},
+		{"gRPC invalid", status.Error(codes.InvalidArgument, "bad"), Permanent},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), Transient},
+		{"truncated response", io.ErrUnexpectedEOF, Transient},
+		{"no server", fmt.Errorf("dial: %w", syscall.ECONNREFUSED), Permanent},
+		{"canceled", context.Canceled, Permanent},
+		// Messages are not parsed
+		{"message only", errors.New("429 Too Many Requests"), Permanent},
+	}
+	for _, c := range cases {
+		if got := Classify(c.err); got != c.want {
+			t.Errorf("%s: expected %s, got %s", c.name, c.want, got)
+		}
+	}
+}
+
+// TestParseRetryAfter tests Retry-After headers in seconds and as dates
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cases := map[string]time.Duration{
+		"":                              0,
+		"7":                             7 * time.Second,
+		"-3":                            0,
+		"soon":                          0,
+		"Wed, 01 Jan 2025 12:00:30 GMT": 30 * time.Second,
+		"Wed, 01 Jan 2025 11:00:00 GMT": 0,
+	}
+	for header, want := range cases {
+		if got := ParseRetryAfter(header, now); got != want {
+			t.Errorf("ParseRetryAfter(%q): expected %v, got %v", header, want, got)
+		}
+	}
+}
+
+// TestBackoff tests that backoffs double up to the cap with at most half
+// dropped as jitter
+func TestBackoff(t *testing.T) {
+	p := Policy{BaseDelay: time.Second, MaxDelay: 10 * time.Second, rand: func() float64 { return 0 }}
+	for attempt, want := range map[int]time.Duration{1: 500 * time.Millisecond, 2: time.Second, 4: 4 * time.Second, 5: 5 * time.Second, 100: 5 * time.Second} {
+		if got := p.Backoff(attempt); got != want {
+			t.Errorf("Backoff(%d) without jitter: expected %v, got %v", attempt, want, got)
+		}
+	}
+	p.rand = nil
+	for i := 0; i < 100; i++ {
+		if d := p.Backoff(3); d < 2*time.Second || d > 4*time.Second {
+			t.Fatalf("Expected a backoff between 2s and 4s, got %v", d)
+		}
+	}
+}
+
+// TestDo tests that retryable failures are retried with the server's delay
+// and that permanent failures and used up attempts end the calls
+func TestDo(t *testing.T) {
+	var waits []time.Duration
+	var retries []Class
+	p := Policy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		Wait: func(_ context.Context, d time.Duration) error {
+			waits = append(waits, d)
+			return nil
+		},
+		OnRetry: func(_ int, class Class, _ time.Duration, _ error) { retries = append(retries, class) },
+	}
+
+	errs := []error{&httpError{code: http.StatusTooManyRequests, delay: time.Minute}, &httpError{code: http.StatusServiceUnavailable}}
+	calls := 0
+	err := p.Do(context.Background(), func(context.Context) error {
+		calls++
+		if calls <= len(errs) {
+			return errs[calls-1]
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("Expected success on the third call, got %v after %d calls", err, calls)
+	}
+	if len(waits) != 2 || waits[0] != time.Minute || waits[1] > 2*time.Millisecond {
+		t.Errorf("Expected to wait as long as Retry-After, then the backoff, got %v", waits)
+	}
+	if len(retries) != 2 || retries[0] != RateLimit || retries[1] != Transient {
+		t.Errorf("Expected a rate limit and a transient retry, got %v", retries)
+	}
+
+	calls, waits = 0, nil
+	err = p.Do(context.Background(), func(context.Context) error {
+		calls++
+		return &httpError{code: http.StatusTooManyRequests}
+	})
+	var exhausted *ExhaustedError
+	if !errors.As(err, &exhausted) || exhausted.Attempts != 3 || exhausted.Class != RateLimit || calls != 3 || len(waits) != 2 {
+		t.Errorf("Expected an ExhaustedError after 3 calls and 2 waits, got %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	permanent := &httpError{code: http.StatusBadRequest}
+	if err := p.Do(context.Background(), func(context.Context) error { calls++; return permanent }); err != permanent || calls != 1 {
+		t.Errorf("Expected a permanent error to be returned at once, got %v after %d calls", err, calls)
+	}
+
+	// A canceled call is not retried, however long the backoff
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	overloaded := &httpError{code: 529}
+	if err := (Policy{BaseDelay: time.Hour}).Do(ctx, func(context.Context) error { return overloaded }); err != overloaded {
+		t.Errorf("Expected the error of the canceled call, got %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+package rewriter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/redact"
+	"github.com/Hekzory/MetamorphLLM/internal/retry"
+)
+
+const (
+	// DefaultAnthropicURL is the base URL of the Anthropic API
+	DefaultAnthropicURL = "https://api.anthropic.com"
+	// AnthropicVersion is the API version sent with every request
+	AnthropicVersion = "2023-06-01"
+)
+
+// anthropicThinkingBudgets maps reasoning efforts to extended thinking
+// budgets in tokens. "none" disables thinking, like an empty effort.
+var anthropicThinkingBudgets = map[string]int{
+	"minimal": 1024,
+	"low":     2048,
+	"medium":  8192,
+	"high":    16384,
+	"xhigh":   32000,
+}
+
+// AnthropicClient calls the Anthropic Messages API
+type AnthropicClient struct {
+	APIKey     string
+	BaseURL    string // DefaultAnthropicURL unless a test points it elsewhere
+	HTTPClient *http.Client
+}
+
+// NewAnthropicClient creates an Anthropic client authenticated with ANTHROPIC_API_KEY
+func NewAnthropicClient() (*AnthropicClient, error) {
+	apiKey, ok := os.LookupEnv("ANTHROPIC_API_KEY")
+	if !ok {
+		return nil, withKind(ErrAPIKeyMissing, fmt.Errorf("environment variable ANTHROPIC_API_KEY not set"))
+	}
+	return newAnthropicClient(apiKey), nil
+}
+
+// newAnthropicClient creates an Anthropic client authenticated with apiKey
+func newAnthropicClient(apiKey string) *AnthropicClient {
+	return &AnthropicClient{
+		APIKey:     apiKey,
+		BaseURL:    DefaultAnthropicURL,
+		HTTPClient: &http.Client{Timeout: 10 * time.Minute},
+	}
+}
+
+// anthropicMessage is one turn of a Messages API conversation
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// anthropicThinking enables extended thinking
+type anthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+// anthropicRequest is the body of POST /v1/messages
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	MaxTokens   int                `json:"max_tokens"`
+	Messages    []anthropicMessage `json:"messages"`
+	Temperature *float64           `json:"temperature,omitempty"`
+	TopP        *float64           `json:"top_p,omitempty"`
+	Thinking    *anthropicThinking `json:"thinking,omitempty"`
+}
+
+// anthropicResponse is the part of a Messages API response the strategy uses
+type anthropicResponse struct {
+	Content []struct {
+		Type     string `json:"type"`
+		Text     string `json:"text,omitempty"`
+		Thinking string `json:"thinking,omitempty"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// AnthropicError is an error response of the Anthropic API
+type AnthropicError struct {
+	StatusCode int
+	Type       string // e.g. "rate_limit_error" or "overloaded_error"
+	Message    string
+	RetryAfter time.Duration // From the Retry-After header, 0 if absent
+}
+
+func (e *AnthropicError) Error() string {
+	return fmt.Sprintf("HTTP %d %s: %s", e.StatusCode, e.Type, e.Message)
+}
+
+// HTTPStatus implements retry.StatusError: the API is rate limiting (429)
+// or overloaded (529) and the request may succeed later
+func (e *AnthropicError) HTTPStatus() int {
+	return e.StatusCode
+}
+
+// RetryDelay implements retry.DelayError
+func (e *AnthropicError) RetryDelay() time.Duration {
+	return e.RetryAfter
+}
+
+// createMessage sends one Messages API request
+func (c *AnthropicClient) createMessage(ctx context.Context, request anthropicRequest) (*anthropicResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.BaseURL, "/")+"/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-Key", c.APIKey)
+	req.Header.Set("Anthropic-Version", AnthropicVersion)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &AnthropicError{StatusCode: resp.StatusCode, Type: "error"}
+		var body struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &body) == nil && body.Error.Type != "" {
+			apiErr.Type, apiErr.Message = body.Error.Type, body.Error.Message
+		} else {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		// Error bodies can echo the credentials that were sent
+		apiErr.Message = redact.String(apiErr.Message)
+		apiErr.RetryAfter = retry.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		return nil, apiErr
+	}
+
+	var result anthropicResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &result, nil
+}
+
+// ClaudeStrategy uses the Anthropic Messages API to rewrite function bodies
+type ClaudeStrategy struct {
+	BaseStrategy
+	// NewClient creates the Anthropic client on first use; the client and its
+	// HTTP connections are then reused for every function. Tests can replace it
+	// to point at a fake endpoint.
+	NewClient func() (*AnthropicClient, error)
+
+	clientOnce sync.Once
+	client     *AnthropicClient
+	clientErr  error
+}
+
+// NewClaudeStrategy creates a new Claude strategy
+func NewClaudeStrategy(astHandler *ASTHandler, comment string, opts ...StrategyOption) *ClaudeStrategy {
+	cs := &ClaudeStrategy{
+		BaseStrategy: BaseStrategy{
+			ASTHandler: astHandler,
+			Comment:    comment,
+			Model:      DefaultAnthropicModel,
+			Provider:   string(APITypeAnthropic),
+			Structured: true,
+			Limiter:    SharedLimiter(string(APITypeAnthropic)),
+			Breaker:    SharedBreaker(string(APITypeAnthropic)),
+		},
+	}
+	cs.apply(opts)
+	cs.NewClient = NewAnthropicClient
+	cs.rewriteFunc = cs.callClaudeLLM
+	return cs
+}
+
+// getClient returns the strategy's Anthropic client, creating it on first use
+func (cs *ClaudeStrategy) getClient() (*AnthropicClient, error) {
+	cs.clientOnce.Do(func() {
+		cs.client, cs.clientErr = cs.NewClient()
+	})
+	return cs.client, cs.clientErr
+}
+
+// Close releases the idle connections of the Anthropic client if one was created
+func (cs *ClaudeStrategy) Close() error {
+	if cs.client != nil && cs.client.HTTPClient != nil {
+		cs.client.HTTPClient.CloseIdleConnections()
+	}
+	return nil
+}
+
+// request builds the Messages API request for a prompt. Claude models do not
+// accept temperature and top-p together, so top-p is only sent when it was
+// changed from the default and then replaces the temperature. Extended
+// thinking requires the default sampling, so neither is sent with it.
+func (cs *ClaudeStrategy) request(prompt string) anthropicRequest {
+	request := anthropicRequest{
+		Model:     cs.Model,
+		MaxTokens: cs.maxTokens(),
+		Messages:  []anthropicMessage{{Role: "user", Content: prompt}},
+	}
+	if budget, ok := anthropicThinkingBudgets[cs.ReasoningEffort]; ok {
+		request.Thinking = &anthropicThinking{Type: "enabled", BudgetTokens: budget}
+		request.MaxTokens += budget
+		return request
+	}
+	sampling := cs.sampling()
+	if sampling.TopP != DefaultSampling.TopP {
+		request.TopP = &sampling.TopP
+	} else {
+		request.Temperature = &sampling.Temperature
+	}
+	return request
+}
+
+// callClaudeLLM makes an API call to Claude to rewrite function code
+func (cs *ClaudeStrategy) callClaudeLLM(ctx context.Context, functionSource string) (string, error) {
+	client, err := cs.getClient()
+	if err != nil {
+		return "", err
+	}
+
+	// Structured output is requested in the prompt; the response is parsed
+	// with the JSON fallback like on the other providers
+	prompt := cs.prompt(functionSource)
+	request := cs.request(prompt)
+	estimated := estimateTokens(prompt)
+
+	// Rate limited or overloaded: wait at least as long as the API asks
+	var resp *anthropicResponse
+	err = cs.callWithRetry(ctx, APITypeAnthropic, estimated, func(ctx context.Context) (err error) {
+		resp, err = client.createMessage(ctx, request)
+		return err
+	})
+	if err != nil {
+		return "", retryError("Anthropic API", err)
+	}
+
+	cs.settleTokens(APITypeAnthropic, cs.Model, estimated, callUsage{Prompt: resp.Usage.InputTokens, Completion: resp.Usage.OutputTokens})
+
+	// Thinking blocks are not part of the answer
+	var answer, thinking strings.Builder
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			answer.WriteString(block.Text)
+		case "thinking":
+			thinking.WriteString(block.Thinking)
+		}
+	}
+	if thinking.Len() > 0 {
+		logger.Debug("Model reasoned before answering", "characters", thinking.Len())
+	}
+	if answer.Len() == 0 {
+		if resp.StopReason == "max_tokens" {
+			return "", withKind(ErrEmptyResponse, fmt.Errorf("model reached the token limit before answering; lower the reasoning effort"))
+		}
+		return "", withKind(ErrEmptyResponse, fmt.Errorf("received empty response from Anthropic API"))
+	}
+	return cs.parseResponse(answer.String())
+}
@@ -0,0 +1,172 @@
+package rewriter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of calling a provider whose circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// Default circuit breaker policy
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = time.Minute
+)
+
+// Breaker is a circuit breaker for one provider. After Threshold consecutive
+// failed API calls it opens and rejects calls for Cooldown; then a single probe
+// call is let through, which closes the breaker on success or reopens it on
+// failure. Like the Limiter, one Breaker is shared per provider (see
+// SharedBreaker). A zero threshold disables the breaker; a nil Breaker never opens.
+type Breaker struct {
+	Provider string
+
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	probing   bool
+
+	now func() time.Time
+}
+
+// NewBreaker creates a breaker for provider with the given policy
+func NewBreaker(provider string, threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{Provider: provider, threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+var (
+	sharedBreakersMu sync.Mutex
+	sharedBreakers   = map[string]*Breaker{}
+)
+
+// SharedBreaker returns the process-wide breaker for a provider, creating one
+// with the default policy on first use
+func SharedBreaker(provider string) *Breaker {
+	sharedBreakersMu.Lock()
+	defer sharedBreakersMu.Unlock()
+	b, ok := sharedBreakers[provider]
+	if !ok {
+		b = NewBreaker(provider, DefaultBreakerThreshold, DefaultBreakerCooldown)
+		sharedBreakers[provider] = b
+	}
+	return b
+}
+
+// SetPolicy changes the threshold and cool-down and closes the breaker
+func (b *Breaker) SetPolicy(threshold int, cooldown time.Duration) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.threshold, b.cooldown = threshold, cooldown
+	b.failures, b.openUntil, b.probing = 0, time.Time{}, false
+}
+
+// Allow returns an error wrapping ErrCircuitOpen if no call may be sent now
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return nil
+	}
+	if remaining := b.openUntil.Sub(b.now()); remaining > 0 {
+		return fmt.Errorf("%w for %s after %d consecutive failures, retrying in %v",
+			ErrCircuitOpen, b.Provider, b.failures, remaining.Round(time.Second))
+	}
+	if b.probing {
+		return fmt.Errorf("%w for %s, waiting for a probe call", ErrCircuitOpen, b.Provider)
+	}
+	b.probing = true
+	return nil
+}
+
+// Open reports whether the breaker is currently rejecting calls
+func (b *Breaker) Open() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.threshold > 0 && b.failures >= b.threshold && b.openUntil.After(b.now())
+}
+
+// Record reports the outcome of a call admitted by Allow
+func (b *Breaker) Record(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	// A canceled run says nothing about the provider
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+		logger.Warn("Circuit breaker opened", "provider", b.Provider, "failures", b.failures, "cooldown", b.cooldown)
+	}
+}
+
+// base gives access to the BaseStrategy embedded in LLM strategies
+func (bs *BaseStrategy) base() *BaseStrategy {
+	return bs
+}
+
+// baseStrategy is implemented by strategies that embed BaseStrategy
+type baseStrategy interface {
+	base() *BaseStrategy
+}
+
+// SetFallback makes the rewriter send functions to the given provider while
+// the current provider's circuit breaker is open. An empty model selects the
+// provider's default; APITypeNone falls back to deterministic transforms.
+func (r *Rewriter) SetFallback(apiType APIType, model string) error {
+	primary, ok := r.Strategy.(baseStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support failover", r.Strategy)
+	}
+	if primary.base().Provider == string(APITypeNone) {
+		return fmt.Errorf("the deterministic strategy needs no fallback")
+	}
+	if !IsBuiltinStrategy(string(apiType)) {
+		return fmt.Errorf("unknown fallback API %q", apiType)
+	}
+	fallback := NewLLMRewriterWithModel(apiType, model).Strategy
+	fb := fallback.(baseStrategy).base()
+	if fb.Provider == primary.base().Provider {
+		return fmt.Errorf("fallback provider must differ from the primary provider %s", fb.Provider)
+	}
+
+	fb.ASTHandler = r.ASTHandler
+	fb.State = primary.base().State
+	fb.Cache = primary.base().Cache
+	fb.Secrets = primary.base().Secrets
+	fb.Deadline = primary.base().Deadline
+	fb.Usage = primary.base().Usage
+	fb.Examples, fb.Shots = primary.base().Examples, primary.base().Shots
+	fb.Sampling = primary.base().Sampling
+	fb.MaxTokens = primary.base().MaxTokens
+	fb.Retry = primary.base().Retry
+	fb.Observer = primary.base().Observer
+	fb.Techniques = primary.base().Techniques
+	fb.Prompts, fb.PromptVariant = primary.base().Prompts, primary.base().PromptVariant
+	primary.base().Fallback = fb
+	r.fallback = fallback
+	return nil
+}
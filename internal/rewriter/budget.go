@@ -0,0 +1,36 @@
+package rewriter
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrBudgetExceeded is returned instead of an API call once the rewriter's
+// deadline has passed or its token or cost budget is used up
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// pastDeadline returns ErrBudgetExceeded once the strategy's deadline has passed
+func (bs *BaseStrategy) pastDeadline() error {
+	if !bs.Deadline.IsZero() && time.Now().After(bs.Deadline) {
+		return fmt.Errorf("time %w at %s, not sent to the API", ErrBudgetExceeded, bs.Deadline.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// SetDeadline stops sending functions to the API, including the fallback's,
+// once deadline has passed. A call in flight at the deadline is completed.
+// Later functions are kept unchanged and reported as skipped, and rewrites
+// reused from the incremental state are still applied.
+func (r *Rewriter) SetDeadline(deadline time.Time) error {
+	s, ok := r.Strategy.(baseStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support a time budget", r.Strategy)
+	}
+	bs := s.base()
+	bs.Deadline = deadline
+	if bs.Fallback != nil {
+		bs.Fallback.Deadline = deadline
+	}
+	return nil
+}
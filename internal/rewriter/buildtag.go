@@ -0,0 +1,131 @@
+package rewriter
+
+import (
+	"fmt"
+	"go/build/constraint"
+	"go/format"
+	"strings"
+)
+
+// DefaultBuildTag is the build tag rewritten files are constrained to
+const DefaultBuildTag = "rewritten"
+
+// BuildConstraint returns the header that constrains a file to tag, in the
+// //go:build syntax and the legacy // +build syntax older toolchains read.
+// An empty tag returns no header.
+func BuildConstraint(tag string) string {
+	if tag == "" {
+		return ""
+	}
+	return "//go:build " + tag + "\n// +build " + tag + "\n\n"
+}
+
+// ValidateBuildTag rejects tags the go command cannot select with -tags
+func ValidateBuildTag(tag string) error {
+	if tag == "" {
+		return fmt.Errorf("empty build tag")
+	}
+	for _, c := range tag {
+		if !(c == '_' || c == '.' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			return fmt.Errorf("invalid build tag %q: only letters, digits, '_' and '.' are allowed", tag)
+		}
+	}
+	return nil
+}
+
+// SetBuildTag constrains rewritten files to tag. An empty tag leaves them
+// unconstrained, which is only safe when the output is not a .go file next to
+// the input: such a file would build together with the original.
+func (r *Rewriter) SetBuildTag(tag string) error {
+	if tag == "" {
+		r.BuildTag, r.OmitBuildTag = "", true
+		return nil
+	}
+	if err := ValidateBuildTag(tag); err != nil {
+		return err
+	}
+	r.BuildTag, r.OmitBuildTag = tag, false
+	return nil
+}
+
+// EffectiveBuildTag returns the tag rewritten files are constrained to, or ""
+// for none; go commands need it in -tags to build them
+func (r *Rewriter) EffectiveBuildTag() string {
+	switch {
+	case r.OmitBuildTag:
+		return ""
+	case r.BuildTag == "":
+		return DefaultBuildTag
+	default:
+		return r.BuildTag
+	}
+}
+
+// ConstrainSource constrains the Go source src to tag and formats the whole
+// file. A file can only have one //go:build line, so a constraint src already
+// has is combined with tag, e.g. "//go:build linux" becomes
+// "//go:build rewritten && linux", and its // +build lines are regenerated.
+// An empty tag keeps the constraint of src as it is.
+func ConstrainSource(src, tag string) (string, error) {
+	var goBuild constraint.Expr
+	var plusBuild []constraint.Expr
+	lines := strings.SplitAfter(src, "\n")
+	var kept []string
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		// Constraints are only read before the package clause
+		if strings.HasPrefix(trimmed, "package ") {
+			kept = append(kept, lines[i:]...)
+			break
+		}
+		if !constraint.IsGoBuild(trimmed) && !constraint.IsPlusBuild(trimmed) {
+			kept = append(kept, line)
+			continue
+		}
+		x, err := constraint.Parse(trimmed)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse build constraint %q: %w", trimmed, err)
+		}
+		if constraint.IsGoBuild(trimmed) {
+			goBuild = x
+		} else {
+			plusBuild = append(plusBuild, x)
+		}
+	}
+
+	// Like the go command, ignore // +build lines next to a //go:build line
+	existing := goBuild
+	if existing == nil {
+		for _, x := range plusBuild {
+			if existing == nil {
+				existing = x
+			} else {
+				existing = &constraint.AndExpr{X: existing, Y: x}
+			}
+		}
+	}
+	expr := existing
+	if tag != "" {
+		expr = &constraint.TagExpr{Tag: tag}
+		if existing != nil && existing.String() != tag {
+			expr = &constraint.AndExpr{X: expr, Y: existing}
+		}
+	}
+
+	var header strings.Builder
+	if expr != nil {
+		header.WriteString("//go:build " + expr.String() + "\n")
+		// Expressions too complex for // +build lines only get //go:build
+		if plus, err := constraint.PlusBuildLines(expr); err == nil {
+			for _, line := range plus {
+				header.WriteString(line + "\n")
+			}
+		}
+		header.WriteString("\n")
+	}
+	formatted, err := format.Source([]byte(header.String() + strings.Join(kept, "")))
+	if err != nil {
+		return "", fmt.Errorf("failed to format rewritten code: %w", err)
+	}
+	return string(formatted), nil
+}
@@ -0,0 +1,171 @@
+package rewriter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ChainPass is one pass of a StrategyChain
+type ChainPass struct {
+	Name     string // Shown in logs and errors, e.g. the techniques of the pass
+	Strategy RewriteStrategy
+}
+
+// StrategyChain applies several strategies to a file in sequence, each one to
+// the output of the one before. After every pass that changed the file, the
+// file is printed and parsed again, so a pass that broke it fails the chain
+// instead of being handed to the next pass.
+type StrategyChain struct {
+	ASTHandler *ASTHandler
+	Passes     []ChainPass
+}
+
+// Rewrite implements the RewriteStrategy interface. It reports a change if any
+// pass changed the file.
+func (c *StrategyChain) Rewrite(ctx context.Context, f *ast.File) (bool, error) {
+	rewritten := false
+	for i, pass := range c.Passes {
+		logger.Info("Running pass", "pass", i+1, "passes", len(c.Passes), "name", pass.Name)
+		changed, err := pass.Strategy.Rewrite(ctx, f)
+		if err != nil {
+			return rewritten, fmt.Errorf("pass %d (%s) failed: %w", i+1, pass.Name, err)
+		}
+		if !changed {
+			continue
+		}
+		rewritten = true
+		if err := c.validate(f); err != nil {
+			return rewritten, fmt.Errorf("pass %d (%s) produced invalid code: %w", i+1, pass.Name, err)
+		}
+	}
+	return rewritten, nil
+}
+
+// validate checks that f still prints as a Go file that parses
+func (c *StrategyChain) validate(f *ast.File) error {
+	src, err := c.ASTHandler.PrintAST(f)
+	if err != nil {
+		return err
+	}
+	_, err = parser.ParseFile(token.NewFileSet(), "", src, parser.SkipObjectResolution)
+	return err
+}
+
+// Offline implements offlineStrategy: the chain keeps code on the machine only
+// if every pass does
+func (c *StrategyChain) Offline() bool {
+	for _, pass := range c.Passes {
+		if !isOffline(pass.Strategy) {
+			return false
+		}
+	}
+	return len(c.Passes) > 0
+}
+
+// Close closes every strategy of the chain once, even if several passes share it
+func (c *StrategyChain) Close() error {
+	var closed []io.Closer
+	var errs []error
+	for _, pass := range c.Passes {
+		closer, ok := pass.Strategy.(io.Closer)
+		if tp, isPass := pass.Strategy.(techniquePass); isPass {
+			closer, ok = tp.strategy.(io.Closer)
+		}
+		if ok && !slices.Contains(closed, closer) {
+			closed = append(closed, closer)
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// techniquePass runs a strategy with the techniques of one pass, restoring
+// the strategy's own techniques afterwards
+type techniquePass struct {
+	strategy   RewriteStrategy
+	techniques []TechniqueType
+}
+
+// Rewrite implements the RewriteStrategy interface
+func (p techniquePass) Rewrite(ctx context.Context, f *ast.File) (bool, error) {
+	bs := p.strategy.(baseStrategy).base()
+	saved := bs.Techniques
+	bs.Techniques = p.techniques
+	if bs.Fallback != nil {
+		bs.Fallback.Techniques = p.techniques
+	}
+	defer func() {
+		bs.Techniques = saved
+		if bs.Fallback != nil {
+			bs.Fallback.Techniques = saved
+		}
+	}()
+	return p.strategy.Rewrite(ctx, f)
+}
+
+// Offline implements offlineStrategy
+func (p techniquePass) Offline() bool {
+	return isOffline(p.strategy)
+}
+
+// ParsePasses parses a comma-separated list of passes, each a technique or
+// several joined with "+", e.g. "dead-code,variable-renaming+opaque-predicates"
+func ParsePasses(list string) ([][]TechniqueType, error) {
+	var passes [][]TechniqueType
+	for _, pass := range strings.Split(list, ",") {
+		if strings.TrimSpace(pass) == "" {
+			continue
+		}
+		techniques, err := ParseTechniques(strings.ReplaceAll(pass, "+", ","))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pass %q: %w", strings.TrimSpace(pass), err)
+		}
+		passes = append(passes, techniques)
+	}
+	if len(passes) == 0 {
+		return nil, fmt.Errorf("at least one pass is required")
+	}
+	return passes, nil
+}
+
+// SetPasses replaces the strategy with a StrategyChain that runs it once per
+// pass, in order, asking each time for the techniques of that pass only. The
+// other setters do not apply to a chain, so the strategy must be configured
+// first.
+func (r *Rewriter) SetPasses(passes ...[]TechniqueType) error {
+	if _, ok := r.Strategy.(baseStrategy); !ok {
+		return fmt.Errorf("strategy %T does not support passes", r.Strategy)
+	}
+	if _, ok := r.Strategy.(*ObfuscatorStrategy); ok {
+		return fmt.Errorf("passes select techniques, which the deterministic strategy does not use")
+	}
+	if len(passes) == 0 {
+		return fmt.Errorf("at least one pass is required")
+	}
+	chain := &StrategyChain{ASTHandler: r.ASTHandler}
+	for _, techniques := range passes {
+		if len(techniques) == 0 {
+			return fmt.Errorf("every pass needs at least one technique")
+		}
+		names := make([]string, len(techniques))
+		for i, t := range techniques {
+			if _, ok := techniqueTemplates[t]; !ok {
+				return fmt.Errorf("unknown technique %q (expected one of %s)", t, TechniqueNames())
+			}
+			names[i] = string(t)
+		}
+		chain.Passes = append(chain.Passes, ChainPass{
+			Name:     strings.Join(names, "+"),
+			Strategy: techniquePass{strategy: r.Strategy, techniques: slices.Clone(techniques)},
+		})
+	}
+	r.Strategy = chain
+	return nil
+}
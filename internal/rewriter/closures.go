@@ -0,0 +1,254 @@
+package rewriter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"strings"
+	"time"
+)
+
+// DefaultClosureLines is the size from which function literals are rewritten
+// on their own when closure rewriting is enabled without a size
+const DefaultClosureLines = 10
+
+// SetClosureRewriting makes function literals of at least minLines lines
+// separate rewrite units. 0 leaves them to the function containing them.
+func (r *Rewriter) SetClosureRewriting(minLines int) error {
+	s, ok := r.Strategy.(baseStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support closure rewriting", r.Strategy)
+	}
+	if minLines < 0 {
+		return fmt.Errorf("closure size must not be negative, got %d", minLines)
+	}
+	s.base().ClosureLines = minLines
+	return nil
+}
+
+// closure is a function literal sent to the LLM as a function of its own
+type closure struct {
+	name string // e.g. "handler.func2", as the runtime names it
+	lit  *ast.FuncLit
+}
+
+// largeClosures returns the function literals directly inside fd, not nested
+// in another literal, that span at least ClosureLines lines
+func (bs *BaseStrategy) largeClosures(fd *ast.FuncDecl) []closure {
+	var closures []closure
+	n := 0
+	ast.Inspect(fd.Body, func(node ast.Node) bool {
+		lit, ok := node.(*ast.FuncLit)
+		if !ok {
+			return true
+		}
+		n++
+		fset := bs.ASTHandler.FileSet
+		if fset.Position(lit.End()).Line-fset.Position(lit.Pos()).Line+1 >= bs.ClosureLines {
+			closures = append(closures, closure{name: fmt.Sprintf("%s.func%d", fd.Name.Name, n), lit: lit})
+		}
+		// Nested literals are rewritten as part of this one
+		return false
+	})
+	return closures
+}
+
+// rewriteClosures rewrites the large function literals of fd in place. Their
+// function was rewritten first, so its prompt is the same as without closure
+// rewriting. Rejected rewrites are repaired or not applied.
+func (bs *BaseStrategy) rewriteClosures(ctx context.Context, file *ast.File, fd *ast.FuncDecl, checker *bodyChecker) (bool, error) {
+	rewrote := false
+	for _, c := range bs.largeClosures(fd) {
+		logger.Info("Processing function literal", "function", c.name)
+		start, startTokens := time.Now(), bs.usedTokens()
+		bs.emit(Event{Type: EventStarted, Function: c.name})
+		report := func(status string, err error) {
+			if bs.Report != nil {
+				bs.Report.add(c.name, status, err, start, bs.usedTokens()-startTokens)
+			}
+			bs.emitFinished(Event{Function: c.name}, status, err, start)
+		}
+
+		source, err := bs.closureSource(fd, c)
+		if err != nil {
+			report(FunctionFailed, err)
+			return false, fmt.Errorf("failed to extract function literal source for %s: %w", c.name, err)
+		}
+		rewrittenSource, err := bs.rewriteUnit(ctx, c.name, source)
+		if errors.Is(err, ErrBudgetExceeded) {
+			logger.Warn("Skipping function literal", "function", c.name, "error", err)
+			report(FunctionSkipped, err)
+			continue
+		}
+		if err != nil {
+			report(FunctionFailed, err)
+			return false, fmt.Errorf("failed to rewrite function literal %s: %w", c.name, err)
+		}
+		if rewrittenSource == source {
+			logger.Info("LLM didn't make any changes", "function", c.name)
+			report(FunctionUnchanged, nil)
+			continue
+		}
+
+		body, rejected := bs.rewrittenBody(file, c.name, closureDecl(c), rewrittenSource, &c.lit.Body, checker)
+		if rejected != nil {
+			body, rejected = bs.repair(ctx, file, c.name, closureDecl(c), source, &c.lit.Body, checker, rejected)
+		}
+		if rejected != nil {
+			report(FunctionFailed, rejected.err)
+			continue
+		}
+
+		// The literal keeps its own signature, only its body is replaced
+		spliceBody(file, &c.lit.Body, body)
+		report(FunctionRewritten, nil)
+		rewrote = true
+		logger.Info("Successfully rewrote function literal", "function", c.name)
+	}
+	return rewrote, nil
+}
+
+// closureDecl returns the literal as a function declaration named after it,
+// which is how the model sees it
+func closureDecl(c closure) *ast.FuncDecl {
+	return &ast.FuncDecl{Name: ast.NewIdent(strings.ReplaceAll(c.name, ".", "_")), Type: c.lit.Type, Body: c.lit.Body}
+}
+
+// closureSource returns the declaration of a literal preceded by a comment
+// listing the variables it captures from fd, which the model cannot see
+// otherwise
+func (bs *BaseStrategy) closureSource(fd *ast.FuncDecl, c closure) (string, error) {
+	source, err := bs.getFunctionSource(closureDecl(c))
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "// Function literal from %s.\n", fd.Name.Name)
+	if captured := bs.capturedVariables(fd, c.lit); len(captured) > 0 {
+		fmt.Fprintf(&sb, "// It uses these variables of %s, which are not declared here and must keep their meaning:\n", fd.Name.Name)
+		for _, v := range captured {
+			fmt.Fprintf(&sb, "//   %s\n", v)
+		}
+	}
+	sb.WriteString(source)
+	return sb.String(), nil
+}
+
+// capturedVariables describes the variables of fd that lit refers to, each
+// with the declaration that introduces it. Without type information, a name
+// declared again inside lit is taken to shadow the outer one.
+func (bs *BaseStrategy) capturedVariables(fd *ast.FuncDecl, lit *ast.FuncLit) []string {
+	outer := make(map[string]string)
+	var order []string
+	declare := func(name, description string) {
+		if _, ok := outer[name]; !ok && name != "_" {
+			outer[name] = description
+			order = append(order, name)
+		}
+	}
+	for _, fields := range []*ast.FieldList{fd.Recv, fd.Type.Params, fd.Type.Results} {
+		if fields == nil {
+			continue
+		}
+		for _, field := range fields.List {
+			for _, name := range field.Names {
+				declare(name.Name, fmt.Sprintf("%s %s (parameter)", name.Name, bs.nodeText(field.Type)))
+			}
+		}
+	}
+	// Variables of other literals are out of lit's scope
+	ast.Inspect(fd.Body, func(node ast.Node) bool {
+		if _, ok := node.(*ast.FuncLit); ok {
+			return false
+		}
+		for _, name := range declaredNames(node) {
+			declare(name, fmt.Sprintf("%s (%s)", name, bs.nodeText(node)))
+		}
+		return true
+	})
+
+	inner := make(map[string]bool)
+	used := make(map[string]bool)
+	for _, fields := range []*ast.FieldList{lit.Type.Params, lit.Type.Results} {
+		if fields == nil {
+			continue
+		}
+		for _, field := range fields.List {
+			for _, name := range field.Names {
+				inner[name.Name] = true
+			}
+		}
+	}
+	ast.Inspect(lit.Body, func(node ast.Node) bool {
+		for _, name := range declaredNames(node) {
+			inner[name] = true
+		}
+		switch n := node.(type) {
+		case *ast.SelectorExpr:
+			// Only the operand can be a variable
+			ast.Inspect(n.X, func(node ast.Node) bool {
+				if id, ok := node.(*ast.Ident); ok {
+					used[id.Name] = true
+				}
+				return true
+			})
+			return false
+		case *ast.Ident:
+			used[n.Name] = true
+		}
+		return true
+	})
+
+	var captured []string
+	for _, name := range order {
+		if used[name] && !inner[name] {
+			captured = append(captured, outer[name])
+		}
+	}
+	return captured
+}
+
+// declaredNames returns the names a statement or declaration introduces
+func declaredNames(node ast.Node) []string {
+	var names []string
+	add := func(exprs ...ast.Expr) {
+		for _, e := range exprs {
+			if id, ok := e.(*ast.Ident); ok {
+				names = append(names, id.Name)
+			}
+		}
+	}
+	switch n := node.(type) {
+	case *ast.AssignStmt:
+		if n.Tok == token.DEFINE {
+			add(n.Lhs...)
+		}
+	case *ast.RangeStmt:
+		if n.Tok == token.DEFINE {
+			add(n.Key, n.Value)
+		}
+	case *ast.ValueSpec:
+		for _, name := range n.Names {
+			names = append(names, name.Name)
+		}
+	}
+	return names
+}
+
+// nodeText prints node on one line, shortened for the prompt
+func (bs *BaseStrategy) nodeText(node ast.Node) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, bs.ASTHandler.FileSet, node); err != nil {
+		return "?"
+	}
+	text := strings.Join(strings.Fields(buf.String()), " ")
+	if len(text) > 80 {
+		text = text[:77] + "..."
+	}
+	return text
+}
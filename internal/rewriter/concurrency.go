@@ -0,0 +1,110 @@
+package rewriter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// unitResult is the outcome of one function sent by a unitPool
+type unitResult struct {
+	source    string
+	sourceErr error // The source could not be printed; nothing was sent
+	rewritten string
+	err       error
+	start     time.Time
+	tokens    int64 // Tokens settled since the previous function finished
+	done      chan struct{}
+}
+
+// unitPool sends functions to the strategy's LLM from up to size goroutines
+// and hands the results back in dispatch order
+type unitPool struct {
+	ctx     context.Context
+	bs      *BaseStrategy
+	size    int
+	results []*unitResult
+	wg      sync.WaitGroup
+
+	mu         sync.Mutex
+	lastTokens int64
+}
+
+// newUnitPool creates a pool of the strategy's concurrency. A minimizing
+// search shares its insertion limit between requests, so it runs alone.
+func (bs *BaseStrategy) newUnitPool(ctx context.Context) *unitPool {
+	size := max(bs.Concurrency, 1)
+	if bs.Minimize != nil {
+		size = 1
+	}
+	return &unitPool{ctx: ctx, bs: bs, size: size, lastTokens: bs.usedTokens()}
+}
+
+// dispatched returns how many functions were dispatched so far
+func (p *unitPool) dispatched() int {
+	return len(p.results)
+}
+
+// dispatch starts rewriting a function, unless its source could not be printed
+func (p *unitPool) dispatch(name, source string, sourceErr error) {
+	unit := &unitResult{source: source, sourceErr: sourceErr, start: time.Now(), done: make(chan struct{})}
+	p.results = append(p.results, unit)
+	if sourceErr != nil {
+		close(unit.done)
+		return
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer close(unit.done)
+		unit.rewritten, unit.err = p.bs.rewriteUnit(p.ctx, name, source)
+		// Calls settle their tokens just before they return, so the tokens
+		// settled since the previous function finished are this function's.
+		// Alone in the pool, the count is exact.
+		p.mu.Lock()
+		used := p.bs.usedTokens()
+		unit.tokens, p.lastTokens = used-p.lastTokens, used
+		p.mu.Unlock()
+	}()
+}
+
+// result waits for the i-th dispatched function
+func (p *unitPool) result(i int) *unitResult {
+	<-p.results[i].done
+	return p.results[i]
+}
+
+// charge runs fn, which sends more requests for a finished function, and
+// adds the tokens settled meanwhile to the function's
+func (p *unitPool) charge(unit *unitResult, fn func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fn()
+	used := p.bs.usedTokens()
+	unit.tokens, p.lastTokens = unit.tokens+used-p.lastTokens, used
+}
+
+// wait blocks until every dispatched function is done, so no request is
+// still running when Rewrite returns
+func (p *unitPool) wait() {
+	p.wg.Wait()
+}
+
+// SetConcurrency sends up to n functions of a file to the LLM at once. The
+// provider's rate limiter and circuit breaker are shared by all requests, and
+// the results are applied in source order.
+func (r *Rewriter) SetConcurrency(n int) error {
+	if n < 1 {
+		return fmt.Errorf("concurrency must be at least 1, got %d", n)
+	}
+	s, ok := r.Strategy.(baseStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support concurrent rewriting", r.Strategy)
+	}
+	if _, ok := r.Strategy.(*ReplayStrategy); ok && n > 1 {
+		return fmt.Errorf("replays are read from disk one function at a time")
+	}
+	s.base().Concurrency = n
+	return nil
+}
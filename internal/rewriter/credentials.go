@@ -0,0 +1,60 @@
+package rewriter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/generative-ai-go/genai"
+	openrouter "github.com/revrost/go-openrouter"
+)
+
+// SetAPIKeys authenticates the strategy and its fallback with the key of
+// their provider instead of the provider's environment variable. A remote
+// strategy whose provider has no key is an error, so a caller with its own
+// credentials never falls back to the process-wide ones. Offline strategies
+// need no key.
+func (r *Rewriter) SetAPIKeys(keys map[APIType]string) error {
+	for _, s := range []RewriteStrategy{r.Strategy, r.fallback} {
+		switch s := s.(type) {
+		case nil:
+		case *LLMStrategy:
+			key, ok := keys[APITypeGemini]
+			if !ok {
+				return withKind(ErrAPIKeyMissing, fmt.Errorf("no API key for provider %s", APITypeGemini))
+			}
+			s.NewClient = func(ctx context.Context) (*genai.Client, error) {
+				return newGeminiClient(ctx, key)
+			}
+		case *OpenRouterStrategy:
+			key, ok := keys[APITypeOpenRouter]
+			if !ok {
+				return withKind(ErrAPIKeyMissing, fmt.Errorf("no API key for provider %s", APITypeOpenRouter))
+			}
+			s.NewClient = func() (*openrouter.Client, error) {
+				return newOpenRouterClient(key), nil
+			}
+		case *ClaudeStrategy:
+			key, ok := keys[APITypeAnthropic]
+			if !ok {
+				return withKind(ErrAPIKeyMissing, fmt.Errorf("no API key for provider %s", APITypeAnthropic))
+			}
+			s.NewClient = func() (*AnthropicClient, error) {
+				return newAnthropicClient(key), nil
+			}
+		case *OllamaStrategy:
+			// A local Ollama server needs no API key
+		case *OpenAICompatibleStrategy:
+			// A server on this machine may need no API key
+			key, ok := keys[APITypeOpenAICompatible]
+			if !ok && !s.Offline() {
+				return withKind(ErrAPIKeyMissing, fmt.Errorf("no API key for provider %s", APITypeOpenAICompatible))
+			}
+			s.apiKey, s.KeyEnv = key, ""
+		default:
+			if !isOffline(s) {
+				return fmt.Errorf("strategy %T does not support API keys", s)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package rewriter
+
+import "errors"
+
+// Kinds of LLM failures. Errors of a kind match it with errors.Is and keep
+// their message.
+var (
+	// ErrRateLimited is returned when a provider still rate limits after every retry
+	ErrRateLimited = errors.New("rate limited")
+	// ErrEmptyResponse is returned when a provider answers without code
+	ErrEmptyResponse = errors.New("empty response")
+	// ErrInvalidOutput is returned when the code of an answer is rejected:
+	// it does not parse, declares no function, fails a verifier or does not
+	// type-check
+	ErrInvalidOutput = errors.New("invalid output")
+	// ErrAPIKeyMissing is returned when the API key of a provider is not set
+	ErrAPIKeyMissing = errors.New("API key missing")
+)
+
+// errorKinds are the kinds ErrorKind reports, by name
+var errorKinds = []struct {
+	name string
+	err  error
+}{
+	{"rate_limited", ErrRateLimited},
+	{"empty_response", ErrEmptyResponse},
+	{"invalid_output", ErrInvalidOutput},
+	{"api_key_missing", ErrAPIKeyMissing},
+	{"budget_exceeded", ErrBudgetExceeded},
+	{"circuit_open", ErrCircuitOpen},
+}
+
+// ErrorKind names the kind of err for reports, e.g. "rate_limited", or
+// returns "" for an error of no known kind
+func ErrorKind(err error) string {
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind.err) {
+			return kind.name
+		}
+	}
+	return ""
+}
+
+// kindError gives an error a kind without changing its message
+type kindError struct {
+	kind error
+	err  error
+}
+
+// withKind returns err as an error of kind
+func withKind(kind, err error) error {
+	return &kindError{kind: kind, err: err}
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
@@ -0,0 +1,138 @@
+package rewriter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/redact"
+)
+
+// Kinds of progress events
+const (
+	EventStarted   = "started"   // The function was sent to the strategy
+	EventSucceeded = "succeeded" // The function was rewritten or returned unchanged
+	EventFailed    = "failed"    // The function keeps its original body: the rewrite failed, was rejected or skipped
+	EventRetried   = "retried"   // A call for the function is sent again after a failure, or a rejected rewrite for repair
+)
+
+// RetryRepair is the Reason of a retry that sends a rejected rewrite back to the LLM
+const RetryRepair = "repair"
+
+// Event reports progress on one function of a rewrite. Index and Total place
+// the function among the declared functions of its file; they are 0 for
+// function literals rewritten with SetClosureRewriting.
+type Event struct {
+	Type     string        `json:"type"`
+	Function string        `json:"function"`
+	Index    int           `json:"index,omitempty"` // From 1
+	Total    int           `json:"total,omitempty"`
+	Status   string        `json:"status,omitempty"`   // Outcome of a finished function, e.g. FunctionUnchanged
+	Duration time.Duration `json:"duration,omitempty"` // Of a finished function
+	Attempt  int           `json:"attempt,omitempty"`  // Of a retry, from 1
+	Reason   string        `json:"reason,omitempty"`   // Of a retry: the retry class, e.g. "rate_limited", or RetryRepair
+	Error    string        `json:"error,omitempty"`    // Redacted like the rewrite report's
+	Time     time.Time     `json:"time"`
+}
+
+// String describes the event in one line, e.g. for a progress display
+func (e Event) String() string {
+	s := e.Type + " " + e.Function
+	switch {
+	case e.Type == EventRetried:
+		s += fmt.Sprintf(" (%s, attempt %d)", e.Reason, e.Attempt)
+	case e.Status != "":
+		s += fmt.Sprintf(" (%s in %s)", e.Status, e.Duration.Round(time.Millisecond))
+	}
+	if e.Error != "" {
+		s += ": " + e.Error
+	}
+	return s
+}
+
+// Observer receives the events of a rewrite. Started and finished events of a
+// file arrive in source order, but retries arrive from the goroutines sending
+// functions, so Observe must be safe for concurrent use. It is called while
+// the rewrite waits and should return quickly.
+type Observer interface {
+	Observe(e Event)
+}
+
+// ObserverFunc makes a function an Observer
+type ObserverFunc func(e Event)
+
+// Observe calls f
+func (f ObserverFunc) Observe(e Event) {
+	f(e)
+}
+
+// ChannelObserver sends events to ch. Events that do not fit are dropped,
+// so a slow reader never holds up the rewrite.
+func ChannelObserver(ch chan<- Event) Observer {
+	return ObserverFunc(func(e Event) {
+		select {
+		case ch <- e:
+		default:
+		}
+	})
+}
+
+// SetObserver sends the events of every function the strategy and its
+// fallback process to o; nil stops sending them
+func (r *Rewriter) SetObserver(o Observer) error {
+	s, ok := r.Strategy.(baseStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not report progress", r.Strategy)
+	}
+	bs := s.base()
+	bs.Observer = o
+	if bs.Fallback != nil {
+		bs.Fallback.Observer = o
+	}
+	return nil
+}
+
+// emit sends e to the strategy's observer, if any
+func (bs *BaseStrategy) emit(e Event) {
+	if bs.Observer == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	bs.Observer.Observe(e)
+}
+
+// emitFinished sends the event of a function's outcome, one of the Function
+// statuses of the rewrite report
+func (bs *BaseStrategy) emitFinished(e Event, status string, err error, start time.Time) {
+	e.Type, e.Status, e.Duration = EventSucceeded, status, time.Since(start)
+	if status == FunctionFailed || status == FunctionSkipped {
+		e.Type = EventFailed
+	}
+	if err != nil {
+		e.Error = redact.String(err.Error())
+	}
+	bs.emit(e)
+}
+
+// emitRetry sends the event of a retry of the function being rewritten with ctx
+func (bs *BaseStrategy) emitRetry(ctx context.Context, attempt int, reason string, err error) {
+	e := Event{Type: EventRetried, Function: unitName(ctx), Attempt: attempt, Reason: reason}
+	if err != nil {
+		e.Error = redact.String(err.Error())
+	}
+	bs.emit(e)
+}
+
+// unitKey carries the name of the function a request is sent for
+type unitKey struct{}
+
+// withUnit returns ctx carrying the name of the function being rewritten
+func withUnit(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, unitKey{}, name)
+}
+
+// unitName returns the function being rewritten with ctx, or "" if unknown
+func unitName(ctx context.Context) string {
+	name, _ := ctx.Value(unitKey{}).(string)
+	return name
+}
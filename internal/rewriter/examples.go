@@ -0,0 +1,248 @@
+package rewriter
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"slices"
+	"strings"
+)
+
+// exampleHeader introduces the built-in example of a single technique
+const exampleHeader = "Example of the transformation:\n\n"
+
+// defaultExample is the example shown to the model when no example bank is
+// configured. It stays unchanged so existing prompt hashes stay valid.
+const defaultExample = `Example of the transformation:
+
+// --- Example Original Function ---
+package main
+
+func calculateSum(a, b int) int {
+    return a + b
+}
+// --- End Example Original Function ---
+
+// --- Example Obfuscated Output (Dead Code Insertion Only) ---
+package main
+import "fmt" 
+
+func calculateSum(a, b int) int {
+    tempVar := a*a + b*b - 100
+    uselessCounter := 0
+    if tempVar > 0 && a > 0 {
+        for i := 0; i < 5; i++ {
+            uselessCounter += i * (a - b)
+        }
+        fmt.Println("Performed insignificant calculations...")
+    } else {
+         _ = tempVar + uselessCounter
+    }
+
+    result := a + b
+
+    if result != (a + b) {
+        panic("Impossible logic error")
+    }
+
+    return result
+}
+// --- End Example Obfuscated Output ---`
+
+// Example is a reviewed before/after rewrite shown to the model
+type Example struct {
+	Technique TechniqueType `json:"technique"`          // e.g. TechniqueDeadCode
+	Source    string        `json:"source,omitempty"`   // Corpus file the function was drawn from
+	Function  string        `json:"function"`           // Name of the rewritten function
+	Category  string        `json:"category,omitempty"` // Corpus category of the function, e.g. "encoding"
+	Reviewed  bool          `json:"reviewed"`           // Only reviewed examples are shown
+	Original  string        `json:"original"`           // Original file with the function
+	Rewritten string        `json:"rewritten"`          // Rewritten file with the function
+}
+
+// ExampleBank holds the examples prompts can draw from
+type ExampleBank struct {
+	Examples []Example `json:"examples"`
+}
+
+//go:embed examples.json
+var builtinExamples []byte
+
+// BuiltinExampleBank returns the reviewed examples shipped with the rewriter,
+// drawn from the research corpus
+func BuiltinExampleBank() *ExampleBank {
+	bank, err := parseExampleBank("built-in example bank", builtinExamples)
+	if err != nil {
+		panic(err)
+	}
+	return bank
+}
+
+// LoadExampleBank reads and validates an example bank file
+func LoadExampleBank(path string) (*ExampleBank, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read example bank: %w", err)
+	}
+	return parseExampleBank(path, data)
+}
+
+// parseExampleBank decodes a bank and checks that every example is a parsable
+// file declaring the named function before and after the rewrite
+func parseExampleBank(name string, data []byte) (*ExampleBank, error) {
+	var bank ExampleBank
+	if err := json.Unmarshal(data, &bank); err != nil {
+		return nil, fmt.Errorf("failed to parse example bank %s: %w", name, err)
+	}
+	for i, ex := range bank.Examples {
+		if ex.Technique == "" || ex.Function == "" {
+			return nil, fmt.Errorf("example %d in %s needs a technique and a function", i+1, name)
+		}
+		for _, code := range []string{ex.Original, ex.Rewritten} {
+			if !declares(code, ex.Function) {
+				return nil, fmt.Errorf("example %d (%s) in %s is not a Go file declaring %s", i+1, ex.Function, name, ex.Function)
+			}
+		}
+		// The example must not show the model an import it may not use
+		if path, ok := disallowedImport(ex.Rewritten); ok {
+			return nil, fmt.Errorf("example %d (%s) in %s imports %s, which rewrites may not use", i+1, ex.Function, name, path)
+		}
+	}
+	return &bank, nil
+}
+
+// declares reports whether code parses as a Go file declaring the function
+func declares(code, function string) bool {
+	file, err := parser.ParseFile(token.NewFileSet(), "", code, parser.SkipObjectResolution)
+	if err != nil {
+		return false
+	}
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == function {
+			return true
+		}
+	}
+	return false
+}
+
+// disallowedImport returns the first import of code that is not in AllowedImports
+func disallowedImport(code string) (string, bool) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", code, parser.ImportsOnly)
+	if err != nil {
+		return "", false
+	}
+	for _, spec := range file.Imports {
+		path := strings.Trim(spec.Path.Value, `"`)
+		if !slices.Contains(AllowedImports, path) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// Select returns up to k reviewed examples of the technique, never one of the
+// function being rewritten. Examples are taken from each category in turn,
+// in bank order, so a small k still covers different kinds of code.
+func (b *ExampleBank) Select(technique TechniqueType, k int, function string) []Example {
+	var categories []string
+	byCategory := make(map[string][]Example)
+	for _, ex := range b.Examples {
+		if !ex.Reviewed || ex.Technique != technique || ex.Function == function {
+			continue
+		}
+		if _, ok := byCategory[ex.Category]; !ok {
+			categories = append(categories, ex.Category)
+		}
+		byCategory[ex.Category] = append(byCategory[ex.Category], ex)
+	}
+
+	var selected []Example
+	for round := 0; len(selected) < k; round++ {
+		added := false
+		for _, category := range categories {
+			if examples := byCategory[category]; round < len(examples) && len(selected) < k {
+				selected = append(selected, examples[round])
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	return selected
+}
+
+// SetExamples shows k examples of the technique from bank in every prompt
+// instead of the built-in one, for the current and the fallback strategy. A
+// k of 0 restores the built-in example.
+func (r *Rewriter) SetExamples(bank *ExampleBank, k int) error {
+	s, ok := r.Strategy.(baseStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support prompt examples", r.Strategy)
+	}
+	if k < 0 {
+		return fmt.Errorf("number of examples must not be negative, got %d", k)
+	}
+	bs := s.base()
+	if k > 0 && !slices.ContainsFunc(bs.techniques(), func(t TechniqueType) bool { return len(bank.Select(t, k, "")) > 0 }) {
+		return fmt.Errorf("example bank has no reviewed examples of %s", bs.techniqueList())
+	}
+	bs.Examples, bs.Shots = bank, k
+	if bs.Fallback != nil {
+		bs.Fallback.Examples, bs.Fallback.Shots = bank, k
+	}
+	return nil
+}
+
+// examplesSection returns the examples of the prompt for a function. Each
+// technique is shown with examples from the bank, or with its built-in
+// example if the bank has none.
+func (bs *BaseStrategy) examplesSection(functionSource string) string {
+	techniques := bs.techniques()
+	var sections [][]Example
+	found := false
+	for _, t := range techniques {
+		var examples []Example
+		if bs.Examples != nil && bs.Shots > 0 {
+			examples = bs.Examples.Select(t, bs.Shots, functionName(functionSource))
+		}
+		found = found || len(examples) > 0
+		sections = append(sections, examples)
+	}
+	if !found {
+		if len(techniques) == 1 {
+			return exampleHeader + techniqueTemplates[techniques[0]].Example
+		}
+		var sb strings.Builder
+		sb.WriteString("Examples of the transformations:")
+		for _, t := range techniques {
+			sb.WriteString("\n\n" + techniqueTemplates[t].Example)
+		}
+		return sb.String()
+	}
+
+	var sb strings.Builder
+	if len(techniques) == 1 {
+		sb.WriteString("Examples of the transformation:")
+	} else {
+		sb.WriteString("Examples of the transformations:")
+	}
+	n := 0
+	for i, examples := range sections {
+		if len(examples) == 0 {
+			sb.WriteString("\n\n" + techniqueTemplates[techniques[i]].Example)
+			continue
+		}
+		name := techniqueTemplates[techniques[i]].Name
+		for _, ex := range examples {
+			n++
+			fmt.Fprintf(&sb, "\n\n// --- Example %d Original Function ---\n%s\n// --- End Example %d Original Function ---\n", n, strings.TrimSpace(ex.Original), n)
+			fmt.Fprintf(&sb, "\n// --- Example %d Obfuscated Output (%s Only) ---\n%s\n// --- End Example %d Obfuscated Output ---", n, name, strings.TrimSpace(ex.Rewritten), n)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,110 @@
+package rewriter
+
+import (
+	"fmt"
+	"go/ast"
+	"regexp"
+	"strings"
+)
+
+// SkipDirective marks a function that is never rewritten, whatever the
+// strategy and filters
+const SkipDirective = "//metamorph:skip"
+
+// hasDirective reports whether a function's doc comment carries directive,
+// alone or followed by an explanation
+func hasDirective(fd *ast.FuncDecl, directive string) bool {
+	if fd.Doc == nil {
+		return false
+	}
+	for _, c := range fd.Doc.List {
+		text := strings.TrimRight(c.Text, " \t")
+		if text == directive || strings.HasPrefix(text, directive+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSkipped reports whether a function's doc comment carries SkipDirective
+func IsSkipped(fd *ast.FuncDecl) bool {
+	return hasDirective(fd, SkipDirective)
+}
+
+// FunctionFilter selects the functions to rewrite by name. A pattern matches
+// a function if it matches its whole name or, for a method, its whole
+// Type.Method name.
+type FunctionFilter struct {
+	Only    []*regexp.Regexp // If set, only functions matching one are rewritten
+	Exclude []*regexp.Regexp // Functions matching one are never rewritten
+}
+
+// ParseFunctionPatterns parses a comma-separated list of function names or
+// regular expressions, e.g. "init,main,Test.*"
+func ParseFunctionPatterns(list string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		re, err := regexp.Compile("^(?:" + item + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid function pattern %q: %w", item, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+// Match reports whether the filter selects fd
+func (ff FunctionFilter) Match(fd *ast.FuncDecl) bool {
+	names := []string{fd.Name.Name}
+	if recv := receiverType(fd); recv != "" {
+		names = append(names, recv+"."+fd.Name.Name)
+	}
+	matches := func(patterns []*regexp.Regexp) bool {
+		for _, re := range patterns {
+			for _, name := range names {
+				if re.MatchString(name) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if len(ff.Only) > 0 && !matches(ff.Only) {
+		return false
+	}
+	return !matches(ff.Exclude)
+}
+
+// receiverType returns the receiver type name of a method without pointer and
+// type parameters, or "" for a function
+func receiverType(fd *ast.FuncDecl) string {
+	if fd.Recv == nil || len(fd.Recv.List) == 0 {
+		return ""
+	}
+	recv := fd.Recv.List[0].Type
+	if s, ok := recv.(*ast.StarExpr); ok {
+		recv = s.X
+	}
+	switch r := recv.(type) {
+	case *ast.IndexExpr:
+		recv = r.X
+	case *ast.IndexListExpr:
+		recv = r.X
+	}
+	if id, ok := recv.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// SetFunctionFilter limits rewriting to the functions filter selects, in
+// addition to any Select already set
+func (r *Rewriter) SetFunctionFilter(filter FunctionFilter) {
+	selected := r.Select
+	r.Select = func(fd *ast.FuncDecl) bool {
+		return filter.Match(fd) && (selected == nil || selected(fd))
+	}
+}
@@ -0,0 +1,140 @@
+package rewriter
+
+import (
+	"context"
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "Regenerate golden outputs and re-key replay recordings")
+
+// TestGoldenRewrite rewrites the fixed corpus in testdata/corpus with recorded LLM
+// responses and compares the full output against testdata/golden. A failure means the
+// AST handling, prompt construction or response cleaning changed; if the change is
+// intended, run `go test ./internal/rewriter -run TestGoldenRewrite -update`.
+func TestGoldenRewrite(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "corpus", "*.go"))
+	if err != nil {
+		t.Fatalf("Failed to list corpus: %v", err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("Golden corpus is empty")
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".go")
+		t.Run(name, func(t *testing.T) {
+			recordingsPath := filepath.Join("testdata", "replay", name+".json")
+			goldenPath := filepath.Join("testdata", "golden", name+".go.golden")
+
+			r, err := NewReplayRewriter(recordingsPath)
+			if err != nil {
+				t.Fatalf("Failed to create replay rewriter: %v", err)
+			}
+			replay := r.Strategy.(*ReplayStrategy)
+			replay.Rekey = *updateGolden
+
+			got, err := r.RewriteFile(context.Background(), input)
+			if err != nil {
+				t.Fatalf("Error rewriting %s: %v", input, err)
+			}
+			if strings.Contains(got, "// Error during rewriting") {
+				t.Fatalf("Replay failed, the prompt probably changed (run with -update if intended):\n%s",
+					got[strings.LastIndex(got, "// Error during rewriting"):])
+			}
+
+			original, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", input, err)
+			}
+			checkDocComments(t, string(original), got)
+
+			if *updateGolden {
+				if err := os.WriteFile(goldenPath, []byte(got), 0644); err != nil {
+					t.Fatalf("Failed to write golden file: %v", err)
+				}
+				if err := SaveRecordings(recordingsPath, replay.Recordings); err != nil {
+					t.Fatalf("Failed to save recordings: %v", err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("Failed to read golden file (run with -update to create it): %v", err)
+			}
+
+			if got != string(want) {
+				gotLines := strings.Split(got, "\n")
+				wantLines := strings.Split(string(want), "\n")
+				for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+					var g, w string
+					if i < len(gotLines) {
+						g = gotLines[i]
+					}
+					if i < len(wantLines) {
+						w = wantLines[i]
+					}
+					if g != w {
+						t.Fatalf("Output drifted from %s at line %d:\n  got:  %q\n  want: %q", goldenPath, i+1, g, w)
+					}
+				}
+			}
+		})
+	}
+}
+
+// checkDocComments fails unless every function of the rewritten source keeps the
+// doc comment it had in the original, followed by no more than the marker, and
+// every other comment stays in the header or inside a function
+func checkDocComments(t *testing.T, original, rewritten string) {
+	t.Helper()
+	parse := func(src string) *ast.File {
+		f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			t.Fatalf("Failed to parse:\n%s\n%v", src, err)
+		}
+		return f
+	}
+	docs := func(f *ast.File) map[string]string {
+		docs := make(map[string]string)
+		for _, decl := range f.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok {
+				docs[fd.Name.Name] = fd.Doc.Text()
+			}
+		}
+		return docs
+	}
+
+	f := parse(rewritten)
+	got := docs(f)
+	for name, doc := range docs(parse(original)) {
+		rest, ok := strings.CutPrefix(got[name], doc)
+		if !ok || strings.Count(rest, "\n") > 1 {
+			t.Errorf("Doc comment of %s moved, want %q followed by at most the marker, got %q", name, doc, got[name])
+		}
+	}
+
+	placed := func(cg *ast.CommentGroup) bool {
+		if len(f.Decls) == 0 || cg.End() < f.Decls[0].Pos() {
+			return true
+		}
+		for _, decl := range f.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok && (cg == fd.Doc || cg.Pos() > fd.Pos() && cg.End() < fd.End()) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, cg := range f.Comments {
+		if !placed(cg) && !strings.HasPrefix(cg.Text(), "Error during rewriting") {
+			t.Errorf("Comment %q is outside of any function", cg.Text())
+		}
+	}
+}
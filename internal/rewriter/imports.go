@@ -0,0 +1,137 @@
+package rewriter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// majorVersion matches the last element of import paths such as math/rand/v2
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// importName returns the name a file refers to an imported package by: its
+// explicit name, or the last element of its path without a major version
+func importName(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+	path, _ := strconv.Unquote(spec.Path.Value)
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && majorVersion.MatchString(name) {
+		name = elems[len(elems)-2]
+	}
+	return name
+}
+
+// importPath returns the unquoted path of an import
+func importPath(spec *ast.ImportSpec) string {
+	path, _ := strconv.Unquote(spec.Path.Value)
+	return path
+}
+
+// usedImports returns the imports of the rewritten file that body refers to.
+// The model imports what its whole answer uses, so imports of other
+// declarations, blank and dot imports are left out.
+func usedImports(rewritten *ast.File, body *ast.BlockStmt) []*ast.ImportSpec {
+	used := make(map[string]bool)
+	ast.Inspect(body, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok {
+				used[x.Name] = true
+			}
+		}
+		return true
+	})
+	var specs []*ast.ImportSpec
+	for _, spec := range rewritten.Imports {
+		if name := importName(spec); name != "_" && name != "." && used[name] {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+// missingImports returns the imports body needs that f lacks. An import
+// whose name f already uses for another package cannot be added, since the
+// body refers to it by that name.
+func missingImports(f *ast.File, rewritten *ast.File, body *ast.BlockStmt) ([]*ast.ImportSpec, error) {
+	var missing []*ast.ImportSpec
+	for _, spec := range usedImports(rewritten, body) {
+		name, path := importName(spec), importPath(spec)
+		present := false
+		for _, existing := range f.Imports {
+			if importName(existing) != name {
+				continue
+			}
+			if importPath(existing) != path {
+				return nil, fmt.Errorf("the rewrite imports %q as %s, which the file imports as %q", path, name, importPath(existing))
+			}
+			present = true
+		}
+		if !present {
+			missing = append(missing, spec)
+		}
+	}
+	return missing, nil
+}
+
+// addImports adds imports to f with astutil, which puts them in the best
+// matching import declaration or a new one after the package clause. It
+// returns a function that removes them again.
+func addImports(fset *token.FileSet, f *ast.File, specs []*ast.ImportSpec) (undo func()) {
+	// Deleting the imports again drops the parentheses of a single remaining
+	// spec, so they are restored along with the declarations
+	parens := make(map[*ast.GenDecl]token.Pos)
+	for _, d := range importDecls(f.Decls) {
+		parens[d.(*ast.GenDecl)] = d.(*ast.GenDecl).Lparen
+	}
+	var added [][2]string // Names and paths
+	for _, spec := range specs {
+		var name string
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if astutil.AddNamedImport(fset, f, name, importPath(spec)) {
+			added = append(added, [2]string{name, importPath(spec)})
+		}
+	}
+	return func() {
+		for _, imp := range added {
+			astutil.DeleteNamedImport(fset, f, imp[0], imp[1])
+		}
+		for decl, lparen := range parens {
+			decl.Lparen = lparen
+		}
+	}
+}
+
+// importDecls returns the import declarations of decls
+func importDecls(decls []ast.Decl) []ast.Decl {
+	var imports []ast.Decl
+	for _, d := range decls {
+		if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			imports = append(imports, d)
+		}
+	}
+	return imports
+}
+
+// addedImportDecls returns the import declarations of now that are not in
+// before, i.e. those addImports created while only some declarations of a
+// file were handed to a strategy
+func addedImportDecls(now, before []ast.Decl) []ast.Decl {
+	var added []ast.Decl
+	for _, d := range importDecls(now) {
+		if !slices.Contains(before, d) {
+			added = append(added, d)
+		}
+	}
+	return added
+}
@@ -0,0 +1,215 @@
+package rewriter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/Hekzory/MetamorphLLM/internal/cache"
+	"github.com/Hekzory/MetamorphLLM/internal/telemetry"
+)
+
+// incrementalStateVersion is bumped whenever the state file format changes
+const incrementalStateVersion = 1
+
+// FunctionState is the stored rewrite of one function from a previous run
+type FunctionState struct {
+	Function string `json:"function"`
+	// InputSHA256 covers the provider, model, reasoning effort and full prompt, which embeds both the
+	// function source and the prompt template
+	InputSHA256 string `json:"input_sha256"`
+	Rewritten   string `json:"rewritten"` // Cleaned function source returned by the strategy
+}
+
+// IncrementalState remembers previous rewrites so unchanged functions are not sent
+// to the LLM again. Only functions seen during the current run are saved, so
+// entries for deleted or changed functions are dropped. Functions rewritten
+// concurrently may look up and record entries at the same time.
+type IncrementalState struct {
+	Path     string
+	previous map[string]FunctionState
+
+	mu      sync.Mutex
+	current []FunctionState
+	reused  int
+}
+
+// LoadIncrementalState reads the state stored at path; a missing file yields an empty state
+func LoadIncrementalState(path string) (*IncrementalState, error) {
+	s := &IncrementalState{Path: path, previous: make(map[string]FunctionState)}
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read incremental state: %w", err)
+	}
+
+	var stored struct {
+		Version   int             `json:"version"`
+		Functions []FunctionState `json:"functions"`
+	}
+	if err := json.Unmarshal(content, &stored); err != nil {
+		return nil, fmt.Errorf("failed to parse incremental state %s: %w", path, err)
+	}
+	if stored.Version != incrementalStateVersion {
+		logger.Warn("Ignoring incremental state of another version", "path", path, "version", stored.Version)
+		return s, nil
+	}
+	for _, fs := range stored.Functions {
+		s.previous[fs.InputSHA256] = fs
+	}
+	return s, nil
+}
+
+// Lookup returns the previous rewrite for an input hash
+func (s *IncrementalState) Lookup(inputHash string) (string, bool) {
+	fs, ok := s.previous[inputHash]
+	if ok {
+		telemetry.CacheLookups.Inc("incremental", telemetry.CacheHit)
+		s.mu.Lock()
+		s.reused++
+		s.mu.Unlock()
+	} else {
+		telemetry.CacheLookups.Inc("incremental", telemetry.CacheMiss)
+	}
+	return fs.Rewritten, ok
+}
+
+// Record stores the rewrite produced for a function in this run
+func (s *IncrementalState) Record(function, inputHash, rewritten string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = append(s.current, FunctionState{Function: function, InputSHA256: inputHash, Rewritten: rewritten})
+}
+
+// Reused returns how many functions were answered from the previous run
+func (s *IncrementalState) Reused() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reused
+}
+
+// Save writes the functions recorded in this run to Path
+func (s *IncrementalState) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	stored := struct {
+		Version   int             `json:"version"`
+		Functions []FunctionState `json:"functions"`
+	}{incrementalStateVersion, s.current}
+	if err := enc.Encode(stored); err != nil {
+		return fmt.Errorf("failed to encode incremental state: %w", err)
+	}
+	if err := os.WriteFile(s.Path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write incremental state: %w", err)
+	}
+	return nil
+}
+
+// SetIncrementalState makes the strategy reuse rewrites from state for unchanged functions
+func (bs *BaseStrategy) SetIncrementalState(state *IncrementalState) {
+	bs.State = state
+	if bs.Fallback != nil {
+		bs.Fallback.State = state
+	}
+}
+
+// SetCache makes the strategy and its fallback answer functions from the
+// response cache and store their new responses in it
+func (r *Rewriter) SetCache(c *cache.Cache) error {
+	s, ok := r.Strategy.(baseStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support a response cache", r.Strategy)
+	}
+	bs := s.base()
+	bs.Cache = c
+	if bs.Fallback != nil {
+		bs.Fallback.Cache = c
+	}
+	return nil
+}
+
+// inputHash identifies everything that determines a function's rewrite
+func (bs *BaseStrategy) inputHash(functionSource string) string {
+	return PromptHash(bs.Provider + "\x00" + bs.Model + "\x00" + bs.ReasoningEffort + "\x00" + bs.prompt(functionSource) + bs.samplingHash())
+}
+
+// rewriteFunction returns the rewritten source for a function, reusing the
+// previous run's rewrite or a cached response when its inputs are unchanged
+func (bs *BaseStrategy) rewriteFunction(ctx context.Context, name, functionSource string) (string, error) {
+	var hash string
+	if bs.State != nil || bs.Cache != nil {
+		hash = bs.inputHash(functionSource)
+	}
+	if bs.State != nil {
+		if rewritten, ok := bs.State.Lookup(hash); ok {
+			logger.Info("Function is unchanged since the last run, reusing previous rewrite", "function", name)
+			bs.State.Record(name, hash, rewritten)
+			return rewritten, nil
+		}
+	}
+	if bs.Cache != nil {
+		if rewritten, ok := bs.Cache.Get(hash); ok {
+			logger.Info("Function was answered from the response cache", "function", name)
+			if bs.State != nil {
+				bs.State.Record(name, hash, rewritten)
+			}
+			return rewritten, nil
+		}
+	}
+
+	if err := bs.pastDeadline(); err != nil {
+		return "", err
+	}
+	if err := bs.Usage.check(); err != nil {
+		return "", err
+	}
+	if err := ctx.Err(); err != nil {
+		return "", context.Cause(ctx)
+	}
+	rewritten, err := bs.callWithSecretPolicy(ctx, name, functionSource)
+	if err != nil {
+		// Includes the call that tripped the breaker. The fallback records its
+		// rewrite under its own provider and model.
+		if bs.Fallback != nil && ctx.Err() == nil && (errors.Is(err, ErrCircuitOpen) || bs.Breaker.Open()) {
+			logger.Warn("Sending function to the fallback provider", "function", name, "provider", bs.Fallback.Provider, "error", err)
+			return bs.Fallback.rewriteFunction(ctx, name, functionSource)
+		}
+		return "", err
+	}
+	if bs.State != nil {
+		bs.State.Record(name, hash, rewritten)
+	}
+	// A function that came back unchanged may not have been sent at all, e.g.
+	// because of the secret policy, so only actual rewrites are cached
+	if bs.Cache != nil && rewritten != functionSource {
+		if err := bs.Cache.Put(hash, rewritten); err != nil {
+			logger.Warn("Failed to cache response", "function", name, "error", err)
+		}
+	}
+	return rewritten, nil
+}
+
+// incrementalStrategy is implemented by strategies that embed BaseStrategy
+type incrementalStrategy interface {
+	SetIncrementalState(state *IncrementalState)
+}
+
+// SetIncrementalState enables incremental rewriting if the current strategy supports it
+func (r *Rewriter) SetIncrementalState(state *IncrementalState) error {
+	s, ok := r.Strategy.(incrementalStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support incremental rewriting", r.Strategy)
+	}
+	s.SetIncrementalState(state)
+	return nil
+}
@@ -0,0 +1,102 @@
+package rewriter
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+)
+
+// LocalOnlyDirective marks a function whose source must never leave the
+// machine. Only offline strategies may rewrite it.
+const LocalOnlyDirective = "//metamorph:local-only"
+
+// IsLocalOnly reports whether a function's doc comment carries LocalOnlyDirective
+func IsLocalOnly(fd *ast.FuncDecl) bool {
+	return hasDirective(fd, LocalOnlyDirective)
+}
+
+// offlineStrategy is implemented by strategies that never send code off the machine
+type offlineStrategy interface {
+	Offline() bool
+}
+
+// Offline implements offlineStrategy: comments are added locally
+func (fcs *FunctionCommentStrategy) Offline() bool {
+	return true
+}
+
+// Offline implements offlineStrategy: recordings are read from disk, unless a
+// remote fallback is configured
+func (rs *ReplayStrategy) Offline() bool {
+	return rs.Fallback == nil
+}
+
+// isOffline reports whether s keeps code on the machine. Strategies that do
+// not say so are assumed to be remote.
+func isOffline(s RewriteStrategy) bool {
+	o, ok := s.(offlineStrategy)
+	return ok && o.Offline()
+}
+
+// applyStrategy runs the rewriter's strategy on f. Functions rejected by
+// Select or marked with SkipDirective are hidden from the strategies.
+// Local-only functions are withheld from a remote strategy and rewritten by
+// LocalStrategy instead, or left unchanged if there is none.
+func (r *Rewriter) applyStrategy(ctx context.Context, f *ast.File) (bool, error) {
+	hidden := func(fd *ast.FuncDecl) bool {
+		if IsSkipped(fd) {
+			logger.Info("Function is marked "+SkipDirective+", not rewriting it", "function", fd.Name.Name)
+			return true
+		}
+		return r.Select != nil && !r.Select(fd)
+	}
+	all := f.Decls
+	f.Decls = nil
+	for _, decl := range all {
+		if fd, ok := decl.(*ast.FuncDecl); ok && hidden(fd) {
+			continue
+		}
+		f.Decls = append(f.Decls, decl)
+	}
+	defer func() { f.Decls = append(addedImportDecls(f.Decls, all), all...) }()
+
+	if isOffline(r.Strategy) {
+		return r.Strategy.Rewrite(ctx, f)
+	}
+
+	var local, remote []ast.Decl
+	for _, decl := range f.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok && IsLocalOnly(fd) {
+			logger.Info("Function is local-only, not sending it to a remote LLM", "function", fd.Name.Name)
+			local = append(local, decl)
+			continue
+		}
+		remote = append(remote, decl)
+	}
+	if len(local) == 0 {
+		return r.Strategy.Rewrite(ctx, f)
+	}
+
+	// Strategies rewrite declarations in place, so restoring the full list
+	// keeps both their changes and the original order, plus the imports
+	// rewrites needed
+	visible := f.Decls
+	f.Decls = remote
+	rewritten, err := r.Strategy.Rewrite(ctx, f)
+	f.Decls = append(addedImportDecls(f.Decls, visible), visible...)
+	if err != nil || r.LocalStrategy == nil {
+		return rewritten, err
+	}
+
+	if !isOffline(r.LocalStrategy) {
+		return false, fmt.Errorf("local strategy %T may send code off the machine", r.LocalStrategy)
+	}
+	// The imports are shared, so the local strategy can add to them
+	localFile := &ast.File{Name: f.Name, Decls: append(importDecls(f.Decls), local...), Imports: f.Imports}
+	localRewritten, err := r.LocalStrategy.Rewrite(ctx, localFile)
+	if err != nil {
+		return false, fmt.Errorf("local strategy failed: %w", err)
+	}
+	f.Decls, f.Imports = append(addedImportDecls(localFile.Decls, f.Decls), f.Decls...), localFile.Imports
+	return rewritten || localRewritten, nil
+}
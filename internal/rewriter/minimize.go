@@ -0,0 +1,262 @@
+package rewriter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Hekzory/MetamorphLLM/internal/metrics"
+)
+
+// Metrics a minimal rewrite can be required to grow
+const (
+	MetricCC   = "cc"
+	MetricCogC = "cogc"
+	MetricLOC  = "loc"
+)
+
+// MinimizeMetrics lists the metrics Minimization.Metric accepts
+var MinimizeMetrics = []string{MetricCC, MetricCogC, MetricLOC}
+
+// Defaults of the diff-minimizing mode
+const (
+	DefaultMinimizeMetric = MetricCC
+	DefaultMinimizeDelta  = 10.0 // Percent
+	DefaultMaxInsertions  = 16
+)
+
+// Minimization makes the strategy look for the smallest change per function
+// that still grows Metric by at least MinDelta percent, instead of the most
+// obfuscated one. The number of statements the model may insert is binary
+// searched between 1 and MaxInsertions, one request per probe; of the accepted
+// probes, the rewrite with the fewest changed lines is kept.
+type Minimization struct {
+	Metric        string
+	MinDelta      float64
+	MaxInsertions int
+}
+
+// Validate checks that the search is well-defined
+func (m Minimization) Validate() error {
+	if !slices.Contains(MinimizeMetrics, m.Metric) {
+		return fmt.Errorf("unknown metric %q (expected one of %s)", m.Metric, strings.Join(MinimizeMetrics, ", "))
+	}
+	if m.MinDelta <= 0 {
+		return fmt.Errorf("the target growth must be positive, got %g%%", m.MinDelta)
+	}
+	if m.MaxInsertions < 1 {
+		return fmt.Errorf("the insertion limit must be at least 1, got %d", m.MaxInsertions)
+	}
+	return nil
+}
+
+// MinimalRewrite is the trade-off found for one function
+type MinimalRewrite struct {
+	Function   string  `json:"function"`
+	Metric     string  `json:"metric"`
+	Target     float64 `json:"target_percent"`
+	Met        bool    `json:"met"`
+	Insertions int     `json:"insertions,omitempty"` // Statement limit of the kept rewrite
+	Delta      float64 `json:"delta_percent"`        // Growth of Metric achieved by the kept rewrite
+	DiffLines  int     `json:"diff_lines"`           // Lines added or removed by the kept rewrite
+	Probes     int     `json:"probes"`               // Requests sent during the search
+}
+
+// SetMinimization enables the diff-minimizing mode
+func (r *Rewriter) SetMinimization(m Minimization) error {
+	s, ok := r.Strategy.(baseStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support minimal rewrites", r.Strategy)
+	}
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	s.base().Minimize = &m
+	return nil
+}
+
+// insertionConstraint returns the prompt sentence that limits the inserted
+// statements during a search. It is empty otherwise, which keeps the prompt
+// and its hash as they were before minimal rewrites existed.
+func (bs *BaseStrategy) insertionConstraint() string {
+	if bs.insertionLimit <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("MINIMAL CHANGE: insert at most %d dead code statements in total and keep every existing line exactly as it is. Smaller changes are better, as long as the control flow becomes more complex.", bs.insertionLimit)
+}
+
+// setInsertionLimit sets the limit of the next requests, including the fallback's
+func (bs *BaseStrategy) setInsertionLimit(limit int) {
+	bs.insertionLimit = limit
+	if bs.Fallback != nil {
+		bs.Fallback.insertionLimit = limit
+	}
+}
+
+// rewriteUnit returns the rewrite of one function or function literal,
+// searching for the smallest accepted change in the diff-minimizing mode
+func (bs *BaseStrategy) rewriteUnit(ctx context.Context, name, functionSource string) (string, error) {
+	ctx = withUnit(ctx, name)
+	if bs.Minimize == nil {
+		return bs.rewriteFunction(ctx, name, functionSource)
+	}
+	return bs.minimizeFunction(ctx, name, functionSource)
+}
+
+// minimizeFunction binary searches the insertion limit for name. A function
+// no probe could rewrite to the target is returned unchanged.
+func (bs *BaseStrategy) minimizeFunction(ctx context.Context, name, functionSource string) (string, error) {
+	defer bs.setInsertionLimit(0)
+	m := bs.Minimize
+	result := MinimalRewrite{Function: name, Metric: m.Metric, Target: m.MinDelta}
+	before, original, err := functionMetrics(functionSource)
+	if err != nil {
+		return "", err
+	}
+
+	best := functionSource
+	lo, hi := 1, m.MaxInsertions
+	for lo <= hi {
+		limit := (lo + hi) / 2
+		bs.setInsertionLimit(limit)
+		rewritten, err := bs.rewriteFunction(ctx, name, functionSource)
+		if errors.Is(err, ErrBudgetExceeded) && result.Probes > 0 {
+			// Keep what the search found so far
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		result.Probes++
+
+		delta, diffLines, ok := bs.probeOutcome(before, original, rewritten)
+		logger.Info("Minimization probe", "function", name, "insertions", limit, "metric", m.Metric, "delta_percent", math.Round(delta*10)/10, "diff_lines", diffLines)
+		if ok && delta >= m.MinDelta {
+			if !result.Met || diffLines < result.DiffLines {
+				best = rewritten
+				result.Met, result.Insertions, result.Delta, result.DiffLines = true, limit, delta, diffLines
+			}
+			hi = limit - 1
+		} else {
+			lo = limit + 1
+		}
+	}
+
+	if result.Met {
+		logger.Info("Kept the smallest rewrite that met the target", "function", name, "diff_lines", result.DiffLines, "metric", m.Metric, "delta_percent", math.Round(result.Delta*10)/10, "probes", result.Probes)
+	} else {
+		logger.Info("Keeping function unchanged: no rewrite met the target", "function", name, "probes", result.Probes)
+	}
+	if bs.Report != nil {
+		bs.Report.addMinimal(result)
+	}
+	return best, nil
+}
+
+// probeOutcome measures a rewrite against the original function. ok is false
+// if the rewrite does not parse or renames the function.
+func (bs *BaseStrategy) probeOutcome(before *metrics.Metrics, original, rewritten string) (delta float64, diffLines int, ok bool) {
+	after, printed, err := functionMetrics(rewritten)
+	if err != nil || functionName(printed) != functionName(original) {
+		return 0, 0, false
+	}
+	switch bs.Minimize.Metric {
+	case MetricCC:
+		delta = percentGrowth(before.CC, after.CC)
+	case MetricCogC:
+		delta = percentGrowth(before.CogC, after.CogC)
+	case MetricLOC:
+		delta = percentGrowth(before.LOC, after.LOC)
+	}
+	return delta, changedLines(original, printed), true
+}
+
+// functionMetrics returns the metrics of the first function declared in
+// source, and the function formatted on its own. Package clauses and imports
+// a model returns with the function do not count.
+func functionMetrics(source string) (*metrics.Metrics, string, error) {
+	fset := token.NewFileSet()
+	content := source
+	if !packageClause.MatchString(content) {
+		content = "package p\n\n" + content
+	}
+	f, err := parser.ParseFile(fset, "", content, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse function: %w", err)
+	}
+	for _, decl := range f.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Body == nil {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := format.Node(&buf, fset, fd); err != nil {
+			return nil, "", fmt.Errorf("failed to format function: %w", err)
+		}
+		m, err := metrics.CalculateMetricsFromContent("function.go", "package p\n\n"+buf.String())
+		if err != nil {
+			return nil, "", err
+		}
+		return m, buf.String(), nil
+	}
+	return nil, "", errors.New("no function declaration found")
+}
+
+// percentGrowth is the relative change from a to b; from 0 any growth counts as 100%
+func percentGrowth(a, b int) float64 {
+	if a == 0 {
+		if b > 0 {
+			return 100
+		}
+		return 0
+	}
+	return float64(b-a) / float64(a) * 100
+}
+
+// changedLines counts the lines a line diff from a to b adds or removes
+func changedLines(a, b string) int {
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+	// Longest common subsequence, one row at a time
+	prev, cur := make([]int, len(y)+1), make([]int, len(y)+1)
+	for i := range x {
+		for j := range y {
+			if x[i] == y[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(prev[j+1], cur[j])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return len(x) + len(y) - 2*prev[len(y)]
+}
+
+// WriteMinimalRewrites prints the trade-off found for every function
+func WriteMinimalRewrites(w io.Writer, rewrites []MinimalRewrite) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FUNCTION\tTARGET\tMET\tINSERTIONS\tDELTA\tCHANGED LINES\tPROBES")
+	met := 0
+	for _, r := range rewrites {
+		insertions := "-"
+		if r.Met {
+			met++
+			insertions = fmt.Sprint(r.Insertions)
+		}
+		fmt.Fprintf(tw, "%s\t%s +%g%%\t%v\t%s\t%+.1f%%\t%d\t%d\n", r.Function, r.Metric, r.Target, r.Met, insertions, r.Delta, r.DiffLines, r.Probes)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d/%d functions met the target\n", met, len(rewrites))
+	return err
+}
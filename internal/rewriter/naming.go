@@ -0,0 +1,282 @@
+package rewriter
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"go/types"
+	"hash/fnv"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// NamingScheme selects the names TransformRename gives variables and the
+// goto transform gives labels
+type NamingScheme string
+
+const (
+	// NamingOpaque makes tokens of l, I, O, 0 and 1 such as lI0O, which
+	// look like an obfuscator's
+	NamingOpaque NamingScheme = "opaque"
+	// NamingCorporate draws from generic names of business code, such as
+	// result, payload or entryCount
+	NamingCorporate NamingScheme = "corporate"
+	// NamingDomain recombines the words of the function's own identifiers, so
+	// a function about configs gets names such as cfgEntry
+	NamingDomain NamingScheme = "domain"
+	// NamingPool draws from the names of a pool file, e.g. names an LLM
+	// suggested for the code base and a reviewer kept
+	NamingPool NamingScheme = "pool"
+)
+
+// Naming is how the deterministic strategy names what it introduces. The
+// zero value is NamingOpaque with seed 0.
+type Naming struct {
+	Scheme NamingScheme
+	// Pool holds the names of NamingPool
+	Pool []string
+	// Seed varies the names of a function and the style they are written in:
+	// rewrites with different seeds read as if different authors wrote them
+	Seed uint64
+}
+
+// corporateWords are the pool of NamingCorporate, in full and abbreviated
+var corporateWords = [][2]string{
+	{"result", "res"}, {"value", "val"}, {"payload", "pl"}, {"entry", "ent"},
+	{"record", "rec"}, {"item", "it"}, {"buffer", "buf"}, {"count", "cnt"},
+	{"index", "idx"}, {"total", "tot"}, {"current", "cur"}, {"previous", "prev"},
+	{"request", "req"}, {"response", "resp"}, {"message", "msg"}, {"status", "st"},
+	{"config", "cfg"}, {"context", "cx"}, {"handler", "hdl"}, {"manager", "mgr"},
+	{"batch", "bt"}, {"state", "sta"}, {"output", "out"}, {"input", "in"},
+	{"temp", "tmp"}, {"target", "tgt"}, {"source", "src"}, {"offset", "off"},
+	{"cursor", "cur"}, {"pending", "pend"}, {"snapshot", "snap"}, {"next", "nxt"},
+}
+
+// domainSuffixes combine with the words of the function in NamingDomain
+var domainSuffixes = []string{"Entry", "Value", "Info", "Item", "Count", "List", "Ref", "State", "Data", "Result"}
+
+// authorStyle is how one author writes names
+type authorStyle struct {
+	abbreviate bool   // cfg rather than config
+	snake      bool   // entry_count rather than entryCount
+	words      int    // Words per name, 1 or 2
+	suffix     string // Added to tell repeated names apart: "2", "Alt" or "_"
+}
+
+// newAuthorStyle returns the style of the author seed stands for
+func newAuthorStyle(seed uint64) authorStyle {
+	rng := rand.New(rand.NewPCG(seed, 0x6e616d6573))
+	return authorStyle{
+		abbreviate: rng.IntN(2) == 0,
+		snake:      rng.IntN(4) == 0,
+		words:      1 + rng.IntN(2),
+		suffix:     []string{"2", "Alt", "_"}[rng.IntN(3)],
+	}
+}
+
+// join writes words as one name in the author's style
+func (s authorStyle) join(words []string) string {
+	if s.snake {
+		return strings.ToLower(strings.Join(words, "_"))
+	}
+	name := strings.ToLower(words[0])
+	for _, w := range words[1:] {
+		name += strings.ToUpper(w[:1]) + w[1:]
+	}
+	return name
+}
+
+// ParseNaming parses a naming scheme: opaque, corporate, domain, or
+// pool:<file> with a JSON array of names
+func ParseNaming(spec string) (Naming, error) {
+	scheme, path, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	switch NamingScheme(scheme) {
+	case "", NamingOpaque:
+		return Naming{Scheme: NamingOpaque}, nil
+	case NamingCorporate, NamingDomain:
+		return Naming{Scheme: NamingScheme(scheme)}, nil
+	case NamingPool:
+		if path == "" {
+			return Naming{}, fmt.Errorf("naming pool needs a file, as pool:<names.json>")
+		}
+		pool, err := LoadNamePool(path)
+		if err != nil {
+			return Naming{}, err
+		}
+		return Naming{Scheme: NamingPool, Pool: pool}, nil
+	}
+	return Naming{}, fmt.Errorf("unknown naming scheme %q (expected opaque, corporate, domain or pool:<file>)", spec)
+}
+
+// LoadNamePool reads a JSON array of names, keeping those that are valid Go
+// identifiers and neither keywords nor predeclared
+func LoadNamePool(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read name pool: %w", err)
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, fmt.Errorf("failed to parse name pool %s: %w", path, err)
+	}
+	var pool []string
+	for _, name := range names {
+		if usableName(name) && !slices.Contains(pool, name) {
+			pool = append(pool, name)
+		}
+	}
+	if len(pool) == 0 {
+		return nil, fmt.Errorf("name pool %s has no usable names", path)
+	}
+	return pool, nil
+}
+
+// usableName reports whether name can be declared without breaking code the
+// transforms generate, which uses predeclared names such as string and byte
+func usableName(name string) bool {
+	return token.IsIdentifier(name) && name != "_" && types.Universe.Lookup(name) == nil
+}
+
+// namer hands out the new names of one function
+type namer struct {
+	naming Naming
+	style  authorStyle
+	rng    *rand.Rand
+	words  [][2]string // Words of the function's identifiers, for NamingDomain
+}
+
+// newNamer returns the namer of a function with the given identifiers
+func newNamer(naming Naming, rng *rand.Rand, identifiers map[string]bool) *namer {
+	n := &namer{naming: naming, style: newAuthorStyle(naming.Seed), rng: rng}
+	if naming.Scheme == NamingDomain {
+		seen := map[string]bool{}
+		for _, id := range slices.Sorted(maps.Keys(identifiers)) {
+			for _, w := range splitWords(id) {
+				// Words of other scripts would not abbreviate
+				if len(w) >= 3 && !seen[w] && w[0] >= 'a' && w[0] <= 'z' && len(w) == len([]rune(w)) {
+					seen[w] = true
+					n.words = append(n.words, [2]string{w, abbreviate(w)})
+				}
+			}
+		}
+	}
+	return n
+}
+
+// candidate returns a name to try; taken names are retried with a suffix
+func (n *namer) candidate(attempt int) string {
+	var name string
+	switch n.naming.Scheme {
+	case NamingCorporate:
+		name = n.compose(corporateWords, "")
+	case NamingDomain:
+		if len(n.words) == 0 {
+			name = n.compose(corporateWords, "")
+		} else {
+			name = n.compose(n.words, domainSuffixes[n.rng.IntN(len(domainSuffixes))])
+		}
+	case NamingPool:
+		name = n.naming.Pool[n.rng.IntN(len(n.naming.Pool))]
+	default:
+		const first, rest = "lIO", "lIO01"
+		b := []byte{first[n.rng.IntN(len(first))]}
+		for range 3 + n.rng.IntN(3) {
+			b = append(b, rest[n.rng.IntN(len(rest))])
+		}
+		return string(b)
+	}
+	// Pools run out in long functions; after a few draws, vary the name
+	if attempt >= 4 {
+		name += n.style.suffix
+		if attempt >= 8 {
+			name += fmt.Sprint(attempt - 6)
+		}
+	}
+	return name
+}
+
+// compose joins words of pool, with suffix as a last word if not empty
+func (n *namer) compose(pool [][2]string, suffix string) string {
+	var words []string
+	for range n.style.words {
+		w := pool[n.rng.IntN(len(pool))]
+		words = append(words, w[0])
+		if n.style.abbreviate {
+			words[len(words)-1] = w[1]
+		}
+	}
+	if suffix != "" {
+		words = append(words[:1], suffix)
+	}
+	if len(words) == 2 && words[0] == words[1] {
+		words = words[:1]
+	}
+	return n.style.join(words)
+}
+
+// splitWords splits an identifier into lower-case words at underscores and
+// at upper-case letters that start a word
+func splitWords(id string) []string {
+	var words []string
+	var word []rune
+	runes := []rune(id)
+	for i, r := range runes {
+		boundary := unicode.IsUpper(r) && i > 0 && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1]))
+		if r == '_' || boundary {
+			if len(word) > 0 {
+				words = append(words, strings.ToLower(string(word)))
+			}
+			word = nil
+		}
+		if r != '_' && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			word = append(word, r)
+		}
+	}
+	if len(word) > 0 {
+		words = append(words, strings.ToLower(string(word)))
+	}
+	return words
+}
+
+// abbreviate shortens a word the way programmers do: its consonants, keeping
+// the first letter, up to three letters
+func abbreviate(word string) string {
+	short := []byte{word[0]}
+	for i := 1; i < len(word) && len(short) < 3; i++ {
+		if !strings.ContainsRune("aeiou", rune(word[i])) {
+			short = append(short, word[i])
+		}
+	}
+	return string(short)
+}
+
+// String identifies the naming in the model name of the strategy, so that
+// incremental state and the response cache tell namings apart
+func (n Naming) String() string {
+	s := string(cmp.Or(n.Scheme, NamingOpaque))
+	if n.Scheme == NamingPool {
+		h := fnv.New32a()
+		h.Write([]byte(strings.Join(n.Pool, "\n")))
+		s += fmt.Sprintf("-%08x", h.Sum32())
+	}
+	return fmt.Sprintf("%s:%d", s, n.Seed)
+}
+
+// SetNaming selects how the deterministic strategy names variables and labels
+func (r *Rewriter) SetNaming(naming Naming) error {
+	obs, ok := r.Strategy.(*ObfuscatorStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not name identifiers", r.Strategy)
+	}
+	if naming.Scheme == NamingPool && len(naming.Pool) == 0 {
+		return fmt.Errorf("naming pool has no names")
+	}
+	obs.Naming = naming
+	obs.setModel()
+	return nil
+}
@@ -0,0 +1,235 @@
+package rewriter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultOllamaHost is where a local Ollama server listens by default
+const DefaultOllamaHost = "http://localhost:11434"
+
+// OllamaHost returns the Ollama server from OLLAMA_HOST, the variable the
+// ollama command uses, or DefaultOllamaHost
+func OllamaHost() string {
+	if host := os.Getenv("OLLAMA_HOST"); host != "" {
+		if normalized, err := NormalizeOllamaHost(host); err == nil {
+			return normalized
+		}
+	}
+	return DefaultOllamaHost
+}
+
+// NormalizeOllamaHost turns a host as OLLAMA_HOST accepts it, such as
+// "localhost", "0.0.0.0:11434" or "https://gpu-box:443", into a base URL.
+// The port defaults to 11434 and an unspecified address to localhost.
+func NormalizeOllamaHost(host string) (string, error) {
+	host = strings.TrimSpace(host)
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	u, err := url.Parse(host)
+	if err != nil || u.Hostname() == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("invalid Ollama host %q", host)
+	}
+	hostname, port := u.Hostname(), u.Port()
+	if ip := net.ParseIP(hostname); ip != nil && ip.IsUnspecified() {
+		hostname = "localhost"
+	}
+	if port == "" {
+		port = "11434"
+	}
+	u.Host = net.JoinHostPort(hostname, port)
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+// OllamaStrategy uses a local Ollama server to rewrite function bodies, so
+// rewriting needs neither API keys nor network access
+type OllamaStrategy struct {
+	BaseStrategy
+	// Host is the base URL of the Ollama server
+	Host string
+	// HTTPClient sends the requests; local models can take minutes per function
+	HTTPClient *http.Client
+}
+
+// NewOllamaStrategy creates a new Ollama strategy for the server in OLLAMA_HOST
+func NewOllamaStrategy(astHandler *ASTHandler, comment string, opts ...StrategyOption) *OllamaStrategy {
+	ols := &OllamaStrategy{
+		BaseStrategy: BaseStrategy{
+			ASTHandler: astHandler,
+			Comment:    comment,
+			Model:      DefaultOllamaModel,
+			Provider:   string(APITypeOllama),
+			Structured: true,
+			Limiter:    SharedLimiter(string(APITypeOllama)),
+			Breaker:    SharedBreaker(string(APITypeOllama)),
+		},
+		Host:       OllamaHost(),
+		HTTPClient: &http.Client{Timeout: 30 * time.Minute},
+	}
+	ols.apply(opts)
+	ols.rewriteFunc = ols.callOllamaLLM
+	return ols
+}
+
+// Offline implements offlineStrategy: the code stays on the machine if the
+// server runs on it and no remote fallback is configured
+func (ols *OllamaStrategy) Offline() bool {
+	return ols.Fallback == nil && isLoopbackURL(ols.Host)
+}
+
+// isLoopbackURL reports whether a server URL points at this machine
+func isLoopbackURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(u.Hostname())
+	return u.Hostname() == "localhost" || ip != nil && ip.IsLoopback()
+}
+
+// SetReasoningEffort is not supported by the Ollama strategy
+func (ols *OllamaStrategy) SetReasoningEffort(effort string) error {
+	if effort != "" {
+		return fmt.Errorf("reasoning effort is not supported by the Ollama strategy")
+	}
+	return nil
+}
+
+// ollamaRequest is the body of POST /api/chat
+type ollamaRequest struct {
+	Model    string             `json:"model"`
+	Messages []anthropicMessage `json:"messages"` // Same role/content shape
+	Stream   bool               `json:"stream"`
+	Format   json.RawMessage    `json:"format,omitempty"`
+	Options  ollamaOptions      `json:"options"`
+}
+
+// ollamaOptions are the generation parameters of a request
+type ollamaOptions struct {
+	Temperature float64 `json:"temperature"`
+	TopP        float64 `json:"top_p"`
+	NumPredict  int     `json:"num_predict"`
+}
+
+// ollamaResponse is the part of a non-streamed /api/chat response the strategy uses
+type ollamaResponse struct {
+	Message struct {
+		Content  string `json:"content"`
+		Thinking string `json:"thinking,omitempty"`
+	} `json:"message"`
+	DoneReason      string `json:"done_reason"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+}
+
+// ollamaError is an error response of the Ollama server
+type ollamaError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ollamaError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// HTTPStatus implements retry.StatusError
+func (e *ollamaError) HTTPStatus() int {
+	return e.StatusCode
+}
+
+// chat sends one /api/chat request
+func (ols *OllamaStrategy) chat(ctx context.Context, request ollamaRequest) (*ollamaResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ols.Host+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := ols.HTTPClient.Do(req)
+	if err != nil {
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return nil, fmt.Errorf("no Ollama server at %s; start one with 'ollama serve' or set OLLAMA_HOST", ols.Host)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Error string `json:"error"`
+		}
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &body) == nil && body.Error != "" {
+			message = body.Error
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			message += fmt.Sprintf(" (pull the model with 'ollama pull %s')", request.Model)
+		}
+		return nil, &ollamaError{StatusCode: resp.StatusCode, Message: message}
+	}
+
+	var result ollamaResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &result, nil
+}
+
+// callOllamaLLM makes an API call to the Ollama server to rewrite function code
+func (ols *OllamaStrategy) callOllamaLLM(ctx context.Context, functionSource string) (string, error) {
+	prompt := ols.prompt(functionSource)
+	sampling := ols.sampling()
+	request := ollamaRequest{
+		Model:    ols.Model,
+		Messages: []anthropicMessage{{Role: "user", Content: prompt}},
+		Options:  ollamaOptions{Temperature: sampling.Temperature, TopP: sampling.TopP, NumPredict: ols.maxTokens()},
+	}
+	if ols.Structured {
+		// Ollama constrains the output to a JSON schema passed as the format
+		request.Format = codeSchema
+	}
+	estimated := estimateTokens(prompt)
+
+	// A busy server (503) queues no more requests until it catches up
+	var resp *ollamaResponse
+	err := ols.callWithRetry(ctx, APITypeOllama, estimated, func(ctx context.Context) (err error) {
+		resp, err = ols.chat(ctx, request)
+		return err
+	})
+	if err != nil {
+		return "", retryError("Ollama", err)
+	}
+
+	ols.settleTokens(APITypeOllama, ols.Model, estimated, callUsage{Prompt: resp.PromptEvalCount, Completion: resp.EvalCount})
+
+	if resp.Message.Thinking != "" {
+		logger.Debug("Model reasoned before answering", "characters", len(resp.Message.Thinking))
+	}
+	if strings.TrimSpace(resp.Message.Content) == "" {
+		if resp.DoneReason == "length" {
+			return "", withKind(ErrEmptyResponse, fmt.Errorf("model reached the token limit before answering"))
+		}
+		return "", withKind(ErrEmptyResponse, fmt.Errorf("received empty response from Ollama"))
+	}
+	return ols.parseResponse(resp.Message.Content)
+}
@@ -0,0 +1,272 @@
+package rewriter
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/retry"
+)
+
+const (
+	// DefaultOpenAIBaseURL is where vLLM serves the OpenAI API by default
+	DefaultOpenAIBaseURL = "http://localhost:8000/v1"
+	// DefaultOpenAIKeyEnv is the environment variable holding the API key of an
+	// OpenAI-compatible server
+	DefaultOpenAIKeyEnv = "OPENAI_API_KEY"
+)
+
+// OpenAIBaseURL returns the base URL of the OpenAI-compatible server from
+// OPENAI_BASE_URL, the variable the OpenAI SDKs use, or DefaultOpenAIBaseURL
+func OpenAIBaseURL() string {
+	if base := os.Getenv("OPENAI_BASE_URL"); base != "" {
+		if normalized, err := NormalizeOpenAIBaseURL(base); err == nil {
+			return normalized
+		}
+	}
+	return DefaultOpenAIBaseURL
+}
+
+// NormalizeOpenAIBaseURL checks a base URL such as "http://localhost:1234/v1"
+// and removes its trailing slash. The path is kept as given, since servers
+// differ in where they mount the API.
+func NormalizeOpenAIBaseURL(base string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(base))
+	if err != nil || u.Hostname() == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("invalid OpenAI-compatible base URL %q", base)
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+// OpenAICompatibleStrategy rewrites function bodies with any server that
+// implements the OpenAI chat completions API, such as vLLM, LM Studio or the
+// llama.cpp server
+type OpenAICompatibleStrategy struct {
+	BaseStrategy
+	// BaseURL is the URL the API is mounted at, without /chat/completions
+	BaseURL string
+	// KeyEnv names the environment variable holding the API key; servers
+	// without authentication need none
+	KeyEnv string
+	// HTTPClient sends the requests; self-hosted models can take minutes per function
+	HTTPClient *http.Client
+	// apiKey is set by SetAPIKeys, which also clears KeyEnv
+	apiKey string
+}
+
+// NewOpenAICompatibleStrategy creates a new strategy for the server in OPENAI_BASE_URL.
+// The server decides which models exist, so the model defaults to OPENAI_MODEL.
+func NewOpenAICompatibleStrategy(astHandler *ASTHandler, comment string, opts ...StrategyOption) *OpenAICompatibleStrategy {
+	oas := &OpenAICompatibleStrategy{
+		BaseStrategy: BaseStrategy{
+			ASTHandler: astHandler,
+			Comment:    comment,
+			Model:      os.Getenv("OPENAI_MODEL"),
+			Provider:   string(APITypeOpenAICompatible),
+			Structured: true,
+			Limiter:    SharedLimiter(string(APITypeOpenAICompatible)),
+			Breaker:    SharedBreaker(string(APITypeOpenAICompatible)),
+		},
+		BaseURL:    OpenAIBaseURL(),
+		KeyEnv:     DefaultOpenAIKeyEnv,
+		HTTPClient: &http.Client{Timeout: 30 * time.Minute},
+	}
+	oas.apply(opts)
+	oas.rewriteFunc = oas.callOpenAICompatibleLLM
+	return oas
+}
+
+// Offline implements offlineStrategy: the code stays on the machine if the
+// server runs on it and no remote fallback is configured
+func (oas *OpenAICompatibleStrategy) Offline() bool {
+	return oas.Fallback == nil && isLoopbackURL(oas.BaseURL)
+}
+
+// SetOpenAIKeyEnv makes the OpenAI-compatible strategy and fallback read their
+// API key from the named environment variable instead of DefaultOpenAIKeyEnv
+func (r *Rewriter) SetOpenAIKeyEnv(name string) error {
+	found := false
+	for _, s := range []RewriteStrategy{r.Strategy, r.fallback} {
+		if oas, ok := s.(*OpenAICompatibleStrategy); ok {
+			oas.KeyEnv = name
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("strategy %T is not an OpenAI-compatible strategy", r.Strategy)
+	}
+	return nil
+}
+
+// openAIMessage is a message of a chat completion request or response
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// ReasoningContent is where vLLM and others put the reasoning of reasoning models
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+}
+
+// openAIRequest is the body of POST /chat/completions
+type openAIRequest struct {
+	Model           string          `json:"model"`
+	Messages        []openAIMessage `json:"messages"`
+	Temperature     float64         `json:"temperature"`
+	TopP            float64         `json:"top_p"`
+	MaxTokens       int             `json:"max_tokens"`
+	ReasoningEffort string          `json:"reasoning_effort,omitempty"`
+	ResponseFormat  json.RawMessage `json:"response_format,omitempty"`
+}
+
+// openAIResponse is the part of a chat completion the strategy uses
+type openAIResponse struct {
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// openAIError is an error response of an OpenAI-compatible server
+type openAIError struct {
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration // From the Retry-After header, 0 if absent
+}
+
+func (e *openAIError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// HTTPStatus implements retry.StatusError
+func (e *openAIError) HTTPStatus() int {
+	return e.StatusCode
+}
+
+// RetryDelay implements retry.DelayError
+func (e *openAIError) RetryDelay() time.Duration {
+	return e.RetryAfter
+}
+
+// openAIResponseFormat requests a response matching codeSchema
+var openAIResponseFormat = json.RawMessage(`{"type": "json_schema", "json_schema": {"name": "rewritten_code", "strict": true, "schema": ` + string(codeSchema) + `}}`)
+
+// chat sends one /chat/completions request
+func (oas *OpenAICompatibleStrategy) chat(ctx context.Context, request openAIRequest) (*openAIResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, oas.BaseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if key := cmp.Or(oas.apiKey, os.Getenv(oas.KeyEnv)); key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	resp, err := oas.HTTPClient.Do(req)
+	if err != nil {
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return nil, fmt.Errorf("no OpenAI-compatible server at %s; start one or set OPENAI_BASE_URL", oas.BaseURL)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &body) == nil && body.Error.Message != "" {
+			message = body.Error.Message
+		}
+		if resp.StatusCode == http.StatusUnauthorized && oas.KeyEnv != "" {
+			message += fmt.Sprintf(" (set the API key in %s)", oas.KeyEnv)
+		}
+		return nil, &openAIError{StatusCode: resp.StatusCode, Message: message, RetryAfter: retry.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+	}
+
+	var result openAIResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &result, nil
+}
+
+// callOpenAICompatibleLLM makes an API call to the OpenAI-compatible server to rewrite function code
+func (oas *OpenAICompatibleStrategy) callOpenAICompatibleLLM(ctx context.Context, functionSource string) (string, error) {
+	if oas.Model == "" {
+		return "", fmt.Errorf("the OpenAI-compatible strategy needs a model name; pass one or set OPENAI_MODEL")
+	}
+	prompt := oas.prompt(functionSource)
+	sampling := oas.sampling()
+	request := openAIRequest{
+		Model:           oas.Model,
+		Messages:        []openAIMessage{{Role: "user", Content: prompt}},
+		Temperature:     sampling.Temperature,
+		TopP:            sampling.TopP,
+		MaxTokens:       oas.maxTokens(),
+		ReasoningEffort: oas.ReasoningEffort,
+	}
+	if oas.Structured {
+		request.ResponseFormat = openAIResponseFormat
+	}
+	estimated := estimateTokens(prompt)
+
+	// Retry rate limits and busy servers
+	var resp *openAIResponse
+	err := oas.callWithRetry(ctx, APITypeOpenAICompatible, estimated, func(ctx context.Context) (err error) {
+		resp, err = oas.chat(ctx, request)
+		return err
+	})
+	if err != nil {
+		return "", retryError("the OpenAI-compatible server", err)
+	}
+
+	// Not every server reports usage, or more than the total
+	usage := callUsage{Prompt: resp.Usage.PromptTokens, Completion: resp.Usage.CompletionTokens}
+	if usage.Completion == 0 {
+		usage.Completion = resp.Usage.TotalTokens - usage.Prompt
+	}
+	if usage.Prompt+usage.Completion <= 0 {
+		usage = callUsage{Prompt: estimated}
+	}
+	oas.settleTokens(APITypeOpenAICompatible, oas.Model, estimated, usage)
+
+	if len(resp.Choices) == 0 {
+		return "", withKind(ErrEmptyResponse, fmt.Errorf("received no choices from the OpenAI-compatible server"))
+	}
+	choice := resp.Choices[0]
+	if choice.Message.ReasoningContent != "" {
+		logger.Debug("Model reasoned before answering", "characters", len(choice.Message.ReasoningContent))
+	}
+	if strings.TrimSpace(choice.Message.Content) == "" {
+		if choice.FinishReason == "length" {
+			return "", withKind(ErrEmptyResponse, fmt.Errorf("model reached the token limit before answering"))
+		}
+		return "", withKind(ErrEmptyResponse, fmt.Errorf("received empty response from the OpenAI-compatible server"))
+	}
+	return oas.parseResponse(choice.Message.Content)
+}
@@ -0,0 +1,103 @@
+package rewriter
+
+import "fmt"
+
+// DefaultMaxTokens caps the answer of every provider unless overridden. Extended
+// thinking tokens of Claude models come on top.
+const DefaultMaxTokens = 8192
+
+// StrategyOption configures an LLM strategy when it is created, e.g.
+// NewOpenRouterStrategy(h, comment, WithModel("qwen/qwen3-coder"))
+type StrategyOption func(*BaseStrategy)
+
+// WithModel selects the model; an empty name keeps the provider's default
+func WithModel(model string) StrategyOption {
+	return func(bs *BaseStrategy) {
+		if model != "" {
+			bs.Model = model
+		}
+	}
+}
+
+// WithTemperature sets the sampling temperature, keeping the top-p
+func WithTemperature(temperature float64) StrategyOption {
+	return func(bs *BaseStrategy) {
+		s := bs.sampling()
+		s.Temperature = temperature
+		bs.Sampling = &s
+	}
+}
+
+// WithTopP sets the nucleus sampling (top-p), keeping the temperature
+func WithTopP(topP float64) StrategyOption {
+	return func(bs *BaseStrategy) {
+		s := bs.sampling()
+		s.TopP = topP
+		bs.Sampling = &s
+	}
+}
+
+// WithMaxTokens caps the answer at n tokens; 0 keeps DefaultMaxTokens
+func WithMaxTokens(n int) StrategyOption {
+	return func(bs *BaseStrategy) {
+		bs.MaxTokens = n
+	}
+}
+
+// WithMaxAttempts makes at most n calls per request, retries included; 0
+// keeps retry.DefaultMaxAttempts
+func WithMaxAttempts(n int) StrategyOption {
+	return func(bs *BaseStrategy) {
+		bs.Retry.MaxAttempts = n
+	}
+}
+
+// apply runs the options on the strategy
+func (bs *BaseStrategy) apply(opts []StrategyOption) {
+	for _, opt := range opts {
+		opt(bs)
+	}
+}
+
+// maxTokens returns the answer limit of the strategy's requests
+func (bs *BaseStrategy) maxTokens() int {
+	if bs.MaxTokens <= 0 {
+		return DefaultMaxTokens
+	}
+	return bs.MaxTokens
+}
+
+// SetMaxTokens caps the answers of the strategy and its fallback at n tokens
+func (r *Rewriter) SetMaxTokens(n int) error {
+	s, ok := r.Strategy.(baseStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support a token limit", r.Strategy)
+	}
+	if n <= 0 {
+		return fmt.Errorf("max tokens must be positive, got %d", n)
+	}
+	bs := s.base()
+	bs.MaxTokens = n
+	if bs.Fallback != nil {
+		bs.Fallback.MaxTokens = n
+	}
+	return nil
+}
+
+// SetMaxAttempts makes the strategy and its fallback send every request at
+// most n times, retrying rate limits and transient failures
+func (r *Rewriter) SetMaxAttempts(n int) error {
+	s, ok := r.Strategy.(baseStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support retries", r.Strategy)
+	}
+	if n <= 0 {
+		return fmt.Errorf("max attempts must be positive, got %d", n)
+	}
+	bs := s.base()
+	bs.Retry.MaxAttempts = n
+	if bs.Fallback != nil {
+		bs.Fallback.Retry.MaxAttempts = n
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package rewriter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+)
+
+// originMapVersion is bumped whenever the origin map format changes
+const originMapVersion = 1
+
+// OriginMap links the lines of a rewritten file back to the original, like a
+// source map, so positions in stack traces of rewritten binaries can be
+// explained. Lines the rewriter kept are mapped exactly; lines it added are
+// only attributed to their function.
+type OriginMap struct {
+	Version         int              `json:"version"`
+	Original        string           `json:"original"`
+	Rewritten       string           `json:"rewritten"`
+	RewrittenSHA256 string           `json:"rewritten_sha256"` // Detects a map that no longer matches its file
+	Functions       []FunctionOrigin `json:"functions"`
+	Lines           []LineSpan       `json:"lines"` // Kept lines, ordered by rewritten line
+}
+
+// FunctionOrigin is where a function is in both versions, from its func
+// keyword to its closing brace
+type FunctionOrigin struct {
+	Function  string    `json:"function"` // Name, with the receiver type for methods, e.g. "(*Server).Run"
+	Original  LineRange `json:"original"`
+	Rewritten LineRange `json:"rewritten"`
+}
+
+// LineRange is an inclusive range of 1-based lines
+type LineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// LineSpan maps Count consecutive rewritten lines to the same original lines
+type LineSpan struct {
+	Rewritten int `json:"rewritten"`
+	Original  int `json:"original"`
+	Count     int `json:"count"`
+}
+
+// Origin explains one line of the rewritten file
+type Origin struct {
+	Function     string `json:"function,omitempty"`      // Empty outside functions
+	Line         int    `json:"line,omitempty"`          // Original line, 0 if the rewriter added the line
+	After        int    `json:"after,omitempty"`         // For an added line, the closest original line above it
+	FunctionLine int    `json:"function_line,omitempty"` // Original line of the function's func keyword
+}
+
+// OriginMapPath returns where the origin map of an output file is written
+func OriginMapPath(output string) string {
+	return output + ".origin.json"
+}
+
+// BuildOriginMap maps the rewritten file back to the original. Functions are
+// paired by name; within each function, and between functions, unchanged
+// lines are aligned along their longest common subsequence, ignoring
+// indentation.
+func BuildOriginMap(originalPath, original, rewrittenPath, rewritten string) (*OriginMap, error) {
+	before, err := originFunctions(original)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse original source: %w", err)
+	}
+	after, err := originFunctions(rewritten)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rewritten source: %w", err)
+	}
+
+	sum := sha256.Sum256([]byte(rewritten))
+	om := &OriginMap{
+		Version:         originMapVersion,
+		Original:        originalPath,
+		Rewritten:       rewrittenPath,
+		RewrittenSHA256: hex.EncodeToString(sum[:]),
+	}
+	originals := make(map[string]LineRange)
+	for _, f := range before {
+		originals[f.Function] = f.Original
+	}
+	for _, f := range after {
+		if r, ok := originals[f.Function]; ok {
+			om.Functions = append(om.Functions, FunctionOrigin{Function: f.Function, Original: r, Rewritten: f.Original})
+		}
+	}
+
+	a, b := strings.Split(original, "\n"), strings.Split(rewritten, "\n")
+	// The text between two paired functions is aligned only if both versions
+	// have it in the same order
+	prevA, prevB := 0, 0
+	for _, f := range om.Functions {
+		if f.Original.Start > prevA {
+			om.Lines = append(om.Lines, alignLines(a, b, prevA, f.Original.Start-1, prevB, f.Rewritten.Start-1)...)
+			om.Lines = append(om.Lines, alignLines(a, b, f.Original.Start-1, f.Original.End, f.Rewritten.Start-1, f.Rewritten.End)...)
+			prevA, prevB = f.Original.End, f.Rewritten.End
+		}
+	}
+	om.Lines = append(om.Lines, alignLines(a, b, prevA, len(a), prevB, len(b))...)
+	sort.Slice(om.Lines, func(i, j int) bool { return om.Lines[i].Rewritten < om.Lines[j].Rewritten })
+	return om, nil
+}
+
+// originFunctions returns the functions of a file in source order, with their
+// line range stored in Original
+func originFunctions(source string) ([]FunctionOrigin, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", source, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	var functions []FunctionOrigin
+	for _, decl := range f.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		functions = append(functions, FunctionOrigin{
+			Function: originName(fd),
+			Original: LineRange{Start: fset.Position(fd.Pos()).Line, End: fset.Position(fd.End()).Line},
+		})
+	}
+	return functions, nil
+}
+
+// originName returns the name of a function, with the receiver type for methods
+func originName(fd *ast.FuncDecl) string {
+	if fd.Recv == nil || len(fd.Recv.List) == 0 {
+		return fd.Name.Name
+	}
+	recv := fd.Recv.List[0].Type
+	star := ""
+	if s, ok := recv.(*ast.StarExpr); ok {
+		recv, star = s.X, "*"
+	}
+	// Type parameters of generic receivers are left out
+	switch r := recv.(type) {
+	case *ast.IndexExpr:
+		recv = r.X
+	case *ast.IndexListExpr:
+		recv = r.X
+	}
+	if id, ok := recv.(*ast.Ident); ok {
+		return fmt.Sprintf("(%s%s).%s", star, id.Name, fd.Name.Name)
+	}
+	return fd.Name.Name
+}
+
+// alignLines maps the lines b[bFrom:bTo] that also occur, in the same order,
+// in a[aFrom:aTo]. Blank lines are not mapped.
+func alignLines(a, b []string, aFrom, aTo, bFrom, bTo int) []LineSpan {
+	x, y := a[aFrom:min(aTo, len(a))], b[bFrom:min(bTo, len(b))]
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if sameLine(x[i], y[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var spans []LineSpan
+	for i, j := 0, 0; i < len(x) && j < len(y); {
+		switch {
+		case sameLine(x[i], y[j]):
+			original, rewritten := aFrom+i+1, bFrom+j+1
+			if n := len(spans); n > 0 && spans[n-1].Rewritten+spans[n-1].Count == rewritten && spans[n-1].Original+spans[n-1].Count == original {
+				spans[n-1].Count++
+			} else {
+				spans = append(spans, LineSpan{Rewritten: rewritten, Original: original, Count: 1})
+			}
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return spans
+}
+
+// sameLine reports whether two non-blank lines are equal apart from indentation
+func sameLine(a, b string) bool {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	return a != "" && a == b
+}
+
+// Explain returns the origin of a line of the rewritten file
+func (om *OriginMap) Explain(line int) Origin {
+	var origin Origin
+	for _, f := range om.Functions {
+		if line >= f.Rewritten.Start && line <= f.Rewritten.End {
+			origin.Function, origin.FunctionLine = f.Function, f.Original.Start
+			break
+		}
+	}
+	for _, s := range om.Lines {
+		if s.Rewritten > line {
+			break
+		}
+		if line < s.Rewritten+s.Count {
+			origin.Line, origin.After = s.Original+line-s.Rewritten, 0
+			return origin
+		}
+		origin.After = s.Original + s.Count - 1
+	}
+	return origin
+}
+
+// Save writes the origin map as indented JSON
+func (om *OriginMap) Save(path string) error {
+	data, err := json.MarshalIndent(om, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode origin map: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write origin map: %w", err)
+	}
+	return nil
+}
+
+// LoadOriginMap reads an origin map written by Save
+func LoadOriginMap(path string) (*OriginMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read origin map: %w", err)
+	}
+	var om OriginMap
+	if err := json.Unmarshal(data, &om); err != nil {
+		return nil, fmt.Errorf("failed to parse origin map %s: %w", path, err)
+	}
+	if om.Version != originMapVersion {
+		return nil, fmt.Errorf("origin map %s has version %d, expected %d", path, om.Version, originMapVersion)
+	}
+	return &om, nil
+}
@@ -0,0 +1,148 @@
+package rewriter
+
+import (
+	"context"
+	"fmt"
+	"go/build"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PackageOptions selects the files RewritePackage rewrites and where it writes them
+type PackageOptions struct {
+	// OutputDir receives every rewritten file under its path relative to the
+	// input directory; empty writes <file>.rewritten.go next to each file
+	OutputDir string
+	// Tests also rewrites _test.go files
+	Tests bool
+	// BuildTags are the tags build constraints are evaluated with, on top of
+	// the GOOS and GOARCH of the go command; excluded files are not rewritten
+	BuildTags []string
+	// Skip refuses vendored, third-party and generated files
+	Skip SkipRules
+}
+
+// PackageFile is the outcome of one Go file found by RewritePackage
+type PackageFile struct {
+	Input   string `json:"input"`
+	Output  string `json:"output,omitempty"`  // Empty if the file was skipped
+	Skipped string `json:"skipped,omitempty"` // Why the file was not rewritten
+}
+
+// RewritePackage rewrites every Go file in dir and its subdirectories and
+// writes the results. Like the go command, it ignores testdata directories and
+// directories starting with "." or "_". Rewritten copies from earlier runs are
+// never rewritten again.
+func (r *Rewriter) RewritePackage(ctx context.Context, dir string, opts PackageOptions) ([]PackageFile, error) {
+	inputs, err := packageFiles(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]PackageFile, 0, len(inputs))
+	for _, file := range inputs {
+		if file.Skipped != "" {
+			logger.Info("Skipping file", "file", file.Input, "reason", file.Skipped)
+			files = append(files, file)
+			continue
+		}
+		content, err := r.FileHandler.ReadFile(file.Input)
+		if err != nil {
+			return files, err
+		}
+		if reason := opts.Skip.Reason(file.Input, content); reason != "" {
+			file.Skipped = reason
+			logger.Info("Skipping file", "file", file.Input, "reason", file.Skipped)
+			files = append(files, file)
+			continue
+		}
+
+		logger.Info("Rewriting file", "file", file.Input, "output", file.Output)
+		rewritten, err := r.RewriteContent(ctx, content)
+		if err != nil {
+			return files, fmt.Errorf("failed to rewrite %s: %w", file.Input, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(file.Output), 0755); err != nil {
+			return files, fmt.Errorf("failed to create output directory: %w", err)
+		}
+		if err := r.SaveRewrittenFile(file.Output, rewritten); err != nil {
+			return files, fmt.Errorf("failed to write %s: %w", file.Output, err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// packageFiles lists the Go files RewritePackage considers, in lexical order,
+// with their output path or the reason they are skipped
+func packageFiles(dir string, opts PackageOptions) ([]PackageFile, error) {
+	ctx := build.Default
+	ctx.BuildTags = opts.BuildTags
+	outputDir := ""
+	if opts.OutputDir != "" {
+		abs, err := filepath.Abs(opts.OutputDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve output directory: %w", err)
+		}
+		outputDir = abs
+		if in, err := filepath.Abs(dir); err == nil && in == abs {
+			return nil, fmt.Errorf("output directory %s would overwrite the input files", opts.OutputDir)
+		}
+	}
+
+	var files []PackageFile
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path == dir {
+				return nil
+			}
+			if name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			// An output directory inside the input is not input
+			if abs, err := filepath.Abs(path); err == nil && abs == outputDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, ".rewritten.go") {
+			return nil
+		}
+
+		file := PackageFile{Input: path}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasSuffix(name, "_test.go") && !opts.Tests:
+			file.Skipped = "a test file"
+		case opts.Skip.PathReason(path) != "":
+			file.Skipped = opts.Skip.PathReason(path)
+		default:
+			match, err := ctx.MatchFile(filepath.Dir(path), name)
+			if err != nil {
+				return fmt.Errorf("failed to evaluate build constraints of %s: %w", path, err)
+			}
+			if !match {
+				file.Skipped = "excluded by build constraints"
+			} else if outputDir != "" {
+				file.Output = filepath.Join(opts.OutputDir, rel)
+			} else {
+				file.Output = path + ".rewritten.go"
+			}
+		}
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", dir, err)
+	}
+	return files, nil
+}
@@ -0,0 +1,205 @@
+package rewriter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limiter is a token-bucket rate limiter for one provider, limiting both
+// requests per minute and tokens per minute. A single Limiter is shared by every
+// strategy and worker talking to the same provider (see SharedLimiter), so
+// concurrent rewrites stay under the provider's quota together and a rate-limit
+// response pauses all of them instead of each backing off on its own.
+//
+// A zero limit means unlimited. All methods are safe for concurrent use and
+// on a nil Limiter, which never blocks.
+type Limiter struct {
+	mu          sync.Mutex
+	requests    bucket
+	tokens      bucket
+	pausedUntil time.Time
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// bucket holds up to one minute's worth of capacity and refills continuously
+type bucket struct {
+	perMinute int
+	available float64
+	last      time.Time
+}
+
+// NewLimiter creates a limiter allowing rpm requests and tpm tokens per minute
+func NewLimiter(rpm, tpm int) *Limiter {
+	l := &Limiter{now: time.Now, sleep: sleepContext}
+	l.SetLimits(rpm, tpm)
+	return l
+}
+
+var (
+	sharedMu       sync.Mutex
+	sharedLimiters = map[string]*Limiter{}
+)
+
+// SharedLimiter returns the process-wide limiter for a provider, creating an
+// unlimited one on first use
+func SharedLimiter(provider string) *Limiter {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	l, ok := sharedLimiters[provider]
+	if !ok {
+		l = NewLimiter(0, 0)
+		sharedLimiters[provider] = l
+	}
+	return l
+}
+
+// ConfigureRateLimits sets shared limiters from a comma-separated spec of
+// provider=rpm or provider=rpm/tpm entries, e.g. "openrouter=20,gemini=15/1000000"
+func ConfigureRateLimits(spec string) error {
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		provider, limits, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("invalid rate limit %q: expected provider=rpm[/tpm]", entry)
+		}
+		rpmText, tpmText, _ := strings.Cut(limits, "/")
+		rpm, err := strconv.Atoi(rpmText)
+		if err != nil || rpm < 0 {
+			return fmt.Errorf("invalid requests per minute in %q", entry)
+		}
+		tpm := 0
+		if tpmText != "" {
+			if tpm, err = strconv.Atoi(tpmText); err != nil || tpm < 0 {
+				return fmt.Errorf("invalid tokens per minute in %q", entry)
+			}
+		}
+		SharedLimiter(strings.TrimSpace(provider)).SetLimits(rpm, tpm)
+	}
+	return nil
+}
+
+// SetLimits changes the limits; buckets start full
+func (l *Limiter) SetLimits(rpm, tpm int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.requests = bucket{perMinute: rpm, available: float64(rpm), last: now}
+	l.tokens = bucket{perMinute: tpm, available: float64(tpm), last: now}
+}
+
+// Wait blocks until one request using about tokens tokens may be sent
+func (l *Limiter) Wait(ctx context.Context, tokens int) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	for {
+		l.mu.Lock()
+		now := l.now()
+		l.requests.refill(now)
+		l.tokens.refill(now)
+
+		delay := l.pausedUntil.Sub(now)
+		delay = max(delay, l.requests.delay(1), l.tokens.delay(tokens))
+		if delay <= 0 {
+			l.requests.take(1)
+			l.tokens.take(tokens)
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+
+		if err := l.sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// Settle corrects the token bucket once the provider reports the actual usage
+// of a request that was admitted with an estimate
+func (l *Limiter) Settle(estimated, actual int) {
+	if l == nil || actual <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens.refill(l.now())
+	l.tokens.take(actual - estimated)
+}
+
+// Backoff pauses every caller of the limiter for d after a rate-limit response.
+// On a nil Limiter it simply sleeps.
+func (l *Limiter) Backoff(d time.Duration) {
+	if l == nil {
+		time.Sleep(d)
+		return
+	}
+	l.mu.Lock()
+	if until := l.now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	l.mu.Unlock()
+}
+
+// refill adds the capacity accrued since the last refill
+func (b *bucket) refill(now time.Time) {
+	if b.perMinute <= 0 {
+		return
+	}
+	elapsed := now.Sub(b.last)
+	b.last = now
+	if elapsed <= 0 {
+		return
+	}
+	b.available = min(b.available+elapsed.Minutes()*float64(b.perMinute), float64(b.perMinute))
+}
+
+// delay returns how long until n units are available. Requests larger than the
+// bucket only wait for a full bucket and then leave it in debt.
+func (b *bucket) delay(n int) time.Duration {
+	if b.perMinute <= 0 {
+		return 0
+	}
+	need := min(float64(n), float64(b.perMinute))
+	if b.available >= need {
+		return 0
+	}
+	return time.Duration((need - b.available) / float64(b.perMinute) * float64(time.Minute))
+}
+
+// take removes n units; negative n returns units to the bucket
+func (b *bucket) take(n int) {
+	if b.perMinute <= 0 {
+		return
+	}
+	b.available = min(b.available-float64(n), float64(b.perMinute))
+}
+
+// estimateTokens approximates the token count of a request before it is sent,
+// using the common four characters per token heuristic
+func estimateTokens(prompt string) int {
+	return len(prompt)/4 + 1
+}
+
+// sleepContext sleeps for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
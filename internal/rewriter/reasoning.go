@@ -0,0 +1,72 @@
+package rewriter
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ReasoningEfforts lists the accepted reasoning effort levels, from least to most
+var ReasoningEfforts = []string{"none", "minimal", "low", "medium", "high", "xhigh"}
+
+// reasoningBlock matches reasoning that models such as DeepSeek-R1 inline in their answer
+var reasoningBlock = regexp.MustCompile(`(?s)<(?:think|thinking|reasoning)>.*?</(?:think|thinking|reasoning)>`)
+
+// reasoningTags are the opening and closing tags handled when a block is incomplete
+var reasoningTags = []string{"think", "thinking", "reasoning"}
+
+// stripReasoning removes inline reasoning blocks from a model response. A block whose
+// opening tag was dropped by the provider is removed up to its closing tag; one that
+// was never closed (e.g. cut off by the token limit) is removed up to the first code
+// fence, or entirely if there is none.
+func stripReasoning(response string) string {
+	result := reasoningBlock.ReplaceAllString(response, "")
+
+	for _, tag := range reasoningTags {
+		if idx := strings.Index(result, "</"+tag+">"); idx != -1 {
+			result = result[idx+len(tag)+3:]
+		}
+		if idx := strings.Index(result, "<"+tag+">"); idx != -1 {
+			rest := result[idx:]
+			if fence := strings.Index(rest, "```"); fence != -1 {
+				result = result[:idx] + rest[fence:]
+			} else {
+				result = result[:idx]
+			}
+		}
+	}
+	return result
+}
+
+// SetReasoningEffort sets how much the model should reason before answering.
+// An empty effort leaves the provider's default.
+func (bs *BaseStrategy) SetReasoningEffort(effort string) error {
+	if effort != "" && !slices.Contains(ReasoningEfforts, effort) {
+		return fmt.Errorf("unknown reasoning effort %q (expected one of %s)", effort, strings.Join(ReasoningEfforts, ", "))
+	}
+	bs.ReasoningEffort = effort
+	return nil
+}
+
+// SetReasoningEffort is not supported by the Gemini client
+func (ls *LLMStrategy) SetReasoningEffort(effort string) error {
+	if effort != "" {
+		return fmt.Errorf("reasoning effort is not supported by the Gemini strategy")
+	}
+	return nil
+}
+
+// reasoningStrategy is implemented by strategies with configurable reasoning
+type reasoningStrategy interface {
+	SetReasoningEffort(effort string) error
+}
+
+// SetReasoningEffort configures the reasoning effort if the current strategy supports it
+func (r *Rewriter) SetReasoningEffort(effort string) error {
+	s, ok := r.Strategy.(reasoningStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support reasoning effort", r.Strategy)
+	}
+	return s.SetReasoningEffort(effort)
+}
@@ -0,0 +1,141 @@
+package rewriter
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// StrategyFactory creates a strategy that rewrites with the given ASTHandler
+// and marks rewritten functions with comment. The options configure a
+// BaseStrategy; the first one is WithModel, so a strategy that does not embed
+// BaseStrategy can apply them to a zero BaseStrategy to read the model.
+type StrategyFactory func(astHandler *ASTHandler, comment string, opts ...StrategyOption) RewriteStrategy
+
+// registeredStrategy is a strategy factory and the comment of its rewrites
+type registeredStrategy struct {
+	factory StrategyFactory
+	comment string
+	builtin bool
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[APIType]registeredStrategy{
+		APITypeGemini: {
+			factory: func(h *ASTHandler, comment string, opts ...StrategyOption) RewriteStrategy {
+				return NewLLMStrategy(h, comment, opts...)
+			},
+			comment: "// This function was rewritten by Gemini LLM",
+			builtin: true,
+		},
+		APITypeOpenRouter: {
+			factory: func(h *ASTHandler, comment string, opts ...StrategyOption) RewriteStrategy {
+				return NewOpenRouterStrategy(h, comment, opts...)
+			},
+			comment: "// This function was rewritten by OpenRouter LLM",
+			builtin: true,
+		},
+		APITypeAnthropic: {
+			factory: func(h *ASTHandler, comment string, opts ...StrategyOption) RewriteStrategy {
+				return NewClaudeStrategy(h, comment, opts...)
+			},
+			comment: "// This function was rewritten by Claude LLM",
+			builtin: true,
+		},
+		APITypeOllama: {
+			factory: func(h *ASTHandler, comment string, opts ...StrategyOption) RewriteStrategy {
+				return NewOllamaStrategy(h, comment, opts...)
+			},
+			comment: "// This function was rewritten by a local Ollama LLM",
+			builtin: true,
+		},
+		APITypeOpenAICompatible: {
+			factory: func(h *ASTHandler, comment string, opts ...StrategyOption) RewriteStrategy {
+				return NewOpenAICompatibleStrategy(h, comment, opts...)
+			},
+			comment: "// This function was rewritten by an OpenAI-compatible LLM",
+			builtin: true,
+		},
+		APITypeNone: {
+			factory: func(h *ASTHandler, comment string, opts ...StrategyOption) RewriteStrategy {
+				return NewObfuscatorStrategy(h, comment, opts...)
+			},
+			comment: "// This function was rewritten by MetamorphLLM (deterministic)",
+			builtin: true,
+		},
+	}
+)
+
+// RegisterStrategy makes a strategy available by name, e.g. to -api of the
+// rewriter, so that custom strategies can be plugged in from an init function.
+// Its rewrites are marked "// This function was rewritten by <name>".
+// Like database/sql.Register, it panics if the name is empty or taken, or if
+// factory is nil.
+func RegisterStrategy(name string, factory StrategyFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if name == "" {
+		panic("rewriter: RegisterStrategy with an empty name")
+	}
+	if factory == nil {
+		panic("rewriter: RegisterStrategy factory is nil for " + name)
+	}
+	if _, dup := registry[APIType(name)]; dup {
+		panic("rewriter: RegisterStrategy called twice for " + name)
+	}
+	registry[APIType(name)] = registeredStrategy{
+		factory: factory,
+		comment: "// This function was rewritten by " + name,
+	}
+}
+
+// Strategies returns the names of the registered strategies, sorted
+func Strategies() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, string(name))
+	}
+	slices.Sort(names)
+	return names
+}
+
+// IsRegisteredStrategy reports whether a strategy of that name was registered
+func IsRegisteredStrategy(name string) bool {
+	_, ok := lookupStrategy(APIType(name))
+	return ok
+}
+
+// IsBuiltinStrategy reports whether the strategy ships with the rewriter.
+// Built-in strategies embed BaseStrategy and support every Set method of Rewriter.
+func IsBuiltinStrategy(name string) bool {
+	s, ok := lookupStrategy(APIType(name))
+	return ok && s.builtin
+}
+
+// lookupStrategy returns the registration of a strategy
+func lookupStrategy(apiType APIType) (registeredStrategy, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	s, ok := registry[apiType]
+	return s, ok
+}
+
+// NewStrategyRewriter creates a Rewriter with the registered strategy of that
+// name. An empty model name selects the strategy's default model.
+func NewStrategyRewriter(name, model string, opts ...StrategyOption) (*Rewriter, error) {
+	s, ok := lookupStrategy(APIType(name))
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q (registered: %v)", name, Strategies())
+	}
+	astHandler := NewASTHandler()
+	opts = append([]StrategyOption{WithModel(model)}, opts...)
+	return &Rewriter{
+		FileHandler:    &FileHandler{},
+		ASTHandler:     astHandler,
+		Strategy:       s.factory(astHandler, s.comment, opts...),
+		DefaultComment: s.comment,
+	}, nil
+}
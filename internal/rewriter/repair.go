@@ -0,0 +1,134 @@
+package rewriter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// DefaultRepairs is how many times the rewriter CLI sends a rejected rewrite
+// back to the LLM
+const DefaultRepairs = 2
+
+// rejection is why a rewrite was not applied
+type rejection struct {
+	comment string // Added to a function that keeps its original body
+	err     error  // Reported, and shown to the LLM when it repairs the rewrite
+}
+
+// rewrittenBody parses the rewrite of a function or function literal, given
+// as the declaration original, and returns its body, unless it does not
+// parse, declares no function, is rejected by a verifier or, with a checker,
+// introduces type errors in place of *body. Imports the body needs are
+// added to file.
+func (bs *BaseStrategy) rewrittenBody(file *ast.File, name string, original *ast.FuncDecl, rewrittenSource string, body **ast.BlockStmt, checker *bodyChecker) (*ast.BlockStmt, *rejection) {
+	rewrittenFile, err := bs.ASTHandler.ParseSnippet(rewrittenSource)
+	if err != nil {
+		logger.Warn("Failed to parse rewritten code", "function", name, "error", err)
+		return nil, &rejection{
+			comment: fmt.Sprintf("// Failed to parse rewritten function code: %v", err),
+			err:     withKind(ErrInvalidOutput, fmt.Errorf("failed to parse rewritten function code: %w", err)),
+		}
+	}
+
+	// Find the function in the rewritten code
+	var rewrittenFunc *ast.FuncDecl
+	for _, d := range rewrittenFile.Decls {
+		if fd, ok := d.(*ast.FuncDecl); ok && fd.Body != nil {
+			rewrittenFunc = fd
+			break
+		}
+	}
+	if rewrittenFunc == nil {
+		logger.Warn("Couldn't find function declaration in rewritten code", "function", name)
+		return nil, &rejection{
+			comment: "// Failed to find function in the rewritten code",
+			err:     withKind(ErrInvalidOutput, errors.New("no function declaration in the rewritten code")),
+		}
+	}
+
+	if err := bs.verify(original, rewrittenFunc); err != nil {
+		logger.Warn("Rewritten code was rejected by a verifier", "function", name, "error", err)
+		return nil, &rejection{
+			comment: fmt.Sprintf("// Rewrite rejected: %v", err),
+			err:     withKind(ErrInvalidOutput, fmt.Errorf("rewrite rejected: %w", err)),
+		}
+	}
+
+	missing, err := missingImports(file, rewrittenFile, rewrittenFunc.Body)
+	if err != nil {
+		logger.Warn("Rewritten code needs a conflicting import", "function", name, "error", err)
+		return nil, &rejection{
+			comment: fmt.Sprintf("// Rewrite rejected: %v", err),
+			err:     withKind(ErrInvalidOutput, fmt.Errorf("rewrite rejected: %w", err)),
+		}
+	}
+	undo := addImports(bs.ASTHandler.FileSet, file, missing)
+
+	if err := checker.check(body, rewrittenFunc.Body); err != nil {
+		undo()
+		logger.Warn("Rewritten code does not type-check", "function", name, "error", err)
+		return nil, &rejection{
+			comment: fmt.Sprintf("// Rewrite rejected by type check: %v", err),
+			err:     withKind(ErrInvalidOutput, fmt.Errorf("rewritten function does not type-check: %w", err)),
+		}
+	}
+	for _, spec := range missing {
+		logger.Info("Added an import the rewrite needs", "function", name, "import", importPath(spec))
+	}
+	return rewrittenFunc.Body, nil
+}
+
+// repairNote starts the comments repairSource adds
+const repairNote = "// Your previous rewrite of this function failed with:"
+
+// repairSource is the source sent to ask for a new rewrite after a rejected
+// one: the function followed by comments with the error. It goes through the
+// same prompt, secret policy and incremental state as the function itself.
+func repairSource(functionSource string, rejected error) string {
+	return fmt.Sprintf("%s\n\n%s %s\n// Rewrite the function again and fix this error.\n",
+		strings.TrimRight(functionSource, "\n"), repairNote, strings.Join(strings.Fields(rejected.Error()), " "))
+}
+
+// repair asks the LLM up to Repairs times for a rewrite that is not rejected.
+// It returns the body of the first accepted rewrite, or the last rejection.
+// A failed request ends the repairs.
+func (bs *BaseStrategy) repair(ctx context.Context, file *ast.File, name string, original *ast.FuncDecl, functionSource string, body **ast.BlockStmt, checker *bodyChecker, rejected *rejection) (*ast.BlockStmt, *rejection) {
+	for attempt := 1; attempt <= bs.Repairs; attempt++ {
+		logger.Info("Asking the LLM to repair the rewrite", "function", name, "attempt", attempt, "max_attempts", bs.Repairs)
+		bs.emitRetry(withUnit(ctx, name), attempt, RetryRepair, rejected.err)
+		source := repairSource(functionSource, rejected.err)
+		rewrittenSource, err := bs.rewriteUnit(ctx, name, source)
+		if err != nil {
+			logger.Warn("Failed to repair the rewrite", "function", name, "error", err)
+			break
+		}
+		if rewrittenSource == source {
+			// The function was not sent, e.g. because it contains secrets
+			break
+		}
+		rewritten, r := bs.rewrittenBody(file, name, original, rewrittenSource, body, checker)
+		if r == nil {
+			logger.Info("Repaired the rewrite", "function", name)
+			return rewritten, nil
+		}
+		rejected = r
+	}
+	return nil, rejected
+}
+
+// SetRepairs makes the strategy send a rewrite that does not parse or
+// type-check back to the LLM with the error, up to n times per function
+func (r *Rewriter) SetRepairs(n int) error {
+	s, ok := r.Strategy.(baseStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support repairing rewrites", r.Strategy)
+	}
+	if n < 0 {
+		return fmt.Errorf("repairs must not be negative, got %d", n)
+	}
+	s.base().Repairs = n
+	return nil
+}
@@ -0,0 +1,134 @@
+package rewriter
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+
+	"github.com/Hekzory/MetamorphLLM/internal/telemetry"
+)
+
+// Recording is a stored LLM response for a specific prompt
+type Recording struct {
+	Function     string `json:"function"` // Name of the function the prompt was built for
+	PromptSHA256 string `json:"prompt_sha256"`
+	Response     string `json:"response"` // Raw, uncleaned model output
+}
+
+// PromptHash returns the hex SHA-256 of a prompt, used to key recordings
+func PromptHash(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadRecordings reads recorded responses from a JSON file
+func LoadRecordings(path string) ([]Recording, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recordings: %w", err)
+	}
+
+	var recordings []Recording
+	if err := json.Unmarshal(content, &recordings); err != nil {
+		return nil, fmt.Errorf("failed to parse recordings %s: %w", path, err)
+	}
+	return recordings, nil
+}
+
+// SaveRecordings writes recorded responses to a JSON file
+func SaveRecordings(path string, recordings []Recording) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false) // Keep Go operators such as < and & readable
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(recordings); err != nil {
+		return fmt.Errorf("failed to encode recordings: %w", err)
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// ReplayStrategy answers rewrite requests from recorded LLM responses instead of
+// calling an API, making the full rewrite path reproducible offline
+type ReplayStrategy struct {
+	BaseStrategy
+	Recordings []Recording
+	// Rekey matches recordings by function name when the prompt hash is unknown and
+	// updates the stored hash. Used to refresh recordings after an intended prompt change.
+	Rekey bool
+}
+
+// NewReplayStrategy creates a new replay strategy
+func NewReplayStrategy(astHandler *ASTHandler, comment string, recordings []Recording) *ReplayStrategy {
+	rs := &ReplayStrategy{
+		BaseStrategy: BaseStrategy{
+			ASTHandler: astHandler,
+			Comment:    comment,
+			Provider:   "replay",
+		},
+		Recordings: recordings,
+	}
+	rs.rewriteFunc = rs.replay
+	return rs
+}
+
+// NewReplayRewriter creates a new Rewriter that replays the recordings stored at path
+func NewReplayRewriter(path string) (*Rewriter, error) {
+	recordings, err := LoadRecordings(path)
+	if err != nil {
+		return nil, err
+	}
+
+	astHandler := NewASTHandler()
+	comment := "// This function was rewritten by MetamorphLLM (replay)"
+	return &Rewriter{
+		FileHandler:    &FileHandler{},
+		ASTHandler:     astHandler,
+		Strategy:       NewReplayStrategy(astHandler, comment, recordings),
+		DefaultComment: comment,
+	}, nil
+}
+
+// replay looks up the recorded response for the prompt built from functionSource
+func (rs *ReplayStrategy) replay(_ context.Context, functionSource string) (string, error) {
+	hash := PromptHash(rs.createPrompt(functionSource))
+	for _, rec := range rs.Recordings {
+		if rec.PromptSHA256 == hash {
+			telemetry.CacheLookups.Inc("replay", telemetry.CacheHit)
+			return rs.cleanResponse(rec.Response)
+		}
+	}
+
+	telemetry.CacheLookups.Inc("replay", telemetry.CacheMiss)
+	name := functionName(functionSource)
+	if rs.Rekey {
+		for i, rec := range rs.Recordings {
+			if rec.Function == name {
+				rs.Recordings[i].PromptSHA256 = hash
+				return rs.cleanResponse(rec.Response)
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no recorded response for function %s (prompt %s)", name, hash[:12])
+}
+
+// functionName extracts the name of the function declared in a source snippet
+func functionName(functionSource string) string {
+	f, err := parser.ParseFile(token.NewFileSet(), "", "package p\n\n"+functionSource, 0)
+	if err != nil {
+		return ""
+	}
+	for _, decl := range f.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok {
+			return fd.Name.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,145 @@
+package rewriter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/redact"
+)
+
+// Outcomes of a function rewrite
+const (
+	FunctionRewritten = "rewritten"
+	FunctionUnchanged = "unchanged" // The strategy returned the function as it was
+	FunctionFailed    = "failed"
+	FunctionSkipped   = "skipped" // Not sent to the API because the time, token or cost budget ran out
+)
+
+// FunctionReport is the outcome of rewriting one function
+type FunctionReport struct {
+	Function string        `json:"function"`
+	Status   string        `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Kind     string        `json:"error_kind,omitempty"` // See ErrorKind, e.g. "rate_limited"
+	Duration time.Duration `json:"duration"`
+	Tokens   int64         `json:"tokens,omitempty"` // Prompt and response tokens the provider reported
+}
+
+// RewriteReport collects the outcome of every function a strategy processes
+type RewriteReport struct {
+	Source    string           `json:"source"`
+	Functions []FunctionReport `json:"functions"`
+	Minimized []MinimalRewrite `json:"minimized,omitempty"` // Trade-offs found by the diff-minimizing mode
+	Usage     []ModelUsage     `json:"usage,omitempty"`     // Tokens and cost per model
+
+	mu   sync.Mutex
+	path string // Where Track saves the report after every function
+}
+
+// ReportPath returns where the rewrite report of an output file is written
+func ReportPath(output string) string {
+	return output + ".report.json"
+}
+
+// add records a function outcome; errors are redacted since reports are saved
+func (rr *RewriteReport) add(function, status string, err error, start time.Time, tokens int64) {
+	fr := FunctionReport{Function: function, Status: status, Duration: time.Since(start), Tokens: tokens}
+	if err != nil {
+		fr.Error, fr.Kind = redact.String(err.Error()), ErrorKind(err)
+	}
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.Functions = append(rr.Functions, fr)
+	if rr.path != "" {
+		if err := rr.save(rr.path); err != nil {
+			logger.Warn("Failed to save the rewrite report", "error", err)
+		}
+	}
+}
+
+// addMinimal records the trade-off found for a function; it is saved with the
+// function's outcome
+func (rr *RewriteReport) addMinimal(m MinimalRewrite) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.Minimized = append(rr.Minimized, m)
+}
+
+// Track saves the report to path after every function, so a running rewrite
+// can be followed by reading the file
+func (rr *RewriteReport) Track(path string) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.path = path
+}
+
+// Tokens returns the tokens used by every reported function
+func (rr *RewriteReport) Tokens() int64 {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	var tokens int64
+	for _, f := range rr.Functions {
+		tokens += f.Tokens
+	}
+	return tokens
+}
+
+// Save writes the report as indented JSON
+func (rr *RewriteReport) Save(path string) error {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	return rr.save(path)
+}
+
+// save writes the report through a temporary file, so a reader never sees a
+// partly written report
+func (rr *RewriteReport) save(path string) error {
+	data, err := json.MarshalIndent(rr, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode rewrite report: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write rewrite report: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write rewrite report: %w", err)
+	}
+	return nil
+}
+
+// LoadRewriteReport reads a report written by Save
+func LoadRewriteReport(path string) (*RewriteReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rewrite report: %w", err)
+	}
+	var rr RewriteReport
+	if err := json.Unmarshal(data, &rr); err != nil {
+		return nil, fmt.Errorf("failed to parse rewrite report %s: %w", path, err)
+	}
+	return &rr, nil
+}
+
+// SetReport makes the strategy record every function outcome in report
+func (bs *BaseStrategy) SetReport(report *RewriteReport) {
+	bs.Report = report
+}
+
+// reportingStrategy is implemented by strategies that embed BaseStrategy
+type reportingStrategy interface {
+	SetReport(report *RewriteReport)
+}
+
+// SetReport records function outcomes in report if the current strategy supports it
+func (r *Rewriter) SetReport(report *RewriteReport) error {
+	s, ok := r.Strategy.(reportingStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not report function outcomes", r.Strategy)
+	}
+	s.SetReport(report)
+	return nil
+}
@@ -3,21 +3,37 @@
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"go/ast"
+	"go/format"
 	"go/parser"
 	"go/printer"
 	"go/token"
-	"math"
+	"io"
+	"net/url"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Hekzory/MetamorphLLM/internal/cache"
+	"github.com/Hekzory/MetamorphLLM/internal/log"
+	"github.com/Hekzory/MetamorphLLM/internal/prompts"
+	"github.com/Hekzory/MetamorphLLM/internal/retry"
+	"github.com/Hekzory/MetamorphLLM/internal/telemetry"
 	"github.com/google/generative-ai-go/genai"
 	openrouter "github.com/revrost/go-openrouter"
 	"google.golang.org/api/option"
 )
 
+// logger is the logger of the rewriting engine
+var logger = log.Component("rewriter")
+
 // FileHandler handles file I/O operations
 type FileHandler struct{}
 
@@ -35,9 +51,11 @@ func (fh *FileHandler) WriteFile(filePath string, content string) error {
 	return os.WriteFile(filePath, []byte(content), 0644)
 }
 
-// ASTHandler handles parsing and printing ASTs
+// ASTHandler handles parsing and printing ASTs. All files, including parsed
+// LLM responses, share one FileSet so that grafted function bodies keep valid positions.
 type ASTHandler struct {
 	FileSet *token.FileSet
+	buf     bytes.Buffer // Reused by PrintAST
 }
 
 // NewASTHandler creates a new ASTHandler
@@ -49,21 +67,124 @@ func NewASTHandler() *ASTHandler {
 
 // ParseContent parses Go code into an AST
 func (ah *ASTHandler) ParseContent(content string) (*ast.File, error) {
-	return parser.ParseFile(ah.FileSet, "", content, parser.ParseComments)
+	return parser.ParseFile(ah.FileSet, "", content, parser.ParseComments|parser.SkipObjectResolution)
+}
+
+// packageClause matches a package clause at the start of a line
+var packageClause = regexp.MustCompile(`(?m)^package\s`)
+
+// ParseSnippet parses a rewritten function returned by an LLM. Only the
+// declarations are needed, so comments and object resolution are skipped, and
+// a snippet without a package clause is accepted.
+func (ah *ASTHandler) ParseSnippet(content string) (*ast.File, error) {
+	if !packageClause.MatchString(content) {
+		// Same line, so reported positions still match the snippet
+		content = "package p; " + content
+	}
+	return parser.ParseFile(ah.FileSet, "", content, parser.SkipObjectResolution)
 }
 
-// PrintAST converts an AST back to a string
+// PrintAST converts an AST back to gofmt-formatted source
 func (ah *ASTHandler) PrintAST(f *ast.File) (string, error) {
-	var buf strings.Builder
-	if err := printer.Fprint(&buf, ah.FileSet, f); err != nil {
+	spliced := ah.splicedBodies(f)
+	if len(spliced) > 0 {
+		return ah.printSpliced(f, spliced)
+	}
+	ah.buf.Reset()
+	if err := format.Node(&ah.buf, ah.FileSet, f); err != nil {
+		return "", err
+	}
+	return ah.buf.String(), nil
+}
+
+// splicedBody is a function body parsed from a rewrite and spliced into a file
+type splicedBody struct {
+	target **ast.BlockStmt
+	body   *ast.BlockStmt
+	anchor token.Pos // End of the signature the body belongs to
+}
+
+// splicePlaceholder stands in for a spliced body while the file is printed
+var splicePlaceholder = regexp.MustCompile(`\{\s*_metamorph_splice_(\d+)\s*\}`)
+
+// splicedBodies returns the bodies of f that were parsed into another
+// token.File than f itself. Bodies nested in one of them are left out.
+func (ah *ASTHandler) splicedBodies(f *ast.File) []splicedBody {
+	file := ah.FileSet.File(f.Package)
+	var spliced []splicedBody
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Body != nil && ah.FileSet.File(n.Body.Lbrace) != file {
+				spliced = append(spliced, splicedBody{target: &n.Body, body: n.Body, anchor: n.Type.End()})
+				return false
+			}
+		case *ast.FuncLit:
+			if ah.FileSet.File(n.Body.Lbrace) != file {
+				spliced = append(spliced, splicedBody{target: &n.Body, body: n.Body, anchor: n.Type.End()})
+				return false
+			}
+		}
+		return true
+	})
+	return spliced
+}
+
+// printSpliced prints f with placeholders for its spliced bodies, which are
+// printed on their own and substituted afterwards. The printer places comments
+// by offset, and offsets from different token.Files don't compare, so printing
+// the spliced bodies in place moves the file's comments into them.
+func (ah *ASTHandler) printSpliced(f *ast.File, spliced []splicedBody) (string, error) {
+	bodies := make([]string, len(spliced))
+	for i, s := range spliced {
+		ah.buf.Reset()
+		if err := format.Node(&ah.buf, ah.FileSet, s.body); err != nil {
+			return "", err
+		}
+		bodies[i] = ah.buf.String()
+	}
+
+	for i, s := range spliced {
+		*s.target = &ast.BlockStmt{
+			Lbrace: s.anchor,
+			List:   []ast.Stmt{&ast.ExprStmt{X: &ast.Ident{NamePos: s.anchor, Name: fmt.Sprintf("_metamorph_splice_%d", i)}}},
+			Rbrace: s.anchor,
+		}
+	}
+	ah.buf.Reset()
+	err := format.Node(&ah.buf, ah.FileSet, f)
+	for _, s := range spliced {
+		*s.target = s.body
+	}
+	if err != nil {
 		return "", err
 	}
-	return buf.String(), nil
+
+	src := splicePlaceholder.ReplaceAllStringFunc(ah.buf.String(), func(m string) string {
+		i, _ := strconv.Atoi(splicePlaceholder.FindStringSubmatch(m)[1])
+		return bodies[i]
+	})
+	out, err := format.Source([]byte(src))
+	if err != nil {
+		return "", fmt.Errorf("failed to format spliced bodies: %w", err)
+	}
+	return string(out), nil
+}
+
+// spliceBody replaces the body at target with one parsed from a rewrite. The
+// comments inside the old body are dropped along with it.
+func spliceBody(f *ast.File, target **ast.BlockStmt, body *ast.BlockStmt) {
+	old := *target
+	f.Comments = slices.DeleteFunc(f.Comments, func(cg *ast.CommentGroup) bool {
+		return cg.Pos() > old.Lbrace && cg.End() <= old.Rbrace
+	})
+	*target = body
 }
 
-// RewriteStrategy defines an interface for different code rewriting strategies
+// RewriteStrategy defines an interface for different code rewriting strategies.
+// Rewrite stops sending functions once ctx is done and returns its error.
 type RewriteStrategy interface {
-	Rewrite(f *ast.File) (bool, error)
+	Rewrite(ctx context.Context, f *ast.File) (bool, error)
 }
 
 // FunctionCommentStrategy adds comments to function declarations
@@ -79,7 +200,7 @@ func NewFunctionCommentStrategy(commentText string) *FunctionCommentStrategy {
 }
 
 // Rewrite implements the RewriteStrategy interface
-func (fcs *FunctionCommentStrategy) Rewrite(f *ast.File) (bool, error) {
+func (fcs *FunctionCommentStrategy) Rewrite(_ context.Context, f *ast.File) (bool, error) {
 	functionsRewritten := false
 
 	ast.Inspect(f, func(n ast.Node) bool {
@@ -109,95 +230,149 @@ functionsRewritten = true
 type BaseStrategy struct {
 	ASTHandler *ASTHandler
 	Comment    string
+	Model      string // Model name passed to the LLM API
+	Provider   string // Name of the backend, part of the incremental input hash
+	// ReasoningEffort is passed to reasoning models (see ReasoningEfforts); empty keeps the default
+	ReasoningEffort string
+	// Structured requests a JSON {"code": ...} response where the provider supports it
+	Structured bool
+	// State, when set, supplies previous rewrites for unchanged functions
+	State *IncrementalState
+	// Cache, when set, keeps responses on disk across runs and outputs
+	Cache *cache.Cache
+	// Limiter throttles API calls; strategies for the same provider share one
+	Limiter *Limiter
+	// Breaker stops calls to a failing provider; shared per provider like Limiter
+	Breaker *Breaker
+	// Fallback, when set, rewrites functions while Breaker is open
+	Fallback *BaseStrategy
+	// Secrets decides how secrets in function sources are handled; empty means SecretsRedact
+	Secrets SecretPolicy
+	// Report, when set, records the outcome and duration of every function
+	Report *RewriteReport
+	// Observer, when set, receives the progress events of every function
+	Observer Observer
+	// Deadline, when set, is when the strategy stops sending functions to the API
+	Deadline time.Time
+	// Retry sets how failed calls are retried; the zero value uses the
+	// defaults of package retry
+	Retry retry.Policy
+	// Usage, when set, records the tokens and cost of every call and stops
+	// sending functions once its budget is used up
+	Usage *TokenUsage
+	// Examples, when Shots is positive, supplies the examples shown in prompts
+	Examples *ExampleBank
+	Shots    int
+	// Sampling sets the generation parameters; nil uses DefaultSampling
+	Sampling *Sampling
+	// Concurrency is how many functions are sent to the LLM at once; 0 or 1
+	// sends them one at a time
+	Concurrency int
+	// MaxTokens caps the answer; 0 uses DefaultMaxTokens
+	MaxTokens int
+	// TypeCheck keeps the original body of functions whose rewrite does not
+	// type-check in the context of their file
+	TypeCheck bool
+	// Repairs is how many times a rewrite that does not parse, verify or
+	// type-check is sent back to the LLM with the error
+	Repairs int
+	// Verifiers check every rewritten function after SignatureVerifier, which
+	// always runs
+	Verifiers Verifiers
+	// ClosureLines, when positive, makes function literals of at least this
+	// many lines separate rewrite units
+	ClosureLines int
+	// Techniques are the transformations the prompt asks for; empty means
+	// TechniqueDeadCode
+	Techniques []TechniqueType
+	// Minimize, when set, searches for the smallest change per function that
+	// meets a metric target (see Minimization)
+	Minimize *Minimization
+	// Prompts, when set, replaces the built-in prompt templates, and
+	// PromptVariant selects among their variants
+	Prompts       *prompts.Library
+	PromptVariant string
+	// insertionLimit caps the statements inserted by the requests of a search
+	insertionLimit int
+	// tokens counts the tokens the provider reported for this strategy's calls
+	tokens atomic.Int64
+	// srcBuf is reused by getFunctionSource
+	srcBuf bytes.Buffer
 	// Add interface for concrete strategies to implement
-	rewriteFunc func(string) (string, error)
+	rewriteFunc func(context.Context, string) (string, error)
 }
 
-// getFunctionSource extracts the source code of a function
+// getFunctionSource extracts the source code of a function. It keeps using
+// printer.Fprint rather than format.Node: the output is part of the prompt, and
+// prompt hashes key replay recordings and incremental state.
 func (bs *BaseStrategy) getFunctionSource(funcDecl *ast.FuncDecl) (string, error) {
-	var buf bytes.Buffer
-	if err := printer.Fprint(&buf, bs.ASTHandler.FileSet, funcDecl); err != nil {
+	bs.srcBuf.Reset()
+	if err := printer.Fprint(&bs.srcBuf, bs.ASTHandler.FileSet, funcDecl); err != nil {
 		return "", fmt.Errorf("failed to extract function source: %w", err)
 	}
-	return buf.String(), nil
+	return bs.srcBuf.String(), nil
 }
 
-// createPrompt creates the prompt for the LLM
+// builtinPrompts holds the prompt templates shipped with the rewriter
+var builtinPrompts = prompts.Builtin()
+
+// createPrompt creates the prompt for the LLM from the strategy's prompt
+// templates, or from the built-in ones if they fail to render
 func (bs *BaseStrategy) createPrompt(functionSource string) string {
-	return fmt.Sprintf(
-		`You are a Go obfuscation expert. Your goal is to make the provided function hard to analyze while preserving its exact functionality.
-
-Rewrite the function below using **only the Dead Code Insertion technique**. Add varied and plausible-looking dead code (unused variables, pointless computations, non-impacting conditions, unreachable blocks). Avoid trivial dead code (e.g., if false {}). The added code must not alter the function's semantics or final result.
-
-CRITICAL REQUIREMENTS:
-1.  The function signature must remain EXACTLY the same (name, parameters, return types).
-2.  Your response must be valid Go code, parsable by go/parser and compilable.
-3.  Do not change the overall behavior or functionality of the function.
-4.  STRICTLY preserve the return values and their types.
-5.  If multiple values are returned, preserve the exact number and types.
-6.  Maintain existing error handling patterns.
-7.  You MUST start the function code with package declaration and necessary import statements.
-8.  Ensure correct variable types are used when interacting with library functions.
-9.  The generated code MUST ONLY use functions and types from the following standard Go libraries. NO OTHER LIBRARIES ARE ALLOWED:
-    *   "encoding/base64"
-    *   "fmt"
-    *   "io"
-    *   "math"
-    *   "math/rand"
-    *   "net/http"
-    *   "os"
-    *   "strconv"
-    *   "strings"
-    *   "time"
-
-Example of the transformation:
-
-// --- Example Original Function ---
-package main
-
-func calculateSum(a, b int) int {
-    return a + b
-}
-// --- End Example Original Function ---
-
-// --- Example Obfuscated Output (Dead Code Insertion Only) ---
-package main
-import "fmt" 
-
-func calculateSum(a, b int) int {
-    tempVar := a*a + b*b - 100
-    uselessCounter := 0
-    if tempVar > 0 && a > 0 {
-        for i := 0; i < 5; i++ {
-            uselessCounter += i * (a - b)
-        }
-        fmt.Println("Performed insignificant calculations...")
-    } else {
-         _ = tempVar + uselessCounter
-    }
-
-    result := a + b
-
-    if result != (a + b) {
-        panic("Impossible logic error")
-    }
-
-    return result
-}
-// --- End Example Obfuscated Output ---
-
-Now, please rewrite the following Go function using only Dead Code Insertion:
-
-%s
-
-Return **only** the complete, modified Go function code. No explanations, comments, intro text, or markdown. Ensure the output is directly parsable by go/parser and strictly adheres to all requirements.`,
-		functionSource,
-	)
+	techniques := bs.techniques()
+	data := prompts.Data{
+		Function:      functionSource,
+		Imports:       AllowedImports,
+		Techniques:    make([]prompts.Technique, len(techniques)),
+		Instructions:  bs.techniqueInstructions(),
+		TechniqueList: bs.techniqueList(),
+		Examples:      bs.examplesSection(functionSource),
+	}
+	for i, t := range techniques {
+		data.Techniques[i] = prompts.Technique{Key: string(t), Name: techniqueTemplates[t].Name, Instructions: techniqueTemplates[t].Instructions}
+	}
+	if constraint := bs.insertionConstraint(); constraint != "" {
+		data.Constraints = append(data.Constraints, constraint)
+	}
+	if bs.Prompts != nil {
+		prompt, err := bs.Prompts.Render(bs.PromptVariant, data)
+		if err == nil {
+			return prompt
+		}
+		logger.Error("Falling back to the built-in prompt", "error", err)
+	}
+	prompt, err := builtinPrompts.Render("", data)
+	if err != nil {
+		panic(err)
+	}
+	return prompt
+}
+
+// AllowedImports lists the only packages the LLM may use in rewritten functions
+var AllowedImports = []string{
+	"encoding/base64",
+	"fmt",
+	"io",
+	"math",
+	"math/rand",
+	"net/http",
+	"os",
+	"strconv",
+	"strings",
+	"time",
 }
 
 // cleanResponse cleans and validates the response from LLM
 func (bs *BaseStrategy) cleanResponse(response string) (string, error) {
-	result := strings.TrimSpace(response)
+	// Drop reasoning that some models inline before their answer
+	result := strings.TrimSpace(stripReasoning(response))
+
+	// Keep only the code block when the model wraps it in prose
+	if !strings.HasPrefix(result, "```") {
+		if idx := strings.Index(result, "```go"); idx != -1 {
+			result = result[idx:]
+		}
+	}
 
 	// Remove markdown code fences if present
 	if strings.HasPrefix(result, "```go") {
@@ -215,14 +390,18 @@ func (bs *BaseStrategy) cleanResponse(response string) (string, error) {
 
 	// Basic validation
 	if len(result) < 10 {
-		return "", fmt.Errorf("received suspiciously short response: %q", result)
+		return "", withKind(ErrEmptyResponse, fmt.Errorf("received suspiciously short response: %q", result))
 	}
 
 	return result, nil
 }
 
-// addComment adds a comment to a function declaration
+// addComment adds a comment to a function declaration, unless an earlier
+// pass already added the same one
 func (bs *BaseStrategy) addComment(funcDecl *ast.FuncDecl, commentText string) {
+	if funcDecl.Doc != nil && slices.ContainsFunc(funcDecl.Doc.List, func(c *ast.Comment) bool { return c.Text == commentText }) {
+		return
+	}
 	comment := &ast.Comment{
 		Text:  commentText,
 		Slash: funcDecl.Pos(),
@@ -237,81 +416,114 @@ funcDecl.Doc.List = append(funcDecl.Doc.List, comment)
 	}
 }
 
-// Rewrite implements the RewriteStrategy interface
-func (bs *BaseStrategy) Rewrite(f *ast.File) (bool, error) {
+// Rewrite implements the RewriteStrategy interface. Up to Concurrency
+// functions are sent to the LLM at once; their results are applied in source
+// order, so the output does not depend on which answer arrives first.
+func (bs *BaseStrategy) Rewrite(ctx context.Context, f *ast.File) (bool, error) {
 	functionsRewritten := false
 	functionsEncountered := 0
 
-	// Process each function declaration
+	var funcDecls []*ast.FuncDecl
 	for _, decl := range f.Decls {
-		funcDecl, isFuncDecl := decl.(*ast.FuncDecl)
-		if !isFuncDecl || funcDecl.Body == nil {
-			continue
+		if funcDecl, isFuncDecl := decl.(*ast.FuncDecl); isFuncDecl && funcDecl.Body != nil {
+			funcDecls = append(funcDecls, funcDecl)
+		}
+	}
+
+	checker := bs.newBodyChecker(f)
+	pool := bs.newUnitPool(ctx)
+	defer pool.wait()
+	for i, funcDecl := range funcDecls {
+		// Keep up to the pool's size of functions in flight ahead of this one
+		for pool.dispatched() < min(len(funcDecls), i+pool.size) {
+			next := funcDecls[pool.dispatched()]
+			logger.Info("Processing function", "function", next.Name.Name)
+			// The source is printed here, as the printer buffer is not shared with workers
+			functionSource, err := bs.getFunctionSource(next)
+			if err != nil {
+				err = fmt.Errorf("failed to extract function source for %s: %w", next.Name.Name, err)
+			}
+			bs.emit(Event{Type: EventStarted, Function: next.Name.Name, Index: pool.dispatched() + 1, Total: len(funcDecls)})
+			pool.dispatch(next.Name.Name, functionSource, err)
 		}
 
 		functionsEncountered++
-		fmt.Printf("Processing function: %s\n", funcDecl.Name.Name)
-
-		// Get the original function source
-		functionSource, err := bs.getFunctionSource(funcDecl)
-		if err != nil {
-			return false, fmt.Errorf("failed to extract function source for %s: %w",
-				funcDecl.Name.Name, err)
+		unit := pool.result(i)
+		report := func(status string, err error) {
+			if bs.Report != nil {
+				bs.Report.add(funcDecl.Name.Name, status, err, unit.start, unit.tokens)
+			}
+			bs.emitFinished(Event{Function: funcDecl.Name.Name, Index: i + 1, Total: len(funcDecls)}, status, err, unit.start)
+		}
+		if unit.sourceErr != nil {
+			report(FunctionFailed, unit.sourceErr)
+			return false, unit.sourceErr
 		}
+		functionSource, rewrittenSource, err := unit.source, unit.rewritten, unit.err
 
-		// Get the rewritten function source from concrete implementation
-		rewrittenSource, err := bs.rewriteFunc(functionSource)
+		if errors.Is(err, ErrBudgetExceeded) {
+			// Keep the function as it is and go on with the rest of the file
+			logger.Warn("Skipping function", "function", funcDecl.Name.Name, "error", err)
+			report(FunctionSkipped, err)
+			continue
+		}
 		if err != nil {
+			report(FunctionFailed, err)
 			return false, fmt.Errorf("failed to rewrite function %s: %w",
 				funcDecl.Name.Name, err)
 		}
-		//fmt.Println(rewrittenSource)
 
 		// Check if the source actually changed
 		if rewrittenSource == functionSource {
-			fmt.Printf("LLM didn't make any changes to function %s\n", funcDecl.Name.Name)
+			logger.Info("LLM didn't make any changes", "function", funcDecl.Name.Name)
 
 			// Add an analyzed-but-unchanged comment
 			bs.addComment(funcDecl, bs.Comment+" (analyzed but no changes required)")
+			report(FunctionUnchanged, nil)
 			functionsRewritten = true
 			continue
 		}
 
-		fmt.Printf("Got rewritten source for %s (%d bytes)\n", funcDecl.Name.Name, len(rewrittenSource))
-		// Parse the rewritten source code
-		rewrittenFile, err := bs.ASTHandler.ParseContent(rewrittenSource)
-		if err != nil {
-			bs.addComment(funcDecl, fmt.Sprintf("// Failed to parse rewritten function code: %v", err))
-			fmt.Printf("Failed to parse rewritten code for %s: %v\n", funcDecl.Name.Name, err)
-			continue
-		}
-
-		// Find the function in the rewritten code
-		var rewrittenFunc *ast.FuncDecl
-		for _, d := range rewrittenFile.Decls {
-			if fd, ok := d.(*ast.FuncDecl); ok {
-				rewrittenFunc = fd
-				break
-			}
+		logger.Debug("Got rewritten source", "function", funcDecl.Name.Name, "bytes", len(rewrittenSource))
+		body, rejected := bs.rewrittenBody(f, funcDecl.Name.Name, funcDecl, rewrittenSource, &funcDecl.Body, checker)
+		if rejected != nil && bs.Repairs > 0 {
+			pool.charge(unit, func() {
+				body, rejected = bs.repair(ctx, f, funcDecl.Name.Name, funcDecl, functionSource, &funcDecl.Body, checker, rejected)
+			})
 		}
-
-		if rewrittenFunc == nil {
-			bs.addComment(funcDecl, "// Failed to find function in the rewritten code")
-			fmt.Printf("Couldn't find function declaration in rewritten code for %s\n", funcDecl.Name.Name)
+		if rejected != nil {
+			bs.addComment(funcDecl, rejected.comment)
+			logger.Warn("Keeping the original body", "function", funcDecl.Name.Name, "error", rejected.err)
+			report(FunctionFailed, rejected.err)
 			continue
 		}
 
 		// Replace the function body and add a comment
-		funcDecl.Body = rewrittenFunc.Body
+		spliceBody(f, &funcDecl.Body, body)
 		bs.addComment(funcDecl, bs.Comment)
+		report(FunctionRewritten, nil)
 
 		functionsRewritten = true
-		fmt.Printf("Successfully rewrote function: %s\n", funcDecl.Name.Name)
+		logger.Info("Successfully rewrote function", "function", funcDecl.Name.Name)
+	}
+	pool.wait()
+
+	// Large closures are sent on their own once every function is done
+	if bs.ClosureLines > 0 {
+		for _, decl := range f.Decls {
+			funcDecl, isFuncDecl := decl.(*ast.FuncDecl)
+			if !isFuncDecl || funcDecl.Body == nil {
+				continue
+			}
+			rewrote, err := bs.rewriteClosures(ctx, f, funcDecl, checker)
+			if err != nil {
+				return false, err
+			}
+			functionsRewritten = functionsRewritten || rewrote
+		}
 	}
 
-	// Log summary
-	fmt.Printf("Rewrite summary: Found %d functions, rewrote %v\n",
-		functionsEncountered, functionsRewritten)
+	logger.Info("Rewrite summary", "functions", functionsEncountered, "rewrote", functionsRewritten)
 
 	return functionsRewritten, nil
 }
@@ -319,92 +531,112 @@ functionsEncountered, functionsRewritten)
 // LLMStrategy uses an LLM API to rewrite function bodies
 type LLMStrategy struct {
 	BaseStrategy
+	// NewClient creates the Gemini client on first use; the client is then reused
+	// for every function. Tests can replace it to point at a fake endpoint.
+	NewClient func(ctx context.Context) (*genai.Client, error)
+
+	clientOnce sync.Once
+	client     *genai.Client
+	clientErr  error
 }
 
 // NewLLMStrategy creates a new LLM strategy
-func NewLLMStrategy(astHandler *ASTHandler, comment string) *LLMStrategy {
+func NewLLMStrategy(astHandler *ASTHandler, comment string, opts ...StrategyOption) *LLMStrategy {
 	ls := &LLMStrategy{
 		BaseStrategy: BaseStrategy{
 			ASTHandler: astHandler,
 			Comment:    comment,
+			Model:      DefaultGeminiModel,
+			Provider:   string(APITypeGemini),
+			Structured: true,
+			Limiter:    SharedLimiter(string(APITypeGemini)),
+			Breaker:    SharedBreaker(string(APITypeGemini)),
 		},
 	}
+	ls.apply(opts)
+	ls.NewClient = NewGeminiClient
 	// Set the function to use LLMStrategy's implementation
 	ls.rewriteFunc = ls.callGeminiLLM
 	return ls
 }
 
-// callGeminiLLM makes an API call to Gemini LLM to rewrite function code
-func (ls *LLMStrategy) callGeminiLLM(functionSource string) (string, error) {
-	ctx := context.Background()
-
-	// Get API key from environment variable
+// NewGeminiClient creates a Gemini client authenticated with GEMINI_API_KEY
+func NewGeminiClient(ctx context.Context) (*genai.Client, error) {
 	apiKey, ok := os.LookupEnv("GEMINI_API_KEY")
 	if !ok {
-		return "", fmt.Errorf("environment variable GEMINI_API_KEY not set")
+		return nil, withKind(ErrAPIKeyMissing, fmt.Errorf("environment variable GEMINI_API_KEY not set"))
 	}
+	return newGeminiClient(ctx, apiKey)
+}
 
-	// Create a new Gemini client
+// newGeminiClient creates a Gemini client authenticated with apiKey
+func newGeminiClient(ctx context.Context, apiKey string) (*genai.Client, error) {
 	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
 	if err != nil {
-		return "", fmt.Errorf("failed to create Gemini client: %w", err)
+		return nil, fmt.Errorf("failed to create Gemini client: %w", err)
 	}
-	defer client.Close()
+	return client, nil
+}
+
+// getClient returns the strategy's Gemini client, creating it on first use
+func (ls *LLMStrategy) getClient(ctx context.Context) (*genai.Client, error) {
+	ls.clientOnce.Do(func() {
+		ls.client, ls.clientErr = ls.NewClient(ctx)
+	})
+	return ls.client, ls.clientErr
+}
 
-	// Create a generative model
-	model := client.GenerativeModel("gemini-2.5-flash-preview-04-17")
-	model.SetTemperature(0.1)
+// Close releases the Gemini client if one was created
+func (ls *LLMStrategy) Close() error {
+	if ls.client == nil {
+		return nil
+	}
+	return ls.client.Close()
+}
+
+// callGeminiLLM makes an API call to Gemini LLM to rewrite function code
+func (ls *LLMStrategy) callGeminiLLM(ctx context.Context, functionSource string) (string, error) {
+	client, err := ls.getClient(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// Configure the generative model. Each function is an independent single-turn
+	// request, so no chat history is carried between functions.
+	model := client.GenerativeModel(ls.Model)
+	sampling := ls.sampling()
+	model.SetTemperature(float32(sampling.Temperature))
 	model.SetTopK(64)
-	model.SetTopP(0.9)
-	model.SetMaxOutputTokens(8192)
+	model.SetTopP(float32(sampling.TopP))
+	model.SetMaxOutputTokens(int32(ls.maxTokens()))
 	model.ResponseMIMEType = "text/plain"
-
-	// Create a chat session
-	session := model.StartChat()
+	if ls.Structured {
+		model.ResponseMIMEType = "application/json"
+		model.ResponseSchema = geminiCodeSchema
+	}
 
 	// Prepare the prompt
-	prompt := ls.createPrompt(functionSource)
+	prompt := ls.prompt(functionSource)
+	estimated := estimateTokens(prompt)
 
-	// Implement retry with exponential backoff
-	const maxRetries = 5
 	var resp *genai.GenerateContentResponse
-
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		resp, err = session.SendMessage(ctx, genai.Text(prompt))
-
-		// If successful, break out of the retry loop
-		if err == nil {
-			break
-		}
-
-		// Handle rate limit errors
-		if strings.Contains(err.Error(), "429") || strings.Contains(err.Error(), "Too Many Requests") {
-			backoffTime := math.Min(math.Pow(2, float64(attempt)), 60)
-			waitTime := time.Duration(backoffTime*1000) * time.Millisecond
-
-			fmt.Printf("Rate limited by Gemini API. Attempt %d/%d. Waiting %v before retrying...\n",
-				attempt+1, maxRetries, waitTime)
-
-			time.Sleep(waitTime)
-			continue
-		}
-
-		// For other errors, don't retry
-		return "", fmt.Errorf("error sending message to Gemini API: %w", err)
+	err = ls.callWithRetry(ctx, APITypeGemini, estimated, func(ctx context.Context) (err error) {
+		resp, err = model.GenerateContent(ctx, genai.Text(prompt))
+		return err
+	})
+	if err != nil {
+		return "", retryError("Gemini API", err)
 	}
 
-	// Check if we still have an error after all retries
-	if err != nil {
-		if strings.Contains(err.Error(), "429") || strings.Contains(err.Error(), "Too Many Requests") {
-			return "", fmt.Errorf("Gemini API rate limit exceeded after %d retries: %w", maxRetries, err)
-		}
-		return "", fmt.Errorf("error sending message to Gemini API: %w", err)
+	if resp.UsageMetadata != nil {
+		prompt := int(resp.UsageMetadata.PromptTokenCount)
+		ls.settleTokens(APITypeGemini, ls.Model, estimated, callUsage{Prompt: prompt, Completion: int(resp.UsageMetadata.TotalTokenCount) - prompt})
 	}
 
 	// Validate and process response
 	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil ||
 		len(resp.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("received empty or invalid response from Gemini API")
+		return "", withKind(ErrEmptyResponse, fmt.Errorf("received empty or invalid response from Gemini API"))
 	}
 
 	// Build the rewritten code from response parts
@@ -413,123 +645,246 @@ func (ls *LLMStrategy) callGeminiLLM(functionSource string) (string, error) {
 		rewrittenCode.WriteString(fmt.Sprintf("%v", part))
 	}
 
-	return ls.cleanResponse(rewrittenCode.String())
+	return ls.parseResponse(rewrittenCode.String())
 }
 
 // OpenRouterStrategy uses OpenRouter API to rewrite function bodies
 type OpenRouterStrategy struct {
 	BaseStrategy
+	// NewClient creates the OpenRouter client on first use; the client and its
+	// HTTP connections are then reused for every function
+	NewClient func() (*openrouter.Client, error)
+	// Routing selects the upstream providers that serve the model
+	Routing ProviderRouting
+
+	clientOnce sync.Once
+	client     *openrouter.Client
+	clientErr  error
 }
 
 // NewOpenRouterStrategy creates a new OpenRouter strategy
-func NewOpenRouterStrategy(astHandler *ASTHandler, comment string) *OpenRouterStrategy {
+func NewOpenRouterStrategy(astHandler *ASTHandler, comment string, opts ...StrategyOption) *OpenRouterStrategy {
 	ors := &OpenRouterStrategy{
 		BaseStrategy: BaseStrategy{
 			ASTHandler: astHandler,
 			Comment:    comment,
+			Model:      DefaultOpenRouterModel,
+			Provider:   string(APITypeOpenRouter),
+			Structured: true,
+			Limiter:    SharedLimiter(string(APITypeOpenRouter)),
+			Breaker:    SharedBreaker(string(APITypeOpenRouter)),
 		},
 	}
+	ors.apply(opts)
+	ors.NewClient = NewOpenRouterClient
 	// Set the function to use OpenRouterStrategy's implementation
 	ors.rewriteFunc = ors.callOpenRouterLLM
 	return ors
 }
 
-// callOpenRouterLLM makes an API call to OpenRouter LLM to rewrite function code
-func (ors *OpenRouterStrategy) callOpenRouterLLM(functionSource string) (string, error) {
-	ctx := context.Background()
-
-	// Get API key from environment variable
+// NewOpenRouterClient creates an OpenRouter client authenticated with OPENROUTER_API_KEY
+func NewOpenRouterClient() (*openrouter.Client, error) {
 	apiKey, ok := os.LookupEnv("OPENROUTER_API_KEY")
 	if !ok {
-		return "", fmt.Errorf("environment variable OPENROUTER_API_KEY not set")
+		return nil, withKind(ErrAPIKeyMissing, fmt.Errorf("environment variable OPENROUTER_API_KEY not set"))
 	}
+	return newOpenRouterClient(apiKey), nil
+}
 
-	// Create a new OpenRouter client
-	client := openrouter.NewClient(
+// newOpenRouterClient creates an OpenRouter client authenticated with apiKey
+func newOpenRouterClient(apiKey string) *openrouter.Client {
+	return openrouter.NewClient(
 		apiKey,
 		openrouter.WithXTitle("MetamorphLLM"),
 		openrouter.WithHTTPReferer("https://github.com/Hekzory/MetamorphLLM"),
 	)
+}
 
-	// Prepare the prompt
-	prompt := ors.createPrompt(functionSource)
+// getClient returns the strategy's OpenRouter client, creating it on first use
+func (ors *OpenRouterStrategy) getClient() (*openrouter.Client, error) {
+	ors.clientOnce.Do(func() {
+		ors.client, ors.clientErr = ors.NewClient()
+	})
+	return ors.client, ors.clientErr
+}
 
-	// Call the OpenRouter API
-	resp, err := client.CreateChatCompletion(
-		ctx,
-		openrouter.ChatCompletionRequest{
-			Model: "deepseek/deepseek-chat-v3-0324:free", // Can be configured as needed
-			Messages: []openrouter.ChatCompletionMessage{
-				{
-					Role:    openrouter.ChatMessageRoleUser,
-					Content: openrouter.Content{Text: prompt},
-				},
+// callOpenRouterLLM makes an API call to OpenRouter LLM to rewrite function code
+func (ors *OpenRouterStrategy) callOpenRouterLLM(ctx context.Context, functionSource string) (string, error) {
+	client, err := ors.getClient()
+	if err != nil {
+		return "", err
+	}
+
+	// Prepare the prompt
+	prompt := ors.prompt(functionSource)
+
+	sampling := ors.sampling()
+	request := openrouter.ChatCompletionRequest{
+		Model: ors.Model,
+		Messages: []openrouter.ChatCompletionMessage{
+			{
+				Role:    openrouter.ChatMessageRoleUser,
+				Content: openrouter.Content{Text: prompt},
 			},
-			Temperature: 0.1,
-			MaxTokens:   8192,
-			TopP:        0.9,
 		},
-	)
+		Temperature: float32(sampling.Temperature),
+		MaxTokens:   ors.maxTokens(),
+		TopP:        float32(sampling.TopP),
+	}
+	if ors.Structured {
+		request.ResponseFormat = openRouterResponseFormat()
+	}
+	if ors.ReasoningEffort != "" {
+		effort := ors.ReasoningEffort
+		request.Reasoning = &openrouter.ChatCompletionReasoning{Effort: &effort}
+	}
+	request.Provider = ors.Routing.chatProvider()
 
-	// Implement retry with exponential backoff
-	const maxRetries = 5
-	var rewrittenCode string
-	attempt := 0
+	// Call the OpenRouter API
+	estimated := estimateTokens(prompt)
+	var resp openrouter.ChatCompletionResponse
+	err = ors.callWithRetry(ctx, APITypeOpenRouter, estimated, func(ctx context.Context) (err error) {
+		resp, err = client.CreateChatCompletion(ctx, request)
+		return err
+	})
+	if err != nil {
+		return "", retryError("OpenRouter API", err)
+	}
+	if resp.Usage != nil {
+		ors.settleTokens(APITypeOpenRouter, ors.Model, estimated, callUsage{
+			Prompt:     resp.Usage.PromptTokens,
+			Completion: resp.Usage.TotalTokens - resp.Usage.PromptTokens,
+			Cost:       resp.Usage.Cost,
+			Billed:     resp.Usage.Cost > 0,
+		})
+	}
 
-	for attempt < maxRetries {
-		if err == nil {
-			// Extract the response content
-			if len(resp.Choices) > 0 && resp.Choices[0].Message.Content.Text != "" {
-				rewrittenCode = resp.Choices[0].Message.Content.Text
-				break
-			} else {
-				err = fmt.Errorf("received empty response from OpenRouter API")
-			}
+	// Extract the response content; reasoning models return their reasoning
+	// separately and it is not part of the answer
+	if len(resp.Choices) == 0 || resp.Choices[0].Message.Content.Text == "" {
+		if len(resp.Choices) > 0 && reasoningText(resp.Choices[0]) != "" {
+			return "", withKind(ErrEmptyResponse, fmt.Errorf("error sending message to OpenRouter API: model returned %d characters of reasoning but no answer; lower the reasoning effort or raise the token limit",
+				len(reasoningText(resp.Choices[0]))))
 		}
+		return "", withKind(ErrEmptyResponse, fmt.Errorf("error sending message to OpenRouter API: received empty response from OpenRouter API"))
+	}
+	if reasoning := reasoningText(resp.Choices[0]); reasoning != "" {
+		logger.Debug("Model reasoned before answering", "characters", len(reasoning))
+	}
+	return ors.parseResponse(resp.Choices[0].Message.Content.Text)
+}
 
-		// Handle rate limit errors
-		if strings.Contains(err.Error(), "429") || strings.Contains(err.Error(), "Too Many Requests") {
-			attempt++
-			backoffTime := math.Min(math.Pow(2, float64(attempt)), 60)
-			waitTime := time.Duration(backoffTime*1000) * time.Millisecond
-
-			fmt.Printf("Rate limited by OpenRouter API. Attempt %d/%d. Waiting %v before retrying...\n",
-				attempt, maxRetries, waitTime)
-
-			time.Sleep(waitTime)
-
-			// Retry the API call
-			resp, err = client.CreateChatCompletion(
-				ctx,
-				openrouter.ChatCompletionRequest{
-					Model: "deepseek/deepseek-chat-v3-0324:free",
-					Messages: []openrouter.ChatCompletionMessage{
-						{
-							Role:    openrouter.ChatMessageRoleUser,
-							Content: openrouter.Content{Text: prompt},
-						},
-					},
-					Temperature: 0.1,
-					MaxTokens:   8192,
-					TopP:        0.9,
-				},
-			)
-			continue
-		}
+// classifyError classifies a failed call to api
+func classifyError(api APIType, err error) retry.Class {
+	if api == APITypeOpenRouter {
+		return classifyOpenRouterError(err)
+	}
+	return retry.Classify(err)
+}
 
-		// For other errors, don't retry
-		return "", fmt.Errorf("error sending message to OpenRouter API: %w", err)
+// classifyOpenRouterError classifies errors by the HTTP status the OpenRouter
+// client reports, which its error types do not expose as a method
+func classifyOpenRouterError(err error) retry.Class {
+	if code, ok := openrouter.HTTPStatusCode(err); ok {
+		return retry.ClassifyStatus(code)
 	}
+	return retry.Classify(err)
+}
 
-	// Check if we still have an error after all retries
-	if err != nil {
-		if strings.Contains(err.Error(), "429") || strings.Contains(err.Error(), "Too Many Requests") {
-			return "", fmt.Errorf("OpenRouter API rate limit exceeded after %d retries: %w", maxRetries, err)
+// callWithRetry sends a request with call, admitted like every API call,
+// and retries rate limits and transient failures with the strategy's Retry
+// policy. Backoffs pause every worker sharing the limiter, not just this one.
+func (bs *BaseStrategy) callWithRetry(ctx context.Context, api APIType, estimated int, call func(context.Context) error) error {
+	var admitErr error
+	policy := bs.Retry
+	if policy.Classify == nil && api == APITypeOpenRouter {
+		policy.Classify = classifyOpenRouterError
+	}
+	policy.Wait = func(_ context.Context, d time.Duration) error {
+		bs.Limiter.Backoff(d)
+		return nil
+	}
+	policy.OnRetry = func(attempt int, class retry.Class, wait time.Duration, err error) {
+		logger.Warn("API call failed, retrying", "api", api, "reason", class,
+			"attempt", attempt, "max_attempts", policy.Attempts(), "wait", wait, "error", err)
+		telemetry.ProviderRetries.Inc(string(api), class.String())
+		bs.emitRetry(ctx, attempt, class.String(), err)
+	}
+	err := policy.Do(ctx, func(ctx context.Context) error {
+		if admitErr = bs.admit(ctx, estimated); admitErr != nil {
+			return admitErr
+		}
+		start := time.Now()
+		err := call(ctx)
+		observeCall(api, bs.Model, start, err)
+		bs.Breaker.Record(err)
+		return err
+	})
+	if admitErr != nil {
+		return admitErr
+	}
+	return err
+}
+
+// retryError describes a failed call to provider: still failing after every
+// attempt, or failing in a way that is not retried
+func retryError(provider string, err error) error {
+	var exhausted *retry.ExhaustedError
+	if errors.As(err, &exhausted) {
+		if exhausted.Class == retry.RateLimit {
+			return withKind(ErrRateLimited, fmt.Errorf("%s rate limit exceeded after %d attempts: %w", provider, exhausted.Attempts, exhausted.Err))
 		}
-		return "", fmt.Errorf("error sending message to OpenRouter API: %w", err)
+		return fmt.Errorf("%s still failing after %d attempts: %w", provider, exhausted.Attempts, exhausted.Err)
+	}
+	return fmt.Errorf("error sending message to %s: %w", provider, err)
+}
+
+// admit blocks until an API call may be sent: the provider's circuit breaker
+// must be closed and the shared rate limiter must have capacity
+func (bs *BaseStrategy) admit(ctx context.Context, estimatedTokens int) error {
+	if err := bs.Breaker.Allow(); err != nil {
+		return err
+	}
+	return bs.Limiter.Wait(ctx, estimatedTokens)
+}
+
+// settleTokens corrects the rate limiter with the tokens a call actually used
+// and counts them for the rewrite report, the token usage and metrics
+func (bs *BaseStrategy) settleTokens(api APIType, model string, estimated int, usage callUsage) {
+	actual := usage.Prompt + usage.Completion
+	bs.Limiter.Settle(estimated, actual)
+	bs.tokens.Add(int64(actual))
+	bs.Usage.record(api, model, usage)
+	telemetry.ProviderTokens.Add(float64(actual), string(api), model)
+}
+
+// usedTokens returns the tokens used so far by the strategy and its fallback
+func (bs *BaseStrategy) usedTokens() int64 {
+	used := bs.tokens.Load()
+	if bs.Fallback != nil {
+		used += bs.Fallback.tokens.Load()
+	}
+	return used
+}
+
+// observeCall records the outcome and latency of one LLM API call
+func observeCall(api APIType, model string, start time.Time, err error) {
+	status := telemetry.Status(err)
+	if err != nil && classifyError(api, err) == retry.RateLimit {
+		status = telemetry.StatusRateLimited
 	}
+	telemetry.ProviderRequests.Inc(string(api), model, status)
+	telemetry.ProviderLatency.ObserveSince(start, string(api), model)
+}
 
-	return ors.cleanResponse(rewrittenCode)
+// reasoningText returns the reasoning a model reported separately from its answer
+func reasoningText(choice openrouter.ChatCompletionChoice) string {
+	for _, r := range []*string{choice.Message.Reasoning, choice.Message.ReasoningContent, choice.Reasoning} {
+		if r != nil && *r != "" {
+			return *r
+		}
+	}
+	return ""
 }
 
 // APIType represents the type of API to use for rewriting
@@ -540,14 +895,72 @@ func (ors *OpenRouterStrategy) callOpenRouterLLM(functionSource string) (string,
 	APITypeGemini APIType = "gemini"
 	// APITypeOpenRouter represents OpenRouter API
 	APITypeOpenRouter APIType = "openrouter"
+	// APITypeAnthropic represents Anthropic's Messages API
+	APITypeAnthropic APIType = "anthropic"
+	// APITypeOllama represents a local Ollama server
+	APITypeOllama APIType = "ollama"
+	// APITypeOpenAICompatible represents any server implementing the OpenAI
+	// chat completions API, such as vLLM, LM Studio or llama.cpp
+	APITypeOpenAICompatible APIType = "openai-compatible"
+	// APITypeNone rewrites with deterministic AST transforms instead of an LLM
+	APITypeNone APIType = "none"
 )
 
+// ProviderHost returns the API endpoint host the provider's SDK connects to
+func ProviderHost(apiType APIType) string {
+	switch apiType {
+	case APITypeGemini:
+		return "generativelanguage.googleapis.com"
+	case APITypeOpenRouter:
+		return "openrouter.ai"
+	case APITypeAnthropic:
+		return "api.anthropic.com"
+	case APITypeOllama:
+		if u, err := url.Parse(OllamaHost()); err == nil {
+			return u.Host
+		}
+	case APITypeOpenAICompatible:
+		if u, err := url.Parse(OpenAIBaseURL()); err == nil {
+			return u.Host
+		}
+	}
+	return ""
+}
+
+const (
+	// DefaultGeminiModel is the model used by the Gemini strategy unless overridden
+	DefaultGeminiModel = "gemini-2.5-flash-preview-04-17"
+	// DefaultOpenRouterModel is the model used by the OpenRouter strategy unless overridden
+	DefaultOpenRouterModel = "deepseek/deepseek-chat-v3-0324:free"
+	// DefaultAnthropicModel is the model used by the Claude strategy unless overridden
+	DefaultAnthropicModel = "claude-sonnet-4-5"
+	// DefaultOllamaModel is the model used by the Ollama strategy unless overridden
+	DefaultOllamaModel = "qwen2.5-coder:7b"
+)
+
+// BuildTagHeader starts every file rewritten with the default build tag, so
+// the rewritten copy only builds with -tags=rewritten
+const BuildTagHeader = "//go:build " + DefaultBuildTag + "\n// +build " + DefaultBuildTag + "\n\n"
+
 // Rewriter orchestrates the code rewriting process
 type Rewriter struct {
 	FileHandler    *FileHandler
 	ASTHandler     *ASTHandler
 	Strategy       RewriteStrategy
 	DefaultComment string
+	// LocalStrategy rewrites local-only functions when Strategy is remote; it
+	// must be offline. Nil leaves them unchanged.
+	LocalStrategy RewriteStrategy
+	// Select, when set, limits rewriting to the functions it accepts; the
+	// others are printed unchanged
+	Select func(fd *ast.FuncDecl) bool
+
+	// BuildTag constrains rewritten files (DefaultBuildTag if empty), and
+	// OmitBuildTag leaves them unconstrained; see SetBuildTag
+	BuildTag     string
+	OmitBuildTag bool
+
+	fallback RewriteStrategy // Set by SetFallback, closed with the rewriter
 }
 
 // NewRewriter creates a new Rewriter with default components
@@ -567,25 +980,19 @@ func NewLLMRewriter() *Rewriter {
 
 // NewLLMRewriterWithAPI creates a new Rewriter with the specified API type
 func NewLLMRewriterWithAPI(apiType APIType) *Rewriter {
-	astHandler := NewASTHandler()
-	var strategy RewriteStrategy
-	var commentPrefix string
-
-	switch apiType {
-	case APITypeOpenRouter:
-		strategy = NewOpenRouterStrategy(astHandler, "// This function was rewritten by OpenRouter LLM")
-		commentPrefix = "// This function was rewritten by OpenRouter LLM"
-	default: // APITypeGemini or any other case
-		strategy = NewLLMStrategy(astHandler, "// This function was rewritten by Gemini LLM")
-		commentPrefix = "// This function was rewritten by Gemini LLM"
-	}
+	return NewLLMRewriterWithModel(apiType, "")
+}
 
-	return &Rewriter{
-		FileHandler:    &FileHandler{},
-		ASTHandler:     astHandler,
-		Strategy:       strategy,
-		DefaultComment: commentPrefix,
+// NewLLMRewriterWithModel creates a new Rewriter with the specified API type and model.
+// An empty model name selects the API's default model. Further options
+// configure the strategy, e.g. WithMaxTokens. Strategies added with
+// RegisterStrategy are selected by their name; unknown names select Gemini.
+func NewLLMRewriterWithModel(apiType APIType, model string, opts ...StrategyOption) *Rewriter {
+	if _, ok := lookupStrategy(apiType); !ok {
+		apiType = APITypeGemini
 	}
+	r, _ := NewStrategyRewriter(string(apiType), model, opts...)
+	return r
 }
 
 // SetStrategy changes the rewriting strategy
@@ -593,59 +1000,78 @@ func (r *Rewriter) SetStrategy(strategy RewriteStrategy) {
 	r.Strategy = strategy
 }
 
+// Close releases resources held by the strategies, such as API clients
+func (r *Rewriter) Close() error {
+	var errs []error
+	for _, s := range []RewriteStrategy{r.Strategy, r.fallback} {
+		if c, ok := s.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // RewriteFile reads a file and rewrites its content
-func (r *Rewriter) RewriteFile(filePath string) (string, error) {
+func (r *Rewriter) RewriteFile(ctx context.Context, filePath string) (string, error) {
 	content, err := r.FileHandler.ReadFile(filePath)
 	if err != nil {
 		return "", err
 	}
 
-	return r.RewriteContent(content)
+	return r.RewriteContent(ctx, content)
 }
 
-// RewriteContent rewrites Go code using the current strategy
-func (r *Rewriter) RewriteContent(content string) (string, error) {
+// RewriteContent rewrites Go code using the current strategy. Failures are
+// reported in a comment appended to the content; only a canceled or expired
+// ctx, which stops the requests in flight, is returned as an error.
+func (r *Rewriter) RewriteContent(ctx context.Context, content string) (string, error) {
 	// Parse the Go source code
 	f, err := r.ASTHandler.ParseContent(content)
 	if err != nil {
 		return content + fmt.Sprintf("\n\n// Failed to parse code for rewriting: %v\n", err), nil
 	}
 
-	fmt.Println("Applying rewriting strategy to the code...")
+	logger.Debug("Applying rewriting strategy to the code")
 
 	// Apply the rewriting strategy
-	rewritten, err := r.Strategy.Rewrite(f)
+	rewritten, err := r.applyStrategy(ctx, f)
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("rewriting stopped: %w", context.Cause(ctx))
+	}
 	if err != nil {
 		errMsg := fmt.Sprintf("\n\n// Error during rewriting: %v\n", err)
-		fmt.Println(errMsg)
+		logger.Error("Rewriting failed", "error", err)
 		return content + errMsg, nil
 	}
 
 	// If no changes were made, add a comment to the entire file
 	if !rewritten {
-		fmt.Println("WARNING: No changes were made during rewriting")
+		logger.Warn("No changes were made during rewriting")
 		return content + "\n\n// No changes made by the MetamorphLLM\n", nil
 	}
 
-	fmt.Println("Successfully rewrote code. Converting AST back to string...")
+	logger.Debug("Successfully rewrote code, converting the AST back to source")
 
 	// Convert the AST back to a string
 	result, err := r.ASTHandler.PrintAST(f)
 	if err != nil {
 		errMsg := fmt.Sprintf("\n\n// Failed to print rewritten code: %v\n", err)
-		fmt.Println(errMsg)
+		logger.Error("Failed to print rewritten code", "error", err)
 		return content + errMsg, nil
 	}
 
-	// Add build tag to the rewritten content
-	resultWithTag := "// +build rewritten\n\n" + result
-
 	// Check if the content actually changed
 	if result == content {
-		fmt.Println("WARNING: AST printer output matches original content. Adding success comment anyway.")
+		logger.Warn("AST printer output matches the original content, adding a success comment anyway")
 		return content + "\n\n// Processed by MetamorphLLM (no changes needed)\n", nil
 	}
 
+	// Add the build constraint and format the file as a whole
+	resultWithTag, err := ConstrainSource(result, r.EffectiveBuildTag())
+	if err != nil {
+		logger.Error("Failed to constrain rewritten code", "error", err)
+		return content + fmt.Sprintf("\n\n// Failed to constrain rewritten code: %v\n", err), nil
+	}
 	return resultWithTag, nil
 }
 
@@ -0,0 +1,98 @@
+package rewriter
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/revrost/go-openrouter"
+)
+
+// ProviderRouting restricts which upstream providers OpenRouter may serve a
+// model from. Provider names are OpenRouter slugs such as "deepinfra" or "together".
+type ProviderRouting struct {
+	Order          []string // Providers to try first, in order
+	Only           []string // Providers allowed to serve requests (empty allows all)
+	Ignore         []string // Providers never used
+	DataCollection string   // "deny" skips providers that may store or train on prompts; "allow" or empty keeps the default
+	NoFallbacks    bool     // Fail instead of falling back to providers outside Order
+}
+
+// IsZero reports whether the routing leaves OpenRouter's defaults unchanged
+func (pr ProviderRouting) IsZero() bool {
+	return len(pr.Order) == 0 && len(pr.Only) == 0 && len(pr.Ignore) == 0 && pr.DataCollection == "" && !pr.NoFallbacks
+}
+
+// Validate rejects unknown data collection policies and contradictory lists
+func (pr ProviderRouting) Validate() error {
+	switch openrouter.DataCollection(pr.DataCollection) {
+	case "", openrouter.DataCollectionAllow, openrouter.DataCollectionDeny:
+	default:
+		return fmt.Errorf("unknown data collection policy %q (expected allow or deny)", pr.DataCollection)
+	}
+	for _, provider := range pr.Ignore {
+		if slices.Contains(pr.Order, provider) || slices.Contains(pr.Only, provider) {
+			return fmt.Errorf("provider %q is both preferred and ignored", provider)
+		}
+	}
+	if len(pr.Only) > 0 {
+		for _, provider := range pr.Order {
+			if !slices.Contains(pr.Only, provider) {
+				return fmt.Errorf("provider %q is ordered but not in the allowed providers", provider)
+			}
+		}
+	}
+	if pr.NoFallbacks && len(pr.Order) == 0 && len(pr.Only) == 0 {
+		return fmt.Errorf("disabling fallbacks requires a provider order or allowed providers")
+	}
+	return nil
+}
+
+// chatProvider returns the provider preferences of a request, or nil for the defaults
+func (pr ProviderRouting) chatProvider() *openrouter.ChatProvider {
+	if pr.IsZero() {
+		return nil
+	}
+	provider := &openrouter.ChatProvider{
+		Order:          pr.Order,
+		Only:           pr.Only,
+		Ignore:         pr.Ignore,
+		DataCollection: openrouter.DataCollection(pr.DataCollection),
+	}
+	if pr.NoFallbacks {
+		allow := false
+		provider.AllowFallbacks = &allow
+	}
+	return provider
+}
+
+// SetProviderRouting sets the provider preferences sent with every request
+func (ors *OpenRouterStrategy) SetProviderRouting(routing ProviderRouting) error {
+	if err := routing.Validate(); err != nil {
+		return err
+	}
+	ors.Routing = routing
+	return nil
+}
+
+// routingStrategy is implemented by strategies that can choose upstream providers
+type routingStrategy interface {
+	SetProviderRouting(routing ProviderRouting) error
+}
+
+// SetProviderRouting configures provider routing on the current strategy and
+// the fallback strategy, whichever of them supports it. Call it after SetFallback.
+func (r *Rewriter) SetProviderRouting(routing ProviderRouting) error {
+	configured := false
+	for _, strategy := range []RewriteStrategy{r.Strategy, r.fallback} {
+		if s, ok := strategy.(routingStrategy); ok {
+			if err := s.SetProviderRouting(routing); err != nil {
+				return err
+			}
+			configured = true
+		}
+	}
+	if !configured {
+		return fmt.Errorf("strategy %T does not support provider routing", r.Strategy)
+	}
+	return nil
+}
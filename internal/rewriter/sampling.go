@@ -0,0 +1,72 @@
+package rewriter
+
+import "fmt"
+
+// Sampling holds the generation parameters sent with every LLM request
+type Sampling struct {
+	Temperature float64 `json:"temperature"`
+	TopP        float64 `json:"top_p"`
+}
+
+// DefaultSampling keeps rewrites close to deterministic
+var DefaultSampling = Sampling{Temperature: 0.1, TopP: 0.9}
+
+// Validate rejects values the providers do not accept
+func (s Sampling) Validate() error {
+	if s.Temperature < 0 || s.Temperature > 2 {
+		return fmt.Errorf("temperature must be between 0 and 2, got %g", s.Temperature)
+	}
+	if s.TopP <= 0 || s.TopP > 1 {
+		return fmt.Errorf("top-p must be above 0 and at most 1, got %g", s.TopP)
+	}
+	return nil
+}
+
+// String describes the parameters, e.g. "temperature=0.1 top_p=0.9"
+func (s Sampling) String() string {
+	return fmt.Sprintf("temperature=%g top_p=%g", s.Temperature, s.TopP)
+}
+
+// sampling returns the parameters of the strategy's requests
+func (bs *BaseStrategy) sampling() Sampling {
+	if bs.Sampling == nil {
+		return DefaultSampling
+	}
+	return *bs.Sampling
+}
+
+// samplingHash returns the part of the incremental input hash that depends on
+// the sampling parameters. It is empty for the defaults, so hashes recorded
+// before the parameters were configurable stay valid.
+func (bs *BaseStrategy) samplingHash() string {
+	if s := bs.sampling(); s != DefaultSampling {
+		return "\x00" + s.String()
+	}
+	return ""
+}
+
+// SetSampling sets the generation parameters of the strategy and its fallback
+func (bs *BaseStrategy) SetSampling(s Sampling) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	bs.Sampling = &s
+	if bs.Fallback != nil {
+		bs.Fallback.Sampling = &s
+	}
+	return nil
+}
+
+// samplingStrategy is implemented by strategies with configurable generation parameters
+type samplingStrategy interface {
+	SetSampling(s Sampling) error
+}
+
+// SetSampling configures the generation parameters if the current strategy supports them
+func (r *Rewriter) SetSampling(s Sampling) error {
+	strategy, ok := r.Strategy.(samplingStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support sampling parameters", r.Strategy)
+	}
+	return strategy.SetSampling(s)
+}
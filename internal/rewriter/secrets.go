@@ -0,0 +1,248 @@
+package rewriter
+
+import (
+	"context"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Hekzory/MetamorphLLM/internal/redact"
+)
+
+// SecretPolicy decides what happens to functions whose source contains secrets
+type SecretPolicy string
+
+const (
+	// SecretsRedact replaces secrets with placeholders before the LLM call and
+	// restores them in the response (the default)
+	SecretsRedact SecretPolicy = "redact"
+	// SecretsRefuse keeps functions containing secrets unchanged and never sends them
+	SecretsRefuse SecretPolicy = "refuse"
+	// SecretsOff sends sources verbatim
+	SecretsOff SecretPolicy = "off"
+)
+
+// secretPatterns match credentials and internal infrastructure inside string
+// literals and comments. The first submatch, if any, is the secret itself.
+var secretPatterns = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{"private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+	{"AWS access key", regexp.MustCompile(`\b((?:AKIA|ASIA)[0-9A-Z]{16})\b`)},
+	{"GitHub token", regexp.MustCompile(`\b((?:ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"Slack token", regexp.MustCompile(`\b(xox[abprs]-[A-Za-z0-9-]{10,})`)},
+	{"Google API key", regexp.MustCompile(`\b(AIza[0-9A-Za-z_-]{35})`)},
+	{"API key", regexp.MustCompile(`\b((?:sk|rk)(?:-or-v1|-proj|_live|_test)?[-_][A-Za-z0-9]{20,})`)},
+	{"JWT", regexp.MustCompile(`\b(eyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,})`)},
+	{"URL credentials", regexp.MustCompile(`[a-z][a-z0-9+.-]*://[^/\s:@"]+:([^/\s@"]+)@`)},
+	{"credential", regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key)\s*[:=]\s*([^\s"',;]{6,})`)},
+	{"private hostname", regexp.MustCompile(`(?i)\b((?:[a-z0-9-]+\.)+(?:internal|corp|lan|intranet|local|localdomain))\b`)},
+	{"private IP", regexp.MustCompile(`\b(10\.\d{1,3}\.\d{1,3}\.\d{1,3}|192\.168\.\d{1,3}\.\d{1,3}|172\.(?:1[6-9]|2\d|3[01])\.\d{1,3}\.\d{1,3})\b`)},
+}
+
+// highEntropyToken matches long runs of key-like characters, checked for entropy
+var highEntropyToken = regexp.MustCompile(`[A-Za-z0-9+/=_-]{24,}`)
+
+// Secret is a suspected secret found in a function's source
+type Secret struct {
+	Kind  string
+	Value string
+}
+
+// FindSecrets scans the string literals and comments of Go source for secrets
+func FindSecrets(source string) []Secret {
+	var secrets []Secret
+	seen := make(map[string]bool)
+	add := func(kind, value string) {
+		if !seen[value] {
+			seen[value] = true
+			secrets = append(secrets, Secret{Kind: kind, Value: value})
+		}
+	}
+
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(source))
+	s.Init(file, []byte(source), nil, scanner.ScanComments)
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok != token.STRING && tok != token.CHAR && tok != token.COMMENT {
+			continue
+		}
+
+		for _, p := range secretPatterns {
+			for _, m := range p.re.FindAllStringSubmatch(lit, -1) {
+				value := m[0]
+				if len(m) > 1 && m[1] != "" {
+					value = m[1]
+				}
+				add(p.kind, value)
+			}
+		}
+		for _, candidate := range highEntropyToken.FindAllString(lit, -1) {
+			if looksRandom(candidate) {
+				add("high-entropy string", candidate)
+			}
+		}
+	}
+	return secrets
+}
+
+// looksRandom reports whether s has the character mix and entropy of a
+// generated key rather than of words, paths or identifiers
+func looksRandom(s string) bool {
+	var lower, upper, digit bool
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		}
+	}
+	if !digit || !(lower || upper) {
+		return false
+	}
+	return shannonEntropy(s) >= 4.0
+}
+
+// shannonEntropy returns the entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	n := float64(len(s))
+	entropy := 0.0
+	for _, c := range counts {
+		p := float64(c) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// secretPlaceholder is what the LLM sees in place of the i-th secret
+func secretPlaceholder(i int) string {
+	return fmt.Sprintf("METAMORPH_REDACTED_%d", i+1)
+}
+
+// redactSecrets replaces every secret in source with a placeholder and returns
+// the placeholders mapped to the values they replace
+func redactSecrets(source string, secrets []Secret) (string, map[string]string) {
+	// Longest first, so a secret containing another is replaced whole
+	sorted := append([]Secret(nil), secrets...)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i].Value) > len(sorted[j].Value) })
+
+	placeholders := make(map[string]string, len(sorted))
+	for i, secret := range sorted {
+		placeholder := secretPlaceholder(i)
+		placeholders[placeholder] = secret.Value
+		source = strings.ReplaceAll(source, secret.Value, placeholder)
+	}
+	return source, placeholders
+}
+
+// restoreSecrets puts the original values back into a rewritten function. It
+// fails if the LLM dropped or altered a placeholder, because the rewrite would
+// then no longer contain the original value.
+func restoreSecrets(rewritten string, placeholders map[string]string) (string, error) {
+	// Replace longer placeholders first so _1 does not clobber _10
+	keys := make([]string, 0, len(placeholders))
+	for placeholder := range placeholders {
+		if !strings.Contains(rewritten, placeholder) {
+			return "", fmt.Errorf("rewritten code lost redacted value %s", placeholder)
+		}
+		keys = append(keys, placeholder)
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	for _, placeholder := range keys {
+		rewritten = strings.ReplaceAll(rewritten, placeholder, placeholders[placeholder])
+	}
+	return rewritten, nil
+}
+
+// secretKinds summarizes secrets for log messages without revealing them
+func secretKinds(secrets []Secret) string {
+	kinds := make([]string, len(secrets))
+	for i, s := range secrets {
+		kinds[i] = s.Kind
+	}
+	return strings.Join(kinds, ", ")
+}
+
+// send passes functionSource to the provider. Provider errors often echo the
+// request, so their messages are redacted before anyone prints them.
+func (bs *BaseStrategy) send(ctx context.Context, functionSource string) (string, error) {
+	rewritten, err := bs.rewriteFunc(ctx, functionSource)
+	return rewritten, redact.Error(err)
+}
+
+// callWithSecretPolicy sends functionSource to the LLM according to the
+// strategy's secret policy. Functions that cannot be sent safely are returned
+// unchanged, which Rewrite treats as analyzed without changes. Deterministic
+// transforms keep the function on the machine, so no policy applies to them.
+func (bs *BaseStrategy) callWithSecretPolicy(ctx context.Context, name, functionSource string) (string, error) {
+	if bs.Secrets == SecretsOff || bs.Provider == string(APITypeNone) {
+		return bs.send(ctx, functionSource)
+	}
+	secrets := FindSecrets(functionSource)
+	if len(secrets) == 0 {
+		return bs.send(ctx, functionSource)
+	}
+
+	if bs.Secrets == SecretsRefuse {
+		logger.Warn("Function contains possible secrets, not sending it", "function", name, "kinds", secretKinds(secrets))
+		return functionSource, nil
+	}
+
+	redacted, placeholders := redactSecrets(functionSource, secrets)
+	logger.Info("Redacted possible secrets before sending", "function", name, "count", len(secrets), "kinds", secretKinds(secrets))
+	rewritten, err := bs.send(ctx, redacted)
+	if err != nil {
+		return "", err
+	}
+	restored, err := restoreSecrets(rewritten, placeholders)
+	if err != nil {
+		logger.Warn("Keeping function unchanged", "function", name, "error", err)
+		return functionSource, nil
+	}
+	return restored, nil
+}
+
+// SetSecretPolicy validates and sets the policy for functions containing secrets
+func (bs *BaseStrategy) SetSecretPolicy(policy SecretPolicy) error {
+	switch policy {
+	case SecretsRedact, SecretsRefuse, SecretsOff:
+		bs.Secrets = policy
+		return nil
+	case "":
+		bs.Secrets = SecretsRedact
+		return nil
+	}
+	return fmt.Errorf("unknown secret policy %q (redact, refuse or off)", policy)
+}
+
+// SetSecretPolicy sets the secret policy if the current strategy sends code to an LLM
+func (r *Rewriter) SetSecretPolicy(policy SecretPolicy) error {
+	s, ok := r.Strategy.(baseStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not send code to an LLM", r.Strategy)
+	}
+	if err := s.base().SetSecretPolicy(policy); err != nil {
+		return err
+	}
+	if fb := s.base().Fallback; fb != nil {
+		fb.Secrets = s.base().Secrets
+	}
+	return nil
+}
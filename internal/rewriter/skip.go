@@ -0,0 +1,97 @@
+package rewriter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Kinds of code that are not rewritten unless told otherwise
+const (
+	SkipVendor     = "vendor"      // Files under a vendor/ directory
+	SkipThirdParty = "third_party" // Files under a third_party/ directory
+	SkipGenerated  = "generated"   // Files with a "// Code generated ... DO NOT EDIT." header
+)
+
+// SkipKinds lists every kind of code SkipRules can skip
+var SkipKinds = []string{SkipVendor, SkipThirdParty, SkipGenerated}
+
+// DefaultSkip is the -skip value that skips every kind
+var DefaultSkip = strings.Join(SkipKinds, ",")
+
+// SkipRules selects the kinds of code that are left alone. Rewriting vendored
+// dependencies and generated stubs wastes tokens, and the rewritten files are
+// overwritten by the next 'go mod vendor' or code generation anyway.
+type SkipRules map[string]bool
+
+// DefaultSkipRules returns rules that skip every kind
+func DefaultSkipRules() SkipRules {
+	rules, _ := ParseSkipRules(DefaultSkip)
+	return rules
+}
+
+// ParseSkipRules parses a comma-separated list of kinds; an empty list skips nothing
+func ParseSkipRules(value string) (SkipRules, error) {
+	rules := make(SkipRules)
+	for _, kind := range strings.Split(value, ",") {
+		kind = strings.TrimSpace(kind)
+		if kind == "" {
+			continue
+		}
+		if !slices.Contains(SkipKinds, kind) {
+			return nil, fmt.Errorf("unknown kind of code to skip %q (expected %s)", kind, strings.Join(SkipKinds, ", "))
+		}
+		rules[kind] = true
+	}
+	return rules, nil
+}
+
+// String returns the rules as ParseSkipRules reads them
+func (sr SkipRules) String() string {
+	var kinds []string
+	for _, kind := range SkipKinds {
+		if sr[kind] {
+			kinds = append(kinds, kind)
+		}
+	}
+	return strings.Join(kinds, ",")
+}
+
+// PathReason returns why the file at path is skipped based on its location,
+// or "" if it is not
+func (sr SkipRules) PathReason(path string) string {
+	dirs := strings.Split(filepath.ToSlash(filepath.Dir(path)), "/")
+	for _, kind := range []string{SkipVendor, SkipThirdParty} {
+		if sr[kind] && slices.Contains(dirs, kind) {
+			return fmt.Sprintf("%s code (under %s/)", kind, kind)
+		}
+	}
+	return ""
+}
+
+// Reason returns why the file at path with the given source is skipped, or ""
+// if it is rewritten. Sources that do not parse are not skipped; the rewrite
+// reports them.
+func (sr SkipRules) Reason(path, source string) string {
+	if reason := sr.PathReason(path); reason != "" {
+		return reason
+	}
+	if sr[SkipGenerated] && IsGenerated(source) {
+		return "generated code (DO NOT EDIT header)"
+	}
+	return ""
+}
+
+// IsGenerated reports whether source has the "// Code generated ... DO NOT
+// EDIT." comment that marks generated Go files, before its package clause
+func IsGenerated(source string) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), "", source, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return false
+	}
+	return ast.IsGenerated(f)
+}
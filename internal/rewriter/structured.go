@@ -0,0 +1,107 @@
+package rewriter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	openrouter "github.com/revrost/go-openrouter"
+)
+
+// structuredInstruction is appended to the prompt when structured output is requested
+const structuredInstruction = `
+
+Respond with a JSON object of the form {"code": "<the complete Go code>"} and nothing else.`
+
+// structuredResponse is the JSON object requested from the model
+type structuredResponse struct {
+	Code string `json:"code"`
+}
+
+// codeSchema is the JSON schema of structuredResponse sent to OpenRouter
+var codeSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {"code": {"type": "string", "description": "The complete rewritten Go code"}},
+  "required": ["code"],
+  "additionalProperties": false
+}`)
+
+// geminiCodeSchema is the response schema of structuredResponse for Gemini
+var geminiCodeSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"code": {Type: genai.TypeString, Description: "The complete rewritten Go code"},
+	},
+	Required: []string{"code"},
+}
+
+// openRouterResponseFormat requests a response matching codeSchema
+func openRouterResponseFormat() *openrouter.ChatCompletionResponseFormat {
+	return &openrouter.ChatCompletionResponseFormat{
+		Type: openrouter.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openrouter.ChatCompletionResponseFormatJSONSchema{
+			Name:   "rewritten_code",
+			Schema: codeSchema,
+			Strict: true,
+		},
+	}
+}
+
+// prompt returns the prompt sent to the provider for a function
+func (bs *BaseStrategy) prompt(functionSource string) string {
+	if bs.Structured {
+		return bs.createPrompt(functionSource) + structuredInstruction
+	}
+	return bs.createPrompt(functionSource)
+}
+
+// parseResponse extracts the code from a model response. Structured responses are
+// decoded from JSON; providers or models that ignore the requested format fall back
+// to free-text cleaning.
+func (bs *BaseStrategy) parseResponse(response string) (string, error) {
+	if !bs.Structured {
+		return bs.cleanResponse(response)
+	}
+
+	if code, ok := decodeStructured(response); ok {
+		return bs.cleanResponse(code)
+	}
+	logger.Debug("Response is not the requested JSON object, falling back to free-text cleaning")
+	return bs.cleanResponse(response)
+}
+
+// decodeStructured decodes a {"code": ...} object, tolerating inline reasoning and a
+// surrounding markdown fence
+func decodeStructured(response string) (string, bool) {
+	text := strings.TrimSpace(stripReasoning(response))
+	text = strings.TrimPrefix(text, "```json")
+	text = strings.TrimPrefix(text, "```")
+	text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+
+	var sr structuredResponse
+	if err := json.Unmarshal([]byte(strings.TrimSpace(text)), &sr); err != nil || sr.Code == "" {
+		return "", false
+	}
+	return sr.Code, true
+}
+
+// SetStructuredOutput turns JSON-mode responses on or off
+func (bs *BaseStrategy) SetStructuredOutput(enabled bool) {
+	bs.Structured = enabled
+}
+
+// structuredStrategy is implemented by strategies that can request structured output
+type structuredStrategy interface {
+	SetStructuredOutput(enabled bool)
+}
+
+// SetStructuredOutput turns JSON-mode responses on or off if the current strategy supports it
+func (r *Rewriter) SetStructuredOutput(enabled bool) error {
+	s, ok := r.Strategy.(structuredStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support structured output", r.Strategy)
+	}
+	s.SetStructuredOutput(enabled)
+	return nil
+}
@@ -0,0 +1,295 @@
+package rewriter
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Hekzory/MetamorphLLM/internal/prompts"
+)
+
+// TechniqueType is an obfuscation technique the prompt can ask for
+type TechniqueType string
+
+const (
+	// TechniqueDeadCode inserts code that never affects the result
+	TechniqueDeadCode TechniqueType = "dead-code"
+	// TechniqueControlFlowFlattening runs the body from a state machine
+	TechniqueControlFlowFlattening TechniqueType = "control-flow-flattening"
+	// TechniqueOpaquePredicates guards code with conditions of fixed outcome
+	TechniqueOpaquePredicates TechniqueType = "opaque-predicates"
+	// TechniqueStringEncryption decodes string literals at run time
+	TechniqueStringEncryption TechniqueType = "string-encryption"
+	// TechniqueInstructionSubstitution replaces expressions with equivalent ones
+	TechniqueInstructionSubstitution TechniqueType = "instruction-substitution"
+	// TechniqueVariableRenaming gives local variables meaningless names
+	TechniqueVariableRenaming TechniqueType = "variable-renaming"
+)
+
+// Techniques lists the transformations the prompt can ask for
+var Techniques = []TechniqueType{
+	TechniqueDeadCode,
+	TechniqueControlFlowFlattening,
+	TechniqueOpaquePredicates,
+	TechniqueStringEncryption,
+	TechniqueInstructionSubstitution,
+	TechniqueVariableRenaming,
+}
+
+// techniqueTemplate is the part of the prompt specific to a technique
+type techniqueTemplate struct {
+	Name         string // As the prompt names it, e.g. "Dead Code Insertion"
+	Instructions string // What the model is asked to do
+	Example      string // Built-in example, shown when no example bank is used
+}
+
+// techniqueTemplates holds the prompt template of every technique. The Dead
+// Code Insertion template reproduces the original prompt, so its hashes stay
+// valid.
+var techniqueTemplates = map[TechniqueType]techniqueTemplate{
+	TechniqueDeadCode: {
+		Name:         "Dead Code Insertion",
+		Instructions: "Add varied and plausible-looking dead code (unused variables, pointless computations, non-impacting conditions, unreachable blocks). Avoid trivial dead code (e.g., if false {}). The added code must not alter the function's semantics or final result.",
+		Example:      strings.TrimPrefix(defaultExample, exampleHeader),
+	},
+	TechniqueControlFlowFlattening: {
+		Name:         "Control Flow Flattening",
+		Instructions: "Split the function body into basic blocks and run them from a `for` loop with a `switch` on a state variable, where every block sets the state of the block that follows it. Loops and branches of the original become state transitions. Side effects must happen in the original order and every return must return the original values.",
+		Example: `// --- Example Original Function ---
+package main
+
+func calculateSum(a, b int) int {
+    return a + b
+}
+// --- End Example Original Function ---
+
+// --- Example Obfuscated Output (Control Flow Flattening Only) ---
+package main
+
+func calculateSum(a, b int) int {
+    var result int
+    state := 2
+    for {
+        switch state {
+        case 0:
+            return result
+        case 1:
+            result += b
+            state = 0
+        case 2:
+            result = a
+            state = 1
+        }
+    }
+}
+// --- End Example Obfuscated Output ---`,
+	},
+	TechniqueOpaquePredicates: {
+		Name:         "Opaque Predicates",
+		Instructions: "Guard the original code with opaque predicates: conditions whose outcome never changes but is hard to determine statically, such as `(n*(n+1))%2 == 0` for an integer n. Predicates must hold for every value, including on integer overflow. Branches that never run may contain plausible but wrong code. The function's semantics and final result must not change.",
+		Example: `// --- Example Original Function ---
+package main
+
+func calculateSum(a, b int) int {
+    return a + b
+}
+// --- End Example Original Function ---
+
+// --- Example Obfuscated Output (Opaque Predicates Only) ---
+package main
+
+func calculateSum(a, b int) int {
+    if (a*(a+1))%2 == 0 {
+        if (b|1)&1 == 1 {
+            return a + b
+        }
+        return a - b
+    }
+    return b * a
+}
+// --- End Example Obfuscated Output ---`,
+	},
+	TechniqueStringEncryption: {
+		Name:         "String Encryption",
+		Instructions: "Replace string literals with code that decodes them at run time, for example from base64 with encoding/base64, from XOR-ed byte slices or from reversed runes. Every decoded string must equal the original literal exactly. Leave literals in constant declarations, struct tags and import paths unchanged.",
+		Example: `// --- Example Original Function ---
+package main
+
+func greet(name string) string {
+    return "Hello, " + name
+}
+// --- End Example Original Function ---
+
+// --- Example Obfuscated Output (String Encryption Only) ---
+package main
+
+import "encoding/base64"
+
+func greet(name string) string {
+    prefix, _ := base64.StdEncoding.DecodeString("SGVsbG8sIA==")
+    return string(prefix) + name
+}
+// --- End Example Obfuscated Output ---`,
+	},
+	TechniqueInstructionSubstitution: {
+		Name:         "Instruction Substitution",
+		Instructions: "Replace arithmetic, bitwise and comparison expressions with equivalent but more complex ones, such as `a + b` as `(a ^ b) + 2*(a & b)` or `x == y` as `!(x != y)`. Every substitution must be equivalent for all values of its operand types, including on integer overflow and for floating-point operands.",
+		Example: `// --- Example Original Function ---
+package main
+
+func calculateSum(a, b int) int {
+    return a + b
+}
+// --- End Example Original Function ---
+
+// --- Example Obfuscated Output (Instruction Substitution Only) ---
+package main
+
+func calculateSum(a, b int) int {
+    return (a ^ b) + ((a & b) << 1)
+}
+// --- End Example Obfuscated Output ---`,
+	},
+	TechniqueVariableRenaming: {
+		Name:         "Variable Renaming",
+		Instructions: "Give the function's local variables meaningless or misleading names, such as `l1`, `O0` or `buffer` for a counter. Do not rename the function, its parameters or named results, package-level identifiers, struct fields, methods or labels of the original code. Every renamed variable must stay unique in its scope.",
+		Example: `// --- Example Original Function ---
+package main
+
+func average(values []float64) float64 {
+    total := 0.0
+    for _, v := range values {
+        total += v
+    }
+    return total / float64(len(values))
+}
+// --- End Example Original Function ---
+
+// --- Example Obfuscated Output (Variable Renaming Only) ---
+package main
+
+func average(values []float64) float64 {
+    O0 := 0.0
+    for _, lI := range values {
+        O0 += lI
+    }
+    return O0 / float64(len(values))
+}
+// --- End Example Obfuscated Output ---`,
+	},
+}
+
+// ParseTechnique returns the technique called name
+func ParseTechnique(name string) (TechniqueType, error) {
+	t := TechniqueType(strings.TrimSpace(name))
+	if !slices.Contains(Techniques, t) {
+		return "", fmt.Errorf("unknown technique %q (expected one of %s)", name, TechniqueNames())
+	}
+	return t, nil
+}
+
+// ParseTechniques parses a comma-separated list of techniques, without duplicates
+func ParseTechniques(list string) ([]TechniqueType, error) {
+	var techniques []TechniqueType
+	for _, name := range strings.Split(list, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		t, err := ParseTechnique(name)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(techniques, t) {
+			techniques = append(techniques, t)
+		}
+	}
+	if len(techniques) == 0 {
+		return nil, fmt.Errorf("at least one technique is required")
+	}
+	return techniques, nil
+}
+
+// TechniqueNames returns the names of all techniques, comma-separated
+func TechniqueNames() string {
+	names := make([]string, len(Techniques))
+	for i, t := range Techniques {
+		names[i] = string(t)
+	}
+	return strings.Join(names, ", ")
+}
+
+// SetTechniques selects the techniques the prompt asks for, for the current
+// and the fallback strategy. Several techniques are applied together.
+func (r *Rewriter) SetTechniques(techniques ...TechniqueType) error {
+	s, ok := r.Strategy.(baseStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support technique selection", r.Strategy)
+	}
+	if len(techniques) == 0 {
+		return fmt.Errorf("at least one technique is required")
+	}
+	for _, t := range techniques {
+		if _, ok := techniqueTemplates[t]; !ok {
+			return fmt.Errorf("unknown technique %q (expected one of %s)", t, TechniqueNames())
+		}
+	}
+	bs := s.base()
+	bs.Techniques = slices.Clone(techniques)
+	if bs.Fallback != nil {
+		bs.Fallback.Techniques = bs.Techniques
+	}
+	return nil
+}
+
+// SetPrompts makes the current and the fallback strategy render their prompts
+// from lib, using the templates of variant where there are any
+func (r *Rewriter) SetPrompts(lib *prompts.Library, variant string) error {
+	s, ok := r.Strategy.(baseStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support prompt templates", r.Strategy)
+	}
+	bs := s.base()
+	bs.Prompts, bs.PromptVariant = lib, variant
+	if bs.Fallback != nil {
+		bs.Fallback.Prompts, bs.Fallback.PromptVariant = lib, variant
+	}
+	return nil
+}
+
+// techniques returns the selected techniques, TechniqueDeadCode by default
+func (bs *BaseStrategy) techniques() []TechniqueType {
+	if len(bs.Techniques) == 0 {
+		return []TechniqueType{TechniqueDeadCode}
+	}
+	return bs.Techniques
+}
+
+// techniqueInstructions returns the prompt's description of the selected techniques
+func (bs *BaseStrategy) techniqueInstructions() string {
+	techniques := bs.techniques()
+	if len(techniques) == 1 {
+		t := techniqueTemplates[techniques[0]]
+		return fmt.Sprintf("Rewrite the function below using **only the %s technique**. %s", t.Name, t.Instructions)
+	}
+	var sb strings.Builder
+	sb.WriteString("Rewrite the function below using **only the following techniques**, all applied together:")
+	for _, technique := range techniques {
+		t := techniqueTemplates[technique]
+		fmt.Fprintf(&sb, "\n- **%s**: %s", t.Name, t.Instructions)
+	}
+	return sb.String()
+}
+
+// techniqueList returns the names of the selected techniques as a phrase,
+// e.g. "Dead Code Insertion and Opaque Predicates"
+func (bs *BaseStrategy) techniqueList() string {
+	techniques := bs.techniques()
+	names := make([]string, len(techniques))
+	for i, t := range techniques {
+		names[i] = techniqueTemplates[t].Name
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
@@ -0,0 +1,91 @@
+package rewriter
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// bodyChecker type-checks a file with a rewritten body in place of the
+// original one. The file's other files are not loaded, so only errors the
+// original file does not already have reject a rewrite: a call to a function
+// declared next to the file is undefined either way.
+type bodyChecker struct {
+	fset     *token.FileSet
+	file     *ast.File
+	importer types.Importer
+	baseline map[string]bool
+}
+
+// newBodyChecker returns a checker for f, or nil if the strategy does not
+// type-check rewrites
+func (bs *BaseStrategy) newBodyChecker(f *ast.File) *bodyChecker {
+	if !bs.TypeCheck {
+		return nil
+	}
+	c := &bodyChecker{
+		fset: bs.ASTHandler.FileSet,
+		file: f,
+		// Imported packages are parsed into a set of their own
+		importer: importer.ForCompiler(token.NewFileSet(), "source", nil),
+		baseline: make(map[string]bool),
+	}
+	for _, msg := range c.errors() {
+		c.baseline[msg] = true
+	}
+	return c
+}
+
+// errors type-checks the file as it is and returns the error messages
+func (c *bodyChecker) errors() []string {
+	var msgs []string
+	conf := types.Config{
+		Importer: c.importer,
+		Error: func(err error) {
+			if te, ok := err.(types.Error); ok {
+				msgs = append(msgs, te.Msg)
+			} else {
+				msgs = append(msgs, err.Error())
+			}
+		},
+	}
+	// Errors are collected above; the returned one is the first of them
+	_, _ = conf.Check(c.file.Name.Name, c.fset, []*ast.File{c.file}, nil)
+	return msgs
+}
+
+// check puts the rewritten body in place of *body and returns the first type
+// error it introduces. The original body is restored either way. A nil checker
+// accepts every rewrite.
+func (c *bodyChecker) check(body **ast.BlockStmt, rewritten *ast.BlockStmt) error {
+	if c == nil {
+		return nil
+	}
+	original := *body
+	*body = rewritten
+	defer func() { *body = original }()
+
+	for _, msg := range c.errors() {
+		if !c.baseline[msg] {
+			// Some messages span lines, e.g. the have/want of return values
+			return errors.New(strings.Join(strings.Fields(msg), " "))
+		}
+	}
+	return nil
+}
+
+// SetTypeCheck makes the strategy type-check every rewritten function in the
+// context of its file and keep the original body of those that introduce
+// type errors, such as undefined identifiers or mismatched return values
+func (r *Rewriter) SetTypeCheck(enabled bool) error {
+	s, ok := r.Strategy.(baseStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support type checking", r.Strategy)
+	}
+	s.base().TypeCheck = enabled
+	return nil
+}
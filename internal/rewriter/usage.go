@@ -0,0 +1,221 @@
+package rewriter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Price is the cost of a model in USD per million tokens
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// PriceTable maps model names to prices
+type PriceTable map[string]Price
+
+// DefaultPrices contains list prices for the default models. Models with a
+// ":free" suffix are always priced at zero.
+var DefaultPrices = PriceTable{
+	DefaultGeminiModel:     {Input: 0.15, Output: 0.60},
+	DefaultOpenRouterModel: {Input: 0, Output: 0},
+	DefaultAnthropicModel:  {Input: 3, Output: 15},
+	DefaultOllamaModel:     {Input: 0, Output: 0}, // Runs locally
+}
+
+// LoadPrices reads a JSON price table and merges it over the defaults
+func LoadPrices(path string) (PriceTable, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price table: %w", err)
+	}
+
+	var custom PriceTable
+	if err := json.Unmarshal(content, &custom); err != nil {
+		return nil, fmt.Errorf("failed to parse price table %s: %w", path, err)
+	}
+
+	prices := make(PriceTable, len(DefaultPrices)+len(custom))
+	for model, price := range DefaultPrices {
+		prices[model] = price
+	}
+	for model, price := range custom {
+		prices[model] = price
+	}
+	return prices, nil
+}
+
+// Lookup returns the price of a model and whether it is known
+func (pt PriceTable) Lookup(model string) (Price, bool) {
+	if strings.HasSuffix(model, ":free") {
+		return Price{}, true
+	}
+	price, ok := pt[model]
+	return price, ok
+}
+
+// callUsage is what one API call used, as the provider reported it
+type callUsage struct {
+	Prompt, Completion int
+	// Cost is the cost in USD the provider reported, if Billed is set
+	Cost   float64
+	Billed bool
+}
+
+// ModelUsage is the tokens and cost of the calls to one model
+type ModelUsage struct {
+	Provider         string  `json:"provider"`
+	Model            string  `json:"model"`
+	Calls            int     `json:"calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Cost             float64 `json:"cost"` // USD, as billed by the provider or from the price table
+	// Unpriced counts the calls whose cost is unknown: the provider reported
+	// none and the model is missing from the price table
+	Unpriced int `json:"unpriced,omitempty"`
+}
+
+// Tokens returns the prompt and completion tokens
+func (mu ModelUsage) Tokens() int64 {
+	return mu.PromptTokens + mu.CompletionTokens
+}
+
+// TokenUsage records the tokens and cost of every API call of a run and
+// enforces an optional budget. Calls in flight when the budget is used up
+// are completed, so a run can exceed it by one call per worker. It is safe
+// for concurrent use.
+type TokenUsage struct {
+	Prices    PriceTable
+	MaxTokens int64   // Budget of prompt and completion tokens (0 for none)
+	MaxCost   float64 // Budget in USD (0 for none)
+
+	mu     sync.Mutex
+	models map[[2]string]*ModelUsage
+}
+
+// NewTokenUsage creates a tracker that prices calls from prices
+func NewTokenUsage(prices PriceTable) *TokenUsage {
+	return &TokenUsage{Prices: prices}
+}
+
+// record adds one call. Without a cost from the provider, it is estimated
+// from the price table.
+func (tu *TokenUsage) record(api APIType, model string, usage callUsage) {
+	if tu == nil {
+		return
+	}
+	tu.mu.Lock()
+	defer tu.mu.Unlock()
+	if tu.models == nil {
+		tu.models = make(map[[2]string]*ModelUsage)
+	}
+	key := [2]string{string(api), model}
+	mu, ok := tu.models[key]
+	if !ok {
+		mu = &ModelUsage{Provider: string(api), Model: model}
+		tu.models[key] = mu
+	}
+	mu.Calls++
+	mu.PromptTokens += int64(usage.Prompt)
+	mu.CompletionTokens += int64(usage.Completion)
+	switch price, priced := tu.Prices.Lookup(model); {
+	case usage.Billed:
+		mu.Cost += usage.Cost
+	case api == APITypeOllama || priced:
+		mu.Cost += (float64(usage.Prompt)*price.Input + float64(usage.Completion)*price.Output) / 1e6
+	default:
+		mu.Unpriced++
+	}
+}
+
+// check returns ErrBudgetExceeded once the token or cost budget is used up
+func (tu *TokenUsage) check() error {
+	if tu == nil || (tu.MaxTokens <= 0 && tu.MaxCost <= 0) {
+		return nil
+	}
+	total := tu.Total()
+	if tu.MaxTokens > 0 && total.Tokens() >= tu.MaxTokens {
+		return fmt.Errorf("token %w: %d of %d tokens used, not sent to the API", ErrBudgetExceeded, total.Tokens(), tu.MaxTokens)
+	}
+	if tu.MaxCost > 0 && total.Cost >= tu.MaxCost {
+		return fmt.Errorf("cost %w: $%.4f of $%.4f spent, not sent to the API", ErrBudgetExceeded, total.Cost, tu.MaxCost)
+	}
+	return nil
+}
+
+// Models returns the usage of every model, sorted by provider and model
+func (tu *TokenUsage) Models() []ModelUsage {
+	tu.mu.Lock()
+	defer tu.mu.Unlock()
+	models := make([]ModelUsage, 0, len(tu.models))
+	for _, mu := range tu.models {
+		models = append(models, *mu)
+	}
+	slices.SortFunc(models, func(a, b ModelUsage) int {
+		return strings.Compare(a.Provider+"/"+a.Model, b.Provider+"/"+b.Model)
+	})
+	return models
+}
+
+// Total returns the usage of every model added up
+func (tu *TokenUsage) Total() ModelUsage {
+	return TotalUsage(tu.Models())
+}
+
+// TotalUsage adds up the usage of models
+func TotalUsage(models []ModelUsage) ModelUsage {
+	var total ModelUsage
+	for _, mu := range models {
+		total.Calls += mu.Calls
+		total.PromptTokens += mu.PromptTokens
+		total.CompletionTokens += mu.CompletionTokens
+		total.Cost += mu.Cost
+		total.Unpriced += mu.Unpriced
+	}
+	return total
+}
+
+// WriteUsageSummary prints the tokens and cost of every model and their total
+func WriteUsageSummary(w io.Writer, models []ModelUsage) {
+	fmt.Fprintln(w, "\nToken usage:")
+	if len(models) == 0 {
+		fmt.Fprintln(w, "  No API calls")
+		return
+	}
+	line := func(name string, mu ModelUsage) {
+		cost := fmt.Sprintf("$%.4f", mu.Cost)
+		if mu.Unpriced > 0 {
+			cost += "?"
+		}
+		fmt.Fprintf(w, "  %-40s %4d calls %9d prompt %9d completion %10s\n", name, mu.Calls, mu.PromptTokens, mu.CompletionTokens, cost)
+	}
+	for _, mu := range models {
+		line(mu.Provider+"/"+mu.Model, mu)
+	}
+	total := TotalUsage(models)
+	line("total", total)
+	if total.Unpriced > 0 {
+		fmt.Fprintln(w, "  ? cost leaves out calls to models missing from the price table")
+	}
+}
+
+// SetUsage records the tokens and cost of every API call of the strategy and
+// its fallback in usage, and stops sending functions once its budget is used
+// up. Later functions are kept unchanged and reported as skipped.
+func (r *Rewriter) SetUsage(usage *TokenUsage) error {
+	s, ok := r.Strategy.(baseStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support token accounting", r.Strategy)
+	}
+	bs := s.base()
+	bs.Usage = usage
+	if bs.Fallback != nil {
+		bs.Fallback.Usage = usage
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package rewriter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// Verifier checks a rewritten function against the original before its body
+// replaces the original body. An error rejects the rewrite; with repairs
+// enabled it is shown to the LLM.
+type Verifier interface {
+	Verify(original, rewritten *ast.FuncDecl) error
+}
+
+// VerifierFunc adapts a function to the Verifier interface
+type VerifierFunc func(original, rewritten *ast.FuncDecl) error
+
+// Verify calls f
+func (f VerifierFunc) Verify(original, rewritten *ast.FuncDecl) error {
+	return f(original, rewritten)
+}
+
+// Verifiers chains verifiers; the first error rejects the rewrite
+type Verifiers []Verifier
+
+// Verify runs every verifier in order and returns the first error
+func (vs Verifiers) Verify(original, rewritten *ast.FuncDecl) error {
+	for _, v := range vs {
+		if err := v.Verify(original, rewritten); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SignatureVerifier rejects rewrites that change the name, receiver, type
+// parameters, parameters or results of a function. Only the body of a
+// rewrite is used, so a changed signature would otherwise be dropped
+// silently, and with it any parameter the new body refers to. Names count,
+// since the body refers to them, but grouping does not: (a, b int) is the
+// same as (a int, b int).
+type SignatureVerifier struct{}
+
+// Verify compares the signatures of original and rewritten
+func (SignatureVerifier) Verify(original, rewritten *ast.FuncDecl) error {
+	if original.Name.Name != rewritten.Name.Name {
+		return fmt.Errorf("function name changed from %s to %s", original.Name.Name, rewritten.Name.Name)
+	}
+	parts := []struct {
+		what       string
+		orig, rewr *ast.FieldList
+	}{
+		{"receiver", original.Recv, rewritten.Recv},
+		{"type parameters", original.Type.TypeParams, rewritten.Type.TypeParams},
+		{"parameters", original.Type.Params, rewritten.Type.Params},
+		{"results", original.Type.Results, rewritten.Type.Results},
+	}
+	for _, p := range parts {
+		if orig, rewr := fieldListString(p.orig), fieldListString(p.rewr); orig != rewr {
+			return fmt.Errorf("%s of %s changed from %s to %s", p.what, original.Name.Name, orig, rewr)
+		}
+	}
+	return nil
+}
+
+// fieldListString returns a field list with one name per field, e.g.
+// "(a int, b int)"; an empty or missing list is "()"
+func fieldListString(fl *ast.FieldList) string {
+	var fields []string
+	if fl != nil {
+		for _, f := range fl.List {
+			typ := types.ExprString(f.Type)
+			if len(f.Names) == 0 {
+				fields = append(fields, typ)
+			}
+			for _, name := range f.Names {
+				fields = append(fields, name.Name+" "+typ)
+			}
+		}
+	}
+	return "(" + strings.Join(fields, ", ") + ")"
+}
+
+// verify runs SignatureVerifier and then the strategy's own verifiers
+func (bs *BaseStrategy) verify(original, rewritten *ast.FuncDecl) error {
+	return append(Verifiers{SignatureVerifier{}}, bs.Verifiers...).Verify(original, rewritten)
+}
+
+// AddVerifier makes the strategy reject rewritten functions that v rejects,
+// after the signature check and any verifier added before
+func (r *Rewriter) AddVerifier(v Verifier) error {
+	s, ok := r.Strategy.(baseStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support verifiers", r.Strategy)
+	}
+	if v == nil {
+		return fmt.Errorf("verifier must not be nil")
+	}
+	s.base().Verifiers = append(s.base().Verifiers, v)
+	return nil
+}
@@ -0,0 +1,206 @@
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/Hekzory/MetamorphLLM/internal/redact"
+)
+
+// Mode selects how programs built from rewritten code are isolated
+type Mode string
+
+const (
+	// ModeAuto uses bwrap if installed, otherwise unshare; it fails if neither works
+	ModeAuto Mode = "auto"
+	// ModeBwrap runs the program under bubblewrap
+	ModeBwrap Mode = "bwrap"
+	// ModeUnshare runs the program in user, mount, PID and network namespaces
+	// created with util-linux unshare
+	ModeUnshare Mode = "unshare"
+	// ModeNone runs the program directly on the host; it must be chosen explicitly
+	ModeNone Mode = "none"
+)
+
+// Config describes the sandbox. By default programs get no network and a
+// read-only view of the filesystem, except for a private scratch directory
+// that is also their TMPDIR and HOME.
+type Config struct {
+	Mode    Mode
+	Network bool // Allow network access
+}
+
+// Sandbox is a resolved configuration with its own scratch directory.
+// Call Close to remove the scratch directory.
+type Sandbox struct {
+	Mode    Mode
+	Network bool
+	Scratch string
+}
+
+// New resolves the configured mode and creates a scratch directory
+func New(cfg Config) (*Sandbox, error) {
+	mode, err := Resolve(cfg.Mode)
+	if err != nil {
+		return nil, err
+	}
+	scratch, err := os.MkdirTemp("", "metamorph-sandbox-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sandbox scratch directory: %w", err)
+	}
+	// The path is only quoted into sandbox command lines; without a sandbox it
+	// is used as is, e.g. a Windows temp directory with backslashes
+	if mode != ModeNone && strings.ContainsAny(scratch, "'\"\\ ") {
+		os.RemoveAll(scratch)
+		return nil, fmt.Errorf("sandbox scratch directory %q contains characters that cannot be quoted; set TMPDIR", scratch)
+	}
+	return &Sandbox{Mode: mode, Network: cfg.Network, Scratch: scratch}, nil
+}
+
+// Close removes the scratch directory
+func (s *Sandbox) Close() error {
+	return os.RemoveAll(s.Scratch)
+}
+
+// Resolve maps ModeAuto to an available mode and checks that the chosen mode works
+func Resolve(mode Mode) (Mode, error) {
+	switch mode {
+	case ModeNone:
+		return ModeNone, nil
+	case ModeBwrap:
+		if _, err := exec.LookPath("bwrap"); err != nil {
+			return "", fmt.Errorf("sandbox mode bwrap: %w", err)
+		}
+		return ModeBwrap, nil
+	case ModeUnshare:
+		if err := probeUnshare(); err != nil {
+			return "", fmt.Errorf("sandbox mode unshare: %w", err)
+		}
+		return ModeUnshare, nil
+	case ModeAuto, "":
+		if runtime.GOOS == "windows" {
+			return "", fmt.Errorf("no sandbox is available on Windows; explicitly accept running rewritten code on the host with sandbox mode none")
+		}
+		if _, err := exec.LookPath("bwrap"); err == nil {
+			return ModeBwrap, nil
+		}
+		if err := probeUnshare(); err == nil {
+			return ModeUnshare, nil
+		}
+		return "", fmt.Errorf("no sandbox available: install bubblewrap or enable unprivileged user namespaces, " +
+			"or explicitly accept running rewritten code on the host with sandbox mode none")
+	default:
+		return "", fmt.Errorf("unknown sandbox mode %q (auto, bwrap, unshare or none)", mode)
+	}
+}
+
+var (
+	unshareOnce sync.Once
+	unshareErr  error
+)
+
+// probeUnshare checks once whether unprivileged namespaces can be created
+func probeUnshare() error {
+	unshareOnce.Do(func() {
+		out, err := exec.Command("unshare", "--user", "--map-root-user", "--mount", "--net", "true").CombinedOutput()
+		if err != nil {
+			unshareErr = fmt.Errorf("unprivileged user namespaces unavailable: %v %s", err, strings.TrimSpace(string(out)))
+		}
+	})
+	return unshareErr
+}
+
+// Prefix returns the command line placed in front of a program to run it in the sandbox
+func (s *Sandbox) Prefix() []string {
+	switch s.Mode {
+	case ModeBwrap:
+		args := []string{"bwrap",
+			"--ro-bind", "/", "/",
+			"--dev", "/dev",
+			"--proc", "/proc",
+			"--tmpfs", "/dev/shm",
+			"--bind", s.Scratch, s.Scratch,
+			"--setenv", "TMPDIR", s.Scratch,
+			"--setenv", "HOME", s.Scratch,
+			"--unshare-all",
+			"--die-with-parent",
+			"--new-session",
+		}
+		if s.Network {
+			args = append(args, "--share-net")
+		}
+		return args
+	case ModeUnshare:
+		args := []string{"unshare", "--user", "--map-root-user", "--mount", "--pid", "--fork", "--kill-child", "--mount-proc"}
+		if !s.Network {
+			args = append(args, "--net")
+		}
+		return append(args, "sh", "-c", s.unshareScript(), "metamorph-sandbox")
+	default:
+		return nil
+	}
+}
+
+// unshareScript runs inside the new namespaces: it keeps the scratch directory
+// writable, makes every other mount read-only and then executes the program
+func (s *Sandbox) unshareScript() string {
+	return strings.Join([]string{
+		"set -e",
+		"mount --bind " + s.Scratch + " " + s.Scratch,
+		// No single quotes anywhere: the script must survive go test -exec quoting
+		"while read -r _ _ _ _ m _; do " +
+			"case $m in /proc|/proc/*|/sys|/sys/*|/dev|/dev/*|" + s.Scratch + ") ;; " +
+			"*) mount -o remount,bind,ro $m 2>/dev/null || true ;; esac; done < /proc/self/mountinfo",
+		"mount -o remount,bind,ro /",
+		"if [ -d /dev/shm ]; then mount -t tmpfs tmpfs /dev/shm; fi",
+		"export TMPDIR=" + s.Scratch + " HOME=" + s.Scratch,
+		`exec "$@"`,
+	}, "; ")
+}
+
+// Command prepares name with args to run inside the sandbox, without credentials
+// in its environment
+func (s *Sandbox) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	argv := append(s.Prefix(), name)
+	argv = append(argv, args...)
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = ScrubEnv(os.Environ())
+	return cmd
+}
+
+// ExecFlag returns the value for go test -exec that runs test binaries in the
+// sandbox, or "" in ModeNone
+func (s *Sandbox) ExecFlag() string {
+	prefix := s.Prefix()
+	quoted := make([]string, len(prefix))
+	for i, arg := range prefix {
+		// go splits -exec on spaces and honours single and double quotes
+		switch {
+		case !strings.ContainsAny(arg, " '\"\t"):
+			quoted[i] = arg
+		case !strings.Contains(arg, "'"):
+			quoted[i] = "'" + arg + "'"
+		default:
+			quoted[i] = `"` + arg + `"`
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// ScrubEnv returns env without variables that look like credentials, such as
+// the provider API keys, so rewritten code never sees them
+func ScrubEnv(env []string) []string {
+	scrubbed := make([]string, 0, len(env))
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if !redact.IsSensitiveName(name) {
+			scrubbed = append(scrubbed, kv)
+		}
+	}
+	return scrubbed
+}
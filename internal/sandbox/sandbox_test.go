@@ -0,0 +1,55 @@
+package sandbox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSandbox tests that sandboxed programs can only write to their scratch directory
+func TestSandbox(t *testing.T) {
+	sb, err := New(Config{Mode: ModeAuto})
+	if err != nil {
+		t.Skipf("No sandbox available: %v", err)
+	}
+	defer sb.Close()
+
+	hostDir := t.TempDir()
+	script := `touch "$TMPDIR/ok" && echo scratch-writable; ` +
+		`touch "$1/escaped" 2>/dev/null && echo host-writable; ` +
+		`tail -n +3 /proc/net/dev | grep -qv "lo:" && echo network-up; true`
+	out, err := sb.Command(context.Background(), "sh", "-c", script, "sh", hostDir).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Sandboxed command failed: %v\n%s", err, out)
+	}
+
+	if !strings.Contains(string(out), "scratch-writable") {
+		t.Errorf("Expected the scratch directory to be writable, got:\n%s", out)
+	}
+	if strings.Contains(string(out), "host-writable") {
+		t.Errorf("Expected host directories to be read-only, got:\n%s", out)
+	}
+	if _, err := os.Stat(filepath.Join(hostDir, "escaped")); err == nil {
+		t.Error("Sandboxed program created a file on the host")
+	}
+	if strings.Contains(string(out), "network-up") {
+		t.Errorf("Expected no network interfaces besides loopback, got:\n%s", out)
+	}
+}
+
+// TestResolve tests mode selection
+func TestResolve(t *testing.T) {
+	if mode, err := Resolve(ModeNone); err != nil || mode != ModeNone {
+		t.Errorf("Expected none to resolve to itself, got %q, %v", mode, err)
+	}
+	if _, err := Resolve("docker"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+
+	sb := &Sandbox{Mode: ModeNone}
+	if flag := sb.ExecFlag(); flag != "" {
+		t.Errorf("Expected no -exec wrapper without a sandbox, got %q", flag)
+	}
+}
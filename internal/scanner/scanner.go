@@ -0,0 +1,92 @@
+// Package scanner runs static scanners such as ClamAV and YARA over binaries
+// and compares what they detect in the binary compiled from the original with
+// what they detect in the one compiled from the rewrite. Scanners are local:
+// files only go to the configured clamd and the yara command, with the user's
+// own signatures and rules.
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Scanner reports which signatures or rules match a file
+type Scanner interface {
+	Name() string
+	// Scan returns the names of the signatures or rules that match the file
+	// at path, or none if it is clean
+	Scan(ctx context.Context, path string) ([]string, error)
+}
+
+// Parse returns the scanner described by spec:
+//   - clamd=unix:/run/clamav/clamd.ctl or clamd=tcp:localhost:3310 streams
+//     files to a clamd daemon
+//   - yara=rules.yar matches files against a YARA rule file with the yara command
+func Parse(spec string) (Scanner, error) {
+	kind, arg, _ := strings.Cut(spec, "=")
+	arg = strings.TrimSpace(arg)
+	if arg == "" {
+		return nil, fmt.Errorf("invalid scanner %q (expected clamd=unix:<socket>, clamd=tcp:<host:port> or yara=<rules>)", spec)
+	}
+	switch strings.TrimSpace(kind) {
+	case "clamd":
+		network, address, _ := strings.Cut(arg, ":")
+		if (network != "unix" && network != "tcp") || address == "" {
+			return nil, fmt.Errorf("invalid clamd address %q (expected unix:<socket> or tcp:<host:port>)", arg)
+		}
+		return &Clamd{Network: network, Address: address}, nil
+	case "yara":
+		return &Yara{Rules: arg}, nil
+	default:
+		return nil, fmt.Errorf("unknown scanner %q (expected clamd or yara)", kind)
+	}
+}
+
+// Delta compares the detections of one scanner in the binary compiled from
+// the original and in the one compiled from the rewrite
+type Delta struct {
+	Scanner   string   `json:"scanner"`
+	Original  []string `json:"original"`
+	Rewritten []string `json:"rewritten"`
+	Lost      []string `json:"lost,omitempty"`   // Detections of the original the rewrite no longer has
+	Gained    []string `json:"gained,omitempty"` // Detections only the rewrite has
+}
+
+// Compare returns the delta between the detections of the original and the rewrite
+func Compare(scanner string, original, rewritten []string) Delta {
+	d := Delta{Scanner: scanner, Original: sorted(original), Rewritten: sorted(rewritten)}
+	for _, name := range d.Original {
+		if !slices.Contains(d.Rewritten, name) {
+			d.Lost = append(d.Lost, name)
+		}
+	}
+	for _, name := range d.Rewritten {
+		if !slices.Contains(d.Original, name) {
+			d.Gained = append(d.Gained, name)
+		}
+	}
+	return d
+}
+
+// ScanBoth scans the original and the rewritten binary with s
+func ScanBoth(ctx context.Context, s Scanner, original, rewritten string) (Delta, error) {
+	before, err := s.Scan(ctx, original)
+	if err != nil {
+		return Delta{}, fmt.Errorf("failed to scan %s with %s: %w", original, s.Name(), err)
+	}
+	after, err := s.Scan(ctx, rewritten)
+	if err != nil {
+		return Delta{}, fmt.Errorf("failed to scan %s with %s: %w", rewritten, s.Name(), err)
+	}
+	return Compare(s.Name(), before, after), nil
+}
+
+// sorted returns the names sorted and without duplicates, and never nil so
+// that clean files encode as an empty list
+func sorted(names []string) []string {
+	names = slices.Clone(names)
+	slices.Sort(names)
+	return append([]string{}, slices.Compact(names)...)
+}
@@ -0,0 +1,168 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestParse tests parsing scanner specs
+func TestParse(t *testing.T) {
+	s, err := Parse("clamd=unix:/run/clamav/clamd.ctl")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if c, ok := s.(*Clamd); !ok || c.Network != "unix" || c.Address != "/run/clamav/clamd.ctl" {
+		t.Errorf("Expected a clamd unix socket scanner, got %+v", s)
+	}
+	s, err = Parse("clamd=tcp:localhost:3310")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if c, ok := s.(*Clamd); !ok || c.Network != "tcp" || c.Address != "localhost:3310" {
+		t.Errorf("Expected a clamd tcp scanner, got %+v", s)
+	}
+	s, err = Parse("yara=rules/app.yar")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if y, ok := s.(*Yara); !ok || y.Rules != "rules/app.yar" {
+		t.Errorf("Expected a yara scanner, got %+v", s)
+	}
+	for _, spec := range []string{"clamd", "clamd=udp:localhost:3310", "yara=", "virustotal=key"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Expected %q to be refused", spec)
+		}
+	}
+}
+
+// TestCompare tests the detections lost and gained by a rewrite
+func TestCompare(t *testing.T) {
+	d := Compare("yara", []string{"B", "A", "A"}, []string{"C", "A"})
+	if !slices.Equal(d.Original, []string{"A", "B"}) || !slices.Equal(d.Rewritten, []string{"A", "C"}) {
+		t.Errorf("Expected sorted detections without duplicates, got %+v", d)
+	}
+	if !slices.Equal(d.Lost, []string{"B"}) || !slices.Equal(d.Gained, []string{"C"}) {
+		t.Errorf("Expected B to be lost and C gained, got %+v", d)
+	}
+	if clean := Compare("clamd", nil, nil); clean.Original == nil || clean.Lost != nil {
+		t.Errorf("Expected clean files to have empty detections, got %+v", clean)
+	}
+}
+
+// TestClamd tests streaming files to a fake clamd
+func TestClamd(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveClamd(conn)
+		}
+	}()
+
+	dir := t.TempDir()
+	clean := filepath.Join(dir, "clean")
+	infected := filepath.Join(dir, "infected")
+	broken := filepath.Join(dir, "broken")
+	// Larger than a chunk, so it is streamed in several
+	content := strings.Repeat("harmless ", clamdChunkSize/4)
+	files := map[string]string{clean: content, infected: content + "SIGNATURE", broken: "BROKEN"}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	c := &Clamd{Network: "tcp", Address: l.Addr().String()}
+	d, err := ScanBoth(context.Background(), c, infected, clean)
+	if err != nil {
+		t.Fatalf("ScanBoth failed: %v", err)
+	}
+	if !slices.Equal(d.Original, []string{"Test.Signature"}) || len(d.Rewritten) != 0 || !slices.Equal(d.Lost, []string{"Test.Signature"}) {
+		t.Errorf("Expected the signature to be lost in the rewrite, got %+v", d)
+	}
+	if _, err := c.Scan(context.Background(), broken); err == nil || !strings.Contains(err.Error(), "size limit exceeded") {
+		t.Errorf("Expected the clamd error to be returned, got %v", err)
+	}
+}
+
+// serveClamd answers one INSTREAM command like clamd: files containing
+// SIGNATURE are infected and files containing BROKEN fail
+func serveClamd(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	if command, err := r.ReadString(0); err != nil || command != "zINSTREAM\x00" {
+		return
+	}
+	var data []byte
+	for {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if size == 0 {
+			break
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return
+		}
+		data = append(data, chunk...)
+	}
+	switch {
+	case strings.Contains(string(data), "SIGNATURE"):
+		io.WriteString(conn, "stream: Test.Signature FOUND\x00")
+	case strings.Contains(string(data), "BROKEN"):
+		io.WriteString(conn, "INSTREAM size limit exceeded. ERROR\x00")
+	default:
+		io.WriteString(conn, "stream: OK\x00")
+	}
+}
+
+// TestYara tests running a yara command and reading its matches
+func TestYara(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake yara is a shell script")
+	}
+	dir := t.TempDir()
+	rules := filepath.Join(dir, "rules.yar")
+	if err := os.WriteFile(rules, []byte("rule Suspicious { condition: true }\n"), 0644); err != nil {
+		t.Fatalf("Failed to write rules: %v", err)
+	}
+	// Prints the rules a file matches like yara: one "<rule> <path>" per line
+	yara := filepath.Join(dir, "yara")
+	script := "#!/bin/sh\nfor last; do :; done\nif grep -q SIGNATURE \"$last\"; then\n  echo \"Suspicious $last\"\n  echo \"Packed $last\"\nfi\n"
+	if err := os.WriteFile(yara, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake yara: %v", err)
+	}
+	original := filepath.Join(dir, "original")
+	rewritten := filepath.Join(dir, "rewritten")
+	os.WriteFile(original, []byte("SIGNATURE"), 0644)
+	os.WriteFile(rewritten, []byte("changed"), 0644)
+
+	d, err := ScanBoth(context.Background(), &Yara{Rules: rules, Command: yara}, original, rewritten)
+	if err != nil {
+		t.Fatalf("ScanBoth failed: %v", err)
+	}
+	if !slices.Equal(d.Lost, []string{"Packed", "Suspicious"}) || len(d.Rewritten) != 0 {
+		t.Errorf("Expected both rules to be lost in the rewrite, got %+v", d)
+	}
+	if _, err := (&Yara{Rules: filepath.Join(dir, "missing.yar"), Command: yara}).Scan(context.Background(), original); err == nil {
+		t.Error("Expected a missing rule file to be refused")
+	}
+}
@@ -0,0 +1,65 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Yara matches files against a YARA rule file with the yara command line tool
+type Yara struct {
+	Rules   string // Rule file, source or compiled with yarac
+	Command string // yara executable (defaults to "yara")
+}
+
+func (y *Yara) Name() string {
+	return "yara"
+}
+
+func (y *Yara) Scan(ctx context.Context, path string) ([]string, error) {
+	args := []string{"--no-warnings"}
+	if compiled, err := isCompiledYara(y.Rules); err != nil {
+		return nil, err
+	} else if compiled {
+		args = append(args, "--compiled-rules")
+	}
+	cmd := exec.CommandContext(ctx, cmp.Or(y.Command, "yara"), append(args, y.Rules, path)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("yara failed: %v\n%s", err, stderr.String())
+	}
+
+	// Every match is printed as "<rule> <path>"
+	var rules []string
+	lines := bufio.NewScanner(&stdout)
+	for lines.Scan() {
+		if rule, _, ok := strings.Cut(strings.TrimSpace(lines.Text()), " "); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// isCompiledYara reports whether the rule file was compiled with yarac, whose
+// output starts with "YARA"
+func isCompiledYara(rules string) (bool, error) {
+	f, err := os.Open(rules)
+	if err != nil {
+		return false, fmt.Errorf("failed to open YARA rules: %w", err)
+	}
+	defer f.Close()
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		// Shorter than the magic, so a (tiny) source file
+		return false, nil
+	}
+	return string(magic) == "YARA", nil
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+// eventLog keeps the progress events of a job's run, so that every client
+// streaming them gets all of them however late it connects
+type eventLog struct {
+	mu      sync.Mutex
+	events  []rewriter.Event
+	changed chan struct{} // Closed, and replaced, when an event is added or the run ends
+	closed  bool
+}
+
+func newEventLog() *eventLog {
+	return &eventLog{changed: make(chan struct{})}
+}
+
+// Observe implements rewriter.Observer
+func (l *eventLog) Observe(e rewriter.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	l.events = append(l.events, e)
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// close marks the end of the run
+func (l *eventLog) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closed {
+		l.closed = true
+		close(l.changed)
+	}
+}
+
+// since returns the events from the n-th on, whether the run has ended, and
+// a channel closed once there is more to read
+func (l *eventLog) since(n int) ([]rewriter.Event, bool, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.events[n:], l.closed, l.changed
+}
+
+// handleEvents streams the progress of a job as server-sent events: one per
+// function event of its current run, named after the event's type, then a
+// "job" event with the finished job, without its result. A job that finished
+// before the server started has only the job event.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	job, ok := s.jobs[r.PathValue("id")]
+	ok = ok && s.visible(r.Context(), job)
+	var log *eventLog
+	if ok {
+		log = job.events
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("job %s not found", r.PathValue("id")))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for n := 0; log != nil; {
+		events, closed, changed := log.since(n)
+		for _, e := range events {
+			if err := writeEvent(w, e.Type, e); err != nil {
+				return
+			}
+		}
+		n += len(events)
+		flusher.Flush()
+		if closed {
+			break
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	s.mu.Lock()
+	summary := job.Job
+	s.mu.Unlock()
+	summary.Result = nil
+	if err := writeEvent(w, "job", summary); err == nil {
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes one server-sent event with v as JSON data
+func writeEvent(w http.ResponseWriter, name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return err
+}
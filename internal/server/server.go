@@ -0,0 +1,559 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/eval"
+	"github.com/Hekzory/MetamorphLLM/internal/metrics"
+	"github.com/Hekzory/MetamorphLLM/internal/redact"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+// Defaults for a new Server
+const (
+	DefaultAsyncThreshold = 64 << 10 // Sources above this size are always rewritten as jobs
+	DefaultMaxSourceBytes = 4 << 20
+	DefaultJobTTL         = time.Hour
+	DefaultJobDir         = ".metamorph/jobs"
+	DefaultJobListLimit   = 100
+)
+
+// RewriteRequest is the body of POST /v1/rewrite
+type RewriteRequest struct {
+	Source   string `json:"source"`
+	Strategy string `json:"strategy,omitempty"` // Defaults to the server's strategy
+	Model    string `json:"model,omitempty"`    // Empty selects the strategy's default model
+	Async    bool   `json:"async,omitempty"`    // Return a job instead of waiting for the rewrite
+}
+
+// FileMetrics are the code metrics of one version of the source
+type FileMetrics struct {
+	LOC       int `json:"loc"`
+	CC        int `json:"cc"`
+	CogC      int `json:"cogc"`
+	Functions int `json:"functions"`
+}
+
+// MetricsReport compares the original and rewritten source
+type MetricsReport struct {
+	Original  FileMetrics `json:"original"`
+	Rewritten FileMetrics `json:"rewritten"`
+	LOCDelta  float64     `json:"loc_delta_percent"`
+	CCDelta   float64     `json:"cc_delta_percent"`
+	CogCDelta float64     `json:"cogc_delta_percent"`
+}
+
+// RewriteResult is the response of a completed rewrite
+type RewriteResult struct {
+	Rewritten string         `json:"rewritten"`
+	Changed   bool           `json:"changed"`
+	Metrics   *MetricsReport `json:"metrics,omitempty"` // Omitted if the rewritten source does not parse
+}
+
+// Health is the response of GET /health
+type Health struct {
+	Status   string `json:"status"`   // Always "ok" while the server answers
+	Running  int    `json:"running"`  // Rewrites running now
+	Pending  int    `json:"pending"`  // Jobs waiting for a free slot
+	Capacity int    `json:"capacity"` // Rewrites that can run at once
+}
+
+// JobStatus is the state of an asynchronous rewrite
+type JobStatus string
+
+const (
+	JobPending JobStatus = "pending"
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed"
+)
+
+// Job is an asynchronous rewrite, polled at GET /v1/jobs/{id}
+type Job struct {
+	ID       string         `json:"id"`
+	Status   JobStatus      `json:"status"`
+	Strategy string         `json:"strategy"`
+	Model    string         `json:"model,omitempty"`
+	Tenant   string         `json:"tenant,omitempty"`
+	Attempts int            `json:"attempts"` // Number of times the job started running
+	Created  time.Time      `json:"created"`
+	Started  time.Time      `json:"started,omitzero"`
+	Finished time.Time      `json:"finished,omitzero"`
+	Result   *RewriteResult `json:"result,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// JobList is the response of GET /v1/jobs, newest first and without results
+type JobList struct {
+	Jobs []Job `json:"jobs"`
+}
+
+// Server exposes the rewriter over HTTP
+type Server struct {
+	NewRewriter     eval.RewriterFactory
+	DefaultStrategy string
+	AsyncThreshold  int   // Sources larger than this many bytes are always rewritten as jobs
+	MaxSourceBytes  int64 // Larger request bodies are rejected
+	JobTTL          time.Duration
+	Store           *JobStore // Persists jobs across restarts (nil keeps them in memory only)
+	Tenants         []*Tenant // Clients allowed to use the server (nil requires no API key)
+
+	sem  chan struct{} // Limits concurrent rewrites, synchronous or not
+	mu   sync.Mutex
+	jobs map[string]*storedJob
+}
+
+// New creates a server that runs at most concurrency rewrites at a time
+func New(defaultStrategy string, concurrency int) *Server {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Server{
+		NewRewriter:     eval.DefaultRewriterFactory,
+		DefaultStrategy: defaultStrategy,
+		AsyncThreshold:  DefaultAsyncThreshold,
+		MaxSourceBytes:  DefaultMaxSourceBytes,
+		JobTTL:          DefaultJobTTL,
+		sem:             make(chan struct{}, concurrency),
+		jobs:            make(map[string]*storedJob),
+	}
+}
+
+// Handler returns the HTTP routes of the service. GET /health needs no API
+// key, so load balancers and CI systems can probe it.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/rewrite", s.handleRewrite)
+	mux.HandleFunc("GET /v1/jobs", s.handleJobs)
+	mux.HandleFunc("GET /v1/jobs/{id}", s.handleJob)
+	mux.HandleFunc("GET /v1/jobs/{id}/events", s.handleEvents)
+	mux.HandleFunc("POST /v1/jobs/{id}/retry", s.handleRetry)
+	mux.HandleFunc("GET /v1/usage", s.handleUsage)
+	if len(s.Tenants) == 0 {
+		mux.HandleFunc("GET /health", s.handleHealth)
+		return mux
+	}
+	public := http.NewServeMux()
+	public.HandleFunc("GET /health", s.handleHealth)
+	public.Handle("/", s.authenticate(mux))
+	return public
+}
+
+// handleHealth reports that the server is up and how busy it is
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	h := Health{Status: "ok", Running: len(s.sem), Capacity: cap(s.sem)}
+	s.mu.Lock()
+	for _, job := range s.jobs {
+		if job.Status == JobPending {
+			h.Pending++
+		}
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, h)
+}
+
+// authenticate requires the API key of a tenant, as "Authorization: Bearer <key>"
+// or "X-API-Key: <key>", and passes the tenant on in the request context
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := BearerToken(r.Header.Get("Authorization"))
+		if key == "" {
+			key = r.Header.Get("X-API-Key")
+		}
+		t, err := s.Authenticate(key)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metamorph"`)
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), t)))
+	})
+}
+
+// handleRewrite rewrites small sources inline and queues large or async ones as jobs
+func (s *Server) handleRewrite(w http.ResponseWriter, r *http.Request) {
+	var req RewriteRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.MaxSourceBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("request body exceeds %d bytes", s.MaxSourceBytes))
+			return
+		}
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	if err := s.Admit(r.Context()); err != nil {
+		writeQuotaError(w, err)
+		return
+	}
+	rw, err := s.Prepare(r.Context(), req.Source, req.Strategy, req.Model)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Async || len(req.Source) > s.AsyncThreshold {
+		job := s.submit(r.Context(), rw, req)
+		w.Header().Set("Location", "/v1/jobs/"+job.ID)
+		writeJSON(w, http.StatusAccepted, job)
+		return
+	}
+
+	result, err := s.Run(r.Context(), rw, req.Source, nil)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleJob reports the state of a job, including its result once done
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	job, ok := s.jobs[r.PathValue("id")]
+	ok = ok && s.visible(r.Context(), job)
+	var snapshot Job
+	if ok {
+		snapshot = job.Job
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("job %s not found", r.PathValue("id")))
+		return
+	}
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+// handleJobs lists the known jobs, optionally only those with ?status=, up to ?limit=
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	status := JobStatus(r.URL.Query().Get("status"))
+	if status != "" && !slices.Contains([]JobStatus{JobPending, JobRunning, JobDone, JobFailed}, status) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown job status %q", status))
+		return
+	}
+	limit := DefaultJobListLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", value))
+			return
+		}
+		limit = n
+	}
+
+	list := JobList{Jobs: []Job{}}
+	s.mu.Lock()
+	s.pruneJobs()
+	for _, job := range s.jobs {
+		if s.visible(r.Context(), job) && (status == "" || job.Status == status) {
+			summary := job.Job
+			summary.Result = nil
+			list.Jobs = append(list.Jobs, summary)
+		}
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(list.Jobs, func(a, b Job) int { return b.Created.Compare(a.Created) })
+	if len(list.Jobs) > limit {
+		list.Jobs = list.Jobs[:limit]
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handleRetry queues a failed job again
+func (s *Server) handleRetry(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	job, ok := s.jobs[r.PathValue("id")]
+	if !ok || !s.visible(r.Context(), job) {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, fmt.Errorf("job %s not found", r.PathValue("id")))
+		return
+	}
+	if job.Status != JobFailed {
+		s.mu.Unlock()
+		writeError(w, http.StatusConflict, fmt.Errorf("job %s is %s, only failed jobs can be retried", job.ID, job.Status))
+		return
+	}
+	if err := s.Admit(r.Context()); err != nil {
+		s.mu.Unlock()
+		writeQuotaError(w, err)
+		return
+	}
+	job.Status, job.Error = JobPending, ""
+	job.Started, job.Finished = time.Time{}, time.Time{}
+	job.events = newEventLog()
+	s.persist(job)
+	snapshot := job.Job
+	s.mu.Unlock()
+
+	go s.runJob(job, nil)
+	w.Header().Set("Location", "/v1/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, snapshot)
+}
+
+// handleUsage reports what the caller's tenant has used of its quotas
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	t := TenantFrom(r.Context())
+	if t == nil {
+		writeError(w, http.StatusNotFound, errors.New("the server has no tenants"))
+		return
+	}
+	writeJSON(w, http.StatusOK, t.Usage())
+}
+
+// visible reports whether the request's tenant may see job. Without tenants
+// every job is visible.
+func (s *Server) visible(ctx context.Context, job *storedJob) bool {
+	return len(s.Tenants) == 0 || job.Tenant == tenantName(ctx)
+}
+
+// submit queues a rewrite of the request's source as a job and returns a snapshot of it
+func (s *Server) submit(ctx context.Context, rw *rewriter.Rewriter, req RewriteRequest) Job {
+	strategy := req.Strategy
+	if strategy == "" {
+		strategy = s.DefaultStrategy
+	}
+	s.mu.Lock()
+	s.pruneJobs()
+	job := &storedJob{
+		Job:    Job{ID: newJobID(), Status: JobPending, Strategy: strategy, Model: req.Model, Tenant: tenantName(ctx), Created: time.Now().UTC()},
+		Source: req.Source,
+		events: newEventLog(),
+	}
+	s.jobs[job.ID] = job
+	s.persist(job)
+	snapshot := job.Job
+	s.mu.Unlock()
+
+	go s.runJob(job, rw)
+	return snapshot
+}
+
+// runJob runs a queued job. Jobs that are resumed or retried have no rewriter
+// yet and get a new one. The progress of strategies that report it is kept
+// for GET /v1/jobs/{id}/events.
+func (s *Server) runJob(job *storedJob, rw *rewriter.Rewriter) {
+	events := job.events
+	defer events.close()
+	ctx, err := s.jobContext(job)
+	if err == nil && rw == nil {
+		rw, err = s.Prepare(ctx, job.Source, job.Strategy, job.Model)
+	}
+	var result *RewriteResult
+	if err == nil {
+		// Strategies that do not report progress only have the job event
+		_ = rw.SetObserver(events)
+		result, err = s.Run(ctx, rw, job.Source, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			job.Status, job.Started = JobRunning, time.Now().UTC()
+			job.Attempts++
+			s.persist(job)
+		})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.Finished = time.Now().UTC()
+	if err != nil {
+		job.Status, job.Error = JobFailed, redact.String(err.Error())
+	} else {
+		job.Status, job.Result = JobDone, result
+	}
+	s.persist(job)
+}
+
+// jobContext returns a context carrying the tenant that submitted job
+func (s *Server) jobContext(job *storedJob) (context.Context, error) {
+	ctx := context.Background()
+	if job.Tenant == "" {
+		return ctx, nil
+	}
+	t := s.tenantByName(job.Tenant)
+	if t == nil {
+		return nil, fmt.Errorf("tenant %s is no longer configured", job.Tenant)
+	}
+	return WithTenant(ctx, t), nil
+}
+
+// persist saves a job to the store, if there is one; callers hold s.mu. A
+// failure is reported but does not fail the job, which is still served from memory.
+func (s *Server) persist(job *storedJob) {
+	if s.Store == nil {
+		return
+	}
+	if err := s.Store.Save(job); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// UseJobStore persists jobs in st and resumes the jobs a previous run left
+// pending or running. It returns the number of resumed jobs.
+func (s *Server) UseJobStore(st *JobStore) (int, error) {
+	jobs, err := st.Load()
+	if err != nil {
+		return 0, err
+	}
+	slices.SortFunc(jobs, func(a, b *storedJob) int { return a.Created.Compare(b.Created) })
+
+	s.mu.Lock()
+	s.Store = st
+	var resumed []*storedJob
+	for _, job := range jobs {
+		s.jobs[job.ID] = job
+		if job.Status == JobPending || job.Status == JobRunning {
+			// A running job was interrupted and starts over
+			job.Status, job.Started = JobPending, time.Time{}
+			job.events = newEventLog()
+			s.persist(job)
+			resumed = append(resumed, job)
+		}
+	}
+	s.pruneJobs()
+	s.mu.Unlock()
+
+	for _, job := range resumed {
+		go s.runJob(job, nil)
+	}
+	return len(resumed), nil
+}
+
+// pruneJobs forgets finished jobs older than JobTTL; callers hold s.mu
+func (s *Server) pruneJobs() {
+	for id, job := range s.jobs {
+		if !job.Finished.IsZero() && time.Since(job.Finished) > s.JobTTL {
+			delete(s.jobs, id)
+			if s.Store != nil {
+				if err := s.Store.Delete(id); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				}
+			}
+		}
+	}
+}
+
+// Prepare checks that source is a Go file and creates the rewriter for strategy
+// (the server's default if empty) and model, authenticated with the provider
+// keys of the context's tenant. Its errors are the client's fault.
+func (s *Server) Prepare(ctx context.Context, source, strategy, model string) (*rewriter.Rewriter, error) {
+	if strategy == "" {
+		strategy = s.DefaultStrategy
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "source.go", source, parser.SkipObjectResolution); err != nil {
+		return nil, fmt.Errorf("source is not a valid Go file: %w", err)
+	}
+	rw, err := s.NewRewriter(strategy, model)
+	if err != nil {
+		return nil, err
+	}
+	if t := TenantFrom(ctx); t != nil {
+		if err := rw.SetAPIKeys(t.keys); err != nil {
+			rw.Close()
+			return nil, fmt.Errorf("tenant %s cannot use strategy %s: %w", t.Name, strategy, err)
+		}
+	}
+	return rw, nil
+}
+
+// Run rewrites source once a slot is free, calling started (if not nil) when
+// it begins. The rewriter is closed afterwards. The tokens it uses count
+// against the daily quota of the context's tenant. Canceling ctx stops the
+// wait for a slot and the rewrite.
+func (s *Server) Run(ctx context.Context, rw *rewriter.Rewriter, source string, started func()) (*RewriteResult, error) {
+	defer rw.Close()
+	if t := TenantFrom(ctx); t != nil {
+		report := &rewriter.RewriteReport{}
+		// Offline strategies use no tokens and do not report
+		if rw.SetReport(report) == nil {
+			defer func() { t.addTokens(report.Tokens()) }()
+		}
+	}
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("rewrite not started: %w", context.Cause(ctx))
+	}
+	defer func() { <-s.sem }()
+	if started != nil {
+		started()
+	}
+
+	rewritten, err := rw.RewriteContent(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("rewrite failed: %w", err)
+	}
+	return &RewriteResult{
+		Rewritten: rewritten,
+		Changed:   rewritten != source,
+		Metrics:   compareMetrics(source, rewritten),
+	}, nil
+}
+
+// compareMetrics computes the metrics of both versions, or nil if either does not parse
+func compareMetrics(original, rewritten string) *MetricsReport {
+	before, err := metrics.CalculateMetricsFromContent("original.go", original)
+	if err != nil {
+		return nil
+	}
+	after, err := metrics.CalculateMetricsFromContent("rewritten.go", rewritten)
+	if err != nil {
+		return nil
+	}
+	delta := metrics.CalculateDeltaMetrics(before, after)
+	return &MetricsReport{
+		Original:  NewFileMetrics(before),
+		Rewritten: NewFileMetrics(after),
+		LOCDelta:  delta.LOC.Percent,
+		CCDelta:   delta.CC.Percent,
+		CogCDelta: delta.CogC.Percent,
+	}
+}
+
+// NewFileMetrics selects the reported metrics from a full calculation
+func NewFileMetrics(m *metrics.Metrics) FileMetrics {
+	return FileMetrics{LOC: m.LOC, CC: m.CC, CogC: m.CogC, Functions: m.FuncCount}
+}
+
+// newJobID returns a random job identifier
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeQuotaError responds 429 with Retry-After to a QuotaError
+func writeQuotaError(w http.ResponseWriter, err error) {
+	var quota *QuotaError
+	if errors.As(err, &quota) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(quota.RetryAfter.Seconds()))))
+	}
+	writeError(w, http.StatusTooManyRequests, err)
+}
+
+// writeError responds with {"error": ...}, redacted like every other error the tools print
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": redact.String(err.Error())})
+}
@@ -0,0 +1,424 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/eval"
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+const source = "package p\n\nfunc add(a, b int) int {\n\tif a > b {\n\t\treturn a + b\n\t}\n\treturn b + a\n}\n"
+
+func post(t *testing.T, ts *httptest.Server, body any) *http.Response {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	resp, err := http.Post(ts.URL+"/v1/rewrite", "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	return resp
+}
+
+func decode(t *testing.T, resp *http.Response, v any) {
+	t.Helper()
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+}
+
+// TestRewrite tests synchronous rewrites and request validation
+func TestRewrite(t *testing.T) {
+	ts := httptest.NewServer(New(eval.StrategyComment, 2).Handler())
+	defer ts.Close()
+
+	resp := post(t, ts, RewriteRequest{Source: source})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	var result RewriteResult
+	decode(t, resp, &result)
+	if !result.Changed || !strings.Contains(result.Rewritten, "package p") {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if result.Metrics == nil || result.Metrics.Original.Functions != 1 || result.Metrics.Original.CC == 0 {
+		t.Errorf("Expected metrics of the original source, got %+v", result.Metrics)
+	}
+
+	cases := []struct {
+		name   string
+		body   any
+		status int
+	}{
+		{"invalid Go", RewriteRequest{Source: "package p\nfunc {"}, http.StatusBadRequest},
+		{"unknown strategy", RewriteRequest{Source: source, Strategy: "oracle"}, http.StatusBadRequest},
+		{"unknown field", map[string]string{"code": source}, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		resp := post(t, ts, c.body)
+		var body map[string]string
+		decode(t, resp, &body)
+		if resp.StatusCode != c.status || body["error"] == "" {
+			t.Errorf("%s: expected %d with an error, got %d %v", c.name, c.status, resp.StatusCode, body)
+		}
+	}
+}
+
+// TestRewriteJob tests that async and large requests become pollable jobs
+func TestRewriteJob(t *testing.T) {
+	s := New(eval.StrategyComment, 1)
+	s.AsyncThreshold = len(source) - 1
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp := post(t, ts, RewriteRequest{Source: source})
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected a large source to be accepted as a job, got %d", resp.StatusCode)
+	}
+	location := resp.Header.Get("Location")
+	var job Job
+	decode(t, resp, &job)
+	if job.ID == "" || location != "/v1/jobs/"+job.ID {
+		t.Fatalf("Unexpected job %+v at %q", job, location)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status != JobDone {
+		if job.Status == JobFailed || time.Now().After(deadline) {
+			t.Fatalf("Job did not complete: %+v", job)
+		}
+		time.Sleep(10 * time.Millisecond)
+		r, err := http.Get(ts.URL + location)
+		if err != nil {
+			t.Fatalf("Poll failed: %v", err)
+		}
+		decode(t, r, &job)
+	}
+	if job.Result == nil || !job.Result.Changed || job.Finished.IsZero() {
+		t.Errorf("Expected a finished job with a result, got %+v", job)
+	}
+
+	r, err := http.Get(ts.URL + "/v1/jobs/unknown")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	r.Body.Close()
+	if r.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown job, got %d", r.StatusCode)
+	}
+}
+
+// TestJobEvents tests that the progress of a job is streamed as server-sent
+// events, ending with the finished job
+func TestJobEvents(t *testing.T) {
+	s := New(eval.StrategyNone, 1)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp := post(t, ts, RewriteRequest{Source: source + "\nfunc sub(a, b int) int {\n\treturn a - b\n}\n", Async: true})
+	var job Job
+	decode(t, resp, &job)
+	resp, err := http.Get(ts.URL + "/v1/jobs/" + job.ID + "/events")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	var names []string
+	var last string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if name, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+			names = append(names, name)
+		} else if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			last = data
+		}
+	}
+	want := []string{rewriter.EventStarted, rewriter.EventSucceeded, rewriter.EventStarted, rewriter.EventSucceeded, "job"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected events %v, got %v", want, names)
+	}
+	var finished Job
+	if err := json.Unmarshal([]byte(last), &finished); err != nil || finished.Status != JobDone || finished.Result != nil {
+		t.Errorf("Expected the stream to end with the done job without its result, got %s (%v)", last, err)
+	}
+
+	resp, err = http.Get(ts.URL + "/v1/jobs/unknown/events")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown job, got %d", resp.StatusCode)
+	}
+}
+
+// waitJob polls a job until it has finished
+func waitJob(t *testing.T, ts *httptest.Server, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		r, err := http.Get(ts.URL + "/v1/jobs/" + id)
+		if err != nil {
+			t.Fatalf("Poll failed: %v", err)
+		}
+		var job Job
+		decode(t, r, &job)
+		if job.Status == JobDone || job.Status == JobFailed {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Job did not finish: %+v", job)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestJobStore tests that stored jobs are resumed after a restart, failed jobs
+// can be retried and the job history can be listed
+func TestJobStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenJobStore(dir)
+	if err != nil {
+		t.Fatalf("OpenJobStore failed: %v", err)
+	}
+	created := time.Now().UTC().Add(-time.Minute)
+	for i, status := range []JobStatus{JobPending, JobRunning, JobFailed} {
+		job := &storedJob{
+			Job:    Job{ID: string(status), Status: status, Strategy: eval.StrategyComment, Created: created.Add(time.Duration(i) * time.Second)},
+			Source: source,
+		}
+		if status == JobFailed {
+			job.Attempts, job.Error, job.Finished = 1, "provider unavailable", created
+		}
+		if err := store.Save(job); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted server picks up the jobs the previous one did not finish
+	s := New(eval.StrategyComment, 1)
+	resumed, err := s.UseJobStore(store)
+	if err != nil {
+		t.Fatalf("UseJobStore failed: %v", err)
+	}
+	if resumed != 2 {
+		t.Errorf("Expected the pending and running jobs to be resumed, got %d", resumed)
+	}
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	for _, id := range []string{"pending", "running"} {
+		if job := waitJob(t, ts, id); job.Status != JobDone || job.Attempts != 1 || job.Result == nil {
+			t.Errorf("Expected resumed job %s to be done after one attempt, got %+v", id, job)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "running.json"))
+	if err != nil || !strings.Contains(string(data), `"status":"done"`) {
+		t.Errorf("Expected the finished job to be saved, got %s (%v)", data, err)
+	}
+
+	resp, err := http.Post(ts.URL+"/v1/jobs/failed/retry", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected the failed job to be retried, got %d", resp.StatusCode)
+	}
+	if job := waitJob(t, ts, "failed"); job.Status != JobDone || job.Attempts != 2 || job.Error != "" {
+		t.Errorf("Expected the retried job to be done after a second attempt, got %+v", job)
+	}
+	for id, status := range map[string]int{"failed": http.StatusConflict, "unknown": http.StatusNotFound} {
+		resp, err := http.Post(ts.URL+"/v1/jobs/"+id+"/retry", "application/json", nil)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("Expected retrying %s to return %d, got %d", id, status, resp.StatusCode)
+		}
+	}
+
+	resp, err = http.Get(ts.URL + "/v1/jobs?status=done&limit=2")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	var list JobList
+	decode(t, resp, &list)
+	if len(list.Jobs) != 2 || list.Jobs[0].ID != "failed" || list.Jobs[0].Result != nil {
+		t.Errorf("Expected the two newest done jobs without results, got %+v", list.Jobs)
+	}
+	resp, err = http.Get(ts.URL + "/v1/jobs?status=lost")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown status, got %d", resp.StatusCode)
+	}
+}
+
+// writeTenants writes a tenants file for the API keys "alpha-key" and "beta-key"
+func writeTenants(t *testing.T) string {
+	t.Helper()
+	hash := func(key string) string {
+		sum := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(sum[:])
+	}
+	t.Setenv("ALPHA_OPENROUTER_KEY", "sk-or-alpha")
+	data, err := json.Marshal(map[string]any{"tenants": []map[string]any{
+		{"name": "alpha", "key_sha256": hash("alpha-key"), "openrouter_key_env": "ALPHA_OPENROUTER_KEY", "requests_per_minute": 3, "tokens_per_day": 1000},
+		{"name": "beta", "key_sha256": strings.ToUpper(hash("beta-key"))},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// call sends a request with an API key header, if key is not empty
+func call(t *testing.T, method, url, header, key string, body any) *http.Response {
+	t.Helper()
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		req.Header.Set(header, key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	return resp
+}
+
+// TestTenants tests API-key authentication, per-tenant jobs and quotas
+func TestTenants(t *testing.T) {
+	tenants, err := LoadTenants(writeTenants(t))
+	if err != nil {
+		t.Fatalf("LoadTenants failed: %v", err)
+	}
+	s := New(eval.StrategyComment, 1)
+	s.Tenants = tenants
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	rewrite := ts.URL + "/v1/rewrite"
+
+	for _, key := range []string{"", "gamma-key"} {
+		resp := call(t, http.MethodPost, rewrite, "Authorization", "Bearer "+key, RewriteRequest{Source: source})
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("Expected 401 for key %q, got %d", key, resp.StatusCode)
+		}
+	}
+
+	// Health checks need no key
+	resp := call(t, http.MethodGet, ts.URL+"/health", "X-API-Key", "", nil)
+	var health Health
+	decode(t, resp, &health)
+	if resp.StatusCode != http.StatusOK || health.Status != "ok" || health.Capacity != 1 {
+		t.Errorf("Expected the health check to pass without a key, got %d %+v", resp.StatusCode, health)
+	}
+
+	resp = call(t, http.MethodPost, rewrite, "Authorization", "Bearer alpha-key", RewriteRequest{Source: source, Async: true})
+	var job Job
+	decode(t, resp, &job)
+	if resp.StatusCode != http.StatusAccepted || job.Tenant != "alpha" {
+		t.Fatalf("Expected a job of tenant alpha, got %d %+v", resp.StatusCode, job)
+	}
+	resp = call(t, http.MethodGet, ts.URL+"/v1/jobs/"+job.ID, "X-API-Key", "beta-key", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected another tenant's job to be hidden, got %d", resp.StatusCode)
+	}
+	resp = call(t, http.MethodGet, ts.URL+"/v1/jobs", "X-API-Key", "beta-key", nil)
+	var list JobList
+	decode(t, resp, &list)
+	if len(list.Jobs) != 0 {
+		t.Errorf("Expected tenant beta to have no jobs, got %+v", list.Jobs)
+	}
+
+	// The tenant has no Gemini key, so it cannot fall back to the server's
+	resp = call(t, http.MethodPost, rewrite, "X-API-Key", "alpha-key", RewriteRequest{Source: source, Strategy: eval.StrategyGemini})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a provider without a tenant key, got %d", resp.StatusCode)
+	}
+
+	// Three requests per minute: the async job, the Gemini request and this one
+	resp = call(t, http.MethodPost, rewrite, "X-API-Key", "alpha-key", RewriteRequest{Source: source})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the third request to be admitted, got %d", resp.StatusCode)
+	}
+	resp = call(t, http.MethodPost, rewrite, "X-API-Key", "alpha-key", RewriteRequest{Source: source})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After past the rate quota, got %d", resp.StatusCode)
+	}
+	resp = call(t, http.MethodPost, rewrite, "X-API-Key", "beta-key", RewriteRequest{Source: source})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a tenant without quotas to be admitted, got %d", resp.StatusCode)
+	}
+
+	resp = call(t, http.MethodGet, ts.URL+"/v1/usage", "X-API-Key", "alpha-key", nil)
+	var usage Usage
+	decode(t, resp, &usage)
+	if usage.Tenant != "alpha" || usage.Requests != 3 || usage.RequestsPerMinute != 3 || usage.TokensPerDay != 1000 {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+
+	alpha := s.tenantByName("alpha")
+	alpha.addTokens(1000)
+	var quota *QuotaError
+	if err := s.Admit(WithTenant(context.Background(), alpha)); !errors.As(err, &quota) || quota.RetryAfter <= 0 {
+		t.Errorf("Expected the daily token quota to be exceeded, got %v", err)
+	}
+	if err := s.Admit(context.Background()); err != nil {
+		t.Errorf("Expected a request without a tenant to be admitted, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "unset.json")
+	data := `{"tenants": [{"name": "gamma", "key_sha256": "` + strings.Repeat("ab", sha256.Size) + `", "gemini_key_env": "METAMORPH_TEST_UNSET_KEY"}]}`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTenants(path); err == nil || !strings.Contains(err.Error(), "METAMORPH_TEST_UNSET_KEY") {
+		t.Errorf("Expected an error for an unset provider key variable, got %v", err)
+	}
+}
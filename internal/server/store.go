@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// storedJob is a job as saved by JobStore, with the source needed to run it again
+type storedJob struct {
+	Job
+	Source string `json:"source"`
+
+	events *eventLog // Progress of the current run; nil for jobs that finished before a restart
+}
+
+// JobStore keeps jobs in a directory, one JSON file per job, so queued and
+// finished jobs survive a restart of the server
+type JobStore struct {
+	Dir string
+}
+
+// OpenJobStore creates dir if needed and returns a store of the jobs in it
+func OpenJobStore(dir string) (*JobStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create job directory: %w", err)
+	}
+	return &JobStore{Dir: dir}, nil
+}
+
+// path returns the file of a job. IDs are generated by the server, so they
+// never contain a path separator.
+func (st *JobStore) path(id string) string {
+	return filepath.Join(st.Dir, id+".json")
+}
+
+// Save writes a job to a temporary file and renames it, so a crash never
+// leaves a half-written job behind
+func (st *JobStore) Save(job *storedJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job %s: %w", job.ID, err)
+	}
+	tmp, err := os.CreateTemp(st.Dir, job.ID+".json.tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create job file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write job %s: %w", job.ID, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync job %s: %w", job.ID, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write job %s: %w", job.ID, err)
+	}
+	if err := os.Rename(tmp.Name(), st.path(job.ID)); err != nil {
+		return fmt.Errorf("failed to commit job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+// Delete removes a job
+func (st *JobStore) Delete(id string) error {
+	if err := os.Remove(st.path(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove job %s: %w", id, err)
+	}
+	return nil
+}
+
+// Load reads every job in the store. Files that cannot be decoded are
+// reported and skipped rather than keeping the server from starting.
+func (st *JobStore) Load() ([]*storedJob, error) {
+	entries, err := os.ReadDir(st.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job directory: %w", err)
+	}
+	var jobs []*storedJob
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(st.Dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read job file: %w", err)
+		}
+		var job storedJob
+		if err := json.Unmarshal(data, &job); err != nil || job.ID+".json" != entry.Name() {
+			fmt.Fprintf(os.Stderr, "Warning: skipping unreadable job file %s\n", entry.Name())
+			continue
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
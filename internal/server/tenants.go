@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Hekzory/MetamorphLLM/internal/rewriter"
+)
+
+// Tenant is a client of a shared server with its own API key, provider
+// credentials and quotas
+type Tenant struct {
+	Name              string `json:"name"`
+	KeySHA256         string `json:"key_sha256"`                    // Hex SHA-256 of the tenant's API key
+	OpenRouterKeyEnv  string `json:"openrouter_key_env,omitempty"`  // Environment variable with the tenant's OpenRouter key
+	GeminiKeyEnv      string `json:"gemini_key_env,omitempty"`      // Environment variable with the tenant's Gemini key
+	AnthropicKeyEnv   string `json:"anthropic_key_env,omitempty"`   // Environment variable with the tenant's Anthropic key
+	RequestsPerMinute int    `json:"requests_per_minute,omitempty"` // 0 for no limit
+	TokensPerDay      int64  `json:"tokens_per_day,omitempty"`      // Provider tokens per UTC day, 0 for no limit
+
+	keys  map[rewriter.APIType]string
+	mu    sync.Mutex
+	usage Usage
+}
+
+// Usage is what a tenant has used of its quotas, as served at GET /v1/usage
+type Usage struct {
+	Tenant            string    `json:"tenant"`
+	Day               string    `json:"day"` // UTC day the token count belongs to, e.g. "2026-10-16"
+	Tokens            int64     `json:"tokens"`
+	TokensPerDay      int64     `json:"tokens_per_day,omitempty"`
+	Requests          int       `json:"requests"` // Requests admitted in the current minute
+	RequestsPerMinute int       `json:"requests_per_minute,omitempty"`
+	minute            time.Time // Start of the minute Requests counts
+}
+
+// QuotaError rejects a request that exceeds a tenant's quota
+type QuotaError struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *QuotaError) Error() string {
+	return e.Message
+}
+
+// ErrUnauthenticated rejects a request without a valid API key
+var ErrUnauthenticated = errors.New("missing or invalid API key")
+
+// tenantsFile is the format of the file LoadTenants reads
+type tenantsFile struct {
+	Tenants []*Tenant `json:"tenants"`
+}
+
+// LoadTenants reads a tenants file and resolves every tenant's provider
+// credentials from the environment
+func LoadTenants(path string) ([]*Tenant, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants file: %w", err)
+	}
+	var file tenantsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse tenants file %s: %w", path, err)
+	}
+	if len(file.Tenants) == 0 {
+		return nil, fmt.Errorf("tenants file %s has no tenants", path)
+	}
+
+	names := make(map[string]bool)
+	digests := make(map[string]bool)
+	for _, t := range file.Tenants {
+		if t.Name == "" || names[t.Name] {
+			return nil, fmt.Errorf("tenant names must be unique and not empty, got %q", t.Name)
+		}
+		names[t.Name] = true
+		t.KeySHA256 = strings.ToLower(t.KeySHA256)
+		if digest, err := hex.DecodeString(t.KeySHA256); err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("tenant %s: key_sha256 must be the hex SHA-256 of its API key", t.Name)
+		}
+		if digests[t.KeySHA256] {
+			return nil, fmt.Errorf("tenant %s: another tenant has the same API key", t.Name)
+		}
+		digests[t.KeySHA256] = true
+		if t.RequestsPerMinute < 0 || t.TokensPerDay < 0 {
+			return nil, fmt.Errorf("tenant %s: quotas must not be negative", t.Name)
+		}
+
+		t.keys = make(map[rewriter.APIType]string)
+		for api, env := range map[rewriter.APIType]string{rewriter.APITypeOpenRouter: t.OpenRouterKeyEnv, rewriter.APITypeGemini: t.GeminiKeyEnv, rewriter.APITypeAnthropic: t.AnthropicKeyEnv} {
+			if env == "" {
+				continue
+			}
+			key, ok := os.LookupEnv(env)
+			if !ok || key == "" {
+				return nil, fmt.Errorf("tenant %s: environment variable %s not set", t.Name, env)
+			}
+			t.keys[api] = key
+		}
+	}
+	return file.Tenants, nil
+}
+
+// Authenticate returns the tenant whose API key is key
+func (s *Server) Authenticate(key string) (*Tenant, error) {
+	if key == "" {
+		return nil, ErrUnauthenticated
+	}
+	sum := sha256.Sum256([]byte(key))
+	digest := hex.EncodeToString(sum[:])
+	var found *Tenant
+	// Every tenant is compared, so the time taken does not tell which one matched
+	for _, t := range s.Tenants {
+		if subtle.ConstantTimeCompare([]byte(digest), []byte(t.KeySHA256)) == 1 {
+			found = t
+		}
+	}
+	if found == nil {
+		return nil, ErrUnauthenticated
+	}
+	return found, nil
+}
+
+// BearerToken returns the key of an "Authorization: Bearer <key>" header value
+func BearerToken(header string) string {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+type tenantKey struct{}
+
+// WithTenant returns a context carrying the tenant a request is made for
+func WithTenant(ctx context.Context, t *Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, t)
+}
+
+// TenantFrom returns the tenant of a request, or nil on a server without tenants
+func TenantFrom(ctx context.Context) *Tenant {
+	t, _ := ctx.Value(tenantKey{}).(*Tenant)
+	return t
+}
+
+// tenantName returns the name of the request's tenant, or "" without tenants
+func tenantName(ctx context.Context) string {
+	if t := TenantFrom(ctx); t != nil {
+		return t.Name
+	}
+	return ""
+}
+
+// Admit counts a request against the quotas of its tenant, or rejects it
+// with a QuotaError. A rewrite admitted under the token quota is completed
+// even if it uses up more than what was left.
+func (s *Server) Admit(ctx context.Context) error {
+	t := TenantFrom(ctx)
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now().UTC()
+	t.rollover(now)
+
+	if t.TokensPerDay > 0 && t.usage.Tokens >= t.TokensPerDay {
+		tomorrow := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+		return &QuotaError{
+			Message:    fmt.Sprintf("tenant %s used its daily quota of %d tokens", t.Name, t.TokensPerDay),
+			RetryAfter: tomorrow.Sub(now),
+		}
+	}
+	if t.RequestsPerMinute > 0 && t.usage.Requests >= t.RequestsPerMinute {
+		return &QuotaError{
+			Message:    fmt.Sprintf("tenant %s exceeded its quota of %d requests per minute", t.Name, t.RequestsPerMinute),
+			RetryAfter: t.usage.minute.Add(time.Minute).Sub(now),
+		}
+	}
+	t.usage.Requests++
+	return nil
+}
+
+// addTokens counts provider tokens against the tenant's daily quota
+func (t *Tenant) addTokens(tokens int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover(time.Now().UTC())
+	t.usage.Tokens += tokens
+}
+
+// rollover starts a new minute or day of usage; callers hold t.mu
+func (t *Tenant) rollover(now time.Time) {
+	if day := now.Format(time.DateOnly); t.usage.Day != day {
+		t.usage.Day, t.usage.Tokens = day, 0
+	}
+	if minute := now.Truncate(time.Minute); !t.usage.minute.Equal(minute) {
+		t.usage.minute, t.usage.Requests = minute, 0
+	}
+}
+
+// Usage returns what the tenant has used of its quotas
+func (t *Tenant) Usage() Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover(time.Now().UTC())
+	usage := t.usage
+	usage.Tenant, usage.TokensPerDay, usage.RequestsPerMinute = t.Name, t.TokensPerDay, t.RequestsPerMinute
+	return usage
+}
+
+// tenantByName returns the configured tenant called name
+func (s *Server) tenantByName(name string) *Tenant {
+	for _, t := range s.Tenants {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
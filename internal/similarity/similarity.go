@@ -0,0 +1,224 @@
+// Package similarity scores how structurally different a rewritten Go file is
+// from the original. Both versions are type-checked and built into SSA form
+// (golang.org/x/tools/go/ssa). It compares their basic blocks, reduced to the
+// kinds and operators of their instructions so that renaming alone changes
+// nothing, and the call graphs between their functions.
+package similarity
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+
+	"github.com/Hekzory/MetamorphLLM/internal/metrics"
+)
+
+// Score describes how similar two versions of a file are
+type Score struct {
+	// BlockSimilarity is the weighted Jaccard similarity of the basic-block
+	// patterns, from 0 (no block in common) to 1 (the same blocks)
+	BlockSimilarity float64
+	// CallGraphDistance is the number of functions and calls between them
+	// that were added or removed
+	CallGraphDistance int
+	// CallGraphSimilarity is 1 minus the distance relative to the functions
+	// and calls of both versions together
+	CallGraphSimilarity float64
+}
+
+// Similarity is the mean of the block and call graph similarities; 1 means
+// the structure did not change
+func (s Score) Similarity() float64 {
+	return (s.BlockSimilarity + s.CallGraphSimilarity) / 2
+}
+
+// CompareFiles compares the original and rewritten files at the given paths
+func CompareFiles(originalPath, rewrittenPath string) (*Score, error) {
+	original, err := os.ReadFile(originalPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read original file: %w", err)
+	}
+	rewritten, err := os.ReadFile(rewrittenPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rewritten file: %w", err)
+	}
+	return Compare(string(original), string(rewritten))
+}
+
+// Compare compares original and rewritten Go source held in memory
+func Compare(original, rewritten string) (*Score, error) {
+	before, err := analyze(original)
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze original code: %w", err)
+	}
+	after, err := analyze(rewritten)
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze rewritten code: %w", err)
+	}
+
+	score := &Score{BlockSimilarity: jaccard(before.blocks, after.blocks)}
+	union := 0
+	for _, pair := range [][2]map[string]bool{{before.funcs, after.funcs}, {before.calls, after.calls}} {
+		for key := range pair[0] {
+			if !pair[1][key] {
+				score.CallGraphDistance++
+			}
+		}
+		for key := range pair[1] {
+			if !pair[0][key] {
+				score.CallGraphDistance++
+			}
+		}
+		union += len(pair[0]) + len(pair[1])
+	}
+	// Shared functions and calls were counted twice above
+	union = (union + score.CallGraphDistance) / 2
+	score.CallGraphSimilarity = 1
+	if union > 0 {
+		score.CallGraphSimilarity = 1 - float64(score.CallGraphDistance)/float64(union)
+	}
+	return score, nil
+}
+
+// jaccard is the weighted Jaccard similarity of two multisets, 1 if both are empty
+func jaccard(a, b map[string]int) float64 {
+	shared, total := 0, 0
+	for key, n := range a {
+		shared += min(n, b[key])
+		total += max(n, b[key])
+	}
+	for key, n := range b {
+		if _, ok := a[key]; !ok {
+			total += n
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+	return float64(shared) / float64(total)
+}
+
+// structure holds what is compared of one version of a file
+type structure struct {
+	blocks map[string]int           // Basic-block patterns and how often they occur
+	funcs  map[string]bool          // Functions, named as in metrics.FunctionName
+	calls  map[string]bool          // Calls between functions, "caller -> callee"
+	names  map[*ssa.Function]string // Names of the file's functions
+}
+
+// analyze parses and type-checks src, builds its SSA form and collects its
+// blocks and call graph
+func analyze(src string) (*structure, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	conf := &types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, info, err := ssautil.BuildPackage(conf, fset, types.NewPackage(f.Name.Name, f.Name.Name), []*ast.File{f}, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SSA: %w", err)
+	}
+
+	s := &structure{
+		blocks: make(map[string]int),
+		funcs:  make(map[string]bool),
+		calls:  make(map[string]bool),
+		names:  make(map[*ssa.Function]string),
+	}
+	var funcs []*ssa.Function
+	for _, decl := range f.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		obj, ok := info.Defs[fd.Name].(*types.Func)
+		if !ok {
+			continue
+		}
+		fn := pkg.Prog.FuncValue(obj)
+		if fn == nil {
+			continue
+		}
+		name := metrics.FunctionName(fd)
+		s.funcs[name] = true
+		s.names[fn] = name
+		funcs = append(funcs, fn)
+	}
+	for _, fn := range funcs {
+		s.collect(s.names[fn], fn)
+	}
+	return s, nil
+}
+
+// collect counts the block patterns of fn and records its calls as made by
+// caller. Function literals are collected along with the function they are in.
+func (s *structure) collect(caller string, fn *ssa.Function) {
+	for _, block := range fn.Blocks {
+		var pattern []string
+		for _, instr := range block.Instrs {
+			if _, ok := instr.(*ssa.DebugRef); ok {
+				continue
+			}
+			pattern = append(pattern, shape(instr))
+			if call, ok := instr.(ssa.CallInstruction); ok {
+				if callee := s.callee(call.Common()); callee != "" {
+					s.calls[caller+" -> "+callee] = true
+				}
+			}
+		}
+		s.blocks[strings.Join(pattern, "; ")]++
+	}
+	for _, anon := range fn.AnonFuncs {
+		s.collect(caller, anon)
+	}
+}
+
+// callee names the function a call goes to: functions of the file as in
+// metrics.FunctionName, imported functions as pkg.Func and other methods as
+// .Method. Calls of function values and of function literals are left out.
+func (s *structure) callee(call *ssa.CallCommon) string {
+	if call.IsInvoke() {
+		return "." + call.Method.Name()
+	}
+	fn := call.StaticCallee()
+	if fn == nil {
+		return ""
+	}
+	if origin := fn.Origin(); origin != nil {
+		fn = origin
+	}
+	if name, ok := s.names[fn]; ok {
+		return name
+	}
+	switch {
+	case fn.Parent() != nil:
+		return ""
+	case fn.Signature.Recv() != nil:
+		return "." + fn.Name()
+	case fn.Pkg != nil:
+		return fn.Pkg.Pkg.Name() + "." + fn.Name()
+	}
+	return ""
+}
+
+// shape describes an instruction by its kind, and by its operator for unary
+// and binary operations, leaving out registers, names and values
+func shape(instr ssa.Instruction) string {
+	kind := strings.TrimPrefix(fmt.Sprintf("%T", instr), "*ssa.")
+	switch instr := instr.(type) {
+	case *ssa.BinOp:
+		return kind + " " + instr.Op.String()
+	case *ssa.UnOp:
+		return kind + " " + instr.Op.String()
+	}
+	return kind
+}
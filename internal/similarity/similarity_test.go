@@ -0,0 +1,94 @@
+package similarity
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+const original = `package p
+
+import "fmt"
+
+func sum(items []int) int {
+	total := 0
+	for _, item := range items {
+		if item > 0 {
+			total += item
+		}
+	}
+	return total
+}
+
+func report(items []int) {
+	fmt.Println(sum(items))
+}
+`
+
+// TestIdentical tests that identical code and renamed variables score 1
+func TestIdentical(t *testing.T) {
+	score, err := Compare(original, original)
+	if err != nil {
+		t.Fatalf("Compare failed: %v", err)
+	}
+	if score.Similarity() != 1 || score.CallGraphDistance != 0 {
+		t.Errorf("Expected identical code to score 1, got %+v", score)
+	}
+
+	renamed := strings.NewReplacer("total", "acc", "item", "x").Replace(original)
+	score, err = Compare(original, renamed)
+	if err != nil {
+		t.Fatalf("Compare failed: %v", err)
+	}
+	if score.Similarity() != 1 {
+		t.Errorf("Expected renaming alone to score 1, got %+v", score)
+	}
+}
+
+// TestRestructured tests that new blocks and calls lower the score
+func TestRestructured(t *testing.T) {
+	rewritten := `package p
+
+import "fmt"
+
+func positive(n int) bool {
+	return n > 0
+}
+
+func sum(items []int) int {
+	total := 0
+	for i := 0; i < len(items); i++ {
+		if !positive(items[i]) {
+			continue
+		}
+		total += items[i]
+	}
+	return total
+}
+
+func report(items []int) {
+	fmt.Printf("%d\n", sum(items))
+}
+`
+	score, err := Compare(original, rewritten)
+	if err != nil {
+		t.Fatalf("Compare failed: %v", err)
+	}
+	if score.BlockSimilarity <= 0 || score.BlockSimilarity >= 1 {
+		t.Errorf("Expected some blocks in common, got %f", score.BlockSimilarity)
+	}
+	// Added: positive, sum -> positive, report -> fmt.Printf; removed: report -> fmt.Println
+	if score.CallGraphDistance != 4 {
+		t.Errorf("Expected a call graph distance of 4, got %d", score.CallGraphDistance)
+	}
+	// Together: sum, report, positive and 4 calls (report -> sum is shared)
+	if want := 1 - 4.0/7; math.Abs(score.CallGraphSimilarity-want) > 1e-9 {
+		t.Errorf("Expected call graph similarity %f, got %f", want, score.CallGraphSimilarity)
+	}
+	if _, err := Compare(original, "package"); err == nil || !strings.Contains(err.Error(), "rewritten") {
+		t.Errorf("Expected a parse error for the rewritten code, got %v", err)
+	}
+	if _, err := Compare(original, "package p\n\nfunc f() int { return undefined }\n"); err == nil || !strings.Contains(err.Error(), "SSA") {
+		t.Errorf("Expected code that does not type-check to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package telemetry
+
+// Default is the process-wide registry served by Serve
+var Default = NewRegistry()
+
+// Status label values
+const (
+	StatusOK          = "ok"
+	StatusError       = "error"
+	StatusRateLimited = "rate_limited"
+)
+
+// Cache result label values
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+var (
+	// ProviderRequests counts LLM API calls, one per attempt
+	ProviderRequests = Default.NewCounterVec("metamorph_provider_requests_total",
+		"LLM API calls by provider, model and outcome.", "provider", "model", "status")
+	// ProviderLatency records the duration of each LLM API call
+	ProviderLatency = Default.NewHistogramVec("metamorph_provider_request_duration_seconds",
+		"LLM API call latency in seconds.", "provider", "model")
+	// ProviderTokens counts the tokens LLM API calls used, prompt and response
+	ProviderTokens = Default.NewCounterVec("metamorph_provider_tokens_total",
+		"Tokens used by LLM API calls, prompt and response, by provider and model.", "provider", "model")
+	// ProviderRetries counts retries after a failed LLM API call
+	ProviderRetries = Default.NewCounterVec("metamorph_provider_retries_total",
+		"LLM API calls retried after a failure, by reason.", "provider", "reason")
+	// CacheLookups counts cache lookups; hit rate is hits over all lookups
+	CacheLookups = Default.NewCounterVec("metamorph_cache_lookups_total",
+		"Cache lookups by cache and result (hit or miss).", "cache", "result")
+	// StageDuration records how long each pipeline stage took
+	StageDuration = Default.NewHistogramVec("metamorph_stage_duration_seconds",
+		"Pipeline stage duration in seconds.", "stage", "status")
+	// PipelineRuns counts complete pipeline runs
+	PipelineRuns = Default.NewCounterVec("metamorph_pipeline_runs_total",
+		"Complete pipeline runs by outcome.", "status")
+)
+
+// Status maps an error to the ok/error status label
+func Status(err error) string {
+	if err != nil {
+		return StatusError
+	}
+	return StatusOK
+}
@@ -0,0 +1,71 @@
+package telemetry
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("test_requests_total", "Requests.", "provider", "status")
+	latency := r.NewHistogramVec("test_latency_seconds", "Latency.", "provider")
+
+	requests.Inc("gemini", StatusOK)
+	requests.Inc("gemini", StatusOK)
+	requests.Inc("openrouter", StatusRateLimited)
+	requests.Inc("модель \"x\"\\\n", StatusOK)
+	latency.Observe(0.3, "gemini")
+	latency.Observe(7, "gemini")
+
+	if got := requests.Value("gemini", StatusOK); got != 2 {
+		t.Errorf("Expected counter value 2, got %v", got)
+	}
+	if got := latency.Count("gemini"); got != 2 {
+		t.Errorf("Expected 2 observations, got %d", got)
+	}
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE test_requests_total counter",
+		`test_requests_total{provider="gemini",status="ok"} 2`,
+		`test_requests_total{provider="openrouter",status="rate_limited"} 1`,
+		`test_requests_total{provider="модель \"x\"\\\n",status="ok"} 1`,
+		"# TYPE test_latency_seconds histogram",
+		`test_latency_seconds_bucket{provider="gemini",le="0.25"} 0`,
+		`test_latency_seconds_bucket{provider="gemini",le="0.5"} 1`,
+		`test_latency_seconds_bucket{provider="gemini",le="10"} 2`,
+		`test_latency_seconds_bucket{provider="gemini",le="+Inf"} 2`,
+		`test_latency_seconds_sum{provider="gemini"} 7.3`,
+		`test_latency_seconds_count{provider="gemini"} 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	if strings.Index(out, "test_latency_seconds") > strings.Index(out, "test_requests_total") {
+		t.Error("Expected metrics to be sorted by name")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("test_runs_total", "Runs.").Inc()
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "test_runs_total 1\n") {
+		t.Errorf("Unexpected body:\n%s", rec.Body.String())
+	}
+}